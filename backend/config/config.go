@@ -0,0 +1,414 @@
+// Package config loads the server's configuration from a config file and the
+// environment
+package config
+
+import (
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxArchiveSize is the default MAX_UPLOAD_BYTES, bounding uploaded files
+	MaxArchiveSize = 32 << 20
+
+	defaultMaxBodyBytes     = 1 << 20
+	defaultMaxAuthBodyBytes = 16 << 10
+	defaultMaxBulkBodyBytes = 10 << 20
+)
+
+// Databases, selected by DB_DRIVER
+const (
+	DBDriverMySQL  = "mysql"
+	DBDriverSQLite = "sqlite"
+)
+
+// Stores for backed-up contacts, selected by BACKUP_STORE
+const (
+	BackupStoreFirestore = "firestore"
+	BackupStoreGCS       = "gcs"
+	BackupStoreS3        = "s3"
+	BackupStoreLocal     = "local"
+	BackupStoreMemory    = "memory"
+)
+
+// Key management services wrapping the data key, selected by KMS_PROVIDER.
+// With none the data key is DATA_ENCRYPTION_KEY itself.
+const (
+	KMSProviderNone   = "none"
+	KMSProviderGoogle = "gcp"
+	KMSProviderLocal  = "local"
+)
+
+// Services signup CAPTCHA tokens are verified with, selected by
+// CAPTCHA_PROVIDER. With none signups aren't challenged.
+const (
+	CaptchaProviderNone      = "none"
+	CaptchaProviderTurnstile = "turnstile"
+	CaptchaProviderReCAPTCHA = "recaptcha"
+)
+
+// Services contacts' phone numbers are verified with, selected by
+// PHONE_VERIFICATION_PROVIDER. With none phone numbers can't be verified.
+const (
+	PhoneVerificationProviderNone   = "none"
+	PhoneVerificationProviderTwilio = "twilio"
+)
+
+// Services reporting the phone numbers known for spam and robocalls,
+// selected by SPAM_REPUTATION_PROVIDER. With none only users' blocked
+// numbers are flagged.
+const (
+	SpamReputationProviderNone     = "none"
+	SpamReputationProviderNomorobo = "nomorobo"
+)
+
+// Services suggesting contacts' photos and companies from their email
+// addresses, selected by CONTACT_ENRICHMENT_PROVIDER. With none contacts
+// aren't enriched.
+const (
+	ContactEnrichmentProviderNone     = "none"
+	ContactEnrichmentProviderGravatar = "gravatar"
+	ContactEnrichmentProviderClearbit = "clearbit"
+)
+
+// Stores for rate limit buckets, selected by RATE_LIMIT_STORE
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// Config holds all configuration for the application
+type Config struct {
+	DBDriver       string
+	DBPath         string
+	DBHost         string
+	DBPort         string
+	DBUser         string
+	DBPassword     string
+	DBName         string
+	AutoMigrate    bool
+	JWTSecret      string
+	AdminEmails    []string
+	DataKey        string
+	KMSProvider    string
+	KMSKeyName     string
+	KMSLocalKey    string
+	ServerPort     string
+	FirebaseConfig string
+	BackupStore    string
+	BackupBucket   string
+	BackupPrefix   string
+	BackupDir      string
+	S3Region       string
+	S3Endpoint     string
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	BackupKeepLast        int
+	BackupRetention       time.Duration
+	BackupMaxBytes        int64
+	BackupCleanupInterval time.Duration
+
+	TombstoneRetention time.Duration
+	AuditRetention     time.Duration
+	StartupTimeout     time.Duration
+	ShutdownTimeout    time.Duration
+	RequestTimeout     time.Duration
+	DBTimeout          time.Duration
+
+	// AccountDeletionGrace is how long after its owner asks for it an account
+	// is erased, during which they can cancel
+	AccountDeletionGrace time.Duration
+	// RefreshTokenLifetime is how long a refresh token is valid, so how long
+	// a client can stay signed in without using it
+	RefreshTokenLifetime time.Duration
+	// ImportTokenLifetime is how long the tokens issued to import tools are
+	// valid
+	ImportTokenLifetime time.Duration
+	// AccessTokenLifetime is how long the scoped tokens issued to
+	// integrations are valid
+	AccessTokenLifetime time.Duration
+	// ImpersonationLifetime is how long the tokens admins are issued to act
+	// as a user are valid
+	ImpersonationLifetime time.Duration
+
+	MailProvider   string
+	SMTPHost       string
+	SMTPPort       string
+	SMTPUser       string
+	SMTPPassword   string
+	SMTPFrom       string
+	SendGridAPIKey string
+	ReminderHour   int
+
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFromNumber string
+
+	CaptchaProvider string
+	CaptchaSecret   string
+
+	// PhoneVerificationProvider looks up contacts' phone numbers; twilio
+	// uses Twilio Lookup with the Twilio account's credentials
+	PhoneVerificationProvider string
+
+	// SpamReputationProvider flags the spam numbers lookups and new contacts
+	// call from; nomorobo uses the Nomorobo Spam Score add-on of Twilio
+	// Lookup with the Twilio account's credentials
+	SpamReputationProvider string
+
+	// ContactEnrichmentProvider suggests photos and companies for the
+	// contacts of users who opted in; gravatar only finds photos, and
+	// clearbit uses the Clearbit Enrichment API with ClearbitAPIKey
+	ContactEnrichmentProvider string
+	ClearbitAPIKey            string
+
+	// StripeSecretKey turns billing on, charging for the pro plan through
+	// Stripe; without it every account has the pro plan
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	StripeProPriceID    string
+	// BillingReturnURL is where Stripe sends users back to from checkout
+	// and the billing portal
+	BillingReturnURL   string
+	FreeMaxContacts    int
+	FreeBackupMaxBytes int64
+
+	// GoogleClientID and GoogleClientSecret are the OAuth client users
+	// connect their Google account with to sync their contacts; without
+	// them the Google integration is off
+	GoogleClientID     string
+	GoogleClientSecret string
+	// MicrosoftClientID and MicrosoftClientSecret are the Microsoft Entra
+	// app users connect their Outlook account with, signing in through
+	// MicrosoftTenant; without them the Outlook integration is off
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftTenant       string
+	// ContactSyncInterval is how often connected accounts are synced
+	ContactSyncInterval time.Duration
+
+	// IFTTTServiceKey is the service key of the PhoneSaver service on IFTTT,
+	// which IFTTT sends with every request; without it the IFTTT endpoints
+	// are off. IFTTTTestEmail is the account IFTTT's endpoint tests run as.
+	IFTTTServiceKey string
+	IFTTTTestEmail  string
+	// IFTTTClientID and IFTTTClientSecret are the OAuth client IFTTT
+	// connects users' accounts with
+	IFTTTClientID     string
+	IFTTTClientSecret string
+
+	LogLevel  slog.Level
+	LogFormat string
+
+	RateLimitStore          string
+	RedisURL                string
+	RateLimitAPIInterval    time.Duration
+	RateLimitAPIBurst       int
+	RateLimitSignupInterval time.Duration
+	RateLimitSignupBurst    int
+	AuthDelayBase           time.Duration
+	AuthDelayMax            time.Duration
+	AuthDelayAfter          int
+	AuthFailureWindow       time.Duration
+
+	Environment          string
+	CORSOrigins          []string
+	CORSMethods          []string
+	CORSHeaders          []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// SecureHeaders turns the security headers below on; with it off they
+	// are left to a reverse proxy
+	SecureHeaders         bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	CSPPolicy             string
+	PermissionsPolicy     string
+	FrameOptions          string
+
+	// TrustedProxies are the proxies whose X-Forwarded-For the client IP is
+	// taken from; when unset no proxy is trusted and the client IP is the
+	// peer's address
+	TrustedProxies   []string
+	AdminIPAllowlist []string
+	IPDenylist       []string
+	GeoCountryHeader string
+	BlockedCountries []string
+
+	TLSCertFile     string
+	TLSKeyFile      string
+	ACMEDomains     []string
+	ACMEEmail       string
+	ACMECacheDir    string
+	TLSRedirectPort string
+
+	MaxBodyBytes     int64
+	MaxAuthBodyBytes int64
+	MaxBulkBodyBytes int64
+	MaxUploadBytes   int64
+}
+
+// Load loads configuration from the YAML config file at path, if path is not
+// empty, and from environment variables, which override the file's settings.
+// Every problem with the merged configuration is reported before exiting.
+func Load(path string) *Config {
+	l, err := newLoader(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := &Config{
+		DBDriver:       l.get("DB_DRIVER", DBDriverMySQL),
+		DBPath:         l.get("DB_PATH", "phonesaver.db"),
+		DBHost:         l.get("DB_HOST", ""),
+		DBPort:         l.get("DB_PORT", ""),
+		DBUser:         l.get("DB_USER", ""),
+		DBPassword:     l.get("DB_PASSWORD", ""),
+		DBName:         l.get("DB_NAME", ""),
+		AutoMigrate:    l.getBool("AUTO_MIGRATE", true),
+		JWTSecret:      l.get("JWT_SECRET", ""),
+		AdminEmails:    l.getList("ADMIN_EMAILS", nil),
+		DataKey:        l.get("DATA_ENCRYPTION_KEY", ""),
+		KMSProvider:    l.get("KMS_PROVIDER", KMSProviderNone),
+		KMSKeyName:     l.get("KMS_KEY_NAME", ""),
+		KMSLocalKey:    l.get("KMS_LOCAL_KEY", ""),
+		ServerPort:     l.get("SERVER_PORT", "8080"),
+		FirebaseConfig: l.get("FIREBASE_CONFIG", ""),
+		BackupStore:    l.get("BACKUP_STORE", BackupStoreFirestore),
+		BackupBucket:   l.get("BACKUP_BUCKET", ""),
+		BackupPrefix:   l.get("BACKUP_PREFIX", ""),
+		BackupDir:      l.get("BACKUP_DIR", "backups"),
+		S3Region:       l.get("S3_REGION", "us-east-1"),
+		S3Endpoint:     l.get("S3_ENDPOINT", ""),
+
+		DBMaxOpenConns:    l.getInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:    l.getInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime: l.getDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+
+		BackupKeepLast:        l.getInt("BACKUP_KEEP_LAST", 10),
+		BackupRetention:       l.getDuration("BACKUP_RETENTION", 30*24*time.Hour),
+		BackupMaxBytes:        int64(l.getInt("BACKUP_MAX_BYTES_PER_USER", 50<<20)),
+		BackupCleanupInterval: l.getDuration("BACKUP_CLEANUP_INTERVAL", time.Hour),
+
+		TombstoneRetention: l.getDuration("TOMBSTONE_RETENTION", 30*24*time.Hour),
+		AuditRetention:     l.getDuration("AUDIT_RETENTION", 365*24*time.Hour),
+		StartupTimeout:     l.getDuration("STARTUP_TIMEOUT", 30*time.Second),
+		ShutdownTimeout:    l.getDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		RequestTimeout:     l.getDuration("REQUEST_TIMEOUT", 30*time.Second),
+		DBTimeout:          l.getDuration("DB_TIMEOUT", 10*time.Second),
+
+		AccountDeletionGrace:  l.getDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour),
+		RefreshTokenLifetime:  l.getDuration("REFRESH_TOKEN_LIFETIME", 30*24*time.Hour),
+		ImportTokenLifetime:   l.getDuration("IMPORT_TOKEN_LIFETIME", 30*24*time.Hour),
+		AccessTokenLifetime:   l.getDuration("ACCESS_TOKEN_LIFETIME", 90*24*time.Hour),
+		ImpersonationLifetime: l.getDuration("IMPERSONATION_LIFETIME", 30*time.Minute),
+
+		MailProvider:   l.get("MAIL_PROVIDER", ""),
+		SMTPHost:       l.get("SMTP_HOST", ""),
+		SMTPPort:       l.get("SMTP_PORT", "587"),
+		SMTPUser:       l.get("SMTP_USER", ""),
+		SMTPPassword:   l.get("SMTP_PASSWORD", ""),
+		SMTPFrom:       l.get("SMTP_FROM", ""),
+		SendGridAPIKey: l.get("SENDGRID_API_KEY", ""),
+		ReminderHour:   l.getInt("REMINDER_HOUR", 8),
+
+		TwilioAccountSID: l.get("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:  l.get("TWILIO_AUTH_TOKEN", ""),
+		TwilioFromNumber: l.get("TWILIO_FROM_NUMBER", ""),
+
+		CaptchaProvider: l.get("CAPTCHA_PROVIDER", CaptchaProviderNone),
+		CaptchaSecret:   l.get("CAPTCHA_SECRET", ""),
+
+		PhoneVerificationProvider: l.get("PHONE_VERIFICATION_PROVIDER", PhoneVerificationProviderNone),
+
+		SpamReputationProvider: l.get("SPAM_REPUTATION_PROVIDER", SpamReputationProviderNone),
+
+		ContactEnrichmentProvider: l.get("CONTACT_ENRICHMENT_PROVIDER", ContactEnrichmentProviderNone),
+		ClearbitAPIKey:            l.get("CLEARBIT_API_KEY", ""),
+
+		StripeSecretKey:     l.get("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret: l.get("STRIPE_WEBHOOK_SECRET", ""),
+		StripeProPriceID:    l.get("STRIPE_PRO_PRICE_ID", ""),
+		BillingReturnURL:    l.get("BILLING_RETURN_URL", ""),
+		FreeMaxContacts:     l.getInt("FREE_MAX_CONTACTS", 500),
+		FreeBackupMaxBytes:  int64(l.getInt("FREE_BACKUP_MAX_BYTES", 5<<20)),
+
+		GoogleClientID:        l.get("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:    l.get("GOOGLE_CLIENT_SECRET", ""),
+		MicrosoftClientID:     l.get("MICROSOFT_CLIENT_ID", ""),
+		MicrosoftClientSecret: l.get("MICROSOFT_CLIENT_SECRET", ""),
+		MicrosoftTenant:       l.get("MICROSOFT_TENANT", "common"),
+		ContactSyncInterval:   l.getDuration("CONTACT_SYNC_INTERVAL", 15*time.Minute),
+
+		IFTTTServiceKey:   l.get("IFTTT_SERVICE_KEY", ""),
+		IFTTTTestEmail:    l.get("IFTTT_TEST_EMAIL", ""),
+		IFTTTClientID:     l.get("IFTTT_CLIENT_ID", ""),
+		IFTTTClientSecret: l.get("IFTTT_CLIENT_SECRET", ""),
+
+		LogFormat: l.get("LOG_FORMAT", "text"),
+
+		RateLimitStore:          l.get("RATE_LIMIT_STORE", RateLimitStoreMemory),
+		RedisURL:                l.get("REDIS_URL", ""),
+		RateLimitAPIInterval:    l.getDuration("RATE_LIMIT_API_INTERVAL", time.Second),
+		RateLimitAPIBurst:       l.getInt("RATE_LIMIT_API_BURST", 100),
+		RateLimitSignupInterval: l.getDuration("RATE_LIMIT_SIGNUP_INTERVAL", time.Minute),
+		RateLimitSignupBurst:    l.getInt("RATE_LIMIT_SIGNUP_BURST", 100),
+		AuthDelayBase:           l.getDuration("AUTH_DELAY_BASE", 500*time.Millisecond),
+		AuthDelayMax:            l.getDuration("AUTH_DELAY_MAX", 10*time.Second),
+		AuthDelayAfter:          l.getInt("AUTH_DELAY_AFTER", 3),
+		AuthFailureWindow:       l.getDuration("AUTH_FAILURE_WINDOW", 15*time.Minute),
+
+		Environment:          l.get("APP_ENV", envProduction),
+		CORSMethods:          l.getList("CORS_METHODS", defaultCORSMethods),
+		CORSHeaders:          l.getList("CORS_HEADERS", defaultCORSHeaders),
+		CORSAllowCredentials: l.getBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           l.getDuration("CORS_MAX_AGE", defaultCORSMaxAge),
+
+		SecureHeaders:         l.getBool("SECURE_HEADERS", true),
+		HSTSMaxAge:            l.getDuration("HSTS_MAX_AGE", defaultHSTSMaxAge),
+		HSTSIncludeSubdomains: l.getBool("HSTS_INCLUDE_SUBDOMAINS", true),
+		HSTSPreload:           l.getBool("HSTS_PRELOAD", false),
+		CSPPolicy:             l.get("CSP_POLICY", defaultCSPPolicy),
+		PermissionsPolicy:     l.get("PERMISSIONS_POLICY", defaultPermissionsPolicy),
+		FrameOptions:          l.get("FRAME_OPTIONS", FrameOptionsDeny),
+
+		TrustedProxies:   l.getList("TRUSTED_PROXIES", nil),
+		AdminIPAllowlist: l.getList("ADMIN_IP_ALLOWLIST", nil),
+		IPDenylist:       l.getList("IP_DENYLIST", nil),
+		GeoCountryHeader: l.get("GEO_COUNTRY_HEADER", ""),
+		BlockedCountries: l.getList("GEO_BLOCKED_COUNTRIES", nil),
+
+		TLSCertFile:     l.get("TLS_CERT_FILE", ""),
+		TLSKeyFile:      l.get("TLS_KEY_FILE", ""),
+		ACMEDomains:     l.getList("ACME_DOMAINS", nil),
+		ACMEEmail:       l.get("ACME_EMAIL", ""),
+		ACMECacheDir:    l.get("ACME_CACHE_DIR", "certs"),
+		TLSRedirectPort: l.get("TLS_REDIRECT_PORT", ""),
+
+		MaxBodyBytes:     int64(l.getInt("MAX_BODY_BYTES", defaultMaxBodyBytes)),
+		MaxAuthBodyBytes: int64(l.getInt("MAX_AUTH_BODY_BYTES", defaultMaxAuthBodyBytes)),
+		MaxBulkBodyBytes: int64(l.getInt("MAX_BULK_BODY_BYTES", defaultMaxBulkBodyBytes)),
+		MaxUploadBytes:   int64(l.getInt("MAX_UPLOAD_BYTES", MaxArchiveSize)),
+	}
+	config.CORSOrigins = l.getList("CORS_ORIGINS", defaultCORSOrigins(config.Environment))
+	if err := config.LogLevel.UnmarshalText([]byte(l.get("LOG_LEVEL", "info"))); err != nil {
+		l.invalid("LOG_LEVEL", "must be debug, info, warn or error")
+	}
+	l.checkUnknown()
+	l.validate(config)
+
+	if len(l.errs) > 0 {
+		problems := make([]string, len(l.errs))
+		for i, err := range l.errs {
+			problems[i] = "  " + err.Error()
+		}
+		log.Fatalf("Invalid configuration:\n%s", strings.Join(problems, "\n"))
+	}
+	return config
+}
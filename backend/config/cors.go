@@ -0,0 +1,47 @@
+package config
+
+import "time"
+
+const (
+	envDevelopment = "development"
+	envProduction  = "production"
+)
+
+// defaultCORSMaxAge is how long browsers may cache preflight responses
+const defaultCORSMaxAge = 12 * time.Hour
+
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Origin", "Content-Type", "Authorization", "If-Match", "If-None-Match", "If-Modified-Since", "Idempotency-Key", "X-Request-ID"}
+)
+
+// defaultCORSOrigins returns the origins allowed when CORS_ORIGINS is unset:
+// any origin in development, and none in production, where the app's
+// origins must be listed explicitly
+func defaultCORSOrigins(env string) []string {
+	if env == envDevelopment {
+		return []string{"*"}
+	}
+	return nil
+}
+
+// validateCORS checks the CORS settings, which browsers reject if credentials
+// are allowed for any origin
+func (l *loader) validateCORS(cfg *Config) {
+	if cfg.Environment != envDevelopment && cfg.Environment != envProduction {
+		l.invalid("APP_ENV", "must be %s or %s", envDevelopment, envProduction)
+	}
+	if cfg.CORSAllowCredentials && AllOrigins(cfg.CORSOrigins) {
+		l.invalid("CORS_ALLOW_CREDENTIALS", "requires CORS_ORIGINS to list origins rather than *")
+	}
+}
+
+// AllOrigins reports whether origins allows any origin
+func AllOrigins(origins []string) bool {
+	for _, origin := range origins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
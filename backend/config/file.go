@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileSetting is a setting read from the config file
+type fileSetting struct {
+	value string
+	// key is the setting's key as written in the file, such as db.host
+	key string
+}
+
+// loader reads settings from the environment and falls back to the config
+// file, collecting the problems it finds so they can be reported together
+type loader struct {
+	path string
+	file map[string]fileSetting
+	used map[string]bool
+	errs []error
+}
+
+// newLoader reads the YAML config file at path, or only the environment if
+// path is empty. Nested keys are joined with underscores to name the
+// environment variable they set, so
+//
+//	db:
+//	  host: localhost
+//
+// sets DB_HOST, and lists set comma-separated values.
+func newLoader(path string) (*loader, error) {
+	l := &loader{path: path, file: map[string]fileSetting{}, used: map[string]bool{}}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if err := l.flatten("", "", doc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return l, nil
+}
+
+func (l *loader) flatten(name, key string, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for k, child := range v {
+			childName := strings.ToUpper(strings.ReplaceAll(k, "-", "_"))
+			childKey := k
+			if name != "" {
+				childName = name + "_" + childName
+				childKey = key + "." + k
+			}
+			if err := l.flatten(childName, childKey, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s must be a list of values", key)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return l.set(name, key, strings.Join(items, ","))
+	default:
+		return l.set(name, key, fmt.Sprint(v))
+	}
+}
+
+func (l *loader) set(name, key, value string) error {
+	if name == "" {
+		return fmt.Errorf("the file must be a mapping of settings")
+	}
+	if existing, ok := l.file[name]; ok {
+		return fmt.Errorf("%s and %s both set %s", existing.key, key, name)
+	}
+	l.file[name] = fileSetting{value: value, key: key}
+	return nil
+}
+
+// lookup returns the value of a setting, which is empty if it is not set
+func (l *loader) lookup(name string) string {
+	l.used[name] = true
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return l.file[name].value
+}
+
+// describe names a setting in error messages, including where in the config
+// file it was set if it was not overridden by the environment
+func (l *loader) describe(name string) string {
+	if setting, ok := l.file[name]; ok && os.Getenv(name) == "" {
+		return fmt.Sprintf("%s (%s in %s)", name, setting.key, l.path)
+	}
+	return name
+}
+
+// invalid records a problem with a setting
+func (l *loader) invalid(name, format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf("%s %s", l.describe(name), fmt.Sprintf(format, args...)))
+}
+
+// checkUnknown records a problem for each setting in the file that the
+// server does not have, which is most likely misspelled
+func (l *loader) checkUnknown() {
+	var unknown []string
+	for name, setting := range l.file {
+		if !l.used[name] {
+			unknown = append(unknown, setting.key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.errs = append(l.errs, fmt.Errorf("unknown setting %s in %s", key, l.path))
+	}
+}
+
+func (l *loader) get(name, defaultValue string) string {
+	if value := l.lookup(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (l *loader) getInt(name string, defaultValue int) int {
+	value := l.lookup(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.invalid(name, "must be an integer, got %q", value)
+		return defaultValue
+	}
+	return n
+}
+
+func (l *loader) getBool(name string, defaultValue bool) bool {
+	value := l.lookup(name)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.invalid(name, "must be true or false, got %q", value)
+		return defaultValue
+	}
+	return b
+}
+
+// getList parses a comma-separated list, ignoring empty entries
+func (l *loader) getList(name string, defaultValue []string) []string {
+	value := l.lookup(name)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getDuration parses a duration such as "90m" or "12h", also accepting a
+// "d" suffix for whole days such as "7d"
+func (l *loader) getDuration(name string, defaultValue time.Duration) time.Duration {
+	value := l.lookup(name)
+	if value == "" {
+		return defaultValue
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			l.invalid(name, "must be a duration such as 90m, 12h or 7d, got %q", value)
+			return defaultValue
+		}
+		return time.Duration(n) * 24 * time.Hour
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.invalid(name, "must be a duration such as 90m, 12h or 7d, got %q", value)
+		return defaultValue
+	}
+	return d
+}
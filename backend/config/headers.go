@@ -0,0 +1,34 @@
+package config
+
+import "time"
+
+// Values of FRAME_OPTIONS, sent as X-Frame-Options; with none the header is
+// left out
+const (
+	FrameOptionsDeny       = "DENY"
+	FrameOptionsSameOrigin = "SAMEORIGIN"
+	FrameOptionsNone       = "none"
+)
+
+const (
+	// defaultHSTSMaxAge is how long browsers remember to only use HTTPS
+	defaultHSTSMaxAge = 365 * 24 * time.Hour
+	// defaultCSPPolicy lets API responses load nothing and be framed
+	// nowhere, which suits JSON
+	defaultCSPPolicy = "default-src 'none'; frame-ancestors 'none'"
+	// defaultPermissionsPolicy denies the browser features an API response
+	// never needs
+	defaultPermissionsPolicy = "camera=(), microphone=(), geolocation=(), payment=(), usb=()"
+)
+
+// validateSecurityHeaders checks the security header policy
+func (l *loader) validateSecurityHeaders(cfg *Config) {
+	switch cfg.FrameOptions {
+	case FrameOptionsDeny, FrameOptionsSameOrigin, FrameOptionsNone:
+	default:
+		l.invalid("FRAME_OPTIONS", "must be %s, %s or %s", FrameOptionsDeny, FrameOptionsSameOrigin, FrameOptionsNone)
+	}
+	if cfg.HSTSMaxAge < 0 {
+		l.invalid("HSTS_MAX_AGE", "must not be negative")
+	}
+}
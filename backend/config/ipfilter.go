@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseIPPrefixes parses a list of IP addresses and CIDR ranges, such as
+// 203.0.113.7 or 10.0.0.0/8, into prefixes; a single address is a prefix of
+// its full length
+func ParseIPPrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q", value)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// validateIPFilters checks the IP and country lists requests are filtered
+// by
+func (l *loader) validateIPFilters(cfg *Config) {
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"TRUSTED_PROXIES", cfg.TrustedProxies},
+		{"ADMIN_IP_ALLOWLIST", cfg.AdminIPAllowlist},
+		{"IP_DENYLIST", cfg.IPDenylist},
+	} {
+		if _, err := ParseIPPrefixes(list.values); err != nil {
+			l.invalid(list.name, "%v", err)
+		}
+	}
+	for _, country := range cfg.BlockedCountries {
+		if len(country) != 2 {
+			l.invalid("GEO_BLOCKED_COUNTRIES", "must list two-letter ISO 3166 country codes, got %q", country)
+		}
+	}
+	if len(cfg.BlockedCountries) > 0 && cfg.GeoCountryHeader == "" {
+		l.invalid("GEO_COUNTRY_HEADER", "must be set when GEO_BLOCKED_COUNTRIES is")
+	}
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"phonesaver-backend/encryption"
+)
+
+// validate checks the merged configuration, recording every problem it finds
+func (l *loader) validate(cfg *Config) {
+	l.validateCORS(cfg)
+	l.validateSecurityHeaders(cfg)
+	l.validateIPFilters(cfg)
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		l.invalid("LOG_FORMAT", "must be text or json")
+	}
+
+	switch cfg.DBDriver {
+	case DBDriverMySQL:
+		var missing []string
+		for _, setting := range []struct{ name, value string }{
+			{"DB_HOST", cfg.DBHost}, {"DB_PORT", cfg.DBPort}, {"DB_USER", cfg.DBUser},
+			{"DB_PASSWORD", cfg.DBPassword}, {"DB_NAME", cfg.DBName},
+		} {
+			if setting.value == "" {
+				missing = append(missing, setting.name)
+			}
+		}
+		if len(missing) > 0 {
+			l.invalid("DB_DRIVER", "is mysql, which requires %s to be set", strings.Join(missing, ", "))
+		}
+	case DBDriverSQLite:
+		if cfg.DBPath == "" {
+			l.invalid("DB_PATH", "must be set when DB_DRIVER is sqlite")
+		}
+	default:
+		l.invalid("DB_DRIVER", "must be mysql or sqlite")
+	}
+
+	if cfg.DBMaxOpenConns < 0 {
+		l.invalid("DB_MAX_OPEN_CONNS", "must not be negative")
+	}
+	if cfg.DBMaxIdleConns < 0 {
+		l.invalid("DB_MAX_IDLE_CONNS", "must not be negative")
+	}
+	if cfg.DBConnMaxLifetime < 0 {
+		l.invalid("DB_CONN_MAX_LIFETIME", "must not be negative")
+	}
+
+	if cfg.JWTSecret == "" {
+		l.invalid("JWT_SECRET", "must be set")
+	}
+	l.validateDataKey(cfg)
+
+	l.validatePort("SERVER_PORT", cfg.ServerPort)
+	l.validatePort("DB_PORT", cfg.DBPort)
+	l.validatePort("SMTP_PORT", cfg.SMTPPort)
+	l.validatePort("TLS_REDIRECT_PORT", cfg.TLSRedirectPort)
+	if cfg.ReminderHour < 0 || cfg.ReminderHour > 23 {
+		l.invalid("REMINDER_HOUR", "must be between 0 and 23")
+	}
+
+	switch cfg.RateLimitStore {
+	case RateLimitStoreMemory:
+	case RateLimitStoreRedis:
+		if cfg.RedisURL == "" {
+			l.invalid("REDIS_URL", "must be set when RATE_LIMIT_STORE is redis")
+		}
+	default:
+		l.invalid("RATE_LIMIT_STORE", "must be %s or %s", RateLimitStoreMemory, RateLimitStoreRedis)
+	}
+
+	if cfg.AuthDelayAfter < 0 {
+		l.invalid("AUTH_DELAY_AFTER", "must not be negative")
+	}
+	if cfg.AuthDelayBase < 0 {
+		l.invalid("AUTH_DELAY_BASE", "must not be negative")
+	}
+	if cfg.AuthDelayMax < cfg.AuthDelayBase {
+		l.invalid("AUTH_DELAY_MAX", "must not be less than AUTH_DELAY_BASE")
+	}
+
+	switch cfg.CaptchaProvider {
+	case CaptchaProviderNone:
+	case CaptchaProviderTurnstile, CaptchaProviderReCAPTCHA:
+		if cfg.CaptchaSecret == "" {
+			l.invalid("CAPTCHA_SECRET", "must be set when CAPTCHA_PROVIDER is %s", cfg.CaptchaProvider)
+		}
+	default:
+		l.invalid("CAPTCHA_PROVIDER", "must be %s, %s or %s", CaptchaProviderNone,
+			CaptchaProviderTurnstile, CaptchaProviderReCAPTCHA)
+	}
+
+	switch cfg.PhoneVerificationProvider {
+	case PhoneVerificationProviderNone:
+	case PhoneVerificationProviderTwilio:
+		for _, setting := range []struct{ name, value string }{
+			{"TWILIO_ACCOUNT_SID", cfg.TwilioAccountSID},
+			{"TWILIO_AUTH_TOKEN", cfg.TwilioAuthToken},
+		} {
+			if setting.value == "" {
+				l.invalid(setting.name, "must be set when PHONE_VERIFICATION_PROVIDER is %s", cfg.PhoneVerificationProvider)
+			}
+		}
+	default:
+		l.invalid("PHONE_VERIFICATION_PROVIDER", "must be %s or %s", PhoneVerificationProviderNone, PhoneVerificationProviderTwilio)
+	}
+
+	switch cfg.SpamReputationProvider {
+	case SpamReputationProviderNone:
+	case SpamReputationProviderNomorobo:
+		for _, setting := range []struct{ name, value string }{
+			{"TWILIO_ACCOUNT_SID", cfg.TwilioAccountSID},
+			{"TWILIO_AUTH_TOKEN", cfg.TwilioAuthToken},
+		} {
+			if setting.value == "" {
+				l.invalid(setting.name, "must be set when SPAM_REPUTATION_PROVIDER is %s", cfg.SpamReputationProvider)
+			}
+		}
+	default:
+		l.invalid("SPAM_REPUTATION_PROVIDER", "must be %s or %s", SpamReputationProviderNone, SpamReputationProviderNomorobo)
+	}
+
+	switch cfg.ContactEnrichmentProvider {
+	case ContactEnrichmentProviderNone, ContactEnrichmentProviderGravatar:
+	case ContactEnrichmentProviderClearbit:
+		if cfg.ClearbitAPIKey == "" {
+			l.invalid("CLEARBIT_API_KEY", "must be set when CONTACT_ENRICHMENT_PROVIDER is %s", cfg.ContactEnrichmentProvider)
+		}
+	default:
+		l.invalid("CONTACT_ENRICHMENT_PROVIDER", "must be %s, %s or %s", ContactEnrichmentProviderNone,
+			ContactEnrichmentProviderGravatar, ContactEnrichmentProviderClearbit)
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{"MAX_BODY_BYTES", cfg.MaxBodyBytes},
+		{"MAX_AUTH_BODY_BYTES", cfg.MaxAuthBodyBytes},
+		{"MAX_BULK_BODY_BYTES", cfg.MaxBulkBodyBytes},
+		{"MAX_UPLOAD_BYTES", cfg.MaxUploadBytes},
+		{"RATE_LIMIT_API_BURST", int64(cfg.RateLimitAPIBurst)},
+		{"RATE_LIMIT_SIGNUP_BURST", int64(cfg.RateLimitSignupBurst)},
+	} {
+		if limit.value <= 0 {
+			l.invalid(limit.name, "must be positive")
+		}
+	}
+	switch cfg.BackupStore {
+	case BackupStoreFirestore, BackupStoreMemory:
+	case BackupStoreGCS, BackupStoreS3:
+		if cfg.BackupBucket == "" {
+			l.invalid("BACKUP_BUCKET", "must be set when BACKUP_STORE is %s", cfg.BackupStore)
+		}
+	case BackupStoreLocal:
+		if cfg.BackupDir == "" {
+			l.invalid("BACKUP_DIR", "must be set when BACKUP_STORE is local")
+		}
+	default:
+		l.invalid("BACKUP_STORE", "must be %s, %s, %s, %s or %s", BackupStoreFirestore,
+			BackupStoreGCS, BackupStoreS3, BackupStoreLocal, BackupStoreMemory)
+	}
+	if cfg.StripeSecretKey != "" {
+		for _, setting := range []struct{ name, value string }{
+			{"STRIPE_WEBHOOK_SECRET", cfg.StripeWebhookSecret},
+			{"STRIPE_PRO_PRICE_ID", cfg.StripeProPriceID},
+			{"BILLING_RETURN_URL", cfg.BillingReturnURL},
+		} {
+			if setting.value == "" {
+				l.invalid(setting.name, "must be set when STRIPE_SECRET_KEY is")
+			}
+		}
+	}
+	if (cfg.GoogleClientID == "") != (cfg.GoogleClientSecret == "") {
+		l.invalid("GOOGLE_CLIENT_SECRET", "must be set together with GOOGLE_CLIENT_ID")
+	}
+	if (cfg.MicrosoftClientID == "") != (cfg.MicrosoftClientSecret == "") {
+		l.invalid("MICROSOFT_CLIENT_SECRET", "must be set together with MICROSOFT_CLIENT_ID")
+	}
+	if cfg.MicrosoftClientID != "" && cfg.MicrosoftTenant == "" {
+		l.invalid("MICROSOFT_TENANT", "must be set when MICROSOFT_CLIENT_ID is")
+	}
+	if cfg.IFTTTServiceKey != "" {
+		for _, setting := range []struct{ name, value string }{
+			{"IFTTT_CLIENT_ID", cfg.IFTTTClientID},
+			{"IFTTT_CLIENT_SECRET", cfg.IFTTTClientSecret},
+		} {
+			if setting.value == "" {
+				l.invalid(setting.name, "must be set when IFTTT_SERVICE_KEY is")
+			}
+		}
+	}
+	if cfg.FreeMaxContacts < 0 {
+		l.invalid("FREE_MAX_CONTACTS", "must not be negative")
+	}
+	if cfg.FreeBackupMaxBytes < 0 {
+		l.invalid("FREE_BACKUP_MAX_BYTES", "must not be negative")
+	}
+	if cfg.BackupKeepLast < 0 {
+		l.invalid("BACKUP_KEEP_LAST", "must not be negative")
+	}
+	if cfg.BackupMaxBytes < 0 {
+		l.invalid("BACKUP_MAX_BYTES_PER_USER", "must not be negative")
+	}
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"BACKUP_CLEANUP_INTERVAL", cfg.BackupCleanupInterval},
+		{"STARTUP_TIMEOUT", cfg.StartupTimeout},
+		{"SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout},
+		{"REQUEST_TIMEOUT", cfg.RequestTimeout},
+		{"DB_TIMEOUT", cfg.DBTimeout},
+		{"RATE_LIMIT_API_INTERVAL", cfg.RateLimitAPIInterval},
+		{"RATE_LIMIT_SIGNUP_INTERVAL", cfg.RateLimitSignupInterval},
+		{"AUTH_FAILURE_WINDOW", cfg.AuthFailureWindow},
+		{"REFRESH_TOKEN_LIFETIME", cfg.RefreshTokenLifetime},
+		{"IMPORT_TOKEN_LIFETIME", cfg.ImportTokenLifetime},
+		{"ACCESS_TOKEN_LIFETIME", cfg.AccessTokenLifetime},
+		{"IMPERSONATION_LIFETIME", cfg.ImpersonationLifetime},
+		{"CONTACT_SYNC_INTERVAL", cfg.ContactSyncInterval},
+	} {
+		if interval.value <= 0 {
+			l.invalid(interval.name, "must be positive")
+		}
+	}
+}
+
+// validatePort checks that a port, if set, is a TCP port number
+func (l *loader) validatePort(name, value string) {
+	if value == "" {
+		return
+	}
+	if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+		l.invalid(name, "must be a port number between 1 and 65535, got %q", value)
+	}
+}
+
+// validateDataKey checks the data key contacts are encrypted with, or the
+// KMS it is wrapped with
+func (l *loader) validateDataKey(cfg *Config) {
+	if cfg.DataKey != "" {
+		if _, err := encryption.ParseKey(cfg.DataKey); err != nil {
+			l.invalid("DATA_ENCRYPTION_KEY", "must be %d bytes encoded in base64, e.g. from openssl rand -base64 32", encryption.KeySize)
+		}
+	}
+
+	switch cfg.KMSProvider {
+	case KMSProviderNone:
+		if cfg.DataKey == "" {
+			l.invalid("DATA_ENCRYPTION_KEY", "must be set when KMS_PROVIDER is %s", KMSProviderNone)
+		}
+	case KMSProviderGoogle:
+		if cfg.KMSKeyName == "" {
+			l.invalid("KMS_KEY_NAME", "must be set when KMS_PROVIDER is %s", KMSProviderGoogle)
+		} else if !strings.HasPrefix(cfg.KMSKeyName, "projects/") || !strings.Contains(cfg.KMSKeyName, "/cryptoKeys/") {
+			l.invalid("KMS_KEY_NAME", "must be a key name such as projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY")
+		}
+	case KMSProviderLocal:
+		if cfg.KMSLocalKey == "" {
+			l.invalid("KMS_LOCAL_KEY", "must be set when KMS_PROVIDER is %s", KMSProviderLocal)
+		} else if _, err := encryption.ParseKey(cfg.KMSLocalKey); err != nil {
+			l.invalid("KMS_LOCAL_KEY", "must be %d bytes encoded in base64, e.g. from openssl rand -base64 32", encryption.KeySize)
+		}
+	default:
+		l.invalid("KMS_PROVIDER", "must be %s, %s or %s", KMSProviderNone, KMSProviderGoogle, KMSProviderLocal)
+	}
+}
@@ -0,0 +1,170 @@
+// Package encryption encrypts the personal data the server stores, such as
+// contacts' phone numbers, with the data key it is configured with
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// KeySize is the size of a data key, which selects AES-256
+	KeySize = 32
+	// prefix marks values encrypted by a Cipher, and the format they are in
+	prefix = "v1:"
+	// indexKeyLabel derives the key of blind indexes from the data key, so
+	// the index of a value reveals nothing about how it was encrypted
+	indexKeyLabel = "phonesaver-blind-index"
+)
+
+// ErrKeySize is returned for a data key that is not KeySize bytes long
+var ErrKeySize = fmt.Errorf("data key must be %d bytes", KeySize)
+
+// ParseKey decodes a base64-encoded data key, such as one generated with
+// openssl rand -base64 32
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("data key must be base64-encoded")
+	}
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	return key, nil
+}
+
+// Cipher encrypts values with AES-GCM and computes blind indexes of them,
+// keyed hashes that let encrypted values be matched exactly without being
+// decrypted
+type Cipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// NewCipher creates a Cipher for a KeySize-byte data key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(indexKeyLabel))
+	return &Cipher{aead: aead, indexKey: mac.Sum(nil)}, nil
+}
+
+// Encrypt encrypts plaintext, bound to associatedData so the result can't be
+// moved to another record and decrypted there. The result is text, safe to
+// store in a VARCHAR column.
+func (c *Cipher) Encrypt(plaintext, associatedData string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(associatedData))
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt with the same associatedData.
+// Values that were never encrypted are returned as they are, so data
+// written before encryption was enabled stays readable.
+func (c *Cipher) Decrypt(value, associatedData string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %v", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("ciphertext is truncated")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(associatedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// Index returns the blind index of value, the hex-encoded HMAC-SHA256 of it
+// under a key derived from the data key. Equal values have equal indexes.
+func (c *Cipher) Index(value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether value was returned by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Keyring holds the versions of the data key. The current version encrypts
+// new values, and every version decrypts the values it encrypted, so values
+// can be re-encrypted to a new version gradually.
+type Keyring struct {
+	ciphers map[int]*Cipher
+	current int
+}
+
+// NewKeyring creates a Keyring of data keys by version, whose current
+// version is current
+func NewKeyring(keys map[int][]byte, current int) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no data key of version %d", current)
+	}
+	ring := &Keyring{ciphers: make(map[int]*Cipher, len(keys)), current: current}
+	for version, key := range keys {
+		c, err := NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("data key version %d: %v", version, err)
+		}
+		ring.ciphers[version] = c
+	}
+	return ring, nil
+}
+
+// Current returns the version new values are encrypted with and its Cipher
+func (r *Keyring) Current() (int, *Cipher) {
+	return r.current, r.ciphers[r.current]
+}
+
+// Version returns the Cipher of a version of the data key
+func (r *Keyring) Version(version int) (*Cipher, error) {
+	c, ok := r.ciphers[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown data key version %d", version)
+	}
+	return c, nil
+}
+
+// Indexes returns the blind index of value under every version, to match
+// values indexed before and after a rotation alike
+func (r *Keyring) Indexes(value string) []string {
+	versions := make([]int, 0, len(r.ciphers))
+	for version := range r.ciphers {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	indexes := make([]string, len(versions))
+	for i, version := range versions {
+		indexes[i] = r.ciphers[version].Index(value)
+	}
+	return indexes
+}
@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// errCorrupted is returned when a checksum shows a request or response to
+// Cloud KMS was corrupted in transit
+var errCorrupted = errors.New("cloud kms request was corrupted in transit")
+
+// crc32c is the checksum Cloud KMS verifies requests and responses with
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// googleKMS wraps data keys with a Google Cloud KMS symmetric key. Rotating
+// the key in Cloud KMS makes its new primary version wrap data keys from
+// then on, while data keys wrapped with older versions can still be
+// unwrapped as long as those versions are enabled.
+type googleKMS struct {
+	client  *kms.KeyManagementClient
+	keyName string
+}
+
+// NewGoogleKMS connects to Google Cloud KMS to wrap data keys with the key
+// named keyName, such as
+// projects/my-project/locations/global/keyRings/phonesaver/cryptoKeys/data-keys
+func NewGoogleKMS(ctx context.Context, keyName string, opts ...option.ClientOption) (KMS, error) {
+	client, err := kms.NewKeyManagementClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing cloud kms client: %v", err)
+	}
+	return &googleKMS{client: client, keyName: keyName}, nil
+}
+
+func (k *googleKMS) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	resp, err := k.client.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:            k.keyName,
+		Plaintext:       dataKey,
+		PlaintextCrc32C: wrapperspb.Int64(checksum(dataKey)),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to wrap data key: %v", err)
+	}
+	if !resp.VerifiedPlaintextCrc32C || resp.CiphertextCrc32C == nil || resp.CiphertextCrc32C.Value != checksum(resp.Ciphertext) {
+		return nil, "", errCorrupted
+	}
+	return resp.Ciphertext, resp.Name, nil
+}
+
+func (k *googleKMS) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := k.client.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:             k.keyName,
+		Ciphertext:       wrapped,
+		CiphertextCrc32C: wrapperspb.Int64(checksum(wrapped)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+	if resp.PlaintextCrc32C == nil || resp.PlaintextCrc32C.Value != checksum(resp.Plaintext) {
+		return nil, errCorrupted
+	}
+	return resp.Plaintext, nil
+}
+
+func (k *googleKMS) Close() error {
+	return k.client.Close()
+}
+
+func checksum(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32c))
+}
@@ -0,0 +1,80 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"time"
+)
+
+type Contact struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Phone           string     `json:"phone"`
+	EncryptedPhone  string     `json:"encryptedPhone"`
+	Tags            []string   `json:"tags"`
+	LastInteraction *time.Time `json:"lastInteraction,omitempty"`
+	Birthday        *time.Time `json:"birthday,omitempty"`
+	Version         int        `json:"version"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	// The contact's interactions, newest first
+	Interactions []*Interaction `json:"interactions"`
+}
+
+type ContactFrequency struct {
+	ContactID          int        `json:"contactId"`
+	Contact            *Contact   `json:"contact"`
+	Interactions       int        `json:"interactions"`
+	PerWeek            float64    `json:"perWeek"`
+	CallsPerWeek       float64    `json:"callsPerWeek"`
+	AverageGapDays     *float64   `json:"averageGapDays,omitempty"`
+	LongestStreakWeeks int        `json:"longestStreakWeeks"`
+	LastInteraction    *time.Time `json:"lastInteraction,omitempty"`
+	DaysSince          *int       `json:"daysSince,omitempty"`
+}
+
+type Interaction struct {
+	ID        int       `json:"id"`
+	ContactID int       `json:"contactId"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Note      *string   `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Contact   *Contact  `json:"contact"`
+}
+
+type InteractionInsights struct {
+	Stats     *InteractionStats   `json:"stats"`
+	Contacts  []*ContactFrequency `json:"contacts"`
+	Neglected []*NeglectedContact `json:"neglected"`
+}
+
+type InteractionStats struct {
+	Total             int                     `json:"total"`
+	ByType            []*InteractionTypeCount `json:"byType"`
+	PerWeek           float64                 `json:"perWeek"`
+	CallsPerWeek      float64                 `json:"callsPerWeek"`
+	LongestStreakDays int                     `json:"longestStreakDays"`
+	CurrentStreakDays int                     `json:"currentStreakDays"`
+}
+
+type InteractionTypeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+type NeglectedContact struct {
+	ContactID int      `json:"contactId"`
+	Contact   *Contact `json:"contact"`
+	DaysSince *int     `json:"daysSince,omitempty"`
+	Reason    string   `json:"reason"`
+}
+
+type Query struct {
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+	// The contacts with the tag
+	Contacts []*Contact `json:"contacts"`
+}
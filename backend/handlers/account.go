@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// accountExportVersion is bumped whenever the layout of the account data
+	// export changes
+	accountExportVersion = 1
+	// auditExportPage is how many audit events are read per query when
+	// exporting the audit log
+	auditExportPage = 500
+)
+
+// ExportAccount returns everything stored about the user as a JSON document,
+// downloaded as a file, so the user can take their data elsewhere
+func (a *App) ExportAccount(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	export, err := a.exportAccount(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to export account data: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to export account data",
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditAccountExport, map[string]string{
+		"contacts": strconv.Itoa(len(export.Contacts)),
+	}))
+
+	filename := fmt.Sprintf("phonesaver-account-%s.json", export.ExportedAt.Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, export)
+}
+
+// exportAccount collects the user's data for ExportAccount
+func (a *App) exportAccount(ctx context.Context, userID int) (models.AccountExport, error) {
+	export := models.AccountExport{Version: accountExportVersion, ExportedAt: time.Now().UTC()}
+
+	err := a.store.DB.QueryRowContext(ctx, "SELECT id, email, created_at FROM users WHERE id = ?", userID).Scan(
+		&export.Account.ID, &export.Account.Email, &export.Account.CreatedAt,
+	)
+	if err != nil {
+		return export, fmt.Errorf("failed to load account: %v", err)
+	}
+
+	contacts, err := a.store.Contacts.ListAll(ctx, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to load contacts: %v", err)
+	}
+	export.Contacts = models.NewContactResponses(contacts)
+
+	if export.Interactions, err = a.exportInteractions(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load interactions: %v", err)
+	}
+	if export.Reminders, err = a.exportReminders(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load reminders: %v", err)
+	}
+	if export.ShareLinks, err = a.store.ShareLinks.ListByUser(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load share links: %v", err)
+	}
+	if export.Backups, err = a.exportBackups(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load backups: %v", err)
+	}
+	if export.Devices, err = a.exportDevices(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load devices: %v", err)
+	}
+	settings, err := a.loadNotificationSettings(ctx, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to load notification settings: %v", err)
+	}
+	export.NotificationSettings = settings.Redacted()
+	if export.Notifications, err = a.exportNotifications(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load notifications: %v", err)
+	}
+	if export.Webhooks, err = a.exportWebhooks(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load webhooks: %v", err)
+	}
+	if export.AuditLog, err = a.exportAuditLog(ctx, userID); err != nil {
+		return export, fmt.Errorf("failed to load audit log: %v", err)
+	}
+	return export, nil
+}
+
+// exportInteractions returns all of the user's interactions, oldest first
+func (a *App) exportInteractions(ctx context.Context, userID int) ([]models.Interaction, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT id, contact_id, type, occurred_at, note, note_key_version, call_direction, call_duration, created_at FROM interactions WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interactions := []models.Interaction{}
+	for rows.Next() {
+		var interaction models.Interaction
+		var note sql.NullString
+		var noteVersion sql.NullInt64
+		if err := rows.Scan(
+			&interaction.ID, &interaction.ContactID, &interaction.Type, &interaction.Timestamp, &note, &noteVersion,
+			&interaction.Direction, &interaction.Duration, &interaction.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if interaction.Note, err = a.store.OpenNote(ctx, userID, repository.InteractionNote, note.String, noteVersion); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, rows.Err()
+}
+
+// exportReminders returns all of the user's reminders, active and completed,
+// oldest first
+func (a *App) exportReminders(ctx context.Context, userID int) ([]models.Reminder, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT "+reminderColumns+" FROM reminders r JOIN contacts c ON c.id = r.contact_id WHERE r.user_id = ? ORDER BY r.id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []models.Reminder{}
+	for rows.Next() {
+		reminder, err := a.scanReminder(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+// exportBackups returns the records of the user's backups, oldest first
+func (a *App) exportBackups(ctx context.Context, userID int) ([]models.BackupManifest, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT id, user_id, mode, status, written, deleted, unchanged, total, checksum, encrypted, size_bytes, started_at, completed_at
+		FROM backups WHERE user_id = ? ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backups := []models.BackupManifest{}
+	for rows.Next() {
+		var manifest models.BackupManifest
+		var checksum sql.NullString
+		var completedAt sql.NullTime
+		if err := rows.Scan(
+			&manifest.ID, &manifest.UserID, &manifest.Mode, &manifest.Status, &manifest.Written, &manifest.Deleted,
+			&manifest.Unchanged, &manifest.Total, &checksum, &manifest.Encrypted, &manifest.SizeBytes,
+			&manifest.StartedAt, &completedAt,
+		); err != nil {
+			return nil, err
+		}
+		manifest.Checksum = checksum.String
+		if completedAt.Valid {
+			manifest.CompletedAt = &completedAt.Time
+		}
+		backups = append(backups, manifest)
+	}
+	return backups, rows.Err()
+}
+
+// exportDevices returns the devices the user has logged in from, oldest
+// first
+func (a *App) exportDevices(ctx context.Context, userID int) ([]models.Device, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT device_id, name, last_sync_token, last_sync_at, last_seen_at, created_at FROM devices WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		var device models.Device
+		var token sql.NullString
+		var lastSyncAt sql.NullTime
+		if err := rows.Scan(&device.ID, &device.Name, &token, &lastSyncAt, &device.LastSeenAt, &device.CreatedAt); err != nil {
+			return nil, err
+		}
+		device.LastSyncToken = token.String
+		if lastSyncAt.Valid {
+			device.LastSyncAt = &lastSyncAt.Time
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// exportNotifications returns the notifications sent to the user, oldest
+// first
+func (a *App) exportNotifications(ctx context.Context, userID int) ([]models.NotificationDelivery, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT id, channel, kind, recipient, subject, status, attempts, error, created_at, sent_at
+		FROM notification_deliveries WHERE user_id = ? ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var delivery models.NotificationDelivery
+		var deliveryErr sql.NullString
+		var sentAt sql.NullTime
+		if err := rows.Scan(
+			&delivery.ID, &delivery.Channel, &delivery.Kind, &delivery.Recipient, &delivery.Subject,
+			&delivery.Status, &delivery.Attempts, &deliveryErr, &delivery.CreatedAt, &sentAt,
+		); err != nil {
+			return nil, err
+		}
+		delivery.Error = deliveryErr.String
+		if sentAt.Valid {
+			delivery.SentAt = &sentAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// exportWebhooks returns the user's webhooks, without their secrets
+func (a *App) exportWebhooks(ctx context.Context, userID int) ([]models.Webhook, error) {
+	rows, err := a.store.DB.QueryContext(ctx, "SELECT id, url, events, format, created_at FROM webhooks WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		var subscribed string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &subscribed, &webhook.Format, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(subscribed, ",")
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// exportAuditLog returns the user's whole audit log, newest first
+func (a *App) exportAuditLog(ctx context.Context, userID int) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	query := repository.AuditQuery{Limit: auditExportPage}
+	for {
+		page, err := a.store.Audit.List(ctx, userID, query)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < query.Limit {
+			return events, nil
+		}
+		query.Before = page[len(page)-1].ID
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// accountDeletionInterval is how often accounts due to be erased are looked
+// for
+const accountDeletionInterval = time.Hour
+
+// accountDeletionRequest is the body of a request to erase the account,
+// which the user confirms with their password
+type accountDeletionRequest struct {
+	Password string `json:"password" binding:"required,max=100"`
+}
+
+// GetAccountDeletion reports whether the user's account is scheduled to be
+// erased
+func (a *App) GetAccountDeletion(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	deleteAt, err := a.store.Users.DeletionScheduledAt(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get account deletion",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    models.AccountDeletion{Scheduled: deleteAt != nil, DeleteAt: deleteAt},
+	})
+}
+
+// RequestAccountDeletion schedules the user's account to be erased after
+// the grace period, during which it keeps working and the request can be
+// cancelled. Asking again keeps the original schedule.
+func (a *App) RequestAccountDeletion(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req accountDeletionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	err := a.authService.VerifyPassword(c.Request.Context(), userID.(int), req.Password)
+	if err == services.ErrInvalidCredentials {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Invalid password",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to verify password: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to schedule account deletion",
+		})
+		return
+	}
+
+	deleteAt, err := a.store.Users.ScheduleDeletion(c.Request.Context(), userID.(int), time.Now().Add(a.cfg.AccountDeletionGrace))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to schedule account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to schedule account deletion",
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditDeletionRequested, map[string]string{
+		"delete_at": deleteAt.UTC().Format(time.RFC3339),
+	}))
+
+	c.JSON(http.StatusAccepted, models.Response{
+		Success: true,
+		Data:    models.AccountDeletion{Scheduled: true, DeleteAt: &deleteAt},
+	})
+}
+
+// CancelAccountDeletion cancels the scheduled erasure of the user's account
+func (a *App) CancelAccountDeletion(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	cancelled, err := a.store.Users.CancelDeletion(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to cancel account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to cancel account deletion",
+		})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Account deletion is not scheduled",
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditDeletionCancelled, nil))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    models.AccountDeletion{},
+	})
+}
+
+// RunAccountDeletions periodically erases the accounts whose grace period
+// has passed
+func (a *App) RunAccountDeletions() {
+	ticker := time.NewTicker(accountDeletionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		users, err := a.store.Users.ListDueForDeletion(ctx, time.Now())
+		if err != nil {
+			logging.Errorf("Failed to find accounts to erase: %v", err)
+			continue
+		}
+		for _, user := range users {
+			if err := a.eraseAccount(ctx, user); err != nil {
+				logging.Errorf("Failed to erase account %d: %v", user.ID, err)
+				continue
+			}
+			logging.Infof("Erased account %d", user.ID)
+		}
+	}
+}
+
+// eraseAccount deletes a user's backups from the backup store, then the
+// organizations only they own, then the account with the rest of their
+// data, and emails them a receipt. An account whose backups can't be
+// deleted is kept, still scheduled, so it is retried.
+func (a *App) eraseAccount(ctx context.Context, user models.User) error {
+	if err := a.eraseBackups(ctx, user.ID); err != nil {
+		return err
+	}
+	orgs, err := a.store.Organizations.ListSoleOwned(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list organizations: %v", err)
+	}
+	for _, org := range orgs {
+		if err := a.eraseOrganization(ctx, org); err != nil {
+			return fmt.Errorf("failed to erase organization %d: %v", org.ID, err)
+		}
+	}
+
+	if err := a.store.Users.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	err = a.mailer.Send(ctx, EmailMessage{
+		To:      user.Email,
+		Subject: "Your PhoneSaver account has been deleted",
+		Body: fmt.Sprintf(
+			"Hi,\n\nAs you asked, your PhoneSaver account has been deleted on %s, with its contacts, backups and history.\n\n-- PhoneSaver\n",
+			time.Now().UTC().Format("2 January 2006"),
+		),
+	})
+	if err != nil {
+		logging.Errorf("Failed to send deletion receipt for account %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// eraseBackups deletes an account's backups from the backup store
+func (a *App) eraseBackups(ctx context.Context, userID int) error {
+	ids, err := a.backups.ListContactIDs(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list backed up contacts: %v", err)
+	}
+	if len(ids) > 0 {
+		if err := a.backups.SaveContacts(ctx, userID, nil, ids); err != nil {
+			return fmt.Errorf("failed to delete backups: %v", err)
+		}
+	}
+	return nil
+}
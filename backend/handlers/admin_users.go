@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	defaultAdminUserLimit = 50
+	maxAdminUserLimit     = 200
+)
+
+// ListUsers lists accounts for admins, oldest first, optionally only those
+// whose email contains email or with a status, active or suspended
+func (a *App) ListUsers(c *gin.Context) {
+	query := repository.UserQuery{Email: c.Query("email"), Status: c.Query("status"), Limit: defaultAdminUserLimit}
+	if query.Status != "" && query.Status != repository.UserActive && query.Status != repository.UserSuspended {
+		respondValidation(c, models.ValidationError{Field: "status", Message: "Status must be one of active, suspended"})
+		return
+	}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAdminUserLimit {
+			respondValidation(c, models.ValidationError{
+				Field:   "limit",
+				Message: fmt.Sprintf("Limit must be between 1 and %d", maxAdminUserLimit),
+			})
+			return
+		}
+		query.Limit = n
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := strconv.Atoi(raw)
+		if err != nil || cursor < 1 {
+			respondValidation(c, models.ValidationError{Field: "cursor", Message: "Invalid cursor"})
+			return
+		}
+		query.After = cursor
+	}
+
+	total, err := a.store.Users.Count(c.Request.Context(), query)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count users: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch users",
+		})
+		return
+	}
+	users, err := a.store.Users.List(c.Request.Context(), query)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch users: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch users",
+		})
+		return
+	}
+
+	next := ""
+	if len(users) == query.Limit {
+		next = strconv.Itoa(users[len(users)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    users,
+	})
+}
+
+// GetUser returns one account for admins
+func (a *App) GetUser(c *gin.Context) {
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+	a.respondUser(c, userID, "Failed to fetch user")
+}
+
+// SuspendUser suspends an account, refusing its logins and requests until
+// it is reactivated, and signs it out everywhere. Admins can't suspend
+// their own account.
+func (a *App) SuspendUser(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+	if userID == adminID.(int) {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "You can't suspend your own account",
+		})
+		return
+	}
+
+	suspended, err := a.store.Users.Suspend(c.Request.Context(), userID, time.Now())
+	if err == repository.ErrNotFound {
+		respondUserNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to suspend user: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to suspend user",
+		})
+		return
+	}
+	if suspended {
+		if _, err := a.store.RefreshTokens.RevokeUser(c.Request.Context(), userID); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to revoke refresh tokens: %v", err)
+		}
+		a.auditAdminAction(c, userID, auditAccountSuspended)
+	}
+	a.respondUser(c, userID, "Failed to suspend user")
+}
+
+// ReactivateUser lifts the suspension of an account. Its owner has to log in
+// again.
+func (a *App) ReactivateUser(c *gin.Context) {
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+
+	reactivated, err := a.store.Users.Reactivate(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to reactivate user: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to reactivate user",
+		})
+		return
+	}
+	if reactivated {
+		a.auditAdminAction(c, userID, auditAccountReactivated)
+	}
+	a.respondUser(c, userID, "Failed to reactivate user")
+}
+
+// ResetUserPassword discards an account's password and signs it out
+// everywhere, then emails its owner a link to choose a new one. Asking
+// again sends a new link, and the previous one stops working.
+func (a *App) ResetUserPassword(c *gin.Context) {
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := a.store.Users.Get(c.Request.Context(), userID)
+	if err == repository.ErrNotFound {
+		respondUserNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get user: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to reset password",
+		})
+		return
+	}
+	generation, err := a.store.Users.RequirePasswordReset(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to require password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to reset password",
+		})
+		return
+	}
+	if _, err := a.store.RefreshTokens.RevokeUser(c.Request.Context(), userID); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to revoke refresh tokens: %v", err)
+	}
+	a.auditAdminAction(c, userID, auditPasswordResetRequired)
+
+	if err := a.sendPasswordResetEmail(c, user, generation); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to send password reset email: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Password was reset, but the email to choose a new one could not be sent",
+		})
+		return
+	}
+	a.respondUser(c, userID, "Failed to reset password")
+}
+
+// sendPasswordResetEmail emails a user the link to choose a new password
+// after an admin discarded theirs, which works in the token generation the
+// reset started
+func (a *App) sendPasswordResetEmail(c *gin.Context, user models.User, generation int) error {
+	token, err := a.authService.IssuePasswordResetToken(user.ID, generation)
+	if err != nil {
+		return fmt.Errorf("failed to issue password reset token: %v", err)
+	}
+	return a.sendNotification(c.Request.Context(), models.Notification{
+		UserID:  user.ID,
+		Channel: channelEmail,
+		Kind:    notificationSecurityAlert,
+		To:      user.Email,
+		Subject: "Choose a new password for your PhoneSaver account",
+		Body: fmt.Sprintf(
+			"Hi,\n\nAn administrator has reset the password of your PhoneSaver account and signed it out on every device. "+
+				"Choose a new password to sign in again:\n\n%s\n\nThe link works for 7 days.\n\n-- PhoneSaver\n",
+			absoluteURL(c, "/api/auth/reset-password?token="+url.QueryEscape(token)),
+		),
+	})
+}
+
+// auditAdminAction records an admin's action on an account in the account's
+// audit log, naming the admin
+func (a *App) auditAdminAction(c *gin.Context, userID int, action string) {
+	adminID, _ := c.Get("user_id")
+	a.audit(c.Request.Context(), newAuditEvent(c, userID, action, map[string]string{
+		"admin_id": strconv.Itoa(adminID.(int)),
+	}))
+}
+
+// respondUser responds with an account as admins see it
+func (a *App) respondUser(c *gin.Context, userID int, failure string) {
+	user, err := a.store.Users.Account(c.Request.Context(), userID)
+	if err == repository.ErrNotFound {
+		respondUserNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("%s: %v", failure, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// userParam returns the account ID in the route, responding with 404 if it
+// isn't one
+func userParam(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondUserNotFound(c)
+		return 0, false
+	}
+	return userID, true
+}
+
+func respondUserNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "User not found",
+	})
+}
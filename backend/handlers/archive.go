@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/scrypt"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	// archiveMagic identifies PhoneSaver backup archives
+	archiveMagic = "PSBK"
+	// archiveVersion is bumped whenever the encoded layout changes
+	archiveVersion   byte = 1
+	archiveSaltSize       = 16
+	minPassphraseLen      = 8
+)
+
+var errInvalidArchive = errors.New("invalid or corrupted backup archive")
+
+// deriveArchiveKey derives an AES-256 key from a passphrase and salt
+func deriveArchiveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// encryptArchive compresses and encrypts an archive with AES-256-GCM.
+// The result is laid out as magic | version | salt | nonce | ciphertext.
+func encryptArchive(archive models.BackupArchive, passphrase string) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if err := json.NewEncoder(zw).Encode(archive); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, archiveSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(archiveMagic), archiveVersion)
+	out := make([]byte, 0, len(header)+len(salt)+len(nonce)+compressed.Len()+gcm.Overhead())
+	out = append(out, header...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, compressed.Bytes(), header), nil
+}
+
+// decryptArchive reverses encryptArchive
+func decryptArchive(data []byte, passphrase string) (*models.BackupArchive, error) {
+	headerLen := len(archiveMagic) + 1
+	if len(data) < headerLen+archiveSaltSize || string(data[:len(archiveMagic)]) != archiveMagic {
+		return nil, errInvalidArchive
+	}
+	if data[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("unsupported backup archive version %d", data[len(archiveMagic)])
+	}
+	header := data[:headerLen]
+	salt := data[headerLen : headerLen+archiveSaltSize]
+
+	key, err := deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[headerLen+archiveSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errInvalidArchive
+	}
+	compressed, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+	defer zr.Close()
+
+	var archive models.BackupArchive
+	if err := json.NewDecoder(zr).Decode(&archive); err != nil {
+		return nil, errInvalidArchive
+	}
+	return &archive, nil
+}
+
+// archivePassphrase reads and validates the passphrase header
+func archivePassphrase(c *gin.Context) (string, bool) {
+	passphrase := c.GetHeader("X-Backup-Passphrase")
+	if len(passphrase) < minPassphraseLen {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "X-Backup-Passphrase",
+				Message: fmt.Sprintf("Passphrase must be at least %d characters long", minPassphraseLen),
+			},
+		})
+		return "", false
+	}
+	return passphrase, true
+}
+
+// ExportBackup returns an encrypted archive of all the user's contacts
+func (a *App) ExportBackup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	passphrase, ok := archivePassphrase(c)
+	if !ok {
+		return
+	}
+
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts for export: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to export contacts",
+		})
+		return
+	}
+
+	archive := models.BackupArchive{
+		Version:    int(archiveVersion),
+		ExportedAt: time.Now().UTC(),
+		Contacts:   contacts,
+	}
+	data, err := encryptArchive(archive, passphrase)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to encrypt export: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to export contacts",
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditExport, map[string]string{
+		"contacts": strconv.Itoa(len(contacts)),
+	}))
+
+	filename := fmt.Sprintf("phonesaver-%s.psbk", archive.ExportedAt.Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
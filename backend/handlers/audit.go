@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// Actions recorded in the audit log
+const (
+	auditLogin                   = "login"
+	auditLoginFailed             = "login_failed"
+	auditCalendarTokenCreated    = "calendar_token_created"
+	auditCalendarTokenRevoked    = "calendar_token_revoked"
+	auditExport                  = "export"
+	auditImport                  = "import"
+	auditRestore                 = "restore"
+	auditAccountExport           = "account_export"
+	auditDeletionRequested       = "account_deletion_requested"
+	auditDeletionCancelled       = "account_deletion_cancelled"
+	auditRefreshTokenReused      = "refresh_token_reused"
+	auditImportTokenCreated      = "import_token_created"
+	auditAccessTokenCreated      = "access_token_created"
+	auditLoginRevoked            = "login_revoked"
+	auditPrivacyChanged          = "privacy_changed"
+	auditAccountSuspended        = "account_suspended"
+	auditAccountReactivated      = "account_reactivated"
+	auditPasswordResetRequired   = "password_reset_required"
+	auditPasswordReset           = "password_reset"
+	auditMemberAdded             = "member_added"
+	auditMemberRoleChanged       = "member_role_changed"
+	auditMemberRemoved           = "member_removed"
+	auditPermissionGranted       = "permission_granted"
+	auditPermissionRevoked       = "permission_revoked"
+	auditMemberInvited           = "member_invited"
+	auditInviteDeclined          = "invite_declined"
+	auditPlanChanged             = "plan_changed"
+	auditImpersonationStarted    = "impersonation_started"
+	auditImpersonationEnded      = "impersonation_ended"
+	auditOrganizationExport      = "organization_export"
+	auditIntegrationConnected    = "integration_connected"
+	auditIntegrationDisconnected = "integration_disconnected"
+	auditSMSPhoneLinked          = "sms_phone_linked"
+	auditSMSPhoneUnlinked        = "sms_phone_unlinked"
+)
+
+const (
+	// auditCleanupInterval is how often events past AUDIT_RETENTION are
+	// purged
+	auditCleanupInterval = time.Hour
+	defaultAuditLimit    = 50
+	maxAuditLimit        = 200
+)
+
+// newAuditEvent describes an action by a user from the client of the request.
+// Actions on an organization's contacts are recorded in its audit log with
+// the member who took them, and actions an admin took impersonating the
+// user with the admin.
+func newAuditEvent(c *gin.Context, userID int, action string, details map[string]string) models.AuditEvent {
+	if memberID := c.GetInt("member_id"); memberID != 0 {
+		if details == nil {
+			details = map[string]string{}
+		}
+		details["member_id"] = strconv.Itoa(memberID)
+	}
+	if impersonatorID := c.GetInt("impersonator_id"); impersonatorID != 0 {
+		if details == nil {
+			details = map[string]string{}
+		}
+		details["impersonator_id"] = strconv.Itoa(impersonatorID)
+	}
+	return models.AuditEvent{
+		UserID:    userID,
+		Action:    action,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		DeviceID:  c.GetString("device_id"),
+		Details:   details,
+	}
+}
+
+// audit records an event in the audit log. A failure to record it is logged
+// rather than failing the action it describes.
+func (a *App) audit(ctx context.Context, event models.AuditEvent) {
+	if err := a.store.Audit.Record(ctx, &event); err != nil {
+		logging.Errorf("Failed to record %s audit event: %v", event.Action, err)
+	}
+}
+
+// GetAuditLog lists the security-relevant activity on the user's account,
+// newest first, optionally only of one action
+func (a *App) GetAuditLog(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	query := repository.AuditQuery{Action: c.Query("action"), Limit: defaultAuditLimit}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "limit",
+					Message: fmt.Sprintf("Limit must be between 1 and %d", maxAuditLimit),
+				},
+			})
+			return
+		}
+		query.Limit = n
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || cursor < 1 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "cursor",
+					Message: "Invalid cursor",
+				},
+			})
+			return
+		}
+		query.Before = cursor
+	}
+
+	total, err := a.store.Audit.Count(c.Request.Context(), userID.(int), query.Action)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch audit log",
+		})
+		return
+	}
+	events, err := a.store.Audit.List(c.Request.Context(), userID.(int), query)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch audit log",
+		})
+		return
+	}
+
+	next := ""
+	if len(events) == query.Limit {
+		next = strconv.FormatInt(events[len(events)-1].ID, 10)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    events,
+	})
+}
+
+// RunAuditCleanup periodically purges audit events older than the retention
+// window
+func (a *App) RunAuditCleanup(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(auditCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := a.store.Audit.DeleteBefore(context.Background(), time.Now().UTC().Add(-retention))
+		if err != nil {
+			logging.Errorf("Failed to purge audit events: %v", err)
+			continue
+		}
+		if purged > 0 {
+			logging.Infof("Purged %d expired audit events", purged)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// signupRequest is the body of a signup request
+type signupRequest struct {
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,password"`
+	// CaptchaToken is the solved CAPTCHA, required when CAPTCHA_PROVIDER
+	// is set
+	CaptchaToken string `json:"captcha_token" binding:"max=2048"`
+}
+
+// signupResponse is the data of a successful signup
+type signupResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	UserID       int    `json:"user_id"`
+}
+
+func (a *App) Signup(c *gin.Context) {
+	// Rate limiting
+	bucket, err := middleware.SignupLimiter.Allow(c.Request.Context(), c.ClientIP())
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to check signup rate limit: %v", err)
+	} else if !bucket.Allowed {
+		middleware.SetRateLimitHeaders(c, bucket)
+		c.JSON(http.StatusTooManyRequests, models.Response{
+			Success: false,
+			Error:   "Too many signup attempts. Please try again later.",
+		})
+		return
+	}
+
+	var req signupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if a.captcha != nil {
+		err := a.captcha.Verify(c.Request.Context(), req.CaptchaToken, c.ClientIP())
+		if err == errCaptchaFailed {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   "CAPTCHA verification failed",
+			})
+			return
+		}
+		if err != nil {
+			// Fail closed, since the CAPTCHA is what keeps bots out
+			middleware.RequestLogger(c).Errorf("Failed to verify CAPTCHA: %v", err)
+			c.JSON(http.StatusServiceUnavailable, models.Response{
+				Success: false,
+				Error:   "CAPTCHA verification is unavailable. Please try again later.",
+			})
+			return
+		}
+	}
+
+	session, err := a.authService.Signup(c.Request.Context(), req.Email, req.Password)
+	if err == services.ErrEmailTaken {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Email already exists",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to sign up: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to sign up",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    signupResponse{Token: session.Token, RefreshToken: session.RefreshToken, UserID: session.UserID},
+	})
+}
+
+// loginRequest is the body of a login request
+type loginRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,max=100"`
+	DeviceID   string `json:"device_id" binding:"max=64"`
+	DeviceName string `json:"device_name" binding:"max=255"`
+}
+
+// loginResponse is the data of a successful login
+type loginResponse struct {
+	Token        string              `json:"token"`
+	RefreshToken string              `json:"refresh_token"`
+	DeviceID     string              `json:"device_id"`
+	User         models.UserResponse `json:"user"`
+}
+
+// Login handles user login
+func (a *App) Login(c *gin.Context) {
+	var loginReq loginRequest
+	if !bindJSON(c, &loginReq) {
+		return
+	}
+
+	session, err := a.authService.Login(c.Request.Context(), services.LoginInput{
+		Email:      loginReq.Email,
+		Password:   loginReq.Password,
+		DeviceID:   loginReq.DeviceID,
+		DeviceName: loginReq.DeviceName,
+		IP:         c.ClientIP(),
+	})
+	if err == services.ErrInvalidCredentials {
+		a.audit(c.Request.Context(), newAuditEvent(c, session.UserID, auditLoginFailed, nil))
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Error:   "Invalid credentials",
+		})
+		return
+	}
+	if err == services.ErrAccountSuspended {
+		a.audit(c.Request.Context(), newAuditEvent(c, session.UserID, auditLoginFailed, map[string]string{"reason": "suspended"}))
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Account suspended",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to login: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to login",
+		})
+		return
+	}
+	var details map[string]string
+	if session.NewDevice || session.NewNetwork {
+		details = map[string]string{
+			"new_device":  strconv.FormatBool(session.NewDevice),
+			"new_network": strconv.FormatBool(session.NewNetwork),
+		}
+		if err := a.sendLoginAlert(c, session, loginReq.DeviceName); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to send login alert: %v", err)
+		}
+	}
+	event := newAuditEvent(c, session.UserID, auditLogin, details)
+	event.DeviceID = session.DeviceID
+	a.audit(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: loginResponse{
+			Token:        session.Token,
+			RefreshToken: session.RefreshToken,
+			DeviceID:     session.DeviceID,
+			User:         models.UserResponse{ID: session.UserID, Email: session.Email},
+		},
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// progressFunc reports how many of a job's units of work are done
+type progressFunc func(done, total int)
+
+// BackupContacts writes the user's contacts to the backup store. Only contacts
+// changed since the last completed backup are written and contacts that no
+// longer exist are deleted, unless a full backup is requested with ?full=true.
+// Supplying X-Backup-Passphrase encrypts the backup with a key derived from it.
+// With ?async=true the backup runs as a background job.
+func (a *App) BackupContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	key, ok := a.resolveBackupKey(c, userID.(int), true)
+	if !ok {
+		return
+	}
+	full := c.Query("full") == "true"
+	plan, ok := a.loadPlan(c, userID.(int), "Failed to backup contacts")
+	if !ok {
+		return
+	}
+
+	if c.Query("async") == "true" {
+		a.startJobResponse(c, userID.(int), jobTypeBackup, func(ctx context.Context, progress progressFunc) (interface{}, error) {
+			return a.runBackup(ctx, userID.(int), key, full, plan.BackupMaxBytes, progress)
+		})
+		return
+	}
+
+	manifest, err := a.runBackup(c.Request.Context(), userID.(int), key, full, plan.BackupMaxBytes, nil)
+	if err != nil {
+		respondError(c, err, "Failed to backup contacts")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"message":        "Backup completed successfully",
+			"contacts_count": manifest.Total,
+			"timestamp":      manifest.CompletedAt,
+			"manifest":       manifest,
+		},
+	})
+}
+
+// runBackup performs a backup of the user's contacts within the storage
+// quota of their plan, meters it, notifies the user's webhooks and returns
+// the backup's manifest
+func (a *App) runBackup(ctx context.Context, userID int, key []byte, full bool, maxBytes int64, progress progressFunc) (*models.BackupManifest, error) {
+	manifest, err := a.backupService.Backup(ctx, services.BackupInput{UserID: userID, Key: key, Full: full, MaxBytes: maxBytes, Progress: progress})
+	var quotaErr *services.QuotaError
+	switch {
+	case err == services.ErrNoContacts:
+		return nil, &models.CustomError{Code: http.StatusBadRequest, Message: "No contacts to backup"}
+	case errors.As(err, &quotaErr):
+		return nil, &models.CustomError{Code: http.StatusRequestEntityTooLarge, Message: quotaErr.Error()}
+	case err != nil:
+		return nil, err
+	}
+	a.meterBackup(ctx, userID, manifest.SizeBytes)
+	go a.queueWebhooks(context.Background(), userID, eventBackupCompleted, *manifest)
+	return manifest, nil
+}
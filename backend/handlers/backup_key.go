@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// backupKeyCheck is authenticated with a derived key to detect a wrong passphrase
+const backupKeyCheck = "phonesaver-backup-key-check"
+
+// deriveBackupKey derives a user's backup key and the verifier stored for it
+func deriveBackupKey(passphrase string, salt []byte) (key []byte, verifier string, err error) {
+	key, err = deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return nil, "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(backupKeyCheck))
+	return key, hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// resolveBackupKey returns the backup key for the request's user, or nil when
+// the user's backups are not encrypted. Backup keys are derived from the
+// X-Backup-Passphrase header and never stored; only a salt and verifier are
+// kept so a wrong passphrase can be rejected. When enroll is true and the user
+// has no key yet, a passphrase in the request enables encrypted backups.
+// On failure an error response has already been written.
+func (a *App) resolveBackupKey(c *gin.Context, userID int, enroll bool) ([]byte, bool) {
+	passphrase := c.GetHeader("X-Backup-Passphrase")
+
+	var salt []byte
+	var verifier string
+	err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT salt, verifier FROM backup_keys WHERE user_id = ?", userID).Scan(&salt, &verifier)
+	if err != nil && err != sql.ErrNoRows {
+		middleware.RequestLogger(c).Errorf("Failed to get backup key: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to load backup key",
+		})
+		return nil, false
+	}
+
+	if err == sql.ErrNoRows {
+		if passphrase == "" || !enroll {
+			return nil, true
+		}
+		if _, ok := archivePassphrase(c); !ok {
+			return nil, false
+		}
+
+		salt = make([]byte, archiveSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to generate backup key salt: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to create backup key",
+			})
+			return nil, false
+		}
+		key, verifier, err := deriveBackupKey(passphrase, salt)
+		if err == nil {
+			_, err = a.store.DB.ExecContext(c.Request.Context(), "INSERT INTO backup_keys (user_id, salt, verifier) VALUES (?, ?, ?)", userID, salt, verifier)
+		}
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to create backup key: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to create backup key",
+			})
+			return nil, false
+		}
+		return key, true
+	}
+
+	if passphrase == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "X-Backup-Passphrase",
+				Message: "Backups for this account are encrypted. A passphrase is required",
+			},
+		})
+		return nil, false
+	}
+
+	key, expected, err := deriveBackupKey(passphrase, salt)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to derive backup key: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to load backup key",
+		})
+		return nil, false
+	}
+	if !hmac.Equal([]byte(expected), []byte(verifier)) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Incorrect backup passphrase",
+		})
+		return nil, false
+	}
+	return key, true
+}
+
+// DeleteBackupKey disables encrypted backups for the user. The next backup is
+// written in full without encryption; existing encrypted records can no longer
+// be restored.
+func (a *App) DeleteBackupKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	if _, err := a.store.DB.ExecContext(c.Request.Context(), "DELETE FROM backup_keys WHERE user_id = ?", userID); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete backup key: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete backup key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Backup encryption disabled",
+	})
+}
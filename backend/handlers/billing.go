@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// featureTeamSharing is the premium feature of sharing an address book in
+// an organization
+const featureTeamSharing = "team_sharing"
+
+// activeSubscriptionStatuses are the Stripe subscription statuses that keep
+// an account on the pro plan. Past due subscriptions keep it while Stripe
+// retries the payment.
+var activeSubscriptionStatuses = []string{"active", "trialing", "past_due"}
+
+// plans returns the plans accounts can be on, free first. The pro plan's
+// backups are limited by BACKUP_MAX_BYTES_PER_USER, like every account's
+// when billing is off.
+func (a *App) plans() []models.Plan {
+	return []models.Plan{
+		{
+			ID:             repository.PlanFree,
+			Name:           "Free",
+			MaxContacts:    a.cfg.FreeMaxContacts,
+			BackupMaxBytes: a.cfg.FreeBackupMaxBytes,
+			Features:       []string{},
+		},
+		{
+			ID:             repository.PlanPro,
+			Name:           "Pro",
+			BackupMaxBytes: a.cfg.BackupMaxBytes,
+			Features:       []string{featureTeamSharing},
+		},
+	}
+}
+
+// plan returns the plan with an ID, falling back to the free plan
+func (a *App) plan(id string) models.Plan {
+	plans := a.plans()
+	for _, plan := range plans {
+		if plan.ID == id {
+			return plan
+		}
+	}
+	return plans[0]
+}
+
+// GetBilling returns the user's plan and the state of the subscription
+// paying for it, along with the plans to choose from
+func (a *App) GetBilling(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	billing := models.Billing{Enabled: a.stripe != nil, Plan: a.plan(repository.PlanPro), Plans: a.plans()}
+	if a.stripe != nil {
+		subscription, err := a.loadSubscription(c.Request.Context(), userID.(int))
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to fetch subscription: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch billing",
+			})
+			return
+		}
+		billing.Plan = a.plan(subscription.Plan)
+		billing.Status = subscription.Status
+		billing.CurrentPeriodEnd = subscription.CurrentPeriodEnd
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    billing,
+	})
+}
+
+// CreateCheckout starts a subscription to the pro plan, returning the URL of
+// the Stripe Checkout page the user pays on. The plan changes once Stripe
+// reports the payment to StripeWebhook.
+func (a *App) CreateCheckout(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if !a.requireBilling(c) {
+		return
+	}
+
+	subscription, err := a.loadSubscription(c.Request.Context(), userID.(int))
+	var user models.User
+	if err == nil {
+		user, err = a.store.Users.Get(c.Request.Context(), userID.(int))
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to start checkout",
+		})
+		return
+	}
+	if subscription.Plan == repository.PlanPro {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "You're already on the Pro plan; manage it from the billing portal",
+		})
+		return
+	}
+
+	checkoutURL, err := a.stripe.Checkout(c.Request.Context(), stripeCheckout{
+		UserID:     userID.(int),
+		Email:      user.Email,
+		CustomerID: subscription.CustomerID,
+		ReturnURL:  a.cfg.BillingReturnURL,
+	})
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create checkout session: %v", err)
+		c.JSON(http.StatusBadGateway, models.Response{
+			Success: false,
+			Error:   "Failed to start checkout",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    map[string]string{"url": checkoutURL},
+	})
+}
+
+// CreateBillingPortal returns the URL of the Stripe billing portal, where
+// subscribers change their payment details or cancel
+func (a *App) CreateBillingPortal(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if !a.requireBilling(c) {
+		return
+	}
+
+	subscription, err := a.loadSubscription(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to open the billing portal",
+		})
+		return
+	}
+	if subscription.CustomerID == "" {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "You have no subscription to manage",
+		})
+		return
+	}
+
+	portalURL, err := a.stripe.Portal(c.Request.Context(), subscription.CustomerID, a.cfg.BillingReturnURL)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create billing portal session: %v", err)
+		c.JSON(http.StatusBadGateway, models.Response{
+			Success: false,
+			Error:   "Failed to open the billing portal",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    map[string]string{"url": portalURL},
+	})
+}
+
+// StripeWebhook receives the events Stripe sends about Checkout sessions and
+// subscriptions, moving accounts between plans as they subscribe, fail to
+// pay or cancel. Deliveries must be signed with STRIPE_WEBHOOK_SECRET.
+// Events older than the last one applied to an account are ignored, as
+// Stripe doesn't deliver them in order.
+func (a *App) StripeWebhook(c *gin.Context) {
+	if !a.requireBilling(c) {
+		return
+	}
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			middleware.RespondBodyTooLarge(c, a.cfg.MaxBodyBytes)
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	var event stripeEvent
+	if err := a.stripe.verify(payload, c.GetHeader("Stripe-Signature"), time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid signature",
+		})
+		return
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid event",
+		})
+		return
+	}
+
+	if err := a.applyStripeEvent(c, event); err != nil {
+		// Stripe retries deliveries that fail
+		middleware.RequestLogger(c).Errorf("Failed to apply Stripe event %s: %v", event.ID, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to apply event",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Event received",
+	})
+}
+
+// applyStripeEvent updates the subscription an event is about. Events of
+// other types, or about customers who aren't users, are ignored.
+func (a *App) applyStripeEvent(c *gin.Context, event stripeEvent) error {
+	ctx := c.Request.Context()
+	at := time.Unix(event.Created, 0).UTC()
+
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return fmt.Errorf("failed to decode checkout session: %v", err)
+		}
+		userID, err := strconv.Atoi(session.ClientReferenceID)
+		if err != nil {
+			return nil
+		}
+		subscription, err := a.loadSubscription(ctx, userID)
+		if err != nil {
+			return err
+		}
+		previous := subscription.Plan
+		subscription.CustomerID = session.Customer
+		subscription.SubscriptionID = session.Subscription
+		// The subscription's own events tell its status, if they came first
+		if subscription.Status == "" {
+			subscription.Plan = repository.PlanPro
+			subscription.Status = "active"
+			subscription.UpdatedAt = at
+		}
+		return a.saveSubscription(c, subscription, previous)
+
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var object stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &object); err != nil {
+			return fmt.Errorf("failed to decode subscription: %v", err)
+		}
+		var subscription models.Subscription
+		userID, err := strconv.Atoi(object.Metadata["user_id"])
+		if err == nil {
+			subscription, err = a.loadSubscription(ctx, userID)
+		} else {
+			subscription, err = a.store.Subscriptions.GetByCustomer(ctx, object.Customer)
+			if err == repository.ErrNotFound {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if subscription.UpdatedAt.After(at) {
+			return nil
+		}
+
+		previous := subscription.Plan
+		subscription.CustomerID = object.Customer
+		subscription.SubscriptionID = object.ID
+		subscription.Status = object.Status
+		subscription.CurrentPeriodEnd = object.periodEnd()
+		subscription.UpdatedAt = at
+		subscription.Plan = repository.PlanFree
+		if event.Type != "customer.subscription.deleted" && object.hasPrice(a.stripe.proPriceID) &&
+			slices.Contains(activeSubscriptionStatuses, object.Status) {
+			subscription.Plan = repository.PlanPro
+		}
+		return a.saveSubscription(c, subscription, previous)
+	}
+	return nil
+}
+
+// loadSubscription returns a user's subscription, or a new free one for
+// users who never subscribed
+func (a *App) loadSubscription(ctx context.Context, userID int) (models.Subscription, error) {
+	subscription, err := a.store.Subscriptions.Get(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.Subscription{UserID: userID, Plan: repository.PlanFree}, nil
+	}
+	return subscription, err
+}
+
+// saveSubscription stores a subscription, recording a change from the
+// previous plan in the user's audit log
+func (a *App) saveSubscription(c *gin.Context, subscription models.Subscription, previous string) error {
+	err := a.store.Subscriptions.Save(c.Request.Context(), subscription)
+	if err == repository.ErrDuplicate {
+		return fmt.Errorf("customer %s belongs to another user", subscription.CustomerID)
+	}
+	if err != nil {
+		// Events about users deleted since are dropped
+		if _, lookupErr := a.store.Users.Get(c.Request.Context(), subscription.UserID); lookupErr == repository.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	if subscription.Plan != previous {
+		a.audit(c.Request.Context(), newAuditEvent(c, subscription.UserID, auditPlanChanged, map[string]string{
+			"plan":          subscription.Plan,
+			"previous_plan": previous,
+			"status":        subscription.Status,
+		}))
+	}
+	return nil
+}
+
+// requireBilling responds with 404 if the server doesn't bill
+func (a *App) requireBilling(c *gin.Context) bool {
+	if a.stripe == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Billing is not enabled",
+		})
+		return false
+	}
+	return true
+}
+
+// loadPlan returns the plan of the account a request works with. Every
+// account has the pro plan when billing is off, and organizations, being
+// the pro plan's team sharing, always do. It responds with failure if the
+// plan can't be loaded.
+func (a *App) loadPlan(c *gin.Context, userID int, failure string) (models.Plan, bool) {
+	if _, ok := c.Get("organization"); ok || a.stripe == nil {
+		return a.plan(repository.PlanPro), true
+	}
+	subscription, err := a.loadSubscription(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load plan: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return models.Plan{}, false
+	}
+	return a.plan(subscription.Plan), true
+}
+
+// requireFeature reports whether the user's plan has a premium feature,
+// responding with 402 if it doesn't
+func (a *App) requireFeature(c *gin.Context, userID int, feature, failure string) bool {
+	plan, ok := a.loadPlan(c, userID, failure)
+	if !ok {
+		return false
+	}
+	if !slices.Contains(plan.Features, feature) {
+		c.JSON(http.StatusPaymentRequired, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("The %s plan doesn't include %s; upgrade to Pro to use it", plan.Name, featureNames[feature]),
+		})
+		return false
+	}
+	return true
+}
+
+// featureNames name the premium features in error messages
+var featureNames = map[string]string{
+	featureTeamSharing: "team sharing",
+}
+
+// allowContacts reports whether the user's plan lets them add contacts,
+// replacing the ones they have if replacing is set. It responds with 402 if
+// the plan's limit would be exceeded.
+func (a *App) allowContacts(c *gin.Context, userID, adding int, replacing bool, failure string) bool {
+	plan, ok := a.loadPlan(c, userID, failure)
+	if !ok {
+		return false
+	}
+	if plan.MaxContacts == 0 || adding == 0 {
+		return true
+	}
+	total := adding
+	if !replacing {
+		count, err := a.store.Contacts.Count(c.Request.Context(), userID)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to count contacts: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   failure,
+			})
+			return false
+		}
+		total += count
+	}
+	if total > plan.MaxContacts {
+		c.JSON(http.StatusPaymentRequired, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("The %s plan allows at most %d contacts; upgrade to Pro for more", plan.Name, plan.MaxContacts),
+		})
+		return false
+	}
+	return true
+}
+
+// contactLimitReached reports whether the user's plan allows no more
+// contacts, for contacts created outside the contact routes
+func (a *App) contactLimitReached(ctx context.Context, userID int) (bool, error) {
+	if a.stripe == nil {
+		return false, nil
+	}
+	subscription, err := a.loadSubscription(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load plan: %v", err)
+	}
+	plan := a.plan(subscription.Plan)
+	if plan.MaxContacts == 0 {
+		return false, nil
+	}
+	count, err := a.store.Contacts.Count(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to count contacts: %v", err)
+	}
+	return count >= plan.MaxContacts, nil
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+)
+
+// birthdayReminderDays is the default number of days ahead, including today,
+// the reminder email lists birthdays for
+const birthdayReminderDays = 7
+
+var birthdayEmailTemplate = template.Must(template.New("birthdays").Parse(`Hi,
+
+{{if .Today}}Birthdays today:
+{{range .Today}}  - {{.Name}}
+{{end}}
+{{end}}{{if .Upcoming}}Coming up:
+{{range .Upcoming}}  - {{.Name}} on {{.Date.Format "Monday, January 2"}}
+{{end}}
+{{end}}Don't forget to reach out!
+
+-- PhoneSaver
+`))
+
+var birthdaySlackTemplate = template.Must(template.New("birthdays").Funcs(template.FuncMap{"slack": slackEscaper.Replace}).Parse(
+	`{{if .Today}}:birthday: *Birthdays today*
+{{range .Today}}• {{slack .Name}}
+{{end}}{{end}}{{if .Upcoming}}{{if .Today}}
+{{end}}*Coming up*
+{{range .Upcoming}}• {{slack .Name}} on {{.Date.Format "Monday, January 2"}}
+{{end}}{{end}}`))
+
+// upcomingBirthday is a contact's next birthday
+type upcomingBirthday struct {
+	Name string
+	Date time.Time
+	Days int
+}
+
+// runHourly calls fn at the start of every hour
+func runHourly(fn func(now time.Time)) {
+	for {
+		now := time.Now().UTC()
+		time.Sleep(time.Until(now.Truncate(time.Hour).Add(time.Hour)))
+		fn(time.Now().UTC())
+	}
+}
+
+// RunBirthdayReminders sends opted-in users their upcoming birthdays at the
+// hour each user chose
+func (a *App) RunBirthdayReminders() {
+	runHourly(func(now time.Time) {
+		sent, err := a.sendBirthdayReminders(context.Background(), now)
+		if err != nil {
+			logging.Errorf("Failed to send birthday reminders: %v", err)
+		}
+		if sent > 0 {
+			logging.Infof("Sent %d birthday reminders", sent)
+		}
+	})
+}
+
+// birthdayRecipient is a user opted in to birthday reminders
+type birthdayRecipient struct {
+	userID    int
+	email     string
+	byMail    bool
+	byPush    bool
+	bySMS     bool
+	bySlack   bool
+	smsNumber string
+	daysAhead int
+	today     time.Time
+	// slackChannel is the channel the user's Slack reminders are posted to,
+	// or "" for their incoming webhook's
+	slackChannel string
+}
+
+// sendBirthdayReminders reminds every opted-in user whose reminder hour has
+// passed in their time zone and who has not yet been reminded on their local
+// date, returning the number of reminders sent. Users in their quiet hours
+// are skipped.
+func (a *App) sendBirthdayReminders(ctx context.Context, now time.Time) (int, error) {
+	// No time zone is more than a day ahead of UTC, so users reminded on the
+	// next UTC date are certainly done
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT u.id, u.email, s.birthday_email, s.birthday_push, s.birthday_sms, s.birthday_slack, s.sms_number, s.slack_channel,
+		s.birthday_days_ahead, COALESCE(s.reminder_hour, ?), s.timezone, s.quiet_hours_enabled, s.quiet_hours_start, s.quiet_hours_end,
+		s.birthday_reminder_sent_on FROM users u
+		JOIN notification_settings s ON s.user_id = u.id
+		WHERE (s.birthday_email = TRUE OR s.birthday_push = TRUE OR s.birthday_sms = TRUE OR s.birthday_slack = TRUE)
+		AND (s.birthday_reminder_sent_on IS NULL OR s.birthday_reminder_sent_on <= ?)`,
+		a.cfg.ReminderHour, dateOf(now.UTC()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch users for birthday reminders: %v", err)
+	}
+	var recipients []birthdayRecipient
+	for rows.Next() {
+		var r birthdayRecipient
+		var schedule notificationSchedule
+		var timezone string
+		var sentOn sql.NullTime
+		if err := rows.Scan(
+			&r.userID, &r.email, &r.byMail, &r.byPush, &r.bySMS, &r.bySlack, &r.smsNumber, &r.slackChannel, &r.daysAhead,
+			&schedule.hour, &timezone, &schedule.quiet.Enabled, &schedule.quiet.Start, &schedule.quiet.End, &sentOn,
+		); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user: %v", err)
+		}
+		schedule.loc = loadLocation(timezone)
+		today, due := schedule.due(now)
+		if !due || (sentOn.Valid && !sentOn.Time.Before(today)) {
+			continue
+		}
+		r.today = today
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range recipients {
+		n, err := a.sendBirthdayReminder(ctx, r)
+		sent += n
+		if err != nil {
+			// Leave the user unmarked so the next run tries again
+			logging.Errorf("Failed to send birthday reminder to user %d: %v", r.userID, err)
+			continue
+		}
+		if _, err := a.store.DB.ExecContext(ctx, "UPDATE notification_settings SET birthday_reminder_sent_on = ? WHERE user_id = ?", r.today, r.userID); err != nil {
+			logging.Errorf("Failed to record birthday reminder for user %d: %v", r.userID, err)
+		}
+	}
+	return sent, nil
+}
+
+// sendBirthdayReminder emails a user or posts to their Slack the birthdays
+// of the coming days, and pushes or texts today's birthdays, as they opted
+// in to. It returns the number of reminders sent; none are sent if there
+// are no birthdays.
+func (a *App) sendBirthdayReminder(ctx context.Context, r birthdayRecipient) (int, error) {
+	contacts, err := a.store.Contacts.ListAll(ctx, r.userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load contacts: %v", err)
+	}
+
+	birthdays := upcomingBirthdays(contacts, r.today, r.daysAhead)
+	if len(birthdays) == 0 {
+		return 0, nil
+	}
+
+	var data struct {
+		Today    []upcomingBirthday
+		Upcoming []upcomingBirthday
+	}
+	for _, b := range birthdays {
+		if b.Days == 0 {
+			data.Today = append(data.Today, b)
+		} else {
+			data.Upcoming = append(data.Upcoming, b)
+		}
+	}
+
+	sent := 0
+	if r.byPush && len(data.Today) > 0 {
+		title := fmt.Sprintf("It's %s's birthday today", data.Today[0].Name)
+		body := "Don't forget to reach out!"
+		if len(data.Today) > 1 {
+			title = fmt.Sprintf("%d birthdays today", len(data.Today))
+			body = fmt.Sprintf("%s and others are celebrating today", data.Today[0].Name)
+		}
+		err := a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelPush,
+			Kind:    notificationBirthday,
+			Subject: title,
+			Body:    body,
+			Data:    map[string]string{"type": "birthday_reminder"},
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if r.bySMS && len(data.Today) > 0 {
+		names := make([]string, len(data.Today))
+		for i, b := range data.Today {
+			names[i] = b.Name
+		}
+		body := fmt.Sprintf("PhoneSaver: it's %s's birthday today. Don't forget to reach out!", strings.Join(names, " and "))
+		if len(names) > 2 {
+			body = fmt.Sprintf("PhoneSaver: %d birthdays today: %s. Don't forget to reach out!", len(names), strings.Join(names, ", "))
+		}
+		err := a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelSMS,
+			Kind:    notificationBirthday,
+			To:      r.smsNumber,
+			Subject: "Birthdays today",
+			Body:    body,
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	subject := fmt.Sprintf("%d birthdays coming up", len(birthdays))
+	if len(data.Today) > 0 {
+		subject = fmt.Sprintf("It's %s's birthday today", data.Today[0].Name)
+	}
+
+	if r.bySlack {
+		var body bytes.Buffer
+		if err := birthdaySlackTemplate.Execute(&body, data); err != nil {
+			return sent, fmt.Errorf("failed to render Slack message: %v", err)
+		}
+		err := a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelSlack,
+			Kind:    notificationBirthday,
+			To:      slackRecipient(r.slackChannel),
+			Subject: subject,
+			Body:    body.String(),
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if r.byMail {
+		var body bytes.Buffer
+		if err := birthdayEmailTemplate.Execute(&body, data); err != nil {
+			return sent, fmt.Errorf("failed to render email: %v", err)
+		}
+
+		err := a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelEmail,
+			Kind:    notificationBirthday,
+			To:      r.email,
+			Subject: subject,
+			Body:    body.String(),
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// upcomingBirthdays returns the contacts whose birthdays fall within the next
+// days days, starting today, soonest first
+func upcomingBirthdays(contacts []models.Contact, today time.Time, days int) []upcomingBirthday {
+	var birthdays []upcomingBirthday
+	for _, contact := range contacts {
+		if contact.Birthday.IsZero() {
+			continue
+		}
+		if n := daysUntilBirthday(contact.Birthday, today); n < days {
+			birthdays = append(birthdays, upcomingBirthday{
+				Name: contact.Name,
+				Date: today.AddDate(0, 0, n),
+				Days: n,
+			})
+		}
+	}
+	sort.SliceStable(birthdays, func(i, j int) bool { return birthdays[i].Days < birthdays[j].Days })
+	return birthdays
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// blockNumberRequest is a phone number to block, with an optional note on
+// why
+type blockNumberRequest struct {
+	Phone string `json:"phone" binding:"required,max=255,phone"`
+	Label string `json:"label" binding:"max=100"`
+}
+
+// ListBlockedNumbers returns the phone numbers the user blocked, newest
+// first
+func (a *App) ListBlockedNumbers(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	numbers, err := a.store.BlockedNumbers.List(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to list blocked numbers: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to list blocked numbers",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    numbers,
+	})
+}
+
+// BlockNumber adds a phone number to the user's blocked numbers, which
+// lookups and contact creation flag. A number already blocked, however it
+// is formatted, is rejected with 409.
+func (a *App) BlockNumber(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req blockNumberRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	number := models.BlockedNumber{UserID: userID.(int), Phone: req.Phone, Label: req.Label}
+	err := a.store.BlockedNumbers.Block(c.Request.Context(), &number)
+	if err == repository.ErrDuplicate {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "This phone number is already blocked",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to block number: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to block number",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    number,
+	})
+}
+
+// UnblockNumber removes one of the user's blocked numbers
+func (a *App) UnblockNumber(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondBlockedNumberNotFound(c)
+		return
+	}
+
+	found, err := a.store.BlockedNumbers.Unblock(c.Request.Context(), userID.(int), id)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to unblock number: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to unblock number",
+		})
+		return
+	}
+	if !found {
+		respondBlockedNumberNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Number unblocked successfully",
+	})
+}
+
+func respondBlockedNumberNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Blocked number not found",
+	})
+}
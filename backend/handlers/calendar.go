@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// calendarTokenBytes is the length of the random part of calendar feed tokens
+const calendarTokenBytes = 24
+
+// icsLineLimit is the maximum line length in octets before folding, per RFC 5545
+const icsLineLimit = 75
+
+// icsEscaper escapes text property values
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// hashCalendarToken returns the stored form of a calendar feed token. Only
+// the hash is stored so a leaked database does not expose subscribable URLs.
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// calendarFeedURL returns the absolute URL of the birthday feed for a token
+func calendarFeedURL(c *gin.Context, token string) string {
+	return absoluteURL(c, "/api/calendar/birthdays.ics?token="+token)
+}
+
+// absoluteURL returns the URL of path on the host the request was sent to
+func absoluteURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, path)
+}
+
+// CreateCalendarToken issues a new calendar feed token for the user,
+// revoking any previous one, and returns the feed URL to subscribe to
+func (a *App) CreateCalendarToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	raw := make([]byte, calendarTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to generate calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create calendar feed",
+		})
+		return
+	}
+	token := hex.EncodeToString(raw)
+
+	_, err := a.store.DB.ExecContext(c.Request.Context(),
+		"INSERT INTO calendar_feeds (user_id, token_hash, created_at) VALUES (?, ?, ?) "+
+			a.store.Upsert([]string{"user_id"}, "token_hash", "created_at"),
+		userID, hashCalendarToken(token), time.Now().UTC(),
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to store calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create calendar feed",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditCalendarTokenCreated, nil))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]string{
+			"token": token,
+			"url":   calendarFeedURL(c, token),
+		},
+	})
+}
+
+// DeleteCalendarToken revokes the user's calendar feed token
+func (a *App) DeleteCalendarToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := a.store.DB.ExecContext(c.Request.Context(), "DELETE FROM calendar_feeds WHERE user_id = ?", userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete calendar feed",
+		})
+		return
+	}
+	if revoked, _ := result.RowsAffected(); revoked > 0 {
+		a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditCalendarTokenRevoked, nil))
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Calendar feed deleted successfully",
+	})
+}
+
+// GetBirthdayCalendar serves the user's contact birthdays as an iCalendar
+// feed. Calendar apps cannot send an Authorization header, so the feed is
+// authenticated by the token in its URL instead.
+func (a *App) GetBirthdayCalendar(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Error:   "Calendar token required",
+		})
+		return
+	}
+
+	var userID int
+	err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT user_id FROM calendar_feeds WHERE token_hash = ?", hashCalendarToken(token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Error:   "Invalid calendar token",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to look up calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch calendar",
+		})
+		return
+	}
+
+	user, err := a.store.Users.Get(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get calendar owner: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch calendar",
+		})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Account suspended",
+		})
+		return
+	}
+
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts for calendar: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch calendar",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", birthdayCalendar(contacts, time.Now().UTC()))
+}
+
+// birthdayCalendar renders a yearly recurring all-day event for each contact
+// with a birthday
+func birthdayCalendar(contacts []models.Contact, now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(format string, args ...interface{}) {
+		writeICSLine(&buf, fmt.Sprintf(format, args...))
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//PhoneSaver//Birthdays//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Contact Birthdays")
+	line("X-PUBLISHED-TTL:PT12H")
+	stamp := now.Format("20060102T150405Z")
+	for _, contact := range contacts {
+		if contact.Birthday.IsZero() {
+			continue
+		}
+		start := contact.Birthday
+		rule := "FREQ=YEARLY"
+		if start.Month() == time.February && start.Day() == 29 {
+			// Fall back to the last day of February outside leap years
+			rule = "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+		}
+		line("BEGIN:VEVENT")
+		line("UID:contact-%d-birthday@phonesaver", contact.ID)
+		line("DTSTAMP:%s", stamp)
+		line("DTSTART;VALUE=DATE:%s", start.Format("20060102"))
+		line("DTEND;VALUE=DATE:%s", start.AddDate(0, 0, 1).Format("20060102"))
+		line("RRULE:%s", rule)
+		line("SUMMARY:%s", icsEscaper.Replace(contact.Name+"'s birthday"))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// writeICSLine writes a content line terminated by CRLF, folding it so that
+// no line exceeds the length limit without splitting UTF-8 sequences
+func writeICSLine(buf *bytes.Buffer, s string) {
+	limit := icsLineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		buf.WriteString(s[:cut])
+		buf.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = icsLineLimit - 1
+	}
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+}
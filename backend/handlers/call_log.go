@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+const (
+	callIncoming = "incoming"
+	callOutgoing = "outgoing"
+)
+
+// callLogRequest is a batch of calls from the phone's call log
+type callLogRequest struct {
+	Calls []callRecord `json:"calls" binding:"required,min=1,max=500,dive"`
+}
+
+// callRecord is a call from the phone's call log. Duration is in seconds.
+type callRecord struct {
+	Number    string    `json:"number" binding:"required,max=255"`
+	Direction string    `json:"direction" binding:"required,oneof=incoming outgoing missed rejected"`
+	Duration  int       `json:"duration" binding:"min=0"`
+	Timestamp time.Time `json:"timestamp" binding:"required"`
+}
+
+// ImportCallLog records the answered calls of a batch from the phone's call
+// log as call interactions with the contacts whose normalized number they
+// were with. Calls sent before are recognized and not recorded again, so
+// the app may send overlapping batches.
+func (a *App) ImportCallLog(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req callLogRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	for i, call := range req.Calls {
+		if call.Timestamp.After(time.Now().Add(maxInteractionSkew)) {
+			respondValidation(c, models.ValidationError{Field: fmt.Sprintf("calls[%d].timestamp", i), Message: "Timestamp cannot be in the future"})
+			return
+		}
+	}
+
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to import call log",
+		})
+		return
+	}
+	idx := services.NewContactIndex(contacts)
+
+	var result models.CallLogResult
+	byContact := make(map[int][]models.Interaction)
+	for _, call := range req.Calls {
+		// Missed, rejected and unanswered calls aren't interactions
+		if (call.Direction != callIncoming && call.Direction != callOutgoing) || call.Duration == 0 {
+			result.Ignored++
+			continue
+		}
+		contact := idx.Match(models.Contact{Phone: call.Number})
+		if contact == nil {
+			result.Unmatched++
+			continue
+		}
+		byContact[contact.ID] = append(byContact[contact.ID], models.Interaction{
+			ContactID: contact.ID,
+			Type:      interactionCall,
+			// DATETIME columns keep whole seconds in MySQL, so calls are
+			// matched to those sent before at that precision
+			Timestamp: call.Timestamp.UTC().Truncate(time.Second),
+			Direction: call.Direction,
+			Duration:  call.Duration,
+		})
+	}
+
+	contactIDs := make([]int, 0, len(byContact))
+	for contactID := range byContact {
+		contactIDs = append(contactIDs, contactID)
+	}
+	sort.Ints(contactIDs)
+	updated, err := a.recordCalls(c.Request.Context(), userID.(int), contactIDs, byContact, &result)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to import call log: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to import call log",
+		})
+		return
+	}
+	for _, contactID := range updated {
+		a.publishContactUpdated(c.Request.Context(), userID.(int), contactID, c.GetString("device_id"))
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditImport, map[string]string{
+		"format": "call_log",
+		"calls":  strconv.Itoa(result.Recorded),
+	}))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// recordCalls stores the calls with each contact that weren't recorded
+// before, counting them in result, and updates the contacts' last
+// interaction. It returns the contacts calls were recorded with.
+func (a *App) recordCalls(ctx context.Context, userID int, contactIDs []int, calls map[int][]models.Interaction, result *models.CallLogResult) ([]int, error) {
+	tx, err := a.store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var updated []int
+	now := time.Now().UTC()
+	for _, contactID := range contactIDs {
+		// Lock the contact, in ID order, so concurrent batches with the same
+		// calls record them once
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM contacts WHERE id = ? AND user_id = ?"+a.store.ForUpdate(), contactID, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			// Deleted since the contacts were loaded
+			result.Unmatched += len(calls[contactID])
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock contact: %v", err)
+		}
+
+		recorded := 0
+		for _, call := range calls[contactID] {
+			var exists int
+			err := tx.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM interactions WHERE contact_id = ? AND occurred_at = ? AND call_direction = ?",
+				contactID, call.Timestamp, call.Direction,
+			).Scan(&exists)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check for recorded call: %v", err)
+			}
+			if exists > 0 {
+				result.Duplicates++
+				continue
+			}
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO interactions (user_id, contact_id, type, occurred_at, call_direction, call_duration, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				userID, contactID, call.Type, call.Timestamp, call.Direction, call.Duration, now,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record call: %v", err)
+			}
+			recorded++
+		}
+		if recorded == 0 {
+			continue
+		}
+		if err := refreshLastInteraction(ctx, tx, contactID); err != nil {
+			return nil, err
+		}
+		result.Recorded += recorded
+		updated = append(updated, contactID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"phonesaver-backend/config"
+)
+
+// errCaptchaFailed is returned when a CAPTCHA token is missing or the
+// provider doesn't accept it
+var errCaptchaFailed = errors.New("CAPTCHA verification failed")
+
+// CaptchaVerifier checks the token a client got by solving a CAPTCHA
+type CaptchaVerifier interface {
+	// Verify returns errCaptchaFailed if token isn't a valid solution
+	// for a client at remoteIP
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// newCaptchaVerifier creates the verifier selected by CAPTCHA_PROVIDER, or
+// nil when signups aren't challenged
+func newCaptchaVerifier(cfg *config.Config) (CaptchaVerifier, error) {
+	var endpoint string
+	switch cfg.CaptchaProvider {
+	case "", config.CaptchaProviderNone:
+		return nil, nil
+	case config.CaptchaProviderTurnstile:
+		endpoint = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	case config.CaptchaProviderReCAPTCHA:
+		endpoint = "https://www.google.com/recaptcha/api/siteverify"
+	default:
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q", cfg.CaptchaProvider)
+	}
+	if cfg.CaptchaSecret == "" {
+		return nil, fmt.Errorf("CAPTCHA_SECRET must be set for the %s CAPTCHA provider", cfg.CaptchaProvider)
+	}
+	return &siteVerifier{
+		endpoint: endpoint,
+		secret:   cfg.CaptchaSecret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// siteVerifier checks tokens with a siteverify API, which Turnstile and
+// reCAPTCHA share
+type siteVerifier struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return errCaptchaFailed
+	}
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	form.Set("remoteip", remoteIP)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify CAPTCHA: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to verify CAPTCHA: provider returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode CAPTCHA verification: %v", err)
+	}
+	if !result.Success {
+		for _, code := range result.ErrorCodes {
+			// A rejected secret is our misconfiguration, not the client's
+			if code == "invalid-input-secret" || code == "missing-input-secret" {
+				return fmt.Errorf("CAPTCHA provider rejected the secret: %s", code)
+			}
+		}
+		return errCaptchaFailed
+	}
+	return nil
+}
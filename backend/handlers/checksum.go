@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// VerifyBackup recomputes the checksum and item count of the stored backup
+// and compares them with the values recorded when the backup was taken
+func (a *App) VerifyBackup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	backupID := c.Param("id")
+	ctx := c.Request.Context()
+
+	var manifest models.BackupManifest
+	var checksum sql.NullString
+	err := a.store.DB.QueryRowContext(c.Request.Context(),
+		"SELECT id, status, total, checksum FROM backups WHERE id = ? AND user_id = ?",
+		backupID, userID,
+	).Scan(&manifest.ID, &manifest.Status, &manifest.Total, &checksum)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Backup not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get backup: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify backup",
+		})
+		return
+	}
+
+	if manifest.Status != "completed" || !checksum.Valid {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Only completed backups can be verified",
+		})
+		return
+	}
+
+	// Later runs overwrite the stored contacts, so only the latest completed
+	// backup can be compared against the store
+	latestID, err := a.latestCompletedBackupID(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get latest backup: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify backup",
+		})
+		return
+	}
+
+	key, ok := a.resolveBackupKey(c, userID.(int), false)
+	if !ok {
+		return
+	}
+
+	contacts, err := a.backupService.LoadContacts(ctx, userID.(int), key)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch contacts from backup store: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify backup",
+		})
+		return
+	}
+
+	actualChecksum := services.BackupChecksum(contacts)
+	superseded := latestID != manifest.ID
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"backup_id":         manifest.ID,
+			"valid":             !superseded && len(contacts) == manifest.Total && actualChecksum == checksum.String,
+			"superseded":        superseded,
+			"expected_count":    manifest.Total,
+			"actual_count":      len(contacts),
+			"expected_checksum": checksum.String,
+			"actual_checksum":   actualChecksum,
+		},
+	})
+}
+
+// latestCompletedBackupID returns the ID of the user's most recent completed
+// backup, whose contents are the ones currently held in the backup store
+func (a *App) latestCompletedBackupID(ctx context.Context, userID interface{}) (int, error) {
+	var latestID int
+	err := a.store.DB.QueryRowContext(ctx,
+		"SELECT id FROM backups WHERE user_id = ? AND status = 'completed' ORDER BY started_at DESC, id DESC LIMIT 1",
+		userID,
+	).Scan(&latestID)
+	return latestID, err
+}
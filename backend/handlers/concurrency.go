@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// contactETag returns the entity tag for a contact version
+func contactETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// contactListETag returns a weak entity tag for a page of a list of total
+// contacts, which changes whenever a contact in it changes or the list gains
+// or loses one, and differs between the representations fields and links
+// select
+func contactListETag(contacts []models.Contact, total int, fields []string, links bool) string {
+	sum := sha256.New()
+	sum.Write([]byte(strconv.Itoa(total) + "\n" + strings.Join(fields, ",") + "\n"))
+	if links {
+		sum.Write([]byte("links\n"))
+	}
+	for _, contact := range contacts {
+		sum.Write([]byte(strconv.Itoa(contact.ID) + ":" + strconv.Itoa(contact.Version) + ":" +
+			strconv.FormatInt(contact.UpdatedAt.UnixNano(), 10) + "\n"))
+	}
+	return `W/"` + hex.EncodeToString(sum.Sum(nil))[:32] + `"`
+}
+
+// notModified sets the ETag and, if known, Last-Modified headers for a
+// response, and responds with 304 if the client's cached copy is still
+// current according to If-None-Match or, failing that, If-Modified-Since
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		if !etagMatches(header, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+		if err != nil || lastModified.IsZero() || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison that ignores the W/ prefix
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion returns the contact version a write is conditional on,
+// taken from the If-Match header or else the version in the request body.
+// Zero means the write is unconditional. An invalid If-Match header is
+// reported to the client and ok is false.
+func expectedVersion(c *gin.Context, bodyVersion int) (version int, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return bodyVersion, true
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "If-Match",
+				Message: "If-Match must be the ETag of the contact",
+			},
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+// updateContactVersioned applies a patch to a contact and increments its
+// version. When expected is non-zero the update only succeeds if the contact
+// is still at that version; otherwise the current contact is returned with a
+// 409 so the client can reconcile. It reports whether the update succeeded,
+// in which case the new ETag has been set on the response.
+func (a *App) updateContactVersioned(c *gin.Context, userID, contactID, expected int, failure string, patch repository.ContactPatch) bool {
+	current, err := a.store.Contacts.Update(c.Request.Context(), userID, contactID, expected, patch)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return false
+	}
+	if err == repository.ErrVersionConflict {
+		c.Header("ETag", contactETag(current.Version))
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Data:    contactResponse(current),
+			Error:   "Contact was modified by another device",
+		})
+		return false
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("%s: %v", failure, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return false
+	}
+
+	c.Header("ETag", contactETag(current.Version))
+	a.publish(current.UserID, models.ContactEvent{Type: eventContactUpdated, ContactID: current.ID, Contact: contactResponse(current), DeviceID: c.GetString("device_id")})
+	return true
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+// maxSyncBatch is the number of changes accepted in one push
+const maxSyncBatch = 500
+
+const (
+	syncStatusCreated   = "created"
+	syncStatusApplied   = "applied"
+	syncStatusMerged    = "merged"
+	syncStatusUnchanged = "unchanged"
+	syncStatusDeleted   = "deleted"
+	syncStatusRejected  = "rejected"
+	syncStatusNotFound  = "not_found"
+	syncStatusInvalid   = "invalid"
+)
+
+const (
+	resolutionClient = "client"
+	resolutionServer = "server"
+	resolutionMerged = "merged"
+)
+
+// resolveConflict merges a change based on a stale version into the current
+// server contact. Fields are resolved last-writer-wins: the device's value is
+// kept if the change was made after the server's last update. Tags are merged
+// instead, keeping tags added on either side.
+func resolveConflict(server models.Contact, change models.SyncChange) (models.Contact, []models.FieldConflict) {
+	clientWins := change.ModifiedAt.After(server.UpdatedAt)
+	merged := server
+	var conflicts []models.FieldConflict
+
+	edited := make(map[string]bool, len(change.Fields))
+	for _, field := range change.Fields {
+		edited[field] = true
+	}
+	resolve := func(field string, equal bool, client, current interface{}, useClient func()) {
+		if equal || (len(edited) > 0 && !edited[field]) {
+			return
+		}
+		resolution := resolutionServer
+		if clientWins {
+			useClient()
+			resolution = resolutionClient
+		}
+		conflicts = append(conflicts, models.FieldConflict{Field: field, Client: client, Server: current, Resolution: resolution})
+	}
+	resolve("name", change.Name == server.Name, change.Name, server.Name, func() { merged.Name = change.Name })
+	resolve("phone", change.Phone == server.Phone, change.Phone, server.Phone, func() { merged.Phone = change.Phone })
+	resolve("encrypted_phone", change.EncryptedPhone == server.EncryptedPhone, change.EncryptedPhone, server.EncryptedPhone,
+		func() { merged.EncryptedPhone = change.EncryptedPhone })
+	resolve("birthday", change.Birthday.Equal(server.Birthday), change.Birthday, server.Birthday,
+		func() { merged.Birthday = change.Birthday })
+
+	if (len(edited) == 0 || edited["tags"]) && strings.Join(change.Tags, ",") != strings.Join(server.Tags, ",") {
+		merged.Tags = mergeTags(server.Tags, change.Tags)
+		conflicts = append(conflicts, models.FieldConflict{Field: "tags", Client: change.Tags, Server: server.Tags, Resolution: resolutionMerged})
+	}
+	return merged, conflicts
+}
+
+// mergeTags returns the server tags followed by any tags only on the device
+func mergeTags(server, client []string) []string {
+	merged := append([]string{}, server...)
+	seen := make(map[string]bool, len(server))
+	for _, tag := range server {
+		seen[strings.ToLower(tag)] = true
+	}
+	for _, tag := range client {
+		if !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// pushChangesRequest is a batch of changes pushed by a device. Each change
+// is validated on its own, so one invalid change doesn't reject the batch.
+type pushChangesRequest struct {
+	Changes []models.SyncChange `json:"changes" binding:"required"`
+}
+
+// PushChanges applies a batch of changes made on a device, resolving
+// conflicts with changes made elsewhere, and reports the outcome of each
+func (a *App) PushChanges(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req pushChangesRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.Changes) > maxSyncBatch {
+		respondValidation(c, models.ValidationError{
+			Field:   "changes",
+			Message: fmt.Sprintf("At most %d changes can be pushed at once", maxSyncBatch),
+		})
+		return
+	}
+
+	created := 0
+	for _, change := range req.Changes {
+		if change.ID == 0 && !change.Deleted {
+			created++
+		}
+	}
+	if !a.allowContacts(c, userID.(int), created, false, "Failed to apply changes") {
+		return
+	}
+
+	results := make([]models.SyncResult, 0, len(req.Changes))
+	receivedAt := time.Now().UTC()
+	err := a.store.Contacts.Transaction(c.Request.Context(), func(tx repository.ContactTx) error {
+		for i, change := range req.Changes {
+			if change.ModifiedAt.IsZero() {
+				change.ModifiedAt = receivedAt
+			}
+			result, err := applyChange(tx, userID.(int), change)
+			if err != nil {
+				return err
+			}
+			result.Index = i
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to apply changes: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to apply changes",
+		})
+		return
+	}
+
+	conflicts := 0
+	deviceID := c.GetString("device_id")
+	for _, result := range results {
+		if len(result.Conflicts) > 0 {
+			conflicts++
+		}
+		switch result.Status {
+		case syncStatusCreated:
+			a.publish(userID.(int), models.ContactEvent{Type: eventContactCreated, ContactID: result.ID, Contact: result.Contact, DeviceID: deviceID})
+		case syncStatusApplied, syncStatusMerged:
+			a.publish(userID.(int), models.ContactEvent{Type: eventContactUpdated, ContactID: result.ID, Contact: result.Contact, DeviceID: deviceID})
+		case syncStatusDeleted:
+			a.publish(userID.(int), models.ContactEvent{Type: eventContactDeleted, ContactID: result.ID, DeviceID: deviceID})
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"results":   results,
+			"conflicts": conflicts,
+		},
+	})
+}
+
+// applyChange applies a single pushed change within tx
+func applyChange(tx repository.ContactTx, userID int, change models.SyncChange) (models.SyncResult, error) {
+	if errs := validateChange(change); len(errs) > 0 {
+		return models.SyncResult{ID: change.ID, Status: syncStatusInvalid, Error: "Invalid change", Errors: errs}, nil
+	}
+	if change.ID == 0 {
+		if change.Deleted {
+			return models.SyncResult{Status: syncStatusInvalid, Error: "New contacts cannot be deleted"}, nil
+		}
+		contact := models.Contact{
+			UserID:          userID,
+			Name:            change.Name,
+			Phone:           change.Phone,
+			EncryptedPhone:  change.EncryptedPhone,
+			Tags:            change.Tags,
+			LastInteraction: change.LastInteraction,
+			Birthday:        change.Birthday,
+			Version:         1,
+		}
+		if err := tx.Create(&contact); err != nil {
+			return models.SyncResult{}, fmt.Errorf("failed to create contact: %v", err)
+		}
+		return models.SyncResult{ID: contact.ID, Status: syncStatusCreated, Version: contact.Version, Contact: contactResponse(contact)}, nil
+	}
+
+	server, err := tx.GetForUpdate(userID, change.ID)
+	if err == repository.ErrNotFound {
+		// Deleting a contact that is already gone is not an error
+		if change.Deleted {
+			return models.SyncResult{ID: change.ID, Status: syncStatusDeleted}, nil
+		}
+		return models.SyncResult{ID: change.ID, Status: syncStatusNotFound}, nil
+	}
+	if err != nil {
+		return models.SyncResult{}, fmt.Errorf("failed to load contact: %v", err)
+	}
+	stale := change.Version != server.Version
+
+	if change.Deleted {
+		// A deletion loses to a later edit made elsewhere
+		if stale && !change.ModifiedAt.After(server.UpdatedAt) {
+			return models.SyncResult{
+				ID:      server.ID,
+				Status:  syncStatusRejected,
+				Version: server.Version,
+				Conflicts: []models.FieldConflict{
+					{Field: "deleted", Client: true, Server: false, Resolution: resolutionServer},
+				},
+				Contact: contactResponse(server),
+			}, nil
+		}
+		if _, err := tx.Delete(userID, server.ID); err != nil {
+			return models.SyncResult{}, fmt.Errorf("failed to delete contact: %v", err)
+		}
+		return models.SyncResult{ID: server.ID, Status: syncStatusDeleted}, nil
+	}
+
+	status := syncStatusApplied
+	updated := server
+	var conflicts []models.FieldConflict
+	if stale {
+		updated, conflicts = resolveConflict(server, change)
+		status = syncStatusMerged
+	} else {
+		edited := editedFields(change)
+		if edited("name") {
+			updated.Name = change.Name
+		}
+		if edited("phone") {
+			updated.Phone = change.Phone
+		}
+		if edited("encrypted_phone") {
+			updated.EncryptedPhone = change.EncryptedPhone
+		}
+		if edited("tags") {
+			updated.Tags = change.Tags
+		}
+		if edited("birthday") {
+			updated.Birthday = change.Birthday
+		}
+	}
+
+	if services.ContactsEqual(updated, server) {
+		return models.SyncResult{ID: server.ID, Status: syncStatusUnchanged, Version: server.Version, Conflicts: conflicts, Contact: contactResponse(server)}, nil
+	}
+
+	// last_interaction is derived from recorded interactions
+	if err := tx.Update(userID, server.ID, repository.EditableFields(updated)); err != nil {
+		return models.SyncResult{}, fmt.Errorf("failed to update contact: %v", err)
+	}
+	updated.Version++
+	updated.UpdatedAt = time.Now().UTC()
+	return models.SyncResult{ID: server.ID, Status: status, Version: updated.Version, Conflicts: conflicts, Contact: contactResponse(updated)}, nil
+}
+
+// validateChange returns the invalid fields of a pushed change. New contacts
+// need a name and phone, while updates listing their edited fields in Fields
+// are only checked on those, as the others are left as they are.
+func validateChange(change models.SyncChange) []models.ValidationError {
+	var errs []models.ValidationError
+	if change.ID == 0 && !change.Deleted {
+		if change.Name == "" {
+			errs = append(errs, models.ValidationError{Field: "name", Message: "Name is required"})
+		}
+		if change.Phone == "" {
+			errs = append(errs, models.ValidationError{Field: "phone", Message: "Phone is required"})
+		}
+	}
+	edited := editedFields(change)
+	for _, e := range validateValue(change) {
+		// Errors in a tag are reported as tags[i]
+		field, _, _ := strings.Cut(e.Field, "[")
+		if edited(field) {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// editedFields returns whether a change edits a field: every field if it
+// doesn't list the fields it edits, or only those listed. New contacts are
+// created with every field.
+func editedFields(change models.SyncChange) func(field string) bool {
+	if change.ID == 0 || len(change.Fields) == 0 {
+		return func(string) bool { return true }
+	}
+	listed := make(map[string]bool, len(change.Fields))
+	for _, field := range change.Fields {
+		listed[field] = true
+	}
+	return func(field string) bool { return listed[field] }
+}
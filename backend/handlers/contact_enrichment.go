@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// enrichmentSourceUser is the source of the profile details users entered
+const enrichmentSourceUser = "user"
+
+const (
+	// contactEnrichmentInterval is how often the enrichment worker looks
+	// for profiles to enrich
+	contactEnrichmentInterval = time.Hour
+	// contactEnrichmentRefresh is how long a profile goes before it is
+	// enriched again, picking up new photos and job changes
+	contactEnrichmentRefresh = 30 * 24 * time.Hour
+	// contactEnrichmentBatch is the most profiles enriched in a run
+	contactEnrichmentBatch = 500
+	// contactEnrichmentPause is how long the worker waits between lookups,
+	// keeping within the provider's rate limit
+	contactEnrichmentPause = 100 * time.Millisecond
+)
+
+// errEnrichmentPending is returned by enrichers still looking an email
+// address up, which is asked about again on the next run
+var errEnrichmentPending = errors.New("enrichment is pending")
+
+// enrichment is what an enricher found for an email address; either field
+// is empty if it found none
+type enrichment struct {
+	PhotoURL string
+	Company  string
+}
+
+// ContactEnricher suggests details for contacts from their email addresses
+type ContactEnricher interface {
+	// Source names the provider, and is recorded as the source of the
+	// details it suggests
+	Source() string
+	// Enrich looks up email, returning errEnrichmentPending if the
+	// provider has yet to finish
+	Enrich(ctx context.Context, email string) (enrichment, error)
+}
+
+// newContactEnricher creates the enricher selected by
+// CONTACT_ENRICHMENT_PROVIDER, or nil when contacts aren't enriched
+func newContactEnricher(cfg *config.Config) (ContactEnricher, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch cfg.ContactEnrichmentProvider {
+	case "", config.ContactEnrichmentProviderNone:
+		return nil, nil
+	case config.ContactEnrichmentProviderGravatar:
+		return &gravatarEnricher{baseURL: "https://gravatar.com/avatar/", client: client}, nil
+	case config.ContactEnrichmentProviderClearbit:
+		if cfg.ClearbitAPIKey == "" {
+			return nil, fmt.Errorf("CLEARBIT_API_KEY must be set to enrich contacts through Clearbit")
+		}
+		return &clearbitEnricher{
+			endpoint: "https://person.clearbit.com/v2/combined/find",
+			apiKey:   cfg.ClearbitAPIKey,
+			client:   client,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown contact enrichment provider %q", cfg.ContactEnrichmentProvider)
+	}
+}
+
+// gravatarEnricher finds the photos people chose on Gravatar, which are
+// addressed by the SHA-256 hash of the email address
+type gravatarEnricher struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (g *gravatarEnricher) Source() string {
+	return config.ContactEnrichmentProviderGravatar
+}
+
+func (g *gravatarEnricher) Enrich(ctx context.Context, email string) (enrichment, error) {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	photoURL := g.baseURL + hex.EncodeToString(hash[:])
+	// d=404 answers 404 rather than a generated image for addresses
+	// without a photo
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, photoURL+"?d=404", nil)
+	if err != nil {
+		return enrichment{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return enrichment{}, fmt.Errorf("failed to look up Gravatar: %v", err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return enrichment{}, nil
+	case resp.StatusCode >= 300:
+		return enrichment{}, fmt.Errorf("failed to look up Gravatar: Gravatar returned %s", resp.Status)
+	}
+	return enrichment{PhotoURL: photoURL}, nil
+}
+
+// clearbitEnricher finds people's photos and employers with the Clearbit
+// Enrichment API, which looks unknown addresses up in the background
+type clearbitEnricher struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func (e *clearbitEnricher) Source() string {
+	return config.ContactEnrichmentProviderClearbit
+}
+
+func (e *clearbitEnricher) Enrich(ctx context.Context, email string) (enrichment, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.endpoint+"?email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return enrichment{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return enrichment{}, fmt.Errorf("failed to look up Clearbit: %v", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return enrichment{}, errEnrichmentPending
+	case resp.StatusCode == http.StatusNotFound:
+		return enrichment{}, nil
+	case resp.StatusCode >= 300:
+		return enrichment{}, fmt.Errorf("failed to look up Clearbit: Clearbit returned %s", resp.Status)
+	}
+
+	var result struct {
+		Person *struct {
+			Avatar string `json:"avatar"`
+		} `json:"person"`
+		Company *struct {
+			Name string `json:"name"`
+		} `json:"company"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return enrichment{}, fmt.Errorf("failed to decode Clearbit response: %v", err)
+	}
+	var found enrichment
+	if result.Person != nil {
+		found.PhotoURL = result.Person.Avatar
+	}
+	if result.Company != nil {
+		found.Company = result.Company.Name
+	}
+	return found, nil
+}
+
+// applyEnrichment fills a profile's missing photo and company with those
+// found by source, unless the user rejected them before
+func applyEnrichment(profile *models.ContactProfile, source string, found enrichment, now time.Time) {
+	if profile.PhotoURL == "" && found.PhotoURL != "" && found.PhotoURL != profile.RejectedPhotoURL {
+		profile.PhotoURL, profile.PhotoSource = found.PhotoURL, source
+	}
+	if profile.Company == "" && found.Company != "" && found.Company != profile.RejectedCompany {
+		profile.Company, profile.CompanySource = found.Company, source
+	}
+	profile.EnrichedAt = &now
+}
+
+// RunContactEnrichment suggests photos and companies for the contacts of
+// users who opted in, as their profiles become due
+func (a *App) RunContactEnrichment() {
+	if a.enricher == nil {
+		return
+	}
+	ticker := time.NewTicker(contactEnrichmentInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		enriched, err := a.enrichProfiles(context.Background(), time.Now().UTC())
+		if err != nil {
+			logging.Errorf("Failed to enrich contacts: %v", err)
+		}
+		if enriched > 0 {
+			logging.Infof("Enriched %d contacts", enriched)
+		}
+	}
+}
+
+// enrichProfiles looks up the profiles due for enrichment, returning the
+// number enriched. It stops at the first provider error, as the others
+// would most likely fail too.
+func (a *App) enrichProfiles(ctx context.Context, now time.Time) (int, error) {
+	profiles, err := a.store.ContactProfiles.ListDue(ctx, now.Add(-contactEnrichmentRefresh), contactEnrichmentBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find contacts to enrich: %v", err)
+	}
+
+	enriched := 0
+	for i, profile := range profiles {
+		if i > 0 {
+			time.Sleep(contactEnrichmentPause)
+		}
+		found, err := a.enricher.Enrich(ctx, profile.Email)
+		if err == errEnrichmentPending {
+			continue
+		}
+		if err != nil {
+			return enriched, err
+		}
+		applyEnrichment(&profile, a.enricher.Source(), found, now.Truncate(time.Second))
+		if err := a.store.ContactProfiles.Save(ctx, profile); err != nil {
+			return enriched, fmt.Errorf("failed to save profile of contact %d: %v", profile.ContactID, err)
+		}
+		enriched++
+	}
+	return enriched, nil
+}
+
+// loadContactProfile returns the profile of one of the user's contacts,
+// responding with 404 if the contact doesn't exist or isn't accessible.
+// Contacts without a saved profile get an empty one.
+func (a *App) loadContactProfile(c *gin.Context, access, failure string) (models.ContactProfile, bool) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return models.ContactProfile{}, false
+	}
+	if !a.allowContact(c, userID.(int), contactID, access, failure) {
+		return models.ContactProfile{}, false
+	}
+
+	_, err := a.contactService.Get(c.Request.Context(), userID.(int), contactID)
+	if err == nil {
+		var profile models.ContactProfile
+		profile, err = a.store.ContactProfiles.Get(c.Request.Context(), userID.(int), contactID)
+		if err == repository.ErrNotFound {
+			return models.ContactProfile{ContactID: contactID, UserID: userID.(int)}, true
+		}
+		if err == nil {
+			return profile, true
+		}
+	}
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return models.ContactProfile{}, false
+	}
+	middleware.RequestLogger(c).Errorf("Failed to get contact profile: %v", err)
+	c.JSON(http.StatusInternalServerError, models.Response{
+		Success: false,
+		Error:   failure,
+	})
+	return models.ContactProfile{}, false
+}
+
+// GetContactProfile returns a contact's email address, and its photo and
+// company with where they came from
+func (a *App) GetContactProfile(c *gin.Context) {
+	profile, ok := a.loadContactProfile(c, repository.AccessRead, "Failed to get contact profile")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    profile,
+	})
+}
+
+// UpdateContactProfile sets a contact's email address, photo and company.
+// Fields left out of the request keep their current values. A new email
+// address is enriched again, and a photo or company entered replaces any
+// suggestion.
+func (a *App) UpdateContactProfile(c *gin.Context) {
+	profile, ok := a.loadContactProfile(c, repository.AccessWrite, "Failed to update contact profile")
+	if !ok {
+		return
+	}
+
+	update := models.ContactProfileUpdate{Email: profile.Email, PhotoURL: profile.PhotoURL, Company: profile.Company}
+	if !bindJSON(c, &update) {
+		return
+	}
+	update.Company = strings.TrimSpace(update.Company)
+	if update.Email != profile.Email {
+		profile.Email, profile.EnrichedAt = update.Email, nil
+	}
+	if update.PhotoURL != profile.PhotoURL {
+		profile.PhotoURL, profile.PhotoSource = update.PhotoURL, profileSource(update.PhotoURL)
+	}
+	if update.Company != profile.Company {
+		profile.Company, profile.CompanySource = update.Company, profileSource(update.Company)
+	}
+
+	if err := a.store.ContactProfiles.Save(c.Request.Context(), profile); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update contact profile: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update contact profile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    profile,
+	})
+}
+
+// profileSource returns the source of a detail the user entered, which is
+// empty when they cleared it
+func profileSource(value string) string {
+	if value == "" {
+		return ""
+	}
+	return enrichmentSourceUser
+}
+
+// RejectContactEnrichment removes a suggested photo or company from a
+// contact's profile, and keeps it from being suggested again
+func (a *App) RejectContactEnrichment(c *gin.Context) {
+	profile, ok := a.loadContactProfile(c, repository.AccessWrite, "Failed to reject suggestion")
+	if !ok {
+		return
+	}
+
+	var req models.EnrichmentRejection
+	if !bindJSON(c, &req) {
+		return
+	}
+	value, source := &profile.PhotoURL, &profile.PhotoSource
+	rejected := &profile.RejectedPhotoURL
+	if req.Field == "company" {
+		value, source, rejected = &profile.Company, &profile.CompanySource, &profile.RejectedCompany
+	}
+	if *value == "" || *source == enrichmentSourceUser {
+		respondValidation(c, models.ValidationError{Field: "field", Message: "The contact has no suggested " + strings.ReplaceAll(req.Field, "_", " ")})
+		return
+	}
+	*rejected, *value, *source = *value, "", ""
+
+	if err := a.store.ContactProfiles.Save(c.Request.Context(), profile); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to reject suggestion: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to reject suggestion",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    profile,
+	})
+}
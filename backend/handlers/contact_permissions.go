@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	defaultPermissionLimit = 50
+	maxPermissionLimit     = 200
+)
+
+// permissionRequest is the body of a request to share a contact, or the
+// contacts with a tag, with a member of an organization
+type permissionRequest struct {
+	UserID    int    `json:"user_id" binding:"required"`
+	ContactID int    `json:"contact_id" binding:"min=0"`
+	Tag       string `json:"tag" binding:"max=50,excludes=0x2C"`
+	Access    string `json:"access" binding:"required,oneof=read write"`
+}
+
+// ListContactPermissions lists the contacts shared with the members of an
+// organization, or with the one in ?user_id. Members who aren't owners or
+// admins only see their own.
+func (a *App) ListContactPermissions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+
+	memberID := 0
+	if org.Role == repository.RoleMember {
+		memberID = userID.(int)
+	} else if param := c.Query("user_id"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil || id <= 0 {
+			respondValidation(c, models.ValidationError{Field: "user_id", Message: "User ID must be a positive number"})
+			return
+		}
+		memberID = id
+	}
+
+	var after int
+	page, ok := parseListPage(c, defaultPermissionLimit, maxPermissionLimit, &after)
+	if !ok {
+		return
+	}
+	total, err := a.store.ContactPermissions.Count(c.Request.Context(), org.ID, memberID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch permissions",
+		})
+		return
+	}
+	permissions, err := a.store.ContactPermissions.List(c.Request.Context(), org.ID, memberID, page)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch permissions",
+		})
+		return
+	}
+
+	next := ""
+	if len(permissions) == page.Limit {
+		next = listCursor(permissions[len(permissions)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    permissions,
+	})
+}
+
+// GrantContactPermission shares a contact of an organization, or the
+// contacts with a tag, with a member who isn't an owner or admin, replacing
+// the access they had to it
+func (a *App) GrantContactPermission(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	var req permissionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if (req.ContactID == 0) == (req.Tag == "") {
+		respondValidation(c, models.ValidationError{Field: "contact_id", Message: "Give either a contact ID or a tag"})
+		return
+	}
+
+	member, ok := a.loadMember(c, org, req.UserID, "Failed to grant permission")
+	if !ok {
+		return
+	}
+	if member.Role != repository.RoleMember {
+		respondValidation(c, models.ValidationError{Field: "user_id", Message: "Owners and admins can already access every contact"})
+		return
+	}
+	if req.ContactID != 0 {
+		_, err := a.contactService.Get(c.Request.Context(), org.AccountID, req.ContactID)
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, models.Response{
+				Success: false,
+				Error:   "Contact not found",
+			})
+			return
+		}
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to get contact: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to grant permission",
+			})
+			return
+		}
+	}
+
+	permission := models.ContactPermission{UserID: req.UserID, ContactID: req.ContactID, Tag: req.Tag, Access: req.Access}
+	if err := a.store.ContactPermissions.Grant(c.Request.Context(), org.ID, &permission); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to grant permission: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to grant permission",
+		})
+		return
+	}
+	a.auditPermission(c, org, auditPermissionGranted, permission)
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    permission,
+	})
+}
+
+// RevokeContactPermission stops sharing the contacts of a permission with
+// the member it was given to
+func (a *App) RevokeContactPermission(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	id, err := strconv.Atoi(c.Param("permission"))
+	if err != nil {
+		respondPermissionNotFound(c)
+		return
+	}
+
+	permission, err := a.store.ContactPermissions.Get(c.Request.Context(), org.ID, id)
+	if err == repository.ErrNotFound {
+		respondPermissionNotFound(c)
+		return
+	}
+	if err == nil {
+		_, err = a.store.ContactPermissions.Revoke(c.Request.Context(), org.ID, id)
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to revoke permission: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to revoke permission",
+		})
+		return
+	}
+	a.auditPermission(c, org, auditPermissionRevoked, permission)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Permission revoked successfully",
+	})
+}
+
+// auditPermission records a change to the contacts shared with a member in
+// the organization's audit log
+func (a *App) auditPermission(c *gin.Context, org models.Organization, action string, permission models.ContactPermission) {
+	userID, _ := c.Get("user_id")
+	details := map[string]string{
+		"user_id":   strconv.Itoa(permission.UserID),
+		"access":    permission.Access,
+		"member_id": strconv.Itoa(userID.(int)),
+	}
+	if permission.ContactID != 0 {
+		details["contact_id"] = strconv.Itoa(permission.ContactID)
+	} else {
+		details["tag"] = permission.Tag
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, org.AccountID, action, details))
+}
+
+func respondPermissionNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Permission not found",
+	})
+}
+
+// contactAccess is which of the contacts a request works with the user may
+// read or change
+type contactAccess struct {
+	// restricted is set for the members of an organization who aren't
+	// owners or admins, who only work with the contacts shared with them
+	restricted  bool
+	permissions []models.ContactPermission
+}
+
+// allows reports whether the user may read a contact, or also change it if
+// access is repository.AccessWrite
+func (access contactAccess) allows(contact models.Contact, want string) bool {
+	if !access.restricted {
+		return true
+	}
+	for _, permission := range access.permissions {
+		if want == repository.AccessWrite && permission.Access != repository.AccessWrite {
+			continue
+		}
+		if permission.ContactID == contact.ID || (permission.Tag != "" && slices.Contains(contact.Tags, permission.Tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readable returns the contacts the user may read
+func (access contactAccess) readable(contacts []models.Contact) []models.Contact {
+	if !access.restricted {
+		return contacts
+	}
+	shared := []models.Contact{}
+	for _, contact := range contacts {
+		if access.allows(contact, repository.AccessRead) {
+			shared = append(shared, contact)
+		}
+	}
+	return shared
+}
+
+// loadContactAccess returns which contacts the user may work with, which
+// is all of them but in an organization they are a member of without being
+// an owner or admin. It responds with failure if the permissions can't be
+// loaded.
+func (a *App) loadContactAccess(c *gin.Context, failure string) (contactAccess, bool) {
+	value, ok := c.Get("organization")
+	if !ok || value.(models.Organization).Role != repository.RoleMember {
+		return contactAccess{}, true
+	}
+	permissions, err := a.store.ContactPermissions.List(c.Request.Context(), value.(models.Organization).ID, c.GetInt("member_id"), repository.Page{})
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return contactAccess{}, false
+	}
+	return contactAccess{restricted: true, permissions: permissions}, true
+}
+
+// allowContact reports whether the user may read a contact, or also change
+// it if want is repository.AccessWrite. It responds with 404 for contacts
+// that weren't shared with them, as if they didn't exist, and with 403 for
+// those they may only read.
+func (a *App) allowContact(c *gin.Context, userID, contactID int, want, failure string) bool {
+	access, ok := a.loadContactAccess(c, failure)
+	if !ok {
+		return false
+	}
+	if !access.restricted {
+		return true
+	}
+
+	contact, err := a.contactService.Get(c.Request.Context(), userID, contactID)
+	if err != nil && err != repository.ErrNotFound {
+		middleware.RequestLogger(c).Errorf("Failed to get contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return false
+	}
+	if err == repository.ErrNotFound || !access.allows(contact, repository.AccessRead) {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return false
+	}
+	if !access.allows(contact, want) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "This contact was only shared with you to read",
+		})
+		return false
+	}
+	return true
+}
+
+// shareCreatedContact lets the member of an organization who created a
+// contact change it, if their permissions don't already
+func (a *App) shareCreatedContact(c *gin.Context, access contactAccess, contact models.Contact) {
+	if access.allows(contact, repository.AccessWrite) {
+		return
+	}
+	value, _ := c.Get("organization")
+	permission := models.ContactPermission{UserID: c.GetInt("member_id"), ContactID: contact.ID, Access: repository.AccessWrite}
+	if err := a.store.ContactPermissions.Grant(c.Request.Context(), value.(models.Organization).ID, &permission); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to share created contact: %v", err)
+	}
+}
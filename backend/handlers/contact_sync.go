@@ -0,0 +1,811 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+const (
+	// contactSyncCheckInterval is how often connections are checked for
+	// being due a sync
+	contactSyncCheckInterval = time.Minute
+	// contactSyncRequestTimeout bounds each request to a contact provider
+	contactSyncRequestTimeout = 30 * time.Second
+)
+
+var (
+	// errSyncTokenExpired is returned by contactProvider.changes for a sync
+	// token the provider no longer accepts, which takes a full sync
+	errSyncTokenExpired = errors.New("sync token expired")
+	// errRemoteChanged is returned by contactProvider.update for a contact
+	// that changed at the provider since it was last pulled
+	errRemoteChanged = errors.New("remote contact changed")
+)
+
+// remoteContact is a provider's copy of a contact, mapped to the fields
+// that are synced: the name, the primary phone number and the birthday
+type remoteContact struct {
+	ID   string
+	ETag string
+	// Deleted is set for contacts deleted at the provider, which only have
+	// an ID
+	Deleted   bool
+	Name      string
+	Phone     string
+	Birthday  time.Time
+	UpdatedAt time.Time
+}
+
+// remoteChanges are the contacts a provider reports changed since a sync
+// token. Full is set when every contact is listed, in which case those not
+// listed were deleted.
+type remoteChanges struct {
+	Contacts  []remoteContact
+	SyncToken string
+	Full      bool
+}
+
+// contactProvider is a service users' contacts are kept in sync with, over
+// an OAuth client authorized by them
+type contactProvider interface {
+	// title names the provider to users
+	title() string
+	// oauth returns the OAuth configuration users connect their account
+	// with, sending them back to redirectURL
+	oauth(redirectURL string) *oauth2.Config
+	// authOptions are the options of the consent screen, which must grant a
+	// refresh token
+	authOptions() []oauth2.AuthCodeOption
+	// account returns the name of the connected account, such as its email
+	account(ctx context.Context, client *http.Client) (string, error)
+	// changes returns the contacts changed since syncToken, or all of them
+	// if it is empty
+	changes(ctx context.Context, client *http.Client, syncToken string) (remoteChanges, error)
+	// create creates a copy of contact at the provider, returning its ID
+	// and ETag
+	create(ctx context.Context, client *http.Client, contact models.Contact) (remoteContact, error)
+	// update changes the synced fields of a provider's contact to those of
+	// contact, leaving the others as they are, and returns its new ETag. It
+	// returns errRemoteChanged if the contact no longer has etag.
+	update(ctx context.Context, client *http.Client, remoteID, etag string, contact models.Contact) (string, error)
+	// delete deletes a provider's contact. One that is already gone is not
+	// an error.
+	delete(ctx context.Context, client *http.Client, remoteID string) error
+}
+
+// newContactProviders returns the contact providers whose OAuth clients are
+// configured, by name
+func newContactProviders(cfg *config.Config) map[string]contactProvider {
+	providers := map[string]contactProvider{}
+	if cfg.GoogleClientID != "" {
+		providers[providerGoogle] = newGoogleContacts(cfg)
+	}
+	if cfg.MicrosoftClientID != "" {
+		providers[providerOutlook] = newOutlookContacts(cfg)
+	}
+	return providers
+}
+
+// integrationPage tells a user who was sent back from a contact provider's
+// consent screen whether their account was connected
+var integrationPage = template.Must(template.New("integration").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>PhoneSaver integrations</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// integrationView is what integrationPage shows
+type integrationView struct {
+	Title   string
+	Message string
+}
+
+// integrationsResponse lists the contact providers that can be connected
+// and the user's connections to them
+type integrationsResponse struct {
+	Available   []string             `json:"available"`
+	Connections []models.ContactSync `json:"connections"`
+}
+
+// connectIntegrationResponse is the consent screen a user grants access to
+// their account at a provider on
+type connectIntegrationResponse struct {
+	URL string `json:"url"`
+}
+
+// ListIntegrations returns the contact providers the server can sync with
+// and the user's connections to them
+func (a *App) ListIntegrations(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	syncs, err := a.store.ContactSyncs.List(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to list integrations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to list integrations",
+		})
+		return
+	}
+	available := make([]string, 0, len(a.contactProviders))
+	for name := range a.contactProviders {
+		available = append(available, name)
+	}
+	sort.Strings(available)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    integrationsResponse{Available: available, Connections: syncs},
+	})
+}
+
+// ConnectIntegration returns the URL of the provider's consent screen,
+// which sends the user back to IntegrationCallback once they grant access
+// to their contacts
+func (a *App) ConnectIntegration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	name := c.Param("provider")
+	provider, ok := a.contactProviders[name]
+	if !ok {
+		respondIntegrationNotFound(c)
+		return
+	}
+
+	state, err := a.authService.IssueContactSyncState(userID.(int), name)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to issue contact sync state: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to connect integration",
+		})
+		return
+	}
+	url := provider.oauth(integrationCallbackURL(c, name)).AuthCodeURL(state, provider.authOptions()...)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    connectIntegrationResponse{URL: url},
+	})
+}
+
+// IntegrationCallback is where a provider's consent screen sends the user
+// back to. It stores the connection to their account and starts importing
+// their contacts, showing a page that says so.
+func (a *App) IntegrationCallback(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := a.contactProviders[name]
+	if !ok {
+		a.renderIntegration(c, http.StatusNotFound, integrationView{
+			Title:   "Integration not found",
+			Message: "This integration isn't available.",
+		})
+		return
+	}
+	failed := integrationView{
+		Title:   provider.title() + " wasn't connected",
+		Message: fmt.Sprintf("PhoneSaver couldn't connect to %s. Try connecting it again from PhoneSaver.", provider.title()),
+	}
+	if c.Query("error") != "" {
+		failed.Message = fmt.Sprintf("Access to %s wasn't granted.", provider.title())
+		a.renderIntegration(c, http.StatusBadRequest, failed)
+		return
+	}
+
+	userID, err := a.authService.ParseContactSyncState(c.Query("state"), name)
+	if err == nil {
+		var user models.User
+		user, err = a.store.Users.Get(c.Request.Context(), userID)
+		if err == nil && user.SuspendedAt != nil {
+			err = services.ErrInvalidSyncState
+		}
+	}
+	if err == services.ErrInvalidSyncState || err == repository.ErrNotFound {
+		failed.Message = fmt.Sprintf("This link has expired. Connect %s again from PhoneSaver.", provider.title())
+		a.renderIntegration(c, http.StatusBadRequest, failed)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get user: %v", err)
+		a.renderIntegration(c, http.StatusInternalServerError, failed)
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), oauth2.HTTPClient, &http.Client{Timeout: contactSyncRequestTimeout})
+	oauthConfig := provider.oauth(integrationCallbackURL(c, name))
+	token, err := oauthConfig.Exchange(ctx, c.Query("code"))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to exchange %s authorization code: %v", name, err)
+		a.renderIntegration(c, http.StatusBadRequest, failed)
+		return
+	}
+	account, err := provider.account(ctx, oauthConfig.Client(ctx, token))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get %s account: %v", name, err)
+		a.renderIntegration(c, http.StatusBadGateway, failed)
+		return
+	}
+
+	sync := models.ContactSync{
+		UserID:   userID,
+		Provider: name,
+		Account:  account,
+		Token:    models.OAuthToken{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken, Expiry: token.Expiry},
+	}
+	if err := a.store.ContactSyncs.Connect(c.Request.Context(), sync); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to store integration: %v", err)
+		a.renderIntegration(c, http.StatusInternalServerError, failed)
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID, auditIntegrationConnected, map[string]string{
+		"provider": name,
+		"account":  account,
+	}))
+
+	if _, err := a.startJob(c.Request.Context(), userID, jobTypeContactSync, a.contactSyncJob(userID, name)); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to start initial contact sync: %v", err)
+	}
+	a.renderIntegration(c, http.StatusOK, integrationView{
+		Title:   provider.title() + " connected",
+		Message: fmt.Sprintf("Your contacts in %s (%s) are being imported, and will be kept in sync with PhoneSaver. You can close this page.", provider.title(), account),
+	})
+}
+
+// SyncIntegration syncs the user's contacts with a provider now, as a job
+// whose result counts the changes made on each side
+func (a *App) SyncIntegration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sync, ok := a.loadContactSync(c, "Failed to sync integration")
+	if !ok {
+		return
+	}
+	a.startJobResponse(c, userID.(int), jobTypeContactSync, a.contactSyncJob(sync.UserID, sync.Provider))
+}
+
+// DisconnectIntegration stops syncing the user's contacts with a provider.
+// The contacts stay as they are on both sides.
+func (a *App) DisconnectIntegration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sync, ok := a.loadContactSync(c, "Failed to disconnect integration")
+	if !ok {
+		return
+	}
+	if _, err := a.store.ContactSyncs.Delete(c.Request.Context(), sync.UserID, sync.Provider); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete integration: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to disconnect integration",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditIntegrationDisconnected, map[string]string{
+		"provider": sync.Provider,
+		"account":  sync.Account,
+	}))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    sync,
+	})
+}
+
+// loadContactSync returns the user's connection to the provider a request
+// names, responding with 404 if there is none and with failure if it can't
+// be loaded
+func (a *App) loadContactSync(c *gin.Context, failure string) (models.ContactSync, bool) {
+	userID, _ := c.Get("user_id")
+	name := c.Param("provider")
+	provider, ok := a.contactProviders[name]
+	if !ok {
+		respondIntegrationNotFound(c)
+		return models.ContactSync{}, false
+	}
+	sync, err := a.store.ContactSyncs.Get(c.Request.Context(), userID.(int), name)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   provider.title() + " is not connected",
+		})
+		return sync, false
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get integration: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return sync, false
+	}
+	return sync, true
+}
+
+func respondIntegrationNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Integration not found",
+	})
+}
+
+// integrationCallbackURL returns the URL a provider's consent screen sends
+// users back to, which must be registered with the provider
+func integrationCallbackURL(c *gin.Context, provider string) string {
+	return absoluteURL(c, "/api/integrations/"+provider+"/callback")
+}
+
+// renderIntegration responds with integrationPage showing view
+func (a *App) renderIntegration(c *gin.Context, status int, view integrationView) {
+	var page bytes.Buffer
+	if err := integrationPage.Execute(&page, view); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to render integration page: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+// contactSyncJob returns the job syncing a user's contacts with a provider.
+// The connection is loaded when the job runs, so it has the latest token.
+func (a *App) contactSyncJob(userID int, provider string) jobFunc {
+	return func(ctx context.Context, progress progressFunc) (interface{}, error) {
+		sync, err := a.store.ContactSyncs.Get(ctx, userID, provider)
+		if err == repository.ErrNotFound {
+			return nil, &models.CustomError{Code: http.StatusNotFound, Message: "The integration was disconnected"}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get integration: %v", err)
+		}
+		return a.syncContacts(ctx, sync)
+	}
+}
+
+// RunContactSyncs periodically syncs the connections last synced more than
+// CONTACT_SYNC_INTERVAL ago
+func (a *App) RunContactSyncs() {
+	if len(a.contactProviders) == 0 {
+		return
+	}
+	ticker := time.NewTicker(contactSyncCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		syncs, err := a.store.ContactSyncs.ListDue(ctx, time.Now().Add(-a.cfg.ContactSyncInterval))
+		if err != nil {
+			logging.Errorf("Failed to find contact syncs due: %v", err)
+			continue
+		}
+		for _, sync := range syncs {
+			if _, ok := a.contactProviders[sync.Provider]; !ok {
+				continue
+			}
+			var customErr *models.CustomError
+			if _, err := a.syncContacts(ctx, sync); err != nil && !errors.As(err, &customErr) {
+				logging.Errorf("Failed to sync contacts of user %d with %s: %v", sync.UserID, sync.Provider, err)
+			}
+		}
+	}
+}
+
+// syncContacts syncs a user's contacts with a provider in both directions
+// and records the outcome on the connection. It returns a *CustomError if
+// another sync of the connection is running or the provider no longer
+// accepts its token.
+func (a *App) syncContacts(ctx context.Context, sync models.ContactSync) (models.ContactSyncResult, error) {
+	provider := a.contactProviders[sync.Provider]
+	claimed, err := a.store.ContactSyncs.Claim(ctx, sync.UserID, sync.Provider, time.Now())
+	if err != nil {
+		return models.ContactSyncResult{}, fmt.Errorf("failed to claim contact sync: %v", err)
+	}
+	if !claimed {
+		return models.ContactSyncResult{}, &models.CustomError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("A sync with %s is already running", provider.title()),
+		}
+	}
+
+	httpCtx := context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: contactSyncRequestTimeout})
+	source := provider.oauth("").TokenSource(httpCtx, &oauth2.Token{
+		AccessToken:  sync.Token.AccessToken,
+		RefreshToken: sync.Token.RefreshToken,
+		Expiry:       sync.Token.Expiry,
+	})
+	run := &contactSyncRun{
+		app:      a,
+		ctx:      ctx,
+		sync:     sync,
+		provider: provider,
+		client:   oauth2.NewClient(httpCtx, source),
+	}
+	syncToken, syncErr := run.run()
+
+	// The token may have been refreshed along the way
+	if token, err := source.Token(); err == nil {
+		sync.Token = models.OAuthToken{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken, Expiry: token.Expiry}
+	}
+	now := time.Now().UTC()
+	sync.LastSyncedAt = &now
+	var retrieveErr *oauth2.RetrieveError
+	switch {
+	case syncErr == nil:
+		sync.Status, sync.Error, sync.SyncToken = repository.SyncStatusOK, "", syncToken
+	case errors.As(syncErr, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant":
+		sync.Status = repository.SyncStatusReconnect
+		sync.Error = fmt.Sprintf("%s no longer accepts the connection; connect it again", provider.title())
+		syncErr = &models.CustomError{Code: http.StatusConflict, Message: sync.Error}
+	default:
+		sync.Status, sync.Error = repository.SyncStatusFailed, fmt.Sprintf("Failed to sync with %s", provider.title())
+	}
+	// Recorded even if the sync was cancelled by shutdown
+	if err := a.store.ContactSyncs.Finish(context.WithoutCancel(ctx), sync); err != nil {
+		logging.Errorf("Failed to record contact sync of user %d with %s: %v", sync.UserID, sync.Provider, err)
+	}
+	return run.result, syncErr
+}
+
+// contactSyncRun is one sync of a user's contacts with a provider. Changes
+// pulled from the provider are applied first, then the local changes since
+// the last sync are pushed. A contact changed on both sides keeps the newer
+// change, and one deleted on one side but changed on the other is kept.
+type contactSyncRun struct {
+	app      *App
+	ctx      context.Context
+	sync     models.ContactSync
+	provider contactProvider
+	client   *http.Client
+	result   models.ContactSyncResult
+
+	// contacts are the user's contacts by ID, and phones indexes them by
+	// phone number to match the provider's new contacts to
+	contacts map[int]models.Contact
+	phones   *services.ContactIndex
+	// links are the links by remote ID, and linked the contacts that have
+	// one
+	links  map[string]*models.ContactSyncLink
+	linked map[int]bool
+	// capacity is how many more contacts the user's plan allows, or -1 for
+	// no limit
+	capacity int
+}
+
+// run performs the sync and returns the sync token to pull the next
+// changes from. Contacts beyond the plan's limit are skipped, and the sync
+// token is left as it was so they are pulled again, after an upgrade.
+func (r *contactSyncRun) run() (string, error) {
+	if err := r.load(); err != nil {
+		return "", err
+	}
+	changes, err := r.provider.changes(r.ctx, r.client, r.sync.SyncToken)
+	if err == errSyncTokenExpired {
+		changes, err = r.provider.changes(r.ctx, r.client, "")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to pull changes: %v", err)
+	}
+
+	seen := make(map[string]bool, len(changes.Contacts))
+	limited := false
+	for _, remote := range changes.Contacts {
+		seen[remote.ID] = true
+		full, err := r.pull(remote)
+		if err != nil {
+			return "", err
+		}
+		limited = limited || full
+	}
+	if changes.Full {
+		for remoteID, link := range r.links {
+			if !seen[remoteID] {
+				if err := r.pullDeletion(link); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	if err := r.push(); err != nil {
+		return "", err
+	}
+	if limited {
+		return r.sync.SyncToken, nil
+	}
+	return changes.SyncToken, nil
+}
+
+// load loads the user's contacts, the links and the plan's limit
+func (r *contactSyncRun) load() error {
+	contacts, err := r.app.store.Contacts.ListAll(r.ctx, r.sync.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load contacts: %v", err)
+	}
+	r.contacts = make(map[int]models.Contact, len(contacts))
+	for _, contact := range contacts {
+		r.contacts[contact.ID] = contact
+	}
+	r.phones = services.NewContactIndex(contacts)
+
+	links, err := r.app.store.ContactSyncs.Links(r.ctx, r.sync.UserID, r.sync.Provider)
+	if err != nil {
+		return fmt.Errorf("failed to load links: %v", err)
+	}
+	r.links = make(map[string]*models.ContactSyncLink, len(links))
+	r.linked = make(map[int]bool, len(links))
+	for i := range links {
+		r.links[links[i].RemoteID] = &links[i]
+		if links[i].ContactID != 0 {
+			r.linked[links[i].ContactID] = true
+		}
+	}
+
+	r.capacity = -1
+	if r.app.stripe != nil {
+		subscription, err := r.app.loadSubscription(r.ctx, r.sync.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to load plan: %v", err)
+		}
+		if plan := r.app.plan(subscription.Plan); plan.MaxContacts > 0 {
+			r.capacity = max(plan.MaxContacts-len(contacts), 0)
+		}
+	}
+	return nil
+}
+
+// pull applies a contact the provider reports changed, and reports whether
+// it was skipped because the plan's limit was reached
+func (r *contactSyncRun) pull(remote remoteContact) (bool, error) {
+	link, ok := r.links[remote.ID]
+	if remote.Deleted {
+		if !ok {
+			return false, nil
+		}
+		return false, r.pullDeletion(link)
+	}
+	if !ok {
+		// A contact the user already has is linked rather than imported,
+		// as if both sides had changed
+		if match := r.phones.Match(models.Contact{Phone: remote.Phone}); match != nil && !r.linked[match.ID] {
+			link = &models.ContactSyncLink{UserID: r.sync.UserID, Provider: r.sync.Provider, ContactID: match.ID, RemoteID: remote.ID}
+			r.links[remote.ID] = link
+			r.linked[match.ID] = true
+			return false, r.reconcile(link, *match, remote, false)
+		}
+		return r.pullNew(&models.ContactSyncLink{UserID: r.sync.UserID, Provider: r.sync.Provider, RemoteID: remote.ID}, remote)
+	}
+
+	contact, exists := r.contacts[link.ContactID]
+	if !exists {
+		if remote.ETag == link.ETag {
+			// Deleted locally, which is pushed
+			return false, nil
+		}
+		// Changed at the provider since it was deleted here, so the change
+		// brings it back
+		r.result.Conflicts++
+		return r.pullNew(link, remote)
+	}
+	if remote.ETag == link.ETag {
+		return false, nil
+	}
+	return false, r.reconcile(link, contact, remote, true)
+}
+
+// reconcile applies a provider's change to a linked contact, unless the
+// contact changed locally since the last sync more recently, in which case
+// the local change is pushed instead. counted is set when a change on both
+// sides is a conflict to count, rather than a new link.
+func (r *contactSyncRun) reconcile(link *models.ContactSyncLink, contact models.Contact, remote remoteContact, counted bool) error {
+	if sameSyncedFields(contact, remote) {
+		link.ETag, link.ContactVersion = remote.ETag, contact.Version
+		return r.saveLink(link)
+	}
+	if contact.Version != link.ContactVersion {
+		if counted {
+			r.result.Conflicts++
+		}
+		if !remote.UpdatedAt.After(contact.UpdatedAt) {
+			// The local change wins, and is pushed over the provider's
+			link.ETag = remote.ETag
+			return r.saveLink(link)
+		}
+	}
+	if !validRemoteContact(remote) {
+		r.result.Skipped++
+		link.ETag = remote.ETag
+		return r.saveLink(link)
+	}
+
+	patch := repository.ContactPatch{Name: &remote.Name, Phone: &remote.Phone}
+	if !remote.Birthday.IsZero() {
+		patch.Birthday = &remote.Birthday
+	}
+	updated, err := r.app.store.Contacts.Update(r.ctx, r.sync.UserID, contact.ID, contact.Version, patch)
+	if err == repository.ErrVersionConflict || err == repository.ErrNotFound {
+		// Changed or deleted while syncing, which the next sync picks up
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update contact: %v", err)
+	}
+	r.contacts[updated.ID] = updated
+	r.result.Updated++
+	r.app.publish(r.sync.UserID, models.ContactEvent{Type: eventContactUpdated, ContactID: updated.ID, Contact: contactResponse(updated)})
+
+	link.ETag, link.ContactVersion = remote.ETag, updated.Version
+	return r.saveLink(link)
+}
+
+// pullNew imports a provider's contact as a new contact, and reports
+// whether it was skipped because the plan's limit was reached. The link of
+// a contact that is skipped is dropped, leaving it at the provider.
+func (r *contactSyncRun) pullNew(link *models.ContactSyncLink, remote remoteContact) (bool, error) {
+	if valid := validRemoteContact(remote); !valid || r.capacity == 0 {
+		r.result.Skipped++
+		if link.ID != 0 {
+			delete(r.links, link.RemoteID)
+			if err := r.app.store.ContactSyncs.DeleteLink(r.ctx, link.ID); err != nil {
+				return false, fmt.Errorf("failed to delete link: %v", err)
+			}
+		}
+		return valid, nil
+	}
+
+	contact := models.Contact{Name: remote.Name, Phone: remote.Phone, Birthday: remote.Birthday}
+	if err := r.app.contactService.Create(r.ctx, r.sync.UserID, &contact); err != nil {
+		return false, fmt.Errorf("failed to create contact: %v", err)
+	}
+	if r.capacity > 0 {
+		r.capacity--
+	}
+	r.contacts[contact.ID] = contact
+	r.linked[contact.ID] = true
+	r.result.Imported++
+	r.app.publish(r.sync.UserID, models.ContactEvent{Type: eventContactCreated, ContactID: contact.ID, Contact: contactResponse(contact)})
+
+	link.ContactID, link.ETag, link.ContactVersion = contact.ID, remote.ETag, contact.Version
+	r.links[remote.ID] = link
+	return false, r.saveLink(link)
+}
+
+// pullDeletion applies the deletion of a provider's contact. A contact
+// changed locally since the last sync is kept and unlinked, so it is pushed
+// again as a new contact.
+func (r *contactSyncRun) pullDeletion(link *models.ContactSyncLink) error {
+	delete(r.links, link.RemoteID)
+	if err := r.app.store.ContactSyncs.DeleteLink(r.ctx, link.ID); err != nil {
+		return fmt.Errorf("failed to delete link: %v", err)
+	}
+	contact, exists := r.contacts[link.ContactID]
+	if !exists {
+		return nil
+	}
+	delete(r.linked, contact.ID)
+	if contact.Version != link.ContactVersion {
+		r.result.Conflicts++
+		return nil
+	}
+
+	deleted, err := r.app.contactService.Delete(r.ctx, r.sync.UserID, contact.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %v", err)
+	}
+	delete(r.contacts, contact.ID)
+	if deleted {
+		r.result.Deleted++
+		r.app.publish(r.sync.UserID, models.ContactEvent{Type: eventContactDeleted, ContactID: contact.ID})
+	}
+	return nil
+}
+
+// push pushes the local changes since the last sync: deleted contacts are
+// deleted at the provider, changed ones updated and new ones created
+func (r *contactSyncRun) push() error {
+	for remoteID, link := range r.links {
+		contact, exists := r.contacts[link.ContactID]
+		switch {
+		case !exists:
+			if err := r.provider.delete(r.ctx, r.client, remoteID); err != nil {
+				return fmt.Errorf("failed to delete remote contact: %v", err)
+			}
+			if err := r.app.store.ContactSyncs.DeleteLink(r.ctx, link.ID); err != nil {
+				return fmt.Errorf("failed to delete link: %v", err)
+			}
+			r.result.RemoteDeleted++
+		case contact.Version != link.ContactVersion:
+			etag, err := r.provider.update(r.ctx, r.client, remoteID, link.ETag, contact)
+			if err == errRemoteChanged {
+				// Pulled by the next sync
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to update remote contact: %v", err)
+			}
+			if etag != link.ETag {
+				r.result.RemoteUpdated++
+			}
+			link.ETag, link.ContactVersion = etag, contact.Version
+			if err := r.saveLink(link); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(r.contacts))
+	for id := range r.contacts {
+		if !r.linked[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		contact := r.contacts[id]
+		remote, err := r.provider.create(r.ctx, r.client, contact)
+		if err != nil {
+			return fmt.Errorf("failed to create remote contact: %v", err)
+		}
+		link := &models.ContactSyncLink{
+			UserID:         r.sync.UserID,
+			Provider:       r.sync.Provider,
+			ContactID:      contact.ID,
+			RemoteID:       remote.ID,
+			ETag:           remote.ETag,
+			ContactVersion: contact.Version,
+		}
+		if err := r.saveLink(link); err != nil {
+			return err
+		}
+		r.result.Exported++
+	}
+	return nil
+}
+
+// saveLink stores a link
+func (r *contactSyncRun) saveLink(link *models.ContactSyncLink) error {
+	if err := r.app.store.ContactSyncs.SaveLink(r.ctx, link); err != nil {
+		return fmt.Errorf("failed to save link: %v", err)
+	}
+	return nil
+}
+
+// sameSyncedFields reports whether a contact already has the synced fields
+// of a provider's copy. A copy without a birthday leaves the contact's.
+func sameSyncedFields(contact models.Contact, remote remoteContact) bool {
+	return contact.Name == remote.Name &&
+		repository.NormalizePhone(contact.Phone) == repository.NormalizePhone(remote.Phone) &&
+		(remote.Birthday.IsZero() || contact.Birthday.Equal(remote.Birthday))
+}
+
+// contactPushed reports whether a provider's copy already has the synced
+// fields of a contact. A contact without a birthday leaves the copy's.
+func contactPushed(contact models.Contact, remote remoteContact) bool {
+	return contact.Name == remote.Name &&
+		repository.NormalizePhone(contact.Phone) == repository.NormalizePhone(remote.Phone) &&
+		(contact.Birthday.IsZero() || contact.Birthday.Equal(remote.Birthday))
+}
+
+// validRemoteContact reports whether a provider's contact can be stored as
+// a contact, as the contact routes would accept it. Contacts without a name
+// or phone number are left at the provider.
+func validRemoteContact(remote remoteContact) bool {
+	return len(validateValue(contactRequest{Name: remote.Name, Phone: remote.Phone, Birthday: remote.Birthday})) == 0
+}
@@ -0,0 +1,688 @@
+// Package handlers implements the API's HTTP handlers and the background
+// workers behind them
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	defaultContactLimit   = 100
+	maxContactLimit       = 500
+	defaultDuplicateLimit = 50
+	maxDuplicateLimit     = 200
+)
+
+// contactRequest is the body of a request to create or replace a contact.
+// Phone numbers are encrypted by the server, so encrypted_phone is optional;
+// it is kept as given for clients that still encrypt numbers themselves.
+type contactRequest struct {
+	Name            string    `json:"name" binding:"required,max=255"`
+	Phone           string    `json:"phone" binding:"required,max=255,phone"`
+	EncryptedPhone  string    `json:"encrypted_phone" binding:"max=255"`
+	Tags            []string  `json:"tags" binding:"tagsize,dive,required,max=50,excludes=0x2C"`
+	LastInteraction time.Time `json:"last_interaction"`
+	Birthday        time.Time `json:"birthday" binding:"birthday"`
+	Version         int       `json:"version" binding:"min=0"`
+}
+
+// contact returns the contact the request describes
+func (r contactRequest) contact() models.Contact {
+	return models.Contact{
+		Name:            r.Name,
+		Phone:           r.Phone,
+		EncryptedPhone:  r.EncryptedPhone,
+		Tags:            r.Tags,
+		LastInteraction: r.LastInteraction,
+		Birthday:        r.Birthday,
+		Version:         r.Version,
+	}
+}
+
+// contactResponse returns the API representation of a contact, for the
+// responses and events that point to one
+func contactResponse(contact models.Contact) *models.ContactResponse {
+	response := models.NewContactResponse(contact)
+	return &response
+}
+
+func (a *App) addContact(c *gin.Context) {
+	var req contactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	contact := req.contact()
+
+	userID, _ := c.Get("user_id")
+	if err := a.contactService.Create(c.Request.Context(), userID.(int), &contact); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to add contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to add contact",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"message": "Contact added successfully",
+			"id":      contact.ID,
+		},
+	})
+}
+
+func (a *App) GetContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	fields, ok := parseFields(c, contactFields)
+	if !ok {
+		return
+	}
+
+	access, ok := a.loadContactAccess(c, "Failed to fetch contacts")
+	if !ok {
+		return
+	}
+
+	query := repository.ContactQuery{
+		Search: c.Query("query"),
+		Tag:    c.Query("tag"),
+		Filter: c.Query("filter"),
+		SortBy: c.Query("sort_by"),
+		Desc:   c.Query("order") == "desc",
+	}
+	if query.Limit, query.After, ok = parseContactPage(c, query.SortBy); !ok {
+		return
+	}
+
+	contacts, err := a.contactService.List(c.Request.Context(), userID.(int), query)
+	var total int
+	if err == nil {
+		total, err = a.countContacts(c.Request.Context(), userID.(int), query, access)
+	}
+	var filterErr *repository.FilterError
+	if errors.As(err, &filterErr) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "filter",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch contacts",
+		})
+		return
+	}
+	// The cursor is the last contact of the page, even if it can't be read
+	next := ""
+	if len(contacts) == query.Limit {
+		next = contactCursor(contacts[len(contacts)-1], query.SortBy)
+	}
+	contacts = access.readable(contacts)
+
+	links := c.Query("links") == "true"
+	if notModified(c, contactListETag(contacts, total, fields, links), time.Time{}) {
+		return
+	}
+
+	data, err := selectContactFields(contacts, fields, links)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to select contact fields: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to process contacts",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    data,
+	})
+}
+
+// parseContactPage reads the ?limit= and ?cursor= of a list of contacts
+// sorted by sortBy, responding with 400 if either is invalid
+func parseContactPage(c *gin.Context, sortBy string) (int, *repository.ContactCursor, bool) {
+	var cursor repository.ContactCursor
+	var value json.RawMessage
+	keys := []interface{}{&cursor.ID}
+	if sortBy == "name" || sortBy == "last_interaction" || sortBy == "birthday" {
+		keys = []interface{}{&value, &cursor.ID}
+	}
+	page, ok := parseListPage(c, defaultContactLimit, maxContactLimit, keys...)
+	if !ok || page.After == nil {
+		return page.Limit, nil, ok
+	}
+
+	var err error
+	switch {
+	case len(keys) == 1 || string(value) == "null":
+	case sortBy == "name":
+		var name string
+		err = json.Unmarshal(value, &name)
+		cursor.Value = name
+	default:
+		var t time.Time
+		err = json.Unmarshal(value, &t)
+		cursor.Value = t
+	}
+	if err != nil || cursor.ID < 1 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "cursor",
+				Message: "Invalid cursor",
+			},
+		})
+		return 0, nil, false
+	}
+	return page.Limit, &cursor, true
+}
+
+// contactCursor returns the cursor of the page of contacts sorted by sortBy
+// after the one ending with last
+func contactCursor(last models.Contact, sortBy string) string {
+	var value interface{}
+	switch sortBy {
+	case "name":
+		value = last.Name
+	case "last_interaction", "birthday":
+		t := last.LastInteraction
+		if sortBy == "birthday" {
+			t = last.Birthday
+		}
+		if !t.IsZero() {
+			value = t
+		}
+	default:
+		return listCursor(last.ID)
+	}
+	return listCursor(value, last.ID)
+}
+
+// countContacts returns the number of the user's contacts matching query
+// they may read. Permissions can't be checked in SQL, so the contacts of
+// members with restricted access are listed to be counted.
+func (a *App) countContacts(ctx context.Context, userID int, query repository.ContactQuery, access contactAccess) (int, error) {
+	if !access.restricted {
+		return a.store.Contacts.CountMatching(ctx, userID, query)
+	}
+	query.Limit, query.After = 0, nil
+	contacts, err := a.contactService.List(ctx, userID, query)
+	return len(access.readable(contacts)), err
+}
+
+func (a *App) UpdateContactTags(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+
+	var update models.ContactUpdate
+	if !bindJSON(c, &update) {
+		return
+	}
+
+	expected, ok := expectedVersion(c, update.Version)
+	if !ok {
+		return
+	}
+
+	if !a.allowContact(c, userID.(int), contactID, repository.AccessWrite, "Failed to update tags") {
+		return
+	}
+
+	// Update tags
+	patch := repository.ContactPatch{Tags: &update.Tags}
+	if !a.updateContactVersioned(c, userID.(int), contactID, expected, "Failed to update tags", patch) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Tags updated successfully",
+	})
+}
+
+// UpdateLastInteraction records an interaction of type "other" at the given
+// time. It is kept for older clients; new clients should record interactions
+// with POST /contacts/:id/interactions.
+func (a *App) UpdateLastInteraction(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	var update models.ContactUpdate
+	if !bindJSON(c, &update) {
+		return
+	}
+	if update.LastInteraction.IsZero() {
+		respondValidation(c, models.ValidationError{Field: "last_interaction", Message: "Last interaction is required"})
+		return
+	}
+
+	// Record the interaction, which updates last interaction
+	_, err = a.recordInteraction(c.Request.Context(), userID.(int), contactID, models.Interaction{
+		Type:      interactionOther,
+		Timestamp: update.LastInteraction.UTC(),
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update last interaction: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update last interaction",
+		})
+		return
+	}
+
+	a.publishContactUpdated(c.Request.Context(), userID.(int), contactID, c.GetString("device_id"))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Last interaction updated successfully",
+	})
+}
+
+func (a *App) UpdateBirthday(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+
+	var update models.ContactUpdate
+	if !bindJSON(c, &update) {
+		return
+	}
+
+	expected, ok := expectedVersion(c, update.Version)
+	if !ok {
+		return
+	}
+
+	if !a.allowContact(c, userID.(int), contactID, repository.AccessWrite, "Failed to update birthday") {
+		return
+	}
+
+	// The birthday has been validated as a date, or is empty to clear it
+	var birthday time.Time
+	if update.Birthday != "" {
+		birthday, _ = time.Parse(birthdayLayout, update.Birthday)
+	}
+
+	// Update birthday
+	patch := repository.ContactPatch{Birthday: &birthday}
+	if !a.updateContactVersioned(c, userID.(int), contactID, expected, "Failed to update birthday", patch) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Birthday updated successfully",
+	})
+}
+
+// GetContact retrieves a single contact
+func (a *App) GetContact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+
+	fields, ok := parseFields(c, contactFields)
+	if !ok {
+		return
+	}
+
+	access, ok := a.loadContactAccess(c, "Failed to get contact")
+	if !ok {
+		return
+	}
+
+	contact, err := a.contactService.Get(c.Request.Context(), userID.(int), contactID)
+
+	if err == repository.ErrNotFound || (err == nil && !access.allows(contact, repository.AccessRead)) {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get contact",
+		})
+		return
+	}
+
+	if notModified(c, contactETag(contact.Version), contact.UpdatedAt) {
+		return
+	}
+
+	response := models.NewContactResponse(contact)
+	if c.Query("links") == "true" {
+		response.Links = phoneLinks(contact.Phone)
+	}
+	data, err := selectFields(response, fields)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to select contact fields: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get contact",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// CreateContact creates a new contact. With ?unique=true it is rejected with
+// 409 and the existing contacts if one with the same phone number exists, and
+// with 402 if the user's plan doesn't allow another. With ?check_spam=true
+// it is rejected with 409 and the number's reputation if the requesting
+// user blocked the number or the spam reputation provider reports it.
+// Organization members who only work with the contacts shared with them are
+// given write access to those they create.
+func (a *App) CreateContact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req contactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	contact := req.contact()
+	access, ok := a.loadContactAccess(c, "Failed to create contact")
+	if !ok {
+		return
+	}
+
+	if c.Query("unique") == "true" {
+		existing, err := a.contactService.FindByPhone(c.Request.Context(), userID.(int), contact.Phone)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to check for duplicate contacts: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to create contact",
+			})
+			return
+		}
+		existing = access.readable(existing)
+		if len(existing) > 0 {
+			c.JSON(http.StatusConflict, models.Response{
+				Success: false,
+				Data:    models.NewContactResponses(existing),
+				Error:   "A contact with this phone number already exists",
+			})
+			return
+		}
+	}
+
+	if c.Query("check_spam") == "true" {
+		// The blocked numbers are the member's own in an organization
+		requesterID := userID.(int)
+		if memberID := c.GetInt("member_id"); memberID != 0 {
+			requesterID = memberID
+		}
+		reputation, err := a.phoneReputation(c, requesterID, contact.Phone, true)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to check phone number reputation: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to create contact",
+			})
+			return
+		}
+		if reputation.Blocked || (reputation.Spam != nil && *reputation.Spam) {
+			message := "This phone number is blocked"
+			if !reputation.Blocked {
+				message = "This phone number is reported as spam"
+			}
+			c.JSON(http.StatusConflict, models.Response{
+				Success: false,
+				Data:    reputation,
+				Error:   message,
+			})
+			return
+		}
+	}
+
+	if !a.allowContacts(c, userID.(int), 1, false, "Failed to create contact") {
+		return
+	}
+	if err := a.contactService.Create(c.Request.Context(), userID.(int), &contact); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create contact",
+		})
+		return
+	}
+	a.shareCreatedContact(c, access, contact)
+
+	a.publish(contact.UserID, models.ContactEvent{Type: eventContactCreated, ContactID: contact.ID, Contact: contactResponse(contact), DeviceID: c.GetString("device_id")})
+
+	c.Header("ETag", contactETag(contact.Version))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    models.NewContactResponse(contact),
+	})
+}
+
+// GetDuplicateContacts lists the groups of contacts that share a phone
+// number, so clients can offer to merge them
+func (a *App) GetDuplicateContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	access, ok := a.loadContactAccess(c, "Failed to find duplicate contacts")
+	if !ok {
+		return
+	}
+	var after int
+	page, ok := parseListPage(c, defaultDuplicateLimit, maxDuplicateLimit, &after)
+	if !ok {
+		return
+	}
+
+	groups, err := a.contactService.Duplicates(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to find duplicate contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to find duplicate contacts",
+		})
+		return
+	}
+
+	duplicates := []models.DuplicateContacts{}
+	for _, group := range groups {
+		if group = access.readable(group); len(group) < 2 {
+			continue
+		}
+		duplicates = append(duplicates, models.DuplicateContacts{
+			Phone:    repository.NormalizePhone(group[0].Phone),
+			Contacts: models.NewContactResponses(group),
+		})
+	}
+	// Groups are paged by their first contact, which the contacts the user
+	// can't read may have changed
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Contacts[0].ID < duplicates[j].Contacts[0].ID
+	})
+	total := len(duplicates)
+	start := sort.Search(total, func(i int) bool { return duplicates[i].Contacts[0].ID > after })
+	duplicates = duplicates[start:]
+	next := ""
+	if len(duplicates) > page.Limit {
+		duplicates = duplicates[:page.Limit]
+		next = listCursor(duplicates[page.Limit-1].Contacts[0].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    duplicates,
+	})
+}
+
+// UpdateContact updates an existing contact
+func (a *App) UpdateContact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+	var req contactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	contact := req.contact()
+
+	// Reject writes based on a stale copy of the contact
+	expected, ok := expectedVersion(c, contact.Version)
+	if !ok {
+		return
+	}
+
+	if !a.allowContact(c, userID.(int), contactID, repository.AccessWrite, "Failed to update contact") {
+		return
+	}
+
+	// last_interaction is derived from recorded interactions
+	if !a.updateContactVersioned(c, userID.(int), contactID, expected, "Failed to update contact", repository.EditableFields(contact)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Contact updated successfully",
+	})
+}
+
+// DeleteContact deletes a contact
+func (a *App) DeleteContact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+
+	if !a.allowContact(c, userID.(int), contactID, repository.AccessWrite, "Failed to delete contact") {
+		return
+	}
+
+	deleted, err := a.contactService.Delete(c.Request.Context(), userID.(int), contactID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete contact",
+		})
+		return
+	}
+
+	if !deleted {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	a.publish(userID.(int), models.ContactEvent{Type: eventContactDeleted, ContactID: contactID, DeviceID: c.GetString("device_id")})
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Contact deleted successfully",
+	})
+}
+
+// BulkCreateContacts creates multiple contacts at once, if the user's plan
+// allows them all
+func (a *App) BulkCreateContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var reqs []contactRequest
+	if !bindJSON(c, &reqs) {
+		return
+	}
+	contacts := make([]models.Contact, len(reqs))
+	for i, req := range reqs {
+		contacts[i] = req.contact()
+	}
+
+	if !a.allowContacts(c, userID.(int), len(contacts), false, "Failed to create contacts") {
+		return
+	}
+
+	if err := a.contactService.CreateAll(c.Request.Context(), userID.(int), contacts); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create contacts",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditImport, map[string]string{
+		"format":   "bulk",
+		"contacts": strconv.Itoa(len(contacts)),
+	}))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Contacts created successfully",
+	})
+}
+
+// contactIDParam returns the contact ID in the path, responding with 404 if it
+// is not a number
+func contactIDParam(c *gin.Context) (int, bool) {
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return 0, false
+	}
+	return contactID, true
+}
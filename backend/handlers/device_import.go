@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+// The mimetypes of the ContactsContract.Data rows imported from Android
+const (
+	androidNameMimetype  = "vnd.android.cursor.item/name"
+	androidPhoneMimetype = "vnd.android.cursor.item/phone_v2"
+	androidEventMimetype = "vnd.android.cursor.item/contact_event"
+	androidGroupMimetype = "vnd.android.cursor.item/group_membership"
+)
+
+// The values of the type column, data2, of mobile numbers and birthdays
+const (
+	androidPhoneTypeMobile   = "2"
+	androidEventTypeBirthday = "3"
+)
+
+// maxTagLen bounds each of a contact's tags, as the contact routes do
+const maxTagLen = 50
+
+// devicePerson is a person imported from an Android phone: the raw contacts
+// Android aggregated, and the people sharing a number with them
+type devicePerson struct {
+	name     string
+	phones   []devicePhone
+	birthday time.Time
+	tags     []string
+}
+
+// devicePhone is one of a person's numbers. Its keys are the normalized
+// forms of the number as entered and as Android normalized it, and its rank
+// orders the numbers by how suited they are to be the contact's.
+type devicePhone struct {
+	number string
+	keys   []string
+	rank   int
+}
+
+// ImportDeviceContacts imports the address book of an Android phone, sent as
+// the raw contacts and data rows ContactsContract keeps. Each person Android
+// aggregated becomes one contact, people sharing a number are merged, and
+// people with a number of an existing contact are left out.
+func (a *App) ImportDeviceContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req models.DeviceImport
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	local, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to import contacts",
+		})
+		return
+	}
+	idx := services.NewContactIndex(local)
+
+	people, merged := devicePeople(req)
+	result := models.DeviceImportResult{Merged: merged}
+	var contacts []models.Contact
+	for _, person := range people {
+		contact, ok := person.contact()
+		switch {
+		case !ok:
+			result.Skipped++
+		case person.matches(idx):
+			result.Duplicates++
+		default:
+			contacts = append(contacts, contact)
+		}
+	}
+
+	if !a.allowContacts(c, userID.(int), len(contacts), false, "Failed to import contacts") {
+		return
+	}
+	if err := a.contactService.CreateAll(c.Request.Context(), userID.(int), contacts); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to import contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to import contacts",
+		})
+		return
+	}
+	result.Created = len(contacts)
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditImport, map[string]string{
+		"format":   "device",
+		"contacts": strconv.Itoa(len(contacts)),
+	}))
+	if len(contacts) > 0 {
+		// Too many contacts may have been created to send individually
+		a.publish(userID.(int), models.ContactEvent{Type: eventContactsRestored})
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// devicePeople groups the raw contacts of a device import into people, and
+// reports how many people were merged into another for sharing a number.
+// Deleted raw contacts and groups are ignored, as are the system groups
+// every contact of an account belongs to.
+func devicePeople(req models.DeviceImport) ([]*devicePerson, int) {
+	groups := make(map[string]string, len(req.Groups))
+	for _, group := range req.Groups {
+		if group.Deleted != 0 || group.SystemID != "" {
+			continue
+		}
+		if tag := deviceTag(group.Title); tag != "" {
+			groups[strconv.FormatInt(group.ID, 10)] = tag
+		}
+	}
+
+	var aggregates []*devicePerson
+	byContact := make(map[int64]*devicePerson)
+	for _, raw := range req.RawContacts {
+		if raw.Deleted != 0 {
+			continue
+		}
+		person := byContact[raw.ContactID]
+		if person == nil {
+			person = &devicePerson{}
+			aggregates = append(aggregates, person)
+			// Raw contacts not yet aggregated have no contact ID
+			if raw.ContactID != 0 {
+				byContact[raw.ContactID] = person
+			}
+		}
+		for _, row := range raw.Data {
+			person.add(row, groups)
+		}
+	}
+
+	var people []*devicePerson
+	merged := 0
+	byPhone := make(map[string]*devicePerson)
+	for _, person := range aggregates {
+		into := person.match(byPhone)
+		if into == nil {
+			into = person
+			people = append(people, person)
+		} else {
+			into.merge(person)
+			merged++
+		}
+		for _, phone := range person.phones {
+			for _, key := range phone.keys {
+				byPhone[key] = into
+			}
+		}
+	}
+	return people, merged
+}
+
+// add adds the details of a data row to the person. The first name and
+// birthday found are kept.
+func (p *devicePerson) add(row models.DataRow, groups map[string]string) {
+	switch row.Mimetype {
+	case androidNameMimetype:
+		// data1 is the display name, and data2 and data3 the given and
+		// family names
+		name := strings.TrimSpace(row.Data1)
+		if name == "" {
+			name = strings.TrimSpace(strings.TrimSpace(row.Data2) + " " + strings.TrimSpace(row.Data3))
+		}
+		if p.name == "" {
+			p.name = name
+		}
+	case androidPhoneMimetype:
+		// data1 is the number as entered, and data4 in E.164 form
+		phone := devicePhone{number: strings.TrimSpace(row.Data1)}
+		if phone.number == "" {
+			phone.number = strings.TrimSpace(row.Data4)
+		}
+		for _, number := range []string{row.Data1, row.Data4} {
+			if key := repository.NormalizePhone(number); key != "" && !slices.Contains(phone.keys, key) {
+				phone.keys = append(phone.keys, key)
+			}
+		}
+		switch {
+		case row.IsSuperPrimary != 0:
+			phone.rank = 3
+		case row.IsPrimary != 0:
+			phone.rank = 2
+		case row.Data2 == androidPhoneTypeMobile:
+			phone.rank = 1
+		}
+		if len(phone.keys) > 0 {
+			p.addPhone(phone)
+		}
+	case androidEventMimetype:
+		// Birthdays without a year, given as --MM-DD, and mistyped ones in
+		// the future are left out
+		if row.Data2 == androidEventTypeBirthday && p.birthday.IsZero() {
+			if birthday := parseImportDate(strings.TrimSpace(row.Data1)); !birthday.After(time.Now()) {
+				p.birthday = birthday
+			}
+		}
+	case androidGroupMimetype:
+		// data1 is the row ID of the group
+		if tag, ok := groups[row.Data1]; ok {
+			p.addTag(tag)
+		}
+	}
+}
+
+// addPhone adds a number the person doesn't have yet
+func (p *devicePerson) addPhone(phone devicePhone) {
+	for _, existing := range p.phones {
+		for _, key := range phone.keys {
+			if slices.Contains(existing.keys, key) {
+				return
+			}
+		}
+	}
+	p.phones = append(p.phones, phone)
+}
+
+// addTag adds a tag the person doesn't have yet, if their tags still fit in
+// a contact's
+func (p *devicePerson) addTag(tag string) {
+	if slices.Contains(p.tags, tag) || len(strings.Join(append(p.tags, tag), ",")) > maxTagsLen {
+		return
+	}
+	p.tags = append(p.tags, tag)
+}
+
+// merge adds the numbers and tags of another person sharing a number with
+// p, and their name and birthday if p has none
+func (p *devicePerson) merge(other *devicePerson) {
+	if p.name == "" {
+		p.name = other.name
+	}
+	if p.birthday.IsZero() {
+		p.birthday = other.birthday
+	}
+	for _, phone := range other.phones {
+		p.addPhone(phone)
+	}
+	for _, tag := range other.tags {
+		p.addTag(tag)
+	}
+}
+
+// match returns the person already imported that shares a number with p, or
+// nil
+func (p *devicePerson) match(byPhone map[string]*devicePerson) *devicePerson {
+	for _, phone := range p.phones {
+		for _, key := range phone.keys {
+			if person, ok := byPhone[key]; ok {
+				return person
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether an indexed contact has one of the person's numbers
+func (p *devicePerson) matches(idx *services.ContactIndex) bool {
+	for _, phone := range p.phones {
+		for _, key := range phone.keys {
+			if idx.Match(models.Contact{Phone: key}) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contact returns the contact for the person, with their super primary,
+// primary, first mobile or first number, and reports whether the contact
+// routes would accept it. People without a name are named by their number.
+func (p *devicePerson) contact() (models.Contact, bool) {
+	if len(p.phones) == 0 {
+		return models.Contact{}, false
+	}
+	phone := p.phones[0]
+	for _, other := range p.phones[1:] {
+		if other.rank > phone.rank {
+			phone = other
+		}
+	}
+	contact := models.Contact{
+		Name:     p.name,
+		Phone:    phone.number,
+		Tags:     append([]string{}, p.tags...),
+		Birthday: p.birthday,
+	}
+	if contact.Name == "" {
+		contact.Name = contact.Phone
+	}
+	valid := len(validateValue(contactRequest{
+		Name:     contact.Name,
+		Phone:    contact.Phone,
+		Tags:     contact.Tags,
+		Birthday: contact.Birthday,
+	})) == 0
+	return contact, valid
+}
+
+// deviceTag returns the tag for an Android group's title: without commas,
+// which separate tags, and cut to the longest tag allowed
+func deviceTag(title string) string {
+	tag := strings.Join(strings.Fields(strings.ReplaceAll(title, ",", " ")), " ")
+	if runes := []rune(tag); len(runes) > maxTagLen {
+		tag = string(runes[:maxTagLen])
+	}
+	return strings.TrimSpace(tag)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	// maxDeviceIDLen bounds client-supplied device identifiers
+	maxDeviceIDLen     = 64
+	defaultDeviceLimit = 50
+	maxDeviceLimit     = 200
+)
+
+// recordDeviceSync stores the sync token last returned to a device
+func (a *App) recordDeviceSync(ctx context.Context, userID interface{}, deviceID, token string, syncedAt time.Time) error {
+	_, err := a.store.DB.ExecContext(ctx,
+		"UPDATE devices SET last_sync_token = ?, last_sync_at = ?, last_seen_at = ? WHERE user_id = ? AND device_id = ?",
+		token, syncedAt, time.Now().UTC(), userID, deviceID,
+	)
+	return err
+}
+
+// lastContactChange returns the time of the most recent change to a user's
+// contacts, including deletions
+func (a *App) lastContactChange(ctx context.Context, userID interface{}) (time.Time, error) {
+	// Selecting the latest row rather than MAX keeps the column's type, which
+	// SQLite needs to return a time
+	var updated, deleted time.Time
+	err := a.store.DB.QueryRowContext(ctx, "SELECT updated_at FROM contacts WHERE user_id = ? ORDER BY updated_at DESC LIMIT 1", userID).Scan(&updated)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	err = a.store.DB.QueryRowContext(ctx, "SELECT deleted_at FROM contact_tombstones WHERE user_id = ? ORDER BY deleted_at DESC LIMIT 1", userID).Scan(&deleted)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	if deleted.After(updated) {
+		return deleted, nil
+	}
+	return updated, nil
+}
+
+// ListDevices returns the user's devices and whether each has synced the
+// latest changes
+func (a *App) ListDevices(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	currentDevice := c.GetString("device_id")
+
+	lastChange, err := a.lastContactChange(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get last contact change: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch devices",
+		})
+		return
+	}
+
+	var lastSeenAt time.Time
+	var deviceID string
+	page, ok := parseListPage(c, defaultDeviceLimit, maxDeviceLimit, &lastSeenAt, &deviceID)
+	if !ok {
+		return
+	}
+	var total int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM devices WHERE user_id = ?", userID).Scan(&total); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count devices: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch devices",
+		})
+		return
+	}
+	condition, args := page.Condition(true, "last_seen_at", "device_id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		"SELECT device_id, name, last_sync_token, last_sync_at, last_seen_at, created_at FROM devices WHERE user_id = ? AND "+condition+
+			" ORDER BY last_seen_at DESC, device_id DESC"+limit,
+		append(append([]interface{}{userID}, args...), limitArgs...)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch devices: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch devices",
+		})
+		return
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		var device models.Device
+		var token sql.NullString
+		var lastSyncAt sql.NullTime
+		if err := rows.Scan(&device.ID, &device.Name, &token, &lastSyncAt, &device.LastSeenAt, &device.CreatedAt); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan device: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch devices",
+			})
+			return
+		}
+		device.LastSyncToken = token.String
+		if lastSyncAt.Valid {
+			device.LastSyncAt = &lastSyncAt.Time
+			// Changes in the same second as the sync may not have been included
+			device.UpToDate = lastChange.Before(lastSyncAt.Time)
+		}
+		device.Current = device.ID == currentDevice
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating devices: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch devices",
+		})
+		return
+	}
+
+	next := ""
+	if len(devices) == page.Limit {
+		last := devices[len(devices)-1]
+		next = listCursor(last.LastSeenAt, last.ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    devices,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// DiffBackup compares a backup with the user's current contacts
+func (a *App) DiffBackup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	backupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Backup not found",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var exists bool
+	err = a.store.DB.QueryRowContext(c.Request.Context(), "SELECT EXISTS(SELECT 1 FROM backups WHERE id = ? AND user_id = ?)", backupID, userID).Scan(&exists)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get backup: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to diff backup",
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Backup not found",
+		})
+		return
+	}
+
+	// Later runs overwrite the stored contacts, so only the latest completed
+	// backup can be compared
+	latestID, err := a.latestCompletedBackupID(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		middleware.RequestLogger(c).Errorf("Failed to get latest backup: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to diff backup",
+		})
+		return
+	}
+	if latestID != backupID {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Only the latest completed backup can be compared",
+		})
+		return
+	}
+
+	key, ok := a.resolveBackupKey(c, userID.(int), false)
+	if !ok {
+		return
+	}
+
+	backup, err := a.backupService.LoadContacts(ctx, userID.(int), key)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch contacts from backup store: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to diff backup",
+		})
+		return
+	}
+
+	current, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load local contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to diff backup",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"backup_id": backupID,
+			"diff":      services.DiffContacts(backup, current),
+		},
+	})
+}
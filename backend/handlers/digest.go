@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"text/template"
+	"time"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+)
+
+const (
+	// digestStaleLimit is the number of neglected contacts listed in a digest
+	digestStaleLimit = 5
+	// digestChangesLimit is the number of added or updated contacts named in
+	// a digest; the rest are only counted
+	digestChangesLimit = 10
+)
+
+var digestEmailTemplate = template.Must(template.New("digest").Parse(`Hi,
+
+Here is your {{.Period}} PhoneSaver digest.
+{{if .Birthdays}}
+Upcoming birthdays:
+{{range .Birthdays}}  - {{.Name}}, {{if eq .Days 0}}today{{else}}{{.Date.Format "Monday, January 2"}}{{end}}
+{{end}}{{end}}{{if .Stale}}
+Time to reconnect:
+{{range .Stale}}  - {{.Name}}{{if .DaysSince}} ({{.DaysSince}} days since you were last in touch){{end}}
+{{end}}{{end}}{{if .Changes.Total}}
+Recent changes:
+{{if .Changes.Added}}  - {{len .Changes.Added}}{{if gt .Changes.AddedCount (len .Changes.Added)}} of {{.Changes.AddedCount}}{{end}} added: {{range $i, $name := .Changes.Added}}{{if $i}}, {{end}}{{$name}}{{end}}
+{{end}}{{if .Changes.Updated}}  - {{len .Changes.Updated}}{{if gt .Changes.UpdatedCount (len .Changes.Updated)}} of {{.Changes.UpdatedCount}}{{end}} updated: {{range $i, $name := .Changes.Updated}}{{if $i}}, {{end}}{{$name}}{{end}}
+{{end}}{{if .Changes.Deleted}}  - {{.Changes.Deleted}} deleted
+{{end}}{{end}}
+-- PhoneSaver
+`))
+
+var digestSlackTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{"slack": slackEscaper.Replace}).Parse(
+	`*Your {{.Period}} PhoneSaver digest*
+{{if .Birthdays}}
+:birthday: *Upcoming birthdays*
+{{range .Birthdays}}• {{slack .Name}}, {{if eq .Days 0}}today{{else}}{{.Date.Format "Monday, January 2"}}{{end}}
+{{end}}{{end}}{{if .Stale}}
+:wave: *Time to reconnect*
+{{range .Stale}}• {{slack .Name}}{{if .DaysSince}} ({{.DaysSince}} days since you were last in touch){{end}}
+{{end}}{{end}}{{if .Changes.Total}}
+*Recent changes*
+{{if .Changes.Added}}• {{len .Changes.Added}}{{if gt .Changes.AddedCount (len .Changes.Added)}} of {{.Changes.AddedCount}}{{end}} added: {{range $i, $name := .Changes.Added}}{{if $i}}, {{end}}{{slack $name}}{{end}}
+{{end}}{{if .Changes.Updated}}• {{len .Changes.Updated}}{{if gt .Changes.UpdatedCount (len .Changes.Updated)}} of {{.Changes.UpdatedCount}}{{end}} updated: {{range $i, $name := .Changes.Updated}}{{if $i}}, {{end}}{{slack $name}}{{end}}
+{{end}}{{if .Changes.Deleted}}• {{.Changes.Deleted}} deleted
+{{end}}{{end}}`))
+
+// recentChanges summarizes changes to a user's contacts over a period
+type recentChanges struct {
+	Added        []string
+	AddedCount   int
+	Updated      []string
+	UpdatedCount int
+	Deleted      int
+}
+
+// Total returns the number of changed contacts
+func (r recentChanges) Total() int {
+	return r.AddedCount + r.UpdatedCount + r.Deleted
+}
+
+// digestData is the content of a digest
+type digestData struct {
+	Period    string
+	Birthdays []upcomingBirthday
+	Stale     []staleContact
+	Changes   recentChanges
+}
+
+// staleContact is a neglected contact as shown in a digest
+type staleContact struct {
+	Name      string
+	DaysSince int
+}
+
+// RunDigests sends digests at the hour each user chose
+func (a *App) RunDigests() {
+	runHourly(func(now time.Time) {
+		sent, err := a.sendDigests(context.Background(), now)
+		if err != nil {
+			logging.Errorf("Failed to send digests: %v", err)
+		}
+		if sent > 0 {
+			logging.Infof("Sent %d digests", sent)
+		}
+	})
+}
+
+// digestRecipient is a user subscribed to the digest
+type digestRecipient struct {
+	userID    int
+	email     string
+	frequency string
+	byMail    bool
+	bySlack   bool
+	daysAhead int
+	today     time.Time
+	// slackChannel is the channel the user's Slack digest is posted to, or
+	// "" for their incoming webhook's
+	slackChannel string
+}
+
+// sendDigests sends every subscribed user whose digest is due and whose
+// reminder hour has passed in their time zone, returning the number of
+// digests sent. Users in their quiet hours are skipped.
+func (a *App) sendDigests(ctx context.Context, now time.Time) (int, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT u.id, u.email, s.digest, s.digest_email, s.digest_slack, s.slack_channel, s.birthday_days_ahead,
+		COALESCE(s.reminder_hour, ?), s.timezone, s.quiet_hours_enabled, s.quiet_hours_start, s.quiet_hours_end,
+		s.digest_sent_on FROM users u
+		JOIN notification_settings s ON s.user_id = u.id
+		WHERE s.digest IN (?, ?) AND (s.digest_email = TRUE OR s.digest_slack = TRUE)`,
+		a.cfg.ReminderHour, digestDaily, digestWeekly,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch users for digests: %v", err)
+	}
+	var recipients []digestRecipient
+	for rows.Next() {
+		var r digestRecipient
+		var schedule notificationSchedule
+		var timezone string
+		var sentOn sql.NullTime
+		if err := rows.Scan(
+			&r.userID, &r.email, &r.frequency, &r.byMail, &r.bySlack, &r.slackChannel, &r.daysAhead, &schedule.hour, &timezone,
+			&schedule.quiet.Enabled, &schedule.quiet.Start, &schedule.quiet.End, &sentOn,
+		); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user: %v", err)
+		}
+		schedule.loc = loadLocation(timezone)
+		today, due := schedule.due(now)
+		if !due {
+			continue
+		}
+		if sentOn.Valid {
+			next := sentOn.Time.AddDate(0, 0, 1)
+			if r.frequency == digestWeekly {
+				next = sentOn.Time.AddDate(0, 0, 7)
+			}
+			if today.Before(next) {
+				continue
+			}
+		}
+		r.today = today
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range recipients {
+		ok, err := a.sendDigest(ctx, r, now)
+		if err != nil {
+			// Leave the user unmarked so the next run tries again
+			logging.Errorf("Failed to send digest to user %d: %v", r.userID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+		if _, err := a.store.DB.ExecContext(ctx, "UPDATE notification_settings SET digest_sent_on = ? WHERE user_id = ?", r.today, r.userID); err != nil {
+			logging.Errorf("Failed to record digest for user %d: %v", r.userID, err)
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest emails a user or posts to their Slack their upcoming birthdays,
+// contacts to reconnect with, and changes over the digest period, as they
+// opted in to. Nothing is sent if there is nothing to report.
+func (a *App) sendDigest(ctx context.Context, r digestRecipient, now time.Time) (bool, error) {
+	period, days := "daily", r.daysAhead
+	since := now.AddDate(0, 0, -1)
+	if r.frequency == digestWeekly {
+		period, days = "weekly", max(days, 7)
+		since = now.AddDate(0, 0, -7)
+	}
+
+	contacts, err := a.store.Contacts.ListAll(ctx, r.userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load contacts: %v", err)
+	}
+	interactions, err := a.loadInteractions(ctx, r.userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load interactions: %v", err)
+	}
+	changes, err := a.loadRecentChanges(ctx, r.userID, since)
+	if err != nil {
+		return false, err
+	}
+
+	data := digestData{
+		Period:    period,
+		Birthdays: upcomingBirthdays(contacts, r.today, days),
+		Changes:   changes,
+	}
+	for _, neglected := range computeInteractionInsights(contacts, interactions, now).Neglected {
+		// Contacts never interacted with are left out as there may be many
+		if neglected.DaysSince == nil {
+			continue
+		}
+		data.Stale = append(data.Stale, staleContact{Name: neglected.Name, DaysSince: *neglected.DaysSince})
+		if len(data.Stale) == digestStaleLimit {
+			break
+		}
+	}
+	if len(data.Birthdays) == 0 && len(data.Stale) == 0 && changes.Total() == 0 {
+		return false, nil
+	}
+
+	subject := fmt.Sprintf("Your %s PhoneSaver digest", period)
+	if r.bySlack {
+		var body bytes.Buffer
+		if err := digestSlackTemplate.Execute(&body, data); err != nil {
+			return false, fmt.Errorf("failed to render Slack message: %v", err)
+		}
+		err = a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelSlack,
+			Kind:    notificationDigest,
+			To:      slackRecipient(r.slackChannel),
+			Subject: subject,
+			Body:    body.String(),
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if r.byMail {
+		var body bytes.Buffer
+		if err := digestEmailTemplate.Execute(&body, data); err != nil {
+			return false, fmt.Errorf("failed to render email: %v", err)
+		}
+		err = a.sendNotification(ctx, models.Notification{
+			UserID:  r.userID,
+			Channel: channelEmail,
+			Kind:    notificationDigest,
+			To:      r.email,
+			Subject: subject,
+			Body:    body.String(),
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// loadRecentChanges summarizes the contacts added, updated, and deleted
+// since the given time
+func (a *App) loadRecentChanges(ctx context.Context, userID int, since time.Time) (recentChanges, error) {
+	var changes recentChanges
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT name, created_at >= ? FROM contacts WHERE user_id = ? AND updated_at >= ? ORDER BY updated_at DESC",
+		since, userID, since,
+	)
+	if err != nil {
+		return changes, fmt.Errorf("failed to fetch recent changes: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var added bool
+		if err := rows.Scan(&name, &added); err != nil {
+			return changes, fmt.Errorf("failed to scan contact: %v", err)
+		}
+		if added {
+			changes.AddedCount++
+			if len(changes.Added) < digestChangesLimit {
+				changes.Added = append(changes.Added, name)
+			}
+		} else {
+			changes.UpdatedCount++
+			if len(changes.Updated) < digestChangesLimit {
+				changes.Updated = append(changes.Updated, name)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return changes, err
+	}
+
+	err = a.store.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM contact_tombstones WHERE user_id = ? AND deleted_at >= ?",
+		userID, since,
+	).Scan(&changes.Deleted)
+	if err != nil {
+		return changes, fmt.Errorf("failed to count deleted contacts: %v", err)
+	}
+	return changes, nil
+}
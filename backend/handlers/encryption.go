@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+)
+
+// GetEncryptionStatus reports the versions of the data key and how many
+// contacts are encrypted with each, to follow a re-encryption
+func (a *App) GetEncryptionStatus(c *gin.Context) {
+	keys, current, err := a.store.DataKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to load data keys")
+		return
+	}
+	counts, err := a.store.CountPhonesByKeyVersion(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to count encrypted contacts")
+		return
+	}
+
+	status := models.EncryptionStatus{CurrentVersion: current, Unencrypted: counts[0]}
+	for _, key := range keys {
+		keyStatus := models.DataKeyStatus{
+			Version:       key.Version,
+			KMSKeyVersion: key.KMSKeyVersion,
+			Current:       key.Version == current,
+			Contacts:      counts[key.Version],
+		}
+		if !key.CreatedAt.IsZero() {
+			createdAt, activeAt := key.CreatedAt, key.ActiveAt
+			keyStatus.CreatedAt, keyStatus.ActiveAt = &createdAt, &activeAt
+		}
+		status.Keys = append(status.Keys, keyStatus)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// RotateDataKey starts a job that creates a new version of the data key and
+// re-encrypts every contact to it once all servers have loaded it. Rotation
+// requires a KMS to keep the new key wrapped.
+func (a *App) RotateDataKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	if !a.store.CanRotateDataKey() {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Rotating the data key requires a KMS; set KMS_PROVIDER",
+		})
+		return
+	}
+
+	a.startJobResponse(c, userID.(int), jobTypeReencrypt, func(ctx context.Context, progress progressFunc) (interface{}, error) {
+		if _, err := a.store.RotateDataKey(ctx); err != nil {
+			return nil, err
+		}
+		return a.reencryptPhones(ctx, progress)
+	})
+}
+
+// ReencryptContacts starts a job that re-encrypts the contacts still
+// encrypted with an older version of the data key, such as after a rotation
+// job was interrupted
+func (a *App) ReencryptContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	a.startJobResponse(c, userID.(int), jobTypeReencrypt, a.reencryptPhones)
+}
+
+// reencryptPhones re-encrypts contacts' phone numbers to the newest data key
+func (a *App) reencryptPhones(ctx context.Context, progress progressFunc) (interface{}, error) {
+	reencrypted, version, err := a.store.ReencryptPhones(ctx, progress)
+	if err != nil {
+		return nil, err
+	}
+	return models.ReencryptResult{KeyVersion: version, Reencrypted: reencrypted}, nil
+}
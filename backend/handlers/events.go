@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	eventContactCreated   = "contact.created"
+	eventContactUpdated   = "contact.updated"
+	eventContactDeleted   = "contact.deleted"
+	eventContactsRestored = "contacts.restored"
+)
+
+const (
+	// eventBufferSize is the number of events queued per connection before
+	// further events are dropped
+	eventBufferSize = 64
+	wsPingInterval  = 30 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+)
+
+// eventHub fans out contact events to the connections of each user
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan models.ContactEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[int]map[chan models.ContactEvent]struct{})}
+}
+
+// subscribe registers a new listener for a user's events
+func (h *eventHub) subscribe(userID int) chan models.ContactEvent {
+	ch := make(chan models.ContactEvent, eventBufferSize)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan models.ContactEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a listener registered with subscribe
+func (h *eventHub) unsubscribe(userID int, ch chan models.ContactEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
+
+// publish sends an event to every listener of a user. Slow listeners miss
+// events rather than blocking the caller; clients recover with a delta sync.
+func (h *eventHub) publish(userID int, event models.ContactEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// publish sends an event to the user's connections, wakes their other
+// devices with a push notification and queues the user's webhooks
+func (a *App) publish(userID int, event models.ContactEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	a.events.publish(userID, event)
+
+	a.changePushes.notify(userID, event.DeviceID)
+	if webhookEvents[event.Type] {
+		go a.queueWebhooks(context.Background(), userID, event.Type, event)
+	}
+}
+
+// newUpgrader returns the upgrader for event connections. Browsers may
+// connect from the origins allowed by the CORS policy.
+func newUpgrader(cfg *config.Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return middleware.OriginAllowed(cfg, r)
+		},
+	}
+}
+
+// ServeEvents upgrades the request to a WebSocket and streams the user's
+// contact events until the client disconnects or the server shuts down
+func (a *App) ServeEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	conn, err := a.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		middleware.RequestLogger(c).Errorf("Failed to upgrade WebSocket connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ch := a.events.subscribe(userID.(int))
+	defer a.events.unsubscribe(userID.(int), ch)
+
+	// Clients only send control frames; reading detects disconnects
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-ch:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-shuttingDown:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+)
+
+// contactFields are the fields of a contact that ?fields= may select
+var contactFields = jsonFields(reflect.TypeOf(models.ContactResponse{}))
+
+// jsonFields returns the names of a struct's JSON fields
+func jsonFields(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// parseFields parses a comma-separated ?fields= list of JSON fields to
+// return, always including id. It returns nil to return every field, and
+// responds with 400 if a field is unknown.
+func parseFields(c *gin.Context, allowed map[string]bool) ([]string, bool) {
+	raw := c.Query("fields")
+	if raw == "" {
+		return nil, true
+	}
+	selected := []string{"id"}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || field == "id" {
+			continue
+		}
+		if !allowed[field] {
+			names := make([]string, 0, len(allowed))
+			for name := range allowed {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "fields",
+					Message: "Unknown field " + field + "; fields must be among " + strings.Join(names, ", "),
+				},
+			})
+			return nil, false
+		}
+		selected = append(selected, field)
+	}
+	return selected, true
+}
+
+// selectFields returns the JSON object for v with only the given fields, or
+// v itself if fields is nil
+func selectFields(v interface{}, fields []string) (interface{}, error) {
+	if fields == nil {
+		return v, nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// selectContactFields returns the API representation of each contact, with
+// its phone links if links is set, applying selectFields to it
+func selectContactFields(contacts []models.Contact, fields []string, links bool) (interface{}, error) {
+	responses := models.NewContactResponses(contacts)
+	if links {
+		for i := range responses {
+			responses[i].Links = phoneLinks(responses[i].Phone)
+		}
+	}
+	if fields == nil {
+		return responses, nil
+	}
+	selected := make([]interface{}, len(responses))
+	for i, contact := range responses {
+		s, err := selectFields(contact, fields)
+		if err != nil {
+			return nil, err
+		}
+		selected[i] = s
+	}
+	return selected, nil
+}
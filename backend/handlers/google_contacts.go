@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	people "google.golang.org/api/people/v1"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// providerGoogle names Google Contacts in the integration routes
+const providerGoogle = "google"
+
+const (
+	// googlePersonFields are the fields of a person read from the People
+	// API, those synced and the metadata telling deletions and update times
+	googlePersonFields = "names,phoneNumbers,birthdays,metadata"
+	// googleUpdateFields are the fields of a person a sync changes
+	googleUpdateFields = "names,phoneNumbers,birthdays"
+	// googlePageSize is the most connections the People API lists at once
+	googlePageSize = 1000
+)
+
+// googleContacts syncs contacts with Google Contacts through the People
+// API. A contact's name is synced as a whole, its phone number with the
+// person's primary number, and its birthday with the person's birthday if
+// it has a year; the person's other fields are left as they are.
+type googleContacts struct {
+	clientID     string
+	clientSecret string
+}
+
+// newGoogleContacts creates the Google Contacts provider for the OAuth
+// client in GOOGLE_CLIENT_ID
+func newGoogleContacts(cfg *config.Config) *googleContacts {
+	return &googleContacts{clientID: cfg.GoogleClientID, clientSecret: cfg.GoogleClientSecret}
+}
+
+func (g *googleContacts) title() string {
+	return "Google Contacts"
+}
+
+func (g *googleContacts) oauth(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     g.clientID,
+		ClientSecret: g.clientSecret,
+		Endpoint:     endpoints.Google,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{people.ContactsScope, people.UserinfoEmailScope},
+	}
+}
+
+// authOptions asks for a refresh token, and for consent even from users
+// who gave it before, as Google only issues a refresh token with consent
+func (g *googleContacts) authOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.ApprovalForce}
+}
+
+func (g *googleContacts) account(ctx context.Context, client *http.Client) (string, error) {
+	service, err := g.service(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	me, err := service.People.Get("people/me").PersonFields("emailAddresses").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get profile: %v", err)
+	}
+	for _, email := range me.EmailAddresses {
+		if email.Metadata != nil && email.Metadata.Primary {
+			return email.Value, nil
+		}
+	}
+	if len(me.EmailAddresses) == 0 {
+		return "", errors.New("profile has no email address")
+	}
+	return me.EmailAddresses[0].Value, nil
+}
+
+func (g *googleContacts) changes(ctx context.Context, client *http.Client, syncToken string) (remoteChanges, error) {
+	service, err := g.service(ctx, client)
+	if err != nil {
+		return remoteChanges{}, err
+	}
+	changes := remoteChanges{Full: syncToken == ""}
+	call := service.People.Connections.List("people/me").
+		PersonFields(googlePersonFields).
+		PageSize(googlePageSize).
+		RequestSyncToken(true)
+	if syncToken != "" {
+		call = call.SyncToken(syncToken)
+	}
+	err = call.Pages(ctx, func(page *people.ListConnectionsResponse) error {
+		for _, person := range page.Connections {
+			changes.Contacts = append(changes.Contacts, googleRemoteContact(person))
+		}
+		if page.NextSyncToken != "" {
+			changes.SyncToken = page.NextSyncToken
+		}
+		return nil
+	})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && syncToken != "" &&
+		(apiErr.Code == http.StatusGone || strings.Contains(apiErr.Error(), "EXPIRED_SYNC_TOKEN")) {
+		return remoteChanges{}, errSyncTokenExpired
+	}
+	if err != nil {
+		return remoteChanges{}, fmt.Errorf("failed to list connections: %v", err)
+	}
+	return changes, nil
+}
+
+func (g *googleContacts) create(ctx context.Context, client *http.Client, contact models.Contact) (remoteContact, error) {
+	service, err := g.service(ctx, client)
+	if err != nil {
+		return remoteContact{}, err
+	}
+	person := &people.Person{}
+	setGooglePerson(person, contact)
+	created, err := service.People.CreateContact(person).PersonFields(googlePersonFields).Context(ctx).Do()
+	if err != nil {
+		return remoteContact{}, fmt.Errorf("failed to create contact: %v", err)
+	}
+	return googleRemoteContact(created), nil
+}
+
+func (g *googleContacts) update(ctx context.Context, client *http.Client, remoteID, etag string, contact models.Contact) (string, error) {
+	service, err := g.service(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	person, err := service.People.Get(remoteID).PersonFields(googlePersonFields).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get contact: %v", err)
+	}
+	if contactPushed(contact, googleRemoteContact(person)) {
+		return person.Etag, nil
+	}
+	if person.Etag != etag {
+		return "", errRemoteChanged
+	}
+
+	setGooglePerson(person, contact)
+	updated, err := service.People.UpdateContact(remoteID, person).
+		UpdatePersonFields(googleUpdateFields).
+		PersonFields(googlePersonFields).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to update contact: %v", err)
+	}
+	return updated.Etag, nil
+}
+
+func (g *googleContacts) delete(ctx context.Context, client *http.Client, remoteID string) error {
+	service, err := g.service(ctx, client)
+	if err != nil {
+		return err
+	}
+	_, err = service.People.DeleteContact(remoteID).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %v", err)
+	}
+	return nil
+}
+
+// service returns a People API client calling through client
+func (g *googleContacts) service(ctx context.Context, client *http.Client) (*people.Service, error) {
+	service, err := people.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create People API client: %v", err)
+	}
+	return service, nil
+}
+
+// googleRemoteContact maps a person to the synced fields. Birthdays without
+// a year aren't synced, as contacts' birthdays are dates.
+func googleRemoteContact(person *people.Person) remoteContact {
+	remote := remoteContact{ID: person.ResourceName, ETag: person.Etag}
+	if person.Metadata != nil {
+		remote.Deleted = person.Metadata.Deleted
+		for _, source := range person.Metadata.Sources {
+			if source.Type != "CONTACT" {
+				continue
+			}
+			if updatedAt, err := time.Parse(time.RFC3339, source.UpdateTime); err == nil {
+				remote.UpdatedAt = updatedAt
+			}
+		}
+	}
+	if len(person.Names) > 0 {
+		remote.Name = person.Names[0].UnstructuredName
+		if remote.Name == "" {
+			remote.Name = person.Names[0].DisplayName
+		}
+	}
+	if i := googlePrimaryPhone(person); i >= 0 {
+		remote.Phone = person.PhoneNumbers[i].Value
+	}
+	for _, birthday := range person.Birthdays {
+		if date := birthday.Date; date != nil && date.Year != 0 && date.Month != 0 && date.Day != 0 {
+			remote.Birthday = time.Date(int(date.Year), time.Month(date.Month), int(date.Day), 0, 0, 0, 0, time.UTC)
+			break
+		}
+	}
+	return remote
+}
+
+// setGooglePerson sets the synced fields of a person to a contact's. The
+// primary phone number is replaced, keeping its type, and a contact
+// without a birthday leaves the person's.
+func setGooglePerson(person *people.Person, contact models.Contact) {
+	person.Names = []*people.Name{{UnstructuredName: contact.Name}}
+	if i := googlePrimaryPhone(person); i >= 0 {
+		person.PhoneNumbers[i] = &people.PhoneNumber{Value: contact.Phone, Type: person.PhoneNumbers[i].Type}
+	} else {
+		person.PhoneNumbers = []*people.PhoneNumber{{Value: contact.Phone}}
+	}
+	if !contact.Birthday.IsZero() {
+		birthday := contact.Birthday.UTC()
+		person.Birthdays = []*people.Birthday{{Date: &people.Date{
+			Year:  int64(birthday.Year()),
+			Month: int64(birthday.Month()),
+			Day:   int64(birthday.Day()),
+		}}}
+	}
+}
+
+// googlePrimaryPhone returns the index of a person's primary phone number,
+// or of their first if none is primary, and -1 if they have none
+func googlePrimaryPhone(person *people.Person) int {
+	for i, phone := range person.PhoneNumbers {
+		if phone.Metadata != nil && phone.Metadata.Primary {
+			return i
+		}
+	}
+	if len(person.PhoneNumbers) == 0 {
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,204 @@
+package handlers
+
+// THIS CODE WILL BE UPDATED WITH SCHEMA CHANGES. PREVIOUS IMPLEMENTATION FOR SCHEMA CHANGES WILL BE KEPT IN THE COMMENT SECTION. IMPLEMENTATION FOR UNCHANGED SCHEMA WILL BE KEPT.
+
+import (
+	"context"
+	"fmt"
+	"phonesaver-backend/graph"
+	"strings"
+	"time"
+)
+
+type graphResolver struct {
+	app *App
+}
+
+// Interactions is the resolver for the interactions field.
+func (r *contactGraphResolver) Interactions(ctx context.Context, obj *graph.Contact, limit *int) ([]*graph.Interaction, error) {
+	interactions, err := requestFrom(ctx).loadInteractions(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if limit != nil && *limit >= 0 && *limit < len(interactions) {
+		interactions = interactions[:*limit]
+	}
+
+	result := make([]*graph.Interaction, 0, len(interactions))
+	for _, interaction := range interactions {
+		i := &graph.Interaction{
+			ID:        interaction.ID,
+			ContactID: interaction.ContactID,
+			Type:      interaction.Type,
+			Timestamp: interaction.Timestamp,
+			CreatedAt: interaction.CreatedAt,
+		}
+		if interaction.Note != "" {
+			note := interaction.Note
+			i.Note = &note
+		}
+		result = append(result, i)
+	}
+	return result, nil
+}
+
+// Contact is the resolver for the contact field.
+func (r *contactFrequencyGraphResolver) Contact(ctx context.Context, obj *graph.ContactFrequency) (*graph.Contact, error) {
+	return requestFrom(ctx).contact(ctx, obj.ContactID)
+}
+
+// Contact is the resolver for the contact field.
+func (r *interactionGraphResolver) Contact(ctx context.Context, obj *graph.Interaction) (*graph.Contact, error) {
+	return requestFrom(ctx).contact(ctx, obj.ContactID)
+}
+
+// Contact is the resolver for the contact field.
+func (r *neglectedContactGraphResolver) Contact(ctx context.Context, obj *graph.NeglectedContact) (*graph.Contact, error) {
+	return requestFrom(ctx).contact(ctx, obj.ContactID)
+}
+
+// Contacts is the resolver for the contacts field.
+func (r *queryGraphResolver) Contacts(ctx context.Context, search *string, tag *string) ([]*graph.Contact, error) {
+	contacts, err := requestFrom(ctx).loadContacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*graph.Contact{}
+	for _, contact := range contacts {
+		if search != nil {
+			q := strings.ToLower(*search)
+			if !strings.Contains(strings.ToLower(contact.Name), q) && !strings.Contains(contact.Phone, q) {
+				continue
+			}
+		}
+		if tag != nil && !hasTag(contact, *tag) {
+			continue
+		}
+		result = append(result, graphContact(contact))
+	}
+	return result, nil
+}
+
+// Contact is the resolver for the contact field.
+func (r *queryGraphResolver) Contact(ctx context.Context, id int) (*graph.Contact, error) {
+	return requestFrom(ctx).contact(ctx, id)
+}
+
+// Tags is the resolver for the tags field.
+func (r *queryGraphResolver) Tags(ctx context.Context) ([]*graph.TagCount, error) {
+	contacts, err := requestFrom(ctx).loadContacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := countTags(contacts)
+	result := make([]*graph.TagCount, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, &graph.TagCount{Tag: tag.Tag, Count: tag.Count})
+	}
+	return result, nil
+}
+
+// Insights is the resolver for the insights field.
+func (r *queryGraphResolver) Insights(ctx context.Context) (*graph.InteractionInsights, error) {
+	req := requestFrom(ctx)
+	contacts, err := req.loadContacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	interactions, err := r.app.loadInteractions(ctx, req.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load interactions: %v", err)
+	}
+	insights := computeInteractionInsights(contacts, interactions, time.Now().UTC())
+
+	stats := &graph.InteractionStats{
+		Total:             insights.Stats.Total,
+		ByType:            []*graph.InteractionTypeCount{},
+		PerWeek:           insights.Stats.PerWeek,
+		CallsPerWeek:      insights.Stats.CallsPerWeek,
+		LongestStreakDays: insights.Stats.LongestStreakDays,
+		CurrentStreakDays: insights.Stats.CurrentStreakDays,
+	}
+	for _, interactionType := range []string{interactionCall, interactionSMS, interactionMeeting, interactionOther} {
+		if count := insights.Stats.ByType[interactionType]; count > 0 {
+			stats.ByType = append(stats.ByType, &graph.InteractionTypeCount{Type: interactionType, Count: count})
+		}
+	}
+
+	result := &graph.InteractionInsights{
+		Stats:     stats,
+		Contacts:  make([]*graph.ContactFrequency, 0, len(insights.Contacts)),
+		Neglected: make([]*graph.NeglectedContact, 0, len(insights.Neglected)),
+	}
+	for _, frequency := range insights.Contacts {
+		f := &graph.ContactFrequency{
+			ContactID:          frequency.ContactID,
+			Interactions:       frequency.Interactions,
+			PerWeek:            frequency.PerWeek,
+			CallsPerWeek:       frequency.CallsPerWeek,
+			LongestStreakWeeks: frequency.LongestStreakWeeks,
+			LastInteraction:    frequency.LastInteraction,
+			DaysSince:          frequency.DaysSince,
+		}
+		if frequency.AverageGapDays != 0 {
+			gap := frequency.AverageGapDays
+			f.AverageGapDays = &gap
+		}
+		result.Contacts = append(result.Contacts, f)
+	}
+	for _, neglected := range insights.Neglected {
+		result.Neglected = append(result.Neglected, &graph.NeglectedContact{
+			ContactID: neglected.ContactID,
+			DaysSince: neglected.DaysSince,
+			Reason:    neglected.Reason,
+		})
+	}
+	return result, nil
+}
+
+// Contacts is the resolver for the contacts field.
+func (r *tagCountGraphResolver) Contacts(ctx context.Context, obj *graph.TagCount) ([]*graph.Contact, error) {
+	tag := obj.Tag
+	return (&queryGraphResolver{r.graphResolver}).Contacts(ctx, nil, &tag)
+}
+
+// Contact returns graph.ContactResolver implementation.
+func (r *graphResolver) Contact() graph.ContactResolver { return &contactGraphResolver{r} }
+
+// ContactFrequency returns graph.ContactFrequencyResolver implementation.
+func (r *graphResolver) ContactFrequency() graph.ContactFrequencyResolver {
+	return &contactFrequencyGraphResolver{r}
+}
+
+// Interaction returns graph.InteractionResolver implementation.
+func (r *graphResolver) Interaction() graph.InteractionResolver { return &interactionGraphResolver{r} }
+
+// NeglectedContact returns graph.NeglectedContactResolver implementation.
+func (r *graphResolver) NeglectedContact() graph.NeglectedContactResolver {
+	return &neglectedContactGraphResolver{r}
+}
+
+// Query returns graph.QueryResolver implementation.
+func (r *graphResolver) Query() graph.QueryResolver { return &queryGraphResolver{r} }
+
+// TagCount returns graph.TagCountResolver implementation.
+func (r *graphResolver) TagCount() graph.TagCountResolver { return &tagCountGraphResolver{r} }
+
+type contactGraphResolver struct{ *graphResolver }
+type contactFrequencyGraphResolver struct{ *graphResolver }
+type interactionGraphResolver struct{ *graphResolver }
+type neglectedContactGraphResolver struct{ *graphResolver }
+type queryGraphResolver struct{ *graphResolver }
+type tagCountGraphResolver struct{ *graphResolver }
+
+// !!! WARNING !!!
+// The code below was going to be deleted when updating resolvers. It has been copied here so you have
+// one last chance to move it out of harms way if you want. There are two reasons this happens:
+//  - When renaming or deleting a resolver the old code will be put in here. You can safely delete
+//    it when you're done.
+//  - You have helper methods in this file. Move them out to keep these resolver files clean.
+/*
+	type graphResolver struct{}
+*/
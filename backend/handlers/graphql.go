@@ -0,0 +1,167 @@
+package handlers
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/graph"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// graphQLComplexityLimit bounds the cost of a query, counted as one per
+// field, so deeply nested queries can't load the same data repeatedly
+const graphQLComplexityLimit = 1000
+
+// newGraphQLServer returns the handler for GraphQL queries, served over POST
+// and GET
+func (a *App) newGraphQLServer() *handler.Server {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graphResolver{app: a}}))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(graphQLComplexityLimit))
+	return srv
+}
+
+// ServeGraphQL executes a GraphQL query for the user
+func (a *App) ServeGraphQL(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	ctx := context.WithValue(c.Request.Context(), graphRequestKey{}, &graphRequest{store: a.store, userID: userID.(int)})
+	a.graphQL.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
+
+type graphRequestKey struct{}
+
+// graphRequest holds the user's data loaded while resolving one query, so
+// nested fields load each table at most once
+type graphRequest struct {
+	store  *repository.Store
+	userID int
+
+	mu           sync.Mutex
+	contacts     []models.Contact
+	contactsByID map[int]*models.Contact
+	interactions map[int][]models.Interaction
+}
+
+func requestFrom(ctx context.Context) *graphRequest {
+	return ctx.Value(graphRequestKey{}).(*graphRequest)
+}
+
+// loadContacts returns the user's contacts, loading them on first use
+func (r *graphRequest) loadContacts(ctx context.Context) ([]models.Contact, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.contactsByID == nil {
+		contacts, err := r.store.Contacts.ListAll(ctx, r.userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load contacts: %v", err)
+		}
+		r.contacts = contacts
+		r.contactsByID = make(map[int]*models.Contact, len(contacts))
+		for i := range contacts {
+			r.contactsByID[contacts[i].ID] = &contacts[i]
+		}
+	}
+	return r.contacts, nil
+}
+
+// contact returns one of the user's contacts, or nil if it does not exist
+func (r *graphRequest) contact(ctx context.Context, id int) (*graph.Contact, error) {
+	if _, err := r.loadContacts(ctx); err != nil {
+		return nil, err
+	}
+	contact, ok := r.contactsByID[id]
+	if !ok {
+		return nil, nil
+	}
+	return graphContact(*contact), nil
+}
+
+// loadInteractions returns the user's interactions with a contact, newest
+// first, loading every interaction of the user on first use
+func (r *graphRequest) loadInteractions(ctx context.Context, contactID int) ([]models.Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.interactions == nil {
+		rows, err := r.store.DB.QueryContext(ctx,
+			"SELECT id, contact_id, type, occurred_at, note, note_key_version, created_at FROM interactions WHERE user_id = ? ORDER BY occurred_at DESC, id DESC",
+			r.userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch interactions: %v", err)
+		}
+		defer rows.Close()
+
+		interactions := map[int][]models.Interaction{}
+		for rows.Next() {
+			var interaction models.Interaction
+			var note sql.NullString
+			var noteVersion sql.NullInt64
+			if err := rows.Scan(
+				&interaction.ID, &interaction.ContactID, &interaction.Type, &interaction.Timestamp, &note, &noteVersion, &interaction.CreatedAt,
+			); err != nil {
+				return nil, fmt.Errorf("failed to scan interaction: %v", err)
+			}
+			if interaction.Note, err = r.store.OpenNote(ctx, r.userID, repository.InteractionNote, note.String, noteVersion); err != nil {
+				return nil, err
+			}
+			interactions[interaction.ContactID] = append(interactions[interaction.ContactID], interaction)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		r.interactions = interactions
+	}
+	return r.interactions[contactID], nil
+}
+
+// graphContact converts a contact to its GraphQL form
+func graphContact(contact models.Contact) *graph.Contact {
+	return &graph.Contact{
+		ID:              contact.ID,
+		Name:            contact.Name,
+		Phone:           contact.Phone,
+		EncryptedPhone:  contact.EncryptedPhone,
+		Tags:            contact.Tags,
+		LastInteraction: optionalTime(contact.LastInteraction),
+		Birthday:        optionalTime(contact.Birthday),
+		Version:         contact.Version,
+		UpdatedAt:       contact.UpdatedAt,
+	}
+}
+
+// optionalTime returns nil for the zero time, which marks an unset date
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// hasTag reports whether the contact has the tag, ignoring case and
+// surrounding spaces as tag statistics do
+func hasTag(contact models.Contact, tag string) bool {
+	tag = strings.TrimSpace(tag)
+	for _, t := range contact.Tags {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// iftttDefaultLimit is the number of items a trigger returns when IFTTT
+// doesn't ask for a number, as its service API specifies
+const iftttDefaultLimit = 50
+
+// iftttTriggerRequest is the body IFTTT polls a trigger with. Limit is nil
+// when IFTTT doesn't ask for a number of items.
+type iftttTriggerRequest struct {
+	Limit *int `json:"limit" binding:"omitempty,min=0"`
+}
+
+// iftttActionRequest is the body IFTTT runs the create contact action with
+type iftttActionRequest struct {
+	ActionFields iftttContactFields `json:"actionFields"`
+}
+
+// iftttContactFields are the fields of the create contact action. Tags are
+// separated by commas, as IFTTT only has text fields.
+type iftttContactFields struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Tags  string `json:"tags"`
+}
+
+// iftttContact is an item of the new contact trigger, whose fields IFTTT
+// offers as ingredients
+type iftttContact struct {
+	ID        int              `json:"id"`
+	Name      string           `json:"name"`
+	Phone     string           `json:"phone"`
+	Tags      string           `json:"tags"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Meta      models.IFTTTMeta `json:"meta"`
+}
+
+// iftttBirthday is an item of the birthday today trigger: a contact's
+// birthday on Date, when they turned Age
+type iftttBirthday struct {
+	ID    int              `json:"id"`
+	Name  string           `json:"name"`
+	Phone string           `json:"phone"`
+	Date  string           `json:"date"`
+	Age   int              `json:"age"`
+	Meta  models.IFTTTMeta `json:"meta"`
+}
+
+// iftttUser is the account IFTTT shows a connected user as
+type iftttUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// iftttActionResult identifies what an action created, for IFTTT's logs
+type iftttActionResult struct {
+	ID string `json:"id"`
+}
+
+// iftttTestSetup is what IFTTT's endpoint tests run with: a token of the
+// test account, and the fields of valid and skipped actions
+type iftttTestSetup struct {
+	AccessToken          string                 `json:"accessToken"`
+	Samples              map[string]interface{} `json:"samples"`
+	ActionRecordSkipping map[string]interface{} `json:"actionRecordSkipping,omitempty"`
+}
+
+// GetIFTTTStatus tells IFTTT the service is available
+func (a *App) GetIFTTTStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// SetupIFTTTTest issues an access token of the IFTTT_TEST_EMAIL account for
+// IFTTT's endpoint tests, with samples of the action's fields
+func (a *App) SetupIFTTTTest(c *gin.Context) {
+	var user models.User
+	err := repository.ErrNotFound
+	if a.cfg.IFTTTTestEmail != "" {
+		user, err = a.store.Users.GetByEmail(c.Request.Context(), a.cfg.IFTTTTestEmail)
+	}
+	if err == repository.ErrNotFound {
+		respondIFTTTError(c, http.StatusNotFound, "IFTTT test account not found")
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load IFTTT test account: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to set up test")
+		return
+	}
+	scopes := []string{middleware.ScopeReadContacts, middleware.ScopeWriteContacts}
+	token, _, err := a.authService.IssueScopedToken(c.Request.Context(), user.ID, scopes, a.cfg.AccessTokenLifetime)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to issue IFTTT test token: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to set up test")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": iftttTestSetup{
+		AccessToken: token,
+		Samples: map[string]interface{}{
+			"triggers": map[string]interface{}{
+				"new_contact":    map[string]string{},
+				"birthday_today": map[string]string{},
+			},
+			"actions": map[string]interface{}{
+				"create_contact": iftttContactFields{Name: "IFTTT Test", Phone: "+14155550142", Tags: "ifttt"},
+			},
+		},
+		ActionRecordSkipping: map[string]interface{}{
+			"create_contact": iftttContactFields{Name: "IFTTT Test", Phone: "not a number"},
+		},
+	}})
+}
+
+// GetIFTTTUser returns the account the user connected IFTTT with
+func (a *App) GetIFTTTUser(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	user, err := a.store.Users.Get(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load user: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": iftttUser{ID: strconv.Itoa(user.ID), Name: user.Email}})
+}
+
+// IFTTTNewContactTrigger returns the user's contacts, newest first, for
+// IFTTT to run an applet for each contact it hasn't seen
+func (a *App) IFTTTNewContactTrigger(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, ok := iftttLimit(c)
+	if !ok {
+		return
+	}
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to list contacts: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to list contacts")
+		return
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		if !contacts[i].CreatedAt.Equal(contacts[j].CreatedAt) {
+			return contacts[i].CreatedAt.After(contacts[j].CreatedAt)
+		}
+		return contacts[i].ID > contacts[j].ID
+	})
+
+	items := []iftttContact{}
+	for _, contact := range contacts {
+		if len(items) == limit {
+			break
+		}
+		items = append(items, iftttContact{
+			ID:        contact.ID,
+			Name:      contact.Name,
+			Phone:     contact.Phone,
+			Tags:      strings.Join(contact.Tags, ","),
+			CreatedAt: contact.CreatedAt,
+			UpdatedAt: contact.UpdatedAt,
+			Meta:      models.IFTTTMeta{ID: strconv.Itoa(contact.ID), Timestamp: contact.CreatedAt.Unix()},
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+// IFTTTBirthdayTrigger returns the birthdays of the user's contacts that
+// fall today in the user's time zone, so IFTTT runs an applet on the day of
+// each birthday. A February 29 birthday falls on March 1 in other years.
+func (a *App) IFTTTBirthdayTrigger(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, ok := iftttLimit(c)
+	if !ok {
+		return
+	}
+	loc, err := a.userLocation(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load time zone: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to list birthdays")
+		return
+	}
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to list contacts: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to list birthdays")
+		return
+	}
+
+	today := dateOf(time.Now().In(loc))
+	items := []iftttBirthday{}
+	for _, contact := range contacts {
+		birthday := contact.Birthday
+		if birthday.IsZero() {
+			continue
+		}
+		day := time.Date(today.Year(), birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+		if !day.Equal(today) || today.Year() <= birthday.Year() {
+			continue
+		}
+		items = append(items, iftttBirthday{
+			ID:    contact.ID,
+			Name:  contact.Name,
+			Phone: contact.Phone,
+			Date:  today.Format("2006-01-02"),
+			Age:   today.Year() - birthday.Year(),
+			Meta: models.IFTTTMeta{
+				ID:        fmt.Sprintf("%d-%d", contact.ID, today.Year()),
+				Timestamp: time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc).Unix(),
+			},
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+// IFTTTCreateContact creates a contact from the fields of IFTTT's create
+// contact action. Invalid contacts, numbers the user already has a contact
+// for and contacts over the plan's limit are skipped, so IFTTT doesn't
+// retry them.
+func (a *App) IFTTTCreateContact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req iftttActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondIFTTTError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	fields := req.ActionFields
+	contactReq := contactRequest{
+		Name:  strings.TrimSpace(fields.Name),
+		Phone: strings.TrimSpace(fields.Phone),
+		Tags:  []string{},
+	}
+	for _, tag := range strings.Split(fields.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			contactReq.Tags = append(contactReq.Tags, tag)
+		}
+	}
+	if errs := validateValue(contactReq); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Message
+		}
+		respondIFTTTSkip(c, strings.Join(messages, "; "))
+		return
+	}
+	contact := contactReq.contact()
+
+	existing, err := a.contactService.FindByPhone(c.Request.Context(), userID.(int), contact.Phone)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to check for duplicate contacts: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to create contact")
+		return
+	}
+	if len(existing) > 0 {
+		respondIFTTTSkip(c, "A contact with this phone number already exists")
+		return
+	}
+	limited, err := a.contactLimitReached(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to check contact limit: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to create contact")
+		return
+	}
+	if limited {
+		respondIFTTTSkip(c, "Your plan's contact limit is reached")
+		return
+	}
+
+	if err := a.contactService.Create(c.Request.Context(), userID.(int), &contact); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create contact: %v", err)
+		respondIFTTTError(c, http.StatusInternalServerError, "Failed to create contact")
+		return
+	}
+	a.publish(userID.(int), models.ContactEvent{Type: eventContactCreated, ContactID: contact.ID, Contact: contactResponse(contact)})
+
+	c.JSON(http.StatusOK, gin.H{"data": []iftttActionResult{{ID: strconv.Itoa(contact.ID)}}})
+}
+
+// iftttLimit returns the number of items IFTTT polls a trigger for,
+// responding with 400 if the request is invalid
+func iftttLimit(c *gin.Context) (int, bool) {
+	var req iftttTriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondIFTTTError(c, http.StatusBadRequest, "Invalid request body")
+		return 0, false
+	}
+	if req.Limit == nil {
+		return iftttDefaultLimit, true
+	}
+	return *req.Limit, true
+}
+
+func respondIFTTTError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.IFTTTErrors{Errors: []models.IFTTTError{{Message: message}}})
+}
+
+// respondIFTTTSkip tells IFTTT to skip an action it can't run, rather than
+// retry it
+func respondIFTTTSkip(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.IFTTTErrors{Errors: []models.IFTTTError{{Status: "SKIP", Message: message}}})
+}
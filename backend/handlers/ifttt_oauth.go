@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+const (
+	// iftttCodeLifetime is how long IFTTT has to trade an authorization
+	// code for tokens
+	iftttCodeLifetime = 5 * time.Minute
+	// iftttCodeBytes is the length of the random authorization codes
+	iftttCodeBytes = 32
+)
+
+// iftttAuthorizePage asks a user to sign in to connect their account to
+// IFTTT, or tells them why they can't. It posts back to its own URL, which
+// carries IFTTT's request.
+var iftttAuthorizePage = template.Must(template.New("ifttt-authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect PhoneSaver to IFTTT</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Form}}<form method="post">
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Connect</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// iftttAuthorizeView is what iftttAuthorizePage shows
+type iftttAuthorizeView struct {
+	Title   string
+	Message string
+	Form    bool
+}
+
+// iftttAuthorizeRequest is the query IFTTT sends a user to the authorize
+// page with
+type iftttAuthorizeRequest struct {
+	ClientID     string `form:"client_id"`
+	ResponseType string `form:"response_type"`
+	RedirectURI  string `form:"redirect_uri"`
+	State        string `form:"state"`
+}
+
+// iftttAuthorizeForm is the form iftttAuthorizePage posts
+type iftttAuthorizeForm struct {
+	Email    string `form:"email" binding:"required"`
+	Password string `form:"password" binding:"required"`
+}
+
+// iftttTokenRequest is the form IFTTT posts to trade an authorization code
+// or a refresh token for tokens
+type iftttTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RefreshToken string `form:"refresh_token"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// iftttTokenResponse is the OAuth token response IFTTT stores for a user.
+// ExpiresIn is in seconds.
+type iftttTokenResponse struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// iftttTokenError is an OAuth error from the token endpoint, such as
+// invalid_grant
+type iftttTokenError struct {
+	Error string `json:"error"`
+}
+
+// GetIFTTTAuthorize shows the page IFTTT sends a user to when they connect
+// PhoneSaver, which asks them to sign in
+func (a *App) GetIFTTTAuthorize(c *gin.Context) {
+	if !a.requireIFTTT(c) {
+		return
+	}
+	if _, ok := a.iftttAuthorizeRequest(c); !ok {
+		return
+	}
+	a.renderIFTTTAuthorize(c, http.StatusOK, iftttAuthorizeView{
+		Title:   "Connect PhoneSaver to IFTTT",
+		Message: "Sign in to let IFTTT read your contacts and add new ones.",
+		Form:    true,
+	})
+}
+
+// IFTTTAuthorize signs in the user posting the authorize page, and sends
+// them back to IFTTT with an authorization code for their account
+func (a *App) IFTTTAuthorize(c *gin.Context) {
+	if !a.requireIFTTT(c) {
+		return
+	}
+	req, ok := a.iftttAuthorizeRequest(c)
+	if !ok {
+		return
+	}
+	var form iftttAuthorizeForm
+	if err := c.ShouldBind(&form); err != nil {
+		a.renderIFTTTAuthorize(c, http.StatusBadRequest, iftttAuthorizeView{
+			Title:   "Connect PhoneSaver to IFTTT",
+			Message: "Enter your email and password.",
+			Form:    true,
+		})
+		return
+	}
+
+	user, err := a.authService.Authenticate(c.Request.Context(), form.Email, form.Password)
+	if err == services.ErrInvalidCredentials {
+		a.audit(c.Request.Context(), newAuditEvent(c, user.ID, auditLoginFailed, map[string]string{"client": "ifttt"}))
+		a.renderIFTTTAuthorize(c, http.StatusUnauthorized, iftttAuthorizeView{
+			Title:   "Connect PhoneSaver to IFTTT",
+			Message: "The email or password is incorrect.",
+			Form:    true,
+		})
+		return
+	}
+	if err == services.ErrAccountSuspended {
+		a.audit(c.Request.Context(), newAuditEvent(c, user.ID, auditLoginFailed, map[string]string{"client": "ifttt", "reason": "suspended"}))
+		a.renderIFTTTAuthorize(c, http.StatusForbidden, iftttAuthorizeView{
+			Title:   "Account suspended",
+			Message: "Your PhoneSaver account is suspended, so it can't be connected to IFTTT.",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to sign in to IFTTT: %v", err)
+		a.renderIFTTTAuthorize(c, http.StatusInternalServerError, iftttAuthorizeView{
+			Title:   "Something went wrong",
+			Message: "Your account could not be connected. Please try again.",
+			Form:    true,
+		})
+		return
+	}
+
+	code, err := a.createIFTTTCode(c, user.ID, req.RedirectURI)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create IFTTT authorization code: %v", err)
+		a.renderIFTTTAuthorize(c, http.StatusInternalServerError, iftttAuthorizeView{
+			Title:   "Something went wrong",
+			Message: "Your account could not be connected. Please try again.",
+			Form:    true,
+		})
+		return
+	}
+	redirect, _ := url.Parse(req.RedirectURI)
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", req.State)
+	redirect.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, redirect.String())
+}
+
+// IFTTTToken trades an authorization code from IFTTTAuthorize, or a refresh
+// token, for a token reading and writing the user's contacts and the
+// refresh token that renews it
+func (a *App) IFTTTToken(c *gin.Context) {
+	if !a.requireIFTTT(c) {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	var req iftttTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, iftttTokenError{Error: "invalid_request"})
+		return
+	}
+	validID := subtle.ConstantTimeCompare([]byte(req.ClientID), []byte(a.cfg.IFTTTClientID)) == 1
+	validSecret := subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(a.cfg.IFTTTClientSecret)) == 1
+	if !validID || !validSecret {
+		c.JSON(http.StatusUnauthorized, iftttTokenError{Error: "invalid_client"})
+		return
+	}
+
+	var grant services.IFTTTGrant
+	switch req.GrantType {
+	case "authorization_code":
+		userID, ok, err := a.redeemIFTTTCode(c, req.Code, req.RedirectURI)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to redeem IFTTT authorization code: %v", err)
+			c.JSON(http.StatusInternalServerError, iftttTokenError{Error: "server_error"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, iftttTokenError{Error: "invalid_grant"})
+			return
+		}
+		grant, err = a.authService.IssueIFTTTGrant(c.Request.Context(), userID, a.cfg.AccessTokenLifetime)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to issue IFTTT tokens: %v", err)
+			c.JSON(http.StatusInternalServerError, iftttTokenError{Error: "server_error"})
+			return
+		}
+		a.audit(c.Request.Context(), newAuditEvent(c, userID, auditIntegrationConnected, map[string]string{
+			"provider": "ifttt",
+		}))
+	case "refresh_token":
+		var err error
+		grant, _, err = a.authService.RefreshIFTTTGrant(c.Request.Context(), req.RefreshToken, a.cfg.AccessTokenLifetime)
+		if err == services.ErrInvalidRefreshToken {
+			c.JSON(http.StatusBadRequest, iftttTokenError{Error: "invalid_grant"})
+			return
+		}
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to refresh IFTTT tokens: %v", err)
+			c.JSON(http.StatusInternalServerError, iftttTokenError{Error: "server_error"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, iftttTokenError{Error: "unsupported_grant_type"})
+		return
+	}
+
+	c.JSON(http.StatusOK, iftttTokenResponse{
+		TokenType:    "Bearer",
+		AccessToken:  grant.AccessToken,
+		RefreshToken: grant.RefreshToken,
+		ExpiresIn:    int64(time.Until(grant.ExpiresAt).Seconds()),
+	})
+}
+
+// requireIFTTT reports whether the IFTTT service is enabled, responding
+// with 404 if not
+func (a *App) requireIFTTT(c *gin.Context) bool {
+	if a.cfg.IFTTTServiceKey == "" {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "IFTTT is not enabled",
+		})
+		return false
+	}
+	return true
+}
+
+// iftttAuthorizeRequest returns the request IFTTT sent the user to the
+// authorize page with, showing the page with an error if it isn't from
+// IFTTT. The user isn't sent back to a redirect URI that isn't IFTTT's.
+func (a *App) iftttAuthorizeRequest(c *gin.Context) (iftttAuthorizeRequest, bool) {
+	var req iftttAuthorizeRequest
+	_ = c.ShouldBindQuery(&req)
+	validClient := subtle.ConstantTimeCompare([]byte(req.ClientID), []byte(a.cfg.IFTTTClientID)) == 1
+	if !validClient || req.ResponseType != "code" || !validIFTTTRedirect(req.RedirectURI) {
+		a.renderIFTTTAuthorize(c, http.StatusBadRequest, iftttAuthorizeView{
+			Title:   "This link doesn't work",
+			Message: "Connect PhoneSaver from the IFTTT app or website.",
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// validIFTTTRedirect reports whether uri is one of IFTTT's OAuth redirect
+// URIs, https://ifttt.com/channels/<service>/authorize
+func validIFTTTRedirect(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" && u.Host == "ifttt.com" && u.User == nil &&
+		strings.HasPrefix(u.Path, "/channels/")
+}
+
+// createIFTTTCode stores a new authorization code for the user, bound to
+// the redirect URI it is sent to, and returns it. Expired codes are purged
+// along the way.
+func (a *App) createIFTTTCode(c *gin.Context, userID int, redirectURI string) (string, error) {
+	raw := make([]byte, iftttCodeBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	err := a.store.IFTTTCodes.Create(c.Request.Context(), models.IFTTTAuthorizationCode{
+		CodeHash:    hashIFTTTCode(code),
+		UserID:      userID,
+		RedirectURI: redirectURI,
+		ExpiresAt:   now.Add(iftttCodeLifetime),
+	}, now)
+	return code, err
+}
+
+// redeemIFTTTCode uses up an authorization code and returns the user it
+// was issued to. It reports false for codes that are unknown, expired,
+// already used or sent with another redirect URI.
+func (a *App) redeemIFTTTCode(c *gin.Context, code, redirectURI string) (int, bool, error) {
+	stored, err := a.store.IFTTTCodes.Consume(c.Request.Context(), hashIFTTTCode(code), time.Now().UTC())
+	if err == repository.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return stored.UserID, stored.RedirectURI == redirectURI, nil
+}
+
+// hashIFTTTCode returns the hex SHA-256 hash an authorization code is
+// stored under
+func hashIFTTTCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderIFTTTAuthorize responds with iftttAuthorizePage showing view
+func (a *App) renderIFTTTAuthorize(c *gin.Context, status int, view iftttAuthorizeView) {
+	var page bytes.Buffer
+	if err := iftttAuthorizePage.Execute(&page, view); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to render IFTTT authorize page: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
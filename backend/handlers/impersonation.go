@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// impersonationNoticeInterval is how often users are told about the
+// impersonations of them that are over
+const impersonationNoticeInterval = time.Minute
+
+// impersonationRequest is the body of an admin's request to act as a user,
+// saying why
+type impersonationRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// impersonationResponse is the data of a new impersonation, with the token
+// that acts as the user
+type impersonationResponse struct {
+	Token         string               `json:"token"`
+	Impersonation models.Impersonation `json:"impersonation"`
+}
+
+// ImpersonateUser issues an admin a token that acts as a user until
+// IMPERSONATION_LIFETIME passes, to debug an issue of theirs. Every request
+// made with it is flagged in the user's audit log, and they are emailed once
+// the impersonation is over. Admins can't impersonate themselves, other
+// admins or suspended accounts.
+func (a *App) ImpersonateUser(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+	var req impersonationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := a.store.Users.Get(c.Request.Context(), userID)
+	if err == repository.ErrNotFound {
+		respondUserNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get user: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to impersonate user",
+		})
+		return
+	}
+	var refusal string
+	switch {
+	case userID == adminID.(int):
+		refusal = "You can't impersonate your own account"
+	case middleware.IsAdmin(a.cfg, user.Email):
+		refusal = "Admins can't be impersonated"
+	case user.SuspendedAt != nil:
+		refusal = "Suspended accounts can't be impersonated"
+	}
+	if refusal != "" {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   refusal,
+		})
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	impersonation := models.Impersonation{
+		UserID:    userID,
+		AdminID:   adminID.(int),
+		Reason:    req.Reason,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.cfg.ImpersonationLifetime),
+	}
+	if err := a.store.Impersonations.Create(c.Request.Context(), &impersonation); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create impersonation: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to impersonate user",
+		})
+		return
+	}
+	token, err := a.authService.IssueImpersonationToken(c.Request.Context(), impersonation)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to issue impersonation token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to impersonate user",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID, auditImpersonationStarted, map[string]string{
+		"admin_id":         strconv.Itoa(impersonation.AdminID),
+		"impersonation_id": strconv.Itoa(impersonation.ID),
+		"reason":           impersonation.Reason,
+		"expires_at":       impersonation.ExpiresAt.Format(time.RFC3339),
+	}))
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    impersonationResponse{Token: token, Impersonation: impersonation},
+	})
+}
+
+// EndImpersonation ends an impersonation before it expires, refusing its
+// token from then on
+func (a *App) EndImpersonation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondImpersonationNotFound(c)
+		return
+	}
+
+	ended, err := a.store.Impersonations.End(c.Request.Context(), id, time.Now())
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to end impersonation: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to end impersonation",
+		})
+		return
+	}
+	impersonation, err := a.store.Impersonations.Get(c.Request.Context(), id)
+	if err == repository.ErrNotFound {
+		respondImpersonationNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get impersonation: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to end impersonation",
+		})
+		return
+	}
+	if ended {
+		adminID, _ := c.Get("user_id")
+		a.audit(c.Request.Context(), newAuditEvent(c, impersonation.UserID, auditImpersonationEnded, map[string]string{
+			"admin_id":         strconv.Itoa(adminID.(int)),
+			"impersonation_id": strconv.Itoa(impersonation.ID),
+		}))
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    impersonation,
+	})
+}
+
+func respondImpersonationNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Impersonation not found",
+	})
+}
+
+// RunImpersonationNotices periodically emails users about the impersonations
+// of them that ended or expired: when, why and how many requests were made
+func (a *App) RunImpersonationNotices() {
+	ticker := time.NewTicker(impersonationNoticeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		impersonations, err := a.store.Impersonations.ListFinished(ctx, time.Now())
+		if err != nil {
+			logging.Errorf("Failed to find finished impersonations: %v", err)
+			continue
+		}
+		for _, impersonation := range impersonations {
+			if err := a.sendImpersonationNotice(ctx, impersonation); err != nil {
+				logging.Errorf("Failed to notify user %d of impersonation %d: %v", impersonation.UserID, impersonation.ID, err)
+				continue
+			}
+			if err := a.store.Impersonations.MarkNotified(ctx, impersonation.ID, time.Now()); err != nil {
+				logging.Errorf("Failed to mark impersonation %d notified: %v", impersonation.ID, err)
+			}
+		}
+	}
+}
+
+// sendImpersonationNotice emails a user about an impersonation of them that
+// is over. Users who deleted their account since have nobody to tell.
+func (a *App) sendImpersonationNotice(ctx context.Context, impersonation models.Impersonation) error {
+	user, err := a.store.Users.Get(ctx, impersonation.UserID)
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %v", err)
+	}
+	ended := impersonation.ExpiresAt
+	if impersonation.EndedAt != nil {
+		ended = *impersonation.EndedAt
+	}
+
+	const layout = "2 January 2006 at 15:04 UTC"
+	return a.sendNotification(ctx, models.Notification{
+		UserID:  user.ID,
+		Channel: channelEmail,
+		Kind:    notificationSecurityAlert,
+		To:      user.Email,
+		Subject: "A PhoneSaver administrator accessed your account",
+		Body: fmt.Sprintf(
+			"Hi,\n\nA PhoneSaver administrator accessed your account from %s to %s to look into an issue:\n\n%s\n\n"+
+				"%d requests were made as you. Each is listed in your account's audit log.\n\n-- PhoneSaver\n",
+			impersonation.CreatedAt.UTC().Format(layout), ended.UTC().Format(layout), impersonation.Reason, impersonation.Requests,
+		),
+	})
+}
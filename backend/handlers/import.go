@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+const (
+	importFormatArchive = "archive"
+	importFormatVCard   = "vcard"
+	importFormatCSV     = "csv"
+)
+
+// ImportBackup restores the user's contacts from an uploaded file. The file
+// may be sent as the raw request body or as the "file" field of a multipart
+// form, and may be an exported archive, a vCard file, or a CSV file.
+func (a *App) ImportBackup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	mode, ok := parseRestoreMode(c)
+	if !ok {
+		return
+	}
+
+	data, filename, err := readImportFile(c)
+	if err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			middleware.RespondBodyTooLarge(c, a.cfg.MaxUploadBytes)
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	format := detectImportFormat(c.Query("format"), c.ContentType(), filename, data)
+
+	var contacts []models.Contact
+	skipped := 0
+	switch format {
+	case importFormatArchive:
+		passphrase, ok := archivePassphrase(c)
+		if !ok {
+			return
+		}
+		archive, err := decryptArchive(data, passphrase)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   "Failed to decrypt backup archive. Check the passphrase and file",
+			})
+			return
+		}
+		contacts = archive.Contacts
+	case importFormatVCard:
+		contacts, skipped = parseVCards(data)
+	case importFormatCSV:
+		contacts, skipped, err = parseContactsCSV(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Invalid CSV file: %v", err),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "format",
+				Message: "Format must be one of archive, vcard or csv",
+			},
+		})
+		return
+	}
+
+	if !a.allowContacts(c, userID.(int), len(contacts), mode == services.RestoreModeReplace, "Failed to import contacts") {
+		return
+	}
+
+	plan, err := a.applyRestore(c.Request.Context(), userID.(int), mode, contacts)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to import contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to import contacts",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditImport, map[string]string{
+		"format":   format,
+		"mode":     mode,
+		"contacts": strconv.Itoa(len(contacts)),
+	}))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"message":        "Contacts imported successfully",
+			"format":         format,
+			"contacts_count": len(contacts),
+			"skipped":        skipped,
+			"plan":           plan,
+		},
+	})
+}
+
+// readImportFile returns the uploaded file and its name, if known. Multipart
+// uploads are spooled to a temporary file rather than buffered with the rest
+// of the form.
+func readImportFile(c *gin.Context) ([]byte, string, error) {
+	if c.ContentType() != "multipart/form-data" {
+		data, err := io.ReadAll(c.Request.Body)
+		return data, "", err
+	}
+
+	f, filename, cleanup, err := middleware.SpoolFormFile(c, "file")
+	if err != nil {
+		return nil, "", err
+	}
+	defer cleanup()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, filename, nil
+}
+
+// detectImportFormat picks the import format from an explicit format
+// parameter, the content type, the file extension, or the content itself
+func detectImportFormat(format, contentType, filename string, data []byte) string {
+	if format != "" {
+		return format
+	}
+
+	switch contentType {
+	case "text/vcard", "text/x-vcard":
+		return importFormatVCard
+	case "text/csv":
+		return importFormatCSV
+	}
+
+	lowerName := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lowerName, ".psbk"):
+		return importFormatArchive
+	case strings.HasSuffix(lowerName, ".vcf"), strings.HasSuffix(lowerName, ".vcard"):
+		return importFormatVCard
+	case strings.HasSuffix(lowerName, ".csv"):
+		return importFormatCSV
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte(archiveMagic)):
+		return importFormatArchive
+	case bytes.HasPrefix(bytes.TrimSpace(bytes.ToUpper(data[:min(len(data), 64)])), []byte("BEGIN:VCARD")):
+		return importFormatVCard
+	}
+	return importFormatCSV
+}
+
+// parseVCards extracts contacts from vCard 2.1/3.0/4.0 data. Cards without a
+// name or phone number are skipped and counted.
+func parseVCards(data []byte) ([]models.Contact, int) {
+	var contacts []models.Contact
+	skipped := 0
+
+	var current *models.Contact
+	for _, line := range unfoldVCardLines(data) {
+		name, params, value, ok := parseVCardLine(line)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				current = &models.Contact{Tags: []string{}}
+			}
+		case "END":
+			if current != nil && strings.EqualFold(value, "VCARD") {
+				if current.Name == "" && current.Phone != "" {
+					current.Name = current.Phone
+				}
+				if current.Name == "" || current.Phone == "" {
+					skipped++
+				} else {
+					contacts = append(contacts, *current)
+				}
+				current = nil
+			}
+		}
+		if current == nil {
+			continue
+		}
+
+		switch name {
+		case "FN":
+			current.Name = unescapeVCard(value)
+		case "N":
+			if current.Name == "" {
+				parts := strings.Split(value, ";")
+				given := ""
+				if len(parts) > 1 {
+					given = parts[1]
+				}
+				current.Name = strings.TrimSpace(unescapeVCard(given + " " + parts[0]))
+			}
+		case "TEL":
+			// Prefer the first number, or the one marked as preferred
+			if current.Phone == "" || strings.Contains(strings.ToUpper(params), "PREF") {
+				current.Phone = strings.TrimPrefix(value, "tel:")
+			}
+		case "BDAY":
+			current.Birthday = parseImportDate(value)
+		case "CATEGORIES":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(unescapeVCard(tag)); tag != "" {
+					current.Tags = append(current.Tags, tag)
+				}
+			}
+		}
+	}
+	return contacts, skipped
+}
+
+// unfoldVCardLines splits vCard data into logical lines, joining folded
+// continuation lines
+func unfoldVCardLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), config.MaxArchiveSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseVCardLine splits "group.NAME;PARAMS:value" into its parts
+func parseVCardLine(line string) (name, params, value string, ok bool) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", "", false
+	}
+	name, params, _ = strings.Cut(key, ";")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToUpper(strings.TrimSpace(name)), params, strings.TrimSpace(value), true
+}
+
+func unescapeVCard(value string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(value)
+}
+
+// parseContactsCSV extracts contacts from CSV data with a header row. The
+// name and phone columns are required; tags (separated by ";" or ","),
+// birthday, last_interaction, and encrypted_phone are optional.
+func parseContactsCSV(data []byte) ([]models.Contact, int, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, 0, fmt.Errorf("missing header row")
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, 0, fmt.Errorf("missing name column")
+	}
+	if _, ok := columns["phone"]; !ok {
+		return nil, 0, fmt.Errorf("missing phone column")
+	}
+
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var contacts []models.Contact
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		contact := models.Contact{
+			Name:            field(record, "name"),
+			Phone:           field(record, "phone"),
+			EncryptedPhone:  field(record, "encrypted_phone"),
+			Tags:            repository.SplitTags(strings.ReplaceAll(field(record, "tags"), ";", ",")),
+			Birthday:        parseImportDate(field(record, "birthday")),
+			LastInteraction: parseImportDate(field(record, "last_interaction")),
+		}
+		if contact.Name == "" || contact.Phone == "" {
+			skipped++
+			continue
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, skipped, nil
+}
+
+// parseImportDate accepts the date formats commonly found in vCard and CSV
+// exports, returning the zero time if none match
+func parseImportDate(value string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	// insightsWindow is the period interaction rates are averaged over
+	insightsWindow = 12 * 7 * 24 * time.Hour
+	// neglectAfter is how long without an interaction makes a contact neglected
+	neglectAfter = 90 * 24 * time.Hour
+	// neglectGapFactor flags contacts whose silence is this many times longer
+	// than their usual gap between interactions
+	neglectGapFactor = 2
+	day              = 24 * time.Hour
+	// topTagsLimit is the number of tags returned as top tags
+	topTagsLimit = 10
+)
+
+// tagStatistics counts contacts per tag, treating tags that differ only in
+// case or surrounding spaces as the same. It returns the counts keyed by tag
+// and the most used tags, most used first. Contacts without tags are not
+// counted.
+func tagStatistics(contacts []models.Contact) (map[string]int, []models.TagCount) {
+	top := countTags(contacts)
+	stats := make(map[string]int, len(top))
+	for _, count := range top {
+		stats[count.Tag] = count.Count
+	}
+	if len(top) > topTagsLimit {
+		top = top[:topTagsLimit]
+	}
+	return stats, top
+}
+
+// countTags returns the number of contacts with each tag, most used first.
+// Tags that differ only in case or surrounding spaces are counted together.
+func countTags(contacts []models.Contact) []models.TagCount {
+	counts := make(map[string]*models.TagCount)
+	for _, contact := range contacts {
+		seen := make(map[string]bool, len(contact.Tags))
+		for _, tag := range contact.Tags {
+			tag = strings.TrimSpace(tag)
+			key := strings.ToLower(tag)
+			if tag == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if counts[key] == nil {
+				counts[key] = &models.TagCount{Tag: tag}
+			}
+			counts[key].Count++
+		}
+	}
+
+	tags := make([]models.TagCount, 0, len(counts))
+	for _, count := range counts {
+		tags = append(tags, *count)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
+
+// loadInteractions returns all of a user's interactions, oldest first
+func (a *App) loadInteractions(ctx context.Context, userID interface{}) ([]models.Interaction, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT id, contact_id, type, occurred_at FROM interactions WHERE user_id = ? ORDER BY occurred_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []models.Interaction
+	for rows.Next() {
+		var interaction models.Interaction
+		if err := rows.Scan(&interaction.ID, &interaction.ContactID, &interaction.Type, &interaction.Timestamp); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, rows.Err()
+}
+
+// computeInteractionInsights derives frequency statistics from interactions,
+// which must be sorted oldest first
+func computeInteractionInsights(contacts []models.Contact, interactions []models.Interaction, now time.Time) models.InteractionInsights {
+	insights := models.InteractionInsights{
+		Stats:     models.InteractionStats{Total: len(interactions), ByType: map[string]int{}},
+		Contacts:  []models.ContactFrequency{},
+		Neglected: []models.NeglectedContact{},
+	}
+	windowStart := now.Add(-insightsWindow)
+	weeks := insightsWindow.Hours() / (7 * 24)
+
+	byContact := make(map[int][]models.Interaction)
+	var days []int64
+	var recent, recentCalls int
+	for _, interaction := range interactions {
+		insights.Stats.ByType[interaction.Type]++
+		byContact[interaction.ContactID] = append(byContact[interaction.ContactID], interaction)
+		days = append(days, dayNumber(interaction.Timestamp))
+		if interaction.Timestamp.After(windowStart) {
+			recent++
+			if interaction.Type == interactionCall {
+				recentCalls++
+			}
+		}
+	}
+	insights.Stats.PerWeek = round2(float64(recent) / weeks)
+	insights.Stats.CallsPerWeek = round2(float64(recentCalls) / weeks)
+	insights.Stats.LongestStreakDays, insights.Stats.CurrentStreakDays = streaks(days, dayNumber(now))
+
+	for _, contact := range contacts {
+		history := byContact[contact.ID]
+		if len(history) == 0 {
+			insights.Neglected = append(insights.Neglected, models.NeglectedContact{
+				ContactID: contact.ID,
+				Name:      contact.Name,
+				Reason:    "No interactions recorded",
+			})
+			continue
+		}
+
+		frequency := models.ContactFrequency{
+			ContactID:    contact.ID,
+			Name:         contact.Name,
+			Interactions: len(history),
+		}
+		var recent, recentCalls int
+		var weekNumbers []int64
+		for _, interaction := range history {
+			weekNumbers = append(weekNumbers, dayNumber(interaction.Timestamp)/7)
+			if interaction.Timestamp.After(windowStart) {
+				recent++
+				if interaction.Type == interactionCall {
+					recentCalls++
+				}
+			}
+		}
+		frequency.PerWeek = round2(float64(recent) / weeks)
+		frequency.CallsPerWeek = round2(float64(recentCalls) / weeks)
+		frequency.LongestStreakWeeks, _ = streaks(weekNumbers, dayNumber(now)/7)
+
+		last := history[len(history)-1].Timestamp
+		since := int(now.Sub(last) / day)
+		frequency.LastInteraction = &last
+		frequency.DaysSince = &since
+		if len(history) > 1 {
+			gap := last.Sub(history[0].Timestamp) / time.Duration(len(history)-1)
+			frequency.AverageGapDays = round2(gap.Hours() / 24)
+		}
+		insights.Contacts = append(insights.Contacts, frequency)
+
+		switch {
+		case now.Sub(last) > neglectAfter:
+			insights.Neglected = append(insights.Neglected, models.NeglectedContact{
+				ContactID: contact.ID,
+				Name:      contact.Name,
+				DaysSince: frequency.DaysSince,
+				Reason:    "No interaction in over 90 days",
+			})
+		case frequency.AverageGapDays >= 1 && float64(since) > neglectGapFactor*frequency.AverageGapDays:
+			insights.Neglected = append(insights.Neglected, models.NeglectedContact{
+				ContactID: contact.ID,
+				Name:      contact.Name,
+				DaysSince: frequency.DaysSince,
+				Reason:    "Much longer than usual since the last interaction",
+			})
+		}
+	}
+
+	sort.SliceStable(insights.Contacts, func(i, j int) bool {
+		return insights.Contacts[i].Interactions > insights.Contacts[j].Interactions
+	})
+	// Contacts never interacted with come first, then the longest silences
+	sort.SliceStable(insights.Neglected, func(i, j int) bool {
+		a, b := insights.Neglected[i].DaysSince, insights.Neglected[j].DaysSince
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return *a > *b
+	})
+	return insights
+}
+
+// dayNumber returns the number of whole UTC days since the Unix epoch
+func dayNumber(t time.Time) int64 {
+	return int64(math.Floor(float64(t.Unix()) / 86400))
+}
+
+// streaks returns the longest run of consecutive values in sorted, and the
+// run ending at current or the period before it
+func streaks(sorted []int64, current int64) (longest, ongoing int) {
+	run := 0
+	var prev int64
+	for i, n := range sorted {
+		switch {
+		case i > 0 && n == prev:
+			continue
+		case i > 0 && n == prev+1:
+			run++
+		default:
+			run = 1
+		}
+		prev = n
+		longest = max(longest, run)
+	}
+	if len(sorted) > 0 && prev >= current-1 {
+		ongoing = run
+	}
+	return longest, ongoing
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// GetInsights returns contact insights
+func (a *App) GetInsights(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	interval := c.DefaultQuery("interval", trendIntervalMonth)
+	if interval != trendIntervalMonth && interval != trendIntervalWeek {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "interval",
+				Message: "Interval must be week or month",
+			},
+		})
+		return
+	}
+
+	// Get total contacts
+	totalContacts, err := a.store.Contacts.Count(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get total contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get insights",
+		})
+		return
+	}
+
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts for insights: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get insights",
+		})
+		return
+	}
+
+	// Get contacts by tag, splitting the comma-joined tags column
+	tagStats, topTags := tagStatistics(contacts)
+
+	interactions, err := a.loadInteractions(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load interactions for insights: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get insights",
+		})
+		return
+	}
+
+	// Get contacts and interactions over time
+	now := time.Now().UTC()
+	trends, err := a.loadTrends(c.Request.Context(), userID, interactions, interval, now)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load trends for insights: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get insights",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"total_contacts": totalContacts,
+			"tag_stats":      tagStats,
+			"top_tags":       topTags,
+			"interactions":   computeInteractionInsights(contacts, interactions, now),
+			"trends": map[string]interface{}{
+				"interval": interval,
+				"points":   trends,
+			},
+		},
+	})
+}
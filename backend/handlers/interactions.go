@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	interactionCall    = "call"
+	interactionSMS     = "sms"
+	interactionMeeting = "meeting"
+	interactionOther   = "other"
+)
+
+// maxInteractionSkew is how far in the future an interaction timestamp may be,
+// to allow for clock differences between devices and the server
+const maxInteractionSkew = 5 * time.Minute
+
+const (
+	defaultInteractionLimit = 50
+	maxInteractionLimit     = 200
+)
+
+// recordInteraction stores an interaction with one of the user's contacts and
+// updates the contact's last interaction. It returns sql.ErrNoRows if the
+// contact does not exist.
+func (a *App) recordInteraction(ctx context.Context, userID int, contactID int, interaction models.Interaction) (models.Interaction, error) {
+	note, noteVersion, err := a.store.SealNote(ctx, userID, repository.InteractionNote, interaction.Note)
+	if err != nil {
+		return interaction, fmt.Errorf("failed to seal note: %v", err)
+	}
+	tx, err := a.store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return interaction, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	// Lock the contact so concurrent interactions derive the same result
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM contacts WHERE id = ? AND user_id = ?"+a.store.ForUpdate(), contactID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return interaction, err
+	}
+	if err != nil {
+		tx.Rollback()
+		return interaction, fmt.Errorf("failed to verify contact ownership: %v", err)
+	}
+
+	interaction.ContactID = contactID
+	interaction.CreatedAt = time.Now().UTC()
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO interactions (user_id, contact_id, type, occurred_at, note, note_key_version, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, contactID, interaction.Type, interaction.Timestamp, note, noteVersion, interaction.CreatedAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return interaction, fmt.Errorf("failed to record interaction: %v", err)
+	}
+	interactionID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return interaction, fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	interaction.ID = int(interactionID)
+
+	if err := refreshLastInteraction(ctx, tx, contactID); err != nil {
+		tx.Rollback()
+		return interaction, err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return interaction, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return interaction, nil
+}
+
+// refreshLastInteraction derives a contact's last interaction from its latest
+// recorded interaction
+func refreshLastInteraction(ctx context.Context, tx *sql.Tx, contactID int) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE contacts SET last_interaction = (SELECT MAX(occurred_at) FROM interactions WHERE contact_id = ?), version = version + 1
+		WHERE id = ?`,
+		contactID, contactID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update last interaction: %v", err)
+	}
+	return nil
+}
+
+// publishContactUpdated notifies the user's devices of a change made outside
+// the contact update handlers
+func (a *App) publishContactUpdated(ctx context.Context, userID, contactID int, deviceID string) {
+	contact, err := a.store.Contacts.Get(ctx, userID, contactID)
+	if err != nil {
+		logging.Errorf("Failed to load contact for change event: %v", err)
+		return
+	}
+	a.publish(userID, models.ContactEvent{Type: eventContactUpdated, ContactID: contact.ID, Contact: contactResponse(contact), DeviceID: deviceID})
+}
+
+// interactionRequest is the body of a request to record an interaction
+type interactionRequest struct {
+	Type      string    `json:"type" binding:"required,oneof=call sms meeting other"`
+	Timestamp time.Time `json:"timestamp"`
+	Note      string    `json:"note" binding:"max=2000"`
+}
+
+// CreateInteraction records an interaction with a contact
+func (a *App) CreateInteraction(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	var req interactionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if req.Timestamp.IsZero() {
+		req.Timestamp = time.Now().UTC()
+	}
+	if req.Timestamp.After(time.Now().Add(maxInteractionSkew)) {
+		respondValidation(c, models.ValidationError{Field: "timestamp", Message: "Timestamp cannot be in the future"})
+		return
+	}
+
+	interaction, err := a.recordInteraction(c.Request.Context(), userID.(int), contactID, models.Interaction{
+		Type:      req.Type,
+		Timestamp: req.Timestamp.UTC(),
+		Note:      req.Note,
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to record interaction: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to record interaction",
+		})
+		return
+	}
+
+	a.publishContactUpdated(c.Request.Context(), userID.(int), contactID, c.GetString("device_id"))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    interaction,
+	})
+}
+
+// GetInteractions lists the interactions with a contact, newest first
+func (a *App) GetInteractions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+
+	exists, err := a.store.Contacts.Exists(c.Request.Context(), userID.(int), contactID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to verify contact ownership: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify contact",
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	var occurredAt time.Time
+	var interactionID int
+	page, ok := parseListPage(c, defaultInteractionLimit, maxInteractionLimit, &occurredAt, &interactionID)
+	if !ok {
+		return
+	}
+	var total int
+	err = a.store.DB.QueryRowContext(c.Request.Context(),
+		"SELECT COUNT(*) FROM interactions WHERE contact_id = ? AND user_id = ?", contactID, userID,
+	).Scan(&total)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count interactions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch interactions",
+		})
+		return
+	}
+	condition, args := page.Condition(true, "occurred_at", "id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		"SELECT id, contact_id, type, occurred_at, note, note_key_version, call_direction, call_duration, created_at FROM interactions WHERE contact_id = ? AND user_id = ? AND "+
+			condition+" ORDER BY occurred_at DESC, id DESC"+limit,
+		append(append([]interface{}{contactID, userID}, args...), limitArgs...)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch interactions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch interactions",
+		})
+		return
+	}
+	defer rows.Close()
+
+	interactions := []models.Interaction{}
+	for rows.Next() {
+		var interaction models.Interaction
+		var note sql.NullString
+		var noteVersion sql.NullInt64
+		if err := rows.Scan(
+			&interaction.ID, &interaction.ContactID, &interaction.Type, &interaction.Timestamp, &note, &noteVersion,
+			&interaction.Direction, &interaction.Duration, &interaction.CreatedAt,
+		); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan interaction: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch interactions",
+			})
+			return
+		}
+		if interaction.Note, err = a.store.OpenNote(c.Request.Context(), userID.(int), repository.InteractionNote, note.String, noteVersion); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to open interaction note: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch interactions",
+			})
+			return
+		}
+		interactions = append(interactions, interaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating interactions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch interactions",
+		})
+		return
+	}
+
+	next := ""
+	if len(interactions) == page.Limit {
+		last := interactions[len(interactions)-1]
+		next = listCursor(last.Timestamp, last.ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    interactions,
+	})
+}
+
+// DeleteInteraction removes a recorded interaction and re-derives the
+// contact's last interaction
+func (a *App) DeleteInteraction(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Interaction not found",
+		})
+		return
+	}
+	interactionID := c.Param("interactionId")
+
+	tx, err := a.store.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to start transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete interaction",
+		})
+		return
+	}
+
+	result, err := tx.ExecContext(c.Request.Context(),
+		"DELETE FROM interactions WHERE id = ? AND contact_id = ? AND user_id = ?",
+		interactionID, contactID, userID,
+	)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err == nil && rows > 0 {
+		err = refreshLastInteraction(c.Request.Context(), tx, contactID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		middleware.RequestLogger(c).Errorf("Failed to delete interaction: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete interaction",
+		})
+		return
+	}
+
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Interaction not found",
+		})
+		return
+	}
+
+	a.publishContactUpdated(c.Request.Context(), userID.(int), contactID, c.GetString("device_id"))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Interaction deleted successfully",
+	})
+}
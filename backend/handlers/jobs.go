@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	jobTypeBackup      = "backup"
+	jobTypeRestore     = "restore"
+	jobTypeReencrypt   = "reencrypt"
+	jobTypeContactSync = "contact_sync"
+)
+
+var (
+	// runningJobs tracks background jobs so shutdown can wait for them
+	runningJobs sync.WaitGroup
+	// jobsCtx is the context jobs run with, cancelled if they outlast the
+	// shutdown timeout
+	jobsCtx, cancelJobs = context.WithCancel(context.Background())
+	// shuttingDown is closed when shutdown starts, so long-lived connections
+	// such as WebSockets can close
+	shuttingDown = make(chan struct{})
+)
+
+// jobFunc is the work performed by a job. Its result is stored as JSON.
+type jobFunc func(ctx context.Context, progress progressFunc) (interface{}, error)
+
+// startJob records a new job and runs fn in the background
+func (a *App) startJob(ctx context.Context, userID int, jobType string, fn jobFunc) (*models.Job, error) {
+	var running bool
+	err := a.store.DB.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM jobs WHERE user_id = ? AND type = ? AND status = 'running')",
+		userID, jobType,
+	).Scan(&running)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check running jobs: %v", err)
+	}
+	if running {
+		return nil, &models.CustomError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("A %s job is already running", jobType),
+		}
+	}
+
+	now := time.Now().UTC()
+	job := &models.Job{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Type:      jobType,
+		Status:    "running",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	_, err = a.store.DB.ExecContext(ctx,
+		"INSERT INTO jobs (id, user_id, type, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		job.ID, job.UserID, job.Type, job.Status, job.CreatedAt, job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %v", err)
+	}
+
+	runningJobs.Add(1)
+	go a.runJob(job, fn)
+	return job, nil
+}
+
+// runJob executes a job and records its outcome
+func (a *App) runJob(job *models.Job, fn jobFunc) {
+	defer runningJobs.Done()
+
+	progress := func(done, total int) {
+		_, err := a.store.DB.ExecContext(jobsCtx,
+			"UPDATE jobs SET progress = ?, total = ?, updated_at = ? WHERE id = ?",
+			done, total, time.Now().UTC(), job.ID,
+		)
+		if err != nil {
+			logging.Errorf("Failed to update progress of job %s: %v", job.ID, err)
+		}
+	}
+
+	result, err := fn(jobsCtx, progress)
+
+	status, message := "completed", sql.NullString{}
+	var resultJSON []byte
+	if err != nil {
+		logging.Errorf("Job %s (%s) failed: %v", job.ID, job.Type, err)
+		status = "failed"
+		message = sql.NullString{String: fmt.Sprintf("The %s failed", job.Type), Valid: true}
+		var customErr *models.CustomError
+		if errors.As(err, &customErr) {
+			message.String = customErr.Message
+		} else if jobsCtx.Err() != nil {
+			message.String = "Interrupted by a server shutdown"
+		}
+	} else if resultJSON, err = json.Marshal(result); err != nil {
+		logging.Errorf("Failed to encode result of job %s: %v", job.ID, err)
+	}
+
+	// The outcome is recorded even if the job was cancelled by shutdown
+	now := time.Now().UTC()
+	_, err = a.store.DB.ExecContext(context.Background(),
+		"UPDATE jobs SET status = ?, error = ?, result = ?, updated_at = ?, completed_at = ? WHERE id = ?",
+		status, message, resultJSON, now, now, job.ID,
+	)
+	if err != nil {
+		logging.Errorf("Failed to record outcome of job %s: %v", job.ID, err)
+	}
+}
+
+// FailInterruptedJobs marks jobs left running by a previous process as failed
+func (a *App) FailInterruptedJobs() error {
+	now := time.Now().UTC()
+	_, err := a.store.DB.ExecContext(context.Background(),
+		"UPDATE jobs SET status = 'failed', error = 'Interrupted by a server restart', updated_at = ?, completed_at = ? WHERE status = 'running'",
+		now, now,
+	)
+	return err
+}
+
+// startJobResponse starts a job and responds with 202 and the job
+func (a *App) startJobResponse(c *gin.Context, userID int, jobType string, fn jobFunc) {
+	job, err := a.startJob(c.Request.Context(), userID, jobType, fn)
+	if err != nil {
+		respondError(c, err, "Failed to start job")
+		return
+	}
+
+	location := "/api/jobs/" + job.ID
+	if org := c.Param("org"); org != "" {
+		location = "/api/orgs/" + org + "/jobs/" + job.ID
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusAccepted, models.Response{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// respondError writes the response for an error returned by business logic.
+// A *CustomError is reported as is; other errors are logged and reported
+// with the fallback message.
+func respondError(c *gin.Context, err error, fallback string) {
+	var customErr *models.CustomError
+	if errors.As(err, &customErr) {
+		c.JSON(customErr.Code, models.Response{
+			Success: false,
+			Error:   customErr.Message,
+		})
+		return
+	}
+
+	middleware.RequestLogger(c).Errorf("%s: %v", fallback, err)
+	c.JSON(http.StatusInternalServerError, models.Response{
+		Success: false,
+		Error:   fallback,
+	})
+}
+
+// GetJob returns the status of one of the user's jobs
+func (a *App) GetJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	jobID := c.Param("id")
+
+	var job models.Job
+	var message sql.NullString
+	var result []byte
+	var completedAt sql.NullTime
+	err := a.store.DB.QueryRowContext(c.Request.Context(),
+		"SELECT id, user_id, type, status, progress, total, error, result, created_at, updated_at, completed_at FROM jobs WHERE id = ? AND user_id = ?",
+		jobID, userID,
+	).Scan(
+		&job.ID, &job.UserID, &job.Type, &job.Status, &job.Progress, &job.Total, &message, &result,
+		&job.CreatedAt, &job.UpdatedAt, &completedAt,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Job not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get job: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get job",
+		})
+		return
+	}
+
+	job.Error = message.String
+	if len(result) > 0 {
+		job.Result = result
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// BeginShutdown tells long-lived connections the server is shutting down
+func BeginShutdown() {
+	close(shuttingDown)
+}
+
+// WaitForJobs waits for running background jobs to finish, returning false
+// if ctx is done first
+func WaitForJobs(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CancelJobs cancels the context of running background jobs
+func CancelJobs() {
+	cancelJobs()
+}
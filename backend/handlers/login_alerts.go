@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// revokeLoginPage asks the user to confirm signing out a login they don't
+// recognise, or tells them it is done. It posts back to its own URL, which
+// carries the token.
+var revokeLoginPage = template.Must(template.New("revoke-login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>PhoneSaver sign-in</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Confirm}}<form method="post"><button type="submit">Sign it out</button></form>{{end}}
+</body>
+</html>
+`))
+
+// revokeLoginView is what revokeLoginPage shows
+type revokeLoginView struct {
+	Title   string
+	Message string
+	Confirm bool
+}
+
+// sendLoginAlert tells a user that their account was just signed in to from
+// a new device or network, by email with a link that signs the login out,
+// and by push on their other devices
+func (a *App) sendLoginAlert(c *gin.Context, session services.Session, deviceName string) error {
+	ctx := c.Request.Context()
+	token, err := a.authService.IssueLoginRevocationToken(session)
+	if err != nil {
+		return fmt.Errorf("failed to issue revocation token: %v", err)
+	}
+	if deviceName == "" {
+		deviceName = "an unnamed device"
+	}
+	what := "a new device"
+	if !session.NewDevice {
+		what = "a new location"
+	}
+
+	if devices, err := a.pushToUser(ctx, session.UserID, session.DeviceID, PushMessage{
+		Title: "New sign-in to PhoneSaver",
+		Body:  fmt.Sprintf("Your account was signed in to from %s. Check your email if this wasn't you.", what),
+		Data:  map[string]string{"kind": notificationSecurityAlert},
+	}); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to push login alert to %d devices: %v", devices, err)
+	}
+
+	return a.sendNotification(ctx, models.Notification{
+		UserID:  session.UserID,
+		Channel: channelEmail,
+		Kind:    notificationSecurityAlert,
+		To:      session.Email,
+		Subject: "New sign-in to your PhoneSaver account",
+		Body: fmt.Sprintf(
+			"Hi,\n\nYour PhoneSaver account was signed in to from %s on %s, using %s from %s.\n\n"+
+				"If this was you, there's nothing to do. If it wasn't, sign it out with the link below, then change your password:\n\n%s\n\n"+
+				"The link works for 7 days.\n\n-- PhoneSaver\n",
+			what, time.Now().UTC().Format("2 January 2006 at 15:04 UTC"), deviceName, c.ClientIP(),
+			absoluteURL(c, "/api/auth/revoke-login?token="+url.QueryEscape(token)),
+		),
+	})
+}
+
+// GetRevokeLogin shows the page a new-login alert links to, which asks the
+// user to confirm signing the login out. Nothing is changed until they do,
+// so a mail scanner following the link is harmless.
+func (a *App) GetRevokeLogin(c *gin.Context) {
+	a.renderRevokeLogin(c, http.StatusOK, revokeLoginView{
+		Title:   "Sign out this sign-in?",
+		Message: "If you didn't just sign in to PhoneSaver, sign that session out, then change your password.",
+		Confirm: true,
+	})
+}
+
+// RevokeLogin signs out the login a new-login alert was sent for, revoking
+// its refresh tokens and forgetting its device
+func (a *App) RevokeLogin(c *gin.Context) {
+	session, err := a.authService.RevokeLogin(c.Request.Context(), c.Query("token"))
+	if err == services.ErrInvalidRevocationToken {
+		a.renderRevokeLogin(c, http.StatusBadRequest, revokeLoginView{
+			Title:   "This link doesn't work",
+			Message: "The link has expired or is invalid. Sign in and review your devices, or change your password.",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to revoke login: %v", err)
+		a.renderRevokeLogin(c, http.StatusInternalServerError, revokeLoginView{
+			Title:   "Something went wrong",
+			Message: "The sign-in could not be signed out. Please try the link again.",
+		})
+		return
+	}
+
+	event := newAuditEvent(c, session.UserID, auditLoginRevoked, nil)
+	event.DeviceID = session.DeviceID
+	a.audit(c.Request.Context(), event)
+
+	a.renderRevokeLogin(c, http.StatusOK, revokeLoginView{
+		Title:   "Signed out",
+		Message: "That sign-in can no longer be renewed, and its device has been removed. Change your password to keep it out.",
+	})
+}
+
+// renderRevokeLogin responds with revokeLoginPage showing view
+func (a *App) renderRevokeLogin(c *gin.Context, status int, view revokeLoginView) {
+	var page bytes.Buffer
+	if err := revokeLoginPage.Execute(&page, view); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to render revoke login page: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
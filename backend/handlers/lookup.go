@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// lookupResponse is who a phone number belongs to, for caller ID
+type lookupResponse struct {
+	// Phone is the number looked up, without formatting
+	Phone      string                 `json:"phone"`
+	Matches    []lookupMatch          `json:"matches"`
+	Reputation models.PhoneReputation `json:"reputation"`
+}
+
+// lookupMatch is a contact with the phone number looked up. Organization is
+// set for the contacts of an organization's shared address book.
+type lookupMatch struct {
+	Organization *lookupOrganization    `json:"organization,omitempty"`
+	Contact      models.ContactResponse `json:"contact"`
+}
+
+// lookupOrganization names the organization a matching contact is shared in
+type lookupOrganization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// LookupPhone returns the user's contacts with the phone number in ?phone=,
+// ignoring formatting, for call-screening clients that show who is calling.
+// With ?orgs=true the contacts of the organizations the user is a member of
+// are included, those shared with them if they are a member rather than an
+// owner or admin. Numbers are matched by their blind index, so a lookup is
+// one indexed query per address book. The reputation tells whether the
+// user blocked the number, and for numbers no contact has, whether the spam
+// reputation provider reports it.
+func (a *App) LookupPhone(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	phone := repository.NormalizePhone(c.Query("phone"))
+	if phone == "" {
+		respondValidation(c, models.ValidationError{Field: "phone", Message: "Phone is required"})
+		return
+	}
+
+	contacts, err := a.store.Contacts.FindByPhone(c.Request.Context(), userID.(int), phone)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to look up phone number: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to look up phone number",
+		})
+		return
+	}
+	matches := make([]lookupMatch, 0, len(contacts))
+	for _, contact := range contacts {
+		matches = append(matches, lookupMatch{Contact: models.NewContactResponse(contact)})
+	}
+
+	if c.Query("orgs") == "true" {
+		shared, err := a.lookupOrganizations(c.Request.Context(), userID.(int), phone)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to look up phone number in organizations: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to look up phone number",
+			})
+			return
+		}
+		matches = append(matches, shared...)
+	}
+
+	reputation, err := a.phoneReputation(c, userID.(int), phone, len(matches) == 0)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to check phone number reputation: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to look up phone number",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    lookupResponse{Phone: phone, Matches: matches, Reputation: reputation},
+	})
+}
+
+// lookupOrganizations returns the contacts with a phone number in the
+// address books of the organizations a user is a member of, that they may
+// read
+func (a *App) lookupOrganizations(ctx context.Context, userID int, phone string) ([]lookupMatch, error) {
+	orgs, err := a.store.Organizations.ListByMember(ctx, userID, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %v", err)
+	}
+	matches := []lookupMatch{}
+	for _, org := range orgs {
+		contacts, err := a.store.Contacts.FindByPhone(ctx, org.AccountID, phone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up contacts of organization %d: %v", org.ID, err)
+		}
+		if len(contacts) == 0 {
+			continue
+		}
+		if org.Role == repository.RoleMember {
+			permissions, err := a.store.ContactPermissions.List(ctx, org.ID, userID, repository.Page{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to load permissions: %v", err)
+			}
+			contacts = contactAccess{restricted: true, permissions: permissions}.readable(contacts)
+		}
+		for _, contact := range contacts {
+			matches = append(matches, lookupMatch{
+				Organization: &lookupOrganization{ID: org.ID, Name: org.Name},
+				Contact:      models.NewContactResponse(contact),
+			})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+)
+
+// EmailMessage is a plain text email
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email through a configured provider
+type Mailer interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+// newMailer creates the mailer selected by MAIL_PROVIDER. Without a provider
+// emails are only logged.
+func newMailer(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailProvider {
+	case "", "log":
+		return logMailer{}, nil
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+			return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM must be set for the smtp mail provider")
+		}
+		var auth smtp.Auth
+		if cfg.SMTPUser != "" {
+			auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPHost)
+		}
+		return &smtpMailer{
+			addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+			auth: auth,
+			from: cfg.SMTPFrom,
+		}, nil
+	case "sendgrid":
+		if cfg.SendGridAPIKey == "" || cfg.SMTPFrom == "" {
+			return nil, fmt.Errorf("SENDGRID_API_KEY and SMTP_FROM must be set for the sendgrid mail provider")
+		}
+		return &sendgridMailer{
+			apiKey: cfg.SendGridAPIKey,
+			from:   cfg.SMTPFrom,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.MailProvider)
+	}
+}
+
+// logMailer writes emails to the log instead of sending them
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, msg EmailMessage) error {
+	logging.Infof("Email to %s: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// smtpMailer sends email through an SMTP relay
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg EmailMessage) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(b.String())); err != nil {
+		// 5xx replies are permanent, such as an unknown recipient
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return permanent(fmt.Errorf("failed to send email: %v", err))
+		}
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// sendgridMailer sends email through the SendGrid v3 API
+type sendgridMailer struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+type sendgridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendgridPersonalization struct {
+	To []sendgridAddress `json:"to"`
+}
+
+type sendgridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendgridRequest struct {
+	Personalizations []sendgridPersonalization `json:"personalizations"`
+	From             sendgridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendgridContent         `json:"content"`
+}
+
+func (m *sendgridMailer) Send(ctx context.Context, msg EmailMessage) error {
+	payload := sendgridRequest{
+		Personalizations: []sendgridPersonalization{{To: []sendgridAddress{{Email: msg.To}}}},
+		From:             sendgridAddress{Email: m.from},
+		Subject:          msg.Subject,
+		Content:          []sendgridContent{{Type: "text/plain", Value: msg.Body}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.sendgrid.com/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("failed to send email: SendGrid returned %s", resp.Status)
+		if !retryableStatus(resp.StatusCode) {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	// Embed the time zone database so user time zones work on hosts without one
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	digestOff    = "off"
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// defaultNotificationSettings returns the settings of users who have not
+// saved any
+func (a *App) defaultNotificationSettings() models.NotificationSettings {
+	return models.NotificationSettings{
+		ReminderPush:      true,
+		Digest:            digestOff,
+		DigestEmail:       true,
+		ReminderHour:      a.cfg.ReminderHour,
+		BirthdayDaysAhead: birthdayReminderDays,
+		QuietHours:        models.QuietHours{Start: 22, End: 7},
+		Timezone:          "UTC",
+	}
+}
+
+// loadLocation returns the named time zone, falling back to UTC for names
+// the server does not know
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// userLocation returns a user's time zone
+func (a *App) userLocation(ctx context.Context, userID interface{}) (*time.Location, error) {
+	var name string
+	err := a.store.DB.QueryRowContext(ctx, "SELECT timezone FROM notification_settings WHERE user_id = ?", userID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadLocation(name), nil
+}
+
+// dateOf returns the calendar date of t in its location as midnight UTC, the
+// form dates are compared and stored in
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// notificationSchedule is when a user receives scheduled notifications
+type notificationSchedule struct {
+	hour  int
+	quiet models.QuietHours
+	loc   *time.Location
+}
+
+// due reports whether the user's reminder hour has passed and they are not in
+// their quiet hours, and returns the user's local date
+func (s notificationSchedule) due(now time.Time) (time.Time, bool) {
+	local := now.In(s.loc)
+	return dateOf(local), local.Hour() >= s.hour && !s.quiet.Contains(local.Hour())
+}
+
+// loadNotificationSettings returns a user's settings, or the defaults if the
+// user has not saved any
+func (a *App) loadNotificationSettings(ctx context.Context, userID interface{}) (models.NotificationSettings, error) {
+	settings := a.defaultNotificationSettings()
+	var reminderHour sql.NullInt64
+	err := a.store.DB.QueryRowContext(ctx,
+		`SELECT birthday_email, birthday_push, birthday_sms, birthday_slack, sms_number, reminder_email, reminder_push, reminder_sms,
+		digest, digest_email, digest_slack, slack_webhook_url, slack_bot_token, slack_channel,
+		reminder_hour, birthday_days_ahead, quiet_hours_enabled, quiet_hours_start, quiet_hours_end, timezone
+		FROM notification_settings WHERE user_id = ?`,
+		userID,
+	).Scan(
+		&settings.BirthdayEmail, &settings.BirthdayPush, &settings.BirthdaySMS, &settings.BirthdaySlack, &settings.SMSNumber,
+		&settings.ReminderEmail, &settings.ReminderPush, &settings.ReminderSMS,
+		&settings.Digest, &settings.DigestEmail, &settings.DigestSlack,
+		&settings.Slack.WebhookURL, &settings.Slack.BotToken, &settings.Slack.Channel,
+		&reminderHour, &settings.BirthdayDaysAhead,
+		&settings.QuietHours.Enabled, &settings.QuietHours.Start, &settings.QuietHours.End, &settings.Timezone,
+	)
+	if err == sql.ErrNoRows {
+		return a.defaultNotificationSettings(), nil
+	}
+	if reminderHour.Valid {
+		settings.ReminderHour = int(reminderHour.Int64)
+	}
+	return settings, err
+}
+
+// validateNotificationSettings checks the rules between settings that their
+// binding tags can't express, returning the first invalid field
+func validateNotificationSettings(s models.NotificationSettings) *models.ValidationError {
+	switch {
+	case (s.BirthdaySMS || s.ReminderSMS) && s.SMSNumber == "":
+		return &models.ValidationError{Field: "sms_number", Message: "An SMS number is required for SMS reminders"}
+	case s.Slack.WebhookURL != "" && !strings.HasPrefix(s.Slack.WebhookURL, slackWebhookPrefix):
+		return &models.ValidationError{Field: "slack.webhook_url", Message: "Webhook URL must be a Slack incoming webhook"}
+	case s.Slack.BotToken != "" && !strings.HasPrefix(s.Slack.BotToken, slackBotTokenPrefix):
+		return &models.ValidationError{Field: "slack.bot_token", Message: "Bot token must be a Slack bot token"}
+	case s.Slack.WebhookURL != "" && s.Slack.BotToken != "":
+		return &models.ValidationError{Field: "slack", Message: "Set either a webhook URL or a bot token, not both"}
+	case s.Slack.BotToken != "" && s.Slack.Channel == "":
+		return &models.ValidationError{Field: "slack.channel", Message: "A channel is required to post with a bot token"}
+	case (s.BirthdaySlack || s.DigestSlack) && s.Slack.WebhookURL == "" && s.Slack.BotToken == "":
+		return &models.ValidationError{Field: "slack", Message: "A Slack webhook URL or bot token is required for Slack notifications"}
+	case s.QuietHours.Enabled && s.QuietHours.Start == s.QuietHours.End:
+		return &models.ValidationError{Field: "quiet_hours", Message: "Quiet hours must start and end at different hours"}
+	case s.QuietHours.Contains(s.ReminderHour):
+		// Reminders would otherwise never be sent
+		return &models.ValidationError{Field: "reminder_hour", Message: "Reminder hour must be outside quiet hours"}
+	}
+	return nil
+}
+
+// GetNotificationSettings returns the user's notification settings
+func (a *App) GetNotificationSettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	settings, err := a.loadNotificationSettings(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get notification settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get notification settings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    settings.Redacted(),
+	})
+}
+
+// UpdateNotificationSettings saves the user's notification settings. Fields
+// left out of the request keep their current values.
+func (a *App) UpdateNotificationSettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	settings, err := a.loadNotificationSettings(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get notification settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update notification settings",
+		})
+		return
+	}
+
+	if !bindJSON(c, &settings) {
+		return
+	}
+	if verr := validateNotificationSettings(settings); verr != nil {
+		respondValidation(c, *verr)
+		return
+	}
+
+	_, err = a.store.DB.ExecContext(c.Request.Context(),
+		`INSERT INTO notification_settings
+		(user_id, birthday_email, birthday_push, birthday_sms, birthday_slack, sms_number, reminder_email, reminder_push, reminder_sms,
+		digest, digest_email, digest_slack, slack_webhook_url, slack_bot_token, slack_channel,
+		reminder_hour, birthday_days_ahead, quiet_hours_enabled, quiet_hours_start, quiet_hours_end, timezone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) `+
+			a.store.Upsert([]string{"user_id"},
+				"birthday_email", "birthday_push", "birthday_sms", "birthday_slack", "sms_number", "reminder_email", "reminder_push", "reminder_sms",
+				"digest", "digest_email", "digest_slack", "slack_webhook_url", "slack_bot_token", "slack_channel",
+				"reminder_hour", "birthday_days_ahead", "quiet_hours_enabled", "quiet_hours_start", "quiet_hours_end", "timezone"),
+		userID, settings.BirthdayEmail, settings.BirthdayPush, settings.BirthdaySMS, settings.BirthdaySlack, settings.SMSNumber,
+		settings.ReminderEmail, settings.ReminderPush, settings.ReminderSMS,
+		settings.Digest, settings.DigestEmail, settings.DigestSlack,
+		settings.Slack.WebhookURL, settings.Slack.BotToken, settings.Slack.Channel,
+		settings.ReminderHour, settings.BirthdayDaysAhead,
+		settings.QuietHours.Enabled, settings.QuietHours.Start, settings.QuietHours.End, settings.Timezone,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update notification settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update notification settings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    settings.Redacted(),
+	})
+}
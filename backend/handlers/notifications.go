@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	channelEmail = "email"
+	channelPush  = "push"
+	channelSMS   = "sms"
+	channelSlack = "slack"
+)
+
+const (
+	notificationBirthday      = "birthday_reminder"
+	notificationDigest        = "digest"
+	notificationReminder      = "contact_reminder"
+	notificationSecurityAlert = "security_alert"
+	notificationInvite        = "organization_invite"
+)
+
+const (
+	notificationPending = "pending"
+	notificationSent    = "sent"
+	notificationFailed  = "failed"
+)
+
+const (
+	// notificationMaxAttempts is the number of delivery attempts before a
+	// notification is given up on
+	notificationMaxAttempts = 5
+	// notificationRetryBase is the delay before the first retry, doubled
+	// after each further failure
+	notificationRetryBase     = time.Minute
+	notificationRetryInterval = time.Minute
+	// notificationLease is how long an attempt may take before another
+	// instance may retry it
+	notificationLease           = 5 * time.Minute
+	defaultNotificationHistory  = 50
+	maxNotificationHistoryLimit = 200
+)
+
+// errNoPushDevices is returned for push notifications to users without any
+// device registered for push
+var errNoPushDevices = errors.New("no devices are registered for push notifications")
+
+// permanentError marks a delivery failure that retrying will not fix, such
+// as a recipient rejected by the provider
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// isPermanent reports whether err was marked with permanent
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// retryableStatus reports whether a provider's HTTP error status may succeed
+// on retry: server errors, timeouts, and rate limiting
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// sendNotification records a notification and makes the first delivery
+// attempt. Failed attempts are retried in the background, so an error is
+// only returned if the notification could not be recorded.
+func (a *App) sendNotification(ctx context.Context, n models.Notification) error {
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %v", err)
+	}
+	now := time.Now().UTC()
+	result, err := a.store.DB.ExecContext(ctx,
+		`INSERT INTO notification_deliveries
+		(user_id, channel, kind, recipient, subject, body, data, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?)`,
+		n.UserID, n.Channel, n.Kind, n.To, n.Subject, n.Body, data, notificationPending,
+		now.Add(notificationLease), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+
+	a.recordAttempt(ctx, int(id), 1, a.deliverNotification(ctx, n))
+	return nil
+}
+
+// deliverNotification sends a notification through its channel's provider
+func (a *App) deliverNotification(ctx context.Context, n models.Notification) error {
+	switch n.Channel {
+	case channelEmail:
+		return a.mailer.Send(ctx, EmailMessage{To: n.To, Subject: n.Subject, Body: n.Body})
+	case channelSMS:
+		return a.sms.Send(ctx, n.To, n.Body)
+	case channelSlack:
+		return a.postSlack(ctx, n.UserID, n.Body)
+	case channelPush:
+		devices, err := a.pushToUser(ctx, n.UserID, "", PushMessage{Title: n.Subject, Body: n.Body, Data: n.Data})
+		if err == nil && devices == 0 {
+			err = permanent(errNoPushDevices)
+		}
+		return err
+	default:
+		return permanent(fmt.Errorf("unknown notification channel %q", n.Channel))
+	}
+}
+
+// recordAttempt stores the outcome of a delivery attempt, scheduling a retry
+// with exponential backoff for transient failures
+func (a *App) recordAttempt(ctx context.Context, id, attempts int, err error) {
+	now := time.Now().UTC()
+	var dbErr error
+	switch {
+	case err == nil:
+		_, dbErr = a.store.DB.ExecContext(ctx,
+			"UPDATE notification_deliveries SET status = ?, error = NULL, next_attempt_at = NULL, sent_at = ?, updated_at = ? WHERE id = ?",
+			notificationSent, now, now, id,
+		)
+	case isPermanent(err) || attempts >= notificationMaxAttempts:
+		_, dbErr = a.store.DB.ExecContext(ctx,
+			"UPDATE notification_deliveries SET status = ?, error = ?, next_attempt_at = NULL, updated_at = ? WHERE id = ?",
+			notificationFailed, err.Error(), now, id,
+		)
+	default:
+		_, dbErr = a.store.DB.ExecContext(ctx,
+			"UPDATE notification_deliveries SET error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+			err.Error(), now.Add(notificationRetryBase<<(attempts-1)), now, id,
+		)
+	}
+	if err != nil {
+		logging.Errorf("Failed to deliver notification %d (attempt %d): %v", id, attempts, err)
+	}
+	if dbErr != nil {
+		logging.Errorf("Failed to record notification delivery: %v", dbErr)
+	}
+}
+
+// RunNotificationRetries retries failed notifications as they become due
+func (a *App) RunNotificationRetries() {
+	ticker := time.NewTicker(notificationRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := a.retryDueNotifications(context.Background()); err != nil {
+			logging.Errorf("Failed to retry notifications: %v", err)
+		}
+	}
+}
+
+// retryDueNotifications makes another attempt at every pending notification
+// whose retry is due
+func (a *App) retryDueNotifications(ctx context.Context) error {
+	now := time.Now().UTC()
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT id, user_id, channel, kind, recipient, subject, body, data, attempts FROM notification_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT 100`,
+		notificationPending, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch due notifications: %v", err)
+	}
+	type retry struct {
+		id       int
+		attempts int
+		n        models.Notification
+	}
+	var due []retry
+	for rows.Next() {
+		var r retry
+		var data []byte
+		if err := rows.Scan(
+			&r.id, &r.n.UserID, &r.n.Channel, &r.n.Kind, &r.n.To, &r.n.Subject, &r.n.Body, &data, &r.attempts,
+		); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan notification: %v", err)
+		}
+		if err := json.Unmarshal(data, &r.n.Data); err != nil {
+			logging.Errorf("Failed to decode notification %d data: %v", r.id, err)
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range due {
+		// Claim the notification so other instances don't retry it too
+		result, err := a.store.DB.ExecContext(ctx,
+			"UPDATE notification_deliveries SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ? AND status = ? AND attempts = ?",
+			now.Add(notificationLease), r.id, notificationPending, r.attempts,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim notification: %v", err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+		a.recordAttempt(ctx, r.id, r.attempts+1, a.deliverNotification(ctx, r.n))
+	}
+	return nil
+}
+
+// GetNotificationHistory lists the notifications sent to the user, newest
+// first. ?channel= filters by channel and ?limit= bounds the number returned;
+// the next page starts after ?cursor=, taken from the meta block.
+func (a *App) GetNotificationHistory(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	limit := defaultNotificationHistory
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxNotificationHistoryLimit {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "limit",
+					Message: fmt.Sprintf("Limit must be between 1 and %d", maxNotificationHistoryLimit),
+				},
+			})
+			return
+		}
+		limit = n
+	}
+
+	where := " FROM notification_deliveries WHERE user_id = ?"
+	args := []interface{}{userID}
+	if channel := c.Query("channel"); channel != "" {
+		if channel != channelEmail && channel != channelPush && channel != channelSMS && channel != channelSlack {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "channel",
+					Message: "Channel must be one of email, push, sms or slack",
+				},
+			})
+			return
+		}
+		where += " AND channel = ?"
+		args = append(args, channel)
+	}
+
+	var total int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*)"+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch notification history",
+		})
+		return
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "cursor",
+					Message: "Invalid cursor",
+				},
+			})
+			return
+		}
+		where += " AND id < ?"
+		args = append(args, cursor)
+	}
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		"SELECT id, channel, kind, recipient, subject, status, attempts, error, created_at, sent_at"+where+" ORDER BY id DESC LIMIT ?",
+		append(args, limit)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch notification history: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch notification history",
+		})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var delivery models.NotificationDelivery
+		var deliveryErr sql.NullString
+		var sentAt sql.NullTime
+		if err := rows.Scan(
+			&delivery.ID, &delivery.Channel, &delivery.Kind, &delivery.Recipient, &delivery.Subject,
+			&delivery.Status, &delivery.Attempts, &deliveryErr, &delivery.CreatedAt, &sentAt,
+		); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan notification: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch notification history",
+			})
+			return
+		}
+		delivery.Error = deliveryErr.String
+		if sentAt.Valid {
+			delivery.SentAt = &sentAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch notification history",
+		})
+		return
+	}
+
+	next := ""
+	if len(deliveries) == limit {
+		next = strconv.Itoa(deliveries[len(deliveries)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    deliveries,
+	})
+}
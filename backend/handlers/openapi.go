@@ -0,0 +1,894 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// fields describes an object returned without a named type, such as a
+// map[string]interface{} response. Each value is an example of the field's
+// type; only its type is used.
+type fields map[string]interface{}
+
+// apiParam is a query, header, or path parameter of an operation
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+	Required    bool
+}
+
+func queryParam(name, typ, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: typ, Description: description}
+}
+
+func headerParam(name, description string) apiParam {
+	return apiParam{Name: name, In: "header", Type: "string", Description: description}
+}
+
+var (
+	passphraseHeader      = headerParam("X-Backup-Passphrase", "Passphrase of encrypted backups")
+	ifMatchHeader         = headerParam("If-Match", "ETag of the contact the update is conditional on")
+	iftttServiceKeyHeader = headerParam("IFTTT-Service-Key", "Service key of the PhoneSaver service on IFTTT")
+	idempotencyKeyHeader  = headerParam("Idempotency-Key", "Unique key for the request; retries with the same key replay the first response")
+	asyncQuery            = queryParam("async", "boolean", "Run as a background job and return 202 with the job")
+	restoreModeQuery      = queryParam("mode", "string", "replace (default) or merge")
+	ifNoneMatchHeader     = headerParam("If-None-Match", "ETag of a cached copy; 304 is returned if it is still current")
+	usageDaysQuery        = queryParam("days", "integer", "Number of days up to today, at most 365 (default 30)")
+	fieldsQuery           = queryParam("fields", "string", "Comma-separated contact fields to return, such as id,name,phone; id is always included")
+	linksQuery            = queryParam("links", "boolean", "Include tel:, sms: and WhatsApp links for phone numbers in E.164 format")
+	graphQLResponse       = fields{"data": fields{}, "errors": []fields{}}
+	iftttAuthorizeParams  = []apiParam{
+		{Name: "client_id", In: "query", Type: "string", Required: true},
+		{Name: "response_type", In: "query", Type: "string", Required: true},
+		{Name: "redirect_uri", In: "query", Type: "string", Required: true},
+		queryParam("state", "string", "Returned to IFTTT with the code"),
+	}
+	providerPath = apiParam{Name: "provider", In: "path", Type: "string", Required: true, Description: "Contact provider: google or outlook"}
+)
+
+// apiOperation documents a route for the OpenAPI document. Request and
+// Response are examples of the request body and the response's data field;
+// their schemas are generated from their Go types. Routes with a ContentType
+// don't use the standard response envelope, and Response, if set, is the
+// whole body.
+type apiOperation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Public      bool
+	Params      []apiParam
+	Request     interface{}
+	Upload      bool
+	Status      int
+	Response    interface{}
+	ContentType string
+}
+
+// apiOperations documents every API route. Routes registered without an
+// entry here are reported at startup.
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/api/auth/signup", Tag: "Auth", Summary: "Create an account", Public: true,
+		Request: signupRequest{}, Response: signupResponse{}},
+	{Method: "POST", Path: "/api/auth/login", Tag: "Auth", Summary: "Log in and register the device", Public: true,
+		Request: loginRequest{}, Response: loginResponse{}},
+	{Method: "POST", Path: "/api/auth/refresh", Tag: "Auth", Summary: "Renew the access token, rotating the refresh token", Public: true,
+		Request: refreshRequest{}, Response: refreshResponse{}},
+	{Method: "GET", Path: "/api/auth/revoke-login", Tag: "Auth", Summary: "Page confirming the sign-out of a login from a new-login alert", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/auth/revoke-login", Tag: "Auth", Summary: "Sign out the login a new-login alert was sent for", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "GET", Path: "/api/auth/reset-password", Tag: "Auth", Summary: "Page asking for a new password after an admin reset it", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/auth/reset-password", Tag: "Auth", Summary: "Set the new password posted from the password reset page", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "GET", Path: "/api/invites/accept", Tag: "Organizations", Summary: "Page confirming an invitation to an organization is accepted", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/invites/accept", Tag: "Organizations", Summary: "Join an organization with the role of an invitation", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "GET", Path: "/api/invites/decline", Tag: "Organizations", Summary: "Page confirming an invitation to an organization is declined", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/invites/decline", Tag: "Organizations", Summary: "Decline an invitation to an organization", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/html"},
+
+	{Method: "GET", Path: "/api/contacts", Tag: "Contacts", Summary: "List contacts",
+		Params: []apiParam{
+			queryParam("query", "string", "Search by name or phone"),
+			queryParam("tag", "string", "Only contacts with this tag"),
+			queryParam("sort_by", "string", "name, last_interaction, or birthday"),
+			queryParam("order", "string", "asc or desc"),
+			queryParam("filter", "string", `Filter expression, such as birthday.month == 5 AND tag == "work"`),
+			queryParam("limit", "integer", "Number of contacts, at most 500"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+			fieldsQuery,
+			linksQuery,
+			ifNoneMatchHeader,
+		},
+		Response: []models.ContactResponse{}},
+	{Method: "POST", Path: "/api/contacts", Tag: "Contacts", Summary: "Create a contact",
+		Params: []apiParam{
+			queryParam("unique", "boolean", "Reject with 409 if a contact with the same phone number exists"),
+			queryParam("check_spam", "boolean", "Reject with 409 if the number is blocked or reported as spam"),
+		},
+		Request: contactRequest{}, Response: models.ContactResponse{}},
+	{Method: "GET", Path: "/api/lookup", Tag: "Contacts", Summary: "Find who a phone number belongs to, for caller ID",
+		Params: []apiParam{
+			{Name: "phone", In: "query", Type: "string", Required: true, Description: "Phone number, in any format"},
+			queryParam("orgs", "boolean", "Include the contacts of the user's organizations"),
+		},
+		Response: lookupResponse{Matches: []lookupMatch{}}},
+	{Method: "GET", Path: "/api/blocked-numbers", Tag: "Contacts", Summary: "List the phone numbers the user blocked",
+		Response: []models.BlockedNumber{}},
+	{Method: "POST", Path: "/api/blocked-numbers", Tag: "Contacts", Summary: "Block a phone number",
+		Request: blockNumberRequest{}, Status: http.StatusCreated, Response: models.BlockedNumber{}},
+	{Method: "DELETE", Path: "/api/blocked-numbers/:id", Tag: "Contacts", Summary: "Unblock a phone number", Response: ""},
+	{Method: "GET", Path: "/api/contacts/duplicates", Tag: "Contacts", Summary: "List contacts that share a phone number",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of groups, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.DuplicateContacts{}},
+	{Method: "POST", Path: "/api/contacts/bulk", Tag: "Contacts", Summary: "Create contacts in bulk, with a session or import token",
+		Request: []contactRequest{}, Response: ""},
+	{Method: "POST", Path: "/api/import/device", Tag: "Contacts", Summary: "Import an Android address book from its ContactsContract raw contacts, skipping duplicates",
+		Request: models.DeviceImport{}, Response: models.DeviceImportResult{}},
+	{Method: "POST", Path: "/api/import-tokens", Tag: "Contacts", Summary: "Create a token import tools can create contacts in bulk with",
+		Status: http.StatusCreated, Response: scopedTokenResponse{}},
+	{Method: "POST", Path: "/api/access-tokens", Tag: "Account", Summary: "Create a token limited to some scopes, for an integration",
+		Request: accessTokenRequest{}, Status: http.StatusCreated, Response: scopedTokenResponse{}},
+	{Method: "GET", Path: "/api/contacts/:id", Tag: "Contacts", Summary: "Get a contact",
+		Params: []apiParam{fieldsQuery, linksQuery, ifNoneMatchHeader}, Response: models.ContactResponse{}},
+	{Method: "PUT", Path: "/api/contacts/:id", Tag: "Contacts", Summary: "Update a contact",
+		Params: []apiParam{ifMatchHeader}, Request: contactRequest{}, Response: ""},
+	{Method: "DELETE", Path: "/api/contacts/:id", Tag: "Contacts", Summary: "Delete a contact", Response: ""},
+	{Method: "PUT", Path: "/api/contacts/:id/tags", Tag: "Contacts", Summary: "Replace a contact's tags",
+		Params: []apiParam{ifMatchHeader}, Request: models.ContactUpdate{}, Response: ""},
+	{Method: "PUT", Path: "/api/contacts/:id/last-interaction", Tag: "Contacts", Summary: "Set when a contact was last interacted with",
+		Request: models.ContactUpdate{}, Response: ""},
+	{Method: "PUT", Path: "/api/contacts/:id/birthday", Tag: "Contacts", Summary: "Set a contact's birthday",
+		Params: []apiParam{ifMatchHeader}, Request: models.ContactUpdate{}, Response: ""},
+	{Method: "POST", Path: "/api/contacts/:id/verify-phone", Tag: "Contacts", Summary: "Verify a contact's phone number with the phone verification provider",
+		Response: verifyPhoneResponse{}},
+	{Method: "POST", Path: "/api/contacts/enrich", Tag: "Contacts", Summary: "Start a job annotating contacts with their number's line type, carrier and country",
+		Params: []apiParam{queryParam("all", "boolean", "Look up contacts verified before again")},
+		Status: http.StatusAccepted, Response: models.Job{}},
+	{Method: "GET", Path: "/api/contacts/:id/profile", Tag: "Contacts", Summary: "Get a contact's email address, photo and company",
+		Response: models.ContactProfile{}},
+	{Method: "PUT", Path: "/api/contacts/:id/profile", Tag: "Contacts", Summary: "Set a contact's email address, photo and company",
+		Request: models.ContactProfileUpdate{}, Response: models.ContactProfile{}},
+	{Method: "POST", Path: "/api/contacts/:id/profile/reject", Tag: "Contacts", Summary: "Reject a photo or company suggested by contact enrichment",
+		Request: models.EnrichmentRejection{}, Response: models.ContactProfile{}},
+
+	{Method: "POST", Path: "/api/contacts/:id/interactions", Tag: "Interactions", Summary: "Record an interaction",
+		Request: interactionRequest{}, Response: models.Interaction{}},
+	{Method: "GET", Path: "/api/contacts/:id/interactions", Tag: "Interactions", Summary: "List a contact's interactions",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of interactions, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Interaction{}},
+	{Method: "DELETE", Path: "/api/contacts/:id/interactions/:interactionId", Tag: "Interactions", Summary: "Delete an interaction",
+		Response: ""},
+	{Method: "POST", Path: "/api/interactions/call-log", Tag: "Interactions", Summary: "Record the answered calls of a batch from the phone's call log",
+		Request: callLogRequest{}, Response: models.CallLogResult{}},
+
+	{Method: "POST", Path: "/api/contacts/:id/reminders", Tag: "Reminders", Summary: "Create a reminder for a contact",
+		Request: reminderRequest{}, Response: models.Reminder{}},
+	{Method: "GET", Path: "/api/contacts/:id/reminders", Tag: "Reminders", Summary: "List a contact's reminders",
+		Params: []apiParam{
+			queryParam("status", "string", "active (default) or completed"),
+			queryParam("limit", "integer", "Number of reminders, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Reminder{}},
+	{Method: "GET", Path: "/api/reminders", Tag: "Reminders", Summary: "List reminders",
+		Params: []apiParam{
+			queryParam("status", "string", "active (default) or completed"),
+			queryParam("limit", "integer", "Number of reminders, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Reminder{}},
+	{Method: "POST", Path: "/api/reminders/:id/snooze", Tag: "Reminders", Summary: "Snooze a reminder",
+		Request: snoozeRequest{}, Response: models.Reminder{}},
+	{Method: "POST", Path: "/api/reminders/:id/complete", Tag: "Reminders", Summary: "Complete a reminder",
+		Response: models.Reminder{}},
+	{Method: "DELETE", Path: "/api/reminders/:id", Tag: "Reminders", Summary: "Delete a reminder", Response: ""},
+
+	{Method: "GET", Path: "/api/insights", Tag: "Insights", Summary: "Get contact and interaction insights",
+		Params: []apiParam{queryParam("interval", "string", "Trend interval: week or month (default)")},
+		Response: fields{
+			"total_contacts": 0,
+			"tag_stats":      map[string]int{},
+			"top_tags":       []models.TagCount{},
+			"interactions":   models.InteractionInsights{},
+			"trends":         fields{"interval": "", "points": []models.TrendPoint{}},
+		}},
+	{Method: "GET", Path: "/api/insights/reconnect", Tag: "Insights", Summary: "Suggest contacts to reconnect with",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of suggestions, at most 50"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.ReconnectSuggestion{}},
+
+	{Method: "POST", Path: "/api/backup", Tag: "Backups", Summary: "Back up contacts",
+		Params:   []apiParam{passphraseHeader, queryParam("full", "boolean", "Rewrite every contact"), asyncQuery},
+		Response: fields{"message": "", "contacts_count": 0, "timestamp": time.Time{}, "manifest": models.BackupManifest{}}},
+	{Method: "GET", Path: "/api/backup", Tag: "Backups", Summary: "Restore contacts from the latest backup",
+		Params:   []apiParam{passphraseHeader, restoreModeQuery, asyncQuery},
+		Response: fields{"message": "", "plan": models.RestorePlan{}}},
+	{Method: "GET", Path: "/api/backup/preview", Tag: "Backups", Summary: "Preview a restore",
+		Params:   []apiParam{passphraseHeader, restoreModeQuery},
+		Response: fields{"backup_count": 0, "local_count": 0, "plan": models.RestorePlan{}}},
+	{Method: "DELETE", Path: "/api/backup/key", Tag: "Backups", Summary: "Disable backup encryption",
+		Params: []apiParam{passphraseHeader}, Response: ""},
+	{Method: "GET", Path: "/api/backup/export", Tag: "Backups", Summary: "Export an encrypted archive of all contacts",
+		Params: []apiParam{passphraseHeader}, ContentType: "application/octet-stream"},
+	{Method: "POST", Path: "/api/backup/import", Tag: "Backups", Summary: "Import contacts from an archive, vCard, or CSV file",
+		Params:   []apiParam{passphraseHeader, restoreModeQuery, queryParam("format", "string", "archive, vcard, or csv; detected by default")},
+		Upload:   true,
+		Response: fields{"message": "", "format": "", "contacts_count": 0, "skipped": 0, "plan": models.RestorePlan{}}},
+	{Method: "GET", Path: "/api/backups", Tag: "Backups", Summary: "List backups and quota usage",
+		Response: fields{"backups": []models.BackupManifest{}, "quota": models.BackupQuota{}}},
+	{Method: "GET", Path: "/api/backups/:id/verify", Tag: "Backups", Summary: "Verify a backup's checksum",
+		Params: []apiParam{passphraseHeader},
+		Response: fields{
+			"backup_id": 0, "valid": false, "superseded": false, "expected_count": 0, "actual_count": 0,
+			"expected_checksum": "", "actual_checksum": "",
+		}},
+	{Method: "GET", Path: "/api/backups/:id/diff", Tag: "Backups", Summary: "Compare a backup with current contacts",
+		Params: []apiParam{passphraseHeader}, Response: fields{"backup_id": 0, "diff": models.BackupDiff{}}},
+	{Method: "GET", Path: "/api/jobs/:id", Tag: "Backups", Summary: "Get the status of a background job",
+		Params: []apiParam{{Name: "id", In: "path", Type: "string", Required: true}}, Response: models.Job{}},
+
+	{Method: "GET", Path: "/api/sync", Tag: "Sync", Summary: "Get changes since a sync token",
+		Params:   []apiParam{queryParam("since", "string", "Sync token from the previous call")},
+		Response: fields{"created": []models.ContactResponse{}, "updated": []models.ContactResponse{}, "deleted": []models.Tombstone{}, "sync_token": ""}},
+	{Method: "POST", Path: "/api/sync", Tag: "Sync", Summary: "Push changes made on a device",
+		Request: pushChangesRequest{}, Response: fields{"results": []models.SyncResult{}, "conflicts": 0}},
+	{Method: "GET", Path: "/api/ws", Tag: "Sync", Summary: "Stream contact changes over a WebSocket",
+		Status: http.StatusSwitchingProtocols},
+
+	{Method: "POST", Path: "/api/graphql", Tag: "GraphQL", Summary: "Execute a GraphQL query",
+		Request:     fields{"query": "", "operationName": "", "variables": fields{}},
+		ContentType: "application/json", Response: graphQLResponse},
+	{Method: "GET", Path: "/api/graphql", Tag: "GraphQL", Summary: "Execute a GraphQL query",
+		Params: []apiParam{
+			{Name: "query", In: "query", Type: "string", Required: true},
+			queryParam("operationName", "string", ""),
+			queryParam("variables", "string", "JSON-encoded variables"),
+		},
+		ContentType: "application/json", Response: graphQLResponse},
+
+	{Method: "GET", Path: "/api/devices", Tag: "Devices", Summary: "List devices",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of devices, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Device{}},
+	{Method: "POST", Path: "/api/devices/push-token", Tag: "Devices", Summary: "Register this device's push token",
+		Request: pushTokenRequest{}, Response: ""},
+	{Method: "DELETE", Path: "/api/devices/push-token", Tag: "Devices", Summary: "Delete this device's push token",
+		Response: ""},
+
+	{Method: "GET", Path: "/api/settings/notifications", Tag: "Notifications", Summary: "Get notification settings",
+		Response: models.NotificationSettings{}},
+	{Method: "PUT", Path: "/api/settings/notifications", Tag: "Notifications", Summary: "Update notification settings",
+		Request: models.NotificationSettings{}, Response: models.NotificationSettings{}},
+	{Method: "GET", Path: "/api/notifications/history", Tag: "Notifications", Summary: "List notifications sent",
+		Params: []apiParam{
+			queryParam("channel", "string", "email, push, sms, or slack"),
+			queryParam("limit", "integer", "Number of notifications, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.NotificationDelivery{}},
+
+	{Method: "POST", Path: "/api/calendar/token", Tag: "Calendar", Summary: "Create or rotate the birthday calendar feed",
+		Response: fields{"token": "", "url": ""}},
+	{Method: "DELETE", Path: "/api/calendar/token", Tag: "Calendar", Summary: "Revoke the birthday calendar feed",
+		Response: ""},
+	{Method: "GET", Path: "/api/settings/sms-contacts", Tag: "Contacts", Summary: "Get the number to text contacts to and the phone linked to it",
+		Response: models.SMSContactSettings{}},
+	{Method: "POST", Path: "/api/settings/sms-contacts/code", Tag: "Contacts", Summary: "Create a code to text from the phone to link it",
+		Response: models.SMSLinkCode{}},
+	{Method: "DELETE", Path: "/api/settings/sms-contacts", Tag: "Contacts", Summary: "Unlink the phone contacts are texted from",
+		Response: ""},
+	{Method: "POST", Path: "/api/sms/webhook", Tag: "Contacts", Summary: "Receive the texts Twilio forwards, replying with TwiML", Public: true,
+		Params:      []apiParam{{Name: "X-Twilio-Signature", In: "header", Type: "string", Required: true}},
+		ContentType: "text/xml"},
+	{Method: "GET", Path: "/api/calendar/birthdays.ics", Tag: "Calendar", Summary: "Birthday calendar feed", Public: true,
+		Params:      []apiParam{{Name: "token", In: "query", Type: "string", Required: true}},
+		ContentType: "text/calendar"},
+
+	{Method: "POST", Path: "/api/webhooks", Tag: "Webhooks", Summary: "Register a webhook",
+		Request: webhookRequest{}, Response: models.Webhook{}},
+	{Method: "GET", Path: "/api/webhooks", Tag: "Webhooks", Summary: "List webhooks",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of webhooks, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Webhook{}},
+	{Method: "DELETE", Path: "/api/webhooks/:id", Tag: "Webhooks", Summary: "Delete a webhook", Response: ""},
+	{Method: "GET", Path: "/api/webhooks/:id/deliveries", Tag: "Webhooks", Summary: "List a webhook's deliveries",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of deliveries, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.WebhookDelivery{}},
+	{Method: "POST", Path: "/api/webhooks/:id/deliveries/:deliveryId/retry", Tag: "Webhooks", Summary: "Retry a delivery",
+		Response: ""},
+	{Method: "POST", Path: "/api/hooks/zapier", Tag: "Webhooks", Summary: "Subscribe a Zapier REST hook to a contact event",
+		Request: zapierSubscribeRequest{}, Status: http.StatusCreated, Response: zapierSubscription{}},
+	{Method: "DELETE", Path: "/api/hooks/zapier/:id", Tag: "Webhooks", Summary: "Unsubscribe a Zapier REST hook", Response: ""},
+	{Method: "GET", Path: "/api/hooks/zapier/sample", Tag: "Webhooks", Summary: "List sample payloads of a contact event, for Zapier",
+		Params:      []apiParam{{Name: "event", In: "query", Type: "string", Required: true, Description: "contact.created, contact.updated or contact.deleted"}},
+		ContentType: "application/json", Response: []zapierContact{}},
+	{Method: "GET", Path: "/api/ifttt/oauth2/authorize", Tag: "Webhooks", Summary: "Page asking a user to sign in to connect IFTTT", Public: true,
+		Params:      iftttAuthorizeParams,
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/ifttt/oauth2/authorize", Tag: "Webhooks", Summary: "Sign in from the IFTTT connect page and return to IFTTT with an authorization code", Public: true,
+		Params:      iftttAuthorizeParams,
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/ifttt/oauth2/token", Tag: "Webhooks", Summary: "Trade an IFTTT authorization code or refresh token for tokens", Public: true,
+		ContentType: "application/json", Response: iftttTokenResponse{}},
+	{Method: "GET", Path: "/api/ifttt/v1/status", Tag: "Webhooks", Summary: "Check the IFTTT service is available", Public: true,
+		Params: []apiParam{iftttServiceKeyHeader}, ContentType: "application/json", Response: fields{}},
+	{Method: "POST", Path: "/api/ifttt/v1/test/setup", Tag: "Webhooks", Summary: "Set up IFTTT's endpoint tests", Public: true,
+		Params: []apiParam{iftttServiceKeyHeader}, ContentType: "application/json", Response: fields{"data": iftttTestSetup{}}},
+	{Method: "GET", Path: "/api/ifttt/v1/user/info", Tag: "Webhooks", Summary: "Get the account connected to IFTTT",
+		Params: []apiParam{iftttServiceKeyHeader}, ContentType: "application/json", Response: fields{"data": iftttUser{}}},
+	{Method: "POST", Path: "/api/ifttt/v1/triggers/new_contact", Tag: "Webhooks", Summary: "Poll the IFTTT new contact trigger",
+		Params: []apiParam{iftttServiceKeyHeader}, Request: iftttTriggerRequest{}, ContentType: "application/json", Response: fields{"data": []iftttContact{}}},
+	{Method: "POST", Path: "/api/ifttt/v1/triggers/birthday_today", Tag: "Webhooks", Summary: "Poll the IFTTT birthday today trigger",
+		Params: []apiParam{iftttServiceKeyHeader}, Request: iftttTriggerRequest{}, ContentType: "application/json", Response: fields{"data": []iftttBirthday{}}},
+	{Method: "POST", Path: "/api/ifttt/v1/actions/create_contact", Tag: "Webhooks", Summary: "Run the IFTTT create contact action",
+		Params: []apiParam{iftttServiceKeyHeader}, Request: iftttActionRequest{}, ContentType: "application/json", Response: fields{"data": []iftttActionResult{}}},
+
+	{Method: "GET", Path: "/api/account/audit", Tag: "Account", Summary: "List security-relevant activity on the account",
+		Params: []apiParam{
+			queryParam("action", "string", "login, login_failed, calendar_token_created, calendar_token_revoked, export, import, restore, account_export, account_deletion_requested, account_deletion_cancelled, refresh_token_reused, import_token_created, access_token_created, login_revoked, privacy_changed, account_suspended, account_reactivated, password_reset_required, password_reset, or access_blocked"),
+			queryParam("limit", "integer", "Number of events, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.AuditEvent{}},
+	{Method: "GET", Path: "/api/account/export", Tag: "Account", Summary: "Download everything stored about the account",
+		ContentType: "application/json", Response: models.AccountExport{}},
+	{Method: "GET", Path: "/api/billing", Tag: "Billing", Summary: "Get the account's plan and subscription, and the plans to choose from",
+		Response: models.Billing{}},
+	{Method: "POST", Path: "/api/billing/checkout", Tag: "Billing", Summary: "Start a Stripe Checkout subscribing to the pro plan",
+		Status: http.StatusCreated, Response: fields{"url": ""}},
+	{Method: "POST", Path: "/api/billing/portal", Tag: "Billing", Summary: "Open the Stripe billing portal to manage the subscription",
+		Status: http.StatusCreated, Response: fields{"url": ""}},
+	{Method: "POST", Path: "/api/billing/webhook", Tag: "Billing", Summary: "Receive Stripe's events about subscriptions", Public: true,
+		Params: []apiParam{{Name: "Stripe-Signature", In: "header", Type: "string", Required: true}}, Response: ""},
+	{Method: "GET", Path: "/api/account/usage", Tag: "Account", Summary: "Get the account's daily API calls, storage and backups",
+		Params: []apiParam{usageDaysQuery}, Response: models.Usage{}},
+	{Method: "GET", Path: "/api/account/deletion", Tag: "Account", Summary: "Get whether the account is scheduled to be erased",
+		Response: models.AccountDeletion{}},
+	{Method: "POST", Path: "/api/account/deletion", Tag: "Account", Summary: "Schedule the account to be erased after a grace period",
+		Request: accountDeletionRequest{}, Status: http.StatusAccepted, Response: models.AccountDeletion{}},
+	{Method: "DELETE", Path: "/api/account/deletion", Tag: "Account", Summary: "Cancel the scheduled erasure of the account",
+		Response: models.AccountDeletion{}},
+	{Method: "GET", Path: "/api/settings/privacy", Tag: "Account", Summary: "Get privacy settings",
+		Response: models.PrivacySettings{}},
+	{Method: "PUT", Path: "/api/settings/privacy", Tag: "Account", Summary: "Update privacy settings, encrypting or decrypting tags and notes and opting in to contact enrichment",
+		Request: models.PrivacySettings{}, Response: models.PrivacySettings{}},
+
+	{Method: "GET", Path: "/api/integrations", Tag: "Integrations", Summary: "List the contact providers to sync with and the account's connections to them",
+		Response: integrationsResponse{Available: []string{}, Connections: []models.ContactSync{}}},
+	{Method: "POST", Path: "/api/integrations/:provider", Tag: "Integrations", Summary: "Get the provider's consent screen to connect an account at it",
+		Params: []apiParam{providerPath}, Response: connectIntegrationResponse{}},
+	{Method: "GET", Path: "/api/integrations/:provider/callback", Tag: "Integrations", Summary: "Page the provider's consent screen returns to, which connects the account and starts importing", Public: true,
+		Params: []apiParam{
+			providerPath,
+			{Name: "state", In: "query", Type: "string", Required: true},
+			queryParam("code", "string", "Authorization code granted by the provider"),
+			queryParam("error", "string", "Set by the provider if access wasn't granted"),
+		},
+		ContentType: "text/html"},
+	{Method: "POST", Path: "/api/integrations/:provider/sync", Tag: "Integrations", Summary: "Sync contacts with the provider now, as a background job",
+		Params: []apiParam{providerPath}, Status: http.StatusAccepted, Response: models.Job{}},
+	{Method: "DELETE", Path: "/api/integrations/:provider", Tag: "Integrations", Summary: "Stop syncing contacts with the provider, leaving them on both sides",
+		Params: []apiParam{providerPath}, Response: models.ContactSync{}},
+
+	{Method: "POST", Path: "/api/orgs", Tag: "Organizations", Summary: "Create an organization with a shared address book",
+		Request: organizationRequest{}, Status: http.StatusCreated, Response: models.Organization{}},
+	{Method: "GET", Path: "/api/orgs", Tag: "Organizations", Summary: "List the organizations the user is a member of",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of organizations, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.Organization{}},
+	{Method: "GET", Path: "/api/orgs/:org", Tag: "Organizations", Summary: "Get an organization",
+		Response: models.Organization{}},
+	{Method: "PUT", Path: "/api/orgs/:org", Tag: "Organizations", Summary: "Rename an organization, as an owner or admin",
+		Request: organizationRequest{}, Response: models.Organization{}},
+	{Method: "DELETE", Path: "/api/orgs/:org", Tag: "Organizations", Summary: "Delete an organization with its contacts and backups, as an owner",
+		Response: ""},
+	{Method: "GET", Path: "/api/orgs/:org/members", Tag: "Organizations", Summary: "List an organization's members",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of members, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.OrganizationMember{}},
+	{Method: "POST", Path: "/api/orgs/:org/members", Tag: "Organizations", Summary: "Add a user to an organization, as an owner or admin",
+		Request: memberRequest{}, Status: http.StatusCreated, Response: models.OrganizationMember{}},
+	{Method: "POST", Path: "/api/orgs/:org/invites", Tag: "Organizations", Summary: "Email an invitation to join an organization, as an owner or admin",
+		Request: memberRequest{}, Status: http.StatusCreated, Response: models.OrganizationInvite{}},
+	{Method: "PUT", Path: "/api/orgs/:org/members/:user", Tag: "Organizations", Summary: "Change a member's role, as an owner or admin",
+		Request: roleRequest{}, Response: models.OrganizationMember{}},
+	{Method: "DELETE", Path: "/api/orgs/:org/members/:user", Tag: "Organizations", Summary: "Remove a member, or leave the organization",
+		Response: ""},
+	{Method: "GET", Path: "/api/orgs/:org/permissions", Tag: "Organizations", Summary: "List the contacts shared with members, or with the user if they are a member",
+		Params: []apiParam{
+			queryParam("user_id", "integer", "Only those shared with this member"),
+			queryParam("limit", "integer", "Number of permissions, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.ContactPermission{}},
+	{Method: "POST", Path: "/api/orgs/:org/permissions", Tag: "Organizations", Summary: "Share a contact, or the contacts with a tag, with a member, as an owner or admin",
+		Request: permissionRequest{}, Status: http.StatusCreated, Response: models.ContactPermission{}},
+	{Method: "DELETE", Path: "/api/orgs/:org/permissions/:permission", Tag: "Organizations", Summary: "Stop sharing contacts with a member, as an owner or admin",
+		Response: ""},
+	{Method: "GET", Path: "/api/orgs/:org/contacts", Tag: "Organizations", Summary: "List an organization's contacts",
+		Params: []apiParam{
+			queryParam("query", "string", "Search by name or phone"),
+			queryParam("tag", "string", "Only contacts with this tag"),
+			queryParam("sort_by", "string", "name, last_interaction, or birthday"),
+			queryParam("order", "string", "asc or desc"),
+			queryParam("filter", "string", `Filter expression, such as birthday.month == 5 AND tag == "work"`),
+			queryParam("limit", "integer", "Number of contacts, at most 500"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+			fieldsQuery,
+			linksQuery,
+			ifNoneMatchHeader,
+		},
+		Response: []models.ContactResponse{}},
+	{Method: "GET", Path: "/api/orgs/:org/contacts/duplicates", Tag: "Organizations", Summary: "List an organization's contacts that share a phone number",
+		Params: []apiParam{
+			queryParam("limit", "integer", "Number of groups, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.DuplicateContacts{}},
+	{Method: "GET", Path: "/api/orgs/:org/contacts/:id", Tag: "Organizations", Summary: "Get an organization's contact",
+		Params: []apiParam{fieldsQuery, linksQuery, ifNoneMatchHeader}, Response: models.ContactResponse{}},
+	{Method: "POST", Path: "/api/orgs/:org/contacts", Tag: "Organizations", Summary: "Create a contact in an organization",
+		Params: []apiParam{
+			queryParam("unique", "boolean", "Reject with 409 if a contact with the same phone number exists"),
+			queryParam("check_spam", "boolean", "Reject with 409 if the number is blocked or reported as spam"),
+		},
+		Request: contactRequest{}, Response: models.ContactResponse{}},
+	{Method: "PUT", Path: "/api/orgs/:org/contacts/:id", Tag: "Organizations", Summary: "Update an organization's contact",
+		Params: []apiParam{ifMatchHeader}, Request: contactRequest{}, Response: ""},
+	{Method: "DELETE", Path: "/api/orgs/:org/contacts/:id", Tag: "Organizations", Summary: "Delete an organization's contact", Response: ""},
+	{Method: "PUT", Path: "/api/orgs/:org/contacts/:id/tags", Tag: "Organizations", Summary: "Replace the tags of an organization's contact",
+		Params: []apiParam{ifMatchHeader}, Request: models.ContactUpdate{}, Response: ""},
+	{Method: "PUT", Path: "/api/orgs/:org/contacts/:id/birthday", Tag: "Organizations", Summary: "Set the birthday of an organization's contact",
+		Params: []apiParam{ifMatchHeader}, Request: models.ContactUpdate{}, Response: ""},
+	{Method: "POST", Path: "/api/orgs/:org/contacts/:id/verify-phone", Tag: "Organizations", Summary: "Verify the phone number of an organization's contact",
+		Response: verifyPhoneResponse{}},
+	{Method: "POST", Path: "/api/orgs/:org/contacts/enrich", Tag: "Organizations", Summary: "Start a job annotating an organization's contacts with their number's line type, carrier and country, as an owner or admin",
+		Params: []apiParam{queryParam("all", "boolean", "Look up contacts verified before again")},
+		Status: http.StatusAccepted, Response: models.Job{}},
+	{Method: "POST", Path: "/api/orgs/:org/backup", Tag: "Organizations", Summary: "Back up an organization's contacts",
+		Params:   []apiParam{passphraseHeader, queryParam("full", "boolean", "Rewrite every contact"), asyncQuery},
+		Response: fields{"message": "", "contacts_count": 0, "timestamp": time.Time{}, "manifest": models.BackupManifest{}}},
+	{Method: "GET", Path: "/api/orgs/:org/backup", Tag: "Organizations", Summary: "Restore an organization's contacts from its latest backup, as an owner or admin",
+		Params:   []apiParam{passphraseHeader, restoreModeQuery, asyncQuery},
+		Response: fields{"message": "", "plan": models.RestorePlan{}}},
+	{Method: "GET", Path: "/api/orgs/:org/backup/preview", Tag: "Organizations", Summary: "Preview a restore of an organization's contacts, as an owner or admin",
+		Params:   []apiParam{passphraseHeader, restoreModeQuery},
+		Response: fields{"backup_count": 0, "local_count": 0, "plan": models.RestorePlan{}}},
+	{Method: "GET", Path: "/api/orgs/:org/backups", Tag: "Organizations", Summary: "List an organization's backups and quota usage",
+		Response: fields{"backups": []models.BackupManifest{}, "quota": models.BackupQuota{}}},
+	{Method: "GET", Path: "/api/orgs/:org/backups/:id/verify", Tag: "Organizations", Summary: "Verify an organization's backup",
+		Params: []apiParam{passphraseHeader},
+		Response: fields{
+			"backup_id": 0, "valid": false, "superseded": false, "expected_count": 0, "actual_count": 0,
+			"expected_checksum": "", "actual_checksum": "",
+		}},
+	{Method: "GET", Path: "/api/orgs/:org/jobs/:id", Tag: "Organizations", Summary: "Get the status of an organization's background job",
+		Params: []apiParam{{Name: "id", In: "path", Type: "string", Required: true}}, Response: models.Job{}},
+	{Method: "GET", Path: "/api/orgs/:org/audit", Tag: "Organizations", Summary: "List activity on an organization, as an owner or admin",
+		Params: []apiParam{
+			queryParam("action", "string", "member_added, member_role_changed, member_removed, restore, and the other actions of the account audit log"),
+			queryParam("limit", "integer", "Number of events, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.AuditEvent{}},
+	{Method: "GET", Path: "/api/orgs/:org/export", Tag: "Organizations", Summary: "Download the organization's contacts, members' access and activity, as an owner",
+		ContentType: "application/json", Response: models.OrganizationExport{}},
+
+	{Method: "GET", Path: "/api/admin/encryption", Tag: "Admin", Summary: "Get the data key versions and re-encryption progress",
+		Response: models.EncryptionStatus{}},
+	{Method: "POST", Path: "/api/admin/encryption/rotate", Tag: "Admin", Summary: "Rotate the data key and re-encrypt contacts to it",
+		Status: http.StatusAccepted, Response: models.Job{}},
+	{Method: "POST", Path: "/api/admin/encryption/reencrypt", Tag: "Admin", Summary: "Re-encrypt contacts to the newest data key",
+		Status: http.StatusAccepted, Response: models.Job{}},
+	{Method: "GET", Path: "/api/admin/users", Tag: "Admin", Summary: "List accounts",
+		Params: []apiParam{
+			queryParam("email", "string", "Part of the email"),
+			queryParam("status", "string", "active or suspended"),
+			queryParam("limit", "integer", "Number of accounts, at most 200"),
+			queryParam("cursor", "string", "next_cursor of the previous page"),
+		},
+		Response: []models.AdminUser{}},
+	{Method: "GET", Path: "/api/admin/users/:id", Tag: "Admin", Summary: "Get an account",
+		Response: models.AdminUser{}},
+	{Method: "POST", Path: "/api/admin/users/:id/suspend", Tag: "Admin", Summary: "Suspend an account and sign it out everywhere",
+		Response: models.AdminUser{}},
+	{Method: "POST", Path: "/api/admin/users/:id/reactivate", Tag: "Admin", Summary: "Lift the suspension of an account",
+		Response: models.AdminUser{}},
+	{Method: "POST", Path: "/api/admin/users/:id/password-reset", Tag: "Admin", Summary: "Discard an account's password and email its owner a link to choose a new one",
+		Response: models.AdminUser{}},
+	{Method: "GET", Path: "/api/admin/users/:id/usage", Tag: "Admin", Summary: "Get an account's daily usage",
+		Params: []apiParam{usageDaysQuery}, Response: models.Usage{}},
+	{Method: "POST", Path: "/api/admin/users/:id/impersonate", Tag: "Admin", Summary: "Get a time-limited token that acts as a user, to debug an issue of theirs",
+		Request: impersonationRequest{}, Status: http.StatusCreated, Response: impersonationResponse{}},
+	{Method: "POST", Path: "/api/admin/impersonations/:id/end", Tag: "Admin", Summary: "End an impersonation before it expires",
+		Response: models.Impersonation{}},
+
+	{Method: "GET", Path: "/api/openapi.json", Tag: "Docs", Summary: "This OpenAPI document", Public: true,
+		ContentType: "application/json"},
+	{Method: "GET", Path: "/api/docs", Tag: "Docs", Summary: "Swagger UI", Public: true, ContentType: "text/html"},
+
+	{Method: "GET", Path: "/healthz", Tag: "Health", Summary: "Check the process is up", Public: true,
+		Response: models.HealthReport{}},
+	{Method: "GET", Path: "/readyz", Tag: "Health", Summary: "Check MySQL and Firestore are reachable; 503 if not",
+		Public: true, Response: models.HealthReport{}},
+}
+
+// openAPIDocument is the generated OpenAPI document, built by LoadOpenAPI
+// once the routes are registered
+var openAPIDocument []byte
+
+// LoadOpenAPI builds the OpenAPI document served by GetOpenAPI
+func LoadOpenAPI(routes gin.RoutesInfo) error {
+	document, err := buildOpenAPI(routes)
+	if err != nil {
+		return fmt.Errorf("failed to build OpenAPI document: %v", err)
+	}
+	openAPIDocument = document
+	return nil
+}
+
+// buildOpenAPI generates the OpenAPI 3 document for the registered routes,
+// warning about routes missing from apiOperations
+func buildOpenAPI(routes gin.RoutesInfo) ([]byte, error) {
+	documented := make(map[string]bool, len(apiOperations))
+	for _, op := range apiOperations {
+		documented[op.Method+" "+op.Path] = true
+	}
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, "/api/") && !documented[route.Method+" "+route.Path] {
+			logging.Warnf("Route %s %s is missing from the OpenAPI document", route.Method, route.Path)
+		}
+	}
+
+	g := &schemaGenerator{components: map[string]interface{}{}}
+	g.components["ValidationError"] = g.schema(reflect.TypeOf(models.ValidationError{}))
+	g.components["Meta"] = g.schema(reflect.TypeOf(models.Meta{}))
+	g.components["ErrorResponse"] = fields{
+		"type": "object",
+		"properties": fields{
+			"meta":    fields{"$ref": "#/components/schemas/Meta"},
+			"success": fields{"type": "boolean"},
+			"error": fields{"oneOf": []interface{}{
+				fields{"type": "string"},
+				fields{"$ref": "#/components/schemas/ValidationError"},
+			}},
+		},
+	}
+
+	paths := map[string]fields{}
+	for _, op := range apiOperations {
+		path, params := openAPIPath(op)
+		if paths[path] == nil {
+			paths[path] = fields{}
+		}
+		paths[path][strings.ToLower(op.Method)] = g.operation(op, params)
+	}
+
+	return json.MarshalIndent(fields{
+		"openapi": "3.0.3",
+		"info": fields{
+			"title":   "PhoneSaver API",
+			"version": middleware.APIVersion,
+		},
+		"paths": paths,
+		"components": fields{
+			"schemas": g.components,
+			"securitySchemes": fields{
+				"bearerAuth": fields{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}, "", "  ")
+}
+
+// openAPIPath converts a gin path to OpenAPI form, returning its path
+// parameters. Path parameters are integers unless declared in op.Params.
+func openAPIPath(op apiOperation) (string, []apiParam) {
+	var params []apiParam
+	segments := strings.Split(op.Path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		declared := false
+		for _, p := range op.Params {
+			declared = declared || (p.In == "path" && p.Name == name)
+		}
+		if !declared {
+			params = append(params, apiParam{Name: name, In: "path", Type: "integer", Required: true})
+		}
+	}
+	return strings.Join(segments, "/"), append(params, op.Params...)
+}
+
+// operation returns the OpenAPI operation object for op
+func (g *schemaGenerator) operation(op apiOperation, params []apiParam) fields {
+	operation := fields{
+		"tags":    []string{op.Tag},
+		"summary": op.Summary,
+	}
+	if !op.Public {
+		operation["security"] = []fields{{"bearerAuth": []string{}}}
+	}
+
+	if op.Method == http.MethodPost && !op.Public {
+		params = append(params, idempotencyKeyHeader)
+	}
+	var parameters []fields
+	for _, p := range params {
+		parameter := fields{
+			"name":   p.Name,
+			"in":     p.In,
+			"schema": fields{"type": p.Type},
+		}
+		if p.Required {
+			parameter["required"] = true
+		}
+		if p.Description != "" {
+			parameter["description"] = p.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+	if parameters != nil {
+		operation["parameters"] = parameters
+	}
+
+	switch {
+	case op.Upload:
+		file := fields{"type": "string", "format": "binary"}
+		operation["requestBody"] = fields{
+			"required": true,
+			"content": fields{
+				"multipart/form-data": fields{"schema": fields{
+					"type":       "object",
+					"properties": fields{"file": file},
+				}},
+				"application/octet-stream": fields{"schema": file},
+			},
+		}
+	case op.Request != nil:
+		operation["requestBody"] = fields{
+			"required": true,
+			"content":  fields{"application/json": fields{"schema": g.valueSchema(op.Request)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := fields{"description": http.StatusText(status)}
+	switch {
+	case op.ContentType != "":
+		schema := fields{"type": "string"}
+		if op.ContentType == "application/octet-stream" {
+			schema["format"] = "binary"
+		}
+		if op.Response != nil {
+			schema = g.valueSchema(op.Response)
+		}
+		response["content"] = fields{op.ContentType: fields{"schema": schema}}
+	case status != http.StatusSwitchingProtocols:
+		data := fields{}
+		if op.Response != nil {
+			data = g.valueSchema(op.Response)
+		}
+		response["content"] = fields{"application/json": fields{"schema": fields{
+			"type": "object",
+			"properties": fields{
+				"meta":    fields{"$ref": "#/components/schemas/Meta"},
+				"success": fields{"type": "boolean"},
+				"data":    data,
+			},
+		}}}
+	}
+	operation["responses"] = fields{
+		strconv.Itoa(status): response,
+		"default": fields{
+			"description": "Error",
+			"content": fields{"application/json": fields{"schema": fields{
+				"$ref": "#/components/schemas/ErrorResponse",
+			}}},
+		},
+	}
+	return operation
+}
+
+// schemaGenerator generates JSON schemas from Go types, collecting exported
+// struct types as reusable components
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// valueSchema returns the schema of an example value
+func (g *schemaGenerator) valueSchema(v interface{}) fields {
+	if f, ok := v.(fields); ok {
+		properties := fields{}
+		for name, value := range f {
+			properties[name] = g.valueSchema(value)
+		}
+		return fields{"type": "object", "properties": properties}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+// schema returns the schema of a type as encoded by encoding/json
+func (g *schemaGenerator) schema(t reflect.Type) fields {
+	switch t {
+	case timeType:
+		return fields{"type": "string", "format": "date-time"}
+	case rawJSONType:
+		return fields{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return fields{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fields{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return fields{"type": "number"}
+	case reflect.String:
+		return fields{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fields{"type": "string", "format": "byte"}
+		}
+		return fields{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return fields{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" || !token.IsExported(name) {
+			return g.structSchema(t)
+		}
+		if _, ok := g.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.components[name] = nil
+			g.components[name] = g.structSchema(t)
+		}
+		return fields{"$ref": "#/components/schemas/" + name}
+	}
+	return fields{}
+}
+
+// structSchema returns the object schema of a struct's JSON fields. Fields
+// with a required binding are marked required.
+func (g *schemaGenerator) structSchema(t reflect.Type) fields {
+	properties := fields{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := g.structSchema(field.Type)
+			for k, v := range embedded["properties"].(fields) {
+				properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			if rule == "required" {
+				required = append(required, name)
+			}
+		}
+	}
+
+	schema := fields{"type": "object", "properties": properties}
+	if required != nil {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// GetOpenAPI serves the OpenAPI document
+func (a *App) GetOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
+
+// swaggerUIScript starts Swagger UI on the docs page
+const swaggerUIScript = `
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+    };
+  `
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>PhoneSaver API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>` + swaggerUIScript + `</script>
+</body>
+</html>
+`
+
+// swaggerUIPolicy is the Content-Security-Policy of the docs page, which
+// unlike the JSON API loads Swagger UI's assets and runs its start script
+var swaggerUIPolicy = func() string {
+	sum := sha256.Sum256([]byte(swaggerUIScript))
+	return "default-src 'none'; script-src https://unpkg.com 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src https://unpkg.com 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+}()
+
+// GetSwaggerUI serves Swagger UI for the OpenAPI document
+func (a *App) GetSwaggerUI(c *gin.Context) {
+	if a.cfg.SecureHeaders && a.cfg.CSPPolicy != "" {
+		c.Header("Content-Security-Policy", swaggerUIPolicy)
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
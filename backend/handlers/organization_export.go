@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// organizationExportVersion is bumped whenever the layout of the
+// organization export changes
+const organizationExportVersion = 1
+
+// ExportOrganization returns everything the organization keeps as a JSON
+// document, downloaded as a file, for its owners' compliance records or to
+// take the address book elsewhere when offboarding: the contacts, each
+// member with the contacts their permissions let them work with, and the
+// members' activity in the audit log
+func (a *App) ExportOrganization(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+
+	export, err := a.exportOrganization(c.Request.Context(), org)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to export organization: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to export organization",
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, org.AccountID, auditOrganizationExport, map[string]string{
+		"contacts": strconv.Itoa(len(export.Contacts)),
+		"members":  strconv.Itoa(len(export.Members)),
+	}))
+
+	filename := fmt.Sprintf("phonesaver-organization-%d-%s.json", org.ID, export.ExportedAt.Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, export)
+}
+
+// exportOrganization collects an organization's data for ExportOrganization
+func (a *App) exportOrganization(ctx context.Context, org models.Organization) (models.OrganizationExport, error) {
+	export := models.OrganizationExport{Version: organizationExportVersion, ExportedAt: time.Now().UTC()}
+
+	var err error
+	if export.Organization, err = a.store.Organizations.Get(ctx, org.ID); err != nil {
+		return export, fmt.Errorf("failed to load organization: %v", err)
+	}
+	contacts, err := a.store.Contacts.ListAll(ctx, org.AccountID)
+	if err != nil {
+		return export, fmt.Errorf("failed to load contacts: %v", err)
+	}
+	export.Contacts = models.NewContactResponses(contacts)
+	if export.Permissions, err = a.store.ContactPermissions.List(ctx, org.ID, 0, repository.Page{}); err != nil {
+		return export, fmt.Errorf("failed to load permissions: %v", err)
+	}
+
+	members, err := a.store.Organizations.ListMembers(ctx, org.ID, repository.Page{})
+	if err != nil {
+		return export, fmt.Errorf("failed to load members: %v", err)
+	}
+	export.Members = make([]models.OrganizationMemberExport, 0, len(members))
+	for _, member := range members {
+		export.Members = append(export.Members, models.OrganizationMemberExport{
+			OrganizationMember: member,
+			Contacts:           memberContactAccess(member, export.Permissions, contacts),
+		})
+	}
+
+	if export.AuditLog, err = a.exportAuditLog(ctx, org.AccountID); err != nil {
+		return export, fmt.Errorf("failed to load audit log: %v", err)
+	}
+	return export, nil
+}
+
+// memberContactAccess lists the contacts a member may work with and how,
+// by the same rules as the organization's contact routes
+func memberContactAccess(member models.OrganizationMember, permissions []models.ContactPermission, contacts []models.Contact) []models.MemberContactAccess {
+	access := contactAccess{restricted: member.Role == repository.RoleMember}
+	for _, permission := range permissions {
+		if permission.UserID == member.UserID {
+			access.permissions = append(access.permissions, permission)
+		}
+	}
+
+	shared := []models.MemberContactAccess{}
+	for _, contact := range contacts {
+		switch {
+		case access.allows(contact, repository.AccessWrite):
+			shared = append(shared, models.MemberContactAccess{ContactID: contact.ID, Access: repository.AccessWrite})
+		case access.allows(contact, repository.AccessRead):
+			shared = append(shared, models.MemberContactAccess{ContactID: contact.ID, Access: repository.AccessRead})
+		}
+	}
+	return shared
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+// inviteLifetime is how long the link in an invitation to an organization
+// works
+const inviteLifetime = 7 * 24 * time.Hour
+
+// invitePage asks an invitee to confirm accepting or declining an invitation
+// to an organization, or tells them how that went. It posts back to its own
+// URL, which carries the token.
+var invitePage = template.Must(template.New("invite").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>PhoneSaver invitation</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Button}}<form method="post"><button type="submit">{{.Button}}</button></form>{{end}}
+</body>
+</html>
+`))
+
+// inviteView is what invitePage shows. The confirmation form is shown with
+// Button as its label if it is set.
+type inviteView struct {
+	Title   string
+	Message string
+	Button  string
+}
+
+// invalidInviteView is shown for links that don't answer an invitation
+var invalidInviteView = inviteView{
+	Title:   "This link doesn't work",
+	Message: "The invitation has expired, was already answered, or was replaced by a newer one. Ask the organization for a new invitation.",
+}
+
+// InviteOrganizationMember emails an invitation to join an organization with
+// a role, which the link in it accepts or declines. Inviting the same email
+// again replaces the invitation. Only owners can invite owners.
+func (a *App) InviteOrganizationMember(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	var req memberRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !canGrantRole(c, org, req.Role) {
+		return
+	}
+
+	user, err := a.store.Users.GetByEmail(c.Request.Context(), req.Email)
+	if err == nil {
+		_, err = a.store.Organizations.Member(c.Request.Context(), org.ID, user.ID)
+		if err == nil {
+			c.JSON(http.StatusConflict, models.Response{
+				Success: false,
+				Error:   "This user is already a member",
+			})
+			return
+		}
+	}
+	if err != nil && err != repository.ErrNotFound {
+		middleware.RequestLogger(c).Errorf("Failed to check membership: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to invite member",
+		})
+		return
+	}
+
+	invite := models.OrganizationInvite{
+		OrganizationID: org.ID,
+		Email:          req.Email,
+		Role:           req.Role,
+		InvitedBy:      userID.(int),
+		ExpiresAt:      time.Now().Add(inviteLifetime).UTC().Truncate(time.Second),
+	}
+	if err := a.store.Organizations.CreateInvite(c.Request.Context(), &invite); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create invite: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to invite member",
+		})
+		return
+	}
+	a.auditInvite(c, org, auditMemberInvited, invite, userID.(int))
+
+	if err := a.sendInviteEmail(c, org, invite); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to send invite email: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to send the invitation",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    invite,
+	})
+}
+
+// sendInviteEmail emails an invitee the links that accept and decline their
+// invitation. The email is recorded with the organization's notifications,
+// as the invitee may not have an account yet.
+func (a *App) sendInviteEmail(c *gin.Context, org models.Organization, invite models.OrganizationInvite) error {
+	token, err := a.authService.IssueInviteToken(invite.ID, invite.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to issue invite token: %v", err)
+	}
+	query := "?token=" + url.QueryEscape(token)
+	return a.sendNotification(c.Request.Context(), models.Notification{
+		UserID:  org.AccountID,
+		Channel: channelEmail,
+		Kind:    notificationInvite,
+		To:      invite.Email,
+		Subject: fmt.Sprintf("You're invited to join %s on PhoneSaver", org.Name),
+		Body: fmt.Sprintf(
+			"Hi,\n\nYou've been invited to join %s on PhoneSaver as %s, to share its address book.\n\n"+
+				"Accept the invitation, after signing up with this email if you haven't:\n\n%s\n\n"+
+				"Or decline it:\n\n%s\n\nThe links work for 7 days.\n\n-- PhoneSaver\n",
+			org.Name, invite.Role,
+			absoluteURL(c, "/api/invites/accept"+query),
+			absoluteURL(c, "/api/invites/decline"+query),
+		),
+	})
+}
+
+// GetAcceptInvite shows the page an invitation links to, which asks the
+// invitee to confirm joining the organization. Nothing is changed until they
+// do, so a mail scanner following the link is harmless.
+func (a *App) GetAcceptInvite(c *gin.Context) {
+	invite, org, ok := a.loadInvite(c)
+	if !ok {
+		return
+	}
+	a.renderInvite(c, http.StatusOK, inviteView{
+		Title:   fmt.Sprintf("Join %s?", org.Name),
+		Message: fmt.Sprintf("You were invited to share the address book of %s on PhoneSaver as %s, with the account of %s.", org.Name, invite.Role, invite.Email),
+		Button:  "Join",
+	})
+}
+
+// AcceptInvite adds the user registered with an invitation's email to the
+// organization, with the role they were invited as
+func (a *App) AcceptInvite(c *gin.Context) {
+	invite, org, ok := a.loadInvite(c)
+	if !ok {
+		return
+	}
+
+	user, err := a.store.Users.GetByEmail(c.Request.Context(), invite.Email)
+	if err == repository.ErrNotFound {
+		a.renderInvite(c, http.StatusConflict, inviteView{
+			Title:   "Sign up first",
+			Message: fmt.Sprintf("Sign up to PhoneSaver with %s, then follow the link in the invitation again.", invite.Email),
+		})
+		return
+	}
+	if err == nil {
+		err = a.store.Organizations.AddMember(c.Request.Context(), org.ID, user.ID, invite.Role)
+	}
+	if err != nil && err != repository.ErrDuplicate {
+		middleware.RequestLogger(c).Errorf("Failed to accept invite: %v", err)
+		a.renderInvite(c, http.StatusInternalServerError, inviteView{
+			Title:   "Something went wrong",
+			Message: "The invitation could not be accepted. Please try the link again.",
+			Button:  "Join",
+		})
+		return
+	}
+	added := err == nil
+	if _, err := a.store.Organizations.DeleteInvite(c.Request.Context(), invite.ID); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete invite: %v", err)
+	}
+	// The new member added themselves
+	if added {
+		a.auditMember(c, org, auditMemberAdded, user.ID, invite.Role, user.ID)
+	}
+
+	a.renderInvite(c, http.StatusOK, inviteView{
+		Title:   fmt.Sprintf("You're a member of %s", org.Name),
+		Message: "Sign in to PhoneSaver to work with its contacts.",
+	})
+}
+
+// GetDeclineInvite shows the page an invitation links to for declining it,
+// which asks the invitee to confirm
+func (a *App) GetDeclineInvite(c *gin.Context) {
+	_, org, ok := a.loadInvite(c)
+	if !ok {
+		return
+	}
+	a.renderInvite(c, http.StatusOK, inviteView{
+		Title:   "Decline the invitation?",
+		Message: fmt.Sprintf("You won't join %s on PhoneSaver. It can invite you again.", org.Name),
+		Button:  "Decline",
+	})
+}
+
+// DeclineInvite discards an invitation, so its link no longer works
+func (a *App) DeclineInvite(c *gin.Context) {
+	invite, org, ok := a.loadInvite(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := a.store.Organizations.DeleteInvite(c.Request.Context(), invite.ID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to decline invite: %v", err)
+		a.renderInvite(c, http.StatusInternalServerError, inviteView{
+			Title:   "Something went wrong",
+			Message: "The invitation could not be declined. Please try the link again.",
+			Button:  "Decline",
+		})
+		return
+	}
+	// Another request answered it first
+	if !deleted {
+		a.renderInvite(c, http.StatusBadRequest, invalidInviteView)
+		return
+	}
+	a.auditInvite(c, org, auditInviteDeclined, invite, 0)
+
+	a.renderInvite(c, http.StatusOK, inviteView{
+		Title:   "Invitation declined",
+		Message: fmt.Sprintf("You won't join %s.", org.Name),
+	})
+}
+
+// loadInvite returns the invitation the token in the request answers and its
+// organization, responding with invitePage if there is none
+func (a *App) loadInvite(c *gin.Context) (models.OrganizationInvite, models.Organization, bool) {
+	inviteID, err := a.authService.ParseInviteToken(c.Query("token"))
+	if err == services.ErrInvalidInviteToken {
+		a.renderInvite(c, http.StatusBadRequest, invalidInviteView)
+		return models.OrganizationInvite{}, models.Organization{}, false
+	}
+
+	invite, err := a.store.Organizations.GetInvite(c.Request.Context(), inviteID)
+	var org models.Organization
+	if err == nil {
+		org, err = a.store.Organizations.Get(c.Request.Context(), invite.OrganizationID)
+	}
+	if err == repository.ErrNotFound {
+		a.renderInvite(c, http.StatusBadRequest, invalidInviteView)
+		return invite, org, false
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load invite: %v", err)
+		a.renderInvite(c, http.StatusInternalServerError, inviteView{
+			Title:   "Something went wrong",
+			Message: "The invitation could not be loaded. Please try the link again.",
+		})
+		return invite, org, false
+	}
+	return invite, org, true
+}
+
+// auditInvite records an invitation being sent or answered in the
+// organization's audit log, naming the member who acted if there is one
+func (a *App) auditInvite(c *gin.Context, org models.Organization, action string, invite models.OrganizationInvite, memberID int) {
+	details := map[string]string{
+		"invite_id": strconv.Itoa(invite.ID),
+		"email":     invite.Email,
+		"role":      invite.Role,
+	}
+	if memberID != 0 {
+		details["member_id"] = strconv.Itoa(memberID)
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, org.AccountID, action, details))
+}
+
+// renderInvite responds with invitePage showing view
+func (a *App) renderInvite(c *gin.Context, status int, view inviteView) {
+	var page bytes.Buffer
+	if err := invitePage.Execute(&page, view); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to render invite page: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
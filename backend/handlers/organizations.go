@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	defaultOrganizationLimit = 50
+	maxOrganizationLimit     = 200
+)
+
+// organizationRequest is the body of a request to create or rename an
+// organization
+type organizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// memberRequest is the body of a request to add a user to an organization,
+// or invite them to it
+type memberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// roleRequest is the body of a request to change a member's role
+type roleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// CreateOrganization creates an organization with an empty address book,
+// owned by the user. Team sharing is a feature of the pro plan, though
+// organizations keep working if their owner leaves it.
+func (a *App) CreateOrganization(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req organizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if !a.requireFeature(c, userID.(int), featureTeamSharing, "Failed to create organization") {
+		return
+	}
+
+	org, err := a.store.Organizations.Create(c.Request.Context(), req.Name, userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create organization: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create organization",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    org,
+	})
+}
+
+// ListOrganizations lists the organizations the user is a member of, with
+// their role in each
+func (a *App) ListOrganizations(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var after int
+	page, ok := parseListPage(c, defaultOrganizationLimit, maxOrganizationLimit, &after)
+	if !ok {
+		return
+	}
+	total, err := a.store.Organizations.CountByMember(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count organizations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch organizations",
+		})
+		return
+	}
+	orgs, err := a.store.Organizations.ListByMember(c.Request.Context(), userID.(int), page)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch organizations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch organizations",
+		})
+		return
+	}
+
+	next := ""
+	if len(orgs) == page.Limit {
+		next = listCursor(orgs[len(orgs)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    orgs,
+	})
+}
+
+// GetOrganization returns an organization the user is a member of
+func (a *App) GetOrganization(c *gin.Context) {
+	org, _ := c.Get("organization")
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    org,
+	})
+}
+
+// UpdateOrganization renames an organization
+func (a *App) UpdateOrganization(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	var req organizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := a.store.Organizations.Rename(c.Request.Context(), org.ID, req.Name); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to rename organization: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update organization",
+		})
+		return
+	}
+	org.Name = req.Name
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    org,
+	})
+}
+
+// DeleteOrganization erases an organization with its contacts and backups
+func (a *App) DeleteOrganization(c *gin.Context) {
+	org, _ := c.Get("organization")
+	if err := a.eraseOrganization(c.Request.Context(), org.(models.Organization)); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete organization: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete organization",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Organization deleted successfully",
+	})
+}
+
+// eraseOrganization deletes an organization's backups from the backup
+// store, then its account, which the organization, its members and its
+// contacts are deleted with
+func (a *App) eraseOrganization(ctx context.Context, org models.Organization) error {
+	if err := a.eraseBackups(ctx, org.AccountID); err != nil {
+		return err
+	}
+	return a.store.Users.Delete(ctx, org.AccountID)
+}
+
+// ListOrganizationMembers lists the members of an organization and their
+// roles
+func (a *App) ListOrganizationMembers(c *gin.Context) {
+	org, _ := c.Get("organization")
+
+	var joinedAt time.Time
+	var memberID int
+	page, ok := parseListPage(c, defaultOrganizationLimit, maxOrganizationLimit, &joinedAt, &memberID)
+	if !ok {
+		return
+	}
+	total, err := a.store.Organizations.CountMembers(c.Request.Context(), org.(models.Organization).ID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count members: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch members",
+		})
+		return
+	}
+	members, err := a.store.Organizations.ListMembers(c.Request.Context(), org.(models.Organization).ID, page)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch members: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch members",
+		})
+		return
+	}
+
+	next := ""
+	if len(members) == page.Limit {
+		last := members[len(members)-1]
+		next = listCursor(last.JoinedAt, last.UserID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    members,
+	})
+}
+
+// AddOrganizationMember adds the user registered with an email to an
+// organization. Only owners can add owners.
+func (a *App) AddOrganizationMember(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	var req memberRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !canGrantRole(c, org, req.Role) {
+		return
+	}
+
+	user, err := a.store.Users.GetByEmail(c.Request.Context(), req.Email)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "No account is registered with this email",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get user: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to add member",
+		})
+		return
+	}
+
+	err = a.store.Organizations.AddMember(c.Request.Context(), org.ID, user.ID, req.Role)
+	if err == repository.ErrDuplicate {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "This user is already a member",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to add member: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to add member",
+		})
+		return
+	}
+	a.auditMember(c, org, auditMemberAdded, user.ID, req.Role, c.GetInt("user_id"))
+
+	a.respondMember(c, org, user.ID, http.StatusCreated, "Failed to add member")
+}
+
+// UpdateOrganizationMember changes a member's role. Only owners can make or
+// unmake owners, and the last owner can't be unmade.
+func (a *App) UpdateOrganizationMember(c *gin.Context) {
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	memberID, ok := memberParam(c)
+	if !ok {
+		return
+	}
+	var req roleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	member, ok := a.loadMember(c, org, memberID, "Failed to update member")
+	if !ok || !canGrantRole(c, org, member.Role) || !canGrantRole(c, org, req.Role) {
+		return
+	}
+	if member.Role == repository.RoleOwner && req.Role != repository.RoleOwner && !a.keepsOwner(c, org, "Failed to update member") {
+		return
+	}
+
+	if err := a.store.Organizations.SetRole(c.Request.Context(), org.ID, memberID, req.Role); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update member: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update member",
+		})
+		return
+	}
+	if req.Role != member.Role {
+		a.auditMember(c, org, auditMemberRoleChanged, memberID, req.Role, c.GetInt("user_id"))
+	}
+
+	a.respondMember(c, org, memberID, http.StatusOK, "Failed to update member")
+}
+
+// RemoveOrganizationMember removes a member from an organization. Members
+// can leave, owners and admins can remove others, and only owners can
+// remove owners. The last owner can't leave; they delete the organization
+// instead.
+func (a *App) RemoveOrganizationMember(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	value, _ := c.Get("organization")
+	org := value.(models.Organization)
+	memberID, ok := memberParam(c)
+	if !ok {
+		return
+	}
+	member, ok := a.loadMember(c, org, memberID, "Failed to remove member")
+	if !ok {
+		return
+	}
+	if memberID != userID.(int) {
+		if org.Role == repository.RoleMember {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "Your role in this organization doesn't allow this",
+			})
+			return
+		}
+		if !canGrantRole(c, org, member.Role) {
+			return
+		}
+	}
+	if member.Role == repository.RoleOwner && !a.keepsOwner(c, org, "Failed to remove member") {
+		return
+	}
+
+	if _, err := a.store.Organizations.RemoveMember(c.Request.Context(), org.ID, memberID); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to remove member: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to remove member",
+		})
+		return
+	}
+	a.auditMember(c, org, auditMemberRemoved, memberID, member.Role, userID.(int))
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Member removed successfully",
+	})
+}
+
+// canGrantRole reports whether the user's role lets them give a member
+// role, or take it away, responding with 403 if it doesn't. Only owners
+// can make or unmake owners.
+func canGrantRole(c *gin.Context, org models.Organization, role string) bool {
+	if role == repository.RoleOwner && org.Role != repository.RoleOwner {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Only owners can make or remove owners",
+		})
+		return false
+	}
+	return true
+}
+
+// keepsOwner reports whether an organization has another owner than the one
+// being removed or unmade, responding with 409 if it doesn't
+func (a *App) keepsOwner(c *gin.Context, org models.Organization, failure string) bool {
+	members, err := a.store.Organizations.ListMembers(c.Request.Context(), org.ID, repository.Page{})
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("%s: %v", failure, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return false
+	}
+	owners := 0
+	for _, member := range members {
+		if member.Role == repository.RoleOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "An organization needs an owner. Make another member owner first, or delete the organization",
+		})
+		return false
+	}
+	return true
+}
+
+// loadMember returns a member of an organization, responding with 404 if
+// the user isn't one
+func (a *App) loadMember(c *gin.Context, org models.Organization, userID int, failure string) (models.OrganizationMember, bool) {
+	members, err := a.store.Organizations.ListMembers(c.Request.Context(), org.ID, repository.Page{})
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("%s: %v", failure, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return models.OrganizationMember{}, false
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return member, true
+		}
+	}
+	respondMemberNotFound(c)
+	return models.OrganizationMember{}, false
+}
+
+// respondMember responds with a member of an organization
+func (a *App) respondMember(c *gin.Context, org models.Organization, userID, status int, failure string) {
+	member, ok := a.loadMember(c, org, userID, failure)
+	if !ok {
+		return
+	}
+	c.JSON(status, models.Response{
+		Success: true,
+		Data:    member,
+	})
+}
+
+// auditMember records a change to an organization's members in its audit
+// log, naming the member and their role, and the member who made it,
+// actorID
+func (a *App) auditMember(c *gin.Context, org models.Organization, action string, memberID int, role string, actorID int) {
+	event := newAuditEvent(c, org.AccountID, action, map[string]string{
+		"user_id":   strconv.Itoa(memberID),
+		"role":      role,
+		"member_id": strconv.Itoa(actorID),
+	})
+	a.audit(c.Request.Context(), event)
+}
+
+// memberParam returns the member's user ID in the route, responding with
+// 404 if it isn't one
+func memberParam(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("user"))
+	if err != nil {
+		respondMemberNotFound(c)
+		return 0, false
+	}
+	return userID, true
+}
+
+func respondMemberNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Member not found",
+	})
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// providerOutlook names Outlook contacts in the integration routes
+const providerOutlook = "outlook"
+
+const (
+	// graphBaseURL is the root of the Microsoft Graph API
+	graphBaseURL = "https://graph.microsoft.com/v1.0"
+	// outlookContactFields are the fields of a contact read from Graph, those
+	// synced and the change key and update time
+	outlookContactFields = "displayName,mobilePhone,homePhones,businessPhones,birthday,changeKey,lastModifiedDateTime"
+	// outlookDeltaPath lists the changes to the default contacts folder,
+	// which is the one contacts created through /me/contacts go to
+	outlookDeltaPath = "/me/contactFolders/contacts/contacts/delta"
+)
+
+// outlookContacts syncs contacts with a Microsoft account's Outlook contacts
+// through Microsoft Graph, for Outlook.com and Exchange Online users alike. A
+// contact's name is synced with the Outlook contact's display name, its phone
+// number with the mobile number, or the first home or business number if it
+// has none, and its birthday with the birthday; the other fields are left as
+// they are.
+type outlookContacts struct {
+	clientID     string
+	clientSecret string
+	tenant       string
+	baseURL      string
+}
+
+// newOutlookContacts creates the Outlook provider for the Microsoft Entra
+// app in MICROSOFT_CLIENT_ID
+func newOutlookContacts(cfg *config.Config) *outlookContacts {
+	return &outlookContacts{
+		clientID:     cfg.MicrosoftClientID,
+		clientSecret: cfg.MicrosoftClientSecret,
+		tenant:       cfg.MicrosoftTenant,
+		baseURL:      graphBaseURL,
+	}
+}
+
+func (o *outlookContacts) title() string {
+	return "Outlook"
+}
+
+func (o *outlookContacts) oauth(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.clientID,
+		ClientSecret: o.clientSecret,
+		Endpoint:     endpoints.AzureAD(o.tenant),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"offline_access", "User.Read", "Contacts.ReadWrite"},
+	}
+}
+
+// authOptions is empty, as the offline_access scope is what grants a
+// refresh token
+func (o *outlookContacts) authOptions() []oauth2.AuthCodeOption {
+	return nil
+}
+
+func (o *outlookContacts) account(ctx context.Context, client *http.Client) (string, error) {
+	var me struct {
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+	if err := o.call(ctx, client, http.MethodGet, o.baseURL+"/me?$select=mail,userPrincipalName", nil, &me); err != nil {
+		return "", fmt.Errorf("failed to get profile: %v", err)
+	}
+	if me.Mail != "" {
+		return me.Mail, nil
+	}
+	if me.UserPrincipalName == "" {
+		return "", errors.New("profile has no email address")
+	}
+	return me.UserPrincipalName, nil
+}
+
+// changes follows Graph's delta query, whose delta link is the sync token
+func (o *outlookContacts) changes(ctx context.Context, client *http.Client, syncToken string) (remoteChanges, error) {
+	changes := remoteChanges{Full: syncToken == ""}
+	next := syncToken
+	if next == "" {
+		next = o.baseURL + outlookDeltaPath + "?$select=" + outlookContactFields
+	}
+	for next != "" {
+		var page struct {
+			Value     []outlookContact `json:"value"`
+			NextLink  string           `json:"@odata.nextLink"`
+			DeltaLink string           `json:"@odata.deltaLink"`
+		}
+		err := o.call(ctx, client, http.MethodGet, next, nil, &page)
+		var outlookErr *outlookError
+		if errors.As(err, &outlookErr) && syncToken != "" && outlookErr.syncStateExpired() {
+			return remoteChanges{}, errSyncTokenExpired
+		}
+		if err != nil {
+			return remoteChanges{}, fmt.Errorf("failed to list contact changes: %v", err)
+		}
+		for _, contact := range page.Value {
+			changes.Contacts = append(changes.Contacts, contact.remote())
+		}
+		if page.DeltaLink != "" {
+			changes.SyncToken = page.DeltaLink
+		}
+		next = page.NextLink
+	}
+	return changes, nil
+}
+
+func (o *outlookContacts) create(ctx context.Context, client *http.Client, contact models.Contact) (remoteContact, error) {
+	var created outlookContact
+	body := outlookContactPatch(outlookContact{}, contact)
+	if err := o.call(ctx, client, http.MethodPost, o.baseURL+"/me/contacts", body, &created); err != nil {
+		return remoteContact{}, fmt.Errorf("failed to create contact: %v", err)
+	}
+	return created.remote(), nil
+}
+
+func (o *outlookContacts) update(ctx context.Context, client *http.Client, remoteID, etag string, contact models.Contact) (string, error) {
+	contactURL := o.baseURL + "/me/contacts/" + url.PathEscape(remoteID)
+	var current outlookContact
+	if err := o.call(ctx, client, http.MethodGet, contactURL+"?$select="+outlookContactFields, nil, &current); err != nil {
+		return "", fmt.Errorf("failed to get contact: %v", err)
+	}
+	if contactPushed(contact, current.remote()) {
+		return current.ChangeKey, nil
+	}
+	if current.ChangeKey != etag {
+		return "", errRemoteChanged
+	}
+
+	var updated outlookContact
+	if err := o.call(ctx, client, http.MethodPatch, contactURL, outlookContactPatch(current, contact), &updated); err != nil {
+		return "", fmt.Errorf("failed to update contact: %v", err)
+	}
+	return updated.ChangeKey, nil
+}
+
+func (o *outlookContacts) delete(ctx context.Context, client *http.Client, remoteID string) error {
+	err := o.call(ctx, client, http.MethodDelete, o.baseURL+"/me/contacts/"+url.PathEscape(remoteID), nil, nil)
+	var outlookErr *outlookError
+	if errors.As(err, &outlookErr) && outlookErr.Status == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %v", err)
+	}
+	return nil
+}
+
+// call sends a Graph request with body as JSON and decodes the response
+// into out, returning a *outlookError for an error response
+func (o *outlookContacts) call(ctx context.Context, client *http.Client, method, requestURL string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		outlookErr := &outlookError{Status: resp.StatusCode}
+		var payload struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&payload) == nil {
+			outlookErr.Code, outlookErr.Message = payload.Error.Code, payload.Error.Message
+		}
+		return outlookErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// outlookError is an error response of Microsoft Graph
+type outlookError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *outlookError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("graph: status %d", e.Status)
+	}
+	return fmt.Sprintf("graph: status %d: %s: %s", e.Status, e.Code, e.Message)
+}
+
+// syncStateExpired reports whether a delta link is no longer accepted, and
+// the changes have to be listed again from scratch
+func (e *outlookError) syncStateExpired() bool {
+	switch e.Code {
+	case "resyncRequired", "syncStateNotFound", "SyncStateNotFound", "SyncStateInvalid":
+		return true
+	}
+	return e.Status == http.StatusGone
+}
+
+// outlookContact is an Outlook contact as Graph returns it. Removed is set on
+// the contacts a delta query reports deleted.
+type outlookContact struct {
+	ID                   string    `json:"id"`
+	ChangeKey            string    `json:"changeKey"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	DisplayName          string    `json:"displayName"`
+	MobilePhone          string    `json:"mobilePhone"`
+	HomePhones           []string  `json:"homePhones"`
+	BusinessPhones       []string  `json:"businessPhones"`
+	Birthday             time.Time `json:"birthday"`
+	Removed              *struct {
+		Reason string `json:"reason"`
+	} `json:"@removed"`
+}
+
+// remote maps an Outlook contact to the synced fields. Graph keeps
+// birthdays as times, whose date in UTC is the birthday.
+func (g outlookContact) remote() remoteContact {
+	remote := remoteContact{
+		ID:        g.ID,
+		ETag:      g.ChangeKey,
+		Deleted:   g.Removed != nil,
+		Name:      g.DisplayName,
+		UpdatedAt: g.LastModifiedDateTime,
+	}
+	switch g.phoneField() {
+	case "mobilePhone":
+		remote.Phone = g.MobilePhone
+	case "homePhones":
+		remote.Phone = g.HomePhones[0]
+	case "businessPhones":
+		remote.Phone = g.BusinessPhones[0]
+	}
+	if !g.Birthday.IsZero() {
+		birthday := g.Birthday.UTC()
+		remote.Birthday = time.Date(birthday.Year(), birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return remote
+}
+
+// phoneField returns the field holding an Outlook contact's synced phone
+// number, the first of the list for home and business numbers, or "" if it
+// has none
+func (g outlookContact) phoneField() string {
+	switch {
+	case g.MobilePhone != "":
+		return "mobilePhone"
+	case len(g.HomePhones) > 0:
+		return "homePhones"
+	case len(g.BusinessPhones) > 0:
+		return "businessPhones"
+	}
+	return ""
+}
+
+// outlookContactPatch returns the fields setting an Outlook contact's synced
+// fields to a contact's. The phone number replaces the one current was
+// synced with, or becomes the mobile number, and a contact without a
+// birthday leaves the Outlook contact's. Birthdays are sent at noon UTC so
+// Outlook shows the same date in every time zone.
+func outlookContactPatch(current outlookContact, contact models.Contact) map[string]interface{} {
+	patch := map[string]interface{}{"displayName": contact.Name}
+	switch field := current.phoneField(); field {
+	case "homePhones":
+		phones := append([]string(nil), current.HomePhones...)
+		phones[0] = contact.Phone
+		patch[field] = phones
+	case "businessPhones":
+		phones := append([]string(nil), current.BusinessPhones...)
+		phones[0] = contact.Phone
+		patch[field] = phones
+	default:
+		patch["mobilePhone"] = contact.Phone
+	}
+	if !contact.Birthday.IsZero() {
+		birthday := contact.Birthday.UTC()
+		patch["birthday"] = time.Date(birthday.Year(), birthday.Month(), birthday.Day(), 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	}
+	return patch
+}
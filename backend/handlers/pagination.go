@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// parseListPage reads the page of a list a request asks for: at most
+// ?limit= items, between 1 and max or defaultLimit if not given, after the
+// ?cursor= listCursor returned for the previous page. The cursor is decoded
+// into keys, the pointers to the sort keys of the page's last item, whose
+// values make up the page's After. It responds with 400 if either parameter
+// is invalid.
+func parseListPage(c *gin.Context, defaultLimit, max int, keys ...interface{}) (repository.Page, bool) {
+	page := repository.Page{Limit: defaultLimit}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > max {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "limit",
+					Message: fmt.Sprintf("Limit must be between 1 and %d", max),
+				},
+			})
+			return page, false
+		}
+		page.Limit = n
+	}
+	raw := c.Query("cursor")
+	if raw == "" {
+		return page, true
+	}
+	if !decodeCursor(raw, keys) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "cursor",
+				Message: "Invalid cursor",
+			},
+		})
+		return page, false
+	}
+	for _, key := range keys {
+		page.After = append(page.After, reflect.ValueOf(key).Elem().Interface())
+	}
+	return page, true
+}
+
+// listCursor returns the cursor of the page after the one whose last item
+// has keys. A cursor of a single ID is the ID itself, as for the audit log;
+// others are opaque.
+func listCursor(keys ...interface{}) string {
+	if len(keys) == 1 {
+		if id, ok := keys[0].(int); ok {
+			return strconv.Itoa(id)
+		}
+	}
+	encoded, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor decodes a cursor made by listCursor into keys
+func decodeCursor(raw string, keys []interface{}) bool {
+	if len(keys) == 1 {
+		if id, ok := keys[0].(*int); ok {
+			n, err := strconv.Atoi(raw)
+			*id = n
+			return err == nil && n > 0
+		}
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return false
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(decoded, &values); err != nil || len(values) != len(keys) {
+		return false
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(value, keys[i]); err != nil {
+			return false
+		}
+	}
+	return true
+}
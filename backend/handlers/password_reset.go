@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/services"
+)
+
+// passwordResetPage asks a user an admin required to reset their password
+// for a new one, or tells them how that went. It posts back to its own URL,
+// which carries the token.
+var passwordResetPage = template.Must(template.New("reset-password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>PhoneSaver password</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Form}}<form method="post">
+<label>New password <input type="password" name="password" autocomplete="new-password" required></label>
+<button type="submit">Set password</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// passwordResetView is what passwordResetPage shows
+type passwordResetView struct {
+	Title   string
+	Message string
+	Form    bool
+}
+
+// passwordResetForm is the form passwordResetPage posts
+type passwordResetForm struct {
+	Password string `form:"password" binding:"required,password"`
+}
+
+// GetResetPassword shows the page a password reset email links to, which
+// asks the user for their new password
+func (a *App) GetResetPassword(c *gin.Context) {
+	a.renderPasswordReset(c, http.StatusOK, passwordResetView{
+		Title:   "Choose a new password",
+		Message: "Your password was reset by an administrator. Choose a new one to sign in to PhoneSaver again.",
+		Form:    true,
+	})
+}
+
+// ResetPassword sets the new password posted from the password reset page
+func (a *App) ResetPassword(c *gin.Context) {
+	var form passwordResetForm
+	if err := c.ShouldBind(&form); err != nil {
+		message := "Enter a new password."
+		if errs := validationErrors(err); len(errs) > 0 {
+			message = errs[0].Message + "."
+		}
+		a.renderPasswordReset(c, http.StatusBadRequest, passwordResetView{
+			Title:   "Choose a new password",
+			Message: message,
+			Form:    true,
+		})
+		return
+	}
+
+	userID, err := a.authService.ResetPassword(c.Request.Context(), c.Query("token"), form.Password)
+	if err == services.ErrInvalidResetToken {
+		a.renderPasswordReset(c, http.StatusBadRequest, passwordResetView{
+			Title:   "This link doesn't work",
+			Message: "The link has expired, was already used, or was replaced by a newer one. Check your email for the latest link.",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to reset password: %v", err)
+		a.renderPasswordReset(c, http.StatusInternalServerError, passwordResetView{
+			Title:   "Something went wrong",
+			Message: "Your password could not be set. Please try the link again.",
+			Form:    true,
+		})
+		return
+	}
+
+	a.audit(c.Request.Context(), newAuditEvent(c, userID, auditPasswordReset, nil))
+
+	a.renderPasswordReset(c, http.StatusOK, passwordResetView{
+		Title:   "Password set",
+		Message: "Sign in to PhoneSaver with your new password.",
+	})
+}
+
+// renderPasswordReset responds with passwordResetPage showing view
+func (a *App) renderPasswordReset(c *gin.Context, status int, view passwordResetView) {
+	var page bytes.Buffer
+	if err := passwordResetPage.Execute(&page, view); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to render password reset page: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const jobTypePhoneEnrichment = "phone_enrichment"
+
+// phoneEnrichmentPause is how long an enrichment job waits between lookups,
+// keeping a large address book within the provider's rate limit
+const phoneEnrichmentPause = 50 * time.Millisecond
+
+// EnrichContacts starts a job that looks up the phone numbers of the user's
+// contacts not verified yet at the phone verification provider, annotating
+// them with their line type, carrier and country, which filters can then
+// compare. With ?all=true contacts verified before are looked up again, as
+// numbers move between carriers.
+func (a *App) EnrichContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if a.phoneVerifier == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Phone verification is not enabled",
+		})
+		return
+	}
+
+	a.startJobResponse(c, userID.(int), jobTypePhoneEnrichment, a.enrichPhones(userID.(int), c.Query("all") == "true"))
+}
+
+// enrichPhones returns the job verifying a user's contacts' phone numbers,
+// or only those not verified yet unless all is set. Contacts changed or
+// deleted while the job runs are skipped, and the job stops at the first
+// lookup the provider fails, keeping the verifications already stored.
+func (a *App) enrichPhones(userID int, all bool) jobFunc {
+	return func(ctx context.Context, progress progressFunc) (interface{}, error) {
+		contacts, err := a.store.Contacts.ListAll(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contacts: %v", err)
+		}
+		pending := contacts[:0]
+		for _, contact := range contacts {
+			if all || contact.PhoneVerification == nil {
+				pending = append(pending, contact)
+			}
+		}
+
+		var result models.PhoneEnrichmentResult
+		progress(0, len(pending))
+		for i, contact := range pending {
+			if i > 0 {
+				select {
+				case <-time.After(phoneEnrichmentPause):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			lookup, err := a.phoneVerifier.Verify(ctx, contact.Phone)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify phone number of contact %d: %v", contact.ID, err)
+			}
+			lookup.VerifiedAt = time.Now().UTC().Truncate(time.Second)
+			err = a.store.Contacts.SetPhoneVerification(ctx, userID, contact.ID, contact.Version, lookup.PhoneVerification)
+			switch {
+			case err == repository.ErrNotFound || err == repository.ErrVersionConflict:
+				result.Skipped++
+			case err != nil:
+				return nil, fmt.Errorf("failed to store phone verification of contact %d: %v", contact.ID, err)
+			case lookup.Valid:
+				result.Enriched++
+			default:
+				result.Invalid++
+			}
+			progress(i+1, len(pending))
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"strings"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// whatsAppChatURL is WhatsApp's click-to-chat link, followed by the number's
+// digits without the leading plus
+const whatsAppChatURL = "https://wa.me/"
+
+// phoneLinks returns the tel:, sms: and WhatsApp click-to-chat links of a
+// phone number, or nil unless it is in E.164 format once normalized, as
+// the links should reach the same number from any country
+func phoneLinks(phone string) *models.PhoneLinks {
+	e164 := repository.NormalizePhone(phone)
+	if !phoneNumberPattern.MatchString(e164) {
+		return nil
+	}
+	return &models.PhoneLinks{
+		Tel:      "tel:" + e164,
+		SMS:      "sms:" + e164,
+		WhatsApp: whatsAppChatURL + strings.TrimPrefix(e164, "+"),
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// PhoneVerifier looks phone numbers up at a provider
+type PhoneVerifier interface {
+	// Verify reports whether phone is a valid number, and for valid numbers
+	// their line type, carrier, country and formats. Invalid numbers are not
+	// an error. VerifiedAt is left to the caller.
+	Verify(ctx context.Context, phone string) (models.PhoneLookup, error)
+}
+
+// newPhoneVerifier creates the verifier selected by
+// PHONE_VERIFICATION_PROVIDER, or nil when phone numbers can't be verified
+func newPhoneVerifier(cfg *config.Config) (PhoneVerifier, error) {
+	switch cfg.PhoneVerificationProvider {
+	case "", config.PhoneVerificationProviderNone:
+		return nil, nil
+	case config.PhoneVerificationProviderTwilio:
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" {
+			return nil, fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN must be set to verify phone numbers through Twilio")
+		}
+		return &twilioLookup{
+			endpoint:   "https://lookups.twilio.com/v2/PhoneNumbers/",
+			accountSID: cfg.TwilioAccountSID,
+			authToken:  cfg.TwilioAuthToken,
+			client:     &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown phone verification provider %q", cfg.PhoneVerificationProvider)
+	}
+}
+
+// twilioLineTypes maps the line types of Twilio Lookup to those stored,
+// which lump fixed and non-fixed VoIP together. Types not listed, such as
+// mobile and landline, are stored as they are.
+var twilioLineTypes = map[string]string{
+	"fixedVoip":    "voip",
+	"nonFixedVoip": "voip",
+	"tollFree":     "toll_free",
+	"sharedCost":   "shared_cost",
+}
+
+// twilioLookup verifies phone numbers with Twilio Lookup, including its line
+// type intelligence for the line type and carrier
+type twilioLookup struct {
+	endpoint   string
+	accountSID string
+	authToken  string
+	client     *http.Client
+}
+
+func (t *twilioLookup) Verify(ctx context.Context, phone string) (models.PhoneLookup, error) {
+	endpoint := t.endpoint + url.PathEscape(repository.NormalizePhone(phone)) + "?Fields=line_type_intelligence"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return models.PhoneLookup{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return models.PhoneLookup{}, fmt.Errorf("failed to look up phone number: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Numbers Twilio can't parse at all
+		return models.PhoneLookup{}, nil
+	}
+	if resp.StatusCode >= 300 {
+		return models.PhoneLookup{}, fmt.Errorf("failed to look up phone number: Twilio returned %s", resp.Status)
+	}
+
+	var result struct {
+		Valid            bool     `json:"valid"`
+		ValidationErrors []string `json:"validation_errors"`
+		CountryCode      string   `json:"country_code"`
+		PhoneNumber      string   `json:"phone_number"`
+		NationalFormat   string   `json:"national_format"`
+		LineType         *struct {
+			Type        string `json:"type"`
+			CarrierName string `json:"carrier_name"`
+		} `json:"line_type_intelligence"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return models.PhoneLookup{}, fmt.Errorf("failed to decode phone number lookup: %v", err)
+	}
+	if !result.Valid {
+		return models.PhoneLookup{ValidationErrors: result.ValidationErrors}, nil
+	}
+	lookup := models.PhoneLookup{
+		PhoneVerification: models.PhoneVerification{Valid: true, CountryCode: result.CountryCode},
+		E164:              result.PhoneNumber,
+		NationalFormat:    result.NationalFormat,
+	}
+	if result.LineType != nil {
+		lookup.LineType, lookup.Carrier = result.LineType.Type, result.LineType.CarrierName
+		if lineType, ok := twilioLineTypes[lookup.LineType]; ok {
+			lookup.LineType = lineType
+		}
+	}
+	return lookup, nil
+}
+
+// verifyPhoneResponse is a contact with the verification of its phone number
+// just made
+type verifyPhoneResponse struct {
+	Contact models.ContactResponse `json:"contact"`
+	Lookup  models.PhoneLookup     `json:"lookup"`
+}
+
+// VerifyContactPhone looks a contact's phone number up at the phone
+// verification provider and stores what it reports on the contact, until
+// the number changes. The formats of valid numbers are returned for clients
+// to offer correcting the number with.
+func (a *App) VerifyContactPhone(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, ok := contactIDParam(c)
+	if !ok {
+		return
+	}
+	if a.phoneVerifier == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Phone verification is not enabled",
+		})
+		return
+	}
+	if !a.allowContact(c, userID.(int), contactID, repository.AccessWrite, "Failed to verify phone number") {
+		return
+	}
+
+	contact, err := a.contactService.Get(c.Request.Context(), userID.(int), contactID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get contact: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify phone number",
+		})
+		return
+	}
+
+	lookup, err := a.phoneVerifier.Verify(c.Request.Context(), contact.Phone)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to verify phone number: %v", err)
+		c.JSON(http.StatusBadGateway, models.Response{
+			Success: false,
+			Error:   "Failed to verify phone number",
+		})
+		return
+	}
+	lookup.VerifiedAt = time.Now().UTC().Truncate(time.Second)
+
+	err = a.store.Contacts.SetPhoneVerification(c.Request.Context(), userID.(int), contactID, contact.Version, lookup.PhoneVerification)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+	if err == repository.ErrVersionConflict {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Contact was modified while its phone number was verified",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to store phone verification: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to verify phone number",
+		})
+		return
+	}
+	contact.PhoneVerification = &lookup.PhoneVerification
+	a.publish(userID.(int), models.ContactEvent{Type: eventContactUpdated, ContactID: contact.ID, Contact: contactResponse(contact), DeviceID: c.GetString("device_id")})
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    verifyPhoneResponse{Contact: models.NewContactResponse(contact), Lookup: lookup},
+	})
+}
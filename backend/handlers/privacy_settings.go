@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// GetPrivacySettings returns the user's privacy settings
+func (a *App) GetPrivacySettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	settings, err := a.loadPrivacySettings(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get privacy settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get privacy settings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    settings,
+	})
+}
+
+// loadPrivacySettings returns a user's privacy settings
+func (a *App) loadPrivacySettings(ctx context.Context, userID int) (models.PrivacySettings, error) {
+	var settings models.PrivacySettings
+	var err error
+	if settings.EnhancedPrivacy, err = a.store.Users.EnhancedPrivacy(ctx, userID); err != nil {
+		return settings, err
+	}
+	settings.ContactEnrichment, err = a.store.Users.ContactEnrichment(ctx, userID)
+	return settings, err
+}
+
+// UpdatePrivacySettings saves the user's privacy settings. Turning enhanced
+// privacy on or off encrypts or decrypts the user's existing tags and notes
+// before it returns. Contact enrichment can only be turned on when the
+// server has an enrichment provider.
+func (a *App) UpdatePrivacySettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	settings, err := a.loadPrivacySettings(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get privacy settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update privacy settings",
+		})
+		return
+	}
+
+	enrichment := settings.ContactEnrichment
+	if !bindJSON(c, &settings) {
+		return
+	}
+	if settings.ContactEnrichment && !enrichment && a.enricher == nil {
+		respondValidation(c, models.ValidationError{Field: "contact_enrichment", Message: "Contact enrichment is not available"})
+		return
+	}
+
+	changed, err := a.store.SetEnhancedPrivacy(c.Request.Context(), userID.(int), settings.EnhancedPrivacy)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update privacy settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update privacy settings",
+		})
+		return
+	}
+	if changed {
+		a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditPrivacyChanged, map[string]string{
+			"enhanced_privacy": strconv.FormatBool(settings.EnhancedPrivacy),
+		}))
+	}
+
+	changed, err = a.store.Users.SetContactEnrichment(c.Request.Context(), userID.(int), settings.ContactEnrichment)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update privacy settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to update privacy settings",
+		})
+		return
+	}
+	if changed {
+		a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditPrivacyChanged, map[string]string{
+			"contact_enrichment": strconv.FormatBool(settings.ContactEnrichment),
+		}))
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    settings,
+	})
+}
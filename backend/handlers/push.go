@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	// fcmBatchLimit is the maximum number of tokens per multicast message
+	fcmBatchLimit = 500
+	// changePushDelay coalesces bursts of changes into one push per user
+	changePushDelay = 10 * time.Second
+)
+
+// PushMessage is a push notification. Messages without a title are sent as
+// silent data messages.
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Pusher delivers push notifications to device tokens
+type Pusher interface {
+	// Send delivers msg to tokens and returns the tokens that are no longer
+	// valid and should be forgotten
+	Send(ctx context.Context, tokens []string, msg PushMessage) ([]string, error)
+}
+
+// newPusher returns an FCM pusher if Firebase messaging is available, and a
+// pusher that only logs otherwise
+func newPusher(client *messaging.Client) Pusher {
+	if client == nil {
+		return logPusher{}
+	}
+	return &fcmPusher{client: client}
+}
+
+// logPusher writes push notifications to the log instead of sending them
+type logPusher struct{}
+
+func (logPusher) Send(ctx context.Context, tokens []string, msg PushMessage) ([]string, error) {
+	logging.Infof("Push to %d devices: %s %v", len(tokens), msg.Title, msg.Data)
+	return nil, nil
+}
+
+// fcmPusher sends push notifications through Firebase Cloud Messaging
+type fcmPusher struct {
+	client *messaging.Client
+}
+
+func (p *fcmPusher) Send(ctx context.Context, tokens []string, msg PushMessage) ([]string, error) {
+	var stale []string
+	for start := 0; start < len(tokens); start += fcmBatchLimit {
+		batch := tokens[start:min(start+fcmBatchLimit, len(tokens))]
+		message := &messaging.MulticastMessage{Tokens: batch, Data: msg.Data}
+		if msg.Title != "" {
+			message.Notification = &messaging.Notification{Title: msg.Title, Body: msg.Body}
+		} else {
+			// Let iOS deliver the data message in the background
+			message.APNS = &messaging.APNSConfig{Payload: &messaging.APNSPayload{Aps: &messaging.Aps{ContentAvailable: true}}}
+		}
+
+		resp, err := p.client.SendEachForMulticast(ctx, message)
+		if err != nil {
+			return stale, err
+		}
+		for i, r := range resp.Responses {
+			if r.Error != nil && (messaging.IsRegistrationTokenNotRegistered(r.Error) || messaging.IsInvalidArgument(r.Error)) {
+				stale = append(stale, batch[i])
+			}
+		}
+	}
+	return stale, nil
+}
+
+// pushToUser sends a push notification to every device of a user with a push
+// token, except the given device, and returns the number of devices
+func (a *App) pushToUser(ctx context.Context, userID int, exceptDevice string, msg PushMessage) (int, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT push_token FROM devices WHERE user_id = ? AND push_token IS NOT NULL AND device_id <> ?",
+		userID, exceptDevice,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(tokens) == 0 {
+		return 0, err
+	}
+
+	stale, err := a.pusher.Send(ctx, tokens, msg)
+	if len(stale) > 0 {
+		args := make([]interface{}, len(stale))
+		for i, token := range stale {
+			args[i] = token
+		}
+		_, clearErr := a.store.DB.ExecContext(ctx,
+			"UPDATE devices SET push_token = NULL WHERE push_token IN (?"+strings.Repeat(", ?", len(stale)-1)+")",
+			args...,
+		)
+		if clearErr != nil {
+			logging.Errorf("Failed to clear stale push tokens: %v", clearErr)
+		}
+	}
+	return len(tokens), err
+}
+
+// changeNotifier pushes a silent "contacts changed" message to a user's other
+// devices after their contacts change, so they sync without polling
+type changeNotifier struct {
+	app     *App
+	mu      sync.Mutex
+	pending map[int]map[string]bool
+}
+
+func newChangeNotifier(app *App) *changeNotifier {
+	return &changeNotifier{app: app, pending: make(map[int]map[string]bool)}
+}
+
+// notify records a change made by a device and schedules a push
+func (n *changeNotifier) notify(userID int, deviceID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pending[userID] == nil {
+		n.pending[userID] = make(map[string]bool)
+		time.AfterFunc(changePushDelay, func() { n.flush(userID) })
+	}
+	n.pending[userID][deviceID] = true
+}
+
+// flush sends the push for a user's pending changes. The device that made
+// the changes is skipped when they all came from one device.
+func (n *changeNotifier) flush(userID int) {
+	n.mu.Lock()
+	origins := n.pending[userID]
+	delete(n.pending, userID)
+	n.mu.Unlock()
+
+	except := ""
+	if len(origins) == 1 {
+		for deviceID := range origins {
+			except = deviceID
+		}
+	}
+	_, err := n.app.pushToUser(context.Background(), userID, except, PushMessage{
+		Data: map[string]string{"type": "contacts_changed"},
+	})
+	if err != nil {
+		logging.Errorf("Failed to push change notification to user %d: %v", userID, err)
+	}
+}
+
+// pushTokenRequest is the body of a request to register a push token
+type pushTokenRequest struct {
+	Token string `json:"token" binding:"required,max=512"`
+}
+
+// RegisterPushToken stores the FCM token of the device making the request
+func (a *App) RegisterPushToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	deviceID := c.GetString("device_id")
+	if deviceID == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Log in again to register this device for push notifications",
+		})
+		return
+	}
+
+	var req pushTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tx, err := a.store.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to start transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to register push token",
+		})
+		return
+	}
+
+	// A token belongs to one app install, which may have been used by
+	// another account before
+	var result sql.Result
+	_, err = tx.ExecContext(c.Request.Context(), "UPDATE devices SET push_token = NULL WHERE push_token = ?", req.Token)
+	if err == nil {
+		result, err = tx.ExecContext(c.Request.Context(),
+			"UPDATE devices SET push_token = ?, last_seen_at = ? WHERE user_id = ? AND device_id = ?",
+			req.Token, time.Now().UTC(), userID, deviceID,
+		)
+	}
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		middleware.RequestLogger(c).Errorf("Failed to register push token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to register push token",
+		})
+		return
+	}
+
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Device not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Push token registered successfully",
+	})
+}
+
+// DeletePushToken stops push notifications to the device making the request
+func (a *App) DeletePushToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	_, err := a.store.DB.ExecContext(c.Request.Context(),
+		"UPDATE devices SET push_token = NULL WHERE user_id = ? AND device_id = ?",
+		userID, c.GetString("device_id"),
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete push token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete push token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Push token deleted successfully",
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const (
+	// birthdayHorizonDays is how far ahead upcoming birthdays are considered
+	birthdayHorizonDays = 14
+	// recentlyContactedDays suppresses contacts the user was just in touch with
+	recentlyContactedDays = 7
+	// neverContactedDays is the staleness assumed for contacts never contacted
+	neverContactedDays    = 365
+	defaultReconnectLimit = 10
+	maxReconnectLimit     = 50
+)
+
+// daysUntilBirthday returns the number of days until the next occurrence of
+// birthday, where 0 is today. A February 29 birthday falls on March 1 in
+// other years.
+func daysUntilBirthday(birthday, now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	next := time.Date(today.Year(), birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+	if next.Before(today) {
+		next = time.Date(today.Year()+1, birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(next.Sub(today) / day)
+}
+
+// scoreReconnect ranks contacts by how much they need attention. Staleness,
+// being overdue relative to the usual interaction frequency, and upcoming
+// birthdays each add to the score.
+func scoreReconnect(contacts []models.Contact, frequencies []models.ContactFrequency, now time.Time) []models.ReconnectSuggestion {
+	byContact := make(map[int]models.ContactFrequency, len(frequencies))
+	for _, frequency := range frequencies {
+		byContact[frequency.ContactID] = frequency
+	}
+
+	suggestions := []models.ReconnectSuggestion{}
+	for _, contact := range contacts {
+		suggestion := models.ReconnectSuggestion{ContactID: contact.ID, Name: contact.Name, Reasons: []string{}}
+		frequency, known := byContact[contact.ID]
+
+		daysSince := neverContactedDays
+		if known && frequency.DaysSince != nil {
+			daysSince = *frequency.DaysSince
+			suggestion.DaysSince = frequency.DaysSince
+		}
+
+		// Staleness
+		if !known {
+			suggestion.Score += 30
+			suggestion.Reasons = append(suggestion.Reasons, "You have never recorded an interaction")
+		} else if daysSince >= recentlyContactedDays {
+			suggestion.Score += math.Min(float64(daysSince)/90, 2) * 20
+			suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("Last interaction %d days ago", daysSince))
+		}
+
+		// Past frequency: close contacts who have gone quiet matter most
+		if known && frequency.AverageGapDays >= 1 && daysSince >= recentlyContactedDays {
+			overdue := float64(daysSince) / frequency.AverageGapDays
+			if overdue > 1 {
+				suggestion.Score += math.Min(overdue, 4) * 10
+				suggestion.Reasons = append(suggestion.Reasons,
+					fmt.Sprintf("You usually talk every %.0f days", frequency.AverageGapDays))
+			}
+		}
+
+		// Upcoming birthday
+		if !contact.Birthday.IsZero() {
+			if days := daysUntilBirthday(contact.Birthday, now); days <= birthdayHorizonDays {
+				suggestion.BirthdayInDays = &days
+				suggestion.Score += 10 + 30*float64(birthdayHorizonDays-days)/birthdayHorizonDays
+				switch days {
+				case 0:
+					suggestion.Reasons = append(suggestion.Reasons, "Birthday today")
+				case 1:
+					suggestion.Reasons = append(suggestion.Reasons, "Birthday tomorrow")
+				default:
+					suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("Birthday in %d days", days))
+				}
+			}
+		}
+
+		if known && daysSince < recentlyContactedDays && suggestion.BirthdayInDays == nil {
+			continue
+		}
+		if suggestion.Score > 0 {
+			suggestion.Score = round2(suggestion.Score)
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	return suggestions
+}
+
+// GetReconnectSuggestions returns a ranked list of people the user should get
+// back in touch with
+func (a *App) GetReconnectSuggestions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var score float64
+	var contactID int
+	page, ok := parseListPage(c, defaultReconnectLimit, maxReconnectLimit, &score, &contactID)
+	if !ok {
+		return
+	}
+
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load contacts for recommendations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get recommendations",
+		})
+		return
+	}
+	interactions, err := a.loadInteractions(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load interactions for recommendations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get recommendations",
+		})
+		return
+	}
+
+	loc, err := a.userLocation(c.Request.Context(), userID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load time zone for recommendations: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to get recommendations",
+		})
+		return
+	}
+
+	// Birthdays fall on the user's local date
+	now := time.Now().In(loc)
+	insights := computeInteractionInsights(contacts, interactions, now)
+	suggestions := scoreReconnect(contacts, insights.Contacts, now)
+	total := len(suggestions)
+	if page.After != nil {
+		// Suggestions of equal score are in the order of their contacts' IDs
+		start := sort.Search(total, func(i int) bool {
+			s := suggestions[i]
+			return s.Score < score || (s.Score == score && s.ContactID > contactID)
+		})
+		suggestions = suggestions[start:]
+	}
+	next := ""
+	if len(suggestions) > page.Limit {
+		suggestions = suggestions[:page.Limit]
+		last := suggestions[page.Limit-1]
+		next = listCursor(last.Score, last.ContactID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    suggestions,
+	})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// refreshTokenCleanupInterval is how often expired refresh tokens are
+// purged
+const refreshTokenCleanupInterval = time.Hour
+
+// refreshRequest is the body of a request to renew an access token
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=128"`
+}
+
+// refreshResponse is the data of a successful refresh: a new access token
+// and the refresh token to use next time
+type refreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken trades a refresh token for a new access token, rotating the
+// refresh token. Presenting a refresh token that was already used revokes
+// every token descended from the same login and warns the user, since it
+// means someone else holds a copy.
+func (a *App) RefreshToken(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	session, err := a.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err == services.ErrRefreshTokenReused {
+		event := newAuditEvent(c, session.UserID, auditRefreshTokenReused, nil)
+		event.DeviceID = session.DeviceID
+		a.audit(c.Request.Context(), event)
+		if err := a.sendRefreshReuseAlert(c.Request.Context(), session.UserID, c.ClientIP()); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to send refresh token reuse alert: %v", err)
+		}
+	}
+	if err == services.ErrInvalidRefreshToken || err == services.ErrRefreshTokenReused {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Success: false,
+			Error:   "Invalid refresh token",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to refresh token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    refreshResponse{Token: session.Token, RefreshToken: session.RefreshToken},
+	})
+}
+
+// sendRefreshReuseAlert emails a user whose refresh token was replayed that
+// they have been signed out of the device it belonged to
+func (a *App) sendRefreshReuseAlert(ctx context.Context, userID int, ip string) error {
+	user, err := a.store.Users.Get(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %v", err)
+	}
+	return a.sendNotification(ctx, models.Notification{
+		UserID:  userID,
+		Channel: channelEmail,
+		Kind:    notificationSecurityAlert,
+		To:      user.Email,
+		Subject: "Suspicious sign-in activity on your PhoneSaver account",
+		Body: fmt.Sprintf(
+			"Hi,\n\nA sign-in token for your PhoneSaver account was used twice, most recently from %s, which can mean someone copied it. "+
+				"We've signed that session out; sign in again on that device, and change your password if you don't recognise this.\n\n-- PhoneSaver\n",
+			ip,
+		),
+	})
+}
+
+// RunRefreshTokenCleanup periodically purges expired refresh tokens
+func (a *App) RunRefreshTokenCleanup() {
+	ticker := time.NewTicker(refreshTokenCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := a.store.RefreshTokens.DeleteExpired(context.Background(), time.Now().UTC())
+		if err != nil {
+			logging.Errorf("Failed to purge refresh tokens: %v", err)
+			continue
+		}
+		if purged > 0 {
+			logging.Infof("Purged %d expired refresh tokens", purged)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	reminderActive    = "active"
+	reminderCompleted = "completed"
+)
+
+const (
+	defaultReminderLimit = 50
+	maxReminderLimit     = 200
+)
+
+// reminderPollInterval is how often due reminders are checked for
+const reminderPollInterval = time.Minute
+
+// reminderColumns are the columns read by scanReminder, with the reminders
+// table aliased as r and contacts as c
+const reminderColumns = "r.id, r.user_id, r.contact_id, c.name, r.note, r.note_key_version, r.due_at, r.repeat_every, r.repeat_unit, r.status, r.notified_at, r.completed_at, r.created_at"
+
+// scanReminder reads a reminder row selected with reminderColumns followed
+// by any extra columns, which are scanned into extra, decrypting its note
+func (a *App) scanReminder(ctx context.Context, row repository.RowScanner, extra ...interface{}) (models.Reminder, error) {
+	var reminder models.Reminder
+	var userID int
+	var noteVersion, every sql.NullInt64
+	var unit sql.NullString
+	var notifiedAt, completedAt sql.NullTime
+	dest := []interface{}{
+		&reminder.ID, &userID, &reminder.ContactID, &reminder.ContactName, &reminder.Note, &noteVersion, &reminder.DueAt,
+		&every, &unit, &reminder.Status, &notifiedAt, &completedAt, &reminder.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return reminder, err
+	}
+	note, err := a.store.OpenNote(ctx, userID, repository.ReminderNote, reminder.Note, noteVersion)
+	if err != nil {
+		return reminder, err
+	}
+	reminder.Note = note
+	if every.Valid {
+		reminder.Repeat = &models.ReminderRepeat{Every: int(every.Int64), Unit: unit.String}
+	}
+	if notifiedAt.Valid {
+		reminder.NotifiedAt = &notifiedAt.Time
+	}
+	if completedAt.Valid {
+		reminder.CompletedAt = &completedAt.Time
+	}
+	return reminder, nil
+}
+
+// loadReminder returns one of the user's reminders
+func (a *App) loadReminder(ctx context.Context, userID interface{}, reminderID interface{}) (models.Reminder, error) {
+	return a.scanReminder(ctx, a.store.DB.QueryRowContext(ctx,
+		"SELECT "+reminderColumns+" FROM reminders r JOIN contacts c ON c.id = r.contact_id WHERE r.id = ? AND r.user_id = ?",
+		reminderID, userID,
+	))
+}
+
+// reminderRequest is the body of a request to create a reminder
+type reminderRequest struct {
+	Note   string                 `json:"note" binding:"max=500"`
+	DueAt  time.Time              `json:"due_at" binding:"required"`
+	Repeat *models.ReminderRepeat `json:"repeat"`
+}
+
+// CreateReminder adds a one-off or recurring reminder for a contact
+func (a *App) CreateReminder(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	contactID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	var req reminderRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	exists, err := a.store.Contacts.Exists(c.Request.Context(), userID.(int), contactID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to verify contact ownership: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create reminder",
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	var every, unit interface{}
+	if req.Repeat != nil {
+		every, unit = req.Repeat.Every, req.Repeat.Unit
+	}
+	note, noteVersion, err := a.store.SealNote(c.Request.Context(), userID.(int), repository.ReminderNote, req.Note)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to seal reminder note: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create reminder",
+		})
+		return
+	}
+	now := time.Now().UTC()
+	result, err := a.store.DB.ExecContext(c.Request.Context(),
+		`INSERT INTO reminders (user_id, contact_id, note, note_key_version, due_at, repeat_every, repeat_unit, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, contactID, note, noteVersion, req.DueAt.UTC(), every, unit, reminderActive, now, now,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create reminder",
+		})
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get last insert ID: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create reminder",
+		})
+		return
+	}
+
+	reminder, err := a.loadReminder(c.Request.Context(), userID, id)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create reminder",
+		})
+		return
+	}
+
+	// Deliver reminders created already due without waiting for the next poll
+	wakeReminders()
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    reminder,
+	})
+}
+
+// ListReminders returns the user's reminders, soonest first. With a contact
+// ID only that contact's reminders are listed; ?status= selects active
+// (default) or completed reminders.
+func (a *App) ListReminders(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	status := c.DefaultQuery("status", reminderActive)
+	if status != reminderActive && status != reminderCompleted {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "status",
+				Message: "Status must be either active or completed",
+			},
+		})
+		return
+	}
+
+	var dueAt time.Time
+	var reminderID int
+	page, ok := parseListPage(c, defaultReminderLimit, maxReminderLimit, &dueAt, &reminderID)
+	if !ok {
+		return
+	}
+
+	where := " WHERE r.user_id = ? AND r.status = ?"
+	args := []interface{}{userID, status}
+	if contactID := c.Param("id"); contactID != "" {
+		where += " AND r.contact_id = ?"
+		args = append(args, contactID)
+	}
+	var total int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM reminders r"+where, args...).Scan(&total); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count reminders: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch reminders",
+		})
+		return
+	}
+	condition, afterArgs := page.Condition(false, "r.due_at", "r.id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		"SELECT "+reminderColumns+" FROM reminders r JOIN contacts c ON c.id = r.contact_id"+where+" AND "+condition+" ORDER BY r.due_at, r.id"+limit,
+		append(append(args, afterArgs...), limitArgs...)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch reminders: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch reminders",
+		})
+		return
+	}
+	defer rows.Close()
+
+	reminders := []models.Reminder{}
+	for rows.Next() {
+		reminder, err := a.scanReminder(c.Request.Context(), rows)
+		if err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan reminder: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch reminders",
+			})
+			return
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating reminders: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch reminders",
+		})
+		return
+	}
+
+	next := ""
+	if len(reminders) == page.Limit {
+		last := reminders[len(reminders)-1]
+		next = listCursor(last.DueAt, last.ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    reminders,
+	})
+}
+
+// updateReminderState applies an UPDATE to one of the user's active
+// reminders and responds with the result
+func (a *App) updateReminderState(c *gin.Context, failure, set string, args ...interface{}) {
+	userID, _ := c.Get("user_id")
+	reminderID := c.Param("id")
+
+	args = append(args, time.Now().UTC(), reminderID, userID, reminderActive)
+	result, err := a.store.DB.ExecContext(c.Request.Context(),
+		"UPDATE reminders SET "+set+", updated_at = ? WHERE id = ? AND user_id = ? AND status = ?",
+		args...,
+	)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to update reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Active reminder not found",
+		})
+		return
+	}
+
+	reminder, err := a.loadReminder(c.Request.Context(), userID, reminderID)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   failure,
+		})
+		return
+	}
+
+	wakeReminders()
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    reminder,
+	})
+}
+
+// snoozeRequest is the body of a request to snooze a reminder
+type snoozeRequest struct {
+	Until time.Time `json:"until" binding:"required"`
+}
+
+// SnoozeReminder postpones a reminder until the given time. A snoozed
+// recurring reminder continues its schedule from the new time.
+func (a *App) SnoozeReminder(c *gin.Context) {
+	var req snoozeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !req.Until.After(time.Now()) {
+		respondValidation(c, models.ValidationError{Field: "until", Message: "Snooze time must be in the future"})
+		return
+	}
+
+	a.updateReminderState(c, "Failed to snooze reminder", "due_at = ?, notified_at = NULL", req.Until.UTC())
+}
+
+// CompleteReminder marks a reminder as done. Recurring reminders move on to
+// their next occurrence instead of completing.
+func (a *App) CompleteReminder(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	reminder, err := a.loadReminder(c.Request.Context(), userID, c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && reminder.Status != reminderActive) {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Active reminder not found",
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to complete reminder",
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	if reminder.Repeat == nil {
+		a.updateReminderState(c, "Failed to complete reminder", "status = ?, completed_at = ?", reminderCompleted, now)
+		return
+	}
+
+	next := reminder.Repeat.Next(reminder.DueAt)
+	for !next.After(now) {
+		next = reminder.Repeat.Next(next)
+	}
+	a.updateReminderState(c, "Failed to complete reminder", "due_at = ?, notified_at = NULL, completed_at = ?", next, now)
+}
+
+// DeleteReminder removes one of the user's reminders
+func (a *App) DeleteReminder(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := a.store.DB.ExecContext(c.Request.Context(), "DELETE FROM reminders WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete reminder: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete reminder",
+		})
+		return
+	}
+
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Reminder not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Reminder deleted successfully",
+	})
+}
+
+// reminderWake triggers an immediate check for due reminders
+var reminderWake = make(chan struct{}, 1)
+
+// wakeReminders checks for due reminders without waiting for the next poll
+func wakeReminders() {
+	select {
+	case reminderWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunReminders delivers reminders as they become due
+func (a *App) RunReminders() {
+	ticker := time.NewTicker(reminderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-reminderWake:
+		}
+		sent, err := a.sendDueReminders(context.Background(), time.Now().UTC())
+		if err != nil {
+			logging.Errorf("Failed to send reminders: %v", err)
+		}
+		if sent > 0 {
+			logging.Infof("Sent %d contact reminders", sent)
+		}
+	}
+}
+
+// dueReminder is a due reminder with the user's delivery preferences
+type dueReminder struct {
+	models.Reminder
+	userID    int
+	email     string
+	byMail    bool
+	byPush    bool
+	bySMS     bool
+	smsNumber string
+}
+
+// sendDueReminders notifies users of reminders that have become due,
+// once per occurrence, returning the number sent. Reminders due during a
+// user's quiet hours wait until the quiet hours end.
+func (a *App) sendDueReminders(ctx context.Context, now time.Time) (int, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT `+reminderColumns+`, r.user_id, u.email,
+		COALESCE(s.reminder_email, FALSE), COALESCE(s.reminder_push, TRUE), COALESCE(s.reminder_sms, FALSE), COALESCE(s.sms_number, ''),
+		COALESCE(s.quiet_hours_enabled, FALSE), COALESCE(s.quiet_hours_start, 0), COALESCE(s.quiet_hours_end, 0),
+		COALESCE(s.timezone, 'UTC')
+		FROM reminders r
+		JOIN contacts c ON c.id = r.contact_id
+		JOIN users u ON u.id = r.user_id
+		LEFT JOIN notification_settings s ON s.user_id = r.user_id
+		WHERE r.status = ? AND r.due_at <= ? AND r.notified_at IS NULL
+		ORDER BY r.due_at`,
+		reminderActive, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch due reminders: %v", err)
+	}
+	var due []dueReminder
+	for rows.Next() {
+		var d dueReminder
+		var quiet models.QuietHours
+		var timezone string
+		extra := []interface{}{
+			&d.userID, &d.email, &d.byMail, &d.byPush, &d.bySMS, &d.smsNumber,
+			&quiet.Enabled, &quiet.Start, &quiet.End, &timezone,
+		}
+		reminder, err := a.scanReminder(ctx, rows, extra...)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan reminder: %v", err)
+		}
+		d.Reminder = reminder
+		if quiet.Contains(now.In(loadLocation(timezone)).Hour()) {
+			continue
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range due {
+		// Claim the reminder so other instances don't send it too
+		result, err := a.store.DB.ExecContext(ctx, "UPDATE reminders SET notified_at = ? WHERE id = ? AND notified_at IS NULL", now, d.ID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to claim reminder: %v", err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+		if err := a.sendReminder(ctx, d); err != nil {
+			logging.Errorf("Failed to send reminder %d: %v", d.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sendReminder notifies a user of a due reminder through the channels they
+// chose for reminders
+func (a *App) sendReminder(ctx context.Context, d dueReminder) error {
+	title := fmt.Sprintf("Reminder: get in touch with %s", d.ContactName)
+	body := d.Note
+	if body == "" {
+		body = fmt.Sprintf("It's time to reach out to %s.", d.ContactName)
+	}
+
+	n := models.Notification{UserID: d.userID, Kind: notificationReminder, Subject: title, Body: body}
+	var notifications []models.Notification
+	if d.byPush {
+		push := n
+		push.Channel = channelPush
+		push.Data = map[string]string{
+			"type":        "contact_reminder",
+			"reminder_id": strconv.Itoa(d.ID),
+			"contact_id":  strconv.Itoa(d.ContactID),
+		}
+		notifications = append(notifications, push)
+	}
+	if d.bySMS && d.smsNumber != "" {
+		sms := n
+		sms.Channel, sms.To, sms.Body = channelSMS, d.smsNumber, "PhoneSaver: "+title+". "+body
+		notifications = append(notifications, sms)
+	}
+	if d.byMail {
+		email := n
+		email.Channel, email.To, email.Body = channelEmail, d.email, fmt.Sprintf("Hi,\n\n%s\n\n-- PhoneSaver\n", body)
+		notifications = append(notifications, email)
+	}
+
+	for _, notification := range notifications {
+		if err := a.sendNotification(ctx, notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
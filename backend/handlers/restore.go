@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/services"
+)
+
+// parseRestoreMode reads the ?mode= query parameter, defaulting to replace
+func parseRestoreMode(c *gin.Context) (string, bool) {
+	mode := c.DefaultQuery("mode", services.RestoreModeReplace)
+	if mode != services.RestoreModeReplace && mode != services.RestoreModeMerge {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error: models.ValidationError{
+				Field:   "mode",
+				Message: "Mode must be either replace or merge",
+			},
+		})
+		return "", false
+	}
+	return mode, true
+}
+
+// applyRestore restores contacts for a user in the given mode and returns a
+// summary of the changes made
+func (a *App) applyRestore(ctx context.Context, userID int, mode string, contacts []models.Contact) (models.RestorePlan, error) {
+	plan, err := a.contactService.Restore(ctx, userID, mode, contacts)
+	if err != nil {
+		return plan, err
+	}
+
+	// Too many contacts may have changed to send individually
+	a.publish(userID, models.ContactEvent{Type: eventContactsRestored})
+	return plan, nil
+}
+
+// PreviewRestore reports what restoring the backup would change without
+// modifying any local contacts
+func (a *App) PreviewRestore(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	ctx := c.Request.Context()
+
+	mode, ok := parseRestoreMode(c)
+	if !ok {
+		return
+	}
+
+	key, ok := a.resolveBackupKey(c, userID.(int), false)
+	if !ok {
+		return
+	}
+
+	backup, err := a.backupService.LoadContacts(ctx, userID.(int), key)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch contacts from backup store: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to preview restore",
+		})
+		return
+	}
+
+	local, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to load local contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to preview restore",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"backup_count": len(backup),
+			"local_count":  len(local),
+			"plan":         services.PlanRestore(mode, local, backup),
+		},
+	})
+}
+
+// RestoreContacts restores contacts from backup. With ?mode=merge restored
+// contacts are upserted instead of replacing every local contact. With
+// ?async=true the restore runs as a background job.
+func (a *App) RestoreContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	mode, ok := parseRestoreMode(c)
+	if !ok {
+		return
+	}
+
+	key, ok := a.resolveBackupKey(c, userID.(int), false)
+	if !ok {
+		return
+	}
+
+	event := newAuditEvent(c, userID.(int), auditRestore, map[string]string{"mode": mode})
+
+	if c.Query("async") == "true" {
+		a.startJobResponse(c, userID.(int), jobTypeRestore, func(ctx context.Context, progress progressFunc) (interface{}, error) {
+			plan, err := a.runRestore(ctx, userID.(int), mode, key, progress)
+			if err == nil {
+				a.audit(ctx, event)
+			}
+			return plan, err
+		})
+		return
+	}
+
+	plan, err := a.runRestore(c.Request.Context(), userID.(int), mode, key, nil)
+	if err != nil {
+		respondError(c, err, "Failed to restore contacts")
+		return
+	}
+	a.audit(c.Request.Context(), event)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"message": "Contacts restored successfully",
+			"plan":    plan,
+		},
+	})
+}
+
+// runRestore restores the user's contacts from the backup store
+func (a *App) runRestore(ctx context.Context, userID int, mode string, key []byte, progress progressFunc) (models.RestorePlan, error) {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	progress(0, 2)
+
+	// Get contacts from the backup store
+	contacts, err := a.backupService.LoadContacts(ctx, userID, key)
+	if err != nil {
+		return models.RestorePlan{}, fmt.Errorf("failed to fetch contacts from backup store: %v", err)
+	}
+	progress(1, 2)
+
+	plan, err := a.applyRestore(ctx, userID, mode, contacts)
+	if err != nil {
+		return models.RestorePlan{}, err
+	}
+	progress(2, 2)
+	return plan, nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// RunBackupCleanup periodically enforces the backup retention policy
+func (a *App) RunBackupCleanup(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pruned, err := a.pruneBackups(context.Background(), a.cfg.BackupKeepLast, a.cfg.BackupRetention)
+		if err != nil {
+			logging.Errorf("Failed to prune backups: %v", err)
+			continue
+		}
+		if pruned > 0 {
+			logging.Infof("Pruned %d expired backup manifests", pruned)
+		}
+	}
+}
+
+// pruneBackups deletes backup manifests beyond the newest keepLast per user
+// and those older than maxAge. The latest completed backup of each user is
+// always kept since it describes the current contents of the backup store.
+func (a *App) pruneBackups(ctx context.Context, keepLast int, maxAge time.Duration) (int64, error) {
+	const latestCompleted = `
+		SELECT id FROM (
+			SELECT MAX(id) AS id FROM backups WHERE status = 'completed' GROUP BY user_id
+		) latest`
+
+	var pruned int64
+	if keepLast > 0 {
+		result, err := a.store.DB.ExecContext(ctx, `
+			DELETE FROM backups WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY started_at DESC, id DESC) AS rn
+					FROM backups
+				) ranked WHERE rn > ?
+			) AND id NOT IN (`+latestCompleted+`)`,
+			keepLast,
+		)
+		if err != nil {
+			return pruned, err
+		}
+		n, _ := result.RowsAffected()
+		pruned += n
+	}
+
+	if maxAge > 0 {
+		result, err := a.store.DB.ExecContext(ctx,
+			"DELETE FROM backups WHERE started_at < ? AND id NOT IN ("+latestCompleted+")",
+			time.Now().UTC().Add(-maxAge),
+		)
+		if err != nil {
+			return pruned, err
+		}
+		n, _ := result.RowsAffected()
+		pruned += n
+	}
+	return pruned, nil
+}
+
+// ListBackups returns the user's backup manifests, newest first, along with
+// their quota usage
+func (a *App) ListBackups(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	plan, ok := a.loadPlan(c, userID.(int), "Failed to fetch backups")
+	if !ok {
+		return
+	}
+
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		`SELECT id, user_id, mode, status, written, deleted, unchanged, total, checksum, encrypted, size_bytes, started_at, completed_at
+		FROM backups WHERE user_id = ? ORDER BY started_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch backups: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch backups",
+		})
+		return
+	}
+	defer rows.Close()
+
+	backups := []models.BackupManifest{}
+	foundLatest := false
+	quota := models.BackupQuota{
+		MaxBytes:     plan.BackupMaxBytes,
+		MaxSnapshots: a.cfg.BackupKeepLast,
+	}
+	for rows.Next() {
+		var manifest models.BackupManifest
+		var checksum sql.NullString
+		var completedAt sql.NullTime
+		if err := rows.Scan(
+			&manifest.ID, &manifest.UserID, &manifest.Mode, &manifest.Status, &manifest.Written, &manifest.Deleted,
+			&manifest.Unchanged, &manifest.Total, &checksum, &manifest.Encrypted, &manifest.SizeBytes,
+			&manifest.StartedAt, &completedAt,
+		); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan backup: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch backups",
+			})
+			return
+		}
+		manifest.Checksum = checksum.String
+		if completedAt.Valid {
+			manifest.CompletedAt = &completedAt.Time
+		}
+
+		// The store only holds the latest completed backup
+		if manifest.Status == "completed" && !foundLatest {
+			quota.UsedBytes = manifest.SizeBytes
+			foundLatest = true
+		}
+		backups = append(backups, manifest)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating backups: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch backups",
+		})
+		return
+	}
+	quota.Snapshots = len(backups)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"backups": backups,
+			"quota":   quota,
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// scopedTokenResponse is the data of a new import or access token
+type scopedTokenResponse struct {
+	Token     string    `json:"token"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// accessTokenRequest is the body of a request for an access token, listing
+// the scopes it grants
+type accessTokenRequest struct {
+	Scopes []string `json:"scopes" binding:"required,min=1,max=4,unique,dive,oneof=read:contacts write:contacts backup lookup:contacts"`
+}
+
+// CreateImportToken issues a token that can only create contacts in bulk,
+// for an import tool to use instead of the user's session. It expires after
+// IMPORT_TOKEN_LIFETIME.
+func (a *App) CreateImportToken(c *gin.Context) {
+	a.createScopedToken(c, []string{middleware.ScopeImportContacts}, a.cfg.ImportTokenLifetime, auditImportTokenCreated)
+}
+
+// CreateAccessToken issues a token limited to the routes of the scopes
+// asked for, so an integration gets no more access than it needs. It
+// expires after ACCESS_TOKEN_LIFETIME.
+func (a *App) CreateAccessToken(c *gin.Context) {
+	var req accessTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	a.createScopedToken(c, req.Scopes, a.cfg.AccessTokenLifetime, auditAccessTokenCreated)
+}
+
+// createScopedToken issues a token granting scopes on the user's data and
+// records it in the audit log as action
+func (a *App) createScopedToken(c *gin.Context, scopes []string, lifetime time.Duration, action string) {
+	userID, _ := c.Get("user_id")
+
+	token, expiresAt, err := a.authService.IssueScopedToken(c.Request.Context(), userID.(int), scopes, lifetime)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to issue scoped token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create token",
+		})
+		return
+	}
+	a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), action, map[string]string{
+		"scopes":     strings.Join(scopes, " "),
+		"expires_at": expiresAt.Format(time.RFC3339),
+	}))
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    scopedTokenResponse{Token: token, Scopes: scopes, ExpiresAt: expiresAt},
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	firebase "firebase.google.com/go/v4"
+	"google.golang.org/api/option"
+
+	"cloud.google.com/go/firestore"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/gorilla/websocket"
+	"phonesaver-backend/config"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/services"
+)
+
+// App holds the dependencies of the handlers and background workers: the
+// configuration, storage, and the services notifications are sent through
+type App struct {
+	cfg     *config.Config
+	jwtKey  []byte
+	store   *repository.Store
+	backups repository.BackupStore
+	mailer  Mailer
+	sms     SMSSender
+	slack   *slackPoster
+	captcha CaptchaVerifier
+	pusher  Pusher
+	// phoneVerifier verifies contacts' phone numbers, and is nil when
+	// phone verification is off
+	phoneVerifier PhoneVerifier
+	// spamChecker reports spam numbers, and is nil when only users' blocked
+	// numbers are flagged
+	spamChecker SpamChecker
+	// enricher suggests contacts' photos and companies, and is nil when
+	// contacts aren't enriched
+	enricher ContactEnricher
+	// stripe bills for plans, and is nil when billing is off
+	stripe *stripeClient
+	// contactProviders are the contact providers users can sync with, by
+	// name
+	contactProviders map[string]contactProvider
+
+	graphQL  *handler.Server
+	upgrader *websocket.Upgrader
+
+	authService    *services.Auth
+	contactService *services.Contacts
+	backupService  *services.Backups
+
+	events       *eventHub
+	changePushes *changeNotifier
+}
+
+// New connects to Firebase and creates the backup store, mailer and SMS
+// sender the handlers use alongside store, and the services over them
+func New(cfg *config.Config, store *repository.Store) (*App, error) {
+	a := &App{
+		cfg:      cfg,
+		jwtKey:   []byte(cfg.JWTSecret),
+		store:    store,
+		upgrader: newUpgrader(cfg),
+		events:   newEventHub(),
+	}
+	a.changePushes = newChangeNotifier(a)
+	fs, err := a.initFirebase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.backups, err = repository.NewBackupStore(context.Background(), cfg, fs)
+	if err != nil {
+		if fs != nil {
+			fs.Close()
+		}
+		return nil, err
+	}
+
+	a.mailer, err = newMailer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.sms, err = newSMSSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.slack = newSlackPoster()
+	a.stripe = newStripeClient(cfg)
+	a.contactProviders = newContactProviders(cfg)
+
+	a.captcha, err = newCaptchaVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.phoneVerifier, err = newPhoneVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.spamChecker, err = newSpamChecker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.enricher, err = newContactEnricher(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.authService = services.NewAuth(store.Users, store.Devices, store.RefreshTokens, store.LoginNetworks, a.jwtKey, cfg.RefreshTokenLifetime)
+	a.contactService = services.NewContacts(store.Contacts)
+	a.backupService = services.NewBackups(store, a.backups)
+
+	a.graphQL = a.newGraphQLServer()
+	return a, nil
+}
+
+// Backups returns the store backups are kept in
+func (a *App) Backups() repository.BackupStore {
+	return a.backups
+}
+
+// initFirebase sets up push notifications through Firebase. It returns a
+// Firestore client only when backups are kept in Firestore, and nil otherwise.
+func (a *App) initFirebase(cfg *config.Config) (*firestore.Client, error) {
+	ctx := context.Background()
+	opt := option.WithCredentialsFile(cfg.FirebaseConfig)
+	// The Firestore emulator takes requests without credentials, and the
+	// project is then read from GOOGLE_CLOUD_PROJECT
+	if cfg.FirebaseConfig == "" && os.Getenv("FIRESTORE_EMULATOR_HOST") != "" {
+		opt = option.WithoutAuthentication()
+	}
+	app, err := firebase.NewApp(ctx, nil, opt)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing firebase app: %v", err)
+	}
+
+	messagingClient, err := app.Messaging(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing messaging client: %v", err)
+	}
+	a.pusher = newPusher(messagingClient)
+
+	if cfg.BackupStore != config.BackupStoreFirestore {
+		return nil, nil
+	}
+	fs, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing firestore client: %v", err)
+	}
+	return fs, nil
+}
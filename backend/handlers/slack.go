@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+const (
+	// slackWebhookPrefix starts the URL of every Slack incoming webhook
+	slackWebhookPrefix = "https://hooks.slack.com/"
+	// slackBotTokenPrefix starts Slack bot tokens
+	slackBotTokenPrefix = "xoxb-"
+	// slackAPIURL is the root of the Slack Web API
+	slackAPIURL = "https://slack.com/api"
+)
+
+// errSlackNotConnected is returned for Slack notifications to users who
+// have since disconnected Slack
+var errSlackNotConnected = errors.New("slack is not connected")
+
+// slackEscaper escapes the characters Slack treats as markup in message text
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackPoster posts messages to users' Slack workspaces, through their
+// incoming webhook or with their bot token
+type slackPoster struct {
+	apiURL string
+	client *http.Client
+}
+
+func newSlackPoster() *slackPoster {
+	return &slackPoster{apiURL: slackAPIURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// slackRecipient is how a Slack destination is shown in the notification
+// history: its channel, or "webhook" for a webhook posting to the channel it
+// was created for
+func slackRecipient(channel string) string {
+	if channel == "" {
+		return "webhook"
+	}
+	return channel
+}
+
+// postSlack posts text to the user's Slack. The destination is read when the
+// message is sent, so retries stop once the user disconnects Slack.
+func (a *App) postSlack(ctx context.Context, userID int, text string) error {
+	var dest models.SlackSettings
+	err := a.store.DB.QueryRowContext(ctx,
+		"SELECT slack_webhook_url, slack_bot_token, slack_channel FROM notification_settings WHERE user_id = ?",
+		userID,
+	).Scan(&dest.WebhookURL, &dest.BotToken, &dest.Channel)
+	if err == sql.ErrNoRows || (err == nil && dest.WebhookURL == "" && dest.BotToken == "") {
+		return permanent(errSlackNotConnected)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load Slack settings: %v", err)
+	}
+	return a.slack.post(ctx, dest, text)
+}
+
+// post posts text through dest's incoming webhook, or by its bot to its
+// channel
+func (s *slackPoster) post(ctx context.Context, dest models.SlackSettings, text string) error {
+	if dest.BotToken == "" {
+		return s.postWebhook(ctx, dest.WebhookURL, text)
+	}
+	return s.postMessage(ctx, dest.BotToken, dest.Channel, text)
+}
+
+// postWebhook posts to an incoming webhook, which answers errors such as a
+// removed webhook or archived channel with an error status and code
+func (s *slackPoster) postWebhook(ctx context.Context, webhookURL, text string) error {
+	resp, err := s.send(ctx, webhookURL, "", map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		code, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		err := fmt.Errorf("failed to post to Slack: webhook returned %s: %s", resp.Status, strings.TrimSpace(string(code)))
+		if !retryableStatus(resp.StatusCode) {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// postMessage posts with chat.postMessage, which reports most errors, such
+// as a revoked token or a channel the bot isn't in, in a successful response
+func (s *slackPoster) postMessage(ctx context.Context, token, channel, text string) error {
+	resp, err := s.send(ctx, s.apiURL+"/chat.postMessage", token, map[string]string{"channel": channel, "text": text})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("failed to post to Slack: Slack returned %s", resp.Status)
+		if !retryableStatus(resp.StatusCode) {
+			return permanent(err)
+		}
+		return err
+	}
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode Slack response: %v", err)
+	}
+	if result.OK {
+		return nil
+	}
+	err = fmt.Errorf("failed to post to Slack: %s", result.Error)
+	switch result.Error {
+	case "internal_error", "fatal_error", "service_unavailable", "request_timeout", "ratelimited":
+		return err
+	}
+	return permanent(err)
+}
+
+// send posts body as JSON, authorized with token if set
+func (s *slackPoster) send(ctx context.Context, url, token string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Slack message: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to post to Slack: %v", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+)
+
+// phoneNumberPattern matches E.164 phone numbers, as required by Twilio
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SMSSender sends text messages through a configured provider
+type SMSSender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// newSMSSender creates a Twilio sender when TWILIO_ACCOUNT_SID is set.
+// Without it text messages are only logged.
+func newSMSSender(cfg *config.Config) (SMSSender, error) {
+	if cfg.TwilioAccountSID == "" {
+		return logSMSSender{}, nil
+	}
+	if cfg.TwilioAuthToken == "" || cfg.TwilioFromNumber == "" {
+		return nil, fmt.Errorf("TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER must be set to send SMS through Twilio")
+	}
+	return &twilioSender{
+		accountSID: cfg.TwilioAccountSID,
+		authToken:  cfg.TwilioAuthToken,
+		from:       cfg.TwilioFromNumber,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// logSMSSender writes text messages to the log instead of sending them
+type logSMSSender struct{}
+
+func (logSMSSender) Send(ctx context.Context, to, body string) error {
+	logging.Infof("SMS to %s: %s", to, body)
+	return nil
+}
+
+// twilioSender sends text messages through the Twilio Messaging API
+type twilioSender struct {
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+func (s *twilioSender) Send(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("From", s.from)
+	form.Set("To", to)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", s.accountSID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("failed to send SMS: Twilio returned %s", resp.Status)
+		if !retryableStatus(resp.StatusCode) {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
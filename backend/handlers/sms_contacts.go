@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// smsLinkCommand starts the text linking the phone it is sent from
+	smsLinkCommand = "LINK"
+	// smsLinkCodeLifetime is how long a link code can be texted
+	smsLinkCodeLifetime = 15 * time.Minute
+	// smsLinkCodeAlphabet leaves out letters and digits easily mistaken for
+	// one another when typed from the app into a text
+	smsLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	smsLinkCodeLength   = 8
+)
+
+// Replies to texts that don't save a contact
+const (
+	smsHelpReply      = `Text a name and number, like "John 555-0101", to save a contact to PhoneSaver.`
+	smsNotLinkedReply = "This number isn't linked to a PhoneSaver account. Link it in the app's settings first."
+	smsBadCodeReply   = "That link code is invalid or has expired. Get a new one in the PhoneSaver app."
+	smsSuspendedReply = "Your PhoneSaver account is suspended."
+	smsLimitReply     = "Your PhoneSaver plan's contact limit is reached; upgrade to Pro to save more."
+	smsFailedReply    = "Sorry, that contact couldn't be saved. Please try again later."
+)
+
+// requireSMSContacts reports whether contacts can be saved by text, which
+// needs Twilio to receive the texts, responding with 404 if not
+func (a *App) requireSMSContacts(c *gin.Context) bool {
+	if a.cfg.TwilioAccountSID == "" {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Saving contacts by text is not enabled",
+		})
+		return false
+	}
+	return true
+}
+
+// GetSMSContacts returns the number to text contacts to, and the user's
+// phone linked to it
+func (a *App) GetSMSContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if !a.requireSMSContacts(c) {
+		return
+	}
+
+	settings := models.SMSContactSettings{Number: a.cfg.TwilioFromNumber}
+	linked, err := a.store.SMSContactNumbers.Get(c.Request.Context(), userID.(int))
+	if err != nil && err != repository.ErrNotFound {
+		middleware.RequestLogger(c).Errorf("Failed to load linked phone: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to load text message settings",
+		})
+		return
+	}
+	settings.Phone, settings.LinkedAt = linked.Phone, linked.LinkedAt
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    settings,
+	})
+}
+
+// CreateSMSLinkCode issues a code for the user to text from their phone,
+// replacing any previous code. The phone already linked stays linked until
+// the code is texted.
+func (a *App) CreateSMSLinkCode(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if !a.requireSMSContacts(c) {
+		return
+	}
+
+	code, err := newSMSLinkCode()
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to generate link code: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create link code",
+		})
+		return
+	}
+	expiresAt := time.Now().UTC().Add(smsLinkCodeLifetime)
+	if err := a.store.SMSContactNumbers.SetLinkCode(c.Request.Context(), userID.(int), hashSMSLinkCode(code), expiresAt); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to store link code: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create link code",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.SMSLinkCode{
+			Code:      code,
+			Number:    a.cfg.TwilioFromNumber,
+			Message:   smsLinkCommand + " " + code,
+			ExpiresAt: expiresAt,
+		},
+	})
+}
+
+// DeleteSMSContacts unlinks the user's phone, and drops any pending link
+// code
+func (a *App) DeleteSMSContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if !a.requireSMSContacts(c) {
+		return
+	}
+
+	removed, err := a.store.SMSContactNumbers.Delete(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to unlink phone: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to unlink phone",
+		})
+		return
+	}
+	if removed {
+		a.audit(c.Request.Context(), newAuditEvent(c, userID.(int), auditSMSPhoneUnlinked, nil))
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Phone unlinked successfully",
+	})
+}
+
+// ReceiveSMS answers the texts Twilio forwards to TWILIO_FROM_NUMBER. A
+// text of "LINK" and a link code links the phone it was sent from to the
+// code's user, and a name and number texted from a linked phone is saved as
+// one of its user's contacts. Every text is answered, with TwiML telling
+// Twilio what to reply. Requests must be signed with TWILIO_AUTH_TOKEN.
+func (a *App) ReceiveSMS(c *gin.Context) {
+	if !a.requireSMSContacts(c) {
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		if middleware.IsBodyTooLarge(err) {
+			middleware.RespondBodyTooLarge(c, a.cfg.MaxBodyBytes)
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	signedURL := absoluteURL(c, c.Request.URL.RequestURI())
+	if !validTwilioSignature(a.cfg.TwilioAuthToken, signedURL, c.Request.PostForm, c.GetHeader("X-Twilio-Signature")) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Invalid signature",
+		})
+		return
+	}
+
+	from, body := c.PostForm("From"), strings.TrimSpace(c.PostForm("Body"))
+	var reply string
+	var err error
+	if command, code, _ := strings.Cut(body, " "); strings.EqualFold(command, smsLinkCommand) {
+		reply, err = a.linkSMSPhone(c, from, code)
+	} else {
+		reply, err = a.saveTextedContact(c, from, body)
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to answer text message: %v", err)
+		reply = smsFailedReply
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", twimlMessage(reply))
+}
+
+// linkSMSPhone links the phone a link code was texted from to the code's
+// user, unlinking it from any other user
+func (a *App) linkSMSPhone(c *gin.Context, from, code string) (string, error) {
+	ctx := c.Request.Context()
+	code = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	if !phoneNumberPattern.MatchString(from) || len(code) != smsLinkCodeLength {
+		return smsBadCodeReply, nil
+	}
+
+	userID, err := a.store.SMSContactNumbers.Link(ctx, hashSMSLinkCode(code), from, time.Now().UTC())
+	if err == repository.ErrNotFound {
+		return smsBadCodeReply, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to link phone: %v", err)
+	}
+	a.audit(ctx, newAuditEvent(c, userID, auditSMSPhoneLinked, nil))
+	return "This number is now linked to your PhoneSaver account. " + smsHelpReply, nil
+}
+
+// saveTextedContact saves the contact texted from a linked phone to its
+// user's contacts, unless they already have the number
+func (a *App) saveTextedContact(c *gin.Context, from, body string) (string, error) {
+	ctx := c.Request.Context()
+	linked, err := a.store.SMSContactNumbers.FindByPhone(ctx, from)
+	if err == repository.ErrNotFound {
+		return smsNotLinkedReply, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up linked phone: %v", err)
+	}
+	userID := linked.UserID
+	user, err := a.store.Users.Get(ctx, userID)
+	if err == repository.ErrNotFound {
+		return smsNotLinkedReply, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load user: %v", err)
+	}
+	if user.SuspendedAt != nil {
+		return smsSuspendedReply, nil
+	}
+
+	contact, ok := parseTextedContact(body)
+	if !ok {
+		return smsHelpReply, nil
+	}
+	existing, err := a.contactService.FindByPhone(ctx, userID, contact.Phone)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for duplicate contacts: %v", err)
+	}
+	if len(existing) > 0 {
+		return fmt.Sprintf("%s is already saved as %s.", contact.Phone, existing[0].Name), nil
+	}
+	full, err := a.contactLimitReached(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if full {
+		return smsLimitReply, nil
+	}
+
+	if err := a.contactService.Create(ctx, userID, &contact); err != nil {
+		return "", fmt.Errorf("failed to create contact: %v", err)
+	}
+	a.publish(userID, models.ContactEvent{Type: eventContactCreated, ContactID: contact.ID, Contact: contactResponse(contact)})
+	return fmt.Sprintf("Saved %s (%s) to your PhoneSaver contacts.", contact.Name, contact.Phone), nil
+}
+
+// parseTextedContact reads a texted contact: a name and a number, in either
+// order, like "John 555-0101". It reports whether the contact routes would
+// accept the contact.
+func parseTextedContact(body string) (models.Contact, bool) {
+	words := strings.Fields(body)
+	end := len(words)
+	for end > 0 && isPhoneWord(words[end-1]) {
+		end--
+	}
+	name, phone := words[:end], words[end:]
+	if len(phone) == 0 {
+		start := 0
+		for start < len(words) && isPhoneWord(words[start]) {
+			start++
+		}
+		name, phone = words[start:], words[:start]
+	}
+
+	contact := models.Contact{
+		Name:  strings.TrimSpace(strings.TrimRight(strings.Join(name, " "), ",:;-")),
+		Phone: strings.Join(phone, " "),
+		Tags:  []string{},
+	}
+	valid := len(validateValue(contactRequest{Name: contact.Name, Phone: contact.Phone})) == 0
+	return contact, valid
+}
+
+// isPhoneWord reports whether a word of a text is part of a phone number
+func isPhoneWord(word string) bool {
+	return strings.ContainsAny(word, "0123456789") && strings.Trim(word, "+0123456789().-") == ""
+}
+
+// newSMSLinkCode returns a random link code
+func newSMSLinkCode() (string, error) {
+	code := make([]byte, smsLinkCodeLength)
+	size := big.NewInt(int64(len(smsLinkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		code[i] = smsLinkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// hashSMSLinkCode returns the form link codes are stored in
+func hashSMSLinkCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// validTwilioSignature checks the X-Twilio-Signature header of a request
+// Twilio made: an HMAC-SHA1, with the auth token, of the URL it requested
+// followed by each POST parameter's name and value, sorted by name
+func validTwilioSignature(authToken, requestURL string, params url.Values, signature string) bool {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(requestURL))
+	for _, name := range names {
+		for _, value := range params[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	return err == nil && hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// twimlMessage returns the TwiML telling Twilio to reply with text
+func twimlMessage(text string) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + "<Response><Message>")
+	xml.EscapeText(&b, []byte(text))
+	b.WriteString("</Message></Response>")
+	return b.Bytes()
+}
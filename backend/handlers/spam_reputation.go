@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// spamCheckTimeout bounds the spam reputation provider's answer, as lookups
+// are made while a phone is ringing
+const spamCheckTimeout = 3 * time.Second
+
+// SpamChecker tells spam numbers from others at a reputation provider
+type SpamChecker interface {
+	// IsSpam reports whether phone is known for spam or robocalls
+	IsSpam(ctx context.Context, phone string) (bool, error)
+}
+
+// newSpamChecker creates the checker selected by SPAM_REPUTATION_PROVIDER,
+// or nil when only users' blocked numbers are flagged
+func newSpamChecker(cfg *config.Config) (SpamChecker, error) {
+	switch cfg.SpamReputationProvider {
+	case "", config.SpamReputationProviderNone:
+		return nil, nil
+	case config.SpamReputationProviderNomorobo:
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" {
+			return nil, fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN must be set to check spam numbers through Nomorobo")
+		}
+		return &nomoroboSpamScore{
+			endpoint:   "https://lookups.twilio.com/v1/PhoneNumbers/",
+			accountSID: cfg.TwilioAccountSID,
+			authToken:  cfg.TwilioAuthToken,
+			client:     &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown spam reputation provider %q", cfg.SpamReputationProvider)
+	}
+}
+
+// nomoroboSpamScore checks numbers with the Nomorobo Spam Score add-on of
+// Twilio Lookup, which scores robocallers and telemarketers 1 and other
+// numbers 0
+type nomoroboSpamScore struct {
+	endpoint   string
+	accountSID string
+	authToken  string
+	client     *http.Client
+}
+
+func (n *nomoroboSpamScore) IsSpam(ctx context.Context, phone string) (bool, error) {
+	endpoint := n.endpoint + url.PathEscape(repository.NormalizePhone(phone)) + "?AddOns=nomorobo_spamscore"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(n.accountSID, n.authToken)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check spam score: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Numbers Twilio can't parse, which no one calls from
+		return false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("failed to check spam score: Twilio returned %s", resp.Status)
+	}
+
+	var result struct {
+		AddOns struct {
+			Status  string `json:"status"`
+			Results map[string]struct {
+				Status string `json:"status"`
+				Result *struct {
+					Score int `json:"score"`
+				} `json:"result"`
+			} `json:"results"`
+		} `json:"add_ons"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode spam score: %v", err)
+	}
+	score, ok := result.AddOns.Results["nomorobo_spamscore"]
+	if !ok || score.Status != "successful" || score.Result == nil {
+		return false, fmt.Errorf("failed to check spam score: add-on status %q", score.Status)
+	}
+	return score.Result.Score > 0, nil
+}
+
+// phoneReputation tells whether a user blocked phone, and asks the spam
+// reputation provider about numbers they didn't when askProvider is set. A
+// provider that fails or is slow is logged and left out rather than
+// failing the request, as it only adds a warning.
+func (a *App) phoneReputation(c *gin.Context, userID int, phone string, askProvider bool) (models.PhoneReputation, error) {
+	_, err := a.store.BlockedNumbers.Find(c.Request.Context(), userID, phone)
+	if err == nil {
+		return models.PhoneReputation{Blocked: true}, nil
+	}
+	if err != repository.ErrNotFound {
+		return models.PhoneReputation{}, fmt.Errorf("failed to check blocked numbers: %v", err)
+	}
+	if !askProvider || a.spamChecker == nil {
+		return models.PhoneReputation{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), spamCheckTimeout)
+	defer cancel()
+	spam, err := a.spamChecker.IsSpam(ctx, phone)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to check spam reputation: %v", err)
+		return models.PhoneReputation{}, nil
+	}
+	return models.PhoneReputation{Spam: &spam}, nil
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"phonesaver-backend/config"
+)
+
+// stripeSignatureTolerance is how old a webhook's signature may be, which
+// keeps captured deliveries from being replayed later
+const stripeSignatureTolerance = 5 * time.Minute
+
+// errInvalidStripeSignature is returned for webhook deliveries that weren't
+// signed with the webhook secret
+var errInvalidStripeSignature = errors.New("invalid Stripe signature")
+
+// stripeClient creates Checkout and billing portal sessions through the
+// Stripe API
+type stripeClient struct {
+	secretKey     string
+	webhookSecret string
+	proPriceID    string
+	client        *http.Client
+}
+
+// newStripeClient creates a Stripe client when STRIPE_SECRET_KEY is set.
+// Without it billing is off and nil is returned.
+func newStripeClient(cfg *config.Config) *stripeClient {
+	if cfg.StripeSecretKey == "" {
+		return nil
+	}
+	return &stripeClient{
+		secretKey:     cfg.StripeSecretKey,
+		webhookSecret: cfg.StripeWebhookSecret,
+		proPriceID:    cfg.StripeProPriceID,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// stripeCheckout describes the Checkout session a user subscribes to the
+// pro plan in. Stripe creates a customer for Email unless CustomerID names
+// the one they already are.
+type stripeCheckout struct {
+	UserID     int
+	Email      string
+	CustomerID string
+	ReturnURL  string
+}
+
+// Checkout creates a Checkout session subscribing a user to the pro plan and
+// returns the URL of the page they pay on. The subscription carries the
+// user's ID, so the webhooks about it can be matched to them.
+func (s *stripeClient) Checkout(ctx context.Context, checkout stripeCheckout) (string, error) {
+	userID := strconv.Itoa(checkout.UserID)
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", s.proPriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("client_reference_id", userID)
+	form.Set("subscription_data[metadata][user_id]", userID)
+	form.Set("success_url", checkout.ReturnURL)
+	form.Set("cancel_url", checkout.ReturnURL)
+	if checkout.CustomerID != "" {
+		form.Set("customer", checkout.CustomerID)
+	} else {
+		form.Set("customer_email", checkout.Email)
+	}
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := s.post(ctx, "/v1/checkout/sessions", form, &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// Portal creates a billing portal session, where a customer changes their
+// payment details or cancels their subscription, and returns its URL
+func (s *stripeClient) Portal(ctx context.Context, customerID, returnURL string) (string, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("return_url", returnURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := s.post(ctx, "/v1/billing_portal/sessions", form, &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// post calls the Stripe API and decodes its response into out
+func (s *stripeClient) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.stripe.com"+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Stripe: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("Stripe returned %s: %s", resp.Status, body.Error.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Stripe response: %v", err)
+	}
+	return nil
+}
+
+// verify checks the Stripe-Signature header of a webhook delivery: an HMAC
+// of its timestamp and payload with the webhook secret, made within
+// stripeSignatureTolerance of now
+func (s *stripeClient) verify(payload []byte, header string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidStripeSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return errInvalidStripeSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return errInvalidStripeSignature
+}
+
+// stripeEvent is a webhook delivery. Object is the Checkout session or
+// subscription it is about.
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// stripeCheckoutSession is the object of checkout.session.completed events
+type stripeCheckoutSession struct {
+	ClientReferenceID string `json:"client_reference_id"`
+	Customer          string `json:"customer"`
+	Subscription      string `json:"subscription"`
+}
+
+// stripeSubscription is the object of customer.subscription.* events. Newer
+// API versions report the end of the billing period on the items rather
+// than the subscription.
+type stripeSubscription struct {
+	ID               string            `json:"id"`
+	Customer         string            `json:"customer"`
+	Status           string            `json:"status"`
+	CurrentPeriodEnd int64             `json:"current_period_end"`
+	Metadata         map[string]string `json:"metadata"`
+	Items            struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// periodEnd returns when the subscription's billing period ends, if Stripe
+// reported it
+func (s stripeSubscription) periodEnd() *time.Time {
+	end := s.CurrentPeriodEnd
+	if end == 0 && len(s.Items.Data) > 0 {
+		end = s.Items.Data[0].CurrentPeriodEnd
+	}
+	if end == 0 {
+		return nil
+	}
+	t := time.Unix(end, 0).UTC()
+	return &t
+}
+
+// hasPrice reports whether the subscription is to a price
+func (s stripeSubscription) hasPrice(priceID string) bool {
+	for _, item := range s.Items.Data {
+		if item.Price.ID == priceID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// syncTokenVersion prefixes sync tokens so their format can change later
+const syncTokenVersion = "1"
+
+var errInvalidSyncToken = errors.New("invalid sync token")
+
+// encodeSyncToken returns an opaque token for the given server time
+func encodeSyncToken(t time.Time) string {
+	raw := syncTokenVersion + ":" + strconv.FormatInt(t.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeSyncToken returns the server time encoded in a sync token
+func decodeSyncToken(token string) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, errInvalidSyncToken
+	}
+	version, seconds, ok := strings.Cut(string(raw), ":")
+	if !ok || version != syncTokenVersion {
+		return time.Time{}, errInvalidSyncToken
+	}
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, errInvalidSyncToken
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
+
+// SyncContacts returns the contacts created, updated, or deleted since the
+// given sync token, along with a new token to pass on the next call. Without a
+// token every contact is returned as created. Tokens older than the tombstone
+// retention window are rejected, since deletions may have been purged.
+func (a *App) SyncContacts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var since time.Time
+	if token := c.Query("since"); token != "" {
+		var err error
+		if since, err = decodeSyncToken(token); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "since",
+					Message: "Invalid sync token",
+				},
+			})
+			return
+		}
+	}
+
+	// Read the server time before the changes so that writes made while the
+	// query runs are picked up by the next sync. updated_at has second
+	// precision, so the comparison is inclusive and clients may see a contact
+	// again if it changed in the same second as the previous sync.
+	var now time.Time
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT CURRENT_TIMESTAMP").Scan(&now); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get server time: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to sync contacts",
+		})
+		return
+	}
+
+	if !since.IsZero() && a.cfg.TombstoneRetention > 0 && since.Before(now.Add(-a.cfg.TombstoneRetention)) {
+		c.JSON(http.StatusGone, models.Response{
+			Success: false,
+			Error:   "Sync token has expired. Sync again without a token",
+		})
+		return
+	}
+
+	created, updated, err := a.store.Contacts.ListChanged(c.Request.Context(), userID.(int), since)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch changed contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to sync contacts",
+		})
+		return
+	}
+
+	deleted := []models.Tombstone{}
+	if !since.IsZero() {
+		if deleted, err = a.loadTombstones(c.Request.Context(), userID, since); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to fetch tombstones: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to sync contacts",
+			})
+			return
+		}
+	}
+
+	token := encodeSyncToken(now)
+	if deviceID := c.GetString("device_id"); deviceID != "" {
+		if err := a.recordDeviceSync(c.Request.Context(), userID, deviceID, token, now); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to record device sync: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"created":    models.NewContactResponses(created),
+			"updated":    models.NewContactResponses(updated),
+			"deleted":    deleted,
+			"sync_token": token,
+		},
+	})
+}
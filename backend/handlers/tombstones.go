@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+)
+
+// tombstoneCleanupInterval is how often expired tombstones are purged
+const tombstoneCleanupInterval = time.Hour
+
+// loadTombstones returns the contacts a user deleted since the given time
+func (a *App) loadTombstones(ctx context.Context, userID interface{}, since time.Time) ([]models.Tombstone, error) {
+	rows, err := a.store.DB.QueryContext(ctx,
+		"SELECT contact_id, deleted_at FROM contact_tombstones WHERE user_id = ? AND deleted_at >= ? ORDER BY deleted_at, contact_id",
+		userID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tombstones := []models.Tombstone{}
+	for rows.Next() {
+		var tombstone models.Tombstone
+		if err := rows.Scan(&tombstone.ID, &tombstone.DeletedAt); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, rows.Err()
+}
+
+// RunTombstoneCleanup periodically purges tombstones older than the
+// retention window
+func (a *App) RunTombstoneCleanup(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(tombstoneCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := a.store.DB.ExecContext(context.Background(),
+			"DELETE FROM contact_tombstones WHERE deleted_at < ?",
+			time.Now().UTC().Add(-retention),
+		)
+		if err != nil {
+			logging.Errorf("Failed to purge tombstones: %v", err)
+			continue
+		}
+		if purged, _ := result.RowsAffected(); purged > 0 {
+			logging.Infof("Purged %d expired tombstones", purged)
+		}
+	}
+}
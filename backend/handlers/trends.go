@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+const (
+	trendIntervalWeek  = "week"
+	trendIntervalMonth = "month"
+	// trendPeriods is the number of periods in a trend series
+	trendPeriods = 12
+)
+
+// periodStart returns the start of the week (Monday) or month containing t
+func periodStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	if interval == trendIntervalWeek {
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// nextPeriod returns the start of the period following start
+func nextPeriod(start time.Time, interval string) time.Time {
+	if interval == trendIntervalWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// loadTrends builds a series of the last trendPeriods periods, ending with
+// the current one
+func (a *App) loadTrends(ctx context.Context, userID interface{}, interactions []models.Interaction, interval string, now time.Time) ([]models.TrendPoint, error) {
+	start := periodStart(now, interval)
+	for i := 1; i < trendPeriods; i++ {
+		if interval == trendIntervalWeek {
+			start = start.AddDate(0, 0, -7)
+		} else {
+			start = start.AddDate(0, -1, 0)
+		}
+	}
+
+	var total int
+	if err := a.store.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM contacts WHERE user_id = ? AND created_at < ?", userID, start).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.store.DB.QueryContext(ctx, "SELECT created_at FROM contacts WHERE user_id = ? AND created_at >= ?", userID, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	created := make(map[time.Time]int)
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		created[periodStart(createdAt, interval)]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[time.Time]int)
+	for _, interaction := range interactions {
+		if !interaction.Timestamp.Before(start) {
+			recorded[periodStart(interaction.Timestamp, interval)]++
+		}
+	}
+
+	points := make([]models.TrendPoint, 0, trendPeriods)
+	for period := start; len(points) < trendPeriods; period = nextPeriod(period, interval) {
+		total += created[period]
+		points = append(points, models.TrendPoint{
+			PeriodStart:     period,
+			ContactsCreated: created[period],
+			Interactions:    recorded[period],
+			TotalContacts:   total,
+		})
+	}
+	return points, nil
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// usageRollupInterval is how often the usage metered on past days is
+	// rolled up
+	usageRollupInterval = time.Hour
+	// defaultUsageDays and maxUsageDays are how many days of usage are
+	// returned by default and at most
+	defaultUsageDays = 30
+	maxUsageDays     = 365
+)
+
+// RunUsageRollups periodically rolls up the usage metered on past days into
+// every account's daily usage
+func (a *App) RunUsageRollups() {
+	ticker := time.NewTicker(usageRollupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		days, err := a.store.Usage.RollUp(context.Background(), time.Now())
+		if err != nil {
+			logging.Errorf("Failed to roll up usage: %v", err)
+			continue
+		}
+		if days > 0 {
+			logging.Infof("Rolled up %d days of usage", days)
+		}
+	}
+}
+
+// GetUsage returns the user's usage on each of the last ?days days, 30 by
+// default, including today's so far
+func (a *App) GetUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	a.respondUsage(c, userID.(int))
+}
+
+// GetUserUsage returns an account's usage like GetUsage, for admins
+func (a *App) GetUserUsage(c *gin.Context) {
+	userID, ok := userParam(c)
+	if !ok {
+		return
+	}
+	a.respondUsage(c, userID)
+}
+
+// respondUsage responds with a user's usage over the days in ?days
+func (a *App) respondUsage(c *gin.Context, userID int) {
+	days := defaultUsageDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxUsageDays {
+			respondValidation(c, models.ValidationError{Field: "days", Message: fmt.Sprintf("Days must be between 1 and %d", maxUsageDays)})
+			return
+		}
+		days = n
+	}
+
+	now := time.Now()
+	usageDays, err := a.store.Usage.Days(c.Request.Context(), userID, now.AddDate(0, 0, 1-days), now)
+	if err == repository.ErrNotFound {
+		respondUserNotFound(c)
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch usage: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch usage",
+		})
+		return
+	}
+
+	usage := models.Usage{Days: usageDays}
+	for _, day := range usageDays {
+		usage.APICalls += day.APICalls
+		usage.Backups += day.Backups
+		usage.BackupBytes += day.BackupBytes
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    usage,
+	})
+}
+
+// meterBackup adds a backup of size bytes to a user's usage
+func (a *App) meterBackup(ctx context.Context, userID int, size int64) {
+	if err := a.store.Usage.Add(ctx, userID, repository.MetricBackups, 1); err != nil {
+		logging.Errorf("Failed to meter backup: %v", err)
+		return
+	}
+	if err := a.store.Usage.Add(ctx, userID, repository.MetricBackupBytes, size); err != nil {
+		logging.Errorf("Failed to meter backup: %v", err)
+	}
+}
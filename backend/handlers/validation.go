@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"phonesaver-backend/models"
+)
+
+const (
+	// birthdayLayout is the format of birthdays given as strings
+	birthdayLayout = "2006-01-02"
+	// maxTagsLen bounds a contact's tags, which are stored comma-separated
+	maxTagsLen = 255
+	// minPasswordLen and maxPasswordLen bound the passwords accepted at signup
+	minPasswordLen = 8
+	maxPasswordLen = 100
+	// minPhoneDigits and maxPhoneDigits bound the digits of a contact's
+	// phone number; E.164 numbers have at most 15
+	minPhoneDigits = 3
+	maxPhoneDigits = 15
+)
+
+func init() {
+	binding.Validator = &requestValidator{}
+}
+
+// requestValidator checks request bodies against the binding tags of their
+// fields. Unlike gin's default validator it checks a slice of structs as a
+// whole, so each error keeps the index of the element it was found in.
+type requestValidator struct {
+	once     sync.Once
+	validate *validator.Validate
+}
+
+func (v *requestValidator) ValidateStruct(obj interface{}) error {
+	v.init()
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return v.validate.Struct(value.Interface())
+	case reflect.Slice, reflect.Array:
+		return v.validate.Var(value.Interface(), "dive")
+	}
+	return nil
+}
+
+func (v *requestValidator) Engine() interface{} {
+	v.init()
+	return v.validate
+}
+
+func (v *requestValidator) init() {
+	v.once.Do(func() {
+		v.validate = validator.New()
+		v.validate.SetTagName("binding")
+		// Name fields as clients send them
+		v.validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		for tag, fn := range map[string]validator.Func{
+			"phone":        isPhone,
+			"intlphone":    isIntlPhone,
+			"password":     isStrongPassword,
+			"birthday":     isBirthday,
+			"tagsize":      isTagsSize,
+			"webhookevent": isWebhookEvent,
+		} {
+			if err := v.validate.RegisterValidation(tag, fn); err != nil {
+				panic(err)
+			}
+		}
+	})
+}
+
+// isPhone checks a contact's phone number: digits with an optional leading
+// plus sign, and spaces, dots, dashes or parentheses between them
+func isPhone(fl validator.FieldLevel) bool {
+	digits := 0
+	for i, r := range fl.Field().String() {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" .-()", r):
+		default:
+			return false
+		}
+	}
+	return digits >= minPhoneDigits && digits <= maxPhoneDigits
+}
+
+// isIntlPhone checks a number SMS can be sent to
+func isIntlPhone(fl validator.FieldLevel) bool {
+	return phoneNumberPattern.MatchString(fl.Field().String())
+}
+
+// isStrongPassword checks a password's length and that it mixes uppercase
+// and lowercase letters with numbers
+func isStrongPassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return false
+	}
+	var upper, lower, number bool
+	for _, r := range password {
+		upper = upper || unicode.IsUpper(r)
+		lower = lower || unicode.IsLower(r)
+		number = number || unicode.IsDigit(r)
+	}
+	return upper && lower && number
+}
+
+// isBirthday checks a birthday is not in the future. Birthdays given as
+// strings must be YYYY-MM-DD dates; empty strings and zero times are unset
+// birthdays and pass.
+func isBirthday(fl validator.FieldLevel) bool {
+	var birthday time.Time
+	switch value := fl.Field().Interface().(type) {
+	case string:
+		if value == "" {
+			return true
+		}
+		var err error
+		if birthday, err = time.Parse(birthdayLayout, value); err != nil {
+			return false
+		}
+	case time.Time:
+		birthday = value
+	default:
+		return false
+	}
+	return !birthday.After(time.Now())
+}
+
+// isTagsSize checks a contact's tags fit the column they are stored in
+func isTagsSize(fl validator.FieldLevel) bool {
+	tags, ok := fl.Field().Interface().([]string)
+	return ok && len(strings.Join(tags, ",")) <= maxTagsLen
+}
+
+// isWebhookEvent checks an event can be subscribed to
+func isWebhookEvent(fl validator.FieldLevel) bool {
+	return webhookEvents[fl.Field().String()]
+}
+
+// bindJSON decodes the request body into obj and checks it against the
+// binding tags of obj's fields. It responds with 400 and returns false if
+// the body is malformed or any field is invalid, listing every invalid field.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+	if errs := validationErrors(err); len(errs) > 0 {
+		respondValidation(c, errs...)
+		return false
+	}
+	c.JSON(http.StatusBadRequest, models.Response{
+		Success: false,
+		Error:   "Invalid request format",
+	})
+	return false
+}
+
+// respondValidation writes the 400 response listing invalid fields
+func respondValidation(c *gin.Context, errs ...models.ValidationError) {
+	c.JSON(http.StatusBadRequest, models.Response{
+		Success: false,
+		Error:   errs,
+	})
+}
+
+// validateValue checks a value against the binding tags of its fields,
+// returning the invalid fields
+func validateValue(obj interface{}) []models.ValidationError {
+	return validationErrors(binding.Validator.ValidateStruct(obj))
+}
+
+// validationErrors describes each field a validation error reports, or
+// returns nil if err is not a validation error
+func validationErrors(err error) []models.ValidationError {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return nil
+	}
+	errs := make([]models.ValidationError, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		// Drop the name of the validated type, keeping indexes into slices
+		field := fe.Namespace()
+		if !strings.HasPrefix(field, "[") {
+			if _, rest, ok := strings.Cut(field, "."); ok {
+				field = rest
+			}
+		}
+		errs = append(errs, models.ValidationError{Field: field, Message: validationMessage(field, fe)})
+	}
+	return errs
+}
+
+// validationMessage describes why the field at path failed a rule
+func validationMessage(path string, fe validator.FieldError) string {
+	label := fieldLabel(path)
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return label + " is required"
+	case "min":
+		return label + " must be at least " + fe.Param() + unit
+	case "max":
+		return label + " must be at most " + fe.Param() + unit
+	case "oneof":
+		return label + " must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "unique":
+		return label + " must not repeat entries"
+	case "excludes":
+		if fe.Param() == "," {
+			return label + " must not contain commas"
+		}
+		return label + " must not contain " + strconv.Quote(fe.Param())
+	case "email":
+		return label + " must be a valid email address"
+	case "timezone":
+		return label + " must be an IANA time zone name, e.g. Europe/London"
+	case "phone":
+		return label + " must be a phone number of digits, optionally starting with +"
+	case "intlphone":
+		return label + " must be in international format, e.g. +14155550100"
+	case "password":
+		return fmt.Sprintf("%s must be %d to %d characters and contain an uppercase letter, a lowercase letter and a number",
+			label, minPasswordLen, maxPasswordLen)
+	case "birthday":
+		if fe.Kind() == reflect.String {
+			return label + " must be a date in YYYY-MM-DD format that is not in the future"
+		}
+		return label + " must not be in the future"
+	case "tagsize":
+		return fmt.Sprintf("%s must be at most %d characters in total", label, maxTagsLen)
+	case "webhookevent":
+		return label + " must be a known event"
+	}
+	return label + " is invalid"
+}
+
+// fieldLabel turns a field's path into the start of a sentence, such as
+// "Repeat every" for repeat.every. Elements of a list are called
+// "Each entry", and indexes into lists are dropped.
+func fieldLabel(path string) string {
+	if strings.HasSuffix(path, "]") {
+		return "Each entry"
+	}
+	if i := strings.LastIndex(path, "]."); i >= 0 {
+		path = path[i+2:]
+	}
+	label := strings.NewReplacer("_", " ", ".", " ").Replace(path)
+	if label == "" {
+		return "Value"
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
@@ -0,0 +1,687 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+const eventBackupCompleted = "backup.completed"
+
+const (
+	// maxWebhooksPerUser bounds the number of subscriptions a user can create
+	maxWebhooksPerUser = 10
+	webhookSecretBytes = 32
+	// webhookMaxAttempts is the number of delivery attempts before giving up
+	webhookMaxAttempts = 6
+	// webhookRetryBase is the delay before the first retry, doubled after
+	// each further failure
+	webhookRetryBase     = 30 * time.Second
+	webhookPollInterval  = 10 * time.Second
+	webhookTimeout       = 10 * time.Second
+	webhookDeliveryBatch = 50
+	// webhookDeliveryLogLimit is the number of a webhook's deliveries
+	// listed per page unless ?limit= says otherwise
+	webhookDeliveryLogLimit = 100
+	maxWebhookDeliveryLimit = 200
+	defaultWebhookLimit     = 50
+	maxWebhookLimit         = 200
+	// maxZapierHooksPerUser bounds the number of Zapier subscriptions a
+	// user can have, one for each of their zaps
+	maxZapierHooksPerUser = 50
+)
+
+// Formats of the payloads webhooks are sent
+const (
+	webhookFormatStandard = "standard"
+	webhookFormatZapier   = "zapier"
+)
+
+const (
+	deliveryPending   = "pending"
+	deliverySucceeded = "succeeded"
+	deliveryFailed    = "failed"
+)
+
+// webhookEvents are the events users can subscribe to
+var webhookEvents = map[string]bool{
+	eventContactCreated:  true,
+	eventContactUpdated:  true,
+	eventContactDeleted:  true,
+	eventBackupCompleted: true,
+}
+
+// webhookPayload is the JSON body posted to webhooks
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// errPrivateAddress is returned when a webhook resolves to a non-public address
+var errPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// webhookClient refuses to connect to internal addresses so webhooks cannot
+// be used to reach services on the server's network
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: rejectPrivateAddress}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// rejectPrivateAddress is a dialer control that only allows public addresses
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// webhookWake triggers an immediate delivery run after new events are queued
+var webhookWake = make(chan struct{}, 1)
+
+// signWebhook returns the signature of a payload sent at the given time. The
+// timestamp is signed too so receivers can reject replayed requests.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueWebhooks records a delivery of an event to each of the user's webhooks
+// subscribed to it, in the format of each
+func (a *App) queueWebhooks(ctx context.Context, userID int, eventType string, data interface{}) {
+	rows, err := a.store.DB.QueryContext(ctx, "SELECT id, events, format FROM webhooks WHERE user_id = ?", userID)
+	if err != nil {
+		logging.Errorf("Failed to fetch webhooks: %v", err)
+		return
+	}
+	formats := map[int]string{}
+	for rows.Next() {
+		var id int
+		var subscribed, format string
+		if err := rows.Scan(&id, &subscribed, &format); err != nil {
+			logging.Errorf("Failed to scan webhook: %v", err)
+			continue
+		}
+		for _, event := range strings.Split(subscribed, ",") {
+			if event == eventType {
+				formats[id] = format
+				break
+			}
+		}
+	}
+	rows.Close()
+	if len(formats) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	payloads := map[string][]byte{}
+	for id, format := range formats {
+		payload, ok := payloads[format]
+		if !ok {
+			var body interface{} = webhookPayload{Event: eventType, Timestamp: now, Data: data}
+			if format == webhookFormatZapier {
+				body = zapierPayload(eventType, now, data)
+			}
+			if payload, err = json.Marshal(body); err != nil {
+				logging.Errorf("Failed to encode webhook payload: %v", err)
+				return
+			}
+			payloads[format] = payload
+		}
+		_, err := a.store.DB.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, eventType, payload, deliveryPending, now, now, now,
+		)
+		if err != nil {
+			logging.Errorf("Failed to queue webhook delivery: %v", err)
+		}
+	}
+
+	wakeWebhookDeliveries()
+}
+
+// wakeWebhookDeliveries starts a delivery run without waiting for the next poll
+func wakeWebhookDeliveries() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunWebhookDeliveries sends queued webhook deliveries as they become due
+func (a *App) RunWebhookDeliveries() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+		if err := a.deliverDueWebhooks(context.Background()); err != nil {
+			logging.Errorf("Failed to deliver webhooks: %v", err)
+		}
+	}
+}
+
+// dueDelivery is a pending delivery with the webhook it is sent to
+type dueDelivery struct {
+	id        int
+	event     string
+	payload   []byte
+	attempts  int
+	webhookID int
+	url       string
+	secret    string
+	format    string
+}
+
+// deliverDueWebhooks attempts every delivery whose next attempt is due
+func (a *App) deliverDueWebhooks(ctx context.Context) error {
+	rows, err := a.store.DB.QueryContext(ctx,
+		`SELECT d.id, d.event_type, d.payload, d.attempts, w.id, w.url, w.secret, w.format FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at LIMIT ?`,
+		deliveryPending, time.Now().UTC(), webhookDeliveryBatch,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch due deliveries: %v", err)
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.webhookID, &d.url, &d.secret, &d.format); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan delivery: %v", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		// Claim the delivery so other instances don't send it too
+		result, err := a.store.DB.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ? AND status = ? AND attempts = ?",
+			time.Now().UTC().Add(2*webhookTimeout), d.id, deliveryPending, d.attempts,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim delivery: %v", err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+		d.attempts++
+		a.deliverWebhook(ctx, d)
+	}
+	return nil
+}
+
+// deliverWebhook sends one delivery attempt and records its outcome,
+// scheduling a retry with exponential backoff if it failed. A Zapier
+// subscription answered with 410 Gone was turned off in Zapier, and is
+// deleted as the REST hooks pattern asks.
+func (a *App) deliverWebhook(ctx context.Context, d dueDelivery) {
+	status, err := postWebhook(d)
+	if status == http.StatusGone && d.format == webhookFormatZapier {
+		if _, err := a.store.DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", d.webhookID); err != nil {
+			logging.Errorf("Failed to delete webhook %d that Zapier unsubscribed: %v", d.webhookID, err)
+		}
+		return
+	}
+
+	var responseStatus sql.NullInt64
+	if status != 0 {
+		responseStatus = sql.NullInt64{Int64: int64(status), Valid: true}
+	}
+	now := time.Now().UTC()
+	if err == nil {
+		_, err = a.store.DB.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET status = ?, response_status = ?, error = NULL, next_attempt_at = NULL, updated_at = ? WHERE id = ?",
+			deliverySucceeded, responseStatus, now, d.id,
+		)
+		if err != nil {
+			logging.Errorf("Failed to record webhook delivery: %v", err)
+		}
+		return
+	}
+
+	newStatus := deliveryPending
+	next := sql.NullTime{Time: now.Add(webhookRetryBase << (d.attempts - 1)), Valid: true}
+	if d.attempts >= webhookMaxAttempts {
+		newStatus = deliveryFailed
+		next = sql.NullTime{}
+	}
+	_, dbErr := a.store.DB.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = ?, response_status = ?, error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+		newStatus, responseStatus, err.Error(), next, now, d.id,
+	)
+	if dbErr != nil {
+		logging.Errorf("Failed to record webhook delivery: %v", dbErr)
+	}
+}
+
+// postWebhook posts a delivery's payload and returns the response status
+func postWebhook(d dueDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PhoneSaver-Webhooks/1.0")
+	req.Header.Set("X-PhoneSaver-Event", d.event)
+	req.Header.Set("X-PhoneSaver-Delivery", strconv.Itoa(d.id))
+	req.Header.Set("X-PhoneSaver-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-PhoneSaver-Signature", signWebhook(d.secret, timestamp, d.payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP(S) URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return errors.New("URL must be an absolute http or https URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && (!ip.IsGlobalUnicast() || ip.IsPrivate()) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// newWebhookSecret returns a random secret to sign a webhook's payloads with
+func newWebhookSecret() (string, error) {
+	raw := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// webhookRequest is the body of a request to register a webhook
+type webhookRequest struct {
+	URL    string   `json:"url" binding:"required,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,webhookevent"`
+}
+
+// CreateWebhook registers a URL to receive the user's events
+func (a *App) CreateWebhook(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := validateWebhookURL(req.URL); err != nil {
+		respondValidation(c, models.ValidationError{Field: "url", Message: err.Error()})
+		return
+	}
+	seen := make(map[string]bool, len(req.Events))
+	var subscribed []string
+	for _, event := range req.Events {
+		if !seen[event] {
+			seen[event] = true
+			subscribed = append(subscribed, event)
+		}
+	}
+
+	var count int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM webhooks WHERE user_id = ? AND format = ?", userID, webhookFormatStandard).Scan(&count); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create webhook",
+		})
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("At most %d webhooks can be registered", maxWebhooksPerUser),
+		})
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to generate webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create webhook",
+		})
+		return
+	}
+	webhook := models.Webhook{
+		URL:       req.URL,
+		Events:    subscribed,
+		Format:    webhookFormatStandard,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	result, err := a.store.DB.ExecContext(c.Request.Context(),
+		"INSERT INTO webhooks (user_id, url, secret, events, format, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Format, webhook.CreatedAt,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create webhook",
+		})
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to get last insert ID: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to create webhook",
+		})
+		return
+	}
+	webhook.ID = int(id)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    webhook,
+	})
+}
+
+// ListWebhooks returns the user's webhooks
+func (a *App) ListWebhooks(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var after int
+	page, ok := parseListPage(c, defaultWebhookLimit, maxWebhookLimit, &after)
+	if !ok {
+		return
+	}
+	var total int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID).Scan(&total); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch webhooks",
+		})
+		return
+	}
+	condition, args := page.Condition(false, "id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		"SELECT id, url, events, format, created_at FROM webhooks WHERE user_id = ? AND "+condition+" ORDER BY id"+limit,
+		append(append([]interface{}{userID}, args...), limitArgs...)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch webhooks",
+		})
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		var subscribed string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &subscribed, &webhook.Format, &webhook.CreatedAt); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan webhook: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch webhooks",
+			})
+			return
+		}
+		webhook.Events = strings.Split(subscribed, ",")
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch webhooks",
+		})
+		return
+	}
+
+	next := ""
+	if len(webhooks) == page.Limit {
+		next = listCursor(webhooks[len(webhooks)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    webhooks,
+	})
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (a *App) DeleteWebhook(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := a.store.DB.ExecContext(c.Request.Context(), "DELETE FROM webhooks WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to delete webhook",
+		})
+		return
+	}
+
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Webhook not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Webhook deleted successfully",
+	})
+}
+
+// ListWebhookDeliveries returns the deliveries to a webhook, most recent
+// first
+func (a *App) ListWebhookDeliveries(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	webhookID := c.Param("id")
+
+	var before int
+	page, ok := parseListPage(c, webhookDeliveryLogLimit, maxWebhookDeliveryLimit, &before)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = ? AND user_id = ?)", webhookID, userID).Scan(&exists)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to verify webhook ownership: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch deliveries",
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Webhook not found",
+		})
+		return
+	}
+
+	var total int
+	if err := a.store.DB.QueryRowContext(c.Request.Context(), "SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?", webhookID).Scan(&total); err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to count deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch deliveries",
+		})
+		return
+	}
+	condition, args := page.Condition(true, "id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := a.store.DB.QueryContext(c.Request.Context(),
+		`SELECT id, webhook_id, event_type, status, attempts, response_status, error, next_attempt_at, created_at, updated_at
+		FROM webhook_deliveries WHERE webhook_id = ? AND `+condition+` ORDER BY id DESC`+limit,
+		append(append([]interface{}{webhookID}, args...), limitArgs...)...,
+	)
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to fetch deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch deliveries",
+		})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var responseStatus sql.NullInt64
+		var deliveryErr sql.NullString
+		var next sql.NullTime
+		if err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Status, &delivery.Attempts,
+			&responseStatus, &deliveryErr, &next, &delivery.CreatedAt, &delivery.UpdatedAt,
+		); err != nil {
+			middleware.RequestLogger(c).Errorf("Failed to scan delivery: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to fetch deliveries",
+			})
+			return
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			delivery.ResponseStatus = &status
+		}
+		if next.Valid {
+			delivery.NextAttemptAt = &next.Time
+		}
+		delivery.Error = deliveryErr.String
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		middleware.RequestLogger(c).Errorf("Error iterating deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to fetch deliveries",
+		})
+		return
+	}
+
+	next := ""
+	if len(deliveries) == page.Limit {
+		next = listCursor(deliveries[len(deliveries)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Meta:    middleware.ListMeta(c, total, next),
+		Success: true,
+		Data:    deliveries,
+	})
+}
+
+// RetryWebhookDelivery queues a failed delivery to be sent again, with a
+// fresh set of attempts
+func (a *App) RetryWebhookDelivery(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	now := time.Now().UTC()
+	result, err := a.store.DB.ExecContext(c.Request.Context(),
+		`UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND webhook_id = ? AND status = ?
+		AND webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)`,
+		deliveryPending, now, now, c.Param("deliveryId"), c.Param("id"), deliveryFailed, userID,
+	)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to retry delivery: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to retry delivery",
+		})
+		return
+	}
+
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "Failed delivery not found",
+		})
+		return
+	}
+
+	wakeWebhookDeliveries()
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Delivery queued for retry",
+	})
+}
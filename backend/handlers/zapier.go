@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+)
+
+// zapierSampleSize is the number of recent contacts returned as samples of a
+// Zapier trigger
+const zapierSampleSize = 3
+
+// zapierEvents are the events Zapier triggers can subscribe to
+var zapierEvents = map[string]bool{
+	eventContactCreated: true,
+	eventContactUpdated: true,
+	eventContactDeleted: true,
+}
+
+// zapierContact is the payload of a contact event sent to Zapier: the
+// contact's fields at the top level, where Zapier offers them to later
+// steps of a zap, with the event and when it happened
+type zapierContact struct {
+	models.ContactResponse
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// zapierDeletedContact is the payload of a contact deletion sent to Zapier
+type zapierDeletedContact struct {
+	ID         int       `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// zapierPayload returns the body of an event sent to a Zapier subscription,
+// which is the event's data alone rather than wrapped in the standard
+// webhook payload
+func zapierPayload(eventType string, occurredAt time.Time, data interface{}) interface{} {
+	event, ok := data.(models.ContactEvent)
+	if !ok {
+		return data
+	}
+	if event.Contact == nil {
+		return zapierDeletedContact{ID: event.ContactID, Event: eventType, OccurredAt: occurredAt}
+	}
+	return zapierContact{ContactResponse: *event.Contact, Event: eventType, OccurredAt: occurredAt}
+}
+
+// zapierSubscribeRequest is the body Zapier subscribes to an event with
+type zapierSubscribeRequest struct {
+	TargetURL string `json:"target_url" binding:"required,max=2048"`
+	Event     string `json:"event" binding:"required"`
+}
+
+// zapierSubscription is a Zapier subscription, whose ID Zapier unsubscribes
+// with
+type zapierSubscription struct {
+	ID        int       `json:"id"`
+	Event     string    `json:"event"`
+	TargetURL string    `json:"target_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SubscribeZapier subscribes a zap's target URL to one of the user's contact
+// events, as Zapier's REST hooks do when a zap is turned on. The events are
+// then posted to the URL as the contact's fields, and a subscription Zapier
+// answers with 410 Gone is deleted.
+func (a *App) SubscribeZapier(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var req zapierSubscribeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !zapierEvents[req.Event] {
+		respondValidation(c, models.ValidationError{Field: "event", Message: "Event must be contact.created, contact.updated or contact.deleted"})
+		return
+	}
+	if err := validateWebhookURL(req.TargetURL); err != nil {
+		respondValidation(c, models.ValidationError{Field: "target_url", Message: err.Error()})
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to generate webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to subscribe",
+		})
+		return
+	}
+	subscription := zapierSubscription{Event: req.Event, TargetURL: req.TargetURL, CreatedAt: time.Now().UTC()}
+	err = a.createZapierSubscription(c.Request.Context(), userID.(int), &subscription, secret)
+	if err == errZapierLimit {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("At most %d Zapier subscriptions can be registered", maxZapierHooksPerUser),
+		})
+		return
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to create Zapier subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to subscribe",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Success: true,
+		Data:    subscription,
+	})
+}
+
+// errZapierLimit is returned when subscribing a user who already has
+// maxZapierHooksPerUser Zapier subscriptions
+var errZapierLimit = errors.New("zapier subscription limit reached")
+
+// createZapierSubscription stores a subscription of the user's, setting its
+// ID, unless they already have maxZapierHooksPerUser. The user is locked
+// while their subscriptions are counted, so concurrent subscriptions can't
+// exceed the limit.
+func (a *App) createZapierSubscription(ctx context.Context, userID int, subscription *zapierSubscription, secret string) error {
+	tx, err := a.store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?"+a.store.ForUpdate(), userID).Scan(&id); err != nil {
+		return fmt.Errorf("failed to lock user: %v", err)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhooks WHERE user_id = ? AND format = ?", userID, webhookFormatZapier).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count Zapier subscriptions: %v", err)
+	}
+	if count >= maxZapierHooksPerUser {
+		return errZapierLimit
+	}
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO webhooks (user_id, url, secret, events, format, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, subscription.TargetURL, secret, subscription.Event, webhookFormatZapier, subscription.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	inserted, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	subscription.ID = int(inserted)
+	return nil
+}
+
+// UnsubscribeZapier deletes one of the user's Zapier subscriptions, as
+// Zapier does when a zap is turned off
+func (a *App) UnsubscribeZapier(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondSubscriptionNotFound(c)
+		return
+	}
+
+	result, err := a.store.DB.ExecContext(c.Request.Context(),
+		"DELETE FROM webhooks WHERE id = ? AND user_id = ? AND format = ?", id, userID, webhookFormatZapier)
+	var rows int64
+	if err == nil {
+		rows, err = result.RowsAffected()
+	}
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to delete Zapier subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to unsubscribe",
+		})
+		return
+	}
+	if rows == 0 {
+		respondSubscriptionNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    "Unsubscribed successfully",
+	})
+}
+
+// GetZapierSamples returns the user's most recently changed contacts as
+// payloads of the event in ?event=, for Zapier to show while a zap is set
+// up and to fall back to polling with. Zapier expects a bare array, so the
+// samples aren't wrapped in the usual response. Deletions have no samples,
+// as deleted contacts aren't kept.
+func (a *App) GetZapierSamples(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	event := c.Query("event")
+	if !zapierEvents[event] {
+		respondValidation(c, models.ValidationError{Field: "event", Message: "Event must be contact.created, contact.updated or contact.deleted"})
+		return
+	}
+
+	samples := []zapierContact{}
+	if event == eventContactDeleted {
+		c.JSON(http.StatusOK, samples)
+		return
+	}
+	contacts, err := a.store.Contacts.ListAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		middleware.RequestLogger(c).Errorf("Failed to list contacts: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to list samples",
+		})
+		return
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		if event == eventContactCreated || contacts[i].UpdatedAt.Equal(contacts[j].UpdatedAt) {
+			return contacts[i].ID > contacts[j].ID
+		}
+		return contacts[i].UpdatedAt.After(contacts[j].UpdatedAt)
+	})
+	if len(contacts) > zapierSampleSize {
+		contacts = contacts[:zapierSampleSize]
+	}
+	for _, contact := range contacts {
+		samples = append(samples, zapierContact{
+			ContactResponse: models.NewContactResponse(contact),
+			Event:           event,
+			OccurredAt:      contact.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, samples)
+}
+
+func respondSubscriptionNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Subscription not found",
+	})
+}
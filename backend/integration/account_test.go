@@ -0,0 +1,195 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+func TestAccountExport(t *testing.T) {
+	user := newUser(t)
+	contact := user.createContact("Export Contact", "+14155550199")
+	user.expect(http.StatusOK, http.MethodPost, "/api/contacts/"+strconv.Itoa(contact.ID)+"/interactions",
+		map[string]string{"type": "call", "note": "Caught up"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, api.URL+"/api/account/export", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+user.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export returned %d", resp.StatusCode)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") {
+		t.Errorf("export has Content-Disposition %q, want an attachment", disposition)
+	}
+
+	var export models.AccountExport
+	if err := json.NewDecoder(resp.Body).Decode(&export); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if export.Account.Email != user.email {
+		t.Errorf("export is of account %q, want %q", export.Account.Email, user.email)
+	}
+	if len(export.Contacts) != 1 || export.Contacts[0].Phone != "+14155550199" {
+		t.Errorf("export has contacts %+v, want the one created with its phone decrypted", export.Contacts)
+	}
+	if len(export.Interactions) != 1 || export.Interactions[0].ContactID != contact.ID {
+		t.Errorf("export has interactions %+v, want the one recorded", export.Interactions)
+	}
+	if len(export.Devices) != 1 || export.Devices[0].ID != user.deviceID {
+		t.Errorf("export has devices %+v, want the login's device", export.Devices)
+	}
+	if len(export.AuditLog) == 0 || export.AuditLog[0].Action != "login" {
+		t.Errorf("export has audit log %+v, want the login", export.AuditLog)
+	}
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=account_export", nil, &events)
+	if len(events) != 1 {
+		t.Errorf("audit log has %d account exports, want 1", len(events))
+	}
+}
+
+func TestAccountDeletion(t *testing.T) {
+	user := newUser(t)
+	user.expect(http.StatusForbidden, http.MethodPost, "/api/account/deletion",
+		map[string]string{"password": "Wrong-password1"}, nil)
+
+	var deletion models.AccountDeletion
+	user.expect(http.StatusAccepted, http.MethodPost, "/api/account/deletion",
+		map[string]string{"password": testPassword}, &deletion)
+	if !deletion.Scheduled || deletion.DeleteAt == nil || time.Until(*deletion.DeleteAt) < 13*24*time.Hour {
+		t.Fatalf("deletion is %+v, want it scheduled 14 days ahead", deletion)
+	}
+	scheduled := *deletion.DeleteAt
+
+	user.expect(http.StatusAccepted, http.MethodPost, "/api/account/deletion",
+		map[string]string{"password": testPassword}, &deletion)
+	if deletion.DeleteAt == nil || !deletion.DeleteAt.Equal(scheduled) {
+		t.Errorf("asking again scheduled deletion at %v, want %v", deletion.DeleteAt, scheduled)
+	}
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/deletion", nil, &deletion)
+	if !deletion.Scheduled {
+		t.Errorf("deletion is %+v, want it scheduled", deletion)
+	}
+
+	user.expect(http.StatusOK, http.MethodDelete, "/api/account/deletion", nil, nil)
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/deletion", nil, &deletion)
+	if deletion.Scheduled {
+		t.Errorf("deletion is %+v after cancelling, want it unscheduled", deletion)
+	}
+	user.expect(http.StatusNotFound, http.MethodDelete, "/api/account/deletion", nil, nil)
+}
+
+func TestUsage(t *testing.T) {
+	user := newUser(t)
+	user.createContact("Usage Contact", "+14155550198")
+	user.expect(http.StatusOK, http.MethodPost, "/api/backup", nil, nil)
+
+	var usage models.Usage
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/usage?days=7", nil, &usage)
+	if len(usage.Days) == 0 {
+		t.Fatalf("usage is %+v, want today's", usage)
+	}
+	today := usage.Days[len(usage.Days)-1]
+	if today.Day != time.Now().UTC().Format("2006-01-02") || today.APICalls < 2 || today.Contacts != 1 || today.StorageBytes == 0 {
+		t.Errorf("today's usage is %+v, want the calls and contact so far", today)
+	}
+	if today.Backups != 1 || today.BackupBytes == 0 || today.BackupStorageBytes != today.BackupBytes {
+		t.Errorf("today's usage is %+v, want the backup", today)
+	}
+	if usage.APICalls < today.APICalls || usage.Backups != 1 {
+		t.Errorf("usage totals are %+v, want today's included", usage)
+	}
+	user.expect(http.StatusBadRequest, http.MethodGet, "/api/account/usage?days=0", nil, nil)
+}
+
+func TestBillingDisabled(t *testing.T) {
+	user := newUser(t)
+
+	// Without Stripe every account has the pro plan
+	var billing models.Billing
+	user.expect(http.StatusOK, http.MethodGet, "/api/billing", nil, &billing)
+	if billing.Enabled || billing.Plan.ID != "pro" || len(billing.Plans) != 2 {
+		t.Errorf("billing is %+v, want the pro plan with billing off", billing)
+	}
+	user.expect(http.StatusNotFound, http.MethodPost, "/api/billing/checkout", nil, nil)
+	user.expect(http.StatusCreated, http.MethodPost, "/api/orgs", map[string]string{"name": "Acme Plumbing"}, nil)
+}
+
+func TestIntegrationsDisabled(t *testing.T) {
+	user := newUser(t)
+
+	// Without an OAuth client no provider can be connected
+	var integrations struct {
+		Available   []string             `json:"available"`
+		Connections []models.ContactSync `json:"connections"`
+	}
+	user.expect(http.StatusOK, http.MethodGet, "/api/integrations", nil, &integrations)
+	if len(integrations.Available) != 0 || len(integrations.Connections) != 0 {
+		t.Errorf("integrations are %+v, want none", integrations)
+	}
+	user.expect(http.StatusNotFound, http.MethodPost, "/api/integrations/google", nil, nil)
+	user.expect(http.StatusNotFound, http.MethodPost, "/api/integrations/google/sync", nil, nil)
+}
+
+func TestScopedAccessTokens(t *testing.T) {
+	user := newUser(t)
+	contact := user.createContact("Scoped Contact", "+14155550188")
+
+	var created struct {
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	user.expect(http.StatusBadRequest, http.MethodPost, "/api/access-tokens",
+		map[string][]string{"scopes": {"admin"}}, nil)
+	user.expect(http.StatusCreated, http.MethodPost, "/api/access-tokens",
+		map[string][]string{"scopes": {"read:contacts"}}, &created)
+	reader := &client{t: t, token: created.Token}
+
+	reader.expect(http.StatusOK, http.MethodGet, "/api/contacts/"+strconv.Itoa(contact.ID), nil, nil)
+	reader.expect(http.StatusForbidden, http.MethodDelete, "/api/contacts/"+strconv.Itoa(contact.ID), nil, nil)
+	reader.expect(http.StatusForbidden, http.MethodGet, "/api/backups", nil, nil)
+	reader.expect(http.StatusForbidden, http.MethodPost, "/api/access-tokens",
+		map[string][]string{"scopes": {"write:contacts"}}, nil)
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=access_token_created", nil, &events)
+	if len(events) != 1 || events[0].Details["scopes"] != "read:contacts" {
+		t.Errorf("audit log has access token events %+v, want the one created", events)
+	}
+}
+
+func TestNewDeviceLogin(t *testing.T) {
+	user := newUser(t)
+	first := user.deviceID
+	user.login(first)
+	user.login("")
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=login", nil, &events)
+	if len(events) != 3 {
+		t.Fatalf("audit log has %d logins, want 3", len(events))
+	}
+	if events[0].Details["new_device"] != "true" {
+		t.Errorf("login from a new device has details %v, want it flagged", events[0].Details)
+	}
+	for _, event := range events[1:] {
+		if event.Details != nil {
+			t.Errorf("first login and login from a known device have details %v, want none", event.Details)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// newAdmin logs in as the admin, signing them up if no test has yet
+func newAdmin(t *testing.T) *client {
+	t.Helper()
+	admin := &client{t: t, email: adminEmail}
+	admin.do(http.MethodPost, "/api/auth/signup", map[string]string{"email": adminEmail, "password": testPassword})
+	admin.login("")
+	return admin
+}
+
+func TestAdminEncryption(t *testing.T) {
+	user := newUser(t)
+	user.createContact("Dorothy Vaughan", "+1 555 010 0456")
+	user.expect(http.StatusForbidden, http.MethodGet, "/api/admin/encryption", nil, nil)
+
+	admin := newAdmin(t)
+	var status models.EncryptionStatus
+	admin.expect(http.StatusOK, http.MethodGet, "/api/admin/encryption", nil, &status)
+	if status.CurrentVersion != 1 || len(status.Keys) != 1 || status.Keys[0].Contacts == 0 {
+		t.Errorf("encryption status is %+v, want one key used by the contacts", status)
+	}
+
+	// The data key is configured directly, without a KMS to rotate it with
+	admin.expect(http.StatusConflict, http.MethodPost, "/api/admin/encryption/rotate", nil, nil)
+
+	var job models.Job
+	admin.expect(http.StatusAccepted, http.MethodPost, "/api/admin/encryption/reencrypt", nil, &job)
+	for deadline := time.Now().Add(10 * time.Second); job.Status == "running" && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		admin.expect(http.StatusOK, http.MethodGet, "/api/jobs/"+job.ID, nil, &job)
+	}
+	if job.Status != "completed" {
+		t.Fatalf("re-encryption job is %s: %s", job.Status, job.Error)
+	}
+	var result models.ReencryptResult
+	decode(t, job.Result, &result)
+	if result.KeyVersion != 1 || result.Reencrypted != 0 {
+		t.Errorf("re-encryption result is %+v, want nothing re-encrypted", result)
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	user := newUser(t)
+	user.createContact("Katherine Johnson", "+1 555 010 0789")
+	user.expect(http.StatusForbidden, http.MethodGet, "/api/admin/users", nil, nil)
+
+	admin := newAdmin(t)
+	var users []models.AdminUser
+	admin.expect(http.StatusOK, http.MethodGet, "/api/admin/users?status=active&email="+user.email, nil, &users)
+	if len(users) != 1 || users[0].Email != user.email || users[0].Contacts != 1 || users[0].Suspended {
+		t.Fatalf("users matching the email are %+v, want the active user with one contact", users)
+	}
+	path := "/api/admin/users/" + strconv.Itoa(users[0].ID)
+	admin.expect(http.StatusBadRequest, http.MethodGet, "/api/admin/users?status=deleted", nil, nil)
+	admin.expect(http.StatusNotFound, http.MethodGet, "/api/admin/users/0", nil, nil)
+
+	var account models.AdminUser
+	admin.expect(http.StatusOK, http.MethodPost, path+"/suspend", nil, &account)
+	if !account.Suspended || account.SuspendedAt == nil {
+		t.Errorf("suspended account is %+v, want it suspended", account)
+	}
+	user.expect(http.StatusUnauthorized, http.MethodGet, "/api/contacts", nil, nil)
+	if status, _ := user.do(http.MethodPost, "/api/auth/login", map[string]string{"email": user.email, "password": testPassword}); status != http.StatusForbidden {
+		t.Errorf("login to a suspended account returned %d, want 403", status)
+	}
+
+	admin.expect(http.StatusOK, http.MethodPost, path+"/reactivate", nil, &account)
+	if account.Suspended {
+		t.Errorf("reactivated account is %+v, want it active", account)
+	}
+	user.login("")
+	user.expect(http.StatusOK, http.MethodGet, "/api/contacts", nil, nil)
+
+	admin.expect(http.StatusOK, http.MethodPost, path+"/password-reset", nil, &account)
+	if !account.PasswordResetRequired {
+		t.Errorf("account after a password reset is %+v, want a new password required", account)
+	}
+	user.expect(http.StatusUnauthorized, http.MethodGet, "/api/contacts", nil, nil)
+	if status, _ := user.do(http.MethodPost, "/api/auth/login", map[string]string{"email": user.email, "password": testPassword}); status != http.StatusUnauthorized {
+		t.Errorf("login with the discarded password returned %d, want 401", status)
+	}
+	if status, _ := user.do(http.MethodPost, "/api/auth/reset-password?token=invalid", map[string]string{"password": "New-" + testPassword}); status != http.StatusBadRequest {
+		t.Errorf("reset with an invalid token returned %d, want 400", status)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	user := newUser(t)
+	user.createContact("Mary Jackson", "+1 555 010 0321")
+	admin := newAdmin(t)
+
+	var users []models.AdminUser
+	admin.expect(http.StatusOK, http.MethodGet, "/api/admin/users?email="+user.email, nil, &users)
+	if len(users) != 1 {
+		t.Fatalf("users matching the email are %+v, want the user", users)
+	}
+	path := "/api/admin/users/" + strconv.Itoa(users[0].ID) + "/impersonate"
+	user.expect(http.StatusForbidden, http.MethodPost, path, map[string]string{"reason": "Debugging sync"}, nil)
+	admin.expect(http.StatusBadRequest, http.MethodPost, path, map[string]string{}, nil)
+
+	var started struct {
+		Token         string               `json:"token"`
+		Impersonation models.Impersonation `json:"impersonation"`
+	}
+	admin.expect(http.StatusCreated, http.MethodPost, path, map[string]string{"reason": "Debugging sync"}, &started)
+	if started.Impersonation.UserID != users[0].ID || !started.Impersonation.ExpiresAt.After(started.Impersonation.CreatedAt) {
+		t.Errorf("impersonation is %+v, want one of the user that expires", started.Impersonation)
+	}
+
+	// The token acts as the user, but can't issue tokens or reach admin routes
+	impersonator := &client{t: t, email: user.email, token: started.Token}
+	if contacts := impersonator.listContacts(); len(contacts) != 1 {
+		t.Errorf("impersonator sees %+v, want the user's contact", contacts)
+	}
+	impersonator.expect(http.StatusForbidden, http.MethodPost, "/api/access-tokens", map[string]interface{}{"scopes": []string{"backup"}}, nil)
+	impersonator.expect(http.StatusForbidden, http.MethodGet, "/api/admin/users", nil, nil)
+
+	var audit []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=impersonated_request", nil, &audit)
+	if len(audit) != 3 || audit[0].Details["admin_id"] == "" {
+		t.Errorf("impersonated_request events are %+v, want the impersonator's 3 requests", audit)
+	}
+
+	var ended models.Impersonation
+	admin.expect(http.StatusOK, http.MethodPost, "/api/admin/impersonations/"+strconv.Itoa(started.Impersonation.ID)+"/end", nil, &ended)
+	if ended.EndedAt == nil || ended.Requests != 3 {
+		t.Errorf("ended impersonation is %+v, want it ended after 3 requests", ended)
+	}
+	impersonator.expect(http.StatusUnauthorized, http.MethodGet, "/api/contacts", nil, nil)
+}
@@ -0,0 +1,109 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"phonesaver-backend/models"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	user := newUser(t)
+	if user.token == "" || user.deviceID == "" {
+		t.Fatalf("login returned token %q and device %q", user.token, user.deviceID)
+	}
+
+	// The token authenticates requests
+	user.expect(http.StatusOK, http.MethodGet, "/api/contacts", nil, nil)
+
+	// Logging in again from the same device keeps its ID
+	deviceID := user.deviceID
+	user.login(deviceID)
+	if user.deviceID != deviceID {
+		t.Errorf("login from device %q returned device %q", deviceID, user.deviceID)
+	}
+
+	anonymous := &client{t: t}
+	anonymous.expect(http.StatusBadRequest, http.MethodPost, "/api/auth/signup",
+		map[string]string{"email": user.email, "password": testPassword}, nil)
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/auth/login",
+		map[string]string{"email": user.email, "password": "Wrong-password1"}, nil)
+	anonymous.expect(http.StatusUnauthorized, http.MethodGet, "/api/contacts", nil, nil)
+}
+
+func TestSignupValidation(t *testing.T) {
+	anonymous := &client{t: t}
+	for _, body := range []map[string]string{
+		{"email": "not-an-email", "password": testPassword},
+		{"email": "weak@example.com", "password": "short"},
+		{"email": "nodigits@example.com", "password": "NoDigitsHere"},
+	} {
+		anonymous.expect(http.StatusBadRequest, http.MethodPost, "/api/auth/signup", body, nil)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	user := newUser(t)
+	if user.refreshToken == "" {
+		t.Fatal("login returned no refresh token")
+	}
+
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	anonymous := &client{t: t}
+	first := user.refreshToken
+	anonymous.expect(http.StatusOK, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": first}, &session)
+	if session.Token == "" || session.RefreshToken == "" || session.RefreshToken == first {
+		t.Fatalf("refresh returned %+v, want a new access token and refresh token", session)
+	}
+	renewed := &client{t: t, token: session.Token}
+	renewed.expect(http.StatusOK, http.MethodGet, "/api/contacts", nil, nil)
+	second := session.RefreshToken
+
+	// Replaying the used token revokes its successor too
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": first}, nil)
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": second}, nil)
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": "unknown"}, nil)
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=refresh_token_reused", nil, &events)
+	if len(events) != 1 {
+		t.Errorf("audit log has %d refresh token reuses, want 1", len(events))
+	}
+
+	// Other logins keep their own refresh tokens
+	user.login("")
+	anonymous.expect(http.StatusOK, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": user.refreshToken}, nil)
+}
+
+func TestAuditLog(t *testing.T) {
+	user := newUser(t)
+	anonymous := &client{t: t}
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/auth/login",
+		map[string]string{"email": user.email, "password": "Wrong-password1"}, nil)
+	user.login("")
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit", nil, &events)
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	if want := []string{"login", "login_failed", "login"}; !slices.Equal(actions, want) {
+		t.Errorf("audit log has %v, want %v", actions, want)
+	}
+	if len(events) > 0 && (events[0].IP == "" || events[0].DeviceID != user.deviceID) {
+		t.Errorf("login was audited from %q on device %q, want device %q", events[0].IP, events[0].DeviceID, user.deviceID)
+	}
+
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=login_failed&limit=1", nil, &events)
+	if len(events) != 1 || events[0].Action != "login_failed" {
+		t.Errorf("filtered audit log has %+v, want one failed login", events)
+	}
+	user.expect(http.StatusBadRequest, http.MethodGet, "/api/account/audit?limit=0", nil, nil)
+}
@@ -0,0 +1,93 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"phonesaver-backend/models"
+)
+
+// backupResult is the data of a completed backup
+type backupResult struct {
+	ContactsCount int                   `json:"contacts_count"`
+	Manifest      models.BackupManifest `json:"manifest"`
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	user := newUser(t)
+	kept := user.createContact("Katherine Johnson", "+15551234")
+	removed := user.createContact("Dorothy Vaughan", "+15555678")
+
+	var first backupResult
+	user.expect(http.StatusOK, http.MethodPost, "/api/backup", nil, &first)
+	if first.ContactsCount != 2 || first.Manifest.Mode != "full" || first.Manifest.Written != 2 {
+		t.Fatalf("first backup returned %+v", first)
+	}
+
+	// A second backup only writes what changed
+	var second backupResult
+	user.expect(http.StatusOK, http.MethodPost, "/api/backup", nil, &second)
+	if second.Manifest.Mode != "delta" || second.Manifest.Unchanged != 2 {
+		t.Errorf("second backup returned %+v", second.Manifest)
+	}
+
+	var verify struct {
+		Valid bool `json:"valid"`
+	}
+	user.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/backups/%d/verify", second.Manifest.ID), nil, &verify)
+	if !verify.Valid {
+		t.Errorf("backup %d did not verify", second.Manifest.ID)
+	}
+
+	user.expect(http.StatusOK, http.MethodDelete, fmt.Sprintf("/api/contacts/%d", removed.ID), nil, nil)
+
+	var preview struct {
+		Plan models.RestorePlan `json:"plan"`
+	}
+	user.expect(http.StatusOK, http.MethodGet, "/api/backup/preview?mode=merge", nil, &preview)
+	if preview.Plan.Adds != 1 || preview.Plan.Unchanged != 1 {
+		t.Errorf("restore preview returned %+v", preview.Plan)
+	}
+
+	user.expect(http.StatusOK, http.MethodGet, "/api/backup?mode=merge", nil, nil)
+	contacts := user.listContacts()
+	if len(contacts) != 2 {
+		t.Fatalf("listed %d contacts after restore, want 2", len(contacts))
+	}
+	names := map[string]bool{}
+	for _, contact := range contacts {
+		names[contact.Name] = true
+	}
+	if !names[kept.Name] || !names[removed.Name] {
+		t.Errorf("restored contacts %v, want %q and %q", names, kept.Name, removed.Name)
+	}
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	user := newUser(t)
+	user.createContact("Hedy Lamarr", "+15559876")
+
+	const passphrase = "correct horse battery staple"
+	var backup backupResult
+	user.expect(http.StatusOK, http.MethodPost, "/api/backup", nil, &backup, "X-Backup-Passphrase", passphrase)
+	if !backup.Manifest.Encrypted {
+		t.Fatalf("backup with a passphrase is not encrypted: %+v", backup.Manifest)
+	}
+
+	// Restoring needs the passphrase the backup was sealed with
+	user.expect(http.StatusBadRequest, http.MethodGet, "/api/backup", nil, nil)
+	user.expect(http.StatusForbidden, http.MethodGet, "/api/backup", nil, nil, "X-Backup-Passphrase", "wrong passphrase")
+	user.expect(http.StatusOK, http.MethodGet, "/api/backup", nil, nil, "X-Backup-Passphrase", passphrase)
+
+	if contacts := user.listContacts(); len(contacts) != 1 || contacts[0].Name != "Hedy Lamarr" {
+		t.Errorf("restored contacts %+v", contacts)
+	}
+}
+
+func TestBackupWithoutContacts(t *testing.T) {
+	user := newUser(t)
+	user.expect(http.StatusBadRequest, http.MethodPost, "/api/backup", nil, nil)
+}
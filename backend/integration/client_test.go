@@ -0,0 +1,137 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPassword satisfies the password rules of signup
+const testPassword = "Integration1"
+
+// userCount makes the email of each test user unique
+var userCount atomic.Int64
+
+// envelope is the body of every API response
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   json.RawMessage `json:"error"`
+}
+
+// client calls the API as one user
+type client struct {
+	t            *testing.T
+	email        string
+	token        string
+	refreshToken string
+	deviceID     string
+}
+
+// newUser signs up a new user and logs them in
+func newUser(t *testing.T) *client {
+	t.Helper()
+	return newUserWithEmail(t, fmt.Sprintf("user%d-%d@example.com", time.Now().UnixNano(), userCount.Add(1)))
+}
+
+// newUserWithEmail signs up a user with the given email and logs them in
+func newUserWithEmail(t *testing.T, email string) *client {
+	t.Helper()
+	c := &client{t: t, email: email}
+
+	if status, body := c.do(http.MethodPost, "/api/auth/signup", map[string]string{"email": email, "password": testPassword}); status != http.StatusOK {
+		t.Fatalf("signup returned %d: %s", status, body.Error)
+	}
+	c.login("")
+	return c
+}
+
+// login logs the user in from a device, replacing the client's token
+func (c *client) login(deviceID string) {
+	c.t.Helper()
+	status, body := c.do(http.MethodPost, "/api/auth/login", map[string]string{
+		"email":     c.email,
+		"password":  testPassword,
+		"device_id": deviceID,
+	})
+	if status != http.StatusOK {
+		c.t.Fatalf("login returned %d: %s", status, body.Error)
+	}
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		DeviceID     string `json:"device_id"`
+	}
+	decode(c.t, body.Data, &session)
+	c.token, c.refreshToken, c.deviceID = session.Token, session.RefreshToken, session.DeviceID
+}
+
+// do sends a request with the client's token, encoding body as JSON, and
+// returns the response status and envelope. Extra headers are given as
+// name, value pairs.
+func (c *client) do(method, path string, body interface{}, headers ...string) (int, envelope) {
+	c.t.Helper()
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, api.URL+path, reader)
+	if err != nil {
+		c.t.Fatalf("failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var env envelope
+	if resp.StatusCode != http.StatusNotModified && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+			c.t.Fatalf("%s %s returned an invalid body: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode, env
+}
+
+// expect sends a request and fails the test unless it returns want,
+// decoding the response data into out if it is not nil
+func (c *client) expect(want int, method, path string, body, out interface{}, headers ...string) {
+	c.t.Helper()
+	status, env := c.do(method, path, body, headers...)
+	if status != want {
+		c.t.Fatalf("%s %s returned %d, want %d: %s", method, path, status, want, env.Error)
+	}
+	if out != nil {
+		decode(c.t, env.Data, out)
+	}
+}
+
+func decode(t *testing.T, data json.RawMessage, out interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("failed to decode response data %s: %v", data, err)
+	}
+}
@@ -0,0 +1,270 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"phonesaver-backend/models"
+)
+
+// createContact creates a contact and returns it as stored
+func (c *client) createContact(name, phone string) models.Contact {
+	c.t.Helper()
+	var contact models.Contact
+	c.expect(http.StatusOK, http.MethodPost, "/api/contacts", models.Contact{
+		Name:  name,
+		Phone: phone,
+		Tags:  []string{"friends"},
+	}, &contact)
+	return contact
+}
+
+// listContacts returns the user's contacts matching query, or all of them
+func (c *client) listContacts(query ...string) []models.Contact {
+	c.t.Helper()
+	path := "/api/contacts"
+	if len(query) > 0 {
+		path += "?" + strings.Join(query, "&")
+	}
+	var contacts []models.Contact
+	c.expect(http.StatusOK, http.MethodGet, path, nil, &contacts)
+	return contacts
+}
+
+func TestContactValidation(t *testing.T) {
+	user := newUser(t)
+	status, body := user.do(http.MethodPost, "/api/contacts", map[string]interface{}{
+		"phone": "not a number",
+		"tags":  []string{"ok", ""},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("creating an invalid contact returned %d", status)
+	}
+	var errs []models.ValidationError
+	decode(t, body.Error, &errs)
+	fields := map[string]bool{}
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"name", "phone", "tags[1]"} {
+		if !fields[field] {
+			t.Errorf("validation errors %+v don't include %s", errs, field)
+		}
+	}
+}
+
+func TestContactCRUD(t *testing.T) {
+	user := newUser(t)
+
+	created := user.createContact("Ada Lovelace", "+441234567890")
+	if created.ID == 0 || created.Version == 0 {
+		t.Fatalf("created contact has ID %d and version %d", created.ID, created.Version)
+	}
+	path := fmt.Sprintf("/api/contacts/%d", created.ID)
+
+	var fetched models.Contact
+	user.expect(http.StatusOK, http.MethodGet, path, nil, &fetched)
+	if fetched.Name != created.Name || fetched.Phone != created.Phone {
+		t.Errorf("fetched %+v, want %+v", fetched, created)
+	}
+
+	// Updates are conditional on the version they were based on
+	update := fetched
+	update.Name = "Ada King"
+	ifMatch := `"` + strconv.Itoa(fetched.Version) + `"`
+	user.expect(http.StatusOK, http.MethodPut, path, update, nil, "If-Match", ifMatch)
+	user.expect(http.StatusConflict, http.MethodPut, path, update, nil, "If-Match", ifMatch)
+
+	user.expect(http.StatusOK, http.MethodGet, path, nil, &fetched)
+	if fetched.Name != "Ada King" || fetched.Version != created.Version+1 {
+		t.Errorf("after update got name %q at version %d", fetched.Name, fetched.Version)
+	}
+
+	if contacts := user.listContacts(); len(contacts) != 1 {
+		t.Errorf("listed %d contacts, want 1", len(contacts))
+	}
+
+	// Contacts of other users are not visible
+	other := newUser(t)
+	other.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+	other.expect(http.StatusNotFound, http.MethodDelete, path, nil, nil)
+
+	user.expect(http.StatusOK, http.MethodDelete, path, nil, nil)
+	user.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+	if contacts := user.listContacts(); len(contacts) != 0 {
+		t.Errorf("listed %d contacts after delete, want 0", len(contacts))
+	}
+}
+
+func TestEnhancedPrivacy(t *testing.T) {
+	user := newUser(t)
+	contact := user.createContact("Private Contact", "+14155550177")
+	path := fmt.Sprintf("/api/contacts/%d", contact.ID)
+	user.expect(http.StatusOK, http.MethodPost, path+"/interactions",
+		map[string]string{"type": "call", "note": "Before"}, nil)
+
+	var settings models.PrivacySettings
+	user.expect(http.StatusOK, http.MethodPut, "/api/settings/privacy",
+		models.PrivacySettings{EnhancedPrivacy: true}, &settings)
+	if !settings.EnhancedPrivacy {
+		t.Fatalf("privacy settings are %+v, want enhanced privacy on", settings)
+	}
+	user.expect(http.StatusOK, http.MethodPost, path+"/interactions",
+		map[string]string{"type": "sms", "note": "After"}, nil)
+
+	// Tags and notes read the same once encrypted
+	var fetched models.Contact
+	user.expect(http.StatusOK, http.MethodGet, path, nil, &fetched)
+	if len(fetched.Tags) != 1 || fetched.Tags[0] != "friends" {
+		t.Errorf("contact has tags %v, want them decrypted", fetched.Tags)
+	}
+	var interactions []models.Interaction
+	user.expect(http.StatusOK, http.MethodGet, path+"/interactions", nil, &interactions)
+	if len(interactions) != 2 || interactions[0].Note != "After" || interactions[1].Note != "Before" {
+		t.Errorf("interactions are %+v, want both notes decrypted", interactions)
+	}
+
+	// Encrypted tags match only in full
+	if contacts := user.listContacts("tag=friends"); len(contacts) != 1 {
+		t.Errorf("listed %d contacts tagged friends, want 1", len(contacts))
+	}
+	if contacts := user.listContacts("tag=friend"); len(contacts) != 0 {
+		t.Errorf("listed %d contacts for part of a tag, want 0", len(contacts))
+	}
+	if contacts := user.listContacts("filter=" + url.QueryEscape(`tag == "friends"`)); len(contacts) != 1 {
+		t.Errorf("filtered %d contacts tagged friends, want 1", len(contacts))
+	}
+
+	user.expect(http.StatusOK, http.MethodPut, "/api/settings/privacy",
+		models.PrivacySettings{EnhancedPrivacy: false}, nil)
+	if contacts := user.listContacts("tag=friend"); len(contacts) != 1 {
+		t.Errorf("listed %d contacts for part of a tag after decrypting, want 1", len(contacts))
+	}
+
+	var events []models.AuditEvent
+	user.expect(http.StatusOK, http.MethodGet, "/api/account/audit?action=privacy_changed", nil, &events)
+	if len(events) != 2 {
+		t.Errorf("audit log has %d privacy changes, want 2", len(events))
+	}
+}
+
+func TestPhoneSearch(t *testing.T) {
+	user := newUser(t)
+	created := user.createContact("Katherine Johnson", "+1 (555) 010-0123")
+	if created.Phone != "+1 (555) 010-0123" {
+		t.Errorf("created contact has phone %q", created.Phone)
+	}
+
+	// Phone numbers are stored encrypted, so they match in full and
+	// regardless of formatting
+	for query, want := range map[string]int{
+		"query=" + url.QueryEscape("+15550100123"):    1,
+		"query=" + url.QueryEscape("+1 555 010 0123"): 1,
+		"query=5550100":   0,
+		"query=katherine": 1,
+		"filter=" + url.QueryEscape(`phone == "+1-555-010-0123"`): 1,
+		"filter=" + url.QueryEscape(`phone != "+1-555-010-0123"`): 0,
+	} {
+		contacts := user.listContacts(query)
+		if len(contacts) != want {
+			t.Errorf("%s listed %d contacts, want %d", query, len(contacts), want)
+		}
+		for _, contact := range contacts {
+			if contact.Phone != created.Phone {
+				t.Errorf("%s listed phone %q, want %q", query, contact.Phone, created.Phone)
+			}
+		}
+	}
+
+	user.expect(http.StatusBadRequest, http.MethodGet, "/api/contacts?filter="+url.QueryEscape(`phone ~ "555"`), nil, nil)
+}
+
+func TestDuplicateContacts(t *testing.T) {
+	user := newUser(t)
+	first := user.createContact("Mary Jackson", "+1 555 010 0789")
+	second := user.createContact("Mary", "+15550100789")
+	user.createContact("Christine Darden", "+1 555 010 0790")
+
+	var groups []models.DuplicateContacts
+	user.expect(http.StatusOK, http.MethodGet, "/api/contacts/duplicates", nil, &groups)
+	if len(groups) != 1 || len(groups[0].Contacts) != 2 {
+		t.Fatalf("listed duplicates %+v, want one group of two", groups)
+	}
+	if groups[0].Phone != "+15550100789" || groups[0].Contacts[0].ID != first.ID || groups[0].Contacts[1].ID != second.ID {
+		t.Errorf("listed duplicates %+v, want %d and %d", groups, first.ID, second.ID)
+	}
+
+	var existing []models.ContactResponse
+	status, body := user.do(http.MethodPost, "/api/contacts?unique=true", map[string]string{"name": "M. Jackson", "phone": "+1-555-010-0789"})
+	if status != http.StatusConflict {
+		t.Fatalf("creating a duplicate contact returned %d, want 409", status)
+	}
+	decode(t, body.Data, &existing)
+	if len(existing) != 2 {
+		t.Errorf("duplicate contact conflicts with %d contacts, want 2", len(existing))
+	}
+}
+
+func TestBlockedNumbers(t *testing.T) {
+	user := newUser(t)
+	var blocked models.BlockedNumber
+	user.expect(http.StatusCreated, http.MethodPost, "/api/blocked-numbers", map[string]string{"phone": "+1 555 010 0666", "label": "robocalls"}, &blocked)
+	if status, _ := user.do(http.MethodPost, "/api/blocked-numbers", map[string]string{"phone": "+15550100666"}); status != http.StatusConflict {
+		t.Errorf("blocking a number twice returned %d, want 409", status)
+	}
+
+	var lookup struct {
+		Reputation models.PhoneReputation `json:"reputation"`
+	}
+	user.expect(http.StatusOK, http.MethodGet, "/api/lookup?phone=%2B1-555-010-0666", nil, &lookup)
+	if !lookup.Reputation.Blocked {
+		t.Errorf("looking up a blocked number returned reputation %+v", lookup.Reputation)
+	}
+	status, body := user.do(http.MethodPost, "/api/contacts?check_spam=true", map[string]string{"name": "Robocaller", "phone": "+15550100666"})
+	if status != http.StatusConflict {
+		t.Fatalf("creating a contact with a blocked number returned %d, want 409", status)
+	}
+	var reputation models.PhoneReputation
+	decode(t, body.Data, &reputation)
+	if !reputation.Blocked {
+		t.Errorf("blocked number conflicts with reputation %+v", reputation)
+	}
+
+	other := newUser(t)
+	if status, _ := other.do(http.MethodDelete, "/api/blocked-numbers/"+strconv.Itoa(blocked.ID), nil); status != http.StatusNotFound {
+		t.Errorf("unblocking another user's number returned %d, want 404", status)
+	}
+	user.expect(http.StatusOK, http.MethodDelete, "/api/blocked-numbers/"+strconv.Itoa(blocked.ID), nil, nil)
+	user.expect(http.StatusOK, http.MethodPost, "/api/contacts?check_spam=true", map[string]string{"name": "Robocaller", "phone": "+15550100666"}, nil)
+}
+
+func TestBulkCreateWithImportToken(t *testing.T) {
+	contacts := []models.Contact{
+		{Name: "Dorothy Vaughan", Phone: "+1 555 010 0801"},
+		{Name: "Annie Easley", Phone: "+1 555 010 0802"},
+	}
+	anonymous := &client{t: t}
+	anonymous.expect(http.StatusUnauthorized, http.MethodPost, "/api/contacts/bulk", contacts, nil)
+
+	user := newUser(t)
+	var created struct {
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	user.expect(http.StatusCreated, http.MethodPost, "/api/import-tokens", nil, &created)
+	importer := &client{t: t, token: created.Token}
+	importer.expect(http.StatusOK, http.MethodPost, "/api/contacts/bulk", contacts, nil)
+	if listed := user.listContacts(); len(listed) != len(contacts) {
+		t.Errorf("listed %d contacts after bulk create, want %d", len(listed), len(contacts))
+	}
+
+	// The import token grants nothing else
+	importer.expect(http.StatusForbidden, http.MethodGet, "/api/contacts", nil, nil)
+	importer.expect(http.StatusForbidden, http.MethodPost, "/api/import-tokens", nil, nil)
+}
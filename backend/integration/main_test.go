@@ -0,0 +1,114 @@
+//go:build integration
+
+// Package integration exercises the API end to end against a disposable
+// MySQL server and the Firestore emulator, which are started in Docker with
+// testcontainers. Run it with
+//
+//	go test -tags integration ./integration
+package integration
+
+import (
+	"context"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/gcloud"
+	"github.com/testcontainers/testcontainers-go/modules/mysql"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/repository"
+	"phonesaver-backend/server"
+)
+
+const (
+	mysqlImage       = "mysql:8.0"
+	firestoreProject = "phonesaver-test"
+	// adminEmail is the email of the user listed in ADMIN_EMAILS
+	adminEmail = "admin@example.com"
+)
+
+// api serves the API under test
+var api *httptest.Server
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run starts the dependencies and the API, runs the tests and tears
+// everything down again
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	db, err := mysql.RunContainer(ctx,
+		testcontainers.WithImage(mysqlImage),
+		mysql.WithDatabase("phonesaver"),
+		mysql.WithUsername("phonesaver"),
+		mysql.WithPassword("phonesaver"),
+	)
+	if err != nil {
+		log.Printf("Failed to start MySQL: %v", err)
+		return 1
+	}
+	defer db.Terminate(ctx)
+
+	firestore, err := gcloud.RunFirestoreContainer(ctx, gcloud.WithProjectID(firestoreProject))
+	if err != nil {
+		log.Printf("Failed to start the Firestore emulator: %v", err)
+		return 1
+	}
+	defer firestore.Terminate(ctx)
+
+	host, err := db.Host(ctx)
+	if err != nil {
+		log.Printf("Failed to get MySQL host: %v", err)
+		return 1
+	}
+	port, err := db.MappedPort(ctx, "3306/tcp")
+	if err != nil {
+		log.Printf("Failed to get MySQL port: %v", err)
+		return 1
+	}
+
+	for name, value := range map[string]string{
+		"DB_DRIVER":               config.DBDriverMySQL,
+		"DB_HOST":                 host,
+		"DB_PORT":                 port.Port(),
+		"DB_USER":                 "phonesaver",
+		"DB_PASSWORD":             "phonesaver",
+		"DB_NAME":                 "phonesaver",
+		"JWT_SECRET":              "integration-test-secret",
+		"ADMIN_EMAILS":            adminEmail,
+		"DATA_ENCRYPTION_KEY":     "aW50ZWdyYXRpb24tdGVzdC1kYXRhLWtleS0zMmJ5dGU=",
+		"FIREBASE_CONFIG":         "",
+		"FIRESTORE_EMULATOR_HOST": firestore.URI,
+		"GOOGLE_CLOUD_PROJECT":    firestoreProject,
+		"BACKUP_STORE":            "firestore",
+		"RATE_LIMIT_API_BURST":    "100000",
+		"RATE_LIMIT_SIGNUP_BURST": "1000",
+		"AUTH_DELAY_BASE":         "0",
+		"LOG_LEVEL":               "warn",
+	} {
+		os.Setenv(name, value)
+	}
+	cfg := config.Load("")
+
+	if _, err := repository.Migrate(cfg); err != nil {
+		log.Printf("Failed to migrate the database: %v", err)
+		return 1
+	}
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Printf("Failed to create the server: %v", err)
+		return 1
+	}
+	defer srv.Close()
+
+	api = httptest.NewServer(srv.Handler())
+	defer api.Close()
+
+	return m.Run()
+}
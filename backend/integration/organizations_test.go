@@ -0,0 +1,196 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"phonesaver-backend/models"
+)
+
+func TestOrganizations(t *testing.T) {
+	owner := newUser(t)
+	member := newUser(t)
+	outsider := newUser(t)
+
+	var org models.Organization
+	owner.expect(http.StatusCreated, http.MethodPost, "/api/orgs", map[string]string{"name": "Acme Plumbing"}, &org)
+	if org.Role != "owner" || org.Members != 1 {
+		t.Fatalf("created organization is %+v, want the user its only owner", org)
+	}
+	path := "/api/orgs/" + strconv.Itoa(org.ID)
+
+	var added models.OrganizationMember
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/members", map[string]string{"email": member.email, "role": "member"}, &added)
+	owner.expect(http.StatusConflict, http.MethodPost, path+"/members", map[string]string{"email": member.email, "role": "member"}, nil)
+	owner.expect(http.StatusNotFound, http.MethodPost, path+"/members", map[string]string{"email": "nobody@example.com", "role": "member"}, nil)
+	outsider.expect(http.StatusNotFound, http.MethodGet, path+"/contacts", nil, nil)
+
+	// Members share the contacts, which stay apart from their own
+	var contact models.Contact
+	member.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{
+		Name:  "Valve Supplies",
+		Phone: "+1 555 010 0999",
+		Tags:  []string{"supplier"},
+	}, &contact)
+	var contacts []models.Contact
+	owner.expect(http.StatusOK, http.MethodGet, path+"/contacts?tag=supplier", nil, &contacts)
+	if len(contacts) != 1 || contacts[0].ID != contact.ID {
+		t.Errorf("organization contacts are %+v, want the contact the member created", contacts)
+	}
+	if personal := member.listContacts(); len(personal) != 0 {
+		t.Errorf("member's own contacts are %+v, want none", personal)
+	}
+
+	member.expect(http.StatusForbidden, http.MethodGet, path+"/backup", nil, nil)
+	member.expect(http.StatusForbidden, http.MethodPut, path+"/members/"+strconv.Itoa(added.UserID), map[string]string{"role": "admin"}, nil)
+
+	// The last owner can't leave or be unmade
+	var members []models.OrganizationMember
+	owner.expect(http.StatusOK, http.MethodGet, path+"/members", nil, &members)
+	if len(members) != 2 || members[0].Email != owner.email || members[0].Role != "owner" {
+		t.Fatalf("members are %+v, want the owner and the member", members)
+	}
+	ownerPath := path + "/members/" + strconv.Itoa(members[0].UserID)
+	owner.expect(http.StatusConflict, http.MethodPut, ownerPath, map[string]string{"role": "admin"}, nil)
+	owner.expect(http.StatusConflict, http.MethodDelete, ownerPath, nil, nil)
+
+	var audit []models.AuditEvent
+	owner.expect(http.StatusOK, http.MethodGet, path+"/audit?action=member_added", nil, &audit)
+	if len(audit) != 1 || audit[0].Details["user_id"] != strconv.Itoa(added.UserID) {
+		t.Errorf("member_added events are %+v, want the member added", audit)
+	}
+
+	member.expect(http.StatusOK, http.MethodDelete, path+"/members/"+strconv.Itoa(added.UserID), nil, nil)
+	member.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+
+	owner.expect(http.StatusOK, http.MethodDelete, path, nil, nil)
+	owner.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+}
+
+func TestContactPermissions(t *testing.T) {
+	owner := newUser(t)
+	member := newUser(t)
+
+	var org models.Organization
+	owner.expect(http.StatusCreated, http.MethodPost, "/api/orgs", map[string]string{"name": "Acme Plumbing"}, &org)
+	path := "/api/orgs/" + strconv.Itoa(org.ID)
+	var added models.OrganizationMember
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/members", map[string]string{"email": member.email, "role": "member"}, &added)
+
+	var supplier, customer models.Contact
+	owner.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{Name: "Valve Supplies", Phone: "+1 555 010 0998", Tags: []string{"supplier"}}, &supplier)
+	owner.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{Name: "Ada Customer", Phone: "+1 555 010 0997"}, &customer)
+	supplierPath := path + "/contacts/" + strconv.Itoa(supplier.ID)
+	customerPath := path + "/contacts/" + strconv.Itoa(customer.ID)
+
+	// Members start with none of the contacts
+	var contacts []models.Contact
+	member.expect(http.StatusOK, http.MethodGet, path+"/contacts", nil, &contacts)
+	if len(contacts) != 0 {
+		t.Errorf("member sees %+v before anything is shared, want none", contacts)
+	}
+	member.expect(http.StatusNotFound, http.MethodGet, supplierPath, nil, nil)
+
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/permissions", map[string]interface{}{"user_id": added.UserID, "tag": "supplier", "access": "read"}, nil)
+	var write models.ContactPermission
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/permissions", map[string]interface{}{"user_id": added.UserID, "contact_id": customer.ID, "access": "write"}, &write)
+	owner.expect(http.StatusBadRequest, http.MethodPost, path+"/permissions", map[string]interface{}{"user_id": added.UserID, "access": "read"}, nil)
+	member.expect(http.StatusForbidden, http.MethodPost, path+"/permissions", map[string]interface{}{"user_id": added.UserID, "tag": "vip", "access": "write"}, nil)
+
+	member.expect(http.StatusOK, http.MethodGet, path+"/contacts", nil, &contacts)
+	if len(contacts) != 2 {
+		t.Errorf("member sees %+v, want the contacts shared with them", contacts)
+	}
+	member.expect(http.StatusOK, http.MethodGet, supplierPath, nil, nil)
+	member.expect(http.StatusForbidden, http.MethodDelete, supplierPath, nil, nil)
+	member.expect(http.StatusOK, http.MethodPut, customerPath, models.Contact{Name: "Ada Lovelace", Phone: customer.Phone}, nil)
+
+	// Members can change the contacts they create
+	var created models.Contact
+	member.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{Name: "Pipe Works", Phone: "+1 555 010 0996"}, &created)
+	member.expect(http.StatusOK, http.MethodDelete, path+"/contacts/"+strconv.Itoa(created.ID), nil, nil)
+
+	owner.expect(http.StatusOK, http.MethodDelete, path+"/permissions/"+strconv.Itoa(write.ID), nil, nil)
+	member.expect(http.StatusNotFound, http.MethodGet, customerPath, nil, nil)
+
+	var permissions []models.ContactPermission
+	member.expect(http.StatusOK, http.MethodGet, path+"/permissions", nil, &permissions)
+	if len(permissions) != 1 || permissions[0].Tag != "supplier" || permissions[0].Access != "read" {
+		t.Errorf("member's permissions are %+v, want read access to the suppliers", permissions)
+	}
+}
+
+func TestOrganizationInvites(t *testing.T) {
+	owner := newUser(t)
+	member := newUser(t)
+
+	var org models.Organization
+	owner.expect(http.StatusCreated, http.MethodPost, "/api/orgs", map[string]string{"name": "Acme Plumbing"}, &org)
+	path := "/api/orgs/" + strconv.Itoa(org.ID)
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/members", map[string]string{"email": member.email, "role": "admin"}, nil)
+
+	var invite models.OrganizationInvite
+	member.expect(http.StatusCreated, http.MethodPost, path+"/invites", map[string]string{"email": "invitee@example.com", "role": "member"}, &invite)
+	if invite.Email != "invitee@example.com" || invite.Role != "member" || !invite.ExpiresAt.After(invite.CreatedAt) {
+		t.Errorf("invite is %+v, want one for the invitee as a member", invite)
+	}
+	member.expect(http.StatusForbidden, http.MethodPost, path+"/invites", map[string]string{"email": "invitee@example.com", "role": "owner"}, nil)
+	owner.expect(http.StatusConflict, http.MethodPost, path+"/invites", map[string]string{"email": member.email, "role": "member"}, nil)
+
+	var audit []models.AuditEvent
+	owner.expect(http.StatusOK, http.MethodGet, path+"/audit?action=member_invited", nil, &audit)
+	if len(audit) != 1 || audit[0].Details["email"] != "invitee@example.com" {
+		t.Errorf("member_invited events are %+v, want the invitation", audit)
+	}
+}
+
+func TestOrganizationExport(t *testing.T) {
+	owner := newUser(t)
+	member := newUser(t)
+
+	var org models.Organization
+	owner.expect(http.StatusCreated, http.MethodPost, "/api/orgs", map[string]string{"name": "Acme Plumbing"}, &org)
+	path := "/api/orgs/" + strconv.Itoa(org.ID)
+	var added models.OrganizationMember
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/members", map[string]string{"email": member.email, "role": "member"}, &added)
+
+	var supplier models.Contact
+	owner.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{Name: "Valve Supplies", Phone: "+1 555 010 0995", Tags: []string{"supplier"}}, &supplier)
+	owner.expect(http.StatusOK, http.MethodPost, path+"/contacts", models.Contact{Name: "Ada Customer", Phone: "+1 555 010 0994"}, nil)
+	owner.expect(http.StatusCreated, http.MethodPost, path+"/permissions", map[string]interface{}{"user_id": added.UserID, "tag": "supplier", "access": "read"}, nil)
+	member.expect(http.StatusForbidden, http.MethodGet, path+"/export", nil, nil)
+
+	req, err := http.NewRequest(http.MethodGet, api.URL+path+"/export", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+owner.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export returned %d", resp.StatusCode)
+	}
+	var export models.OrganizationExport
+	if err := json.NewDecoder(resp.Body).Decode(&export); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	if len(export.Contacts) != 2 || len(export.Members) != 2 || len(export.Permissions) != 1 || len(export.AuditLog) == 0 {
+		t.Fatalf("export is %+v, want both contacts, members and the permission, and the audit log", export)
+	}
+	for _, m := range export.Members {
+		want := 2
+		if m.UserID == added.UserID {
+			want = 1
+		}
+		if len(m.Contacts) != want {
+			t.Errorf("member %d may work with %+v in the export, want %d contacts", m.UserID, m.Contacts, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// syncResult is the data of a delta sync
+type syncResult struct {
+	Created   []models.ContactResponse `json:"created"`
+	Updated   []models.ContactResponse `json:"updated"`
+	Deleted   []models.Tombstone       `json:"deleted"`
+	SyncToken string                   `json:"sync_token"`
+}
+
+// pushResult is the data of a push of changes
+type pushResult struct {
+	Results   []models.SyncResult `json:"results"`
+	Conflicts int                 `json:"conflicts"`
+}
+
+func (c *client) sync(token string) syncResult {
+	c.t.Helper()
+	path := "/api/sync"
+	if token != "" {
+		path += "?since=" + token
+	}
+	var result syncResult
+	c.expect(http.StatusOK, http.MethodGet, path, nil, &result)
+	return result
+}
+
+func (c *client) push(changes ...models.SyncChange) pushResult {
+	c.t.Helper()
+	var result pushResult
+	c.expect(http.StatusOK, http.MethodPost, "/api/sync", map[string]interface{}{"changes": changes}, &result)
+	if len(result.Results) != len(changes) {
+		c.t.Fatalf("pushed %d changes, got %d results", len(changes), len(result.Results))
+	}
+	return result
+}
+
+func TestSync(t *testing.T) {
+	phone := newUser(t)
+	tablet := &client{t: t, email: phone.email}
+	tablet.login("tablet")
+
+	initial := phone.sync("")
+	if len(initial.Created) != 0 || initial.SyncToken == "" {
+		t.Fatalf("first sync of a new user returned %+v", initial)
+	}
+
+	// A contact created on one device reaches the other
+	created := phone.push(models.SyncChange{Name: "Mary Jackson", Phone: "+15550100", EncryptedPhone: "sealed:0100"})
+	if created.Results[0].Status != "created" {
+		t.Fatalf("push of a new contact returned %+v", created.Results[0])
+	}
+	contactID := created.Results[0].ID
+
+	pulled := tablet.sync(initial.SyncToken)
+	if len(pulled.Created) != 1 || pulled.Created[0].ID != contactID {
+		t.Fatalf("sync after create returned %+v", pulled)
+	}
+
+	// Edits to different fields on both devices are merged
+	base := pulled.Created[0]
+	tablet.push(models.SyncChange{
+		ID:         contactID,
+		Version:    base.Version,
+		ModifiedAt: time.Now().UTC(),
+		Fields:     []string{"tags"},
+		Tags:       []string{"work"},
+	})
+	merged := phone.push(models.SyncChange{
+		ID:         contactID,
+		Version:    base.Version,
+		ModifiedAt: time.Now().UTC(),
+		Fields:     []string{"name"},
+		Name:       "Mary W. Jackson",
+	})
+	if status := merged.Results[0].Status; status != "merged" && status != "applied" {
+		t.Fatalf("push of a concurrent edit returned %+v", merged.Results[0])
+	}
+
+	var contact models.Contact
+	phone.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/contacts/%d", contactID), nil, &contact)
+	if contact.Name != "Mary W. Jackson" || len(contact.Tags) != 1 || contact.Tags[0] != "work" {
+		t.Errorf("after concurrent edits got name %q and tags %v", contact.Name, contact.Tags)
+	}
+
+	// A deletion reaches the other device as a tombstone
+	deleted := tablet.push(models.SyncChange{ID: contactID, Version: contact.Version, Deleted: true})
+	if deleted.Results[0].Status != "deleted" {
+		t.Fatalf("push of a deletion returned %+v", deleted.Results[0])
+	}
+	afterDelete := phone.sync(pulled.SyncToken)
+	if len(afterDelete.Deleted) != 1 || afterDelete.Deleted[0].ID != contactID {
+		t.Errorf("sync after delete returned %+v", afterDelete)
+	}
+}
+
+func TestSyncRejectsInvalidChanges(t *testing.T) {
+	user := newUser(t)
+	result := user.push(
+		models.SyncChange{Name: "No Phone"},
+		models.SyncChange{Name: "Grace Hopper", Phone: "+15550199", Tags: []string{"a,b"}},
+	)
+	for _, r := range result.Results {
+		if r.Status != "invalid" || len(r.Errors) == 0 {
+			t.Errorf("push of an invalid change returned %+v", r)
+		}
+	}
+}
+
+func TestSyncRejectsInvalidToken(t *testing.T) {
+	user := newUser(t)
+	user.expect(http.StatusBadRequest, http.MethodGet, "/api/sync?since=not-a-token", nil, nil)
+}
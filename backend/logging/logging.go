@@ -0,0 +1,112 @@
+// Package logging provides the structured logger shared by the server
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Logger writes structured log records through log/slog
+type Logger struct {
+	*slog.Logger
+}
+
+// New creates a logger writing records at or above level to stdout,
+// formatted as JSON or as key=value text. Emails and phone numbers in the
+// records are masked.
+func New(level slog.Level, format string) *Logger {
+	opts := &slog.HandlerOptions{Level: level, AddSource: true}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, opts)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	return &Logger{slog.New(redactHandler{handler})}
+}
+
+// With returns a logger that adds the attributes to every record
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l.Logger.With(args...)}
+}
+
+// Debugf logs a debug message
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.logf(slog.LevelDebug, format, v...)
+}
+
+// Infof logs an info message
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.logf(slog.LevelInfo, format, v...)
+}
+
+// Warnf logs a warning
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.logf(slog.LevelWarn, format, v...)
+}
+
+// Errorf logs an error
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.logf(slog.LevelError, format, v...)
+}
+
+// Fatal logs an error and exits
+func (l *Logger) Fatal(v ...interface{}) {
+	l.logf(slog.LevelError, "%s", fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+func (l *Logger) logf(level slog.Level, format string, v ...interface{}) {
+	ctx := context.Background()
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	// Report the caller of Infof, Errorf, etc. as the source of the record
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, v...), pcs[0])
+	l.Handler().Handle(ctx, record)
+}
+
+// std is the logger used by the package-level functions
+var std = New(slog.LevelInfo, "text")
+
+// SetDefault makes l the logger used by the package-level functions and by
+// log/slog
+func SetDefault(l *Logger) {
+	std = l
+	slog.SetDefault(l.Logger)
+}
+
+// With returns a logger that adds the attributes to every record
+func With(args ...any) *Logger {
+	return std.With(args...)
+}
+
+// Debugf logs a debug message
+func Debugf(format string, v ...interface{}) {
+	std.logf(slog.LevelDebug, format, v...)
+}
+
+// Infof logs an info message
+func Infof(format string, v ...interface{}) {
+	std.logf(slog.LevelInfo, format, v...)
+}
+
+// Warnf logs a warning
+func Warnf(format string, v ...interface{}) {
+	std.logf(slog.LevelWarn, format, v...)
+}
+
+// Errorf logs an error
+func Errorf(format string, v ...interface{}) {
+	std.logf(slog.LevelError, format, v...)
+}
+
+// Fatal logs an error and exits
+func Fatal(v ...interface{}) {
+	std.logf(slog.LevelError, "%s", fmt.Sprint(v...))
+	os.Exit(1)
+}
@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// redactedEmail and redactedPhone replace the emails and phone numbers
+	// found in log records
+	redactedEmail = "[email]"
+	redactedPhone = "[phone]"
+	// minPhoneDigits is the fewest digits a run must have to be masked as a
+	// phone number, which leaves IDs, counts and short codes readable
+	minPhoneDigits = 7
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// phonePattern matches digits with the separators phone numbers are
+	// written with: spaces, dashes and parentheses. Dots aren't among them,
+	// so IP addresses and versions stay readable.
+	phonePattern = regexp.MustCompile(`\+?\(?\d[\d ()-]*\d`)
+	// datePattern matches dates, and the hour of a time following one,
+	// which look like phone numbers but aren't worth masking
+	datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}( \d{2})?$`)
+	// uuidPattern matches UUIDs, such as request IDs, whose groups may be
+	// all digits
+	uuidPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// Redact masks the email addresses and phone numbers in s, so personal data
+// in messages, errors and query strings doesn't reach the logs
+func Redact(s string) string {
+	s = emailPattern.ReplaceAllString(s, redactedEmail)
+
+	matches := phonePattern.FindAllStringIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	uuids := uuidPattern.FindAllStringIndex(s, -1)
+	out := make([]byte, 0, len(s))
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if !isPhone(s, start, end) || overlaps(uuids, start, end) {
+			continue
+		}
+		out = append(out, s[last:start]...)
+		out = append(out, redactedPhone...)
+		last = end
+	}
+	return string(append(out, s[last:]...))
+}
+
+// isPhone reports whether s[start:end], matched by phonePattern, is a phone
+// number rather than part of a word, such as an ID in hex, or a date
+func isPhone(s string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && isWordRune(r) {
+		return false
+	}
+	match := s[start:end]
+	if datePattern.MatchString(match) {
+		return false
+	}
+	digits := 0
+	for _, r := range match {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= minPhoneDigits
+}
+
+// overlaps reports whether s[start:end] overlaps any of spans
+func overlaps(spans [][]int, start, end int) bool {
+	for _, span := range spans {
+		if start < span[1] && span[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// redactHandler is a slog.Handler that masks personal data in the message
+// and attributes of each record before passing it on
+type redactHandler struct {
+	next slog.Handler
+}
+
+func (h redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactHandler{h.next.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.next.WithGroup(name)}
+}
+
+// redactAttr masks personal data in an attribute's value. Values other than
+// strings, errors and groups, such as numbers and times, are kept as they
+// are.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// RedactWriter returns a writer that masks personal data in what is written
+// to w, for output that doesn't go through a Logger, such as gin's panic
+// recovery
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+package logging
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"phone", "call +1 (415) 555-0101 now", "call [phone] now"},
+		{"phone in a query", "phone=4155550101&page=2", "phone=[phone]&page=2"},
+		{"phone after a dash", "id-5551234567", "id-[phone]"},
+		{"phone before a dash", "5551234567-home", "[phone]-home"},
+		{"email", "sent to ann.lee+work@example.co.uk", "sent to [email]"},
+		{"UUID with a numeric group", "request 12345678-f9f6-4c1e-9b3a-0d2b8e41f7aa done", "request 12345678-f9f6-4c1e-9b3a-0d2b8e41f7aa done"},
+		{"numeric UUID", "12345678-1234-5678-1234-567812345678", "12345678-1234-5678-1234-567812345678"},
+		{"hex ID", "key a1234567890f", "key a1234567890f"},
+		{"date and hour", "at 2024-05-01 10:00", "at 2024-05-01 10:00"},
+		{"IP address", "from 192.168.100.200", "from 192.168.100.200"},
+		{"short number", "order 123456", "order 123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
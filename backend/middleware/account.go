@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// ActiveAccount refuses requests from suspended accounts, and tokens issued
+// before their account was last signed out everywhere, such as by an admin
+// forcing a password reset. It must run after Auth.
+func ActiveAccount(store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		user, err := store.Users.Get(c.Request.Context(), userID.(int))
+		if err != nil && err != repository.ErrNotFound {
+			RequestLogger(c).Errorf("Failed to load user: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to check account",
+			})
+			c.Abort()
+			return
+		}
+		// A deleted account's tokens are no longer valid either
+		if err != nil || c.GetInt("token_generation") < user.TokenGeneration {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+		if user.SuspendedAt != nil {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "Account suspended",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
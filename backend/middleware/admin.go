@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// Admin restricts a group of routes to the users whose email is listed in
+// ADMIN_EMAILS. Tokens impersonating a user are refused, whoever the user
+// is. It must run after Auth.
+func Admin(cfg *config.Config, store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		user, err := store.Users.Get(c.Request.Context(), userID.(int))
+		if err != nil && err != repository.ErrNotFound {
+			RequestLogger(c).Errorf("Failed to load user: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to check admin access",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil || !IsAdmin(cfg, user.Email) || c.GetInt("impersonator_id") != 0 {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "Admin access required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsAdmin reports whether email is listed in ADMIN_EMAILS
+func IsAdmin(cfg *config.Config, email string) bool {
+	for _, admin := range cfg.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Package middleware holds the gin middleware shared by the API's routes
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+)
+
+// Scopes a token can be limited to, for tools and integrations that
+// shouldn't hold a full session
+const (
+	// ScopeImportContacts lets a token create contacts in bulk, for import
+	// tools
+	ScopeImportContacts = "import:contacts"
+	// ScopeReadContacts lets a token read contacts, their interactions and
+	// reminders, and insights about them
+	ScopeReadContacts = "read:contacts"
+	// ScopeWriteContacts lets a token create, change and delete contacts,
+	// their interactions and reminders
+	ScopeWriteContacts = "write:contacts"
+	// ScopeBackup lets a token back up, restore and export contacts
+	ScopeBackup = "backup"
+	// ScopeLookupContacts lets a token only look up who a phone number
+	// belongs to, for call-screening apps
+	ScopeLookupContacts = "lookup:contacts"
+	// ScopeRevokeLogin lets a token sign out the login it was issued for,
+	// from the link in a new-login alert. No route accepts it.
+	ScopeRevokeLogin = "revoke:login"
+	// ScopeResetPassword lets a token set the new password of a user an
+	// admin required to reset it, from the link emailed to them. No route
+	// accepts it.
+	ScopeResetPassword = "reset:password"
+	// ScopeAnswerInvite lets a token accept or decline an invitation to an
+	// organization, from the link emailed to the invitee. No route accepts
+	// it.
+	ScopeAnswerInvite = "answer:invite"
+	// ScopeConnectContacts lets a token finish connecting the user's
+	// account at a contact provider, as the state of the provider's consent
+	// screen. No route accepts it.
+	ScopeConnectContacts = "connect:contacts"
+	// ScopeRefreshIFTTT lets a token renew the access of a user's
+	// connection to IFTTT, as its OAuth refresh token. No route accepts it.
+	ScopeRefreshIFTTT = "refresh:ifttt"
+)
+
+type Claims struct {
+	UserID   int    `json:"user_id"`
+	DeviceID string `json:"device_id,omitempty"`
+	// Scopes restricts the token to the routes that accept one of them.
+	// Session tokens have no scopes and may call every route.
+	Scopes []string `json:"scopes,omitempty"`
+	// Generation is the user's token generation when the token was issued.
+	// The token is refused once the user is signed out everywhere.
+	Generation int `json:"gen,omitempty"`
+	// Impersonator is the admin a token acting as the user was issued to,
+	// whose ID names the impersonation
+	Impersonator int `json:"imp,omitempty"`
+	jwt.StandardClaims
+}
+
+// HasScope reports whether the claims grant one of scopes
+func (c *Claims) HasScope(scopes []string) bool {
+	for _, granted := range c.Scopes {
+		for _, scope := range scopes {
+			if granted == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Auth validates the JWT token, which is signed with key. Scoped tokens are
+// only accepted if they grant one of scopes.
+func Auth(key []byte, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "Authorization header required",
+			})
+			c.Abort()
+			return
+		}
+
+		// Remove "Bearer " prefix if present
+		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+		claims, err := ParseToken(key, tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+
+		if len(claims.Scopes) > 0 && !claims.HasScope(scopes) {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "Token is not allowed to access this route",
+			})
+			c.Abort()
+			return
+		}
+
+		if claims.Impersonator != 0 {
+			impersonationID, err := strconv.Atoi(claims.Id)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, models.Response{
+					Success: false,
+					Error:   "Invalid token",
+				})
+				c.Abort()
+				return
+			}
+			c.Set("impersonator_id", claims.Impersonator)
+			c.Set("impersonation_id", impersonationID)
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("device_id", claims.DeviceID)
+		c.Set("token_generation", claims.Generation)
+		c.Next()
+	}
+}
+
+// ParseToken checks that tokenString is a valid, unexpired token signed with
+// key and returns its claims
+func ParseToken(key []byte, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"phonesaver-backend/config"
+)
+
+// FailureCounter counts failed attempts per key. A key's count is forgotten
+// once no attempt has failed for the window it was created with.
+type FailureCounter interface {
+	// Failures returns the number of recent failures for key
+	Failures(ctx context.Context, key string) (int, error)
+	// AddFailure records a failure for key
+	AddFailure(ctx context.Context, key string) error
+}
+
+// AuthFailures counts failed logins and signups per client IP
+var AuthFailures FailureCounter
+
+// AuthDelay returns a middleware that slows down clients whose logins and
+// signups keep failing. Once an IP has failed more than AUTH_DELAY_AFTER
+// times, each request from it waits AUTH_DELAY_BASE, doubling with every
+// further failure up to AUTH_DELAY_MAX, before it is handled. Any request
+// refused as invalid or unauthorized counts as a failure.
+func AuthDelay(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.AuthDelayBase <= 0 || AuthFailures == nil {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		key := c.ClientIP()
+
+		failures, err := AuthFailures.Failures(ctx, key)
+		if err != nil {
+			// Fail open, like the rate limiters
+			RequestLogger(c).Errorf("Failed to count auth failures: %v", err)
+		} else if delay := authDelay(cfg, failures); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+
+		switch c.Writer.Status() {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			if err := AuthFailures.AddFailure(ctx, key); err != nil {
+				RequestLogger(c).Errorf("Failed to record auth failure: %v", err)
+			}
+		}
+	}
+}
+
+// authDelay is how long a request is held back after failures
+func authDelay(cfg *config.Config, failures int) time.Duration {
+	excess := failures - cfg.AuthDelayAfter
+	if excess <= 0 {
+		return 0
+	}
+	delay := cfg.AuthDelayBase
+	for i := 1; i < excess && delay < cfg.AuthDelayMax; i++ {
+		delay *= 2
+	}
+	return min(delay, cfg.AuthDelayMax)
+}
+
+// memoryFailureCounter keeps failure counts in process memory
+type memoryFailureCounter struct {
+	window time.Duration
+
+	mu          sync.Mutex
+	counts      map[string]*failureCount
+	lastCleanup time.Time
+}
+
+type failureCount struct {
+	failures int
+	expires  time.Time
+}
+
+func newMemoryFailureCounter(window time.Duration) *memoryFailureCounter {
+	return &memoryFailureCounter{
+		window:      window,
+		counts:      map[string]*failureCount{},
+		lastCleanup: time.Now(),
+	}
+}
+
+func (f *memoryFailureCounter) Failures(ctx context.Context, key string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count, ok := f.counts[key]
+	if !ok || time.Now().After(count.expires) {
+		return 0, nil
+	}
+	return count.failures, nil
+}
+
+func (f *memoryFailureCounter) AddFailure(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.lastCleanup) > f.window {
+		for k, count := range f.counts {
+			if now.After(count.expires) {
+				delete(f.counts, k)
+			}
+		}
+		f.lastCleanup = now
+	}
+
+	count, ok := f.counts[key]
+	if !ok || now.After(count.expires) {
+		count = &failureCount{}
+		f.counts[key] = count
+	}
+	count.failures++
+	count.expires = now.Add(f.window)
+	return nil
+}
+
+// redisFailureCounter keeps failure counts in Redis, shared by every replica
+type redisFailureCounter struct {
+	client *redis.Client
+	prefix string
+	window time.Duration
+}
+
+func (f *redisFailureCounter) Failures(ctx context.Context, key string) (int, error) {
+	failures, err := f.client.Get(ctx, f.prefix+key).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get failure count: %v", err)
+	}
+	return failures, nil
+}
+
+func (f *redisFailureCounter) AddFailure(ctx context.Context, key string) error {
+	pipe := f.client.TxPipeline()
+	pipe.Incr(ctx, f.prefix+key)
+	pipe.Expire(ctx, f.prefix+key, f.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add failure: %v", err)
+	}
+	return nil
+}
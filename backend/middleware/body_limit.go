@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// bodyLimit returns the largest request body accepted by a route: small for
+// authentication, larger for bulk writes and file uploads
+func bodyLimit(cfg *config.Config, route string) int64 {
+	switch route {
+	case "/api/auth/signup", "/api/auth/login":
+		return cfg.MaxAuthBodyBytes
+	case "/api/contacts/bulk", "/api/sync":
+		return cfg.MaxBulkBodyBytes
+	case "/api/backup/import":
+		return cfg.MaxUploadBytes
+	}
+	return cfg.MaxBodyBytes
+}
+
+// uploadRoutes stream their bodies rather than reading them into memory, so
+// their limit is only enforced as they are read
+var uploadRoutes = map[string]bool{
+	"/api/backup/import": true,
+}
+
+// BodyLimit rejects request bodies larger than the route's limit
+// with 413. Bodies of unknown length are read up front so that handlers don't
+// see a truncated body, except on upload routes, which check
+// IsBodyTooLarge themselves.
+func BodyLimit(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := bodyLimit(cfg, c.FullPath())
+		if c.Request.ContentLength > limit {
+			RespondBodyTooLarge(c, limit)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		if c.Request.ContentLength < 0 && !uploadRoutes[c.FullPath()] {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				if IsBodyTooLarge(err) {
+					RespondBodyTooLarge(c, limit)
+				} else {
+					c.JSON(http.StatusBadRequest, models.Response{
+						Success: false,
+						Error:   "Invalid request format",
+					})
+				}
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		c.Next()
+	}
+}
+
+// IsBodyTooLarge reports whether reading a request body failed because it
+// exceeded its limit
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// RespondBodyTooLarge writes the 413 response for a body over limit bytes
+func RespondBodyTooLarge(c *gin.Context, limit int64) {
+	c.JSON(http.StatusRequestEntityTooLarge, models.Response{
+		Success: false,
+		Error: models.ValidationError{
+			Field:   "body",
+			Message: fmt.Sprintf("Request body must be at most %d bytes", limit),
+		},
+	})
+}
+
+// SpoolFormFile streams the named file field of a multipart request to a
+// temporary file, rather than buffering the form in memory as FormFile does.
+// The returned function closes and removes the file.
+func SpoolFormFile(c *gin.Context, field string) (*os.File, string, func(), error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if part.FormName() != field {
+			part.Close()
+			continue
+		}
+
+		f, err := os.CreateTemp("", "phonesaver-upload-*")
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create temporary file: %v", err)
+		}
+		cleanup := func() {
+			f.Close()
+			os.Remove(f.Name())
+		}
+		if _, err := io.Copy(f, part); err != nil {
+			cleanup()
+			return nil, "", nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			cleanup()
+			return nil, "", nil, err
+		}
+		return f, part.FileName(), cleanup, nil
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+)
+
+// corsExposeHeaders are the response headers clients need to read
+var corsExposeHeaders = []string{
+	"Content-Length", "ETag", "Last-Modified", "Idempotent-Replayed", "X-Request-ID",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After",
+}
+
+// CORS returns the CORS middleware for the configured origins. With
+// no origins it adds no CORS headers, so browsers refuse cross-origin
+// requests.
+func CORS(cfg *config.Config) gin.HandlerFunc {
+	if len(cfg.CORSOrigins) == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	corsConfig := cors.Config{
+		AllowMethods:     cfg.CORSMethods,
+		AllowHeaders:     cfg.CORSHeaders,
+		ExposeHeaders:    corsExposeHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+	if config.AllOrigins(cfg.CORSOrigins) {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.CORSOrigins
+	}
+	return cors.New(corsConfig)
+}
+
+// OriginAllowed reports whether a browser on origin may use the API.
+// Requests without an Origin header don't come from a browser page.
+func OriginAllowed(cfg *config.Config, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || config.AllOrigins(cfg.CORSOrigins) {
+		return true
+	}
+	for _, allowed := range cfg.CORSOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+	return false
+}
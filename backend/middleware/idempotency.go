@@ -0,0 +1,297 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// idempotencyKeyTTL is how long responses are kept for replay
+	idempotencyKeyTTL = 24 * time.Hour
+	// maxIdempotencyKeyLen bounds the Idempotency-Key header
+	maxIdempotencyKeyLen = 255
+	// idempotencyLockTimeout is how long a request may run before its key
+	// is considered abandoned, such as after a crash, and may be reused
+	idempotencyLockTimeout = 10 * time.Minute
+	// idempotencyCleanupInterval is how often expired keys are purged
+	idempotencyCleanupInterval = time.Hour
+)
+
+// idempotentHeaders are the response headers stored and replayed along with
+// the body
+var idempotentHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location"}
+
+// responseRecorder captures the response written by a handler while still
+// writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes POST requests with an Idempotency-Key header
+// safe to retry. The first response for a key is stored for 24 hours and
+// replayed for later requests with the same key and body; reusing a key for a
+// different request is rejected. Server errors and the responses of routes
+// marked with SecretResponse are not stored, so the request can be retried.
+// Multipart uploads are spooled to a temporary file while their body is
+// hashed, rather than read into memory.
+func Idempotency(cfg *config.Config, store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error: models.ValidationError{
+					Field:   "Idempotency-Key",
+					Message: "Idempotency-Key must be at most 255 characters",
+				},
+			})
+			c.Abort()
+			return
+		}
+		userID, _ := c.Get("user_id")
+
+		sum := sha256.New()
+		sum.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		if c.ContentType() == "multipart/form-data" {
+			f, err := os.CreateTemp("", "phonesaver-upload-*")
+			if err != nil {
+				RequestLogger(c).Errorf("Failed to create temporary file: %v", err)
+				c.JSON(http.StatusInternalServerError, models.Response{
+					Success: false,
+					Error:   "Failed to process request",
+				})
+				c.Abort()
+				return
+			}
+			defer func() {
+				f.Close()
+				os.Remove(f.Name())
+			}()
+			_, err = io.Copy(io.MultiWriter(f, sum), c.Request.Body)
+			if err == nil {
+				_, err = f.Seek(0, io.SeekStart)
+			}
+			if !readIdempotentBody(c, cfg, err) {
+				return
+			}
+			c.Request.Body = f
+		} else {
+			body, err := io.ReadAll(c.Request.Body)
+			if !readIdempotentBody(c, cfg, err) {
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			sum.Write(body)
+		}
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		now := time.Now().UTC()
+		claimed, err := claimIdempotencyKey(c.Request.Context(), store, userID, key, fingerprint, now)
+		if err != nil {
+			RequestLogger(c).Errorf("Failed to claim idempotency key: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to process request",
+			})
+			c.Abort()
+			return
+		}
+		if !claimed {
+			replayIdempotentResponse(c, store, userID, key, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The response is stored even if the request's context has expired
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || c.GetBool(secretResponseKey) {
+			// Release the key so the client's retry runs the request again,
+			// and secrets such as tokens aren't kept in the database
+			if _, err := store.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID, key); err != nil {
+				RequestLogger(c).Errorf("Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		headers := map[string]string{}
+		for _, name := range idempotentHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		encoded, _ := json.Marshal(headers)
+		_, err = store.DB.ExecContext(ctx,
+			"UPDATE idempotency_keys SET status_code = ?, headers = ?, body = ? WHERE user_id = ? AND idempotency_key = ?",
+			status, encoded, recorder.body.Bytes(), userID, key,
+		)
+		if err != nil {
+			RequestLogger(c).Errorf("Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// readIdempotentBody reports whether the request's body was read without
+// err, responding with 413 or 400 if not
+func readIdempotentBody(c *gin.Context, cfg *config.Config, err error) bool {
+	if IsBodyTooLarge(err) {
+		RespondBodyTooLarge(c, bodyLimit(cfg, c.FullPath()))
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// secretResponseKey is the context key set by SecretResponse
+const secretResponseKey = "secret_response"
+
+// SecretResponse marks a route whose response carries a secret, such as a
+// newly issued token, so that Idempotency doesn't store it for replay. It
+// must run after Idempotency.
+func SecretResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(secretResponseKey, true)
+		c.Next()
+	}
+}
+
+// claimIdempotencyKey records a new request for the key, returning false if
+// the key has already been used. Expired and abandoned keys are claimed
+// afresh.
+func claimIdempotencyKey(ctx context.Context, store *repository.Store, userID interface{}, key, fingerprint string, now time.Time) (bool, error) {
+	_, err := store.DB.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?
+		AND (created_at < ? OR (status_code IS NULL AND created_at < ?))`,
+		userID, key, now.Add(-idempotencyKeyTTL), now.Add(-idempotencyLockTimeout),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = store.DB.ExecContext(ctx,
+		"INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, created_at) VALUES (?, ?, ?, ?)",
+		userID, key, fingerprint, now,
+	)
+	if store.IsDuplicate(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// replayIdempotentResponse writes the stored response for a key that has
+// already been used
+func replayIdempotentResponse(c *gin.Context, store *repository.Store, userID interface{}, key, fingerprint string) {
+	var storedFingerprint string
+	var status sql.NullInt64
+	var headers, body []byte
+	err := store.DB.QueryRowContext(c.Request.Context(),
+		"SELECT fingerprint, status_code, headers, body FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?",
+		userID, key,
+	).Scan(&storedFingerprint, &status, &headers, &body)
+	if err == sql.ErrNoRows {
+		// The first request failed and released the key in the meantime
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "A request with this Idempotency-Key failed; please retry",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		RequestLogger(c).Errorf("Failed to load idempotent response: %v", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to process request",
+		})
+		c.Abort()
+		return
+	}
+
+	switch {
+	case storedFingerprint != fingerprint:
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   "Idempotency-Key was already used for a different request",
+		})
+		c.Abort()
+	case !status.Valid:
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "A request with this Idempotency-Key is still in progress",
+		})
+		c.Abort()
+	default:
+		var stored map[string]string
+		if err := json.Unmarshal(headers, &stored); err != nil {
+			RequestLogger(c).Errorf("Failed to decode idempotent response headers: %v", err)
+		}
+		for name, value := range stored {
+			c.Header(name, value)
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(int(status.Int64))
+		c.Writer.Write(body)
+		c.Abort()
+	}
+}
+
+// RunIdempotencyCleanup periodically purges expired idempotency keys
+func RunIdempotencyCleanup(store *repository.Store) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := store.DB.ExecContext(context.Background(),
+			"DELETE FROM idempotency_keys WHERE created_at < ?",
+			time.Now().UTC().Add(-idempotencyKeyTTL),
+		)
+		if err != nil {
+			logging.Errorf("Failed to purge idempotency keys: %v", err)
+			continue
+		}
+		if purged, _ := result.RowsAffected(); purged > 0 {
+			logging.Infof("Purged %d expired idempotency keys", purged)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/repository"
+)
+
+// testStore returns a store backed by a new SQLite database
+func testStore(t *testing.T) (*config.Config, *repository.Store) {
+	t.Helper()
+	cfg := &config.Config{
+		DBDriver:       config.DBDriverSQLite,
+		DBPath:         filepath.Join(t.TempDir(), "test.db"),
+		DataKey:        base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+		DBTimeout:      5 * time.Second,
+		DBMaxOpenConns: 1,
+		MaxBodyBytes:   1 << 20,
+		MaxUploadBytes: 1 << 20,
+	}
+	if _, err := repository.Migrate(cfg); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	store, err := repository.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return cfg, store
+}
+
+// multipartUpload returns the body of an upload of content, and its
+// content type
+func multipartUpload(t *testing.T, content string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.SetBoundary("test-boundary"); err != nil {
+		t.Fatalf("SetBoundary: %v", err)
+	}
+	part, err := w.CreateFormFile("file", "contacts.csv")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	io.WriteString(part, content)
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+func TestIdempotencyMultipart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, store := testStore(t)
+	userID, err := store.Users.Create(context.Background(), "user@example.com", "hash")
+	if err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+
+	runs := 0
+	r := gin.New()
+	r.POST("/api/backup/import", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	}, Idempotency(cfg, store), func(c *gin.Context) {
+		f, _, cleanup, err := SpoolFormFile(c, "file")
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		defer cleanup()
+		content, _ := io.ReadAll(f)
+		runs++
+		c.String(http.StatusOK, string(content))
+	})
+
+	send := func(content string) *httptest.ResponseRecorder {
+		body, contentType := multipartUpload(t, content)
+		req := httptest.NewRequest(http.MethodPost, "/api/backup/import", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Idempotency-Key", "upload-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("name,phone\nAnn,1"); w.Code != http.StatusOK || w.Body.String() != "name,phone\nAnn,1" {
+		t.Fatalf("first upload = %d %q, want 200 with the file", w.Code, w.Body.String())
+	}
+	if w := send("name,phone\nBob,2"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different upload of the same length = %d, want 422", w.Code)
+	}
+	w := send("name,phone\nAnn,1")
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retried upload = %d, replayed %q, want a replayed 200", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if runs != 1 {
+		t.Errorf("handler ran %d times, want 1", runs)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// IFTTTServiceKey restricts a group of routes to IFTTT, which sends the
+// service's IFTTT_SERVICE_KEY in the IFTTT-Service-Key header of every
+// request. The routes are not found while IFTTT_SERVICE_KEY is not set.
+func IFTTTServiceKey(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.IFTTTServiceKey == "" {
+			c.JSON(http.StatusNotFound, models.Response{
+				Success: false,
+				Error:   "IFTTT is not enabled",
+			})
+			c.Abort()
+			return
+		}
+		key := c.GetHeader("IFTTT-Service-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.IFTTTServiceKey)) != 1 {
+			c.JSON(http.StatusUnauthorized, models.IFTTTErrors{
+				Errors: []models.IFTTTError{{Message: "Invalid service key"}},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
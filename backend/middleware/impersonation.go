@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// auditImpersonatedRequest is the audit log action of a request an admin
+// made as the user
+const auditImpersonatedRequest = "impersonated_request"
+
+// Impersonation refuses tokens of impersonations that were ended, and flags
+// every request made with the others in the user's audit log, naming the
+// admin. It must run after ActiveAccount.
+func Impersonation(store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetInt("impersonation_id")
+		if id == 0 {
+			c.Next()
+			return
+		}
+		impersonation, err := store.Impersonations.Get(c.Request.Context(), id)
+		if err != nil && err != repository.ErrNotFound {
+			RequestLogger(c).Errorf("Failed to load impersonation: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to check token",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil || impersonation.EndedAt != nil || !time.Now().Before(impersonation.ExpiresAt) {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		// Recorded once the response is written, which the request's
+		// cancellation shouldn't stop
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := store.Impersonations.CountRequest(ctx, id); err != nil {
+			RequestLogger(c).Errorf("Failed to count impersonated request: %v", err)
+		}
+		event := models.AuditEvent{
+			UserID:    c.GetInt("user_id"),
+			Action:    auditImpersonatedRequest,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details: map[string]string{
+				"admin_id":         strconv.Itoa(c.GetInt("impersonator_id")),
+				"impersonation_id": strconv.Itoa(id),
+				"method":           c.Request.Method,
+				"path":             c.Request.URL.Path,
+				"status":           strconv.Itoa(c.Writer.Status()),
+			},
+		}
+		if err := store.Audit.Record(ctx, &event); err != nil {
+			logging.Errorf("Failed to record %s audit event: %v", event.Action, err)
+		}
+	}
+}
+
+// NotImpersonating refuses tokens impersonating a user, for routes that
+// would give an admin access outlasting the impersonation, such as issuing
+// tokens. It must run after Auth.
+func NotImpersonating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt("impersonator_id") != 0 {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "Not allowed while impersonating a user",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// auditAccessBlocked is the audit log action of a request refused by an
+	// IP or country filter
+	auditAccessBlocked = "access_blocked"
+	// blockAuditInterval is how often a block of the same client for the
+	// same reason is audited, so a blocked client retrying in a loop
+	// doesn't flood the audit log
+	blockAuditInterval = time.Minute
+)
+
+// Reasons a request was blocked, recorded in the audit log
+const (
+	blockDenylist       = "ip_denylist"
+	blockCountry        = "country"
+	blockAdminAllowlist = "admin_ip_allowlist"
+)
+
+// IPFilter returns a middleware that refuses requests from IPs in
+// IP_DENYLIST and, when the proxy in front of the server reports the
+// client's country in GEO_COUNTRY_HEADER, from GEO_BLOCKED_COUNTRIES.
+// Blocks are recorded in the audit log.
+func IPFilter(cfg *config.Config, store *repository.Store) gin.HandlerFunc {
+	// The lists were validated by config.Load
+	denylist, _ := config.ParseIPPrefixes(cfg.IPDenylist)
+	blocked := map[string]bool{}
+	for _, country := range cfg.BlockedCountries {
+		blocked[strings.ToUpper(country)] = true
+	}
+	auditor := newBlockAuditor(store)
+
+	return func(c *gin.Context) {
+		if len(denylist) > 0 && containsIP(denylist, c.ClientIP()) {
+			auditor.block(c, blockDenylist, nil)
+			return
+		}
+		if len(blocked) > 0 {
+			country := strings.ToUpper(strings.TrimSpace(c.GetHeader(cfg.GeoCountryHeader)))
+			if blocked[country] {
+				auditor.block(c, blockCountry, map[string]string{"country": country})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// AdminIPAllowlist returns a middleware that only lets requests from IPs in
+// ADMIN_IP_ALLOWLIST through, or any IP when the list is empty. Blocks are
+// recorded in the audit log. It must run after Auth.
+func AdminIPAllowlist(cfg *config.Config, store *repository.Store) gin.HandlerFunc {
+	// The list was validated by config.Load
+	allowlist, _ := config.ParseIPPrefixes(cfg.AdminIPAllowlist)
+	auditor := newBlockAuditor(store)
+
+	return func(c *gin.Context) {
+		if len(allowlist) > 0 && !containsIP(allowlist, c.ClientIP()) {
+			auditor.block(c, blockAdminAllowlist, nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// containsIP reports whether ip is in one of prefixes
+func containsIP(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockAuditor refuses blocked requests and records them in the audit log,
+// at most once per blockAuditInterval for each client and reason
+type blockAuditor struct {
+	store *repository.Store
+
+	mu          sync.Mutex
+	audited     map[string]time.Time
+	lastCleanup time.Time
+}
+
+func newBlockAuditor(store *repository.Store) *blockAuditor {
+	return &blockAuditor{store: store, audited: map[string]time.Time{}, lastCleanup: time.Now()}
+}
+
+// block refuses the request, auditing it unless the same block was audited
+// recently
+func (a *blockAuditor) block(c *gin.Context, reason string, details map[string]string) {
+	c.JSON(http.StatusForbidden, models.Response{
+		Success: false,
+		Error:   "Access denied",
+	})
+	c.Abort()
+
+	if !a.due(reason + " " + c.ClientIP()) {
+		return
+	}
+	event := models.AuditEvent{
+		UserID:    c.GetInt("user_id"),
+		Action:    auditAccessBlocked,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		DeviceID:  c.GetString("device_id"),
+		Details:   map[string]string{"reason": reason, "path": c.Request.URL.Path},
+	}
+	for key, value := range details {
+		event.Details[key] = value
+	}
+	if err := a.store.Audit.Record(c.Request.Context(), &event); err != nil {
+		logging.Errorf("Failed to record %s audit event: %v", event.Action, err)
+	}
+}
+
+// due reports whether a block with key should be audited, marking it as
+// audited now if so
+func (a *blockAuditor) due(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(a.lastCleanup) > blockAuditInterval {
+		for k, at := range a.audited {
+			if now.Sub(at) > blockAuditInterval {
+				delete(a.audited, k)
+			}
+		}
+		a.lastCleanup = now
+	}
+	if at, ok := a.audited[key]; ok && now.Sub(at) < blockAuditInterval {
+		return false
+	}
+	a.audited[key] = now
+	return true
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+)
+
+// redactedValue replaces the query values of contact routes in the request
+// log
+const redactedValue = "[redacted]"
+
+// Logger returns a gin middleware that logs each request, at warn
+// level for client errors and error level for server errors. Successful
+// health probes are logged at debug level so they don't flood the logs.
+// Request bodies are never logged, and neither are the query values of
+// contact routes, which search and filter by contacts' details, nor tokens
+// passed in the query; emails and phone numbers in other queries are masked.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// Process request
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case c.FullPath() == "/healthz" || c.FullPath() == "/readyz":
+			level = slog.LevelDebug
+		}
+		RequestLogger(c).Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"query", redactQuery(c.FullPath(), c.Request.URL.RawQuery),
+			"status", status,
+			"latency_ms", float64(time.Since(start))/float64(time.Millisecond),
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// isContactRoute reports whether route reads or writes contacts: the routes
+// with a contacts segment, such as an organization's /api/orgs/:org/contacts,
+// and sync
+func isContactRoute(route string) bool {
+	if route == "/api/sync" {
+		return true
+	}
+	for _, segment := range strings.Split(route, "/") {
+		if segment == "contacts" {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery returns a request's query string as it is logged, decoded:
+// with every value replaced on contact routes, tokens replaced everywhere,
+// and emails and phone numbers masked
+func redactQuery(route, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return logging.Redact(rawQuery)
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range query[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			if isContactRoute(route) || key == "token" {
+				value = redactedValue
+			}
+			b.WriteString(logging.Redact(key + "=" + value))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+)
+
+// APIVersion is the version of the API, reported in every response's meta
+// block and in the OpenAPI document
+const APIVersion = "1.0.0"
+
+// newMeta returns the meta block shared by every response to the request
+func newMeta(c *gin.Context) *models.Meta {
+	return &models.Meta{RequestID: c.GetString("request_id"), APIVersion: APIVersion}
+}
+
+// ListMeta returns the meta block for a list of total items. next is the
+// cursor of the next page, or empty on the last page.
+func ListMeta(c *gin.Context, total int, next string) *models.Meta {
+	meta := newMeta(c)
+	meta.Total = &total
+	meta.NextCursor = next
+	return meta
+}
+
+// envelopePrefix is how a Response without a meta block starts when encoded
+var envelopePrefix = []byte(`{"success":`)
+
+// metaWriter adds the request's meta block to Responses written without one.
+// The envelope is always written in one piece by c.JSON, and Meta is its first
+// field, so responses that set it start with {"meta": instead.
+type metaWriter struct {
+	gin.ResponseWriter
+	field   []byte
+	written bool
+}
+
+func newMetaWriter(c *gin.Context) *metaWriter {
+	encoded, _ := json.Marshal(newMeta(c))
+	field := append([]byte(`"meta":`), encoded...)
+	return &metaWriter{ResponseWriter: c.Writer, field: append(field, ',')}
+}
+
+func (w *metaWriter) Write(data []byte) (int, error) {
+	if w.written || !bytes.HasPrefix(data, envelopePrefix) {
+		w.written = true
+		return w.ResponseWriter.Write(data)
+	}
+	w.written = true
+	out := make([]byte, 0, len(data)+len(w.field))
+	out = append(out, '{')
+	out = append(out, w.field...)
+	out = append(out, data[1:]...)
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *metaWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
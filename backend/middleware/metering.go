@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/repository"
+)
+
+// Metering counts the API calls of signed-in users in their usage. It must
+// run after Auth, and before OrganizationAccount so calls to an
+// organization's contacts count for the member who made them.
+func Metering(store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		// Metered once the response is written, which the request's
+		// cancellation shouldn't stop
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := store.Usage.Add(ctx, c.GetInt("user_id"), repository.MetricAPICalls, 1); err != nil {
+			RequestLogger(c).Errorf("Failed to meter API call: %v", err)
+		}
+	}
+}
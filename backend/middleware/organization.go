@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// Organization restricts a group of routes under /orgs/:org to the members
+// of the organization, which it stores in the context as "organization"
+// with the user's role. Others get 404, as if it didn't exist. It must run
+// after Auth.
+func Organization(store *repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		orgID, err := strconv.Atoi(c.Param("org"))
+		if err != nil {
+			organizationNotFound(c)
+			return
+		}
+		org, err := store.Organizations.Member(c.Request.Context(), orgID, userID.(int))
+		if err == repository.ErrNotFound {
+			organizationNotFound(c)
+			return
+		}
+		if err != nil {
+			RequestLogger(c).Errorf("Failed to load organization: %v", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "Failed to check organization access",
+			})
+			c.Abort()
+			return
+		}
+		c.Set("organization", org)
+		c.Next()
+	}
+}
+
+// OrganizationRole restricts a group of routes to the members of the
+// organization with one of roles. It must run after Organization.
+func OrganizationRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, _ := c.Get("organization")
+		role := org.(models.Organization).Role
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Your role in this organization doesn't allow this",
+		})
+		c.Abort()
+	}
+}
+
+// OrganizationAccount makes the routes after it work with the contacts of
+// the organization, as the user's own routes do with theirs: "user_id"
+// becomes the organization's account and "member_id" the user. It must run
+// after Organization.
+func OrganizationAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, _ := c.Get("organization")
+		c.Set("member_id", c.GetInt("user_id"))
+		c.Set("user_id", org.(models.Organization).AccountID)
+		c.Next()
+	}
+}
+
+func organizationNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   "Organization not found",
+	})
+	c.Abort()
+}
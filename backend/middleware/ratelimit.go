@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// memoryLimiterIdle is how long an unused key's bucket is kept in memory
+const memoryLimiterIdle = 10 * time.Minute
+
+// RateLimiter is a token bucket per key, refilled at a fixed rate up to a
+// burst size
+type RateLimiter interface {
+	// Allow takes a token from key's bucket, if it isn't empty
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+}
+
+// RateLimitResult is the state of a bucket after taking a token from it
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, if none is now
+	RetryAfter time.Duration
+}
+
+// bucketResult describes a bucket holding tokens after a request
+func bucketResult(allowed bool, tokens float64, limit rate.Limit, burst int) RateLimitResult {
+	tokens = math.Max(0, tokens)
+	perToken := time.Duration(float64(time.Second) / float64(limit))
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     burst,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(burst) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return result
+}
+
+// SetRateLimitHeaders describes the bucket to the client, adding Retry-After
+// when the request was refused
+func SetRateLimitHeaders(c *gin.Context, result RateLimitResult) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+var (
+	// APILimiter limits all API requests
+	APILimiter RateLimiter
+	// SignupLimiter limits signups per client IP
+	SignupLimiter RateLimiter
+)
+
+// InitRateLimiters creates the rate limiters and AuthFailures in the store
+// selected by RATE_LIMIT_STORE: in memory, which limits each replica
+// separately, or in Redis, which shares the limits between replicas
+func InitRateLimiters(cfg *config.Config) error {
+	newLimiter := func(name string, limit rate.Limit, burst int) RateLimiter {
+		return newMemoryRateLimiter(limit, burst)
+	}
+	newCounter := func(name string, window time.Duration) FailureCounter {
+		return newMemoryFailureCounter(window)
+	}
+	switch cfg.RateLimitStore {
+	case "", config.RateLimitStoreMemory:
+	case config.RateLimitStoreRedis:
+		if cfg.RedisURL == "" {
+			return fmt.Errorf("REDIS_URL must be set to store rate limits in Redis")
+		}
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return fmt.Errorf("invalid REDIS_URL: %v", err)
+		}
+		client := redis.NewClient(opts)
+		newLimiter = func(name string, limit rate.Limit, burst int) RateLimiter {
+			return &redisRateLimiter{client: client, prefix: "ratelimit:" + name + ":", limit: limit, burst: burst}
+		}
+		newCounter = func(name string, window time.Duration) FailureCounter {
+			return &redisFailureCounter{client: client, prefix: "failures:" + name + ":", window: window}
+		}
+	default:
+		return fmt.Errorf("unknown RATE_LIMIT_STORE %q", cfg.RateLimitStore)
+	}
+
+	APILimiter = newLimiter("api", rate.Every(cfg.RateLimitAPIInterval), cfg.RateLimitAPIBurst)
+	SignupLimiter = newLimiter("signup", rate.Every(cfg.RateLimitSignupInterval), cfg.RateLimitSignupBurst)
+	AuthFailures = newCounter("auth", cfg.AuthFailureWindow)
+	return nil
+}
+
+// RateLimit returns a middleware that limits requests against a single
+// bucket shared by all clients, describing the bucket in the X-RateLimit
+// headers of every response
+func RateLimit(limiter RateLimiter, key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(c.Request.Context(), key)
+		if err != nil {
+			// Fail open rather than rejecting every request while the
+			// store is unavailable
+			RequestLogger(c).Errorf("Failed to check rate limit: %v", err)
+			c.Next()
+			return
+		}
+		SetRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.JSON(http.StatusTooManyRequests, models.Response{
+				Success: false,
+				Error:   "Rate limit exceeded",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// memoryRateLimiter keeps buckets in process memory
+type memoryRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu          sync.Mutex
+	buckets     map[string]*memoryBucket
+	lastCleanup time.Time
+}
+
+type memoryBucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func newMemoryRateLimiter(limit rate.Limit, burst int) *memoryRateLimiter {
+	return &memoryRateLimiter{
+		limit:       limit,
+		burst:       burst,
+		buckets:     map[string]*memoryBucket{},
+		lastCleanup: time.Now(),
+	}
+}
+
+func (l *memoryRateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastCleanup) > memoryLimiterIdle {
+		for k, bucket := range l.buckets {
+			if now.Sub(bucket.lastUsed) > memoryLimiterIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = bucket
+	}
+	bucket.lastUsed = now
+	allowed := bucket.limiter.AllowN(now, 1)
+	return bucketResult(allowed, bucket.limiter.TokensAt(now), l.limit, l.burst), nil
+}
+
+// redisTokenBucket refills and takes from a bucket atomically, using the
+// Redis server's clock so replicas agree on the time
+var redisTokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('EXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// redisRateLimiter keeps buckets in Redis, shared by every replica
+type redisRateLimiter struct {
+	client *redis.Client
+	prefix string
+	limit  rate.Limit
+	burst  int
+}
+
+func (l *redisRateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	// Buckets expire once they would have refilled completely
+	ttl := int(math.Ceil(float64(l.burst)/float64(l.limit))) + 1
+	reply, err := redisTokenBucket.Run(ctx, l.client, []string{l.prefix + key}, float64(l.limit), l.burst, ttl).Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to take rate limit token: %v", err)
+	}
+	if len(reply) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := reply[0].(int64)
+	tokensText, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("invalid rate limit tokens %q: %v", tokensText, err)
+	}
+	return bucketResult(allowed == 1, tokens, l.limit, l.burst), nil
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"phonesaver-backend/logging"
+)
+
+// requestIDHeader carries the request ID in requests and responses
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern is the form of client-supplied request IDs that are
+// honored; others are replaced so they can't inject into logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID assigns each request an ID, reusing the client's
+// X-Request-ID if it has a valid one. The ID is returned in the X-Request-ID
+// header and the response envelope's meta block, and is attached to the
+// request's log records.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Writer = newMetaWriter(c)
+		c.Next()
+	}
+}
+
+// RequestLogger returns the logger for a request, which adds the request ID,
+// route and, once authenticated, user ID to each record
+func RequestLogger(c *gin.Context) *logging.Logger {
+	args := []any{"request_id", c.GetString("request_id"), "route", c.FullPath()}
+	if userID, ok := c.Get("user_id"); ok {
+		args = append(args, "user_id", userID)
+	}
+	return logging.With(args...)
+}
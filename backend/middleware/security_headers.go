@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+)
+
+// SecurityHeaders returns a middleware that sets the security headers of the
+// configured policy on every response: Content-Security-Policy,
+// Permissions-Policy, Strict-Transport-Security and X-Frame-Options, each
+// left out when its setting is empty, and X-Content-Type-Options. Routes
+// that need a different policy, such as an HTML page, may replace a header.
+func SecurityHeaders(cfg *config.Config) gin.HandlerFunc {
+	if !cfg.SecureHeaders {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	headers := http.Header{}
+	headers.Set("X-Content-Type-Options", "nosniff")
+	if cfg.CSPPolicy != "" {
+		headers.Set("Content-Security-Policy", cfg.CSPPolicy)
+	}
+	if cfg.PermissionsPolicy != "" {
+		headers.Set("Permissions-Policy", cfg.PermissionsPolicy)
+	}
+	if cfg.HSTSMaxAge > 0 {
+		hsts := fmt.Sprintf("max-age=%d", int64(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+		headers.Set("Strict-Transport-Security", hsts)
+	}
+	if cfg.FrameOptions != config.FrameOptionsNone {
+		headers.Set("X-Frame-Options", cfg.FrameOptions)
+	}
+
+	return func(c *gin.Context) {
+		for name := range headers {
+			c.Header(name, headers.Get(name))
+		}
+		c.Next()
+	}
+}
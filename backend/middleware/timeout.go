@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/models"
+)
+
+// longLivedRoutes hold their connection open for as long as the client
+// stays, so they are not bounded by REQUEST_TIMEOUT
+var longLivedRoutes = map[string]bool{
+	"/api/ws": true,
+}
+
+// Timeout bounds each request's context by REQUEST_TIMEOUT, so the queries
+// and storage calls made with it fail rather than hang. A server error
+// written once the context has ended is reported as 503 if the request ran
+// out of time, or 408 if the client went away.
+func Timeout(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if longLivedRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.RequestTimeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Next()
+	}
+}
+
+// timeoutWriter replaces a server error caused by the request's context
+// ending with a response saying so
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+	// body replaces the handler's body once the status has been replaced
+	body []byte
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && !w.Written() && w.ctx.Err() != nil {
+		message := "Request timed out"
+		code = http.StatusServiceUnavailable
+		if !errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+			message = "Request was cancelled"
+			code = http.StatusRequestTimeout
+		}
+		w.body, _ = json.Marshal(models.Response{Success: false, Error: message})
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.body == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.Written() {
+		if _, err := w.ResponseWriter.Write(w.body); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
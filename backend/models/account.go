@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Account describes a user account in its data export
+type Account struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountExport is everything stored about a user, in the machine-readable
+// form the account data export is downloaded in
+type AccountExport struct {
+	Version              int                    `json:"version"`
+	ExportedAt           time.Time              `json:"exported_at"`
+	Account              Account                `json:"account"`
+	Contacts             []ContactResponse      `json:"contacts"`
+	Interactions         []Interaction          `json:"interactions"`
+	Reminders            []Reminder             `json:"reminders"`
+	ShareLinks           []ShareLink            `json:"share_links"`
+	Backups              []BackupManifest       `json:"backups"`
+	Devices              []Device               `json:"devices"`
+	NotificationSettings NotificationSettings   `json:"notification_settings"`
+	Notifications        []NotificationDelivery `json:"notifications"`
+	Webhooks             []Webhook              `json:"webhooks"`
+	AuditLog             []AuditEvent           `json:"audit_log"`
+}
+
+// AccountDeletion describes whether a user's account is scheduled to be
+// erased, and when
+type AccountDeletion struct {
+	Scheduled bool       `json:"scheduled"`
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`
+}
+
+// PrivacySettings holds a user's privacy preferences. With EnhancedPrivacy
+// the tags of their contacts and the notes on their interactions and
+// reminders are stored encrypted, and tags can only be filtered on in full.
+// ContactEnrichment opts in to sending contacts' email addresses to the
+// enrichment provider, which suggests their photos and companies.
+type PrivacySettings struct {
+	EnhancedPrivacy   bool `json:"enhanced_privacy"`
+	ContactEnrichment bool `json:"contact_enrichment"`
+}
+
+// AdminUser is an account as admins managing it see it
+type AdminUser struct {
+	ID                    int        `json:"id"`
+	Email                 string     `json:"email"`
+	CreatedAt             time.Time  `json:"created_at"`
+	Suspended             bool       `json:"suspended"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
+	Contacts              int        `json:"contacts"`
+	Devices               int        `json:"devices"`
+}
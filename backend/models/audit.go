@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditEvent records a security-relevant action on an account, such as a
+// login or an export
+type AuditEvent struct {
+	ID     int64  `json:"id"`
+	UserID int    `json:"-"`
+	Action string `json:"action"`
+	// IP and UserAgent identify the client that performed the action
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+	DeviceID  string `json:"device_id,omitempty"`
+	// Details holds facts specific to the action, such as a restore's mode
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// BackupManifest records the outcome of a single backup run
+type BackupManifest struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Mode        string     `json:"mode"`
+	Status      string     `json:"status"`
+	Written     int        `json:"written"`
+	Deleted     int        `json:"deleted"`
+	Unchanged   int        `json:"unchanged"`
+	Total       int        `json:"total"`
+	Checksum    string     `json:"checksum,omitempty"`
+	Encrypted   bool       `json:"encrypted"`
+	SizeBytes   int64      `json:"size_bytes"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// BackupArchive is the plaintext content of an exported backup
+type BackupArchive struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Contacts   []Contact `json:"contacts"`
+}
+
+// ContactChange describes a contact that differs between a backup and the
+// current contacts
+type ContactChange struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// BackupDiff lists the contacts added, removed, or changed since a backup
+type BackupDiff struct {
+	Added   []ContactChange `json:"added"`
+	Removed []ContactChange `json:"removed"`
+	Changed []ContactChange `json:"changed"`
+}
+
+// RestorePlan summarizes the effect of restoring a backup over local contacts
+type RestorePlan struct {
+	Mode        string `json:"mode"`
+	Adds        int    `json:"adds"`
+	Overwrites  int    `json:"overwrites"`
+	Deletions   int    `json:"deletions"`
+	Conflicts   int    `json:"conflicts"`
+	Unchanged   int    `json:"unchanged"`
+	ConflictIDs []int  `json:"conflict_ids"`
+}
+
+// BackupQuota describes a user's backup usage against the configured limits
+type BackupQuota struct {
+	UsedBytes    int64 `json:"used_bytes"`
+	MaxBytes     int64 `json:"max_bytes"`
+	Snapshots    int   `json:"snapshots"`
+	MaxSnapshots int   `json:"max_snapshots"`
+}
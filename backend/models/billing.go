@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Plan is a billing tier and what the accounts on it may use. Limits of 0
+// are unlimited.
+type Plan struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	MaxContacts    int      `json:"max_contacts"`
+	BackupMaxBytes int64    `json:"backup_max_bytes"`
+	Features       []string `json:"features"`
+}
+
+// Subscription is the plan an account is on, and the Stripe subscription
+// paying for it if there is one
+type Subscription struct {
+	UserID           int
+	Plan             string
+	Status           string
+	CustomerID       string
+	SubscriptionID   string
+	CurrentPeriodEnd *time.Time
+	// UpdatedAt is when Stripe reported the subscription's state, so older
+	// reports arriving late can be ignored
+	UpdatedAt time.Time
+}
+
+// Billing is an account's plan and the state of its subscription, along with
+// the plans it can choose from. Enabled is false when the server doesn't
+// bill, in which case every account has the pro plan.
+type Billing struct {
+	Enabled          bool       `json:"enabled"`
+	Plan             Plan       `json:"plan"`
+	Status           string     `json:"status,omitempty"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+	Plans            []Plan     `json:"plans"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// BlockedNumber is a phone number a user blocked, such as a spam caller's.
+// Label is the user's note on why, and may be empty.
+type BlockedNumber struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Phone     string    `json:"phone"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PhoneReputation tells whether a phone number is one to screen. Blocked is
+// set for the user's blocked numbers, and Spam for the numbers the spam
+// reputation provider reports; it is null when the provider wasn't asked,
+// as it is off, failed or the number is blocked or a known contact's.
+type PhoneReputation struct {
+	Blocked bool  `json:"blocked"`
+	Spam    *bool `json:"spam"`
+}
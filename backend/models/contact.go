@@ -0,0 +1,126 @@
+package models
+
+import "time"
+
+// Contact is a stored contact. Its JSON form is also the format contacts are
+// kept in by the object storage backup stores and exported archives; API
+// responses use ContactResponse instead.
+type Contact struct {
+	ID              int       `json:"id" firestore:"id"`
+	UserID          int       `json:"user_id" firestore:"-"`
+	Name            string    `json:"name" firestore:"name"`
+	Phone           string    `json:"phone" firestore:"phone"`
+	EncryptedPhone  string    `json:"encrypted_phone" firestore:"encrypted_phone"`
+	Tags            []string  `json:"tags" firestore:"tags"`
+	LastInteraction time.Time `json:"last_interaction" firestore:"last_interaction"`
+	Birthday        time.Time `json:"birthday" firestore:"birthday"`
+	Version         int       `json:"version" firestore:"version"`
+	UpdatedAt       time.Time `json:"updated_at" firestore:"updated_at"`
+	CreatedAt       time.Time `json:"created_at" firestore:"created_at"`
+	// PhoneVerification is the last verification of the phone number, nil
+	// if it wasn't verified since it was last changed
+	PhoneVerification *PhoneVerification `json:"phone_verification,omitempty" firestore:"phone_verification,omitempty"`
+}
+
+// PhoneVerification is what the phone verification provider reported about
+// a contact's phone number. LineType is mobile, landline, voip, toll_free or
+// another of the provider's types, and CountryCode is the ISO 3166 code;
+// both are empty for invalid numbers.
+type PhoneVerification struct {
+	Valid       bool      `json:"valid" firestore:"valid"`
+	LineType    string    `json:"line_type,omitempty" firestore:"line_type"`
+	Carrier     string    `json:"carrier,omitempty" firestore:"carrier"`
+	CountryCode string    `json:"country_code,omitempty" firestore:"country_code"`
+	VerifiedAt  time.Time `json:"verified_at" firestore:"verified_at"`
+}
+
+// PhoneLookup is a verification of a phone number, with the number in E.164
+// and national format for valid numbers. The formats aren't stored, as phone
+// numbers are only stored encrypted.
+type PhoneLookup struct {
+	PhoneVerification
+	E164           string `json:"e164,omitempty"`
+	NationalFormat string `json:"national_format,omitempty"`
+	// ValidationErrors are the provider's reasons an invalid number is
+	// invalid, such as TOO_SHORT
+	ValidationErrors []string `json:"validation_errors,omitempty"`
+}
+
+// ContactResponse is a contact as returned by the API. It is mapped from
+// Contact field by field, so columns added to Contact are only sent to
+// clients once they are added here.
+type ContactResponse struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Phone           string    `json:"phone"`
+	EncryptedPhone  string    `json:"encrypted_phone"`
+	Tags            []string  `json:"tags"`
+	LastInteraction time.Time `json:"last_interaction"`
+	Birthday        time.Time `json:"birthday"`
+	Version         int       `json:"version"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	// PhoneVerification is null until the phone number is verified
+	PhoneVerification *PhoneVerification `json:"phone_verification"`
+	// Links are only set when asked for, and for phone numbers in E.164
+	// format
+	Links *PhoneLinks `json:"links,omitempty"`
+}
+
+// PhoneLinks are links that call, text, or start a WhatsApp chat with a
+// phone number
+type PhoneLinks struct {
+	Tel      string `json:"tel"`
+	SMS      string `json:"sms"`
+	WhatsApp string `json:"whatsapp"`
+}
+
+// NewContactResponse returns the API representation of a contact
+func NewContactResponse(c Contact) ContactResponse {
+	return ContactResponse{
+		ID:              c.ID,
+		Name:            c.Name,
+		Phone:           c.Phone,
+		EncryptedPhone:  c.EncryptedPhone,
+		Tags:            c.Tags,
+		LastInteraction: c.LastInteraction,
+		Birthday:        c.Birthday,
+		Version:         c.Version,
+		UpdatedAt:       c.UpdatedAt,
+
+		PhoneVerification: c.PhoneVerification,
+	}
+}
+
+// NewContactResponses returns the API representation of each contact
+func NewContactResponses(contacts []Contact) []ContactResponse {
+	responses := make([]ContactResponse, len(contacts))
+	for i, c := range contacts {
+		responses[i] = NewContactResponse(c)
+	}
+	return responses
+}
+
+// DuplicateContacts is a group of contacts sharing a phone number
+type DuplicateContacts struct {
+	// Phone is the shared number without formatting
+	Phone    string            `json:"phone"`
+	Contacts []ContactResponse `json:"contacts"`
+}
+
+// ContactUpdate is the body of requests that change one aspect of a contact
+type ContactUpdate struct {
+	Tags            []string  `json:"tags" binding:"tagsize,dive,required,max=50,excludes=0x2C"`
+	LastInteraction time.Time `json:"last_interaction"`
+	Birthday        string    `json:"birthday" binding:"birthday"`
+	Version         int       `json:"version" binding:"min=0"`
+}
+
+// PhoneEnrichmentResult is the result of a phone enrichment job: the
+// contacts annotated with their number's line type, carrier and country,
+// those whose number the provider reports invalid, and those skipped as
+// they changed while the job ran
+type PhoneEnrichmentResult struct {
+	Enriched int `json:"enriched"`
+	Invalid  int `json:"invalid"`
+	Skipped  int `json:"skipped"`
+}
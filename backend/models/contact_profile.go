@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// ContactProfile holds the details of a contact beyond its phone number:
+// its email address, and the photo and company found from it.
+// PhotoSource and CompanySource are "user" for details the user entered, or
+// the enrichment provider that suggested them, such as "gravatar", and are
+// empty without a photo or company. EnrichedAt is when the provider was
+// last asked about the email, and nil until it was.
+type ContactProfile struct {
+	ContactID     int        `json:"contact_id"`
+	UserID        int        `json:"-"`
+	Email         string     `json:"email"`
+	PhotoURL      string     `json:"photo_url"`
+	PhotoSource   string     `json:"photo_source"`
+	Company       string     `json:"company"`
+	CompanySource string     `json:"company_source"`
+	EnrichedAt    *time.Time `json:"enriched_at"`
+	// RejectedPhotoURL and RejectedCompany are the suggestions the user last
+	// rejected, which aren't suggested again
+	RejectedPhotoURL string `json:"-"`
+	RejectedCompany  string `json:"-"`
+}
+
+// ContactProfileUpdate is the body of requests that set a contact's profile.
+// A photo or company set here replaces any suggestion.
+type ContactProfileUpdate struct {
+	Email    string `json:"email" binding:"omitempty,email,max=254"`
+	PhotoURL string `json:"photo_url" binding:"omitempty,url,max=500"`
+	Company  string `json:"company" binding:"max=200"`
+}
+
+// EnrichmentRejection is the body of requests that reject a suggested photo
+// or company
+type EnrichmentRejection struct {
+	Field string `json:"field" binding:"required,oneof=photo_url company"`
+}
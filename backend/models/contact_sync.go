@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// ContactSync is a user's connection to a contact provider, such as their
+// Google account, that their contacts are kept in sync with. Status is "ok",
+// "failed" when the last sync failed with Error, or "reconnect_required"
+// once the provider stopped accepting the connection's token.
+type ContactSync struct {
+	UserID       int        `json:"-"`
+	Provider     string     `json:"provider"`
+	Account      string     `json:"account"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	LastSyncedAt *time.Time `json:"last_synced_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Token is the OAuth token the provider's API is called with
+	Token OAuthToken `json:"-"`
+	// SyncToken is the provider's cursor of the changes already pulled, and
+	// is empty until the first sync completes
+	SyncToken string `json:"-"`
+}
+
+// OAuthToken is the token a user granted access to their account at a
+// provider with
+type OAuthToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// ContactSyncLink pairs a contact with its copy at a provider, with the
+// version of each as of the last sync. ContactID is 0 once the contact was
+// deleted locally.
+type ContactSyncLink struct {
+	ID             int    `json:"id"`
+	UserID         int    `json:"user_id"`
+	Provider       string `json:"provider"`
+	ContactID      int    `json:"contact_id"`
+	RemoteID       string `json:"remote_id"`
+	ETag           string `json:"etag"`
+	ContactVersion int    `json:"contact_version"`
+}
+
+// ContactSyncResult counts what a sync changed on each side. Conflicts are
+// contacts changed on both sides, where the newer change was kept, and
+// Skipped are the provider's contacts that couldn't be imported, such as
+// those without a phone number or beyond the plan's limit.
+type ContactSyncResult struct {
+	Imported      int `json:"imported"`
+	Updated       int `json:"updated"`
+	Deleted       int `json:"deleted"`
+	Exported      int `json:"exported"`
+	RemoteUpdated int `json:"remote_updated"`
+	RemoteDeleted int `json:"remote_deleted"`
+	Conflicts     int `json:"conflicts"`
+	Skipped       int `json:"skipped"`
+}
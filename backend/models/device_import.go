@@ -0,0 +1,53 @@
+package models
+
+// DeviceImport is an Android phone's address book as ContactsContract
+// stores it: the raw contacts of every account on the phone with their data
+// rows, and the groups the rows refer to
+type DeviceImport struct {
+	RawContacts []RawContact  `json:"raw_contacts" binding:"required,dive"`
+	Groups      []DeviceGroup `json:"groups" binding:"dive"`
+}
+
+// RawContact is a row of ContactsContract.RawContacts: one account's copy
+// of a person. Raw contacts with the same ContactID were aggregated into one
+// person by Android.
+type RawContact struct {
+	ID          int64  `json:"_id"`
+	ContactID   int64  `json:"contact_id"`
+	AccountType string `json:"account_type"`
+	AccountName string `json:"account_name"`
+	Deleted     int    `json:"deleted"`
+	// Data are the raw contact's rows of ContactsContract.Data
+	Data []DataRow `json:"data" binding:"dive"`
+}
+
+// DataRow is a row of ContactsContract.Data, whose columns hold what its
+// mimetype says. The data columns are sent as Cursor.getString returns them.
+type DataRow struct {
+	Mimetype       string `json:"mimetype" binding:"required"`
+	Data1          string `json:"data1"`
+	Data2          string `json:"data2"`
+	Data3          string `json:"data3"`
+	Data4          string `json:"data4"`
+	IsPrimary      int    `json:"is_primary"`
+	IsSuperPrimary int    `json:"is_super_primary"`
+}
+
+// DeviceGroup is a row of ContactsContract.Groups. SystemID is set for the
+// groups Android creates for every account, such as "My Contacts".
+type DeviceGroup struct {
+	ID       int64  `json:"_id"`
+	Title    string `json:"title"`
+	SystemID string `json:"system_id"`
+	Deleted  int    `json:"deleted"`
+}
+
+// DeviceImportResult summarizes a device import. Merged counts the people
+// folded into another person of the import because they share a number, and
+// Duplicates those matching an existing contact, which are left unchanged.
+type DeviceImportResult struct {
+	Created    int `json:"created"`
+	Merged     int `json:"merged"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
+}
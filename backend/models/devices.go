@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Device is a client the user has logged in from, with its sync state
+type Device struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	LastSyncToken string     `json:"last_sync_token,omitempty"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpToDate      bool       `json:"up_to_date"`
+	Current       bool       `json:"current"`
+}
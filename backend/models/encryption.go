@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// DataKeyStatus describes a version of the data key and how many contacts'
+// phone numbers are encrypted with it
+type DataKeyStatus struct {
+	Version       int        `json:"version"`
+	KMSKeyVersion string     `json:"kms_key_version,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	ActiveAt      *time.Time `json:"active_at,omitempty"`
+	Current       bool       `json:"current"`
+	Contacts      int        `json:"contacts"`
+}
+
+// EncryptionStatus reports the versions of the data key and how far
+// contacts have been re-encrypted to the current one
+type EncryptionStatus struct {
+	CurrentVersion int             `json:"current_version"`
+	Keys           []DataKeyStatus `json:"keys"`
+	// Unencrypted counts contacts stored before encryption was enabled
+	// whose phone numbers are not encrypted yet
+	Unencrypted int `json:"unencrypted"`
+}
+
+// ReencryptResult is the result of a re-encryption job
+type ReencryptResult struct {
+	KeyVersion  int `json:"key_version"`
+	Reencrypted int `json:"reencrypted"`
+}
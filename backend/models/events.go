@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ContactEvent describes a change to a user's contacts. DeviceID is the device
+// that made the change, if known.
+type ContactEvent struct {
+	Type      string           `json:"type"`
+	ContactID int              `json:"contact_id,omitempty"`
+	Contact   *ContactResponse `json:"contact,omitempty"`
+	DeviceID  string           `json:"device_id,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
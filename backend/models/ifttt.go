@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// IFTTTErrors is the body of a failed request from IFTTT, in the form its
+// service API expects instead of the usual response
+type IFTTTErrors struct {
+	Errors []IFTTTError `json:"errors"`
+}
+
+// IFTTTError is an error reported to IFTTT. Status is SKIP for an action
+// IFTTT should skip rather than retry.
+type IFTTTError struct {
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+// IFTTTMeta identifies an item of a trigger, which IFTTT runs an applet for
+// once per ID. Timestamp is in Unix seconds.
+type IFTTTMeta struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// IFTTTAuthorizationCode is a code IFTTT trades for tokens once it has
+// redirected a user back to RedirectURI. Only the hash of the code is kept.
+type IFTTTAuthorizationCode struct {
+	CodeHash    string
+	UserID      int
+	RedirectURI string
+	ExpiresAt   time.Time
+}
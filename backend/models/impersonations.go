@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Impersonation is an admin acting as a user to debug an issue of theirs,
+// until ExpiresAt or until it is ended. Requests counts the requests made
+// with its token.
+type Impersonation struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	AdminID   int        `json:"admin_id,omitempty"`
+	Reason    string     `json:"reason"`
+	Requests  int        `json:"requests"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// InteractionStats aggregates all of a user's interactions
+type InteractionStats struct {
+	Total             int            `json:"total"`
+	ByType            map[string]int `json:"by_type"`
+	PerWeek           float64        `json:"per_week"`
+	CallsPerWeek      float64        `json:"calls_per_week"`
+	LongestStreakDays int            `json:"longest_streak_days"`
+	CurrentStreakDays int            `json:"current_streak_days"`
+}
+
+// ContactFrequency describes how often the user interacts with a contact
+type ContactFrequency struct {
+	ContactID          int        `json:"contact_id"`
+	Name               string     `json:"name"`
+	Interactions       int        `json:"interactions"`
+	PerWeek            float64    `json:"per_week"`
+	CallsPerWeek       float64    `json:"calls_per_week"`
+	AverageGapDays     float64    `json:"average_gap_days,omitempty"`
+	LongestStreakWeeks int        `json:"longest_streak_weeks"`
+	LastInteraction    *time.Time `json:"last_interaction,omitempty"`
+	DaysSince          *int       `json:"days_since,omitempty"`
+}
+
+// NeglectedContact is a contact the user has not been in touch with for a
+// long time, or for much longer than usual
+type NeglectedContact struct {
+	ContactID int    `json:"contact_id"`
+	Name      string `json:"name"`
+	DaysSince *int   `json:"days_since,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// InteractionInsights is the interaction section of the insights response
+type InteractionInsights struct {
+	Stats     InteractionStats   `json:"stats"`
+	Contacts  []ContactFrequency `json:"contacts"`
+	Neglected []NeglectedContact `json:"neglected"`
+}
+
+// TagCount is the number of contacts with a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// ReconnectSuggestion is a contact recommended for the user to get in touch
+// with, and why
+type ReconnectSuggestion struct {
+	ContactID      int      `json:"contact_id"`
+	Name           string   `json:"name"`
+	Score          float64  `json:"score"`
+	Reasons        []string `json:"reasons"`
+	DaysSince      *int     `json:"days_since,omitempty"`
+	BirthdayInDays *int     `json:"birthday_in_days,omitempty"`
+}
+
+// TrendPoint counts the contacts created and interactions recorded in one
+// period, and the number of contacts at its end
+type TrendPoint struct {
+	PeriodStart     time.Time `json:"period_start"`
+	ContactsCreated int       `json:"contacts_created"`
+	Interactions    int       `json:"interactions"`
+	TotalContacts   int       `json:"total_contacts"`
+}
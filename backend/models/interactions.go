@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Interaction is a call, message, or meeting with a contact
+type Interaction struct {
+	ID        int       `json:"id"`
+	ContactID int       `json:"contact_id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Note      string    `json:"note,omitempty"`
+	// Direction and Duration, in seconds, are set for calls imported from
+	// the call log
+	Direction string    `json:"direction,omitempty"`
+	Duration  int       `json:"duration,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CallLogResult summarizes a batch of calls imported from a call log.
+// Duplicates were imported before, Unmatched calls have no contact with
+// their number, and Ignored calls weren't answered.
+type CallLogResult struct {
+	Recorded   int `json:"recorded"`
+	Duplicates int `json:"duplicates"`
+	Unmatched  int `json:"unmatched"`
+	Ignored    int `json:"ignored"`
+}
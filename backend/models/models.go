@@ -0,0 +1,64 @@
+// Package models defines the types exchanged by the API and stored by the
+// repository
+package models
+
+import "time"
+
+// User is a stored account. It is never sent to clients, and PasswordHash
+// is excluded from its JSON form so it cannot leak if it is; API responses
+// use UserResponse.
+type User struct {
+	ID           int    `json:"id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	// SuspendedAt is set while an admin has suspended the account
+	SuspendedAt *time.Time `json:"-"`
+	// PasswordResetRequired is set when an admin has made the user choose a
+	// new password, which they can't log in without
+	PasswordResetRequired bool `json:"-"`
+	// TokenGeneration is incremented whenever the account is signed out
+	// everywhere; access tokens issued in an earlier generation are refused
+	TokenGeneration int `json:"-"`
+}
+
+// UserResponse is an account as returned by the API
+type UserResponse struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+// CustomError represents an application error
+type CustomError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CustomError) Error() string {
+	return e.Message
+}
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Response represents a standard API response. List endpoints set Meta with
+// middleware.ListMeta; other responses get the request's meta block when
+// written.
+type Response struct {
+	Meta    *Meta       `json:"meta,omitempty"`
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+}
+
+// Meta describes a response. Every response carries the request ID and API
+// version; list responses add the total number of items and, for paginated
+// lists, the cursor of the next page.
+type Meta struct {
+	RequestID  string `json:"request_id"`
+	APIVersion string `json:"api_version"`
+	Total      *int   `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+// QuietHours is a daily window, in hours of the user's time zone, during
+// which no scheduled notifications are sent. The window may wrap past midnight.
+type QuietHours struct {
+	Enabled bool `json:"enabled"`
+	Start   int  `json:"start" binding:"min=0,max=23"`
+	End     int  `json:"end" binding:"min=0,max=23"`
+}
+
+// Contains reports whether the hour falls within the quiet hours
+func (q QuietHours) Contains(hour int) bool {
+	if !q.Enabled {
+		return false
+	}
+	if q.Start <= q.End {
+		return hour >= q.Start && hour < q.End
+	}
+	return hour >= q.Start || hour < q.End
+}
+
+// SlackSettings is where a user's Slack notifications are posted: through an
+// incoming webhook, which posts to the channel it was created for, or by a
+// bot to Channel. WebhookURL and BotToken are write-only and left out of
+// responses; Connected reports whether either is set.
+type SlackSettings struct {
+	WebhookURL string `json:"webhook_url,omitempty" binding:"omitempty,url,max=255"`
+	BotToken   string `json:"bot_token,omitempty" binding:"max=255"`
+	Channel    string `json:"channel" binding:"max=80"`
+	Connected  bool   `json:"connected"`
+}
+
+// NotificationSettings holds a user's notification preferences. ReminderHour
+// is the hour of the day, in the user's time zone, scheduled notifications
+// are sent.
+type NotificationSettings struct {
+	BirthdayEmail     bool          `json:"birthday_email"`
+	BirthdayPush      bool          `json:"birthday_push"`
+	BirthdaySMS       bool          `json:"birthday_sms"`
+	BirthdaySlack     bool          `json:"birthday_slack"`
+	SMSNumber         string        `json:"sms_number" binding:"omitempty,intlphone"`
+	ReminderEmail     bool          `json:"reminder_email"`
+	ReminderPush      bool          `json:"reminder_push"`
+	ReminderSMS       bool          `json:"reminder_sms"`
+	Digest            string        `json:"digest" binding:"oneof=off daily weekly"`
+	DigestEmail       bool          `json:"digest_email"`
+	DigestSlack       bool          `json:"digest_slack"`
+	Slack             SlackSettings `json:"slack"`
+	ReminderHour      int           `json:"reminder_hour" binding:"min=0,max=23"`
+	BirthdayDaysAhead int           `json:"birthday_days_ahead" binding:"min=1,max=30"`
+	QuietHours        QuietHours    `json:"quiet_hours"`
+	Timezone          string        `json:"timezone" binding:"required,timezone"`
+}
+
+// Redacted returns the settings without the Slack credentials, as they are
+// shown to the user
+func (s NotificationSettings) Redacted() NotificationSettings {
+	s.Slack.Connected = s.Slack.WebhookURL != "" || s.Slack.BotToken != ""
+	s.Slack.WebhookURL, s.Slack.BotToken = "", ""
+	return s
+}
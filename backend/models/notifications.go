@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Notification is a message to a user through one channel. To is the email
+// address or phone number; push notifications go to all of the user's
+// devices.
+type Notification struct {
+	UserID  int
+	Channel string
+	Kind    string
+	To      string
+	Subject string
+	Body    string
+	Data    map[string]string
+}
+
+// NotificationDelivery is the record of a notification sent to the user
+type NotificationDelivery struct {
+	ID        int        `json:"id"`
+	Channel   string     `json:"channel"`
+	Kind      string     `json:"kind"`
+	Recipient string     `json:"recipient,omitempty"`
+	Subject   string     `json:"subject"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
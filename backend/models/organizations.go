@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Organization is a group of users who share an address book, such as a
+// small business. Role is the requesting user's role in it.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	Members   int       `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+	// AccountID is the account that keeps the organization's contacts
+	AccountID int `json:"-"`
+}
+
+// OrganizationMember is a user in an organization and their role
+type OrganizationMember struct {
+	UserID   int       `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ContactPermission shares contacts of an organization with a member who
+// isn't an owner or admin: the contact ContactID, or those tagged Tag.
+// Access is "read", or "write" to also change and delete them.
+type ContactPermission struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ContactID int       `json:"contact_id,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	Access    string    `json:"access"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationInvite is an invitation emailed to join an organization with
+// a role, until it is accepted, declined or expires
+type OrganizationInvite struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	InvitedBy      int       `json:"invited_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// OrganizationExport is everything an organization keeps, in the
+// machine-readable form its owners download it in: the shared address book,
+// its members with the contacts each may work with, and their activity
+type OrganizationExport struct {
+	Version      int                        `json:"version"`
+	ExportedAt   time.Time                  `json:"exported_at"`
+	Organization Organization               `json:"organization"`
+	Members      []OrganizationMemberExport `json:"members"`
+	Contacts     []ContactResponse          `json:"contacts"`
+	Permissions  []ContactPermission        `json:"permissions"`
+	AuditLog     []AuditEvent               `json:"audit_log"`
+}
+
+// OrganizationMemberExport is a member in an organization's export, with the
+// contacts they may work with: all of them for owners and admins, and those
+// shared with them for other members
+type OrganizationMemberExport struct {
+	OrganizationMember
+	Contacts []MemberContactAccess `json:"contacts"`
+}
+
+// MemberContactAccess is the access a member has to a contact, "read" or
+// "write"
+type MemberContactAccess struct {
+	ContactID int    `json:"contact_id"`
+	Access    string `json:"access"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token a client trades for a new access token
+// and the next refresh token of its family. Only the token's hash is stored.
+type RefreshToken struct {
+	ID        int64
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	DeviceID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
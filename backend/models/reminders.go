@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ReminderRepeat makes a reminder recur, e.g. every 3 months
+type ReminderRepeat struct {
+	Every int    `json:"every" binding:"min=1,max=365"`
+	Unit  string `json:"unit" binding:"oneof=day week month year"`
+}
+
+// Next returns the occurrence after t
+func (r ReminderRepeat) Next(t time.Time) time.Time {
+	switch r.Unit {
+	case "day":
+		return t.AddDate(0, 0, r.Every)
+	case "week":
+		return t.AddDate(0, 0, 7*r.Every)
+	case "month":
+		return t.AddDate(0, r.Every, 0)
+	default:
+		return t.AddDate(r.Every, 0, 0)
+	}
+}
+
+// Reminder is a note to get in touch with a contact at a given time
+type Reminder struct {
+	ID          int             `json:"id"`
+	ContactID   int             `json:"contact_id"`
+	ContactName string          `json:"contact_name"`
+	Note        string          `json:"note"`
+	DueAt       time.Time       `json:"due_at"`
+	Repeat      *ReminderRepeat `json:"repeat,omitempty"`
+	Status      string          `json:"status"`
+	NotifiedAt  *time.Time      `json:"notified_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ShareLink grants temporary access to one of a user's contacts through an
+// unguessable token
+type ShareLink struct {
+	ID        int       `json:"id"`
+	Token     string    `json:"token"`
+	ContactID int       `json:"contact_id"`
+	UserID    int       `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
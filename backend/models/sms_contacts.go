@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// SMSContactSettings is how a user saves contacts by text message: they text
+// a name and number to Number from Phone, the number they linked. Phone is
+// empty until a number is linked.
+type SMSContactSettings struct {
+	Number   string     `json:"number"`
+	Phone    string     `json:"phone,omitempty"`
+	LinkedAt *time.Time `json:"linked_at,omitempty"`
+}
+
+// SMSLinkCode is a code linking the phone it is texted from to the user.
+// Message is the text to send to Number.
+type SMSLinkCode struct {
+	Code      string    `json:"code"`
+	Number    string    `json:"number"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SMSContactNumber is the phone a user linked to save contacts by text.
+// Phone is empty while a link code is pending.
+type SMSContactNumber struct {
+	UserID   int
+	Phone    string
+	LinkedAt *time.Time
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// SyncChange is a change made on a device, pushed with POST /api/sync.
+// Version is the contact version the change was based on, ModifiedAt is when
+// it was made on the device, and Fields optionally lists the fields that were
+// edited so that other fields never overwrite changes made elsewhere.
+type SyncChange struct {
+	ID              int       `json:"id"`
+	Version         int       `json:"version"`
+	ModifiedAt      time.Time `json:"modified_at"`
+	Deleted         bool      `json:"deleted"`
+	Fields          []string  `json:"fields"`
+	Name            string    `json:"name" binding:"max=255"`
+	Phone           string    `json:"phone" binding:"omitempty,max=255,phone"`
+	EncryptedPhone  string    `json:"encrypted_phone" binding:"max=255"`
+	Tags            []string  `json:"tags" binding:"tagsize,dive,required,max=50,excludes=0x2C"`
+	LastInteraction time.Time `json:"last_interaction"`
+	Birthday        time.Time `json:"birthday" binding:"birthday"`
+}
+
+// FieldConflict describes a field edited both on the device and on the
+// server, and which value was kept
+type FieldConflict struct {
+	Field      string      `json:"field"`
+	Client     interface{} `json:"client"`
+	Server     interface{} `json:"server"`
+	Resolution string      `json:"resolution"`
+}
+
+// SyncResult is the outcome of one pushed change
+type SyncResult struct {
+	Index   int    `json:"index"`
+	ID      int    `json:"id,omitempty"`
+	Status  string `json:"status"`
+	Version int    `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Errors lists the invalid fields of a change rejected as invalid
+	Errors    []ValidationError `json:"errors,omitempty"`
+	Conflicts []FieldConflict   `json:"conflicts,omitempty"`
+	Contact   *ContactResponse  `json:"contact,omitempty"`
+}
+
+// Tombstone records a deleted contact so sync clients can remove it
+type Tombstone struct {
+	ID        int       `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// UsageDay is an account's usage on a UTC day, given as YYYY-MM-DD. The API
+// calls and backups are those made that day; the contacts, their storage
+// and the backup storage are what the account kept at the end of it, or
+// now for today.
+type UsageDay struct {
+	Day                string `json:"day"`
+	APICalls           int64  `json:"api_calls"`
+	Backups            int    `json:"backups"`
+	BackupBytes        int64  `json:"backup_bytes"`
+	Contacts           int    `json:"contacts"`
+	StorageBytes       int64  `json:"storage_bytes"`
+	BackupStorageBytes int64  `json:"backup_storage_bytes"`
+}
+
+// Usage is an account's usage over a range of days, oldest first, with the
+// totals of what was metered over them
+type Usage struct {
+	Days        []UsageDay `json:"days"`
+	APICalls    int64      `json:"api_calls"`
+	Backups     int        `json:"backups"`
+	BackupBytes int64      `json:"backup_bytes"`
+}
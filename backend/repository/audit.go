@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// AuditRepository stores the audit log. Events are never changed once
+// recorded; they are only deleted once past the retention window, or with
+// the account they belong to when it is erased.
+type AuditRepository interface {
+	// Record appends an event, setting its ID and, if it is zero, its time.
+	// An event without a user, such as a failed login to an unknown email,
+	// is kept but listed for no one.
+	Record(ctx context.Context, event *models.AuditEvent) error
+	// List returns a user's events matching query, newest first
+	List(ctx context.Context, userID int, query AuditQuery) ([]models.AuditEvent, error)
+	// Count returns the number of a user's events with action, or all of
+	// them if action is empty
+	Count(ctx context.Context, userID int, action string) (int, error)
+	// DeleteBefore deletes events recorded before cutoff and returns how
+	// many were deleted
+	DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// AuditQuery selects a page of the events returned by List
+type AuditQuery struct {
+	// Action only returns events with this action if it is not empty
+	Action string
+	// Before only returns events older than the one with this ID if it is
+	// non-zero, to page through the log
+	Before int64
+	// Limit is the maximum number of events returned
+	Limit int
+}
+
+// sqlAudit is the AuditRepository backed by the audit_events table
+type sqlAudit struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func (r *sqlAudit) Record(ctx context.Context, event *models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %v", err)
+		}
+		details = sql.NullString{String: string(data), Valid: true}
+	}
+	userID := sql.NullInt64{Int64: int64(event.UserID), Valid: event.UserID != 0}
+
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO audit_events (user_id, action, ip, user_agent, device_id, details, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, event.Action, event.IP, truncate(event.UserAgent, 255), event.DeviceID, details, event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	return nil
+}
+
+func (r *sqlAudit) List(ctx context.Context, userID int, query AuditQuery) ([]models.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	sqlQuery := "SELECT id, user_id, action, ip, user_agent, device_id, details, created_at FROM audit_events WHERE user_id = ?"
+	args := []interface{}{userID}
+	if query.Action != "" {
+		sqlQuery += " AND action = ?"
+		args = append(args, query.Action)
+	}
+	if query.Before != 0 {
+		sqlQuery += " AND id < ?"
+		args = append(args, query.Before)
+	}
+	rows, err := r.db.QueryContext(ctx, sqlQuery+" ORDER BY id DESC LIMIT ?", append(args, query.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var details sql.NullString
+		if err := rows.Scan(
+			&event.ID, &event.UserID, &event.Action, &event.IP, &event.UserAgent, &event.DeviceID, &details, &event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode details of audit event %d: %v", event.ID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *sqlAudit) Count(ctx context.Context, userID int, action string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM audit_events WHERE user_id = ? AND (? = '' OR action = ?)", userID, action, action,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *sqlAudit) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM audit_events WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// truncate shortens s to at most n bytes, for columns holding client-supplied
+// values such as a User-Agent
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
@@ -0,0 +1,434 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+)
+
+const (
+	// FirestoreBatchLimit is the maximum number of writes in one Firestore batch
+	FirestoreBatchLimit = 500
+	// firestoreCommitAttempts is how often a failed batch commit is attempted
+	firestoreCommitAttempts = 3
+)
+
+// PartialWriteError reports a backup write that failed after some of its
+// changes had already been committed to the store
+type PartialWriteError struct {
+	Committed int
+	Err       error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("backup write failed after %d committed changes: %v", e.Committed, e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// BackupStore persists the backed-up copy of each user's contacts.
+// Records are keyed by contact ID so backups can be applied incrementally.
+type BackupStore interface {
+	// ListContactIDs returns the IDs of all contacts held in the user's backup
+	ListContactIDs(ctx context.Context, userID int) ([]string, error)
+	// SaveContacts writes the given records and removes the given IDs. If it
+	// fails part way through it returns a *PartialWriteError.
+	SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error
+	// LoadContacts returns every record held in the user's backup
+	LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error)
+	// Ping reports whether the store is reachable and accepts the
+	// server's credentials
+	Ping(ctx context.Context) error
+	// Close releases the store's connections
+	Close() error
+}
+
+// BackupRecord is the stored form of a backed-up contact. Records sealed
+// with a user's backup key carry only the contact ID and update time in the
+// clear; the contact itself is encrypted into Sealed.
+type BackupRecord struct {
+	models.Contact
+	Sealed          []byte    `json:"sealed,omitempty" firestore:"sealed,omitempty"`
+	BackupTimestamp time.Time `json:"backup_timestamp" firestore:"backup_timestamp"`
+}
+
+// NewBackupStore creates the backup store selected by config.BackupStore.
+// The Firestore store keeps backups with the Firestore client fs and closes
+// it when the store is closed; fs is not used by the other stores.
+func NewBackupStore(ctx context.Context, cfg *config.Config, fs *firestore.Client) (BackupStore, error) {
+	switch cfg.BackupStore {
+	case "", config.BackupStoreFirestore:
+		if fs == nil {
+			return nil, errors.New("firestore backup store requires an initialized firestore client")
+		}
+		return &firestoreBackupStore{client: fs}, nil
+	case config.BackupStoreGCS:
+		if cfg.BackupBucket == "" {
+			return nil, errors.New("BACKUP_BUCKET must be set for the gcs backup store")
+		}
+		client, err := storage.NewClient(ctx, option.WithCredentialsFile(cfg.FirebaseConfig))
+		if err != nil {
+			return nil, fmt.Errorf("error initializing gcs client: %v", err)
+		}
+		return &gcsBackupStore{client: client, bucket: cfg.BackupBucket, prefix: cfg.BackupPrefix}, nil
+	case config.BackupStoreS3:
+		if cfg.BackupBucket == "" {
+			return nil, errors.New("BACKUP_BUCKET must be set for the s3 backup store")
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.S3Region))
+		if err != nil {
+			return nil, fmt.Errorf("error loading aws config: %v", err)
+		}
+		client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			if cfg.S3Endpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.S3Endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		return &s3BackupStore{client: client, bucket: cfg.BackupBucket, prefix: cfg.BackupPrefix}, nil
+	case config.BackupStoreLocal:
+		return NewLocalBackupStore(cfg.BackupDir)
+	case config.BackupStoreMemory:
+		return NewMemoryBackupStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown backup store %q", cfg.BackupStore)
+	}
+}
+
+// objectKey returns the object name for a contact in an object storage bucket
+func objectKey(prefix string, userID int, contactID string) string {
+	return path.Join(prefix, "users", strconv.Itoa(userID), "contacts", contactID+".json")
+}
+
+// objectPrefix returns the object name prefix holding a user's contacts
+func objectPrefix(prefix string, userID int) string {
+	return path.Join(prefix, "users", strconv.Itoa(userID), "contacts") + "/"
+}
+
+// contactIDFromKey extracts the contact ID from an object name
+func contactIDFromKey(key string) string {
+	return strings.TrimSuffix(path.Base(key), ".json")
+}
+
+// firestoreBackupStore stores backups as documents under users/{id}/contacts
+type firestoreBackupStore struct {
+	client *firestore.Client
+}
+
+func (s *firestoreBackupStore) contacts(userID int) *firestore.CollectionRef {
+	return s.client.Collection("users").Doc(strconv.Itoa(userID)).Collection("contacts")
+}
+
+func (s *firestoreBackupStore) ListContactIDs(ctx context.Context, userID int) ([]string, error) {
+	refs, err := s.contacts(userID).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ids = append(ids, ref.ID)
+	}
+	return ids, nil
+}
+
+// SaveContacts commits the changes in chunks that fit within Firestore's
+// batch write limit, retrying transient failures for each chunk
+func (s *firestoreBackupStore) SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error {
+	contactsRef := s.contacts(userID)
+
+	committed := 0
+	batch, pending := s.client.Batch(), 0
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := commitWithRetry(ctx, batch); err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed += pending
+		batch, pending = s.client.Batch(), 0
+		return nil
+	}
+
+	for _, record := range upserts {
+		batch.Set(contactsRef.Doc(strconv.Itoa(record.ID)), record)
+		if pending++; pending == FirestoreBatchLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range deletes {
+		batch.Delete(contactsRef.Doc(id))
+		if pending++; pending == FirestoreBatchLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// commitWithRetry commits a batch, retrying errors Firestore reports as
+// transient with exponential backoff
+func commitWithRetry(ctx context.Context, batch *firestore.WriteBatch) error {
+	backoff := 200 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= firestoreCommitAttempts; attempt++ {
+		if _, err = batch.Commit(ctx); err == nil || !isTransientFirestoreError(err) {
+			return err
+		}
+		if attempt == firestoreCommitAttempts {
+			break
+		}
+		logging.Warnf("Retrying firestore batch commit after attempt %d: %v", attempt, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// isTransientFirestoreError reports whether a failed commit may succeed if retried
+func isTransientFirestoreError(err error) bool {
+	switch status.Code(err) {
+	case codes.Aborted, codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
+
+func (s *firestoreBackupStore) LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error) {
+	docs, err := s.contacts(userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]BackupRecord, 0, len(docs))
+	for _, doc := range docs {
+		var record BackupRecord
+		if err := doc.DataTo(&record); err != nil {
+			return nil, fmt.Errorf("failed to convert contact %s: %v", doc.Ref.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Ping reads a document that doesn't exist; a not found reply shows
+// Firestore is reachable and the credentials are accepted
+func (s *firestoreBackupStore) Ping(ctx context.Context) error {
+	_, err := s.client.Collection("health").Doc("ping").Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *firestoreBackupStore) Close() error {
+	return s.client.Close()
+}
+
+// gcsBackupStore stores backups as one JSON object per contact in a GCS bucket
+type gcsBackupStore struct {
+	client *storage.Client
+	bucket string
+	prefix string
+}
+
+func (s *gcsBackupStore) ListContactIDs(ctx context.Context, userID int) ([]string, error) {
+	var ids []string
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: objectPrefix(s.prefix, userID)})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, contactIDFromKey(attrs.Name))
+	}
+}
+
+func (s *gcsBackupStore) SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error {
+	bucket := s.client.Bucket(s.bucket)
+	committed := 0
+	for _, record := range upserts {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		w := bucket.Object(objectKey(s.prefix, userID, strconv.Itoa(record.ID))).NewWriter(ctx)
+		w.ContentType = "application/json"
+		if _, err := w.Write(body); err != nil {
+			w.Close()
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		if err := w.Close(); err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	for _, id := range deletes {
+		err := bucket.Object(objectKey(s.prefix, userID, id)).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	return nil
+}
+
+func (s *gcsBackupStore) LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error) {
+	ids, err := s.ListContactIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	bucket := s.client.Bucket(s.bucket)
+	records := make([]BackupRecord, 0, len(ids))
+	for _, id := range ids {
+		r, err := bucket.Object(objectKey(s.prefix, userID, id)).NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var record BackupRecord
+		err = json.NewDecoder(r).Decode(&record)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode contact %s: %v", id, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Ping reads the bucket's attributes
+func (s *gcsBackupStore) Ping(ctx context.Context) error {
+	_, err := s.client.Bucket(s.bucket).Attrs(ctx)
+	return err
+}
+
+func (s *gcsBackupStore) Close() error {
+	return s.client.Close()
+}
+
+// s3BackupStore stores backups as one JSON object per contact in an S3 bucket
+type s3BackupStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3BackupStore) ListContactIDs(ctx context.Context, userID int) ([]string, error) {
+	var ids []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(objectPrefix(s.prefix, userID)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			ids = append(ids, contactIDFromKey(aws.ToString(obj.Key)))
+		}
+	}
+	return ids, nil
+}
+
+func (s *s3BackupStore) SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error {
+	committed := 0
+	for _, record := range upserts {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucket),
+			Key:         aws.String(objectKey(s.prefix, userID, strconv.Itoa(record.ID))),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	for _, id := range deletes {
+		_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(objectKey(s.prefix, userID, id)),
+		})
+		if err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	return nil
+}
+
+func (s *s3BackupStore) LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error) {
+	ids, err := s.ListContactIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]BackupRecord, 0, len(ids))
+	for _, id := range ids {
+		out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(objectKey(s.prefix, userID, id)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(out.Body)
+		out.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var record BackupRecord
+		if err := json.Unmarshal(body, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode contact %s: %v", id, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Ping checks the bucket exists and can be reached
+func (s *s3BackupStore) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+	return err
+}
+
+// Close does nothing; the S3 client holds no connections that need closing
+func (s *s3BackupStore) Close() error {
+	return nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/encryption"
+	"phonesaver-backend/models"
+)
+
+// BlockedNumberRepository stores the phone numbers users blocked
+type BlockedNumberRepository interface {
+	// Block adds a phone number to a user's blocked numbers, setting its ID
+	// and creation time. ErrDuplicate is returned if the number is already
+	// blocked, however it is formatted.
+	Block(ctx context.Context, number *models.BlockedNumber) error
+	// List returns a user's blocked numbers, newest first
+	List(ctx context.Context, userID int) ([]models.BlockedNumber, error)
+	// Find returns a user's blocked number matching phone, ignoring
+	// formatting
+	Find(ctx context.Context, userID int, phone string) (models.BlockedNumber, error)
+	// Unblock removes one of a user's blocked numbers and reports whether
+	// it existed
+	Unblock(ctx context.Context, userID, id int) (bool, error)
+}
+
+// blockedNumberPhone names blocked phone numbers, which are always encrypted
+const blockedNumberPhone = "blocked_numbers.phone"
+
+// blockedNumberColumns are the columns read by scanBlockedNumber
+const blockedNumberColumns = "id, user_id, phone, phone_key_version, label, created_at"
+
+// scanBlockedNumber reads a row selected with blockedNumberColumns,
+// decrypting its phone number with ring
+func scanBlockedNumber(row RowScanner, ring *encryption.Keyring) (models.BlockedNumber, error) {
+	var number models.BlockedNumber
+	var phone string
+	var version sql.NullInt64
+	if err := row.Scan(&number.ID, &number.UserID, &phone, &version, &number.Label, &number.CreatedAt); err != nil {
+		return number, err
+	}
+	opened, err := openField(ring, blockedNumberPhone, number.UserID, phone, version)
+	if err != nil {
+		return number, fmt.Errorf("failed to decrypt %s: %v", blockedNumberPhone, err)
+	}
+	number.Phone = opened
+	return number, nil
+}
+
+// sqlBlockedNumbers is the BlockedNumberRepository backed by the
+// blocked_numbers table
+type sqlBlockedNumbers struct {
+	db      *sql.DB
+	dialect *dialect
+	keys    *dataKeys
+	timeout time.Duration
+}
+
+func (r *sqlBlockedNumbers) Block(ctx context.Context, number *models.BlockedNumber) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	// The unique index only covers numbers blocked under the current data
+	// key, so those blocked under an older one are looked for first
+	if _, err := r.find(ctx, ring, number.UserID, number.Phone); err == nil {
+		return ErrDuplicate
+	} else if err != ErrNotFound {
+		return err
+	}
+
+	phone, version, err := sealField(ring, blockedNumberPhone, number.UserID, number.Phone, true)
+	if err != nil {
+		return err
+	}
+	_, c := ring.Current()
+	if number.CreatedAt.IsZero() {
+		number.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO blocked_numbers (user_id, phone, phone_hmac, phone_key_version, label, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		number.UserID, phone, c.Index(NormalizePhone(number.Phone)), version, number.Label, number.CreatedAt,
+	)
+	if err != nil && r.dialect.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	number.ID = int(id)
+	return nil
+}
+
+func (r *sqlBlockedNumbers) List(ctx context.Context, userID int) ([]models.BlockedNumber, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+blockedNumberColumns+" FROM blocked_numbers WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	numbers := []models.BlockedNumber{}
+	for rows.Next() {
+		number, err := scanBlockedNumber(rows, ring)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, rows.Err()
+}
+
+func (r *sqlBlockedNumbers) Find(ctx context.Context, userID int, phone string) (models.BlockedNumber, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return models.BlockedNumber{}, err
+	}
+	return r.find(ctx, ring, userID, phone)
+}
+
+// find matches phone by its blind index under each version of the data key
+func (r *sqlBlockedNumbers) find(ctx context.Context, ring *encryption.Keyring, userID int, phone string) (models.BlockedNumber, error) {
+	if NormalizePhone(phone) == "" {
+		return models.BlockedNumber{}, ErrNotFound
+	}
+	indexes := phoneIndexes(ring, phone)
+	args := []interface{}{userID}
+	for _, index := range indexes {
+		args = append(args, index)
+	}
+	number, err := scanBlockedNumber(r.db.QueryRowContext(ctx,
+		"SELECT "+blockedNumberColumns+" FROM blocked_numbers WHERE user_id = ? AND phone_hmac IN ("+placeholders(len(indexes))+") ORDER BY id LIMIT 1",
+		args...,
+	), ring)
+	if err == sql.ErrNoRows {
+		return number, ErrNotFound
+	}
+	return number, err
+}
+
+func (r *sqlBlockedNumbers) Unblock(ctx context.Context, userID, id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM blocked_numbers WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// ContactPermissionRepository stores the contacts of organizations shared
+// with their members who aren't owners or admins
+type ContactPermissionRepository interface {
+	// Grant shares the contact or tag of permission with a member,
+	// replacing the access they were given to the same one
+	Grant(ctx context.Context, orgID int, permission *models.ContactPermission) error
+	// List returns the page of the permissions given in an organization, or
+	// to one of its members if userID isn't 0, oldest first, sorted by ID
+	List(ctx context.Context, orgID, userID int, page Page) ([]models.ContactPermission, error)
+	// Count returns the number of permissions List would return without a
+	// page
+	Count(ctx context.Context, orgID, userID int) (int, error)
+	// Get returns a permission given in an organization. ErrNotFound is
+	// returned if there is no such permission.
+	Get(ctx context.Context, orgID, id int) (models.ContactPermission, error)
+	// Revoke removes a permission and reports whether there was one
+	Revoke(ctx context.Context, orgID, id int) (bool, error)
+}
+
+// Access a permission gives to the contacts it shares
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// contactPermissionColumns are the columns read by scanContactPermission
+const contactPermissionColumns = "id, user_id, contact_id, tag, access, created_at"
+
+// scanContactPermission reads a permission row selected with
+// contactPermissionColumns
+func scanContactPermission(row RowScanner) (models.ContactPermission, error) {
+	var permission models.ContactPermission
+	var contactID sql.NullInt64
+	var tag sql.NullString
+	if err := row.Scan(&permission.ID, &permission.UserID, &contactID, &tag, &permission.Access, &permission.CreatedAt); err != nil {
+		return permission, err
+	}
+	permission.ContactID = int(contactID.Int64)
+	permission.Tag = tag.String
+	return permission, nil
+}
+
+// sqlContactPermissions is the ContactPermissionRepository backed by the
+// contact_permissions table
+type sqlContactPermissions struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func (r *sqlContactPermissions) Grant(ctx context.Context, orgID int, permission *models.ContactPermission) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	contactID := sql.NullInt64{Int64: int64(permission.ContactID), Valid: permission.ContactID != 0}
+	tag := sql.NullString{String: permission.Tag, Valid: permission.Tag != ""}
+	target := "contact_id = ?"
+	args := []interface{}{orgID, permission.UserID, contactID}
+	if !contactID.Valid {
+		target, args[2] = "tag = ?", tag
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM contact_permissions WHERE organization_id = ? AND user_id = ? AND "+target, args...)
+	if err != nil {
+		return fmt.Errorf("failed to replace permission: %v", err)
+	}
+
+	permission.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO contact_permissions (organization_id, user_id, contact_id, tag, access, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		orgID, permission.UserID, contactID, tag, permission.Access, permission.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to grant permission: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	permission.ID = int(id)
+	return tx.Commit()
+}
+
+func (r *sqlContactPermissions) List(ctx context.Context, orgID, userID int, page Page) ([]models.ContactPermission, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	conditions, args := permissionConditions(orgID, userID)
+	after, afterArgs := page.Condition(false, "id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+contactPermissionColumns+" FROM contact_permissions WHERE "+strings.Join(append(conditions, after), " AND ")+" ORDER BY id"+limit,
+		append(append(args, afterArgs...), limitArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.ContactPermission{}
+	for rows.Next() {
+		permission, err := scanContactPermission(rows)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (r *sqlContactPermissions) Count(ctx context.Context, orgID, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	conditions, args := permissionConditions(orgID, userID)
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM contact_permissions WHERE "+strings.Join(conditions, " AND "), args...,
+	).Scan(&count)
+	return count, err
+}
+
+// permissionConditions returns the conditions selecting the permissions
+// given in an organization, or to one of its members if userID isn't 0
+func permissionConditions(orgID, userID int) ([]string, []interface{}) {
+	conditions := []string{"organization_id = ?"}
+	args := []interface{}{orgID}
+	if userID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, userID)
+	}
+	return conditions, args
+}
+
+func (r *sqlContactPermissions) Get(ctx context.Context, orgID, id int) (models.ContactPermission, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	permission, err := scanContactPermission(r.db.QueryRowContext(ctx,
+		"SELECT "+contactPermissionColumns+" FROM contact_permissions WHERE organization_id = ? AND id = ?", orgID, id,
+	))
+	if err == sql.ErrNoRows {
+		return permission, ErrNotFound
+	}
+	return permission, err
+}
+
+func (r *sqlContactPermissions) Revoke(ctx context.Context, orgID, id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM contact_permissions WHERE organization_id = ? AND id = ?", orgID, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/encryption"
+	"phonesaver-backend/models"
+)
+
+// ContactProfileRepository stores the email addresses of contacts and the
+// details found from them
+type ContactProfileRepository interface {
+	// Get returns a contact's profile. ErrNotFound is returned if none was
+	// saved.
+	Get(ctx context.Context, userID, contactID int) (models.ContactProfile, error)
+	// Save creates or replaces a contact's profile
+	Save(ctx context.Context, profile models.ContactProfile) error
+	// ListDue returns up to limit profiles with an email address, of users
+	// opted in to contact enrichment, that were never enriched or were last
+	// enriched before the given time, least recently enriched first
+	ListDue(ctx context.Context, before time.Time, limit int) ([]models.ContactProfile, error)
+}
+
+// contactProfileEmail names contacts' email addresses, which are always
+// encrypted
+const contactProfileEmail = "contact_profiles.email"
+
+// contactProfileColumns are the columns read by scanContactProfile
+const contactProfileColumns = "contact_id, user_id, email, email_key_version, photo_url, photo_source, rejected_photo_url, " +
+	"company, company_source, rejected_company, enriched_at"
+
+// scanContactProfile reads a row selected with contactProfileColumns,
+// decrypting its email address with ring
+func scanContactProfile(row RowScanner, ring *encryption.Keyring) (models.ContactProfile, error) {
+	var profile models.ContactProfile
+	var email string
+	var version sql.NullInt64
+	var enrichedAt sql.NullTime
+	err := row.Scan(&profile.ContactID, &profile.UserID, &email, &version,
+		&profile.PhotoURL, &profile.PhotoSource, &profile.RejectedPhotoURL,
+		&profile.Company, &profile.CompanySource, &profile.RejectedCompany, &enrichedAt)
+	if err != nil {
+		return profile, err
+	}
+	if profile.Email, err = openField(ring, contactProfileEmail, profile.UserID, email, version); err != nil {
+		return profile, fmt.Errorf("failed to decrypt %s: %v", contactProfileEmail, err)
+	}
+	if enrichedAt.Valid {
+		profile.EnrichedAt = &enrichedAt.Time
+	}
+	return profile, nil
+}
+
+// sqlContactProfiles is the ContactProfileRepository backed by the
+// contact_profiles table
+type sqlContactProfiles struct {
+	db      *sql.DB
+	dialect *dialect
+	keys    *dataKeys
+	timeout time.Duration
+}
+
+func (r *sqlContactProfiles) Get(ctx context.Context, userID, contactID int) (models.ContactProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return models.ContactProfile{}, err
+	}
+	profile, err := scanContactProfile(r.db.QueryRowContext(ctx,
+		"SELECT "+contactProfileColumns+" FROM contact_profiles WHERE contact_id = ? AND user_id = ?", contactID, userID,
+	), ring)
+	if err == sql.ErrNoRows {
+		return profile, ErrNotFound
+	}
+	return profile, err
+}
+
+func (r *sqlContactProfiles) Save(ctx context.Context, profile models.ContactProfile) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	email, version, err := sealField(ring, contactProfileEmail, profile.UserID, profile.Email, true)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO contact_profiles (contact_id, user_id, email, email_key_version, photo_url, photo_source, rejected_photo_url,
+		company, company_source, rejected_company, enriched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) `+
+			r.dialect.upsert([]string{"contact_id"}, []string{
+				"email", "email_key_version", "photo_url", "photo_source", "rejected_photo_url",
+				"company", "company_source", "rejected_company", "enriched_at",
+			}),
+		profile.ContactID, profile.UserID, email, version, profile.PhotoURL, profile.PhotoSource, profile.RejectedPhotoURL,
+		profile.Company, profile.CompanySource, profile.RejectedCompany, profile.EnrichedAt,
+	)
+	return err
+}
+
+func (r *sqlContactProfiles) ListDue(ctx context.Context, before time.Time, limit int) ([]models.ContactProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT p.contact_id, p.user_id, p.email, p.email_key_version, p.photo_url, p.photo_source, p.rejected_photo_url,
+		p.company, p.company_source, p.rejected_company, p.enriched_at FROM contact_profiles p
+		JOIN users u ON u.id = p.user_id
+		WHERE u.contact_enrichment = TRUE AND p.email <> '' AND (p.enriched_at IS NULL OR p.enriched_at < ?)
+		ORDER BY p.enriched_at, p.contact_id LIMIT ?`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.ContactProfile
+	for rows.Next() {
+		profile, err := scanContactProfile(rows, ring)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
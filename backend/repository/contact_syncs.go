@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/encryption"
+	"phonesaver-backend/models"
+)
+
+// ContactSyncRepository stores users' connections to contact providers and
+// the links between their contacts and the providers' copies
+type ContactSyncRepository interface {
+	// Connect stores a user's connection to a provider, replacing the one
+	// they had. Reconnecting a different account drops the links and sync
+	// token of the previous one.
+	Connect(ctx context.Context, sync models.ContactSync) error
+	// Get returns a user's connection to a provider
+	Get(ctx context.Context, userID int, provider string) (models.ContactSync, error)
+	// List returns a user's connections, ordered by provider
+	List(ctx context.Context, userID int) ([]models.ContactSync, error)
+	// ListDue returns the connections last synced before syncedBefore, or
+	// never, that the providers still accept
+	ListDue(ctx context.Context, syncedBefore time.Time) ([]models.ContactSync, error)
+	// Claim marks a connection as syncing, reporting false if another sync
+	// of it is running. A claim lapses after contactSyncClaimTimeout, in
+	// case its server stopped.
+	Claim(ctx context.Context, userID int, provider string, now time.Time) (bool, error)
+	// Finish records the outcome of a sync, its token, sync token, status
+	// and error, and releases the claim
+	Finish(ctx context.Context, sync models.ContactSync) error
+	// Delete deletes a user's connection to a provider and its links, and
+	// reports whether it existed
+	Delete(ctx context.Context, userID int, provider string) (bool, error)
+	// Links returns the links of a user's connection to a provider
+	Links(ctx context.Context, userID int, provider string) ([]models.ContactSyncLink, error)
+	// SaveLink stores a link, setting its ID if it is new
+	SaveLink(ctx context.Context, link *models.ContactSyncLink) error
+	// DeleteLink deletes a link
+	DeleteLink(ctx context.Context, id int) error
+}
+
+// Statuses of contact syncs
+const (
+	SyncStatusOK        = "ok"
+	SyncStatusFailed    = "failed"
+	SyncStatusReconnect = "reconnect_required"
+)
+
+// contactSyncClaimTimeout is how long a sync may hold its connection
+const contactSyncClaimTimeout = time.Hour
+
+// contactSyncToken names connections' OAuth tokens, which are always
+// encrypted
+const contactSyncToken = "contact_syncs.token"
+
+// contactSyncColumns are the columns read by scanContactSync
+const contactSyncColumns = "user_id, provider, account, token, token_key_version, sync_token, status, error, last_synced_at, created_at"
+
+// scanContactSync reads a connection row selected with contactSyncColumns,
+// decrypting its token with ring
+func scanContactSync(row RowScanner, ring *encryption.Keyring) (models.ContactSync, error) {
+	var sync models.ContactSync
+	var token string
+	var version sql.NullInt64
+	var syncToken, syncErr sql.NullString
+	var lastSyncedAt sql.NullTime
+	if err := row.Scan(&sync.UserID, &sync.Provider, &sync.Account, &token, &version, &syncToken, &sync.Status,
+		&syncErr, &lastSyncedAt, &sync.CreatedAt); err != nil {
+		return sync, err
+	}
+	sync.SyncToken = syncToken.String
+	sync.Error = syncErr.String
+	if lastSyncedAt.Valid {
+		sync.LastSyncedAt = &lastSyncedAt.Time
+	}
+	opened, err := openField(ring, contactSyncToken, sync.UserID, token, version)
+	if err != nil {
+		return sync, fmt.Errorf("failed to decrypt %s: %v", contactSyncToken, err)
+	}
+	if err := json.Unmarshal([]byte(opened), &sync.Token); err != nil {
+		return sync, fmt.Errorf("failed to decode %s: %v", contactSyncToken, err)
+	}
+	return sync, nil
+}
+
+// sealContactSyncToken returns the stored form of a connection's token and
+// the data key version it was encrypted with
+func sealContactSyncToken(ring *encryption.Keyring, sync models.ContactSync) (string, interface{}, error) {
+	token, err := json.Marshal(sync.Token)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode %s: %v", contactSyncToken, err)
+	}
+	return sealField(ring, contactSyncToken, sync.UserID, string(token), true)
+}
+
+// sqlContactSyncs is the ContactSyncRepository backed by the contact_syncs
+// and contact_sync_links tables
+type sqlContactSyncs struct {
+	db      *sql.DB
+	dialect *dialect
+	keys    *dataKeys
+	timeout time.Duration
+}
+
+func (r *sqlContactSyncs) Connect(ctx context.Context, sync models.ContactSync) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	token, version, err := sealContactSyncToken(ring, sync)
+	if err != nil {
+		return err
+	}
+	if sync.CreatedAt.IsZero() {
+		sync.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var account string
+	err = tx.QueryRowContext(ctx,
+		"SELECT account FROM contact_syncs WHERE user_id = ? AND provider = ?"+r.dialect.forUpdate, sync.UserID, sync.Provider,
+	).Scan(&account)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO contact_syncs (user_id, provider, account, token, token_key_version, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			sync.UserID, sync.Provider, sync.Account, token, version, SyncStatusOK, sync.CreatedAt,
+		)
+	case err != nil:
+		return err
+	case account == sync.Account:
+		_, err = tx.ExecContext(ctx,
+			"UPDATE contact_syncs SET token = ?, token_key_version = ?, status = ?, error = NULL WHERE user_id = ? AND provider = ?",
+			token, version, SyncStatusOK, sync.UserID, sync.Provider,
+		)
+	default:
+		if _, err = tx.ExecContext(ctx,
+			"DELETE FROM contact_sync_links WHERE user_id = ? AND provider = ?", sync.UserID, sync.Provider,
+		); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE contact_syncs SET account = ?, token = ?, token_key_version = ?, sync_token = NULL, status = ?, error = NULL, "+
+				"last_synced_at = NULL, created_at = ? WHERE user_id = ? AND provider = ?",
+			sync.Account, token, version, SyncStatusOK, sync.CreatedAt, sync.UserID, sync.Provider,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *sqlContactSyncs) Get(ctx context.Context, userID int, provider string) (models.ContactSync, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return models.ContactSync{}, err
+	}
+	sync, err := scanContactSync(r.db.QueryRowContext(ctx,
+		"SELECT "+contactSyncColumns+" FROM contact_syncs WHERE user_id = ? AND provider = ?", userID, provider,
+	), ring)
+	if err == sql.ErrNoRows {
+		return sync, ErrNotFound
+	}
+	return sync, err
+}
+
+func (r *sqlContactSyncs) List(ctx context.Context, userID int) ([]models.ContactSync, error) {
+	return r.list(ctx, "SELECT "+contactSyncColumns+" FROM contact_syncs WHERE user_id = ? ORDER BY provider", userID)
+}
+
+func (r *sqlContactSyncs) ListDue(ctx context.Context, syncedBefore time.Time) ([]models.ContactSync, error) {
+	return r.list(ctx,
+		"SELECT "+contactSyncColumns+" FROM contact_syncs WHERE status <> ? AND (last_synced_at IS NULL OR last_synced_at < ?) "+
+			"ORDER BY user_id, provider",
+		SyncStatusReconnect, syncedBefore.UTC(),
+	)
+}
+
+// list returns the connections a query selects with contactSyncColumns
+func (r *sqlContactSyncs) list(ctx context.Context, query string, args ...interface{}) ([]models.ContactSync, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncs := []models.ContactSync{}
+	for rows.Next() {
+		sync, err := scanContactSync(rows, ring)
+		if err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, sync)
+	}
+	return syncs, rows.Err()
+}
+
+func (r *sqlContactSyncs) Claim(ctx context.Context, userID int, provider string, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE contact_syncs SET syncing_at = ? WHERE user_id = ? AND provider = ? AND (syncing_at IS NULL OR syncing_at < ?)",
+		now.UTC().Truncate(time.Second), userID, provider, now.Add(-contactSyncClaimTimeout).UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sqlContactSyncs) Finish(ctx context.Context, sync models.ContactSync) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	token, version, err := sealContactSyncToken(ring, sync)
+	if err != nil {
+		return err
+	}
+	var lastSyncedAt interface{}
+	if sync.LastSyncedAt != nil {
+		lastSyncedAt = sync.LastSyncedAt.UTC().Truncate(time.Second)
+	}
+	_, err = r.db.ExecContext(ctx,
+		"UPDATE contact_syncs SET token = ?, token_key_version = ?, sync_token = ?, status = ?, error = ?, last_synced_at = ?, "+
+			"syncing_at = NULL WHERE user_id = ? AND provider = ?",
+		token, version,
+		sql.NullString{String: sync.SyncToken, Valid: sync.SyncToken != ""}, sync.Status,
+		sql.NullString{String: sync.Error, Valid: sync.Error != ""}, lastSyncedAt,
+		sync.UserID, sync.Provider,
+	)
+	return err
+}
+
+func (r *sqlContactSyncs) Delete(ctx context.Context, userID int, provider string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM contact_sync_links WHERE user_id = ? AND provider = ?", userID, provider,
+	); err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM contact_syncs WHERE user_id = ? AND provider = ?", userID, provider)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sqlContactSyncs) Links(ctx context.Context, userID int, provider string) ([]models.ContactSyncLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, user_id, provider, contact_id, remote_id, etag, contact_version FROM contact_sync_links "+
+			"WHERE user_id = ? AND provider = ? ORDER BY id",
+		userID, provider,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.ContactSyncLink
+	for rows.Next() {
+		var link models.ContactSyncLink
+		var contactID sql.NullInt64
+		if err := rows.Scan(&link.ID, &link.UserID, &link.Provider, &contactID, &link.RemoteID, &link.ETag, &link.ContactVersion); err != nil {
+			return nil, err
+		}
+		link.ContactID = int(contactID.Int64)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r *sqlContactSyncs) SaveLink(ctx context.Context, link *models.ContactSyncLink) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	contactID := sql.NullInt64{Int64: int64(link.ContactID), Valid: link.ContactID != 0}
+	if link.ID != 0 {
+		_, err := r.db.ExecContext(ctx,
+			"UPDATE contact_sync_links SET contact_id = ?, remote_id = ?, etag = ?, contact_version = ? WHERE id = ?",
+			contactID, link.RemoteID, link.ETag, link.ContactVersion, link.ID,
+		)
+		if err != nil && r.dialect.isDuplicate(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO contact_sync_links (user_id, provider, contact_id, remote_id, etag, contact_version) VALUES (?, ?, ?, ?, ?, ?)",
+		link.UserID, link.Provider, contactID, link.RemoteID, link.ETag, link.ContactVersion,
+	)
+	if err != nil && r.dialect.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	link.ID = int(id)
+	return nil
+}
+
+func (r *sqlContactSyncs) DeleteLink(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "DELETE FROM contact_sync_links WHERE id = ?", id)
+	return err
+}
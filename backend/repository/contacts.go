@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"phonesaver-backend/encryption"
+	"phonesaver-backend/models"
+)
+
+// ContactRepository stores users' contacts. Every method is scoped to the
+// owning user, so a contact of another user is reported as ErrNotFound, and
+// is bounded by ctx and DB_TIMEOUT.
+type ContactRepository interface {
+	// List returns a user's contacts matching query. An invalid filter
+	// expression is reported as a *FilterError.
+	List(ctx context.Context, userID int, query ContactQuery) ([]models.Contact, error)
+	// CountMatching returns the number of a user's contacts matching query,
+	// ignoring its Limit and After
+	CountMatching(ctx context.Context, userID int, query ContactQuery) (int, error)
+	// ListAll returns all of a user's contacts ordered by ID
+	ListAll(ctx context.Context, userID int) ([]models.Contact, error)
+	// ListChanged returns a user's contacts created or updated at or after
+	// since, in the order they changed, split into those created since then
+	// and those created before
+	ListChanged(ctx context.Context, userID int, since time.Time) (created, updated []models.Contact, err error)
+	// Get returns one of a user's contacts
+	Get(ctx context.Context, userID, contactID int) (models.Contact, error)
+	// FindByPhone returns a user's contacts whose phone number is phone,
+	// ignoring formatting, ordered by ID
+	FindByPhone(ctx context.Context, userID int, phone string) ([]models.Contact, error)
+	// ListDuplicates returns the groups of a user's contacts that share a
+	// phone number, ignoring formatting, each ordered by ID and the groups by
+	// their first contact. While contacts are re-encrypted to a new data key,
+	// a copy still encrypted with the old key is grouped with the others once
+	// it is re-encrypted.
+	ListDuplicates(ctx context.Context, userID int) ([][]models.Contact, error)
+	// Exists reports whether a user owns a contact
+	Exists(ctx context.Context, userID, contactID int) (bool, error)
+	// Count returns the number of contacts a user has
+	Count(ctx context.Context, userID int) (int, error)
+	// Create stores a new contact for contact.UserID, setting its ID and
+	// version
+	Create(ctx context.Context, contact *models.Contact) error
+	// Update applies patch to a contact and increments its version. When
+	// expectedVersion is non-zero the update only succeeds if the contact is
+	// still at that version, and ErrVersionConflict is returned otherwise.
+	// The contact is returned as stored after the attempt.
+	Update(ctx context.Context, userID, contactID, expectedVersion int, patch ContactPatch) (models.Contact, error)
+	// SetPhoneVerification stores the verification of a contact's phone
+	// number as of version, which must still be the contact's, returning
+	// ErrVersionConflict otherwise. The version is left as it is, as the
+	// verification is the server's rather than an edit.
+	SetPhoneVerification(ctx context.Context, userID, contactID, version int, verification models.PhoneVerification) error
+	// Delete deletes a contact, recording a tombstone for sync, and reports
+	// whether it existed
+	Delete(ctx context.Context, userID, contactID int) (bool, error)
+	// Transaction runs fn in a transaction, which is committed if fn returns
+	// nil and rolled back otherwise
+	Transaction(ctx context.Context, fn func(tx ContactTx) error) error
+}
+
+// ContactTx is the set of contact writes that can be grouped in a
+// transaction. They run with the context passed to Transaction.
+type ContactTx interface {
+	// GetForUpdate returns one of a user's contacts and locks it until the
+	// transaction ends
+	GetForUpdate(userID, contactID int) (models.Contact, error)
+	// Create stores a new contact as ContactRepository.Create does
+	Create(contact *models.Contact) error
+	// Update applies patch to a contact and increments its version
+	Update(userID, contactID int, patch ContactPatch) error
+	// Delete deletes a contact as ContactRepository.Delete does
+	Delete(userID, contactID int) (bool, error)
+	// DeleteAll deletes all of a user's contacts, recording tombstones
+	DeleteAll(userID int) error
+}
+
+// ContactQuery selects and orders the contacts returned by List
+type ContactQuery struct {
+	// Search matches contacts whose name contains it or whose phone number
+	// is it, ignoring formatting. Phone numbers are stored encrypted, so they
+	// only match in full.
+	Search string
+	// Tag matches contacts whose tags contain it. Tags encrypted for
+	// enhanced privacy only match in full.
+	Tag string
+	// Filter is an expression in the filter language, such as
+	// `birthday.month == 5 AND tag == "work"`
+	Filter string
+	// SortBy is name, last_interaction or birthday, with ties broken by ID.
+	// Contacts are sorted by ID otherwise.
+	SortBy string
+	// Desc sorts in descending order
+	Desc bool
+	// Limit bounds the number of contacts returned, unless it is 0
+	Limit int
+	// After continues the listing after the contact it identifies, the last
+	// one of the previous page
+	After *ContactCursor
+}
+
+// ContactCursor identifies a contact in the order of a ContactQuery: by its
+// ID and its value of the column sorted by, if any. Value is its name, or
+// its last interaction or birthday, nil if it has none.
+type ContactCursor struct {
+	ID    int
+	Value interface{}
+}
+
+// ContactPatch holds the fields of a contact to change. Nil fields are left
+// as they are.
+type ContactPatch struct {
+	Name            *string
+	Phone           *string
+	EncryptedPhone  *string
+	Tags            *[]string
+	LastInteraction *time.Time
+	Birthday        *time.Time
+}
+
+// EditableFields returns a patch setting the fields of contact that users
+// edit directly. The last interaction is left out as it is derived from
+// recorded interactions.
+func EditableFields(contact models.Contact) ContactPatch {
+	return ContactPatch{
+		Name:           &contact.Name,
+		Phone:          &contact.Phone,
+		EncryptedPhone: &contact.EncryptedPhone,
+		Tags:           &contact.Tags,
+		Birthday:       &contact.Birthday,
+	}
+}
+
+// RowScanner is satisfied by both *sql.Row and *sql.Rows
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanContact reads a contact row selected with the columns
+// id, user_id, name, phone, phone_key_version, encrypted_phone, tags, tags_key_version, last_interaction, birthday, version, updated_at,
+// phone_valid, phone_line_type, phone_carrier, phone_country, phone_verified_at
+// followed by any extra columns, which are scanned into extra, decrypting
+// its phone number and tags with the versions of ring they were encrypted
+// with
+func scanContact(row RowScanner, ring *encryption.Keyring, extra ...interface{}) (models.Contact, error) {
+	var contact models.Contact
+	var keyVersion, tagsKeyVersion sql.NullInt64
+	var tags sql.NullString
+	var lastInteraction, birthday, verifiedAt sql.NullTime
+	var phoneValid sql.NullBool
+	var lineType, carrier, country sql.NullString
+	dest := []interface{}{
+		&contact.ID, &contact.UserID, &contact.Name, &contact.Phone, &keyVersion, &contact.EncryptedPhone,
+		&tags, &tagsKeyVersion, &lastInteraction, &birthday, &contact.Version, &contact.UpdatedAt, &contact.CreatedAt,
+		&phoneValid, &lineType, &carrier, &country, &verifiedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return contact, err
+	}
+	phone, err := openPhone(ring, contact.UserID, contact.Phone, keyVersion)
+	if err != nil {
+		return contact, fmt.Errorf("failed to decrypt phone of contact %d: %v", contact.ID, err)
+	}
+	contact.Phone = phone
+	if contact.Tags, err = openTags(ring, contact.UserID, tags.String, tagsKeyVersion); err != nil {
+		return contact, fmt.Errorf("failed to decrypt tags of contact %d: %v", contact.ID, err)
+	}
+	contact.LastInteraction = lastInteraction.Time
+	contact.Birthday = birthday.Time
+	if verifiedAt.Valid {
+		contact.PhoneVerification = &models.PhoneVerification{
+			Valid:       phoneValid.Bool,
+			LineType:    lineType.String,
+			Carrier:     carrier.String,
+			CountryCode: country.String,
+			VerifiedAt:  verifiedAt.Time,
+		}
+	}
+	return contact, nil
+}
+
+// SplitTags converts the comma-joined tags column into a slice
+func SplitTags(raw string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// NullTime maps the zero time to NULL for nullable DATETIME/DATE columns
+func NullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
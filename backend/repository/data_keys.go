@@ -0,0 +1,351 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/encryption"
+)
+
+const (
+	// dataKeyRefresh is how often servers reload the data keys, picking up
+	// keys created by a rotation on another server
+	dataKeyRefresh = time.Minute
+	// dataKeyActivation is how long after a rotation the new data key starts
+	// encrypting, by which time every server has loaded it and can decrypt
+	// what it encrypts
+	dataKeyActivation = 2 * dataKeyRefresh
+	// configuredKeyVersion is the version of DATA_ENCRYPTION_KEY, which the
+	// first data key stored with a KMS also takes
+	configuredKeyVersion = 1
+)
+
+// ErrNoKMS is returned when rotating the data key without a KMS to keep the
+// new key wrapped by
+var ErrNoKMS = errors.New("rotating the data key requires a kms")
+
+// DataKey describes a version of the data key
+type DataKey struct {
+	Version int
+	// KMSKeyVersion names the version of the KMS key the data key is
+	// wrapped with, and is empty without a KMS
+	KMSKeyVersion string
+	CreatedAt     time.Time
+	// ActiveAt is when the key started, or starts, encrypting new values
+	ActiveAt time.Time
+}
+
+// wrappedDataKey is a stored version of the data key
+type wrappedDataKey struct {
+	DataKey
+	wrapped []byte
+}
+
+// dataKeys provides the keyring contacts' fields are encrypted with. A data
+// key configured directly is used as it is, as the only version. With a KMS,
+// the versions of the data key are kept in the data_keys table wrapped by the
+// KMS, and are unwrapped on first use so the schema can be migrated and the
+// KMS reached after the store opens.
+type dataKeys struct {
+	db      *sql.DB
+	dialect *dialect
+	kms     encryption.KMS
+	timeout time.Duration
+	// configured is DATA_ENCRYPTION_KEY, which with a KMS becomes the stored
+	// data key if there is none yet, so data encrypted before the KMS was
+	// set up stays readable
+	configured []byte
+
+	mu       sync.Mutex
+	ring     *encryption.Keyring
+	loadedAt time.Time
+	// unwrapped holds the unwrapped keys by version, so reloads only unwrap
+	// new ones
+	unwrapped map[int][]byte
+}
+
+// newDataKeys sets up the data key selected by cfg.KMSProvider
+func newDataKeys(cfg *config.Config, db *sql.DB, d *dialect) (*dataKeys, error) {
+	k := &dataKeys{db: db, dialect: d, timeout: cfg.DBTimeout, unwrapped: map[int][]byte{}}
+	if cfg.DataKey != "" {
+		key, err := encryption.ParseKey(cfg.DataKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATA_ENCRYPTION_KEY: %v", err)
+		}
+		k.configured = key
+	}
+
+	var err error
+	switch cfg.KMSProvider {
+	case "", config.KMSProviderNone:
+		k.ring, err = encryption.NewKeyring(map[int][]byte{configuredKeyVersion: k.configured}, configuredKeyVersion)
+		return k, err
+	case config.KMSProviderGoogle:
+		var opts []option.ClientOption
+		if cfg.FirebaseConfig != "" {
+			opts = append(opts, option.WithCredentialsFile(cfg.FirebaseConfig))
+		}
+		k.kms, err = encryption.NewGoogleKMS(context.Background(), cfg.KMSKeyName, opts...)
+	case config.KMSProviderLocal:
+		var masterKey []byte
+		if masterKey, err = encryption.ParseKey(cfg.KMSLocalKey); err != nil {
+			return nil, fmt.Errorf("invalid KMS_LOCAL_KEY: %v", err)
+		}
+		k.kms, err = encryption.NewLocalKMS(masterKey)
+	default:
+		return nil, fmt.Errorf("unknown kms provider %q", cfg.KMSProvider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// get returns the keyring, loading the data keys with the KMS on first use
+// and reloading them every dataKeyRefresh. A failure to load is returned to
+// the caller and retried on the next call; a failure to reload keeps the
+// keys loaded before.
+func (k *dataKeys) get(ctx context.Context) (*encryption.Keyring, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ring != nil && (k.kms == nil || time.Since(k.loadedAt) < dataKeyRefresh) {
+		return k.ring, nil
+	}
+	if err := k.reload(ctx); err != nil && k.ring == nil {
+		return nil, fmt.Errorf("failed to load data key: %v", err)
+	}
+	return k.ring, nil
+}
+
+// reload loads the versions of the data key from the data_keys table, storing
+// the first one if there is none. The newest version that is active becomes
+// the current one. k.mu must be held.
+func (k *dataKeys) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, k.timeout)
+	defer cancel()
+
+	keys, err := k.list(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		if err := k.create(ctx); err != nil {
+			return err
+		}
+		if keys, err = k.list(ctx); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	current := keys[0].Version
+	unwrapped := make(map[int][]byte, len(keys))
+	for _, key := range keys {
+		if !key.ActiveAt.After(now) && key.Version > current {
+			current = key.Version
+		}
+		if plaintext, ok := k.unwrapped[key.Version]; ok {
+			unwrapped[key.Version] = plaintext
+			continue
+		}
+		plaintext, err := k.unwrap(ctx, key)
+		if err != nil {
+			return fmt.Errorf("data key version %d: %v", key.Version, err)
+		}
+		unwrapped[key.Version] = plaintext
+	}
+	if key, ok := unwrapped[configuredKeyVersion]; ok && k.configured != nil && !bytes.Equal(k.configured, key) {
+		return errors.New("DATA_ENCRYPTION_KEY is not the data key stored wrapped by the kms; unset it")
+	}
+
+	ring, err := encryption.NewKeyring(unwrapped, current)
+	if err != nil {
+		return err
+	}
+	k.ring, k.unwrapped, k.loadedAt = ring, unwrapped, now
+	return nil
+}
+
+// list returns the stored versions of the data key, oldest first
+func (k *dataKeys) list(ctx context.Context) ([]wrappedDataKey, error) {
+	rows, err := k.db.QueryContext(ctx, "SELECT id, wrapped_key, kms_key_version, created_at, active_at FROM data_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []wrappedDataKey
+	for rows.Next() {
+		var key wrappedDataKey
+		if err := rows.Scan(&key.Version, &key.wrapped, &key.KMSKeyVersion, &key.CreatedAt, &key.ActiveAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// unwrap decrypts a stored data key. A key wrapped with an older version of
+// the KMS key is rewrapped with the current one, so old versions can be
+// disabled once every server has restarted.
+func (k *dataKeys) unwrap(ctx context.Context, key wrappedDataKey) ([]byte, error) {
+	plaintext, err := k.kms.Unwrap(ctx, key.wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped, current, err := k.kms.Wrap(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if current != key.KMSKeyVersion {
+		_, err = k.db.ExecContext(ctx,
+			"UPDATE data_keys SET wrapped_key = ?, kms_key_version = ? WHERE id = ? AND kms_key_version = ?",
+			rewrapped, current, key.Version, key.KMSKeyVersion,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrap data key: %v", err)
+		}
+	}
+	return plaintext, nil
+}
+
+// create stores the first data key, which is DATA_ENCRYPTION_KEY if it is
+// set and a new random key otherwise. When several servers start at once,
+// the first to store its key wins and the others load it.
+func (k *dataKeys) create(ctx context.Context) error {
+	key := k.configured
+	if key == nil {
+		var err error
+		if key, err = encryption.GenerateKey(); err != nil {
+			return err
+		}
+	}
+	wrapped, version, err := k.kms.Wrap(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = k.db.ExecContext(ctx,
+		"INSERT INTO data_keys (id, wrapped_key, kms_key_version, created_at, active_at) VALUES (?, ?, ?, ?, ?)",
+		configuredKeyVersion, wrapped, version, now, now,
+	)
+	if err != nil && !k.dialect.isDuplicate(err) {
+		return fmt.Errorf("failed to store data key: %v", err)
+	}
+	return nil
+}
+
+// rotate stores a new random version of the data key, which starts
+// encrypting once every server has had time to load it
+func (k *dataKeys) rotate(ctx context.Context) (DataKey, error) {
+	if k.kms == nil {
+		return DataKey{}, ErrNoKMS
+	}
+	plaintext, err := encryption.GenerateKey()
+	if err != nil {
+		return DataKey{}, err
+	}
+	wrapped, kmsVersion, err := k.kms.Wrap(ctx, plaintext)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now().UTC()
+	key := DataKey{KMSKeyVersion: kmsVersion, CreatedAt: now, ActiveAt: now.Add(dataKeyActivation)}
+	result, err := k.db.ExecContext(ctx,
+		"INSERT INTO data_keys (wrapped_key, kms_key_version, created_at, active_at) VALUES (?, ?, ?, ?)",
+		wrapped, key.KMSKeyVersion, key.CreatedAt, key.ActiveAt,
+	)
+	if err != nil {
+		return DataKey{}, fmt.Errorf("failed to store data key: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return DataKey{}, fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	key.Version = int(id)
+	k.unwrapped[key.Version] = plaintext
+
+	// Load the new key right away rather than at the next refresh
+	return key, k.reload(ctx)
+}
+
+// refresh reloads the data keys if version isn't the current one yet, such
+// as right after it became active, and returns the keyring
+func (k *dataKeys) refresh(ctx context.Context, version int) (*encryption.Keyring, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if current, _ := k.ring.Current(); k.kms != nil && current < version {
+		if err := k.reload(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return k.ring, nil
+}
+
+// Close closes the connection to the KMS
+func (k *dataKeys) Close() error {
+	if k.kms == nil {
+		return nil
+	}
+	return k.kms.Close()
+}
+
+// LoadDataKey loads the data key contacts are encrypted with, which is
+// otherwise loaded on first use, so a data key the KMS can't unwrap is
+// reported at startup
+func (s *Store) LoadDataKey(ctx context.Context) error {
+	_, err := s.keys.get(ctx)
+	return err
+}
+
+// DataKeys returns the versions of the data key, oldest first, and the
+// version new values are encrypted with
+func (s *Store) DataKeys(ctx context.Context) ([]DataKey, int, error) {
+	ring, err := s.keys.get(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	current, _ := ring.Current()
+	if s.keys.kms == nil {
+		return []DataKey{{Version: configuredKeyVersion}}, current, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.keys.timeout)
+	defer cancel()
+	wrapped, err := s.keys.list(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make([]DataKey, len(wrapped))
+	for i, key := range wrapped {
+		keys[i] = key.DataKey
+	}
+	return keys, current, nil
+}
+
+// CanRotateDataKey reports whether the data key is kept by a KMS, which
+// rotating it requires
+func (s *Store) CanRotateDataKey() bool {
+	return s.keys.kms != nil
+}
+
+// RotateDataKey creates a new version of the data key, which new values are
+// encrypted with from DataKey.ActiveAt. Existing values keep their version
+// until ReencryptPhones re-encrypts them. Without a KMS, ErrNoKMS is
+// returned.
+func (s *Store) RotateDataKey(ctx context.Context) (DataKey, error) {
+	return s.keys.rotate(ctx)
+}
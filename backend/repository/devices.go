@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DeviceRepository stores the devices users log in from
+type DeviceRepository interface {
+	// Register records a login from one of a user's devices, adding the
+	// device or updating its name and last seen time, and reports whether
+	// the device is new
+	Register(ctx context.Context, userID int, deviceID, name string) (bool, error)
+	// Count returns the number of devices a user has logged in from
+	Count(ctx context.Context, userID int) (int, error)
+	// Delete forgets one of a user's devices, with its sync state and push
+	// token, and reports whether it existed
+	Delete(ctx context.Context, userID int, deviceID string) (bool, error)
+}
+
+// sqlDevices is the DeviceRepository backed by the devices table
+type sqlDevices struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlDevices) Register(ctx context.Context, userID int, deviceID, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var known int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM devices WHERE user_id = ? AND device_id = ?",
+		userID, deviceID,
+	).Scan(&known)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO devices (user_id, device_id, name, last_seen_at, created_at) VALUES (?, ?, ?, ?, ?) "+
+			r.dialect.upsert([]string{"user_id", "device_id"}, []string{"name", "last_seen_at"}),
+		userID, deviceID, name, now, now,
+	)
+	return known == 0, err
+}
+
+func (r *sqlDevices) Count(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM devices WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlDevices) Delete(ctx context.Context, userID int, deviceID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM devices WHERE user_id = ? AND device_id = ?", userID, deviceID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import "strings"
+
+// dialect holds the SQL that differs between the supported databases
+type dialect struct {
+	// forUpdate is appended to a query to lock the rows it selects
+	forUpdate string
+	// likeEscape follows a LIKE pattern escaped with escapeLike
+	likeEscape string
+	// datePart returns the expression extracting the year, month or day of a
+	// date column as an integer
+	datePart func(part, column string) string
+	// hasTag returns the condition that the comma-separated list column
+	// contains the tag bound to ?
+	hasTag func(column string) string
+	// upsert returns the clause that turns an insert conflicting on key
+	// into an update of columns
+	upsert func(key []string, columns []string) string
+	// increment is like upsert, but adds the inserted value of column to
+	// the conflicting row's
+	increment func(key []string, column string) string
+	// isDuplicate reports whether err is a unique constraint violation
+	isDuplicate func(err error) bool
+}
+
+var mysqlDialect = &dialect{
+	forUpdate:  " FOR UPDATE",
+	likeEscape: "",
+	datePart: func(part, column string) string {
+		return map[string]string{"year": "YEAR", "month": "MONTH", "day": "DAYOFMONTH"}[part] + "(" + column + ")"
+	},
+	hasTag: func(column string) string {
+		return "FIND_IN_SET(?, COALESCE(" + column + ", '')) > 0"
+	},
+	upsert: func(key []string, columns []string) string {
+		set := make([]string, len(columns))
+		for i, column := range columns {
+			set[i] = column + " = VALUES(" + column + ")"
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	},
+	increment: func(key []string, column string) string {
+		return "ON DUPLICATE KEY UPDATE " + column + " = " + column + " + VALUES(" + column + ")"
+	},
+	isDuplicate: func(err error) bool {
+		return strings.Contains(err.Error(), "Duplicate entry")
+	},
+}
+
+// sqliteDialect relies on a single writer at a time, which BEGIN IMMEDIATE
+// transactions ensure, in place of row locks
+var sqliteDialect = &dialect{
+	forUpdate:  "",
+	likeEscape: ` ESCAPE '\'`,
+	datePart: func(part, column string) string {
+		format := map[string]string{"year": "%Y", "month": "%m", "day": "%d"}[part]
+		return "CAST(strftime('" + format + "', " + column + ") AS INTEGER)"
+	},
+	hasTag: func(column string) string {
+		return "instr(',' || COALESCE(" + column + ", '') || ',', ',' || ? || ',') > 0"
+	},
+	upsert: func(key []string, columns []string) string {
+		set := make([]string, len(columns))
+		for i, column := range columns {
+			set[i] = column + " = excluded." + column
+		}
+		return "ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(set, ", ")
+	},
+	increment: func(key []string, column string) string {
+		return "ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + column + " = " + column + " + excluded." + column
+	},
+	isDuplicate: func(err error) bool {
+		return strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+			strings.Contains(err.Error(), "PRIMARY KEY constraint failed")
+	},
+}
+
+// ForUpdate returns the suffix that locks the rows a query selects until the
+// transaction ends, which is empty for databases that lock the whole
+// database instead
+func (s *Store) ForUpdate() string {
+	return s.dialect.forUpdate
+}
+
+// Upsert returns the clause to append to an INSERT so that a row conflicting
+// on the key columns is updated with the inserted values of columns instead
+func (s *Store) Upsert(key []string, columns ...string) string {
+	return s.dialect.upsert(key, columns)
+}
+
+// IsDuplicate reports whether err is a violation of a unique or primary key
+func (s *Store) IsDuplicate(err error) bool {
+	return err != nil && s.dialect.isDuplicate(err)
+}
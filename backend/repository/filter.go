@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"phonesaver-backend/encryption"
+)
+
+const (
+	// maxFilterLength bounds the length of a filter expression
+	maxFilterLength = 1000
+	// maxFilterConditions bounds the number of comparisons in a filter
+	maxFilterConditions = 20
+)
+
+// filterFieldType is the type of a filterable field, which decides the
+// operators and values it accepts
+type filterFieldType int
+
+const (
+	filterString filterFieldType = iota
+	filterInt
+	filterDate
+	filterTag
+	// filterPhone compares the blind indexes of phone numbers, which are
+	// stored encrypted, so they can only be compared in full
+	filterPhone
+)
+
+// filterField maps a field of the filter language to the column it compares
+// and, for the parts of a date, the part compared
+type filterField struct {
+	column string
+	part   string
+	typ    filterFieldType
+}
+
+// contactFilterFields are the contact fields filters may compare
+var contactFilterFields = map[string]filterField{
+	"name":             {"name", "", filterString},
+	"phone":            {"phone_hmac", "", filterPhone},
+	"tag":              {"tags", "", filterTag},
+	"birthday":         {"birthday", "", filterDate},
+	"birthday.year":    {"birthday", "year", filterInt},
+	"birthday.month":   {"birthday", "month", filterInt},
+	"birthday.day":     {"birthday", "day", filterInt},
+	"last_interaction": {"last_interaction", "", filterDate},
+	"updated_at":       {"updated_at", "", filterDate},
+	"version":          {"version", "", filterInt},
+	"line_type":        {"phone_line_type", "", filterString},
+	"carrier":          {"phone_carrier", "", filterString},
+	"country":          {"phone_country", "", filterString},
+}
+
+// filterOperators are the operators each field type accepts, with their SQL
+var filterOperators = map[filterFieldType]map[string]string{
+	filterString: {"==": "=", "!=": "<>", "~": "LIKE"},
+	filterInt:    {"==": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">="},
+	filterDate:   {"==": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">="},
+	filterTag:    {"==": "", "!=": ""},
+	filterPhone:  {"==": "IN", "!=": "NOT IN"},
+}
+
+// FilterError reports an invalid filter expression and where it went wrong
+type FilterError struct {
+	pos     int
+	message string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.message, e.pos+1)
+}
+
+type filterTokenKind int
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	value string
+	pos   int
+}
+
+// lexFilter splits a filter expression into tokens
+func lexFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(input) {
+		ch := rune(input[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case ch == '"':
+			start := i
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, &FilterError{start, "unterminated string"}
+				}
+				if input[i] == '\\' && i+1 < len(input) {
+					value.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				value.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: input[start:i], value: value.String(), pos: start})
+		case strings.ContainsRune("=!<>~", ch):
+			start := i
+			op := string(ch)
+			if i+1 < len(input) && input[i+1] == '=' {
+				op += "="
+			}
+			i += len(op)
+			if op == "=" || op == "!" || op == "~=" {
+				return nil, &FilterError{start, fmt.Sprintf("unknown operator %q", op)}
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op, pos: start})
+		case ch == '-' || unicode.IsDigit(ch):
+			start := i
+			i++
+			for i < len(input) && unicode.IsDigit(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: input[start:i], value: input[start:i], pos: start})
+		case unicode.IsLetter(ch) || ch == '_':
+			start := i
+			for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || input[i] == '_' || input[i] == '.') {
+				i++
+			}
+			word := input[start:i]
+			kind := tokenIdent
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, filterToken{kind: kind, text: word, value: word, pos: start})
+		default:
+			return nil, &FilterError{i, fmt.Sprintf("unexpected character %q", ch)}
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, text: "end of filter", pos: len(input)}), nil
+}
+
+// filterParser compiles tokens to a SQL condition by recursive descent:
+//
+//	expr       = and { "OR" and }
+//	and        = unary { "AND" unary }
+//	unary      = "NOT" unary | "(" expr ")" | comparison
+//	comparison = field operator value
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	fields     map[string]filterField
+	dialect    *dialect
+	ring       *encryption.Keyring
+	args       []interface{}
+	conditions int
+}
+
+// compileContactFilter compiles a filter expression over contacts, such as
+// `birthday.month == 5 AND tag == "work"`, into a parameterized SQL
+// condition in dialect d and its arguments. Phone numbers, and tags
+// encrypted for enhanced privacy, are compared by their blind indexes under
+// the versions of ring.
+func compileContactFilter(input string, d *dialect, ring *encryption.Keyring) (string, []interface{}, error) {
+	if len(input) > maxFilterLength {
+		return "", nil, &FilterError{maxFilterLength, fmt.Sprintf("filter is longer than %d characters", maxFilterLength)}
+	}
+	tokens, err := lexFilter(input)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &filterParser{tokens: tokens, fields: contactFilterFields, dialect: d, ring: ring}
+	sql, err := p.expr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return "", nil, &FilterError{tok.pos, fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return sql, p.args, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) expr() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (string, error) {
+	left, err := p.unary()
+	if err != nil {
+		return "", err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (string, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokenNot:
+		p.next()
+		inner, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	case tokenLParen:
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return "", err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return "", &FilterError{closing.pos, fmt.Sprintf("expected ) but found %q", closing.text)}
+		}
+		return "(" + inner + ")", nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (string, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenIdent {
+		return "", &FilterError{fieldTok.pos, fmt.Sprintf("expected a field but found %q", fieldTok.text)}
+	}
+	field, ok := p.fields[fieldTok.value]
+	if !ok {
+		names := make([]string, 0, len(p.fields))
+		for name := range p.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", &FilterError{fieldTok.pos, fmt.Sprintf("unknown field %q; fields are %s", fieldTok.value, strings.Join(names, ", "))}
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokenOperator {
+		return "", &FilterError{opTok.pos, fmt.Sprintf("expected an operator but found %q", opTok.text)}
+	}
+	op, ok := filterOperators[field.typ][opTok.text]
+	if !ok {
+		return "", &FilterError{opTok.pos, fmt.Sprintf("operator %s can't be used with %s", opTok.text, fieldTok.value)}
+	}
+
+	valueTok := p.next()
+	value, err := filterValue(field.typ, valueTok)
+	if err != nil {
+		return "", err
+	}
+
+	p.conditions++
+	if p.conditions > maxFilterConditions {
+		return "", &FilterError{fieldTok.pos, fmt.Sprintf("filter has more than %d conditions", maxFilterConditions)}
+	}
+
+	column := field.column
+	if field.part != "" {
+		column = p.dialect.datePart(field.part, column)
+	}
+	p.args = append(p.args, value)
+	switch {
+	case field.typ == filterTag:
+		// Tags encrypted for enhanced privacy are matched by blind index
+		encrypted, indexes := encryptedTagCondition(p.dialect, p.ring, value.(string))
+		p.args = append(p.args, indexes...)
+		condition := "(" + p.dialect.hasTag(column) + " OR " + encrypted + ")"
+		if opTok.text == "==" {
+			return condition, nil
+		}
+		return "NOT " + condition, nil
+	case field.typ == filterPhone:
+		indexes := phoneIndexes(p.ring, value.(string))
+		p.args = p.args[:len(p.args)-1]
+		for _, index := range indexes {
+			p.args = append(p.args, index)
+		}
+		return column + " " + op + " (" + placeholders(len(indexes)) + ")", nil
+	case op == "LIKE":
+		p.args[len(p.args)-1] = "%" + escapeLike(value.(string)) + "%"
+		return column + " LIKE ?" + p.dialect.likeEscape, nil
+	}
+	return column + " " + op + " ?", nil
+}
+
+// filterValue converts a literal to the value compared with a field
+func filterValue(typ filterFieldType, tok filterToken) (interface{}, error) {
+	switch typ {
+	case filterString, filterTag, filterPhone:
+		if tok.kind != tokenString {
+			return nil, &FilterError{tok.pos, fmt.Sprintf("expected a quoted string but found %q", tok.text)}
+		}
+		return tok.value, nil
+	case filterInt:
+		if tok.kind != tokenNumber {
+			return nil, &FilterError{tok.pos, fmt.Sprintf("expected a number but found %q", tok.text)}
+		}
+		n, err := strconv.Atoi(tok.value)
+		if err != nil {
+			return nil, &FilterError{tok.pos, fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		return n, nil
+	default:
+		if tok.kind != tokenString {
+			return nil, &FilterError{tok.pos, fmt.Sprintf("expected a quoted date but found %q", tok.text)}
+		}
+		if t, err := time.Parse("2006-01-02", tok.value); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(time.RFC3339, tok.value); err == nil {
+			return t.UTC(), nil
+		}
+		return nil, &FilterError{tok.pos, fmt.Sprintf("invalid date %q; use YYYY-MM-DD or RFC 3339", tok.value)}
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
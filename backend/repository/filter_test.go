@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"phonesaver-backend/encryption"
+)
+
+// testKeyring returns a keyring with two versions, so that blind index
+// comparisons cover every version
+func testKeyring(t *testing.T) *encryption.Keyring {
+	t.Helper()
+	ring, err := encryption.NewKeyring(map[int][]byte{
+		1: bytes.Repeat([]byte{1}, 32),
+		2: bytes.Repeat([]byte{2}, 32),
+	}, 2)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return ring
+}
+
+func TestCompileContactFilter(t *testing.T) {
+	ring := testKeyring(t)
+	work := ring.Indexes("work")
+	phone := ring.Indexes("+14155550101")
+	sqliteTag := "instr(',' || COALESCE(tags, '') || ',', ',' || ? || ',') > 0"
+	sqliteTagIndex := "instr(',' || COALESCE(tag_index, '') || ',', ',' || ? || ',') > 0"
+
+	tests := []struct {
+		name    string
+		input   string
+		dialect *dialect
+		sql     string
+		args    []interface{}
+	}{
+		{
+			name:  "equals",
+			input: `name == "Ann"`,
+			sql:   "name = ?",
+			args:  []interface{}{"Ann"},
+		},
+		{
+			name:  "not equals",
+			input: `carrier != "Acme"`,
+			sql:   "phone_carrier <> ?",
+			args:  []interface{}{"Acme"},
+		},
+		{
+			name:  "contains escapes wildcards",
+			input: `name ~ "50%_off\\"`,
+			sql:   `name LIKE ? ESCAPE '\'`,
+			args:  []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			name:    "contains in mysql",
+			input:   `name ~ "an"`,
+			dialect: mysqlDialect,
+			sql:     "name LIKE ?",
+			args:    []interface{}{"%an%"},
+		},
+		{
+			name:  "escaped quotes",
+			input: `name == "say \"hi\""`,
+			sql:   "name = ?",
+			args:  []interface{}{`say "hi"`},
+		},
+		{
+			name:  "number comparisons",
+			input: `version > 2 AND version <= -1`,
+			sql:   "(version > ? AND version <= ?)",
+			args:  []interface{}{2, -1},
+		},
+		{
+			name:  "date part",
+			input: `birthday.month == 5`,
+			sql:   "CAST(strftime('%m', birthday) AS INTEGER) = ?",
+			args:  []interface{}{5},
+		},
+		{
+			name:    "date part in mysql",
+			input:   `birthday.day >= 10`,
+			dialect: mysqlDialect,
+			sql:     "DAYOFMONTH(birthday) >= ?",
+			args:    []interface{}{10},
+		},
+		{
+			name:  "dates",
+			input: `birthday < "2000-01-02" AND updated_at >= "2024-05-01T10:00:00+02:00"`,
+			sql:   "(birthday < ? AND updated_at >= ?)",
+			args: []interface{}{
+				time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "tag",
+			input: `tag == "work"`,
+			sql:   "(" + sqliteTag + " OR " + sqliteTagIndex + " OR " + sqliteTagIndex + ")",
+			args:  []interface{}{"work", work[0], work[1]},
+		},
+		{
+			name:  "not tag",
+			input: `tag != "work"`,
+			sql:   "NOT (" + sqliteTag + " OR " + sqliteTagIndex + " OR " + sqliteTagIndex + ")",
+			args:  []interface{}{"work", work[0], work[1]},
+		},
+		{
+			name:  "phone is normalized",
+			input: `phone == "+1 (415) 555-0101"`,
+			sql:   "phone_hmac IN (?, ?)",
+			args:  []interface{}{phone[0], phone[1]},
+		},
+		{
+			name:  "not phone",
+			input: `phone != "+14155550101"`,
+			sql:   "phone_hmac NOT IN (?, ?)",
+			args:  []interface{}{phone[0], phone[1]},
+		},
+		{
+			name:  "AND binds tighter than OR",
+			input: `name == "a" OR name == "b" AND name == "c"`,
+			sql:   "(name = ? OR (name = ? AND name = ?))",
+			args:  []interface{}{"a", "b", "c"},
+		},
+		{
+			name:  "parentheses",
+			input: `(name == "a" OR name == "b") AND name == "c"`,
+			sql:   "(((name = ? OR name = ?)) AND name = ?)",
+			args:  []interface{}{"a", "b", "c"},
+		},
+		{
+			name:  "NOT binds tighter than AND",
+			input: `NOT name == "a" AND name == "b"`,
+			sql:   "(NOT name = ? AND name = ?)",
+			args:  []interface{}{"a", "b"},
+		},
+		{
+			name:  "keywords are case-insensitive",
+			input: `not name == "a" or name == "b"`,
+			sql:   "(NOT name = ? OR name = ?)",
+			args:  []interface{}{"a", "b"},
+		},
+		{
+			name:  "left-associative",
+			input: `name == "a" OR name == "b" OR name == "c"`,
+			sql:   "((name = ? OR name = ?) OR name = ?)",
+			args:  []interface{}{"a", "b", "c"},
+		},
+		{
+			name:  "values are never inlined",
+			input: `name == "x' OR 1=1 --"`,
+			sql:   "name = ?",
+			args:  []interface{}{"x' OR 1=1 --"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.dialect
+			if d == nil {
+				d = sqliteDialect
+			}
+			sql, args, err := compileContactFilter(tt.input, d, ring)
+			if err != nil {
+				t.Fatalf("compileContactFilter(%q): %v", tt.input, err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql = %q, want %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestCompileContactFilterErrors(t *testing.T) {
+	ring := testKeyring(t)
+	fields := "birthday, birthday.day, birthday.month, birthday.year, carrier, country, last_interaction, line_type, name, phone, tag, updated_at, version"
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"empty", ``, `expected a field but found "end of filter" at position 1`},
+		{"unknown field", `nickname == "a"`, `unknown field "nickname"; fields are ` + fields + ` at position 1`},
+		{"single equals", `name = "a"`, `unknown operator "=" at position 6`},
+		{"bang", `name ! "a"`, `unknown operator "!" at position 6`},
+		{"tilde equals", `name ~= "a"`, `unknown operator "~=" at position 6`},
+		{"operator for type", `birthday.month ~ 5`, `operator ~ can't be used with birthday.month at position 16`},
+		{"ordering a tag", `tag < "work"`, `operator < can't be used with tag at position 5`},
+		{"missing operator", `name "a"`, `expected an operator but found "\"a\"" at position 6`},
+		{"unterminated string", `name == "a`, `unterminated string at position 9`},
+		{"trailing backslash", `name == "a\`, `unterminated string at position 9`},
+		{"single quotes", `name == 'a'`, `unexpected character '\'' at position 9`},
+		{"string for number", `version == "2"`, `expected a number but found "\"2\"" at position 12`},
+		{"number for string", `name == 5`, `expected a quoted string but found "5" at position 9`},
+		{"number for date", `birthday == 2000`, `expected a quoted date but found "2000" at position 13`},
+		{"invalid date", `birthday == "May 1"`, `invalid date "May 1"; use YYYY-MM-DD or RFC 3339 at position 13`},
+		{"lone minus", `version == -`, `invalid number "-" at position 12`},
+		{"number out of range", `version == 99999999999999999999`, `invalid number "99999999999999999999" at position 12`},
+		{"unclosed parenthesis", `(name == "a"`, `expected ) but found "end of filter" at position 13`},
+		{"extra parenthesis", `name == "a")`, `unexpected ")" at position 12`},
+		{"missing conjunction", `name == "a" name == "b"`, `unexpected "name" at position 13`},
+		{"dangling AND", `name == "a" AND`, `expected a field but found "end of filter" at position 16`},
+		{"dangling NOT", `NOT`, `expected a field but found "end of filter" at position 4`},
+		{"keyword as field", `AND == "a"`, `expected a field but found "AND" at position 1`},
+		{
+			"too long",
+			`name == "` + strings.Repeat("a", maxFilterLength) + `"`,
+			`filter is longer than 1000 characters at position 1001`,
+		},
+		{
+			"too many conditions",
+			strings.Repeat(`version == 1 OR `, maxFilterConditions) + `version == 1`,
+			`filter has more than 20 conditions at position 321`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := compileContactFilter(tt.input, sqliteDialect, ring)
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("compileContactFilter(%q) error = %v, want a *FilterError", tt.input, err)
+			}
+			if err.Error() != tt.err {
+				t.Errorf("error = %q, want %q", err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestCompileContactFilterLimits(t *testing.T) {
+	ring := testKeyring(t)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"longest filter", `name == "` + strings.Repeat("a", maxFilterLength-10) + `"`},
+		{"most conditions", strings.Repeat(`version == 1 OR `, maxFilterConditions-1) + `version == 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := compileContactFilter(tt.input, sqliteDialect, ring); err != nil {
+				t.Errorf("compileContactFilter: %v", err)
+			}
+		})
+	}
+}
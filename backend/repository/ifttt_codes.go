@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// IFTTTCodeRepository stores the authorization codes of IFTTT's OAuth2 flow
+type IFTTTCodeRepository interface {
+	// Create stores an authorization code, purging the codes that expired
+	// before now
+	Create(ctx context.Context, code models.IFTTTAuthorizationCode, now time.Time) error
+	// Consume deletes the code with hash and returns it, so that it can only
+	// be used once however many requests use it at the same time.
+	// ErrNotFound is returned if it is unknown, used or expired by now.
+	Consume(ctx context.Context, hash string, now time.Time) (models.IFTTTAuthorizationCode, error)
+}
+
+// sqlIFTTTCodes is the IFTTTCodeRepository backed by the
+// ifttt_authorization_codes table
+type sqlIFTTTCodes struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlIFTTTCodes) Create(ctx context.Context, code models.IFTTTAuthorizationCode, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM ifttt_authorization_codes WHERE expires_at < ?", now); err != nil {
+		return fmt.Errorf("failed to purge expired codes: %v", err)
+	}
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO ifttt_authorization_codes (code_hash, user_id, redirect_uri, expires_at) VALUES (?, ?, ?, ?)",
+		code.CodeHash, code.UserID, code.RedirectURI, code.ExpiresAt,
+	)
+	return err
+}
+
+func (r *sqlIFTTTCodes) Consume(ctx context.Context, hash string, now time.Time) (models.IFTTTAuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	code := models.IFTTTAuthorizationCode{CodeHash: hash}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return code, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, redirect_uri, expires_at FROM ifttt_authorization_codes WHERE code_hash = ?"+r.dialect.forUpdate, hash,
+	).Scan(&code.UserID, &code.RedirectURI, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return code, ErrNotFound
+	}
+	if err != nil {
+		return code, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM ifttt_authorization_codes WHERE code_hash = ?", hash); err != nil {
+		return code, err
+	}
+	if err := tx.Commit(); err != nil {
+		return code, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	// An expired code is deleted all the same, as it can't be used again
+	if !code.ExpiresAt.After(now) {
+		return code, ErrNotFound
+	}
+	return code, nil
+}
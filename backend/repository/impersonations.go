@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// ImpersonationRepository stores admins' impersonations of users and
+// whether their owners were told about them
+type ImpersonationRepository interface {
+	// Create stores an impersonation, setting its ID
+	Create(ctx context.Context, impersonation *models.Impersonation) error
+	// Get returns an impersonation
+	Get(ctx context.Context, id int) (models.Impersonation, error)
+	// CountRequest counts a request made with an impersonation's token
+	CountRequest(ctx context.Context, id int) error
+	// End ends an impersonation at now, and reports false if it was already
+	// over
+	End(ctx context.Context, id int, now time.Time) (bool, error)
+	// ListFinished returns the impersonations over by now whose owners
+	// haven't been told about them, oldest first
+	ListFinished(ctx context.Context, now time.Time) ([]models.Impersonation, error)
+	// MarkNotified records that an impersonation's owner was told about it
+	MarkNotified(ctx context.Context, id int, now time.Time) error
+}
+
+// impersonationColumns are the columns read by scanImpersonation
+const impersonationColumns = "id, user_id, admin_id, reason, requests, created_at, expires_at, ended_at"
+
+// scanImpersonation reads an impersonation row selected with
+// impersonationColumns
+func scanImpersonation(row RowScanner) (models.Impersonation, error) {
+	var impersonation models.Impersonation
+	var adminID sql.NullInt64
+	var endedAt sql.NullTime
+	if err := row.Scan(&impersonation.ID, &impersonation.UserID, &adminID, &impersonation.Reason, &impersonation.Requests,
+		&impersonation.CreatedAt, &impersonation.ExpiresAt, &endedAt); err != nil {
+		return impersonation, err
+	}
+	impersonation.AdminID = int(adminID.Int64)
+	if endedAt.Valid {
+		impersonation.EndedAt = &endedAt.Time
+	}
+	return impersonation, nil
+}
+
+// sqlImpersonations is the ImpersonationRepository backed by the
+// impersonations table
+type sqlImpersonations struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func (r *sqlImpersonations) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if impersonation.CreatedAt.IsZero() {
+		impersonation.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO impersonations (user_id, admin_id, reason, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		impersonation.UserID, impersonation.AdminID, impersonation.Reason, impersonation.CreatedAt, impersonation.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	impersonation.ID = int(id)
+	return nil
+}
+
+func (r *sqlImpersonations) Get(ctx context.Context, id int) (models.Impersonation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	impersonation, err := scanImpersonation(r.db.QueryRowContext(ctx,
+		"SELECT "+impersonationColumns+" FROM impersonations WHERE id = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return impersonation, ErrNotFound
+	}
+	return impersonation, err
+}
+
+func (r *sqlImpersonations) CountRequest(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "UPDATE impersonations SET requests = requests + 1 WHERE id = ?", id)
+	return err
+}
+
+func (r *sqlImpersonations) End(ctx context.Context, id int, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE impersonations SET ended_at = ? WHERE id = ? AND ended_at IS NULL AND expires_at > ?",
+		now.UTC().Truncate(time.Second), id, now.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sqlImpersonations) ListFinished(ctx context.Context, now time.Time) ([]models.Impersonation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+impersonationColumns+" FROM impersonations "+
+			"WHERE notified_at IS NULL AND (ended_at IS NOT NULL OR expires_at <= ?) ORDER BY id",
+		now.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var impersonations []models.Impersonation
+	for rows.Next() {
+		impersonation, err := scanImpersonation(rows)
+		if err != nil {
+			return nil, err
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	return impersonations, rows.Err()
+}
+
+func (r *sqlImpersonations) MarkNotified(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "UPDATE impersonations SET notified_at = ? WHERE id = ?", now.UTC().Truncate(time.Second), id)
+	return err
+}
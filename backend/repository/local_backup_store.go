@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// localBackupStore stores backups as one JSON file per contact under a
+// directory on the local disk, laid out like the object storage buckets
+type localBackupStore struct {
+	dir string
+}
+
+// NewLocalBackupStore creates a backup store keeping backups under dir,
+// creating the directory if it doesn't exist
+func NewLocalBackupStore(dir string) (BackupStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating backup directory: %v", err)
+	}
+	return &localBackupStore{dir: dir}, nil
+}
+
+func (s *localBackupStore) contactsDir(userID int) string {
+	return filepath.Join(s.dir, "users", strconv.Itoa(userID), "contacts")
+}
+
+func (s *localBackupStore) contactFile(userID int, contactID string) string {
+	return filepath.Join(s.contactsDir(userID), contactID+".json")
+}
+
+func (s *localBackupStore) ListContactIDs(ctx context.Context, userID int) ([]string, error) {
+	entries, err := os.ReadDir(s.contactsDir(userID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return ids, nil
+}
+
+// SaveContacts writes each record to a temporary file and renames it into
+// place, so a failed write never leaves a truncated record behind
+func (s *localBackupStore) SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error {
+	dir := s.contactsDir(userID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return &PartialWriteError{Committed: 0, Err: err}
+	}
+
+	committed := 0
+	for _, record := range upserts {
+		if err := ctx.Err(); err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		body, err := json.Marshal(record)
+		if err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		if err := writeFileAtomic(dir, s.contactFile(userID, strconv.Itoa(record.ID)), body); err != nil {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	for _, id := range deletes {
+		err := os.Remove(s.contactFile(userID, id))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &PartialWriteError{Committed: committed, Err: err}
+		}
+		committed++
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in dir and renames it to name
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".contact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *localBackupStore) LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error) {
+	ids, err := s.ListContactIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]BackupRecord, 0, len(ids))
+	for _, id := range ids {
+		body, err := os.ReadFile(s.contactFile(userID, id))
+		if err != nil {
+			return nil, err
+		}
+		var record BackupRecord
+		if err := json.Unmarshal(body, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode contact %s: %v", id, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Ping checks the backup directory still exists
+func (s *localBackupStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+func (s *localBackupStore) Close() error {
+	return nil
+}
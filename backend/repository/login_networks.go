@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginNetworkRepository stores the networks users have logged in from
+type LoginNetworkRepository interface {
+	// Record records a login by a user from network, and reports whether
+	// they hadn't logged in from it before
+	Record(ctx context.Context, userID int, network string) (bool, error)
+}
+
+// sqlLoginNetworks is the LoginNetworkRepository backed by the
+// login_networks table
+type sqlLoginNetworks struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlLoginNetworks) Record(ctx context.Context, userID int, network string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	now := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO login_networks (user_id, network, first_seen_at, last_seen_at) VALUES (?, ?, ?, ?)",
+		userID, network, now, now,
+	)
+	if err == nil {
+		return true, nil
+	}
+	if !r.dialect.isDuplicate(err) {
+		return false, err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"UPDATE login_networks SET last_seen_at = ? WHERE user_id = ? AND network = ?",
+		now, userID, network,
+	)
+	return false, err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MemoryBackupStore keeps backups in process memory. It stands in for a real
+// store in tests and local development; backups are lost when the process
+// exits.
+type MemoryBackupStore struct {
+	mu      sync.Mutex
+	records map[int]map[string]BackupRecord
+	err     error
+}
+
+// NewMemoryBackupStore creates an empty in-memory backup store
+func NewMemoryBackupStore() *MemoryBackupStore {
+	return &MemoryBackupStore{records: map[int]map[string]BackupRecord{}}
+}
+
+// Fail makes every later call return err, to exercise how callers handle an
+// unavailable store. Passing nil makes the store work again.
+func (s *MemoryBackupStore) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *MemoryBackupStore) ListContactIDs(ctx context.Context, userID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	ids := make([]string, 0, len(s.records[userID]))
+	for id := range s.records[userID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SaveContacts applies all of the changes at once; a store made to fail
+// reports that none were committed
+func (s *MemoryBackupStore) SaveContacts(ctx context.Context, userID int, upserts []BackupRecord, deletes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return &PartialWriteError{Committed: 0, Err: s.err}
+	}
+	records := s.records[userID]
+	if records == nil {
+		records = map[string]BackupRecord{}
+		s.records[userID] = records
+	}
+	for _, record := range upserts {
+		record.Tags = append([]string(nil), record.Tags...)
+		record.Sealed = append([]byte(nil), record.Sealed...)
+		records[strconv.Itoa(record.ID)] = record
+	}
+	for _, id := range deletes {
+		delete(records, id)
+	}
+	return nil
+}
+
+func (s *MemoryBackupStore) LoadContacts(ctx context.Context, userID int) ([]BackupRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	records := make([]BackupRecord, 0, len(s.records[userID]))
+	for _, record := range s.records[userID] {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (s *MemoryBackupStore) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *MemoryBackupStore) Close() error {
+	return nil
+}
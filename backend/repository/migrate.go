@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"phonesaver-backend/config"
+)
+
+// migrationFiles holds the schema migrations of each database, such as
+// migrations/mysql/0002_add_column.up.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migrate applies pending schema migrations and returns the version the
+// schema is then at
+func Migrate(cfg *config.Config) (uint, error) {
+	m, err := newMigrator(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return 0, fmt.Errorf("failed to apply migrations: %v", err)
+	}
+	version, _, err := schemaVersion(m)
+	return version, err
+}
+
+// SchemaVersion returns the version the schema is at and the latest version
+// there is a migration for
+func SchemaVersion(cfg *config.Config) (version, latest uint, err error) {
+	m, err := newMigrator(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer m.Close()
+
+	version, _, err = schemaVersion(m)
+	if err != nil {
+		return 0, 0, err
+	}
+	latest, err = latestMigration(cfg.DBDriver)
+	return version, latest, err
+}
+
+// schemaVersion returns the version of the schema, which is 0 before the
+// first migration. A migration that failed part way is reported as an error
+// since the schema must be repaired by hand.
+func schemaVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if dirty {
+		return version, true, fmt.Errorf("migration %d failed part way; repair the schema and force its version", version)
+	}
+	return version, false, nil
+}
+
+// latestMigration returns the highest migration version for a database
+func latestMigration(driver string) (uint, error) {
+	src, err := migrationSource(driver)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	for err == nil {
+		var next uint
+		if next, err = src.Next(version); err == nil {
+			version = next
+		}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read migrations: %v", err)
+	}
+	return version, nil
+}
+
+func migrationSource(driver string) (source.Driver, error) {
+	src, err := iofs.New(migrationFiles, "migrations/"+driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %v", err)
+	}
+	return src, nil
+}
+
+// newMigrator returns a migrator over a connection of its own, since
+// migrations need multi-statement queries and closing the migrator closes
+// its connection
+func newMigrator(cfg *config.Config) (*migrate.Migrate, error) {
+	driver, dsn, _, err := dataSource(cfg, "&multiStatements=true")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	var target database.Driver
+	switch cfg.DBDriver {
+	case config.DBDriverMySQL:
+		target, err = mysql.WithInstance(db, &mysql.Config{})
+	default:
+		target, err = sqlite.WithInstance(db, &sqlite.Config{})
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare migrations: %v", err)
+	}
+
+	src, err := migrationSource(cfg.DBDriver)
+	if err != nil {
+		target.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", src, cfg.DBDriver, target)
+	if err != nil {
+		target.Close()
+		return nil, fmt.Errorf("failed to prepare migrations: %v", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,226 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX idx_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS contacts (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	phone VARCHAR(255) NOT NULL,
+	encrypted_phone VARCHAR(255) NOT NULL,
+	tags VARCHAR(255) DEFAULT '',
+	last_interaction DATETIME DEFAULT NULL,
+	birthday DATE DEFAULT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_id (user_id),
+	INDEX idx_tags (tags),
+	INDEX idx_last_interaction (last_interaction),
+	INDEX idx_birthday (birthday)
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+	user_id INT NOT NULL,
+	device_id VARCHAR(64) NOT NULL,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	last_sync_token VARCHAR(64) DEFAULT NULL,
+	last_sync_at TIMESTAMP NULL DEFAULT NULL,
+	push_token VARCHAR(512) DEFAULT NULL,
+	last_seen_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, device_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_push_token (push_token)
+);
+
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id INT PRIMARY KEY,
+	birthday_email BOOLEAN NOT NULL DEFAULT FALSE,
+	birthday_push BOOLEAN NOT NULL DEFAULT FALSE,
+	birthday_sms BOOLEAN NOT NULL DEFAULT FALSE,
+	reminder_email BOOLEAN NOT NULL DEFAULT FALSE,
+	reminder_push BOOLEAN NOT NULL DEFAULT TRUE,
+	reminder_sms BOOLEAN NOT NULL DEFAULT FALSE,
+	sms_number VARCHAR(16) NOT NULL DEFAULT '',
+	digest VARCHAR(16) NOT NULL DEFAULT 'off',
+	reminder_hour TINYINT DEFAULT NULL,
+	birthday_days_ahead TINYINT NOT NULL DEFAULT 7,
+	quiet_hours_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	quiet_hours_start TINYINT NOT NULL DEFAULT 22,
+	quiet_hours_end TINYINT NOT NULL DEFAULT 7,
+	timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+	birthday_reminder_sent_on DATE DEFAULT NULL,
+	digest_sent_on DATE DEFAULT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+	user_id INT PRIMARY KEY,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(64) NOT NULL,
+	events VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	webhook_id INT NOT NULL,
+	event_type VARCHAR(32) NOT NULL,
+	payload MEDIUMTEXT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	response_status INT DEFAULT NULL,
+	error TEXT,
+	next_attempt_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+	INDEX idx_status_next (status, next_attempt_at)
+);
+
+CREATE TABLE IF NOT EXISTS reminders (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	contact_id INT NOT NULL,
+	note VARCHAR(500) NOT NULL DEFAULT '',
+	due_at DATETIME NOT NULL,
+	repeat_every INT DEFAULT NULL,
+	repeat_unit VARCHAR(8) DEFAULT NULL,
+	status VARCHAR(16) NOT NULL,
+	notified_at DATETIME DEFAULT NULL,
+	completed_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE,
+	INDEX idx_user_status_due (user_id, status, due_at),
+	INDEX idx_status_due (status, due_at)
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	channel VARCHAR(16) NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	recipient VARCHAR(255) NOT NULL DEFAULT '',
+	subject VARCHAR(255) NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	data TEXT,
+	status VARCHAR(16) NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	error TEXT,
+	next_attempt_at DATETIME DEFAULT NULL,
+	sent_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_created (user_id, id),
+	INDEX idx_status_next (status, next_attempt_at)
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INT NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status_code INT DEFAULT NULL,
+	headers TEXT,
+	body MEDIUMBLOB,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, idempotency_key),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_created (created_at)
+);
+
+CREATE TABLE IF NOT EXISTS interactions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	contact_id INT NOT NULL,
+	type VARCHAR(16) NOT NULL,
+	occurred_at DATETIME NOT NULL,
+	note TEXT,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE,
+	INDEX idx_contact_occurred (contact_id, occurred_at),
+	INDEX idx_user_occurred (user_id, occurred_at)
+);
+
+CREATE TABLE IF NOT EXISTS contact_tombstones (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	contact_id INT NOT NULL,
+	deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_deleted (user_id, deleted_at)
+);
+
+CREATE TABLE IF NOT EXISTS share_links (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	token VARCHAR(36) NOT NULL UNIQUE,
+	contact_id INT NOT NULL,
+	user_id INT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_token (token),
+	INDEX idx_expires_at (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS backups (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	mode VARCHAR(16) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	written INT NOT NULL DEFAULT 0,
+	deleted INT NOT NULL DEFAULT 0,
+	unchanged INT NOT NULL DEFAULT 0,
+	total INT NOT NULL DEFAULT 0,
+	checksum CHAR(64) DEFAULT NULL,
+	encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+	size_bytes BIGINT NOT NULL DEFAULT 0,
+	started_at DATETIME NOT NULL,
+	completed_at DATETIME DEFAULT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_started (user_id, started_at)
+);
+
+CREATE TABLE IF NOT EXISTS backup_keys (
+	user_id INT PRIMARY KEY,
+	salt VARBINARY(16) NOT NULL,
+	verifier CHAR(64) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id CHAR(36) PRIMARY KEY,
+	user_id INT NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	progress INT NOT NULL DEFAULT 0,
+	total INT NOT NULL DEFAULT 0,
+	error TEXT DEFAULT NULL,
+	result JSON DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	completed_at DATETIME DEFAULT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_type_status (user_id, type, status)
+);
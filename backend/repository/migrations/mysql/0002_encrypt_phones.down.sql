@@ -0,0 +1,4 @@
+-- Phone numbers stay encrypted, since decrypting them takes the data key
+ALTER TABLE contacts
+	DROP INDEX idx_user_phone_hmac,
+	DROP COLUMN phone_hmac;
@@ -0,0 +1,6 @@
+-- Phone numbers are stored encrypted, which takes more room than the number
+-- itself, alongside a blind index to match them by
+ALTER TABLE contacts
+	MODIFY phone VARCHAR(512) NOT NULL,
+	ADD COLUMN phone_hmac CHAR(64) DEFAULT NULL AFTER phone,
+	ADD INDEX idx_user_phone_hmac (user_id, phone_hmac);
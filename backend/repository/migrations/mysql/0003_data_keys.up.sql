@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS data_keys (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	wrapped_key VARBINARY(1024) NOT NULL,
+	kms_key_version VARCHAR(512) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
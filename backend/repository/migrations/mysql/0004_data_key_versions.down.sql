@@ -0,0 +1,7 @@
+-- Phone numbers re-encrypted to a newer data key stay so, and can only be
+-- read again with that key
+ALTER TABLE data_keys DROP COLUMN active_at;
+
+ALTER TABLE contacts
+	DROP INDEX idx_phone_key_version,
+	DROP COLUMN phone_key_version;
@@ -0,0 +1,14 @@
+-- Contacts record the version of the data key their phone number is
+-- encrypted with, so rows can be re-encrypted to a newer version after a
+-- rotation. Numbers encrypted so far used the first version.
+ALTER TABLE contacts
+	ADD COLUMN phone_key_version INT DEFAULT NULL AFTER phone_hmac,
+	ADD INDEX idx_phone_key_version (phone_key_version);
+
+UPDATE contacts SET phone_key_version = 1, updated_at = updated_at WHERE phone_hmac IS NOT NULL;
+
+-- A new data key starts encrypting at active_at, once every server has
+-- loaded it
+ALTER TABLE data_keys ADD COLUMN active_at TIMESTAMP NULL DEFAULT NULL;
+
+UPDATE data_keys SET active_at = created_at;
@@ -0,0 +1,16 @@
+-- Security-relevant account activity. Events are only ever inserted, and
+-- deleted once older than AUDIT_RETENTION. user_id has no foreign key so
+-- events outlive the account they describe, and is NULL for failed logins
+-- to unknown emails.
+CREATE TABLE IF NOT EXISTS audit_events (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT DEFAULT NULL,
+	action VARCHAR(64) NOT NULL,
+	ip VARCHAR(45) NOT NULL DEFAULT '',
+	user_agent VARCHAR(255) NOT NULL DEFAULT '',
+	device_id VARCHAR(64) NOT NULL DEFAULT '',
+	details TEXT DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	INDEX idx_user_id (user_id, id),
+	INDEX idx_created_at (created_at)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+	DROP INDEX idx_deletion_scheduled_at,
+	DROP COLUMN deletion_scheduled_at;
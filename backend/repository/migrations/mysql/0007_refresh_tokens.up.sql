@@ -0,0 +1,17 @@
+-- Refresh tokens, stored as SHA-256 hashes. Each token can be used once:
+-- using it issues its successor in the same family, and using it again
+-- revokes the whole family, since only a stolen copy would be replayed.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	family_id VARCHAR(36) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	device_id VARCHAR(64) NOT NULL DEFAULT '',
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME DEFAULT NULL,
+	revoked_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_family_id (family_id),
+	INDEX idx_expires_at (expires_at)
+);
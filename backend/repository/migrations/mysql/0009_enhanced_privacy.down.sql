@@ -0,0 +1,12 @@
+ALTER TABLE reminders
+	DROP COLUMN note_key_version,
+	MODIFY note VARCHAR(500) NOT NULL DEFAULT '';
+
+ALTER TABLE interactions DROP COLUMN note_key_version;
+
+ALTER TABLE contacts
+	DROP COLUMN tag_index,
+	DROP COLUMN tags_key_version,
+	MODIFY tags VARCHAR(255) DEFAULT '';
+
+ALTER TABLE users DROP COLUMN enhanced_privacy;
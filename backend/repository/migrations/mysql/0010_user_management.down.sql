@@ -0,0 +1,4 @@
+ALTER TABLE users
+	DROP COLUMN token_generation,
+	DROP COLUMN password_reset_required,
+	DROP COLUMN suspended_at;
@@ -0,0 +1,8 @@
+-- Admins can suspend an account, which refuses its logins and requests until
+-- it is reactivated, and force its owner to choose a new password. Both sign
+-- the account out everywhere by incrementing token_generation: access tokens
+-- carry the generation they were issued in and are refused once it is past.
+ALTER TABLE users
+	ADD COLUMN suspended_at DATETIME DEFAULT NULL,
+	ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN token_generation INT NOT NULL DEFAULT 0;
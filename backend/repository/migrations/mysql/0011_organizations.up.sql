@@ -0,0 +1,22 @@
+-- Organizations, whose members share an address book. Its contacts are
+-- kept by an account of the organization's own, which no one logs in to,
+-- so they are stored, searched and backed up as a user's are.
+CREATE TABLE IF NOT EXISTS organizations (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	account_id INT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (account_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The users in each organization, with their role: owner, admin or member
+CREATE TABLE IF NOT EXISTS organization_members (
+	organization_id INT NOT NULL,
+	user_id INT NOT NULL,
+	role VARCHAR(16) NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (organization_id, user_id),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	INDEX idx_user_id (user_id)
+);
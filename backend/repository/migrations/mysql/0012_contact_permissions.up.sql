@@ -0,0 +1,15 @@
+-- The contacts of an organization shared with its members who aren't owners
+-- or admins, who see none otherwise. A grant is on one contact or on the
+-- contacts with a tag, and lets the member read them or also change them.
+CREATE TABLE IF NOT EXISTS contact_permissions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	organization_id INT NOT NULL,
+	user_id INT NOT NULL,
+	contact_id INT NULL,
+	tag VARCHAR(50) NULL,
+	access VARCHAR(8) NOT NULL,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (organization_id, user_id) REFERENCES organization_members(organization_id, user_id) ON DELETE CASCADE,
+	FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE,
+	INDEX idx_organization_user (organization_id, user_id)
+);
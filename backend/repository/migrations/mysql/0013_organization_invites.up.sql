@@ -0,0 +1,15 @@
+-- Invitations to join an organization, emailed with a signed link that
+-- names the invite. Each is accepted or declined once; inviting the same
+-- email again replaces it.
+CREATE TABLE IF NOT EXISTS organization_invites (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	organization_id INT NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(16) NOT NULL,
+	invited_by INT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	UNIQUE KEY idx_organization_email (organization_id, email),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+	FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL
+);
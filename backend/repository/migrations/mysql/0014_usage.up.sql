@@ -0,0 +1,25 @@
+-- Usage metered as it happens, such as API calls and backups, counted per
+-- account and UTC day until the day is rolled up
+CREATE TABLE IF NOT EXISTS usage_meter (
+	user_id INT NOT NULL,
+	day DATE NOT NULL,
+	metric VARCHAR(32) NOT NULL,
+	amount BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, day, metric),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Each account's usage per UTC day: what was metered, and the contacts and
+-- backup it kept when the day was rolled up
+CREATE TABLE IF NOT EXISTS usage_daily (
+	user_id INT NOT NULL,
+	day DATE NOT NULL,
+	api_calls BIGINT NOT NULL DEFAULT 0,
+	backups INT NOT NULL DEFAULT 0,
+	backup_bytes BIGINT NOT NULL DEFAULT 0,
+	contacts INT NOT NULL DEFAULT 0,
+	storage_bytes BIGINT NOT NULL DEFAULT 0,
+	backup_storage_bytes BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, day),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
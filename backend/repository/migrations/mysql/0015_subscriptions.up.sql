@@ -0,0 +1,13 @@
+-- Each account's billing plan and the Stripe subscription paying for it.
+-- Accounts without a row are on the free plan.
+CREATE TABLE IF NOT EXISTS subscriptions (
+	user_id INT PRIMARY KEY,
+	plan VARCHAR(16) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	stripe_customer_id VARCHAR(255) NULL,
+	stripe_subscription_id VARCHAR(255) NULL,
+	current_period_end DATETIME NULL,
+	updated_at DATETIME NOT NULL,
+	UNIQUE KEY idx_stripe_customer (stripe_customer_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- Admins' impersonations of users, to debug their issues. The tokens issued
+-- for one name it, so it can be ended early, and its owner is emailed once
+-- it is over.
+CREATE TABLE IF NOT EXISTS impersonations (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	admin_id INT NULL,
+	reason VARCHAR(500) NOT NULL,
+	requests INT NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	ended_at DATETIME NULL,
+	notified_at DATETIME NULL,
+	INDEX idx_impersonations_notified (notified_at, expires_at),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS contact_sync_links;
+DROP TABLE IF EXISTS contact_syncs;
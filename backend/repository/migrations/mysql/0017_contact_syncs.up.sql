@@ -0,0 +1,37 @@
+-- Users' connections to the contact providers their address book is kept in
+-- sync with. The OAuth token is encrypted with the data key, and the sync
+-- token is the provider's cursor of the changes already pulled. syncing_at
+-- is set while a server is syncing, so syncs of a connection don't overlap.
+CREATE TABLE IF NOT EXISTS contact_syncs (
+	user_id INT NOT NULL,
+	provider VARCHAR(20) NOT NULL,
+	account VARCHAR(255) NOT NULL,
+	token TEXT NOT NULL,
+	token_key_version INT NULL,
+	sync_token TEXT NULL,
+	status VARCHAR(30) NOT NULL,
+	error VARCHAR(500) NULL,
+	syncing_at DATETIME NULL,
+	last_synced_at DATETIME NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, provider),
+	INDEX idx_contact_syncs_due (status, last_synced_at),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The provider's copy of each synced contact, with its version on both
+-- sides as of the last sync. A contact deleted locally leaves its link
+-- without a contact, so the deletion is pushed.
+CREATE TABLE IF NOT EXISTS contact_sync_links (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	provider VARCHAR(20) NOT NULL,
+	contact_id INT NULL,
+	remote_id VARCHAR(255) NOT NULL,
+	etag VARCHAR(255) NOT NULL,
+	contact_version INT NOT NULL,
+	UNIQUE KEY idx_contact_sync_links_remote (user_id, provider, remote_id),
+	INDEX idx_contact_sync_links_contact (contact_id),
+	FOREIGN KEY (user_id, provider) REFERENCES contact_syncs(user_id, provider) ON DELETE CASCADE,
+	FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE SET NULL
+);
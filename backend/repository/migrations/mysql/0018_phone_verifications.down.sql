@@ -0,0 +1,6 @@
+ALTER TABLE contacts
+	DROP COLUMN phone_verified_at,
+	DROP COLUMN phone_country,
+	DROP COLUMN phone_carrier,
+	DROP COLUMN phone_line_type,
+	DROP COLUMN phone_valid;
@@ -0,0 +1,14 @@
+-- The phone numbers users blocked, flagged when they are looked up or added
+-- as a contact. Numbers are encrypted with the data key like contacts' and
+-- matched by the blind index of their normalized form.
+CREATE TABLE IF NOT EXISTS blocked_numbers (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	phone TEXT NOT NULL,
+	phone_hmac CHAR(64) NOT NULL,
+	phone_key_version INT NOT NULL,
+	label VARCHAR(100) NOT NULL,
+	created_at DATETIME NOT NULL,
+	UNIQUE KEY idx_blocked_numbers_phone (user_id, phone_hmac),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
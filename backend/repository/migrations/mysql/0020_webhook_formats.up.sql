@@ -0,0 +1,3 @@
+-- The shape of the payloads a webhook is sent: standard webhooks get the
+-- event with its data, and Zapier's REST hook subscriptions the data alone.
+ALTER TABLE webhooks ADD COLUMN format VARCHAR(10) NOT NULL DEFAULT 'standard';
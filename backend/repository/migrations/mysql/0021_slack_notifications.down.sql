@@ -0,0 +1,7 @@
+ALTER TABLE notification_settings
+	DROP COLUMN slack_channel,
+	DROP COLUMN slack_bot_token,
+	DROP COLUMN slack_webhook_url,
+	DROP COLUMN digest_slack,
+	DROP COLUMN digest_email,
+	DROP COLUMN birthday_slack;
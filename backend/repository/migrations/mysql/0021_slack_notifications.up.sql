@@ -0,0 +1,11 @@
+-- Slack as a channel for birthday reminders and digests. Messages are posted
+-- through the incoming webhook in slack_webhook_url, or by the bot with
+-- slack_bot_token to slack_channel. digest_email defaults to TRUE so users
+-- already subscribed keep their digest email.
+ALTER TABLE notification_settings
+	ADD COLUMN birthday_slack BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN digest_email BOOLEAN NOT NULL DEFAULT TRUE,
+	ADD COLUMN digest_slack BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN slack_webhook_url VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN slack_bot_token VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN slack_channel VARCHAR(80) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE interactions
+	DROP COLUMN call_duration,
+	DROP COLUMN call_direction;
@@ -0,0 +1,13 @@
+-- The phone numbers users text contacts to save from. A user asks for a link
+-- code, whose hash is kept in code_hash until code_expires_at, and texts it
+-- from their phone, which links the number and clears the code. phone is
+-- NULL until then; a number is linked to one user at a time.
+CREATE TABLE IF NOT EXISTS sms_contact_numbers (
+	user_id INT PRIMARY KEY,
+	phone VARCHAR(16) UNIQUE,
+	code_hash CHAR(64),
+	code_expires_at DATETIME,
+	linked_at DATETIME,
+	INDEX idx_sms_contact_numbers_code (code_hash),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE contacts
+	DROP INDEX idx_user_updated,
+	DROP COLUMN version;
@@ -0,0 +1,6 @@
+-- Contacts' versions, which writes carrying an older one are rejected with,
+-- and the index changes are synced from. Both were added to the contacts
+-- table after the databases the first migration adopts were created.
+ALTER TABLE contacts
+	ADD COLUMN version INT NOT NULL DEFAULT 1,
+	ADD INDEX idx_user_updated (user_id, updated_at);
@@ -0,0 +1,10 @@
+-- The authorization codes IFTTT trades for a user's tokens when the user
+-- connects IFTTT. Only the hash of a code is kept, until expires_at or until
+-- IFTTT uses it, along with the redirect URI it was issued to.
+CREATE TABLE IF NOT EXISTS ifttt_authorization_codes (
+	code_hash CHAR(64) PRIMARY KEY,
+	user_id INT NOT NULL,
+	redirect_uri VARCHAR(2048) NOT NULL,
+	expires_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS backup_keys;
+DROP TABLE IF EXISTS backups;
+DROP TABLE IF EXISTS share_links;
+DROP TABLE IF EXISTS contact_tombstones;
+DROP TABLE IF EXISTS interactions;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS calendar_feeds;
+DROP TABLE IF EXISTS notification_settings;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS users;
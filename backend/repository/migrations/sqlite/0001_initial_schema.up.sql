@@ -0,0 +1,232 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS users_updated_at AFTER UPDATE ON users
+FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at BEGIN
+	UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS contacts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	phone VARCHAR(255) NOT NULL,
+	encrypted_phone VARCHAR(255) NOT NULL,
+	tags VARCHAR(255) DEFAULT '',
+	last_interaction DATETIME DEFAULT NULL,
+	birthday DATE DEFAULT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_contacts_birthday ON contacts (birthday);
+
+CREATE TRIGGER IF NOT EXISTS contacts_updated_at AFTER UPDATE ON contacts
+FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at BEGIN
+	UPDATE contacts SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS devices (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_id VARCHAR(64) NOT NULL,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	last_sync_token VARCHAR(64) DEFAULT NULL,
+	last_sync_at TIMESTAMP NULL DEFAULT NULL,
+	push_token VARCHAR(512) DEFAULT NULL,
+	last_seen_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_push_token ON devices (push_token);
+
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	birthday_email BOOLEAN NOT NULL DEFAULT FALSE,
+	birthday_push BOOLEAN NOT NULL DEFAULT FALSE,
+	birthday_sms BOOLEAN NOT NULL DEFAULT FALSE,
+	reminder_email BOOLEAN NOT NULL DEFAULT FALSE,
+	reminder_push BOOLEAN NOT NULL DEFAULT TRUE,
+	reminder_sms BOOLEAN NOT NULL DEFAULT FALSE,
+	sms_number VARCHAR(16) NOT NULL DEFAULT '',
+	digest VARCHAR(16) NOT NULL DEFAULT 'off',
+	reminder_hour INTEGER DEFAULT NULL,
+	birthday_days_ahead INTEGER NOT NULL DEFAULT 7,
+	quiet_hours_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	quiet_hours_start INTEGER NOT NULL DEFAULT 22,
+	quiet_hours_end INTEGER NOT NULL DEFAULT 7,
+	timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+	birthday_reminder_sent_on DATE DEFAULT NULL,
+	digest_sent_on DATE DEFAULT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS notification_settings_updated_at AFTER UPDATE ON notification_settings
+FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at BEGIN
+	UPDATE notification_settings SET updated_at = CURRENT_TIMESTAMP WHERE user_id = NEW.user_id;
+END;
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(64) NOT NULL,
+	events VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_type VARCHAR(32) NOT NULL,
+	payload TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	response_status INTEGER DEFAULT NULL,
+	error TEXT,
+	next_attempt_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS reminders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	contact_id INTEGER NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	note VARCHAR(500) NOT NULL DEFAULT '',
+	due_at DATETIME NOT NULL,
+	repeat_every INTEGER DEFAULT NULL,
+	repeat_unit VARCHAR(8) DEFAULT NULL,
+	status VARCHAR(16) NOT NULL,
+	notified_at DATETIME DEFAULT NULL,
+	completed_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_user_status_due ON reminders (user_id, status, due_at);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_status_due ON reminders (status, due_at);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	channel VARCHAR(16) NOT NULL,
+	kind VARCHAR(32) NOT NULL,
+	recipient VARCHAR(255) NOT NULL DEFAULT '',
+	subject VARCHAR(255) NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	data TEXT,
+	status VARCHAR(16) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	next_attempt_at DATETIME DEFAULT NULL,
+	sent_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_user ON notification_deliveries (user_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_status_next ON notification_deliveries (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	idempotency_key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status_code INTEGER DEFAULT NULL,
+	headers TEXT,
+	body BLOB,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS interactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	contact_id INTEGER NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	type VARCHAR(16) NOT NULL,
+	occurred_at DATETIME NOT NULL,
+	note TEXT,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_interactions_contact_occurred ON interactions (contact_id, occurred_at);
+
+CREATE INDEX IF NOT EXISTS idx_interactions_user_occurred ON interactions (user_id, occurred_at);
+
+CREATE TABLE IF NOT EXISTS contact_tombstones (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	contact_id INTEGER NOT NULL,
+	deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_tombstones_user_deleted ON contact_tombstones (user_id, deleted_at);
+
+CREATE TABLE IF NOT EXISTS share_links (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token VARCHAR(36) NOT NULL UNIQUE,
+	contact_id INTEGER NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	expires_at DATETIME NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_expires_at ON share_links (expires_at);
+
+CREATE TABLE IF NOT EXISTS backups (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	mode VARCHAR(16) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	written INTEGER NOT NULL DEFAULT 0,
+	deleted INTEGER NOT NULL DEFAULT 0,
+	unchanged INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0,
+	checksum CHAR(64) DEFAULT NULL,
+	encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+	size_bytes INTEGER NOT NULL DEFAULT 0,
+	started_at DATETIME NOT NULL,
+	completed_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_backups_user_started ON backups (user_id, started_at);
+
+CREATE TABLE IF NOT EXISTS backup_keys (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	salt BLOB NOT NULL,
+	verifier CHAR(64) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id CHAR(36) PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(32) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	progress INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0,
+	error TEXT DEFAULT NULL,
+	result TEXT DEFAULT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	completed_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_type_status ON jobs (user_id, type, status);
@@ -0,0 +1,4 @@
+-- Phone numbers stay encrypted, since decrypting them takes the data key
+DROP INDEX IF EXISTS idx_contacts_user_phone_hmac;
+
+ALTER TABLE contacts DROP COLUMN phone_hmac;
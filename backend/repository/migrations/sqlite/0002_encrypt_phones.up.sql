@@ -0,0 +1,6 @@
+-- Phone numbers are stored encrypted alongside a blind index to match them
+-- by. SQLite doesn't enforce VARCHAR lengths, so the phone column holds the
+-- longer ciphertext as it is.
+ALTER TABLE contacts ADD COLUMN phone_hmac CHAR(64) DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_contacts_user_phone_hmac ON contacts (user_id, phone_hmac);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS data_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	wrapped_key BLOB NOT NULL,
+	kms_key_version VARCHAR(512) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+-- Phone numbers re-encrypted to a newer data key stay so, and can only be
+-- read again with that key
+ALTER TABLE data_keys DROP COLUMN active_at;
+
+DROP INDEX IF EXISTS idx_contacts_phone_key_version;
+
+ALTER TABLE contacts DROP COLUMN phone_key_version;
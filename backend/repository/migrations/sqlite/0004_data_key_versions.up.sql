@@ -0,0 +1,14 @@
+-- Contacts record the version of the data key their phone number is
+-- encrypted with, so rows can be re-encrypted to a newer version after a
+-- rotation. Numbers encrypted so far used the first version.
+ALTER TABLE contacts ADD COLUMN phone_key_version INTEGER DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_contacts_phone_key_version ON contacts (phone_key_version);
+
+UPDATE contacts SET phone_key_version = 1 WHERE phone_hmac IS NOT NULL;
+
+-- A new data key starts encrypting at active_at, once every server has
+-- loaded it
+ALTER TABLE data_keys ADD COLUMN active_at TIMESTAMP DEFAULT NULL;
+
+UPDATE data_keys SET active_at = created_at;
@@ -0,0 +1,18 @@
+-- Security-relevant account activity. Events are only ever inserted, and
+-- deleted once older than AUDIT_RETENTION. user_id has no foreign key so
+-- events outlive the account they describe, and is NULL for failed logins
+-- to unknown emails.
+CREATE TABLE IF NOT EXISTS audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER DEFAULT NULL,
+	action VARCHAR(64) NOT NULL,
+	ip VARCHAR(45) NOT NULL DEFAULT '',
+	user_agent VARCHAR(255) NOT NULL DEFAULT '',
+	device_id VARCHAR(64) NOT NULL DEFAULT '',
+	details TEXT DEFAULT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events (user_id, id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
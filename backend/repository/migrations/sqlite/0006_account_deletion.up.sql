@@ -0,0 +1,5 @@
+-- An account whose owner asked for it to be erased is deleted, with all its
+-- data, once deletion_scheduled_at passes, unless the request is cancelled
+ALTER TABLE users ADD COLUMN deletion_scheduled_at DATETIME DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users (deletion_scheduled_at);
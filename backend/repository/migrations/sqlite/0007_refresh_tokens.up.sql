@@ -0,0 +1,18 @@
+-- Refresh tokens, stored as SHA-256 hashes. Each token can be used once:
+-- using it issues its successor in the same family, and using it again
+-- revokes the whole family, since only a stolen copy would be replayed.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id VARCHAR(36) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	device_id VARCHAR(64) NOT NULL DEFAULT '',
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME DEFAULT NULL,
+	revoked_at DATETIME DEFAULT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
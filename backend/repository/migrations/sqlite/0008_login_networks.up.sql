@@ -0,0 +1,9 @@
+-- The networks each user has logged in from, an IPv4 /24 or IPv6 /48, so a
+-- login from somewhere new can be flagged to them
+CREATE TABLE IF NOT EXISTS login_networks (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	network VARCHAR(64) NOT NULL,
+	first_seen_at DATETIME NOT NULL,
+	last_seen_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, network)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE reminders DROP COLUMN note_key_version;
+
+ALTER TABLE interactions DROP COLUMN note_key_version;
+
+ALTER TABLE contacts DROP COLUMN tag_index;
+
+ALTER TABLE contacts DROP COLUMN tags_key_version;
+
+ALTER TABLE users DROP COLUMN enhanced_privacy;
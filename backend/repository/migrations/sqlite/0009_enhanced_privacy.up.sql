@@ -0,0 +1,14 @@
+-- Users who enable enhanced privacy have their contacts' tags and the notes
+-- of their interactions and reminders encrypted with the data key, like
+-- phone numbers. A NULL key version marks a value stored in the clear.
+-- Encrypted tags are matched by tag_index, the comma-separated blind
+-- indexes of each tag.
+ALTER TABLE users ADD COLUMN enhanced_privacy BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE contacts ADD COLUMN tags_key_version INTEGER DEFAULT NULL;
+
+ALTER TABLE contacts ADD COLUMN tag_index TEXT DEFAULT NULL;
+
+ALTER TABLE interactions ADD COLUMN note_key_version INTEGER DEFAULT NULL;
+
+ALTER TABLE reminders ADD COLUMN note_key_version INTEGER DEFAULT NULL;
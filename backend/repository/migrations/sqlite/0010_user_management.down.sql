@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN token_generation;
+
+ALTER TABLE users DROP COLUMN password_reset_required;
+
+ALTER TABLE users DROP COLUMN suspended_at;
@@ -0,0 +1,20 @@
+-- Organizations, whose members share an address book. Its contacts are
+-- kept by an account of the organization's own, which no one logs in to,
+-- so they are stored, searched and backed up as a user's are.
+CREATE TABLE IF NOT EXISTS organizations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(100) NOT NULL,
+	account_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+	created_at DATETIME NOT NULL
+);
+
+-- The users in each organization, with their role: owner, admin or member
+CREATE TABLE IF NOT EXISTS organization_members (
+	organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(16) NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
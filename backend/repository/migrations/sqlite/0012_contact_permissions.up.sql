@@ -0,0 +1,15 @@
+-- The contacts of an organization shared with its members who aren't owners
+-- or admins, who see none otherwise. A grant is on one contact or on the
+-- contacts with a tag, and lets the member read them or also change them.
+CREATE TABLE IF NOT EXISTS contact_permissions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	contact_id INTEGER NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	tag VARCHAR(50) NULL,
+	access VARCHAR(8) NOT NULL,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (organization_id, user_id) REFERENCES organization_members(organization_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_permissions_organization_user ON contact_permissions (organization_id, user_id);
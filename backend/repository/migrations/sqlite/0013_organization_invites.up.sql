@@ -0,0 +1,13 @@
+-- Invitations to join an organization, emailed with a signed link that
+-- names the invite. Each is accepted or declined once; inviting the same
+-- email again replaces it.
+CREATE TABLE IF NOT EXISTS organization_invites (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(16) NOT NULL,
+	invited_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	UNIQUE (organization_id, email)
+);
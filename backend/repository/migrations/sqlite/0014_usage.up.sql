@@ -0,0 +1,23 @@
+-- Usage metered as it happens, such as API calls and backups, counted per
+-- account and UTC day until the day is rolled up
+CREATE TABLE IF NOT EXISTS usage_meter (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	metric VARCHAR(32) NOT NULL,
+	amount BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, day, metric)
+);
+
+-- Each account's usage per UTC day: what was metered, and the contacts and
+-- backup it kept when the day was rolled up
+CREATE TABLE IF NOT EXISTS usage_daily (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	api_calls BIGINT NOT NULL DEFAULT 0,
+	backups INTEGER NOT NULL DEFAULT 0,
+	backup_bytes BIGINT NOT NULL DEFAULT 0,
+	contacts INTEGER NOT NULL DEFAULT 0,
+	storage_bytes BIGINT NOT NULL DEFAULT 0,
+	backup_storage_bytes BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, day)
+);
@@ -0,0 +1,15 @@
+-- Admins' impersonations of users, to debug their issues. The tokens issued
+-- for one name it, so it can be ended early, and its owner is emailed once
+-- it is over.
+CREATE TABLE IF NOT EXISTS impersonations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	admin_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+	reason VARCHAR(500) NOT NULL,
+	requests INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	ended_at DATETIME NULL,
+	notified_at DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS idx_impersonations_notified ON impersonations (notified_at, expires_at);
@@ -0,0 +1,35 @@
+-- Users' connections to the contact providers their address book is kept in
+-- sync with. The OAuth token is encrypted with the data key, and the sync
+-- token is the provider's cursor of the changes already pulled. syncing_at
+-- is set while a server is syncing, so syncs of a connection don't overlap.
+CREATE TABLE IF NOT EXISTS contact_syncs (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider VARCHAR(20) NOT NULL,
+	account VARCHAR(255) NOT NULL,
+	token TEXT NOT NULL,
+	token_key_version INTEGER NULL,
+	sync_token TEXT NULL,
+	status VARCHAR(30) NOT NULL,
+	error VARCHAR(500) NULL,
+	syncing_at DATETIME NULL,
+	last_synced_at DATETIME NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, provider)
+);
+CREATE INDEX IF NOT EXISTS idx_contact_syncs_due ON contact_syncs (status, last_synced_at);
+
+-- The provider's copy of each synced contact, with its version on both
+-- sides as of the last sync. A contact deleted locally leaves its link
+-- without a contact, so the deletion is pushed.
+CREATE TABLE IF NOT EXISTS contact_sync_links (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	provider VARCHAR(20) NOT NULL,
+	contact_id INTEGER NULL REFERENCES contacts(id) ON DELETE SET NULL,
+	remote_id VARCHAR(255) NOT NULL,
+	etag VARCHAR(255) NOT NULL,
+	contact_version INTEGER NOT NULL,
+	FOREIGN KEY (user_id, provider) REFERENCES contact_syncs(user_id, provider) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_sync_links_remote ON contact_sync_links (user_id, provider, remote_id);
+CREATE INDEX IF NOT EXISTS idx_contact_sync_links_contact ON contact_sync_links (contact_id);
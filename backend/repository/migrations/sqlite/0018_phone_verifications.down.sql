@@ -0,0 +1,9 @@
+ALTER TABLE contacts DROP COLUMN phone_verified_at;
+
+ALTER TABLE contacts DROP COLUMN phone_country;
+
+ALTER TABLE contacts DROP COLUMN phone_carrier;
+
+ALTER TABLE contacts DROP COLUMN phone_line_type;
+
+ALTER TABLE contacts DROP COLUMN phone_valid;
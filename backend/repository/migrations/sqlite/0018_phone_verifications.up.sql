@@ -0,0 +1,13 @@
+-- The outcome of the last lookup of a contact's phone number at the phone
+-- verification provider. It describes the number the contact had then, and
+-- is cleared when the number changes. phone_verified_at is NULL for numbers
+-- never verified.
+ALTER TABLE contacts ADD COLUMN phone_valid BOOLEAN DEFAULT NULL;
+
+ALTER TABLE contacts ADD COLUMN phone_line_type VARCHAR(30) DEFAULT NULL;
+
+ALTER TABLE contacts ADD COLUMN phone_carrier VARCHAR(100) DEFAULT NULL;
+
+ALTER TABLE contacts ADD COLUMN phone_country VARCHAR(2) DEFAULT NULL;
+
+ALTER TABLE contacts ADD COLUMN phone_verified_at DATETIME DEFAULT NULL;
@@ -0,0 +1,13 @@
+-- The phone numbers users blocked, flagged when they are looked up or added
+-- as a contact. Numbers are encrypted with the data key like contacts' and
+-- matched by the blind index of their normalized form.
+CREATE TABLE IF NOT EXISTS blocked_numbers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	phone TEXT NOT NULL,
+	phone_hmac CHAR(64) NOT NULL,
+	phone_key_version INTEGER NOT NULL,
+	label VARCHAR(100) NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blocked_numbers_phone ON blocked_numbers (user_id, phone_hmac);
@@ -0,0 +1,11 @@
+ALTER TABLE notification_settings DROP COLUMN slack_channel;
+
+ALTER TABLE notification_settings DROP COLUMN slack_bot_token;
+
+ALTER TABLE notification_settings DROP COLUMN slack_webhook_url;
+
+ALTER TABLE notification_settings DROP COLUMN digest_slack;
+
+ALTER TABLE notification_settings DROP COLUMN digest_email;
+
+ALTER TABLE notification_settings DROP COLUMN birthday_slack;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS contact_profiles;
+
+ALTER TABLE users DROP COLUMN contact_enrichment;
@@ -0,0 +1,22 @@
+-- Details of contacts found from their email addresses. photo_source and
+-- company_source are "user" for details the user entered, or the
+-- enrichment provider that suggested them; the suggestions the user last
+-- rejected are kept so they aren't suggested again. Emails are encrypted
+-- with the data key like phone numbers. enriched_at is NULL until the
+-- provider was asked about the current email.
+ALTER TABLE users ADD COLUMN contact_enrichment BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS contact_profiles (
+	contact_id INTEGER PRIMARY KEY REFERENCES contacts(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	email_key_version INTEGER DEFAULT NULL,
+	photo_url VARCHAR(500) NOT NULL DEFAULT '',
+	photo_source VARCHAR(20) NOT NULL DEFAULT '',
+	rejected_photo_url VARCHAR(500) NOT NULL DEFAULT '',
+	company VARCHAR(200) NOT NULL DEFAULT '',
+	company_source VARCHAR(20) NOT NULL DEFAULT '',
+	rejected_company VARCHAR(200) NOT NULL DEFAULT '',
+	enriched_at DATETIME DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_contact_profiles_user ON contact_profiles (user_id);
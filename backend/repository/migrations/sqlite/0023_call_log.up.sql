@@ -0,0 +1,7 @@
+-- The direction and duration in seconds of calls imported from a phone's
+-- call log. Both are empty for interactions recorded by the user, and
+-- imported calls are matched on contact_id, occurred_at and call_direction
+-- so a call sent again isn't recorded twice.
+ALTER TABLE interactions ADD COLUMN call_direction VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE interactions ADD COLUMN call_duration INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_contacts_user_updated;
+
+ALTER TABLE contacts DROP COLUMN version;
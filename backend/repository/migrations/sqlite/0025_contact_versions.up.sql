@@ -0,0 +1,6 @@
+-- Contacts' versions, which writes carrying an older one are rejected with,
+-- and the index changes are synced from. Both were added to the contacts
+-- table after the databases the first migration adopts were created.
+ALTER TABLE contacts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_contacts_user_updated ON contacts (user_id, updated_at);
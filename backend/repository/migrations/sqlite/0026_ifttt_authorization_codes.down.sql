@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ifttt_authorization_codes;
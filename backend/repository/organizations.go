@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"phonesaver-backend/models"
+)
+
+// OrganizationRepository stores organizations and their members. An
+// organization's contacts are kept by its account, models.Organization's
+// AccountID, with the ContactRepository.
+type OrganizationRepository interface {
+	// Create creates an organization, with the account that keeps its
+	// contacts, and makes ownerID its owner
+	Create(ctx context.Context, name string, ownerID int) (models.Organization, error)
+	// ListByMember returns the page of the organizations a user is a member
+	// of, with their role in each, oldest first, sorted by ID
+	ListByMember(ctx context.Context, userID int, page Page) ([]models.Organization, error)
+	// CountByMember returns the number of organizations a user is a member
+	// of
+	CountByMember(ctx context.Context, userID int) (int, error)
+	// Get returns an organization, without a role. ErrNotFound is returned
+	// if there is no such organization.
+	Get(ctx context.Context, orgID int) (models.Organization, error)
+	// Member returns an organization with the role of one of its members.
+	// ErrNotFound is returned if there is no such organization or the user
+	// isn't a member.
+	Member(ctx context.Context, orgID, userID int) (models.Organization, error)
+	// Rename changes an organization's name
+	Rename(ctx context.Context, orgID int, name string) error
+	// ListMembers returns the page of an organization's members, in the
+	// order they joined, sorted by when they joined and their user ID
+	ListMembers(ctx context.Context, orgID int, page Page) ([]models.OrganizationMember, error)
+	// CountMembers returns the number of an organization's members
+	CountMembers(ctx context.Context, orgID int) (int, error)
+	// AddMember adds a user to an organization with a role. ErrDuplicate is
+	// returned if they are already a member.
+	AddMember(ctx context.Context, orgID, userID int, role string) error
+	// SetRole changes a member's role
+	SetRole(ctx context.Context, orgID, userID int, role string) error
+	// RemoveMember removes a user from an organization and reports whether
+	// they were a member
+	RemoveMember(ctx context.Context, orgID, userID int) (bool, error)
+	// ListSoleOwned returns the organizations whose only owner is a user,
+	// which can't be kept without them
+	ListSoleOwned(ctx context.Context, userID int) ([]models.Organization, error)
+	// CreateInvite stores an invitation to an organization, replacing the
+	// one the email had
+	CreateInvite(ctx context.Context, invite *models.OrganizationInvite) error
+	// GetInvite returns an invitation. ErrNotFound is returned if there is
+	// no such invitation, or it was replaced, accepted or declined.
+	GetInvite(ctx context.Context, id int) (models.OrganizationInvite, error)
+	// DeleteInvite removes an invitation and reports whether there was one,
+	// so that it is only accepted or declined once
+	DeleteInvite(ctx context.Context, id int) (bool, error)
+}
+
+// Roles of organization members. Owners and admins manage the members, and
+// only owners can make owners or delete the organization; every member
+// works with its contacts.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// organizationColumns are the columns read by scanOrganization, with the
+// organizations table aliased as o and organization_members as m
+const organizationColumns = `o.id, o.name, m.role, o.account_id, o.created_at,
+	(SELECT COUNT(*) FROM organization_members c WHERE c.organization_id = o.id)`
+
+// scanOrganization reads an organization row selected with
+// organizationColumns
+func scanOrganization(row RowScanner) (models.Organization, error) {
+	var org models.Organization
+	err := row.Scan(&org.ID, &org.Name, &org.Role, &org.AccountID, &org.CreatedAt, &org.Members)
+	return org, err
+}
+
+// sqlOrganizations is the OrganizationRepository backed by the
+// organizations and organization_members tables
+type sqlOrganizations struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+// Create adds the organization's account without a password, which no one
+// can log in to, and an email that can't be signed up with
+func (r *sqlOrganizations) Create(ctx context.Context, name string, ownerID int) (models.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO users (email, password) VALUES (?, '')", "organization:"+uuid.NewString())
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to create organization account: %v", err)
+	}
+	accountID, err := result.LastInsertId()
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+
+	org := models.Organization{Name: name, Role: RoleOwner, Members: 1, CreatedAt: time.Now().UTC().Truncate(time.Second), AccountID: int(accountID)}
+	result, err = tx.ExecContext(ctx,
+		"INSERT INTO organizations (name, account_id, created_at) VALUES (?, ?, ?)", org.Name, org.AccountID, org.CreatedAt,
+	)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to create organization: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	org.ID = int(id)
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)",
+		org.ID, ownerID, RoleOwner, org.CreatedAt,
+	)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("failed to add owner: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Organization{}, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return org, nil
+}
+
+func (r *sqlOrganizations) ListByMember(ctx context.Context, userID int, page Page) ([]models.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	after, afterArgs := page.Condition(false, "o.id")
+	limit, limitArgs := page.LimitClause()
+	return r.query(ctx,
+		"SELECT "+organizationColumns+" FROM organizations o JOIN organization_members m ON m.organization_id = o.id WHERE m.user_id = ? AND "+after+" ORDER BY o.id"+limit,
+		append(append([]interface{}{userID}, afterArgs...), limitArgs...)...,
+	)
+}
+
+func (r *sqlOrganizations) CountByMember(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM organization_members WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlOrganizations) Get(ctx context.Context, orgID int) (models.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	org, err := scanOrganization(r.db.QueryRowContext(ctx,
+		"SELECT "+strings.Replace(organizationColumns, "m.role", "''", 1)+" FROM organizations o WHERE o.id = ?", orgID,
+	))
+	if err == sql.ErrNoRows {
+		return org, ErrNotFound
+	}
+	return org, err
+}
+
+func (r *sqlOrganizations) Member(ctx context.Context, orgID, userID int) (models.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	org, err := scanOrganization(r.db.QueryRowContext(ctx,
+		"SELECT "+organizationColumns+" FROM organizations o JOIN organization_members m ON m.organization_id = o.id WHERE o.id = ? AND m.user_id = ?",
+		orgID, userID,
+	))
+	if err == sql.ErrNoRows {
+		return org, ErrNotFound
+	}
+	return org, err
+}
+
+func (r *sqlOrganizations) Rename(ctx context.Context, orgID int, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "UPDATE organizations SET name = ? WHERE id = ?", name, orgID)
+	return err
+}
+
+func (r *sqlOrganizations) ListMembers(ctx context.Context, orgID int, page Page) ([]models.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	after, afterArgs := page.Condition(false, "m.created_at", "m.user_id")
+	limit, limitArgs := page.LimitClause()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT m.user_id, u.email, m.role, m.created_at FROM organization_members m JOIN users u ON u.id = m.user_id "+
+			"WHERE m.organization_id = ? AND "+after+" ORDER BY m.created_at, m.user_id"+limit,
+		append(append([]interface{}{orgID}, afterArgs...), limitArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		var member models.OrganizationMember
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *sqlOrganizations) CountMembers(ctx context.Context, orgID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM organization_members WHERE organization_id = ?", orgID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlOrganizations) AddMember(ctx context.Context, orgID, userID int, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)",
+		orgID, userID, role, time.Now().UTC().Truncate(time.Second),
+	)
+	if err != nil && r.dialect.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *sqlOrganizations) SetRole(ctx context.Context, orgID, userID int, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?", role, orgID, userID,
+	)
+	return err
+}
+
+func (r *sqlOrganizations) RemoveMember(ctx context.Context, orgID, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *sqlOrganizations) ListSoleOwned(ctx context.Context, userID int) ([]models.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.query(ctx,
+		"SELECT "+organizationColumns+" FROM organizations o JOIN organization_members m ON m.organization_id = o.id "+
+			"WHERE m.user_id = ? AND m.role = ? AND NOT EXISTS ("+
+			"SELECT 1 FROM organization_members other WHERE other.organization_id = o.id AND other.role = ? AND other.user_id <> m.user_id"+
+			") ORDER BY o.id",
+		userID, RoleOwner, RoleOwner,
+	)
+}
+
+// query runs a query selecting organizationColumns
+func (r *sqlOrganizations) query(ctx context.Context, query string, args ...interface{}) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (r *sqlOrganizations) CreateInvite(ctx context.Context, invite *models.OrganizationInvite) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM organization_invites WHERE organization_id = ? AND email = ?", invite.OrganizationID, invite.Email)
+	if err != nil {
+		return fmt.Errorf("failed to replace invite: %v", err)
+	}
+	invite.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO organization_invites (organization_id, email, role, invited_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		invite.OrganizationID, invite.Email, invite.Role, sql.NullInt64{Int64: int64(invite.InvitedBy), Valid: invite.InvitedBy != 0},
+		invite.CreatedAt, invite.ExpiresAt.UTC().Truncate(time.Second),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	invite.ID = int(id)
+	return tx.Commit()
+}
+
+func (r *sqlOrganizations) GetInvite(ctx context.Context, id int) (models.OrganizationInvite, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var invite models.OrganizationInvite
+	var invitedBy sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, organization_id, email, role, invited_by, created_at, expires_at FROM organization_invites WHERE id = ?", id,
+	).Scan(&invite.ID, &invite.OrganizationID, &invite.Email, &invite.Role, &invitedBy, &invite.CreatedAt, &invite.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return invite, ErrNotFound
+	}
+	invite.InvitedBy = int(invitedBy.Int64)
+	return invite, err
+}
+
+func (r *sqlOrganizations) DeleteInvite(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM organization_invites WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,37 @@
+package repository
+
+import "strings"
+
+// Page selects part of a list sorted by unique keys: at most Limit items, or
+// all of them if Limit is 0, starting after the item whose keys are After,
+// the last one of the previous page, or from the first if After is nil
+type Page struct {
+	Limit int
+	After []interface{}
+}
+
+// Condition returns the condition selecting the items that come after
+// p.After when sorted by columns, descending if desc, and its arguments.
+// Without a cursor it selects every item.
+func (p Page) Condition(desc bool, columns ...string) (string, []interface{}) {
+	if p.After == nil {
+		return "1 = 1", nil
+	}
+	op := " > "
+	if desc {
+		op = " < "
+	}
+	if len(columns) == 1 {
+		return columns[0] + op + "?", p.After
+	}
+	return "(" + strings.Join(columns, ", ") + ")" + op + "(" + placeholders(len(columns)) + ")", p.After
+}
+
+// LimitClause returns the LIMIT clause ending a query for the page, if it
+// has a limit, and its arguments
+func (p Page) LimitClause() (string, []interface{}) {
+	if p.Limit == 0 {
+		return "", nil
+	}
+	return " LIMIT ?", []interface{}{p.Limit}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"phonesaver-backend/encryption"
+)
+
+const (
+	// phoneBackfillBatch is the number of contacts EncryptPhones and
+	// ReencryptPhones update per query
+	phoneBackfillBatch = 500
+	// phoneReencryptPause is how long ReencryptPhones waits between batches,
+	// leaving room for requests on a busy database
+	phoneReencryptPause = 100 * time.Millisecond
+)
+
+// NormalizePhone reduces a phone number to its digits, keeping a leading plus
+// sign, so differently formatted copies of a number compare equal
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// phoneData binds a phone number's ciphertext to the user it belongs to, so
+// it can't be copied into another user's contact and decrypted there
+func phoneData(userID int) string {
+	return "contacts.phone:" + strconv.Itoa(userID)
+}
+
+// sealPhone returns the stored form of a user's phone number: its ciphertext
+// under the current data key, the blind index of its normalized form, and
+// the version of the key
+func sealPhone(ring *encryption.Keyring, userID int, phone string) (ciphertext, index string, version int, err error) {
+	version, c := ring.Current()
+	ciphertext, err = c.Encrypt(phone, phoneData(userID))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to encrypt phone: %v", err)
+	}
+	return ciphertext, c.Index(NormalizePhone(phone)), version, nil
+}
+
+// openPhone decrypts a user's stored phone number with the version of the
+// data key it was encrypted with. Numbers stored before encryption was
+// enabled have no version, and are returned as they are until EncryptPhones
+// runs.
+func openPhone(ring *encryption.Keyring, userID int, stored string, version sql.NullInt64) (string, error) {
+	if !version.Valid {
+		version.Int64 = configuredKeyVersion
+	}
+	c, err := ring.Version(int(version.Int64))
+	if err != nil {
+		return "", err
+	}
+	return c.Decrypt(stored, phoneData(userID))
+}
+
+// phoneIndexes returns the blind indexes phone numbers are matched by, one
+// for each version of the data key a number may have been stored with
+func phoneIndexes(ring *encryption.Keyring, phone string) []string {
+	return ring.Indexes(NormalizePhone(phone))
+}
+
+// EncryptPhones encrypts the phone numbers of contacts stored before
+// encryption was enabled, in batches, and returns how many it encrypted.
+// Contacts keep their version, and a contact written meanwhile is left as
+// that write stored it.
+func (s *Store) EncryptPhones(ctx context.Context) (int, error) {
+	ring, err := s.keys.get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.sealPhones(ctx, ring, 0, nil)
+}
+
+// ReencryptPhones re-encrypts the phone numbers of contacts encrypted with
+// an older version of the data key than the newest, and of contacts not
+// encrypted yet, to the newest version. It waits for the newest version to
+// become active first, then works in batches with a pause between them,
+// reporting its progress. It returns how many contacts it re-encrypted and
+// the version they now have.
+func (s *Store) ReencryptPhones(ctx context.Context, progress func(done, total int)) (int, int, error) {
+	keys, _, err := s.DataKeys(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	newest := keys[len(keys)-1]
+	if wait := time.Until(newest.ActiveAt); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, 0, ctx.Err()
+		}
+	}
+	ring, err := s.keys.refresh(ctx, newest.Version)
+	if err != nil {
+		return 0, 0, err
+	}
+	version, _ := ring.Current()
+
+	var total int
+	err = s.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM contacts WHERE phone_key_version IS NULL OR phone_key_version < ?", version,
+	).Scan(&total)
+	if err != nil {
+		return 0, version, fmt.Errorf("failed to count phones to re-encrypt: %v", err)
+	}
+	progress(0, total)
+
+	done, err := s.sealPhones(ctx, ring, version, func(done int) {
+		if done > total {
+			total = done
+		}
+		progress(done, total)
+	})
+	return done, version, err
+}
+
+// sealPhones encrypts the phone numbers of contacts without a data key
+// version, or with one older than below when it is non-zero, to the current
+// version of ring, and returns how many it encrypted. A contact written
+// meanwhile is left as that write stored it. Contacts written by a server
+// that hasn't loaded the current version yet are picked up by another pass.
+func (s *Store) sealPhones(ctx context.Context, ring *encryption.Keyring, below int, progress func(done int)) (int, error) {
+	where := "phone_key_version IS NULL"
+	if below > 0 {
+		where = "(phone_key_version IS NULL OR phone_key_version < ?)"
+	}
+
+	total, after := 0, 0
+	for {
+		args := []interface{}{after, phoneBackfillBatch}
+		if below > 0 {
+			args = append([]interface{}{below}, args...)
+		}
+		rows, err := s.DB.QueryContext(ctx,
+			"SELECT id, user_id, phone, phone_key_version FROM contacts WHERE "+where+" AND id > ? ORDER BY id LIMIT ?", args...)
+		if err != nil {
+			return total, fmt.Errorf("failed to find phones to encrypt: %v", err)
+		}
+		type pending struct {
+			id, userID int
+			phone      string
+			version    sql.NullInt64
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.userID, &p.phone, &p.version); err != nil {
+				rows.Close()
+				return total, err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			if after == 0 {
+				return total, nil
+			}
+			after = 0
+			continue
+		}
+
+		for _, p := range batch {
+			phone, err := openPhone(ring, p.userID, p.phone, p.version)
+			if err != nil {
+				return total, fmt.Errorf("failed to read phone of contact %d: %v", p.id, err)
+			}
+			ciphertext, index, version, err := sealPhone(ring, p.userID, phone)
+			if err != nil {
+				return total, err
+			}
+			result, err := s.DB.ExecContext(ctx,
+				"UPDATE contacts SET phone = ?, phone_hmac = ?, phone_key_version = ? WHERE id = ? AND phone = ?",
+				ciphertext, index, version, p.id, p.phone,
+			)
+			if err != nil {
+				return total, fmt.Errorf("failed to encrypt phone of contact %d: %v", p.id, err)
+			}
+			if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+				total++
+			}
+			after = p.id
+		}
+		if progress != nil {
+			progress(total)
+			select {
+			case <-time.After(phoneReencryptPause):
+			case <-ctx.Done():
+				return total, ctx.Err()
+			}
+		}
+	}
+}
+
+// CountPhonesByKeyVersion returns how many contacts' phone numbers are
+// encrypted with each version of the data key, counting those not encrypted
+// yet under version 0
+func (s *Store) CountPhonesByKeyVersion(ctx context.Context) (map[int]int, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		"SELECT COALESCE(phone_key_version, 0), COUNT(*) FROM contacts GROUP BY COALESCE(phone_key_version, 0)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var version, count int
+		if err := rows.Scan(&version, &count); err != nil {
+			return nil, err
+		}
+		counts[version] = count
+	}
+	return counts, rows.Err()
+}
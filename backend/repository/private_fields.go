@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"phonesaver-backend/encryption"
+)
+
+// The notes that are encrypted for users with enhanced privacy, named by
+// their table and column
+const (
+	InteractionNote = "interactions.note"
+	ReminderNote    = "reminders.note"
+)
+
+// contactTags names contacts' tags, which are encrypted for users with
+// enhanced privacy
+const contactTags = "contacts.tags"
+
+// fieldData binds the ciphertext of a private field to the user it belongs
+// to, as phoneData does for phone numbers
+func fieldData(field string, userID int) string {
+	return field + ":" + strconv.Itoa(userID)
+}
+
+// enhancedPrivacy reports whether a user has enhanced privacy enabled
+func enhancedPrivacy(ctx context.Context, q querier, userID int) (bool, error) {
+	var enabled bool
+	err := q.QueryRowContext(ctx, "SELECT enhanced_privacy FROM users WHERE id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	return enabled, err
+}
+
+// sealField returns the stored form of a private field: its ciphertext
+// under the current data key and the key's version when private is set, or
+// the value as it is and a NULL version otherwise
+func sealField(ring *encryption.Keyring, field string, userID int, value string, private bool) (string, interface{}, error) {
+	if !private || value == "" {
+		return value, nil, nil
+	}
+	version, c := ring.Current()
+	ciphertext, err := c.Encrypt(value, fieldData(field, userID))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt %s: %v", field, err)
+	}
+	return ciphertext, version, nil
+}
+
+// openField decrypts a stored private field with the version of the data
+// key it was encrypted with. Values stored in the clear have no version and
+// are returned as they are.
+func openField(ring *encryption.Keyring, field string, userID int, stored string, version sql.NullInt64) (string, error) {
+	if !version.Valid {
+		return stored, nil
+	}
+	c, err := ring.Version(int(version.Int64))
+	if err != nil {
+		return "", err
+	}
+	return c.Decrypt(stored, fieldData(field, userID))
+}
+
+// sealTags returns the stored form of a contact's tags: the tags column, the
+// blind index of each tag when they are encrypted, and the key version
+func sealTags(ring *encryption.Keyring, userID int, tags []string, private bool) (string, interface{}, interface{}, error) {
+	joined := strings.Join(tags, ",")
+	stored, version, err := sealField(ring, contactTags, userID, joined, private)
+	if err != nil || version == nil {
+		return stored, nil, nil, err
+	}
+	_, c := ring.Current()
+	indexes := make([]string, len(tags))
+	for i, tag := range tags {
+		indexes[i] = c.Index(tag)
+	}
+	return stored, strings.Join(indexes, ","), version, nil
+}
+
+// openTags decrypts a contact's stored tags
+func openTags(ring *encryption.Keyring, userID int, stored string, version sql.NullInt64) ([]string, error) {
+	joined, err := openField(ring, contactTags, userID, stored, version)
+	if err != nil {
+		return nil, err
+	}
+	return SplitTags(joined), nil
+}
+
+// encryptedTagCondition returns the condition that an encrypted contact's
+// tags include tag, which compares its blind index under every version of
+// ring, and the condition's arguments
+func encryptedTagCondition(d *dialect, ring *encryption.Keyring, tag string) (string, []interface{}) {
+	indexes := ring.Indexes(tag)
+	conditions := make([]string, len(indexes))
+	args := make([]interface{}, len(indexes))
+	for i, index := range indexes {
+		conditions[i] = d.hasTag("tag_index")
+		args[i] = index
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+// SealNote returns the stored form of a note on one of a user's
+// interactions or reminders, field being InteractionNote or ReminderNote,
+// and the data key version to store with it. The note is encrypted if the
+// user has enhanced privacy enabled, and the version is nil otherwise.
+func (s *Store) SealNote(ctx context.Context, userID int, field, note string) (string, interface{}, error) {
+	ring, err := s.keys.get(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	private, err := enhancedPrivacy(ctx, s.DB, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	return sealField(ring, field, userID, note, private)
+}
+
+// OpenNote returns a note stored by SealNote, decrypting it if it has a
+// data key version
+func (s *Store) OpenNote(ctx context.Context, userID int, field, stored string, version sql.NullInt64) (string, error) {
+	if !version.Valid {
+		return stored, nil
+	}
+	ring, err := s.keys.get(ctx)
+	if err != nil {
+		return "", err
+	}
+	note, err := openField(ring, field, userID, stored, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %v", field, err)
+	}
+	return note, nil
+}
+
+// SetEnhancedPrivacy turns a user's enhanced privacy on or off, encrypting
+// or decrypting their contacts' tags and their notes to match, and reports
+// whether the setting changed
+func (s *Store) SetEnhancedPrivacy(ctx context.Context, userID int, enabled bool) (bool, error) {
+	ring, err := s.keys.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE users SET enhanced_privacy = ? WHERE id = ? AND enhanced_privacy <> ?",
+		enabled, userID, enabled,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update privacy setting: %v", err)
+	}
+	if changed, err := result.RowsAffected(); err != nil || changed == 0 {
+		return false, err
+	}
+
+	if err := resealTags(ctx, tx, ring, userID, enabled); err != nil {
+		return false, err
+	}
+	for _, field := range []string{InteractionNote, ReminderNote} {
+		if err := resealNotes(ctx, tx, ring, field, userID, enabled); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return true, nil
+}
+
+// resealTags stores the tags of a user's contacts encrypted or in the clear
+func resealTags(ctx context.Context, tx *sql.Tx, ring *encryption.Keyring, userID int, private bool) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, tags, tags_key_version FROM contacts WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch tags: %v", err)
+	}
+	type stored struct {
+		id      int
+		tags    []string
+		version sql.NullInt64
+	}
+	var contacts []stored
+	for rows.Next() {
+		var contact stored
+		var tags sql.NullString
+		if err := rows.Scan(&contact.id, &tags, &contact.version); err != nil {
+			rows.Close()
+			return err
+		}
+		if contact.tags, err = openTags(ring, userID, tags.String, contact.version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to decrypt tags of contact %d: %v", contact.id, err)
+		}
+		contacts = append(contacts, contact)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, contact := range contacts {
+		tags, index, version, err := sealTags(ring, userID, contact.tags, private)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE contacts SET tags = ?, tag_index = ?, tags_key_version = ? WHERE id = ?",
+			tags, index, version, contact.id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store tags of contact %d: %v", contact.id, err)
+		}
+	}
+	return nil
+}
+
+// resealNotes stores the notes of field, InteractionNote or ReminderNote, of
+// a user encrypted or in the clear
+func resealNotes(ctx context.Context, tx *sql.Tx, ring *encryption.Keyring, field string, userID int, private bool) error {
+	table := strings.TrimSuffix(field, ".note")
+	rows, err := tx.QueryContext(ctx, "SELECT id, note, note_key_version FROM "+table+" WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", field, err)
+	}
+	type stored struct {
+		id   int
+		note string
+	}
+	var notes []stored
+	for rows.Next() {
+		var note stored
+		var raw sql.NullString
+		var version sql.NullInt64
+		if err := rows.Scan(&note.id, &raw, &version); err != nil {
+			rows.Close()
+			return err
+		}
+		if note.note, err = openField(ring, field, userID, raw.String, version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to decrypt %s %d: %v", field, note.id, err)
+		}
+		notes = append(notes, note)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		stored, version, err := sealField(ring, field, userID, note.note, private)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE "+table+" SET note = ?, note_key_version = ? WHERE id = ?", stored, version, note.id)
+		if err != nil {
+			return fmt.Errorf("failed to store %s %d: %v", field, note.id, err)
+		}
+	}
+	return nil
+}
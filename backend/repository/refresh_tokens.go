@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// RefreshTokenRepository stores refresh tokens, grouped into the families
+// descended from one login
+type RefreshTokenRepository interface {
+	// Create stores a refresh token, setting its ID
+	Create(ctx context.Context, token *models.RefreshToken) error
+	// GetByHash returns the refresh token with hash, used or not
+	GetByHash(ctx context.Context, hash string) (models.RefreshToken, error)
+	// MarkUsed marks a token as used, and reports false if it already was
+	// used or revoked, so concurrent uses can't both succeed
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+	// RevokeFamily revokes every token of a family, used or not, and returns
+	// how many were revoked
+	RevokeFamily(ctx context.Context, familyID string) (int64, error)
+	// RevokeUser revokes every token of a user, signing them out of every
+	// login, and returns how many were revoked
+	RevokeUser(ctx context.Context, userID int) (int64, error)
+	// DeleteExpired deletes tokens that expired before now and returns how
+	// many were deleted
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// sqlRefreshTokens is the RefreshTokenRepository backed by the
+// refresh_tokens table
+type sqlRefreshTokens struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func (r *sqlRefreshTokens) Create(ctx context.Context, token *models.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, device_id, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserID, token.FamilyID, token.TokenHash, token.DeviceID, token.ExpiresAt, token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	token.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	return nil
+}
+
+func (r *sqlRefreshTokens) GetByHash(ctx context.Context, hash string) (models.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, token_hash, device_id, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens WHERE token_hash = ?`,
+		hash,
+	).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.DeviceID,
+		&token.ExpiresAt, &usedAt, &revokedAt, &token.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return token, ErrNotFound
+	}
+	if err != nil {
+		return token, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+func (r *sqlRefreshTokens) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *sqlRefreshTokens) RevokeFamily(ctx context.Context, familyID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), familyID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *sqlRefreshTokens) RevokeUser(ctx context.Context, userID int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *sqlRefreshTokens) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,164 @@
+// Package repository holds the storage the handlers use: the contact, user
+// and share link repositories over the SQL database, the backup stores and
+// the queries shared across handlers
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+
+	"phonesaver-backend/config"
+)
+
+// Store holds the connection pool of the MySQL or SQLite database and the
+// repositories backed by it
+type Store struct {
+	// DB is the connection pool, for queries outside the repositories
+	DB *sql.DB
+	// Contacts stores users' contacts
+	Contacts ContactRepository
+	// Users stores user accounts
+	Users UserRepository
+	// ShareLinks stores temporary links to shared contacts
+	ShareLinks ShareLinkRepository
+	// Devices stores the devices users log in from
+	Devices DeviceRepository
+	// LoginNetworks stores the networks users have logged in from
+	LoginNetworks LoginNetworkRepository
+	// Audit stores the audit log of security-relevant account activity
+	Audit AuditRepository
+	// RefreshTokens stores the refresh tokens access tokens are renewed with
+	RefreshTokens RefreshTokenRepository
+	// Organizations stores organizations and their members
+	Organizations OrganizationRepository
+	// ContactPermissions stores the organization contacts shared with
+	// members
+	ContactPermissions ContactPermissionRepository
+	// Usage stores the usage metered for accounts
+	Usage UsageRepository
+	// Subscriptions stores the billing plans accounts are on
+	Subscriptions SubscriptionRepository
+	// Impersonations stores admins' impersonations of users
+	Impersonations ImpersonationRepository
+	// ContactSyncs stores users' connections to the contact providers their
+	// contacts are synced with
+	ContactSyncs ContactSyncRepository
+	// BlockedNumbers stores the phone numbers users blocked
+	BlockedNumbers BlockedNumberRepository
+	// ContactProfiles stores contacts' email addresses and the details found
+	// from them
+	ContactProfiles ContactProfileRepository
+	// IFTTTCodes stores the authorization codes IFTTT trades for tokens
+	IFTTTCodes IFTTTCodeRepository
+	// SMSContactNumbers stores the phones users save contacts by text from
+	SMSContactNumbers SMSContactNumberRepository
+
+	dialect *dialect
+	keys    *dataKeys
+}
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a record conflicts with an existing one,
+	// such as a user with an email that is already registered
+	ErrDuplicate = errors.New("record already exists")
+	// ErrVersionConflict is returned when a contact update was conditional on
+	// a version the contact is no longer at
+	ErrVersionConflict = errors.New("contact was modified")
+)
+
+// Open connects to the database selected by cfg.DBDriver and sets up the
+// repositories backed by it, whose operations are each bounded by
+// cfg.DBTimeout. Contacts' phone numbers are encrypted with the data key in
+// cfg.DataKey, or with one wrapped by the KMS cfg.KMSProvider selects. A
+// database that rejects the connection, such as for a wrong password or an
+// unknown database name, is reported right away; an unreachable MySQL server
+// is left for the caller to wait for.
+func Open(cfg *config.Config) (*Store, error) {
+	driver, dsn, d, err := dataSource(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DBTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil && rejected(d, err) {
+		db.Close()
+		return nil, fmt.Errorf("database rejected the connection: %v", err)
+	}
+
+	keys, err := newDataKeys(cfg, db, d)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{
+		DB:                 db,
+		Contacts:           &sqlContacts{db: db, dialect: d, keys: keys, timeout: cfg.DBTimeout},
+		Users:              &sqlUsers{db: db, dialect: d, timeout: cfg.DBTimeout},
+		ShareLinks:         &sqlShareLinks{db: db, timeout: cfg.DBTimeout},
+		Devices:            &sqlDevices{db: db, dialect: d, timeout: cfg.DBTimeout},
+		Audit:              &sqlAudit{db: db, timeout: cfg.DBTimeout},
+		RefreshTokens:      &sqlRefreshTokens{db: db, timeout: cfg.DBTimeout},
+		LoginNetworks:      &sqlLoginNetworks{db: db, dialect: d, timeout: cfg.DBTimeout},
+		Organizations:      &sqlOrganizations{db: db, dialect: d, timeout: cfg.DBTimeout},
+		ContactPermissions: &sqlContactPermissions{db: db, timeout: cfg.DBTimeout},
+		Usage:              &sqlUsage{db: db, dialect: d, timeout: cfg.DBTimeout},
+		Subscriptions:      &sqlSubscriptions{db: db, dialect: d, timeout: cfg.DBTimeout},
+		Impersonations:     &sqlImpersonations{db: db, timeout: cfg.DBTimeout},
+		ContactSyncs:       &sqlContactSyncs{db: db, dialect: d, keys: keys, timeout: cfg.DBTimeout},
+		BlockedNumbers:     &sqlBlockedNumbers{db: db, dialect: d, keys: keys, timeout: cfg.DBTimeout},
+		ContactProfiles:    &sqlContactProfiles{db: db, dialect: d, keys: keys, timeout: cfg.DBTimeout},
+		IFTTTCodes:         &sqlIFTTTCodes{db: db, dialect: d, timeout: cfg.DBTimeout},
+		SMSContactNumbers:  &sqlSMSContactNumbers{db: db, dialect: d, timeout: cfg.DBTimeout},
+		dialect:            d,
+		keys:               keys,
+	}, nil
+}
+
+// Close closes the connection pool and the connection to the KMS
+func (s *Store) Close() error {
+	s.keys.Close()
+	return s.DB.Close()
+}
+
+// dataSource returns the driver name, data source name and dialect of the
+// database selected by cfg.DBDriver. MySQL parameters in extra are added to
+// the data source name.
+func dataSource(cfg *config.Config, extra string) (string, string, *dialect, error) {
+	switch cfg.DBDriver {
+	case config.DBDriverMySQL:
+		return "mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true%s",
+			cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName, extra), mysqlDialect, nil
+	case config.DBDriverSQLite:
+		// Transactions take the write lock up front so concurrent writers
+		// wait for each other instead of failing to upgrade their locks
+		return "sqlite", fmt.Sprintf(
+			"file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite&_txlock=immediate",
+			cfg.DBPath), sqliteDialect, nil
+	default:
+		return "", "", nil, fmt.Errorf("unknown database driver %q", cfg.DBDriver)
+	}
+}
+
+// rejected reports whether a failed ping was answered by the database, so
+// retrying with the same settings can't succeed. SQLite databases are local
+// files, so any failure to open one is final.
+func rejected(d *dialect, err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return d == sqliteDialect || errors.As(err, &mysqlErr)
+}
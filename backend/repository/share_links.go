@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// ShareLinkRepository stores temporary links to shared contacts
+type ShareLinkRepository interface {
+	// Create stores a share link, setting its ID
+	Create(ctx context.Context, link *models.ShareLink) error
+	// GetByToken returns the unexpired share link with token
+	GetByToken(ctx context.Context, token string) (models.ShareLink, error)
+	// ListByUser returns a user's share links, expired or not, oldest first
+	ListByUser(ctx context.Context, userID int) ([]models.ShareLink, error)
+	// Delete revokes one of a user's share links and reports whether it
+	// existed
+	Delete(ctx context.Context, userID, linkID int) (bool, error)
+	// DeleteExpired deletes links that expired before now and returns how
+	// many were deleted
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// shareLinkColumns are the columns scanShareLink reads
+const shareLinkColumns = "id, token, contact_id, user_id, expires_at, created_at"
+
+// sqlShareLinks is the ShareLinkRepository backed by the share_links table
+type sqlShareLinks struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func (r *sqlShareLinks) Create(ctx context.Context, link *models.ShareLink) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO share_links (token, contact_id, user_id, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		link.Token, link.ContactID, link.UserID, link.ExpiresAt, link.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	link.ID = int(id)
+	return err
+}
+
+func (r *sqlShareLinks) GetByToken(ctx context.Context, token string) (models.ShareLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	link, err := scanShareLink(r.db.QueryRowContext(ctx,
+		"SELECT "+shareLinkColumns+" FROM share_links WHERE token = ? AND expires_at > ?",
+		token, time.Now().UTC(),
+	))
+	if err == sql.ErrNoRows {
+		return link, ErrNotFound
+	}
+	return link, err
+}
+
+func (r *sqlShareLinks) ListByUser(ctx context.Context, userID int) ([]models.ShareLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SELECT "+shareLinkColumns+" FROM share_links WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r *sqlShareLinks) Delete(ctx context.Context, userID, linkID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM share_links WHERE id = ? AND user_id = ?", linkID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *sqlShareLinks) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM share_links WHERE expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanShareLink reads a share link row selected with shareLinkColumns
+func scanShareLink(row RowScanner) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := row.Scan(&link.ID, &link.Token, &link.ContactID, &link.UserID, &link.ExpiresAt, &link.CreatedAt)
+	return link, err
+}
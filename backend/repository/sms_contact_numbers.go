@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// SMSContactNumberRepository stores the phones users linked to save
+// contacts by text, and the codes they link them with
+type SMSContactNumberRepository interface {
+	// Get returns a user's linked phone
+	Get(ctx context.Context, userID int) (models.SMSContactNumber, error)
+	// FindByPhone returns the linked phone matching phone
+	FindByPhone(ctx context.Context, phone string) (models.SMSContactNumber, error)
+	// SetLinkCode replaces a user's link code with the one hashed into
+	// hash, leaving the phone already linked as it is
+	SetLinkCode(ctx context.Context, userID int, hash string, expiresAt time.Time) error
+	// Link links phone to the user of the link code hashed into hash, using
+	// up the code and unlinking the phone from any other user, and returns
+	// the user's ID. ErrNotFound is returned if the code is unknown or
+	// expired by now.
+	Link(ctx context.Context, hash, phone string, now time.Time) (int, error)
+	// Delete unlinks a user's phone and drops their link code, and reports
+	// whether they had either
+	Delete(ctx context.Context, userID int) (bool, error)
+}
+
+// sqlSMSContactNumbers is the SMSContactNumberRepository backed by the
+// sms_contact_numbers table
+type sqlSMSContactNumbers struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlSMSContactNumbers) Get(ctx context.Context, userID int) (models.SMSContactNumber, error) {
+	return r.get(ctx, "user_id = ?", userID)
+}
+
+func (r *sqlSMSContactNumbers) FindByPhone(ctx context.Context, phone string) (models.SMSContactNumber, error) {
+	return r.get(ctx, "phone = ?", phone)
+}
+
+// get returns the linked phone matching where
+func (r *sqlSMSContactNumbers) get(ctx context.Context, where string, args ...interface{}) (models.SMSContactNumber, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var number models.SMSContactNumber
+	var phone sql.NullString
+	var linkedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT user_id, phone, linked_at FROM sms_contact_numbers WHERE "+where, args...,
+	).Scan(&number.UserID, &phone, &linkedAt)
+	if err == sql.ErrNoRows {
+		return number, ErrNotFound
+	}
+	if err != nil {
+		return number, err
+	}
+	number.Phone = phone.String
+	if linkedAt.Valid {
+		number.LinkedAt = &linkedAt.Time
+	}
+	return number, nil
+}
+
+func (r *sqlSMSContactNumbers) SetLinkCode(ctx context.Context, userID int, hash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO sms_contact_numbers (user_id, code_hash, code_expires_at) VALUES (?, ?, ?) "+
+			r.dialect.upsert([]string{"user_id"}, []string{"code_hash", "code_expires_at"}),
+		userID, hash, expiresAt,
+	)
+	return err
+}
+
+func (r *sqlSMSContactNumbers) Link(ctx context.Context, hash, phone string, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id FROM sms_contact_numbers WHERE code_hash = ? AND code_expires_at > ?"+r.dialect.forUpdate,
+		hash, now,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE sms_contact_numbers SET phone = NULL, linked_at = NULL WHERE phone = ? AND user_id <> ?",
+		phone, userID,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE sms_contact_numbers SET phone = ?, linked_at = ?, code_hash = NULL, code_expires_at = NULL WHERE user_id = ?",
+		phone, now, userID,
+	); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return userID, nil
+}
+
+func (r *sqlSMSContactNumbers) Delete(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "DELETE FROM sms_contact_numbers WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
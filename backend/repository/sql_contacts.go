@@ -0,0 +1,573 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"time"
+
+	"phonesaver-backend/encryption"
+	"phonesaver-backend/models"
+)
+
+// contactColumns are the columns scanContact reads
+const contactColumns = "id, user_id, name, phone, phone_key_version, encrypted_phone, tags, tags_key_version, last_interaction, birthday, version, updated_at, created_at, " +
+	"phone_valid, phone_line_type, phone_carrier, phone_country, phone_verified_at"
+
+// phoneVerificationColumns hold a contact's models.PhoneVerification
+var phoneVerificationColumns = []string{"phone_valid", "phone_line_type", "phone_carrier", "phone_country", "phone_verified_at"}
+
+// contactSortColumns are the columns List may sort by
+var contactSortColumns = map[string]string{
+	"name":             "name",
+	"last_interaction": "last_interaction",
+	"birthday":         "birthday",
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// placeholders returns n comma-separated query placeholders, for IN lists
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sqlContacts is the ContactRepository backed by the contacts table
+type sqlContacts struct {
+	db      *sql.DB
+	dialect *dialect
+	keys    *dataKeys
+	timeout time.Duration
+}
+
+func (r *sqlContacts) List(ctx context.Context, userID int, query ContactQuery) ([]models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := contactConditions(r.dialect, ring, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	column := contactSortColumns[query.SortBy]
+	if query.After != nil {
+		condition, afterArgs := contactKeyset(column, query.Desc, *query.After)
+		where += " AND " + condition
+		args = append(args, afterArgs...)
+	}
+	order := "id"
+	if column != "" {
+		order = column + ", id"
+	}
+	if query.Desc {
+		order = strings.ReplaceAll(order, ",", " DESC,") + " DESC"
+	}
+	sqlQuery := "SELECT " + contactColumns + " FROM contacts WHERE " + where + " ORDER BY " + order
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return queryContacts(ctx, r.db, ring, sqlQuery, args...)
+}
+
+func (r *sqlContacts) CountMatching(ctx context.Context, userID int, query ContactQuery) (int, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	where, args, err := contactConditions(r.dialect, ring, userID, query)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM contacts WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// contactConditions returns the WHERE clause selecting a user's contacts
+// matching query's search, tag and filter
+func contactConditions(d *dialect, ring *encryption.Keyring, userID int, query ContactQuery) (string, []interface{}, error) {
+	where := "user_id = ?"
+	args := []interface{}{userID}
+
+	if query.Search != "" {
+		if phone := NormalizePhone(query.Search); phone != "" {
+			indexes := phoneIndexes(ring, phone)
+			where += " AND (name LIKE ? OR phone_hmac IN (" + placeholders(len(indexes)) + "))"
+			args = append(args, "%"+query.Search+"%")
+			for _, index := range indexes {
+				args = append(args, index)
+			}
+		} else {
+			where += " AND name LIKE ?"
+			args = append(args, "%"+query.Search+"%")
+		}
+	}
+
+	if query.Tag != "" {
+		// Encrypted tags can only match in full
+		condition, indexes := encryptedTagCondition(d, ring, query.Tag)
+		where += " AND ((tags_key_version IS NULL AND tags LIKE ?) OR " + condition + ")"
+		args = append(append(args, "%"+query.Tag+"%"), indexes...)
+	}
+
+	if query.Filter != "" {
+		condition, filterArgs, err := compileContactFilter(query.Filter, d, ring)
+		if err != nil {
+			return "", nil, err
+		}
+		where += " AND " + condition
+		args = append(args, filterArgs...)
+	}
+	return where, args, nil
+}
+
+// contactKeyset returns the condition selecting the contacts that come after
+// cursor when sorted by column, if any, and then ID. Both databases sort
+// NULLs before any value.
+func contactKeyset(column string, desc bool, cursor ContactCursor) (string, []interface{}) {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	switch {
+	case column == "":
+		return "id " + op + " ?", []interface{}{cursor.ID}
+	case cursor.Value == nil && desc:
+		return "(" + column + " IS NULL AND id < ?)", []interface{}{cursor.ID}
+	case cursor.Value == nil:
+		return "(" + column + " IS NOT NULL OR id > ?)", []interface{}{cursor.ID}
+	case desc:
+		return "(" + column + " < ? OR (" + column + " = ? AND id < ?) OR " + column + " IS NULL)",
+			[]interface{}{cursor.Value, cursor.Value, cursor.ID}
+	default:
+		return "(" + column + " > ? OR (" + column + " = ? AND id > ?))",
+			[]interface{}{cursor.Value, cursor.Value, cursor.ID}
+	}
+}
+
+func (r *sqlContacts) ListAll(ctx context.Context, userID int) ([]models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return queryContacts(ctx, r.db, ring, "SELECT "+contactColumns+" FROM contacts WHERE user_id = ? ORDER BY id", userID)
+}
+
+func (r *sqlContacts) ListChanged(ctx context.Context, userID int, since time.Time) ([]models.Contact, []models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+contactColumns+" FROM contacts WHERE user_id = ? AND updated_at >= ? ORDER BY updated_at, id",
+		userID, since,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	created, updated := []models.Contact{}, []models.Contact{}
+	for rows.Next() {
+		contact, err := scanContact(rows, ring)
+		if err != nil {
+			return nil, nil, err
+		}
+		if contact.CreatedAt.Before(since) {
+			updated = append(updated, contact)
+		} else {
+			created = append(created, contact)
+		}
+	}
+	return created, updated, rows.Err()
+}
+
+func (r *sqlContacts) Get(ctx context.Context, userID, contactID int) (models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return getContact(ctx, r.db, ring, "", userID, contactID)
+}
+
+func (r *sqlContacts) FindByPhone(ctx context.Context, userID int, phone string) ([]models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if NormalizePhone(phone) == "" {
+		return []models.Contact{}, nil
+	}
+	indexes := phoneIndexes(ring, phone)
+	args := []interface{}{userID}
+	for _, index := range indexes {
+		args = append(args, index)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	contacts, err := queryContacts(ctx, r.db, ring,
+		"SELECT "+contactColumns+" FROM contacts WHERE user_id = ? AND phone_hmac IN ("+placeholders(len(indexes))+") ORDER BY id",
+		args...,
+	)
+	if contacts == nil && err == nil {
+		contacts = []models.Contact{}
+	}
+	return contacts, err
+}
+
+func (r *sqlContacts) ListDuplicates(ctx context.Context, userID int) ([][]models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+contactColumns+", phone_hmac FROM contacts WHERE user_id = ? AND phone_hmac IN ("+
+			"SELECT phone_hmac FROM contacts WHERE user_id = ? AND phone_hmac IS NOT NULL GROUP BY phone_hmac HAVING COUNT(*) > 1"+
+			") ORDER BY phone_hmac, id",
+		userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := [][]models.Contact{}
+	previous := ""
+	for rows.Next() {
+		var index string
+		contact, err := scanContact(rows, ring, &index)
+		if err != nil {
+			return nil, err
+		}
+		if index != previous {
+			groups = append(groups, nil)
+			previous = index
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], contact)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].ID < groups[j][0].ID })
+	return groups, nil
+}
+
+func (r *sqlContacts) Exists(ctx context.Context, userID, contactID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM contacts WHERE id = ? AND user_id = ?)", contactID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlContacts) Count(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM contacts WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlContacts) Create(ctx context.Context, contact *models.Contact) error {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return insertContact(ctx, r.db, ring, contact)
+}
+
+func (r *sqlContacts) Update(ctx context.Context, userID, contactID, expectedVersion int, patch ContactPatch) (models.Contact, error) {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := updateContact(ctx, r.db, ring, userID, contactID, expectedVersion, patch)
+	if err != nil {
+		return models.Contact{}, err
+	}
+
+	current, err := getContact(ctx, r.db, ring, "", userID, contactID)
+	if err != nil {
+		return current, err
+	}
+	if rows == 0 {
+		return current, ErrVersionConflict
+	}
+	return current, nil
+}
+
+func (r *sqlContacts) SetPhoneVerification(ctx context.Context, userID, contactID, version int, verification models.PhoneVerification) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE contacts SET phone_valid = ?, phone_line_type = ?, phone_carrier = ?, phone_country = ?, phone_verified_at = ? WHERE id = ? AND user_id = ? AND version = ?",
+		verification.Valid,
+		sql.NullString{String: verification.LineType, Valid: verification.LineType != ""},
+		sql.NullString{String: verification.Carrier, Valid: verification.Carrier != ""},
+		sql.NullString{String: verification.CountryCode, Valid: verification.CountryCode != ""},
+		verification.VerifiedAt, contactID, userID, version,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+	exists, err := r.Exists(ctx, userID, contactID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (r *sqlContacts) Delete(ctx context.Context, userID, contactID int) (bool, error) {
+	var deleted bool
+	err := r.Transaction(ctx, func(tx ContactTx) error {
+		var err error
+		deleted, err = tx.Delete(userID, contactID)
+		return err
+	})
+	return deleted, err
+}
+
+func (r *sqlContacts) Transaction(ctx context.Context, fn func(tx ContactTx) error) error {
+	ring, err := r.keys.get(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(&sqlContactTx{ctx: ctx, tx: tx, dialect: r.dialect, ring: ring}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// sqlContactTx is the ContactTx of a database transaction, whose statements
+// run with the context the transaction was started with
+type sqlContactTx struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	dialect *dialect
+	ring    *encryption.Keyring
+}
+
+func (t *sqlContactTx) GetForUpdate(userID, contactID int) (models.Contact, error) {
+	return getContact(t.ctx, t.tx, t.ring, t.dialect.forUpdate, userID, contactID)
+}
+
+func (t *sqlContactTx) Create(contact *models.Contact) error {
+	return insertContact(t.ctx, t.tx, t.ring, contact)
+}
+
+func (t *sqlContactTx) Update(userID, contactID int, patch ContactPatch) error {
+	_, err := updateContact(t.ctx, t.tx, t.ring, userID, contactID, 0, patch)
+	return err
+}
+
+func (t *sqlContactTx) Delete(userID, contactID int) (bool, error) {
+	rows, err := deleteContacts(t.ctx, t.tx, "id = ? AND user_id = ?", contactID, userID)
+	return rows > 0, err
+}
+
+func (t *sqlContactTx) DeleteAll(userID int) error {
+	_, err := deleteContacts(t.ctx, t.tx, "user_id = ?", userID)
+	return err
+}
+
+// queryContacts runs a query selecting contactColumns
+func queryContacts(ctx context.Context, q querier, ring *encryption.Keyring, query string, args ...interface{}) ([]models.Contact, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []models.Contact
+	for rows.Next() {
+		contact, err := scanContact(rows, ring)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// getContact loads one of a user's contacts, appending suffix to the query
+func getContact(ctx context.Context, q querier, ring *encryption.Keyring, suffix string, userID, contactID int) (models.Contact, error) {
+	contact, err := scanContact(q.QueryRowContext(ctx,
+		"SELECT "+contactColumns+" FROM contacts WHERE id = ? AND user_id = ?"+suffix,
+		contactID, userID,
+	), ring)
+	if err == sql.ErrNoRows {
+		return contact, ErrNotFound
+	}
+	return contact, err
+}
+
+// insertContact stores a new contact with its phone number encrypted, and
+// its tags too if its user has enhanced privacy, setting its ID and version,
+// and when it was created if that isn't set, as when it is restored
+func insertContact(ctx context.Context, q querier, ring *encryption.Keyring, contact *models.Contact) error {
+	phone, index, keyVersion, err := sealPhone(ring, contact.UserID, contact.Phone)
+	if err != nil {
+		return err
+	}
+	private, err := enhancedPrivacy(ctx, q, contact.UserID)
+	if err != nil {
+		return err
+	}
+	tags, tagIndex, tagsKeyVersion, err := sealTags(ring, contact.UserID, contact.Tags, private)
+	if err != nil {
+		return err
+	}
+	if contact.CreatedAt.IsZero() {
+		contact.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO contacts (user_id, name, phone, phone_hmac, phone_key_version, encrypted_phone, tags, tag_index, tags_key_version, last_interaction, birthday, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		contact.UserID, contact.Name, phone, index, keyVersion, contact.EncryptedPhone, tags, tagIndex, tagsKeyVersion,
+		NullTime(contact.LastInteraction), NullTime(contact.Birthday), contact.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %v", err)
+	}
+	contact.ID = int(id)
+	contact.Version = 1
+	return nil
+}
+
+// updateContact applies patch to a contact, conditional on its version when
+// expectedVersion is non-zero, and returns the number of rows updated
+func updateContact(ctx context.Context, q querier, ring *encryption.Keyring, userID, contactID, expectedVersion int, patch ContactPatch) (int64, error) {
+	var set []string
+	var args []interface{}
+	if patch.Name != nil {
+		set = append(set, "name = ?")
+		args = append(args, *patch.Name)
+	}
+	if patch.Phone != nil {
+		phone, index, keyVersion, err := sealPhone(ring, userID, *patch.Phone)
+		if err != nil {
+			return 0, err
+		}
+		// The verification of another number no longer applies. It is
+		// compared before phone_hmac is set, as MySQL applies assignments in
+		// order.
+		for _, column := range phoneVerificationColumns {
+			set = append(set, column+" = CASE WHEN phone_hmac = ? THEN "+column+" ELSE NULL END")
+			args = append(args, index)
+		}
+		set = append(set, "phone = ?", "phone_hmac = ?", "phone_key_version = ?")
+		args = append(args, phone, index, keyVersion)
+	}
+	if patch.EncryptedPhone != nil {
+		set = append(set, "encrypted_phone = ?")
+		args = append(args, *patch.EncryptedPhone)
+	}
+	if patch.Tags != nil {
+		private, err := enhancedPrivacy(ctx, q, userID)
+		if err != nil {
+			return 0, err
+		}
+		tags, index, keyVersion, err := sealTags(ring, userID, *patch.Tags, private)
+		if err != nil {
+			return 0, err
+		}
+		set = append(set, "tags = ?", "tag_index = ?", "tags_key_version = ?")
+		args = append(args, tags, index, keyVersion)
+	}
+	if patch.LastInteraction != nil {
+		set = append(set, "last_interaction = ?")
+		args = append(args, NullTime(*patch.LastInteraction))
+	}
+	if patch.Birthday != nil {
+		set = append(set, "birthday = ?")
+		args = append(args, NullTime(*patch.Birthday))
+	}
+	set = append(set, "version = version + 1")
+	args = append(args, contactID, userID, expectedVersion, expectedVersion)
+
+	result, err := q.ExecContext(ctx,
+		"UPDATE contacts SET "+strings.Join(set, ", ")+" WHERE id = ? AND user_id = ? AND (? = 0 OR version = ?)",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteContacts deletes the contacts matching where, recording a tombstone
+// for each. It returns the number of contacts deleted.
+func deleteContacts(ctx context.Context, q querier, where string, args ...interface{}) (int64, error) {
+	_, err := q.ExecContext(ctx,
+		"INSERT INTO contact_tombstones (user_id, contact_id) SELECT user_id, id FROM contacts WHERE "+where,
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := q.ExecContext(ctx, "DELETE FROM contacts WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
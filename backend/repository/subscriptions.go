@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// SubscriptionRepository stores the plans accounts are on and the Stripe
+// subscriptions paying for them
+type SubscriptionRepository interface {
+	// Get returns a user's subscription. ErrNotFound is returned for users
+	// who never subscribed, who are on the free plan.
+	Get(ctx context.Context, userID int) (models.Subscription, error)
+	// GetByCustomer returns the subscription of the user a Stripe customer
+	// belongs to. ErrNotFound is returned if no user does.
+	GetByCustomer(ctx context.Context, customerID string) (models.Subscription, error)
+	// Save creates or replaces a user's subscription
+	Save(ctx context.Context, subscription models.Subscription) error
+}
+
+// Plans accounts can be on
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
+// subscriptionColumns are the columns read by scanSubscription
+const subscriptionColumns = "user_id, plan, status, stripe_customer_id, stripe_subscription_id, current_period_end, updated_at"
+
+// scanSubscription reads a subscription row selected with
+// subscriptionColumns
+func scanSubscription(row RowScanner) (models.Subscription, error) {
+	var subscription models.Subscription
+	var customerID, subscriptionID sql.NullString
+	var periodEnd sql.NullTime
+	if err := row.Scan(&subscription.UserID, &subscription.Plan, &subscription.Status, &customerID, &subscriptionID,
+		&periodEnd, &subscription.UpdatedAt); err != nil {
+		return subscription, err
+	}
+	subscription.CustomerID = customerID.String
+	subscription.SubscriptionID = subscriptionID.String
+	if periodEnd.Valid {
+		subscription.CurrentPeriodEnd = &periodEnd.Time
+	}
+	return subscription, nil
+}
+
+// sqlSubscriptions is the SubscriptionRepository backed by the subscriptions
+// table
+type sqlSubscriptions struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlSubscriptions) Get(ctx context.Context, userID int) (models.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	subscription, err := scanSubscription(r.db.QueryRowContext(ctx,
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE user_id = ?", userID,
+	))
+	if err == sql.ErrNoRows {
+		return subscription, ErrNotFound
+	}
+	return subscription, err
+}
+
+func (r *sqlSubscriptions) GetByCustomer(ctx context.Context, customerID string) (models.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	subscription, err := scanSubscription(r.db.QueryRowContext(ctx,
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE stripe_customer_id = ?", customerID,
+	))
+	if err == sql.ErrNoRows {
+		return subscription, ErrNotFound
+	}
+	return subscription, err
+}
+
+func (r *sqlSubscriptions) Save(ctx context.Context, subscription models.Subscription) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var periodEnd interface{}
+	if subscription.CurrentPeriodEnd != nil {
+		periodEnd = subscription.CurrentPeriodEnd.UTC().Truncate(time.Second)
+	}
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO subscriptions (user_id, plan, status, stripe_customer_id, stripe_subscription_id, current_period_end, updated_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?) "+
+			r.dialect.upsert([]string{"user_id"}, []string{"plan", "status", "stripe_customer_id", "stripe_subscription_id", "current_period_end", "updated_at"}),
+		subscription.UserID, subscription.Plan, subscription.Status,
+		sql.NullString{String: subscription.CustomerID, Valid: subscription.CustomerID != ""},
+		sql.NullString{String: subscription.SubscriptionID, Valid: subscription.SubscriptionID != ""},
+		periodEnd, subscription.UpdatedAt.UTC().Truncate(time.Second),
+	)
+	if err != nil && r.dialect.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// UsageRepository meters what accounts use, such as API calls, storage and
+// backups, and rolls it up per UTC day
+type UsageRepository interface {
+	// Add adds amount to a metric of a user's usage today
+	Add(ctx context.Context, userID int, metric string, amount int64) error
+	// RollUp records every account's usage on each day before today that
+	// hasn't been rolled up, from what was metered and the contacts and
+	// backup they keep now, and discards the metered usage. It returns the
+	// number of days rolled up.
+	RollUp(ctx context.Context, today time.Time) (int, error)
+	// Days returns a user's daily usage from since, oldest first, ending
+	// with today's so far
+	Days(ctx context.Context, userID int, since, today time.Time) ([]models.UsageDay, error)
+}
+
+// Metrics of usage metered as it happens
+const (
+	MetricAPICalls    = "api_calls"
+	MetricBackups     = "backups"
+	MetricBackupBytes = "backup_bytes"
+)
+
+// usageDayLayout formats the days of models.UsageDay
+const usageDayLayout = "2006-01-02"
+
+// usageColumns select an account's usage on a day, for the users table
+// aliased as u and the day bound to each of the first three ?. The storage
+// of contacts is counted from the names, phone numbers and tags they are
+// stored with, encrypted or not, and the backup storage is the size of the latest completed
+// backup, which is all the backup store keeps.
+const usageColumns = `u.id,
+	COALESCE((SELECT SUM(amount) FROM usage_meter m WHERE m.user_id = u.id AND m.day = ? AND m.metric = 'api_calls'), 0),
+	COALESCE((SELECT SUM(amount) FROM usage_meter m WHERE m.user_id = u.id AND m.day = ? AND m.metric = 'backups'), 0),
+	COALESCE((SELECT SUM(amount) FROM usage_meter m WHERE m.user_id = u.id AND m.day = ? AND m.metric = 'backup_bytes'), 0),
+	(SELECT COUNT(*) FROM contacts c WHERE c.user_id = u.id),
+	COALESCE((SELECT SUM(LENGTH(c.name) + LENGTH(c.phone) + LENGTH(c.encrypted_phone) + COALESCE(LENGTH(c.tags), 0)) FROM contacts c WHERE c.user_id = u.id), 0),
+	COALESCE((SELECT b.size_bytes FROM backups b WHERE b.user_id = u.id AND b.status = 'completed' ORDER BY b.id DESC LIMIT 1), 0)`
+
+// sqlUsage is the UsageRepository backed by the usage_meter and usage_daily
+// tables
+type sqlUsage struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlUsage) Add(ctx context.Context, userID int, metric string, amount int64) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO usage_meter (user_id, day, metric, amount) VALUES (?, ?, ?, ?) "+
+			r.dialect.increment([]string{"user_id", "day", "metric"}, "amount"),
+		userID, usageDay(time.Now()), metric, amount,
+	)
+	return err
+}
+
+func (r *sqlUsage) RollUp(ctx context.Context, today time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	today = usageDay(today)
+
+	// Days with metered usage left, and yesterday, which every account has
+	// a day of usage for
+	days := map[time.Time]bool{}
+	yesterday := today.AddDate(0, 0, -1)
+	var rolled int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM usage_daily WHERE day = ?", yesterday).Scan(&rolled); err != nil {
+		return 0, fmt.Errorf("failed to check rolled up usage: %v", err)
+	}
+	if rolled == 0 {
+		days[yesterday] = true
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT day FROM usage_meter WHERE day < ?", today)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list metered days: %v", err)
+	}
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		days[usageDay(day)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for day := range days {
+		if err := r.rollUpDay(ctx, day); err != nil {
+			return 0, fmt.Errorf("failed to roll up usage on %s: %v", day.Format(usageDayLayout), err)
+		}
+	}
+	return len(days), nil
+}
+
+// rollUpDay records every account's usage on a day and discards what was
+// metered on it
+func (r *sqlUsage) rollUpDay(ctx context.Context, day time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// SQLite needs the WHERE to tell the upsert's ON from a join's
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO usage_daily (user_id, api_calls, backups, backup_bytes, contacts, storage_bytes, backup_storage_bytes, day) "+
+			"SELECT "+usageColumns+", ? FROM users u WHERE 1 = 1 "+
+			r.dialect.upsert([]string{"user_id", "day"}, []string{"api_calls", "backups", "backup_bytes", "contacts", "storage_bytes", "backup_storage_bytes"}),
+		day, day, day, day,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM usage_meter WHERE day = ?", day); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlUsage) Days(ctx context.Context, userID int, since, today time.Time) ([]models.UsageDay, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	today = usageDay(today)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT day, api_calls, backups, backup_bytes, contacts, storage_bytes, backup_storage_bytes FROM usage_daily "+
+			"WHERE user_id = ? AND day >= ? AND day < ? ORDER BY day",
+		userID, usageDay(since), today,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.UsageDay{}
+	for rows.Next() {
+		var day models.UsageDay
+		var date time.Time
+		if err := rows.Scan(&date, &day.APICalls, &day.Backups, &day.BackupBytes, &day.Contacts, &day.StorageBytes, &day.BackupStorageBytes); err != nil {
+			return nil, err
+		}
+		day.Day = date.Format(usageDayLayout)
+		usage = append(usage, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	current := models.UsageDay{Day: today.Format(usageDayLayout)}
+	var id int
+	err = r.db.QueryRowContext(ctx, "SELECT "+usageColumns+" FROM users u WHERE u.id = ?", today, today, today, userID).Scan(
+		&id, &current.APICalls, &current.Backups, &current.BackupBytes, &current.Contacts, &current.StorageBytes, &current.BackupStorageBytes,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(usage, current), nil
+}
+
+// usageDay returns the UTC day t falls on
+func usageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
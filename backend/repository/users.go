@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"phonesaver-backend/models"
+)
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// Create registers a user with a bcrypt password hash and returns the new
+	// user's ID. ErrDuplicate is returned if the email is already registered.
+	Create(ctx context.Context, email, passwordHash string) (int, error)
+	// GetByEmail returns the user registered with email, including the
+	// password hash
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// Get returns the user with the given ID. ErrNotFound is returned if
+	// there is none.
+	Get(ctx context.Context, userID int) (models.User, error)
+	// ScheduleDeletion schedules a user's account to be erased at at, unless
+	// it already is, and returns when it will be erased
+	ScheduleDeletion(ctx context.Context, userID int, at time.Time) (time.Time, error)
+	// DeletionScheduledAt returns when a user's account will be erased, or
+	// nil if it won't be
+	DeletionScheduledAt(ctx context.Context, userID int) (*time.Time, error)
+	// EnhancedPrivacy reports whether a user has enhanced privacy enabled,
+	// which Store.SetEnhancedPrivacy changes
+	EnhancedPrivacy(ctx context.Context, userID int) (bool, error)
+	// ContactEnrichment reports whether a user opted in to contact
+	// enrichment
+	ContactEnrichment(ctx context.Context, userID int) (bool, error)
+	// SetContactEnrichment opts a user in to or out of contact enrichment
+	// and reports whether this changed their choice
+	SetContactEnrichment(ctx context.Context, userID int, enabled bool) (bool, error)
+	// CancelDeletion cancels the scheduled erasure of a user's account and
+	// reports whether one was scheduled
+	CancelDeletion(ctx context.Context, userID int) (bool, error)
+	// ListDueForDeletion returns the users whose accounts were scheduled to
+	// be erased by now
+	ListDueForDeletion(ctx context.Context, now time.Time) ([]models.User, error)
+	// Delete erases a user's account with everything stored about them in
+	// the database, including their audit log
+	Delete(ctx context.Context, userID int) error
+	// List returns the accounts matching query, oldest first, for admins.
+	// The accounts keeping organizations' contacts are left out.
+	List(ctx context.Context, query UserQuery) ([]models.AdminUser, error)
+	// Count returns the number of accounts matching query, ignoring its page
+	Count(ctx context.Context, query UserQuery) (int, error)
+	// Account returns one account as admins see it. ErrNotFound is returned
+	// if there is none.
+	Account(ctx context.Context, userID int) (models.AdminUser, error)
+	// Suspend suspends a user's account at at, signing it out everywhere,
+	// and reports whether it was active. ErrNotFound is returned if there
+	// is no such account.
+	Suspend(ctx context.Context, userID int, at time.Time) (bool, error)
+	// Reactivate lifts the suspension of a user's account and reports
+	// whether it was suspended
+	Reactivate(ctx context.Context, userID int) (bool, error)
+	// RequirePasswordReset discards a user's password, so they can only log
+	// in again after choosing a new one, signs the account out everywhere
+	// and returns its new token generation. ErrNotFound is returned if there
+	// is no such account.
+	RequirePasswordReset(ctx context.Context, userID int) (int, error)
+	// ResetPassword sets the new password of a user who was required to
+	// reset it, and reports whether one was required
+	ResetPassword(ctx context.Context, userID int, passwordHash string) (bool, error)
+}
+
+// User statuses an admin can list accounts by
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+)
+
+// UserQuery selects a page of the accounts returned by List
+type UserQuery struct {
+	// Email only returns accounts whose email contains it if it is not
+	// empty
+	Email string
+	// Status only returns accounts with this status, UserActive or
+	// UserSuspended, if it is not empty
+	Status string
+	// After only returns accounts newer than the one with this ID if it is
+	// non-zero, to page through them
+	After int
+	// Limit is the maximum number of accounts returned
+	Limit int
+}
+
+// userColumns are the columns read by scanUser
+const userColumns = "id, email, password, suspended_at, password_reset_required, token_generation"
+
+// scanUser reads a user row selected with userColumns
+func scanUser(row RowScanner) (models.User, error) {
+	var user models.User
+	var suspendedAt sql.NullTime
+	if err := row.Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &suspendedAt, &user.PasswordResetRequired, &user.TokenGeneration,
+	); err != nil {
+		return user, err
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	return user, nil
+}
+
+// adminUserColumns are the columns read by scanAdminUser, with the users
+// table aliased as u
+const adminUserColumns = `u.id, u.email, u.created_at, u.suspended_at, u.password_reset_required, u.deletion_scheduled_at,
+	(SELECT COUNT(*) FROM contacts c WHERE c.user_id = u.id), (SELECT COUNT(*) FROM devices d WHERE d.user_id = u.id)`
+
+// scanAdminUser reads an account row selected with adminUserColumns
+func scanAdminUser(row RowScanner) (models.AdminUser, error) {
+	var user models.AdminUser
+	var suspendedAt, deletionScheduledAt sql.NullTime
+	if err := row.Scan(
+		&user.ID, &user.Email, &user.CreatedAt, &suspendedAt, &user.PasswordResetRequired, &deletionScheduledAt,
+		&user.Contacts, &user.Devices,
+	); err != nil {
+		return user, err
+	}
+	if suspendedAt.Valid {
+		user.Suspended, user.SuspendedAt = true, &suspendedAt.Time
+	}
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	return user, nil
+}
+
+// sqlUsers is the UserRepository backed by the users table
+type sqlUsers struct {
+	db      *sql.DB
+	dialect *dialect
+	timeout time.Duration
+}
+
+func (r *sqlUsers) Create(ctx context.Context, email, passwordHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx, "INSERT INTO users (email, password) VALUES (?, ?)", email, passwordHash)
+	if err != nil {
+		if r.dialect.isDuplicate(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (r *sqlUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	user, err := scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *sqlUsers) Get(ctx context.Context, userID int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	user, err := scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *sqlUsers) ScheduleDeletion(ctx context.Context, userID int, at time.Time) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE users SET deletion_scheduled_at = ? WHERE id = ? AND deletion_scheduled_at IS NULL", at.UTC().Truncate(time.Second), userID,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var scheduled sql.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT deletion_scheduled_at FROM users WHERE id = ?", userID).Scan(&scheduled); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, ErrNotFound
+		}
+		return time.Time{}, err
+	}
+	return scheduled.Time, nil
+}
+
+func (r *sqlUsers) DeletionScheduledAt(ctx context.Context, userID int) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var scheduled sql.NullTime
+	err := r.db.QueryRowContext(ctx, "SELECT deletion_scheduled_at FROM users WHERE id = ?", userID).Scan(&scheduled)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil || !scheduled.Valid {
+		return nil, err
+	}
+	return &scheduled.Time, nil
+}
+
+func (r *sqlUsers) EnhancedPrivacy(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return enhancedPrivacy(ctx, r.db, userID)
+}
+
+func (r *sqlUsers) ContactEnrichment(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var enabled bool
+	err := r.db.QueryRowContext(ctx, "SELECT contact_enrichment FROM users WHERE id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	return enabled, err
+}
+
+func (r *sqlUsers) SetContactEnrichment(ctx context.Context, userID int, enabled bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET contact_enrichment = ? WHERE id = ? AND contact_enrichment <> ?", enabled, userID, enabled,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *sqlUsers) CancelDeletion(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL", userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *sqlUsers) ListDueForDeletion(ctx context.Context, now time.Time) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE deletion_scheduled_at <= ? ORDER BY deletion_scheduled_at", now.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Delete removes the user's audit events, which have no foreign key to the
+// account, and the account itself, whose other rows are deleted with it by
+// their foreign keys
+func (r *sqlUsers) Delete(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM audit_events WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete audit events: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// userConditions returns the WHERE clause selecting the accounts matching
+// query, ignoring its page, and its arguments. The accounts keeping
+// organizations' contacts are left out.
+func (r *sqlUsers) userConditions(query UserQuery) (string, []interface{}) {
+	where := " WHERE NOT EXISTS (SELECT 1 FROM organizations o WHERE o.account_id = u.id)"
+	var args []interface{}
+	if query.Email != "" {
+		where += " AND u.email LIKE ?" + r.dialect.likeEscape
+		args = append(args, "%"+escapeLike(query.Email)+"%")
+	}
+	switch query.Status {
+	case UserActive:
+		where += " AND u.suspended_at IS NULL"
+	case UserSuspended:
+		where += " AND u.suspended_at IS NOT NULL"
+	}
+	return where, args
+}
+
+func (r *sqlUsers) List(ctx context.Context, query UserQuery) ([]models.AdminUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	where, args := r.userConditions(query)
+	if query.After != 0 {
+		where += " AND u.id > ?"
+		args = append(args, query.After)
+	}
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+adminUserColumns+" FROM users u"+where+" ORDER BY u.id LIMIT ?", append(args, query.Limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *sqlUsers) Count(ctx context.Context, query UserQuery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	where, args := r.userConditions(query)
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users u"+where, args...).Scan(&count)
+	return count, err
+}
+
+func (r *sqlUsers) Account(ctx context.Context, userID int) (models.AdminUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	user, err := scanAdminUser(r.db.QueryRowContext(ctx, "SELECT "+adminUserColumns+" FROM users u WHERE u.id = ?", userID))
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *sqlUsers) Suspend(ctx context.Context, userID int, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET suspended_at = ?, token_generation = token_generation + 1 WHERE id = ? AND suspended_at IS NULL",
+		at.UTC().Truncate(time.Second), userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+		return rows > 0, err
+	}
+	// Tell a suspended account from a missing one
+	var id int
+	err = r.db.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?", userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	return false, err
+}
+
+func (r *sqlUsers) Reactivate(ctx context.Context, userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET suspended_at = NULL WHERE id = ? AND suspended_at IS NOT NULL", userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RequirePasswordReset stores an empty password, which no password matches
+func (r *sqlUsers) RequirePasswordReset(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET password = '', password_reset_required = TRUE, token_generation = token_generation + 1 WHERE id = ?", userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var generation int
+	err = tx.QueryRowContext(ctx, "SELECT token_generation FROM users WHERE id = ?", userID).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return generation, nil
+}
+
+func (r *sqlUsers) ResetPassword(ctx context.Context, userID int, passwordHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET password = ?, password_reset_required = FALSE WHERE id = ? AND password_reset_required = TRUE",
+		passwordHash, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
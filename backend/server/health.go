@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+)
+
+const (
+	// dependencyCheckTimeout bounds each dependency check
+	dependencyCheckTimeout = 2 * time.Second
+	// startupCheckInterval is how often dependencies are rechecked while
+	// waiting for them at startup
+	startupCheckInterval = 2 * time.Second
+)
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// dependencyChecks returns checks of the dependencies the server needs to
+// serve requests, naming the database after its driver and the backup store
+// after its kind
+func (s *Server) dependencyChecks() map[string]func(ctx context.Context) error {
+	return map[string]func(ctx context.Context) error{
+		s.cfg.DBDriver:    s.store.DB.PingContext,
+		s.cfg.BackupStore: s.app.Backups().Ping,
+	}
+}
+
+// checkDependencies runs every dependency check concurrently
+func (s *Server) checkDependencies(ctx context.Context) models.HealthReport {
+	report := models.HealthReport{Status: healthOK, Dependencies: map[string]models.DependencyHealth{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range s.dependencyChecks() {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			result := models.DependencyHealth{
+				Status:    healthOK,
+				LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				result.Status = healthUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = result
+			if err != nil {
+				report.Status = healthUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// waitForDependencies blocks until every dependency is reachable, so the
+// server doesn't start serving while the database or backup store are still
+// coming up.
+// It fails once timeout has passed.
+func (s *Server) waitForDependencies(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		report := s.checkDependencies(context.Background())
+		if report.Status == healthOK {
+			return nil
+		}
+		for name, dep := range report.Dependencies {
+			if dep.Status != healthOK {
+				logging.Warnf("Waiting for %s: %s", name, dep.Error)
+			}
+		}
+		if time.Now().Add(startupCheckInterval).After(deadline) {
+			return fmt.Errorf("dependencies unavailable after %v", timeout)
+		}
+		time.Sleep(startupCheckInterval)
+	}
+}
+
+// getHealthz reports that the process is up, without checking dependencies,
+// for liveness probes
+func getHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    models.HealthReport{Status: healthOK},
+	})
+}
+
+// getReadyz reports whether the database and backup store are reachable, for readiness
+// probes and load balancers. It returns 503 if any dependency is unavailable.
+func (s *Server) getReadyz(c *gin.Context) {
+	report := s.checkDependencies(c.Request.Context())
+	if report.Status != healthOK {
+		c.JSON(http.StatusServiceUnavailable, models.Response{
+			Success: false,
+			Data:    report,
+			Error:   "Service unavailable",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    report,
+	})
+}
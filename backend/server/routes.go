@@ -0,0 +1,279 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/repository"
+)
+
+// recovery returns gin's panic recovery, with emails and phone numbers masked
+// in the panics and requests it reports
+func recovery() gin.HandlerFunc {
+	return gin.RecoveryWithWriter(logging.RedactWriter(gin.DefaultErrorWriter))
+}
+
+// newRouter returns the router with the middleware and routes of the API
+func (s *Server) newRouter() *gin.Engine {
+	cfg, app := s.cfg, s.app
+
+	// Create and configure router
+	r := gin.New()
+	// Without TRUSTED_PROXIES no proxy is trusted, so a client can't pick
+	// its IP with X-Forwarded-For. The proxies are validated by config.Load.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logging.Errorf("Failed to set trusted proxies: %v", err)
+	}
+
+	// CORS middleware
+	r.Use(middleware.CORS(cfg))
+
+	// Request ID and logging middleware
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Logger())
+
+	// Deadline for each request's queries and storage calls
+	r.Use(middleware.Timeout(cfg))
+
+	// Rate limiting middleware
+	r.Use(middleware.RateLimit(middleware.APILimiter, "all"))
+
+	// Request body size limits
+	r.Use(middleware.BodyLimit(cfg))
+
+	// Security headers
+	r.Use(middleware.SecurityHeaders(cfg))
+
+	// Recovery middleware, after Logger so that panicking requests are
+	// still logged with their request ID
+	r.Use(recovery())
+
+	// Initialize API routes
+	// Liveness and readiness probes
+	r.GET("/healthz", getHealthz)
+	r.GET("/readyz", s.getReadyz)
+
+	// Blocked IPs and countries can't reach the API
+	api := r.Group("/api", middleware.IPFilter(cfg, s.store))
+	{
+		// Public routes
+		api.POST("/auth/signup", middleware.AuthDelay(cfg), app.Signup)
+		api.POST("/auth/login", middleware.AuthDelay(cfg), app.Login)
+		api.POST("/auth/refresh", middleware.AuthDelay(cfg), app.RefreshToken)
+		api.GET("/auth/revoke-login", app.GetRevokeLogin)
+		api.POST("/auth/revoke-login", app.RevokeLogin)
+		api.GET("/auth/reset-password", app.GetResetPassword)
+		api.POST("/auth/reset-password", middleware.AuthDelay(cfg), app.ResetPassword)
+		api.GET("/invites/accept", app.GetAcceptInvite)
+		api.POST("/invites/accept", app.AcceptInvite)
+		api.GET("/invites/decline", app.GetDeclineInvite)
+		api.POST("/invites/decline", app.DeclineInvite)
+		api.GET("/calendar/birthdays.ics", app.GetBirthdayCalendar)
+		api.POST("/billing/webhook", app.StripeWebhook)
+		api.POST("/sms/webhook", app.ReceiveSMS)
+		api.GET("/integrations/:provider/callback", app.IntegrationCallback)
+		api.GET("/ifttt/oauth2/authorize", app.GetIFTTTAuthorize)
+		api.POST("/ifttt/oauth2/authorize", middleware.AuthDelay(cfg), app.IFTTTAuthorize)
+		api.POST("/ifttt/oauth2/token", middleware.AuthDelay(cfg), app.IFTTTToken)
+		api.GET("/openapi.json", app.GetOpenAPI)
+		api.GET("/docs", app.GetSwaggerUI)
+
+		// Routes that tokens with one of the given scopes may call, as well
+		// as signed-in users
+		scoped := func(scopes ...string) *gin.RouterGroup {
+			return api.Group("", middleware.Auth([]byte(cfg.JWTSecret), scopes...), middleware.ActiveAccount(s.store), middleware.Impersonation(s.store), middleware.Metering(s.store), middleware.Idempotency(cfg, s.store))
+		}
+		readContacts := scoped(middleware.ScopeReadContacts)
+		{
+			readContacts.GET("/contacts", app.GetContacts)
+			readContacts.GET("/contacts/duplicates", app.GetDuplicateContacts)
+			readContacts.GET("/contacts/:id", app.GetContact)
+			readContacts.GET("/contacts/:id/interactions", app.GetInteractions)
+			readContacts.GET("/contacts/:id/reminders", app.ListReminders)
+			readContacts.GET("/contacts/:id/profile", app.GetContactProfile)
+			readContacts.GET("/reminders", app.ListReminders)
+			readContacts.GET("/insights", app.GetInsights)
+			readContacts.GET("/insights/reconnect", app.GetReconnectSuggestions)
+			readContacts.GET("/sync", app.SyncContacts)
+			readContacts.GET("/hooks/zapier/sample", app.GetZapierSamples)
+		}
+
+		// IFTTT's service API, which IFTTT calls with the service key, and
+		// for a user's applets with the access token IFTTT was issued when
+		// the user connected
+		ifttt := api.Group("/ifttt/v1", middleware.IFTTTServiceKey(cfg))
+		{
+			ifttt.GET("/status", app.GetIFTTTStatus)
+			ifttt.POST("/test/setup", app.SetupIFTTTTest)
+			iftttScoped := func(scopes ...string) *gin.RouterGroup {
+				return ifttt.Group("", middleware.Auth([]byte(cfg.JWTSecret), scopes...), middleware.ActiveAccount(s.store), middleware.Impersonation(s.store), middleware.Metering(s.store), middleware.Idempotency(cfg, s.store))
+			}
+			iftttRead := iftttScoped(middleware.ScopeReadContacts)
+			iftttRead.GET("/user/info", app.GetIFTTTUser)
+			iftttRead.POST("/triggers/new_contact", app.IFTTTNewContactTrigger)
+			iftttRead.POST("/triggers/birthday_today", app.IFTTTBirthdayTrigger)
+			iftttScoped(middleware.ScopeWriteContacts).POST("/actions/create_contact", app.IFTTTCreateContact)
+		}
+		lookup := scoped(middleware.ScopeReadContacts, middleware.ScopeLookupContacts)
+		{
+			lookup.GET("/lookup", app.LookupPhone)
+			lookup.GET("/blocked-numbers", app.ListBlockedNumbers)
+		}
+		writeContacts := scoped(middleware.ScopeWriteContacts)
+		{
+			writeContacts.POST("/contacts", app.CreateContact)
+			writeContacts.POST("/hooks/zapier", middleware.NotImpersonating(), middleware.SecretResponse(), app.SubscribeZapier)
+			writeContacts.DELETE("/hooks/zapier/:id", app.UnsubscribeZapier)
+			writeContacts.PUT("/contacts/:id", app.UpdateContact)
+			writeContacts.DELETE("/contacts/:id", app.DeleteContact)
+			writeContacts.PUT("/contacts/:id/tags", app.UpdateContactTags)
+			writeContacts.PUT("/contacts/:id/last-interaction", app.UpdateLastInteraction)
+			writeContacts.POST("/contacts/:id/interactions", app.CreateInteraction)
+			writeContacts.DELETE("/contacts/:id/interactions/:interactionId", app.DeleteInteraction)
+			writeContacts.POST("/interactions/call-log", app.ImportCallLog)
+			writeContacts.PUT("/contacts/:id/birthday", app.UpdateBirthday)
+			writeContacts.POST("/contacts/:id/verify-phone", app.VerifyContactPhone)
+			writeContacts.PUT("/contacts/:id/profile", app.UpdateContactProfile)
+			writeContacts.POST("/contacts/:id/profile/reject", app.RejectContactEnrichment)
+			writeContacts.POST("/contacts/enrich", app.EnrichContacts)
+			writeContacts.POST("/contacts/:id/reminders", app.CreateReminder)
+			writeContacts.POST("/reminders/:id/snooze", app.SnoozeReminder)
+			writeContacts.POST("/reminders/:id/complete", app.CompleteReminder)
+			writeContacts.DELETE("/reminders/:id", app.DeleteReminder)
+			writeContacts.POST("/sync", app.PushChanges)
+			writeContacts.POST("/blocked-numbers", app.BlockNumber)
+			writeContacts.DELETE("/blocked-numbers/:id", app.UnblockNumber)
+		}
+		imports := scoped(middleware.ScopeWriteContacts, middleware.ScopeImportContacts)
+		{
+			imports.POST("/contacts/bulk", app.BulkCreateContacts)
+			imports.POST("/import/device", app.ImportDeviceContacts)
+		}
+		backup := scoped(middleware.ScopeBackup)
+		{
+			backup.POST("/backup", app.BackupContacts)
+			backup.GET("/backup", app.RestoreContacts)
+			backup.GET("/backup/preview", app.PreviewRestore)
+			backup.GET("/backup/export", app.ExportBackup)
+			backup.POST("/backup/import", app.ImportBackup)
+			backup.GET("/backups", app.ListBackups)
+			backup.GET("/jobs/:id", app.GetJob)
+			backup.GET("/backups/:id/verify", app.VerifyBackup)
+			backup.GET("/backups/:id/diff", app.DiffBackup)
+		}
+
+		// Routes only signed-in users may call
+		protected := api.Group("", middleware.Auth([]byte(cfg.JWTSecret)), middleware.ActiveAccount(s.store), middleware.Impersonation(s.store), middleware.Metering(s.store), middleware.Idempotency(cfg, s.store))
+		{
+			protected.DELETE("/backup/key", app.DeleteBackupKey)
+			protected.GET("/ws", app.ServeEvents)
+			protected.POST("/graphql", app.ServeGraphQL)
+			protected.GET("/graphql", app.ServeGraphQL)
+			protected.GET("/devices", app.ListDevices)
+			protected.POST("/devices/push-token", app.RegisterPushToken)
+			protected.DELETE("/devices/push-token", app.DeletePushToken)
+			protected.GET("/settings/notifications", app.GetNotificationSettings)
+			protected.PUT("/settings/notifications", app.UpdateNotificationSettings)
+			protected.GET("/settings/privacy", app.GetPrivacySettings)
+			protected.PUT("/settings/privacy", app.UpdatePrivacySettings)
+			protected.GET("/notifications/history", app.GetNotificationHistory)
+			protected.POST("/calendar/token", middleware.NotImpersonating(), middleware.SecretResponse(), app.CreateCalendarToken)
+			protected.POST("/webhooks", middleware.NotImpersonating(), middleware.SecretResponse(), app.CreateWebhook)
+			protected.GET("/webhooks", app.ListWebhooks)
+			protected.DELETE("/webhooks/:id", app.DeleteWebhook)
+			protected.GET("/webhooks/:id/deliveries", app.ListWebhookDeliveries)
+			protected.POST("/webhooks/:id/deliveries/:deliveryId/retry", app.RetryWebhookDelivery)
+			protected.DELETE("/calendar/token", app.DeleteCalendarToken)
+			protected.GET("/settings/sms-contacts", app.GetSMSContacts)
+			protected.POST("/settings/sms-contacts/code", middleware.NotImpersonating(), middleware.SecretResponse(), app.CreateSMSLinkCode)
+			protected.DELETE("/settings/sms-contacts", app.DeleteSMSContacts)
+			protected.POST("/import-tokens", middleware.NotImpersonating(), middleware.SecretResponse(), app.CreateImportToken)
+			protected.POST("/access-tokens", middleware.NotImpersonating(), middleware.SecretResponse(), app.CreateAccessToken)
+			protected.GET("/account/audit", app.GetAuditLog)
+			protected.GET("/account/export", app.ExportAccount)
+			protected.GET("/account/usage", app.GetUsage)
+			protected.GET("/billing", app.GetBilling)
+			protected.POST("/billing/checkout", middleware.NotImpersonating(), app.CreateCheckout)
+			protected.POST("/billing/portal", middleware.NotImpersonating(), app.CreateBillingPortal)
+			protected.GET("/account/deletion", app.GetAccountDeletion)
+			protected.POST("/account/deletion", middleware.NotImpersonating(), app.RequestAccountDeletion)
+			protected.DELETE("/account/deletion", app.CancelAccountDeletion)
+			protected.POST("/orgs", app.CreateOrganization)
+			protected.GET("/orgs", app.ListOrganizations)
+			protected.GET("/integrations", app.ListIntegrations)
+			protected.POST("/integrations/:provider", middleware.NotImpersonating(), app.ConnectIntegration)
+			protected.POST("/integrations/:provider/sync", app.SyncIntegration)
+			protected.DELETE("/integrations/:provider", app.DisconnectIntegration)
+		}
+
+		// Organizations, for their members. Owners and admins manage them,
+		// and every member works with the contacts they share.
+		org := protected.Group("/orgs/:org", middleware.Organization(s.store))
+		{
+			org.GET("", app.GetOrganization)
+			org.GET("/members", app.ListOrganizationMembers)
+			org.DELETE("/members/:user", app.RemoveOrganizationMember)
+			org.GET("/permissions", app.ListContactPermissions)
+		}
+		orgAdmin := org.Group("", middleware.OrganizationRole(repository.RoleOwner, repository.RoleAdmin))
+		{
+			orgAdmin.PUT("", app.UpdateOrganization)
+			orgAdmin.POST("/members", app.AddOrganizationMember)
+			orgAdmin.PUT("/members/:user", app.UpdateOrganizationMember)
+			orgAdmin.POST("/invites", app.InviteOrganizationMember)
+			orgAdmin.POST("/permissions", app.GrantContactPermission)
+			orgAdmin.DELETE("/permissions/:permission", app.RevokeContactPermission)
+		}
+		orgOwner := org.Group("", middleware.OrganizationRole(repository.RoleOwner))
+		{
+			orgOwner.DELETE("", app.DeleteOrganization)
+		}
+		orgContacts := org.Group("", middleware.OrganizationAccount())
+		{
+			orgContacts.GET("/contacts", app.GetContacts)
+			orgContacts.GET("/contacts/duplicates", app.GetDuplicateContacts)
+			orgContacts.GET("/contacts/:id", app.GetContact)
+			orgContacts.POST("/contacts", app.CreateContact)
+			orgContacts.PUT("/contacts/:id", app.UpdateContact)
+			orgContacts.DELETE("/contacts/:id", app.DeleteContact)
+			orgContacts.PUT("/contacts/:id/tags", app.UpdateContactTags)
+			orgContacts.PUT("/contacts/:id/birthday", app.UpdateBirthday)
+			orgContacts.POST("/contacts/:id/verify-phone", app.VerifyContactPhone)
+			orgContacts.POST("/backup", app.BackupContacts)
+			orgContacts.GET("/backups", app.ListBackups)
+			orgContacts.GET("/backups/:id/verify", app.VerifyBackup)
+			orgContacts.GET("/jobs/:id", app.GetJob)
+		}
+		// Restoring replaces the contacts everyone shares
+		orgContactsAdmin := orgContacts.Group("", middleware.OrganizationRole(repository.RoleOwner, repository.RoleAdmin))
+		{
+			orgContactsAdmin.GET("/backup", app.RestoreContacts)
+			orgContactsAdmin.GET("/backup/preview", app.PreviewRestore)
+			orgContactsAdmin.GET("/audit", app.GetAuditLog)
+			orgContactsAdmin.POST("/contacts/enrich", app.EnrichContacts)
+		}
+		orgContactsOwner := orgContacts.Group("", middleware.OrganizationRole(repository.RoleOwner))
+		{
+			orgContactsOwner.GET("/export", app.ExportOrganization)
+		}
+
+		// Admin routes, for the users listed in ADMIN_EMAILS
+		admin := protected.Group("/admin", middleware.AdminIPAllowlist(cfg, s.store), middleware.Admin(cfg, s.store))
+		{
+			admin.GET("/encryption", app.GetEncryptionStatus)
+			admin.POST("/encryption/rotate", app.RotateDataKey)
+			admin.POST("/encryption/reencrypt", app.ReencryptContacts)
+			admin.GET("/users", app.ListUsers)
+			admin.GET("/users/:id", app.GetUser)
+			admin.POST("/users/:id/suspend", app.SuspendUser)
+			admin.POST("/users/:id/reactivate", app.ReactivateUser)
+			admin.POST("/users/:id/password-reset", app.ResetUserPassword)
+			admin.GET("/users/:id/usage", app.GetUserUsage)
+			admin.POST("/users/:id/impersonate", middleware.SecretResponse(), app.ImpersonateUser)
+			admin.POST("/impersonations/:id/end", app.EndImpersonation)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,180 @@
+// Package server wires the configuration, storage, background workers and
+// routes together and runs the HTTP server
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"phonesaver-backend/config"
+	"phonesaver-backend/handlers"
+	"phonesaver-backend/logging"
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/repository"
+)
+
+// Server holds the configuration and dependencies of the API server
+type Server struct {
+	cfg   *config.Config
+	store *repository.Store
+	app   *handlers.App
+}
+
+// New connects to the database, Firebase, backup storage, email and SMS,
+// and creates the rate limiters of the server
+func New(cfg *config.Config) (*Server, error) {
+	// Validate required configuration
+	if cfg.JWTSecret == "" {
+		return nil, errors.New("JWT_SECRET environment variable is required")
+	}
+	if cfg.DBDriver == config.DBDriverMySQL && cfg.DBPassword == "" {
+		return nil, errors.New("DB_PASSWORD environment variable is required")
+	}
+
+	// Initialize database with connection pooling
+	store, err := repository.Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	// Initialize Firebase, backup storage, email and SMS
+	app, err := handlers.New(cfg, store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	if err := middleware.InitRateLimiters(cfg); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &Server{cfg: cfg, store: store, app: app}, nil
+}
+
+// Run starts the background workers and serves the API until the process is
+// asked to stop
+func (s *Server) Run() {
+	cfg, app := s.cfg, s.app
+
+	// Wait for MySQL and Firestore to be reachable
+	if err := s.waitForDependencies(cfg.StartupTimeout); err != nil {
+		logging.Fatal(err)
+	}
+
+	// Bring the database schema up to date
+	if err := prepareSchema(cfg); err != nil {
+		logging.Fatal(err)
+	}
+	if err := s.store.LoadDataKey(context.Background()); err != nil {
+		logging.Fatal(err)
+	}
+
+	if err := app.FailInterruptedJobs(); err != nil {
+		logging.Fatal(err)
+	}
+	go s.encryptPhones()
+
+	// Start backup retention worker
+	go app.RunBackupCleanup(cfg.BackupCleanupInterval)
+	go app.RunTombstoneCleanup(cfg.TombstoneRetention)
+	go app.RunAuditCleanup(cfg.AuditRetention)
+	go app.RunRefreshTokenCleanup()
+	go app.RunAccountDeletions()
+	go app.RunWebhookDeliveries()
+	go app.RunUsageRollups()
+	go app.RunImpersonationNotices()
+	go app.RunContactSyncs()
+	go app.RunContactEnrichment()
+
+	// Start notification scheduler
+	go app.RunBirthdayReminders()
+	go app.RunDigests()
+	go app.RunReminders()
+	go app.RunNotificationRetries()
+	go middleware.RunIdempotencyCleanup(s.store)
+
+	r := s.newRouter()
+	if err := handlers.LoadOpenAPI(r.Routes()); err != nil {
+		logging.Fatal(err)
+	}
+
+	// Start server
+	srv, redirect, err := newServers(r, cfg)
+	if err != nil {
+		logging.Fatal(err)
+	}
+	if srv.TLSConfig != nil {
+		logging.Infof("Server starting with TLS on port %s", cfg.ServerPort)
+	} else {
+		logging.Infof("Server starting on port %s", cfg.ServerPort)
+	}
+	if redirect != nil {
+		logging.Infof("Redirecting HTTP on port %s to HTTPS", cfg.TLSRedirectPort)
+	}
+	if err := serve(srv, redirect, cfg.ShutdownTimeout); err != nil {
+		logging.Fatal(err)
+	}
+	s.closeClients()
+	logging.Infof("Server stopped")
+}
+
+// encryptPhones encrypts the phone numbers stored before encryption was
+// enabled. Until it finishes they are read as they are but not found by
+// search.
+func (s *Server) encryptPhones() {
+	encrypted, err := s.store.EncryptPhones(context.Background())
+	if err != nil {
+		logging.Errorf("Failed to encrypt stored phone numbers: %v", err)
+		return
+	}
+	if encrypted > 0 {
+		logging.Infof("Encrypted %d stored phone numbers", encrypted)
+	}
+}
+
+// Handler returns the router of the API without starting the background
+// workers, for serving the API in tests
+func (s *Server) Handler() http.Handler {
+	return s.newRouter()
+}
+
+// Close closes the server's connections to the database and Firestore
+func (s *Server) Close() {
+	s.closeClients()
+}
+
+// Migrate applies pending database migrations without starting the server
+func Migrate(cfg *config.Config) {
+	if cfg.DBDriver == config.DBDriverMySQL && cfg.DBPassword == "" {
+		logging.Fatal("DB_PASSWORD environment variable is required")
+	}
+	version, err := repository.Migrate(cfg)
+	if err != nil {
+		logging.Fatal(err)
+	}
+	logging.Infof("Database schema is at version %d", version)
+}
+
+// prepareSchema applies pending migrations, or with AUTO_MIGRATE=false
+// refuses to start on a schema that is behind the server
+func prepareSchema(cfg *config.Config) error {
+	if cfg.AutoMigrate {
+		version, err := repository.Migrate(cfg)
+		if err != nil {
+			return err
+		}
+		logging.Infof("Database schema is at version %d", version)
+		return nil
+	}
+
+	version, latest, err := repository.SchemaVersion(cfg)
+	if err != nil {
+		return err
+	}
+	if version < latest {
+		return fmt.Errorf("database schema is at version %d but the server needs version %d; run with -migrate", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"phonesaver-backend/handlers"
+	"phonesaver-backend/logging"
+)
+
+// jobCancelGrace is how long jobs still running at the shutdown deadline are
+// given to stop after being cancelled
+const jobCancelGrace = 5 * time.Second
+
+// serve runs the API server, and the HTTPS redirect server if there is one,
+// until it receives SIGINT or SIGTERM. It then stops accepting connections
+// and waits up to timeout for in-flight requests and background jobs to
+// finish.
+func serve(srv, redirect *http.Server, timeout time.Duration) error {
+	srv.RegisterOnShutdown(handlers.BeginShutdown)
+	servers := []*http.Server{srv}
+	if redirect != nil {
+		servers = append(servers, redirect)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *http.Server) {
+			if s.TLSConfig != nil {
+				errs <- s.ListenAndServeTLS("", "")
+			} else {
+				errs <- s.ListenAndServe()
+			}
+		}(s)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	logging.Infof("Shutting down, draining requests for up to %v", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to drain requests: %v", err)
+		}
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+
+	if !handlers.WaitForJobs(shutdownCtx) {
+		logging.Warnf("Background jobs still running after %v; cancelling them", timeout)
+		handlers.CancelJobs()
+		graceCtx, cancel := context.WithTimeout(context.Background(), jobCancelGrace)
+		defer cancel()
+		if !handlers.WaitForJobs(graceCtx) {
+			return errors.New("background jobs did not stop after being cancelled")
+		}
+	}
+	return nil
+}
+
+// closeClients closes the connections to the database and backup store
+func (s *Server) closeClients() {
+	if err := s.app.Backups().Close(); err != nil {
+		logging.Errorf("Failed to close backup store: %v", err)
+	}
+	if err := s.store.Close(); err != nil {
+		logging.Errorf("Failed to close database: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"phonesaver-backend/config"
+)
+
+// newServers returns the API server and, when it serves TLS, a plain HTTP
+// server on TLS_REDIRECT_PORT that redirects to HTTPS and answers Let's
+// Encrypt challenges. Certificates come from TLS_CERT_FILE and TLS_KEY_FILE,
+// or are obtained automatically for ACME_DOMAINS.
+func newServers(handler http.Handler, cfg *config.Config) (*http.Server, *http.Server, error) {
+	srv := &http.Server{Addr: ":" + cfg.ServerPort, Handler: handler}
+
+	var redirectHandler http.Handler = redirectToHTTPS(cfg.ServerPort)
+	switch {
+	case len(cfg.ACMEDomains) > 0:
+		if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+			return nil, nil, fmt.Errorf("set either ACME_DOMAINS or TLS_CERT_FILE and TLS_KEY_FILE, not both")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		redirectHandler = manager.HTTPHandler(redirectHandler)
+	case cfg.TLSCertFile != "" || cfg.TLSKeyFile != "":
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must both be set to serve TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	default:
+		return srv, nil, nil
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.TLSRedirectPort == "" {
+		return srv, nil, nil
+	}
+	redirect := &http.Server{
+		Addr:              ":" + cfg.TLSRedirectPort,
+		Handler:           redirectHandler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv, redirect, nil
+}
+
+// redirectToHTTPS returns a handler that permanently redirects a plain HTTP
+// request to the same URL on the TLS port
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,564 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"phonesaver-backend/middleware"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// tokenLifetime is how long the access tokens issued at signup, login and
+// refresh are valid
+const tokenLifetime = 24 * time.Hour
+
+// loginRevocationLifetime is how long the link in a new-login alert can sign
+// that login out
+const loginRevocationLifetime = 7 * 24 * time.Hour
+
+// passwordResetLifetime is how long the link emailed to a user an admin
+// required to reset their password works
+const passwordResetLifetime = 7 * 24 * time.Hour
+
+// contactSyncStateLifetime is how long a user has to grant access on a
+// contact provider's consent screen
+const contactSyncStateLifetime = 10 * time.Minute
+
+// Auth signs users up and logs them in, issuing the tokens the API is
+// authenticated with
+type Auth struct {
+	users           repository.UserRepository
+	devices         repository.DeviceRepository
+	refreshTokens   repository.RefreshTokenRepository
+	networks        repository.LoginNetworkRepository
+	key             []byte
+	refreshLifetime time.Duration
+}
+
+// NewAuth returns the account service, signing access tokens with key and
+// issuing refresh tokens valid for refreshLifetime after their last use
+func NewAuth(users repository.UserRepository, devices repository.DeviceRepository,
+	refreshTokens repository.RefreshTokenRepository, networks repository.LoginNetworkRepository,
+	key []byte, refreshLifetime time.Duration) *Auth {
+	return &Auth{
+		users:           users,
+		devices:         devices,
+		refreshTokens:   refreshTokens,
+		networks:        networks,
+		key:             key,
+		refreshLifetime: refreshLifetime,
+	}
+}
+
+// Session is a signed-in user, the token their requests are authenticated
+// with and the refresh token that renews it
+type Session struct {
+	Token        string
+	RefreshToken string
+	UserID       int
+	Email        string
+	// DeviceID identifies the device that logged in, and is empty at signup
+	DeviceID string
+	// FamilyID identifies the login the refresh token descends from
+	FamilyID string
+	// NewDevice and NewNetwork are set at login when a user who has logged
+	// in before does so from a device or network they haven't used
+	NewDevice  bool
+	NewNetwork bool
+	// generation is the user's token generation, which access tokens are
+	// issued in
+	generation int
+}
+
+// LoginInput holds a user's credentials and the device and IP address they
+// log in from. A new device ID is chosen if DeviceID is empty.
+type LoginInput struct {
+	Email      string
+	Password   string
+	DeviceID   string
+	DeviceName string
+	IP         string
+}
+
+// Signup registers a user. The email and password are expected to have been
+// validated by the caller. An email that is already registered is reported
+// as ErrEmailTaken.
+func (s *Auth) Signup(ctx context.Context, email, password string) (Session, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	userID, err := s.users.Create(ctx, email, string(hashedPassword))
+	if err == repository.ErrDuplicate {
+		return Session{}, ErrEmailTaken
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	session := Session{UserID: userID, Email: email}
+	if err := s.issueTokens(ctx, &session, uuid.NewString()); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// Login checks a user's credentials and registers the device and network
+// they log in from, flagging either if it is new to them. Credentials that
+// don't match an account are reported as ErrInvalidCredentials, with the
+// session's UserID set if the email is registered so the failed attempt can
+// be audited. Users who must reset their password have none that matches.
+// Logins to a suspended account are reported as ErrAccountSuspended once
+// the password is checked, with the session's UserID set.
+func (s *Auth) Login(ctx context.Context, in LoginInput) (Session, error) {
+	user, err := s.Authenticate(ctx, in.Email, in.Password)
+	if err != nil {
+		return Session{UserID: user.ID}, err
+	}
+
+	// Register the device so its sync state can be tracked
+	deviceID := in.DeviceID
+	if deviceID == "" {
+		deviceID = uuid.NewString()
+	}
+	devices, err := s.devices.Count(ctx, user.ID)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to count devices: %v", err)
+	}
+	newDevice, err := s.devices.Register(ctx, user.ID, deviceID, in.DeviceName)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to register device: %v", err)
+	}
+	newNetwork := false
+	if network, ok := loginNetwork(in.IP); ok {
+		newNetwork, err = s.networks.Record(ctx, user.ID, network)
+		if err != nil {
+			return Session{}, fmt.Errorf("failed to record network: %v", err)
+		}
+	}
+
+	session := Session{UserID: user.ID, Email: user.Email, DeviceID: deviceID, generation: user.TokenGeneration}
+	// A user's first login has nothing to be compared to
+	if devices > 0 {
+		session.NewDevice = newDevice
+		session.NewNetwork = newNetwork
+	}
+	if err := s.issueTokens(ctx, &session, uuid.NewString()); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// Authenticate checks a user's credentials without signing them in, and
+// returns the user. It reports errors like Login, with the user's ID set if
+// the email is registered.
+func (s *Auth) Authenticate(ctx context.Context, email, password string) (models.User, error) {
+	user, err := s.users.GetByEmail(ctx, email)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to get user: %v", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return models.User{ID: user.ID}, ErrInvalidCredentials
+	}
+	if user.SuspendedAt != nil {
+		return models.User{ID: user.ID}, ErrAccountSuspended
+	}
+	return user, nil
+}
+
+// Refresh trades a refresh token for a new access token and the next refresh
+// token of its family, after which the old one can't be used again. Unknown,
+// expired and revoked tokens, and those of suspended users, are reported as
+// ErrInvalidRefreshToken. A token
+// that was already used has most likely been stolen, so its whole family is
+// revoked, signing out both the thief and the user, and ErrRefreshTokenReused
+// is returned with the session's UserID and DeviceID set so the user can be
+// warned.
+func (s *Auth) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	token, err := s.refreshTokens.GetByHash(ctx, hashRefreshToken(refreshToken))
+	if err == repository.ErrNotFound {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to get refresh token: %v", err)
+	}
+	if token.RevokedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	session := Session{UserID: token.UserID, DeviceID: token.DeviceID}
+	used := token.UsedAt != nil
+	if !used {
+		marked, err := s.refreshTokens.MarkUsed(ctx, token.ID)
+		if err != nil {
+			return Session{}, fmt.Errorf("failed to use refresh token: %v", err)
+		}
+		// Another request used the token first
+		used = !marked
+	}
+	if used {
+		if _, err := s.refreshTokens.RevokeFamily(ctx, token.FamilyID); err != nil {
+			return Session{}, fmt.Errorf("failed to revoke refresh tokens: %v", err)
+		}
+		return session, ErrRefreshTokenReused
+	}
+
+	user, err := s.users.Get(ctx, token.UserID)
+	if err == repository.ErrNotFound || (err == nil && user.SuspendedAt != nil) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	session.generation = user.TokenGeneration
+	if err := s.issueTokens(ctx, &session, token.FamilyID); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// VerifyPassword checks a signed-in user's password, before an action that
+// needs them to confirm who they are. A wrong password is reported as
+// ErrInvalidCredentials.
+func (s *Auth) VerifyPassword(ctx context.Context, userID int, password string) error {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// issueTokens signs an access token for the session's user and device, and
+// stores a new refresh token in family
+func (s *Auth) issueTokens(ctx context.Context, session *Session, family string) error {
+	token, err := s.issueToken(session.UserID, session.DeviceID, session.generation)
+	if err != nil {
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+	err = s.refreshTokens.Create(ctx, &models.RefreshToken{
+		UserID:    session.UserID,
+		FamilyID:  family,
+		TokenHash: hashRefreshToken(refreshToken),
+		DeviceID:  session.DeviceID,
+		ExpiresAt: time.Now().UTC().Add(s.refreshLifetime),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	session.Token = token
+	session.RefreshToken = refreshToken
+	session.FamilyID = family
+	return nil
+}
+
+// hashRefreshToken returns the hex SHA-256 hash a refresh token is stored
+// under
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueScopedToken signs a token that only grants scopes on a user's data,
+// for tools that shouldn't hold a full session, and returns it with its
+// expiry. It can't be refreshed.
+func (s *Auth) IssueScopedToken(ctx context.Context, userID int, scopes []string, lifetime time.Duration) (string, time.Time, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	expiresAt := time.Now().Add(lifetime).UTC().Truncate(time.Second)
+	token, err := s.sign(&middleware.Claims{
+		UserID:     userID,
+		Scopes:     scopes,
+		Generation: user.TokenGeneration,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+	return token, expiresAt, err
+}
+
+// IFTTTGrant is the access a user connected IFTTT with: a token reading and
+// writing their contacts until ExpiresAt, and the refresh token IFTTT renews
+// it with
+type IFTTTGrant struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// IssueIFTTTGrant issues the tokens of a user's connection to IFTTT, whose
+// access token is valid for lifetime. The refresh token is valid until the
+// refresh lifetime has passed after the access token expires, and, like a
+// session, stops working once the user is signed out everywhere.
+func (s *Auth) IssueIFTTTGrant(ctx context.Context, userID int, lifetime time.Duration) (IFTTTGrant, error) {
+	scopes := []string{middleware.ScopeReadContacts, middleware.ScopeWriteContacts}
+	token, expiresAt, err := s.IssueScopedToken(ctx, userID, scopes, lifetime)
+	if err != nil {
+		return IFTTTGrant{}, err
+	}
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return IFTTTGrant{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	refreshToken, err := s.sign(&middleware.Claims{
+		UserID:     userID,
+		Scopes:     []string{middleware.ScopeRefreshIFTTT},
+		Generation: user.TokenGeneration,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Add(s.refreshLifetime).Unix(),
+		},
+	})
+	if err != nil {
+		return IFTTTGrant{}, err
+	}
+	return IFTTTGrant{AccessToken: token, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+// RefreshIFTTTGrant issues new tokens for a refresh token from
+// IssueIFTTTGrant and returns them with the user's ID. Tokens that are
+// invalid, expired, not for IFTTT or from before the user was signed out
+// everywhere, and those of suspended users, are reported as
+// ErrInvalidRefreshToken.
+func (s *Auth) RefreshIFTTTGrant(ctx context.Context, refreshToken string, lifetime time.Duration) (IFTTTGrant, int, error) {
+	claims, err := middleware.ParseToken(s.key, refreshToken)
+	if err != nil || !claims.HasScope([]string{middleware.ScopeRefreshIFTTT}) {
+		return IFTTTGrant{}, 0, ErrInvalidRefreshToken
+	}
+	user, err := s.users.Get(ctx, claims.UserID)
+	if err == repository.ErrNotFound {
+		return IFTTTGrant{}, 0, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return IFTTTGrant{}, 0, fmt.Errorf("failed to get user: %v", err)
+	}
+	if claims.Generation != user.TokenGeneration || user.SuspendedAt != nil {
+		return IFTTTGrant{}, 0, ErrInvalidRefreshToken
+	}
+	grant, err := s.IssueIFTTTGrant(ctx, user.ID, lifetime)
+	return grant, user.ID, err
+}
+
+// IssueImpersonationToken signs a token that acts as the user of an
+// impersonation for its admin, and expires with it. Like a session, it
+// stops working once the user is signed out everywhere.
+func (s *Auth) IssueImpersonationToken(ctx context.Context, impersonation models.Impersonation) (string, error) {
+	user, err := s.users.Get(ctx, impersonation.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %v", err)
+	}
+	return s.sign(&middleware.Claims{
+		UserID:       impersonation.UserID,
+		Generation:   user.TokenGeneration,
+		Impersonator: impersonation.AdminID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        strconv.Itoa(impersonation.ID),
+			ExpiresAt: impersonation.ExpiresAt.Unix(),
+		},
+	})
+}
+
+// IssueLoginRevocationToken signs a token that can sign out a session's
+// login, for the user to follow if they don't recognise it
+func (s *Auth) IssueLoginRevocationToken(session Session) (string, error) {
+	return s.sign(&middleware.Claims{
+		UserID:   session.UserID,
+		DeviceID: session.DeviceID,
+		Scopes:   []string{middleware.ScopeRevokeLogin},
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.FamilyID,
+			ExpiresAt: time.Now().Add(loginRevocationLifetime).Unix(),
+		},
+	})
+}
+
+// RevokeLogin signs out the login a revocation token was issued for: its
+// refresh tokens are revoked and its device forgotten. The login's access
+// token stays valid until it expires. Tokens that are invalid, expired or
+// not for revoking a login are reported as ErrInvalidRevocationToken.
+func (s *Auth) RevokeLogin(ctx context.Context, token string) (Session, error) {
+	claims, err := middleware.ParseToken(s.key, token)
+	if err != nil || !claims.HasScope([]string{middleware.ScopeRevokeLogin}) || claims.Id == "" {
+		return Session{}, ErrInvalidRevocationToken
+	}
+	if _, err := s.refreshTokens.RevokeFamily(ctx, claims.Id); err != nil {
+		return Session{}, fmt.Errorf("failed to revoke refresh tokens: %v", err)
+	}
+	if claims.DeviceID != "" {
+		if _, err := s.devices.Delete(ctx, claims.UserID, claims.DeviceID); err != nil {
+			return Session{}, fmt.Errorf("failed to delete device: %v", err)
+		}
+	}
+	return Session{UserID: claims.UserID, DeviceID: claims.DeviceID, FamilyID: claims.Id}, nil
+}
+
+// IssuePasswordResetToken signs a token that sets the new password of a
+// user an admin required to reset it, in the token generation the reset
+// started. It only works until the password is reset or another reset is
+// required.
+func (s *Auth) IssuePasswordResetToken(userID, generation int) (string, error) {
+	return s.sign(&middleware.Claims{
+		UserID:     userID,
+		Scopes:     []string{middleware.ScopeResetPassword},
+		Generation: generation,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(passwordResetLifetime).Unix(),
+		},
+	})
+}
+
+// ResetPassword sets the new password of a user who was required to reset
+// it, with a token from IssuePasswordResetToken, and returns their ID. The
+// password is expected to have been validated by the caller. Tokens that are
+// invalid, expired, not for resetting a password or for an earlier reset are
+// reported as ErrInvalidResetToken.
+func (s *Auth) ResetPassword(ctx context.Context, token, password string) (int, error) {
+	claims, err := middleware.ParseToken(s.key, token)
+	if err != nil || !claims.HasScope([]string{middleware.ScopeResetPassword}) {
+		return 0, ErrInvalidResetToken
+	}
+	user, err := s.users.Get(ctx, claims.UserID)
+	if err == repository.ErrNotFound {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user: %v", err)
+	}
+	if !user.PasswordResetRequired || claims.Generation != user.TokenGeneration {
+		return 0, ErrInvalidResetToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password: %v", err)
+	}
+	reset, err := s.users.ResetPassword(ctx, user.ID, string(hashedPassword))
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset password: %v", err)
+	}
+	// Another request used the token first
+	if !reset {
+		return 0, ErrInvalidResetToken
+	}
+	return user.ID, nil
+}
+
+// IssueInviteToken signs a token that accepts or declines an invitation to
+// an organization until expiresAt
+func (s *Auth) IssueInviteToken(inviteID int, expiresAt time.Time) (string, error) {
+	return s.sign(&middleware.Claims{
+		Scopes: []string{middleware.ScopeAnswerInvite},
+		StandardClaims: jwt.StandardClaims{
+			Id:        strconv.Itoa(inviteID),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+}
+
+// ParseInviteToken returns the invitation a token from IssueInviteToken
+// answers. Tokens that are invalid, expired or not for an invitation are
+// reported as ErrInvalidInviteToken.
+func (s *Auth) ParseInviteToken(token string) (int, error) {
+	claims, err := middleware.ParseToken(s.key, token)
+	if err != nil || !claims.HasScope([]string{middleware.ScopeAnswerInvite}) {
+		return 0, ErrInvalidInviteToken
+	}
+	inviteID, err := strconv.Atoi(claims.Id)
+	if err != nil {
+		return 0, ErrInvalidInviteToken
+	}
+	return inviteID, nil
+}
+
+// IssueContactSyncState signs the state a user is sent to a contact
+// provider's consent screen with, which identifies them when the provider
+// sends them back
+func (s *Auth) IssueContactSyncState(userID int, provider string) (string, error) {
+	return s.sign(&middleware.Claims{
+		UserID: userID,
+		Scopes: []string{middleware.ScopeConnectContacts},
+		StandardClaims: jwt.StandardClaims{
+			Id:        provider,
+			ExpiresAt: time.Now().Add(contactSyncStateLifetime).Unix(),
+		},
+	})
+}
+
+// ParseContactSyncState returns the user a state from
+// IssueContactSyncState was issued to. States that are invalid, expired or
+// for another provider are reported as ErrInvalidSyncState.
+func (s *Auth) ParseContactSyncState(state, provider string) (int, error) {
+	claims, err := middleware.ParseToken(s.key, state)
+	if err != nil || !claims.HasScope([]string{middleware.ScopeConnectContacts}) || claims.Id != provider {
+		return 0, ErrInvalidSyncState
+	}
+	return claims.UserID, nil
+}
+
+// loginNetwork returns the network a login from ip is attributed to, its
+// IPv4 /24 or IPv6 /48, so that an address changing within a provider's
+// range isn't flagged
+func loginNetwork(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return prefix.String(), true
+}
+
+// issueToken signs a token for a user's device in their token generation
+func (s *Auth) issueToken(userID int, deviceID string, generation int) (string, error) {
+	return s.sign(&middleware.Claims{
+		UserID:     userID,
+		DeviceID:   deviceID,
+		Generation: generation,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(tokenLifetime).Unix(),
+		},
+	})
+}
+
+// sign signs claims with the service's key
+func (s *Auth) sign(claims *middleware.Claims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return token, nil
+}
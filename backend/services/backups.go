@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"phonesaver-backend/logging"
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// backupChunkSize is the number of changes written to the store per call,
+// which is also the granularity of progress reporting
+const backupChunkSize = repository.FirestoreBatchLimit
+
+// Backups copies users' contacts to the backup store and reads them back,
+// recording a manifest of each backup run in the database
+type Backups struct {
+	db       *sql.DB
+	contacts repository.ContactRepository
+	store    repository.BackupStore
+}
+
+// NewBackups returns the backup service
+func NewBackups(store *repository.Store, backups repository.BackupStore) *Backups {
+	return &Backups{db: store.DB, contacts: store.Contacts, store: backups}
+}
+
+// QuotaError is returned when a backup is larger than the storage quota
+type QuotaError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("Backup of %d bytes exceeds the storage quota of %d bytes", e.Size, e.Limit)
+}
+
+// BackupInput selects how a user's contacts are backed up
+type BackupInput struct {
+	UserID int
+	// Key encrypts the backup, which is stored in plain form if it is nil
+	Key []byte
+	// Full rewrites every contact instead of only those changed since the
+	// last completed backup
+	Full bool
+	// MaxBytes is the storage quota of the user's backup, or 0 for none
+	MaxBytes int64
+	// Progress, if set, is called as changes are written to the store
+	Progress func(done, total int)
+}
+
+// Backup writes the user's contacts to the backup store and returns the
+// manifest of the run. Only contacts changed since the last completed backup
+// are written and contacts that no longer exist are deleted, unless a full
+// backup is requested or encryption was turned on or off. A user without
+// contacts, in their account or the store, is reported as ErrNoContacts, and
+// a backup over the quota as a *QuotaError.
+func (s *Backups) Backup(ctx context.Context, in BackupInput) (*models.BackupManifest, error) {
+	progress := in.Progress
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	// The next delta rewrites contacts changed since the snapshot was taken,
+	// so its time is taken before the contacts are loaded, in the whole
+	// seconds the DATETIME column keeps
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	contacts, err := s.contacts.ListAll(ctx, in.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contacts for backup: %v", err)
+	}
+
+	// A user who deleted every contact still has them deleted from the store
+	if len(contacts) == 0 {
+		stored, err := s.store.ListContactIDs(ctx, in.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch existing contacts: %v", err)
+		}
+		if len(stored) == 0 {
+			return nil, ErrNoContacts
+		}
+	}
+
+	// Find the previous completed run to compute the delta against
+	var since sql.NullTime
+	var wasEncrypted bool
+	err = s.db.QueryRowContext(ctx,
+		"SELECT started_at, encrypted FROM backups WHERE user_id = ? AND status = 'completed' ORDER BY started_at DESC LIMIT 1",
+		in.UserID,
+	).Scan(&since, &wasEncrypted)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to fetch previous backup: %v", err)
+	}
+
+	size := BackupSize(contacts)
+	if in.MaxBytes > 0 && size > in.MaxBytes {
+		return nil, &QuotaError{Size: size, Limit: in.MaxBytes}
+	}
+
+	// Enabling or disabling encryption rewrites every record
+	mode := "delta"
+	if !since.Valid || in.Full || wasEncrypted != (in.Key != nil) {
+		mode = "full"
+	}
+
+	manifest := &models.BackupManifest{
+		UserID:    in.UserID,
+		Mode:      mode,
+		Status:    "running",
+		Total:     len(contacts),
+		Encrypted: in.Key != nil,
+		SizeBytes: size,
+		StartedAt: startedAt,
+	}
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO backups (user_id, mode, status, total, encrypted, size_bytes, started_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		manifest.UserID, manifest.Mode, manifest.Status, manifest.Total, manifest.Encrypted, manifest.SizeBytes, manifest.StartedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record backup manifest: %v", err)
+	}
+	backupID, err := result.LastInsertId()
+	if err != nil {
+		logging.Errorf("Failed to get backup ID: %v", err)
+	}
+	manifest.ID = int(backupID)
+
+	existingIDs, err := s.store.ListContactIDs(ctx, manifest.UserID)
+	if err != nil {
+		s.fail(ctx, manifest.ID, 0)
+		return nil, fmt.Errorf("failed to fetch existing contacts: %v", err)
+	}
+
+	existing := make(map[string]bool, len(existingIDs))
+	for _, id := range existingIDs {
+		existing[id] = true
+	}
+
+	// Collect new and changed contacts
+	var upserts []repository.BackupRecord
+	current := make(map[string]bool, len(contacts))
+	for _, contact := range contacts {
+		docID := strconv.Itoa(contact.ID)
+		current[docID] = true
+
+		if mode == "delta" && existing[docID] && contact.UpdatedAt.Before(since.Time) {
+			manifest.Unchanged++
+			continue
+		}
+
+		record, err := sealContact(contact, in.Key, manifest.StartedAt)
+		if err != nil {
+			s.fail(ctx, manifest.ID, 0)
+			return nil, fmt.Errorf("failed to seal contact for backup: %v", err)
+		}
+		upserts = append(upserts, record)
+	}
+
+	// Remove documents for contacts deleted since the last run
+	var deletes []string
+	for docID := range existing {
+		if !current[docID] {
+			deletes = append(deletes, docID)
+		}
+	}
+
+	total := len(upserts) + len(deletes)
+	done := 0
+	progress(done, total)
+	save := func(upserts []repository.BackupRecord, deletes []string) error {
+		if err := s.store.SaveContacts(ctx, manifest.UserID, upserts, deletes); err != nil {
+			// Contacts written before the failure are rewritten by the next run,
+			// since deltas are computed from the last completed backup
+			committed := done
+			var partial *repository.PartialWriteError
+			if errors.As(err, &partial) {
+				committed += partial.Committed
+			}
+			s.fail(ctx, manifest.ID, committed)
+			return fmt.Errorf("failed to backup contacts: %v", err)
+		}
+		done += len(upserts) + len(deletes)
+		progress(done, total)
+		return nil
+	}
+	for start := 0; start < len(upserts); start += backupChunkSize {
+		if err := save(upserts[start:min(start+backupChunkSize, len(upserts))], nil); err != nil {
+			return nil, err
+		}
+	}
+	for start := 0; start < len(deletes); start += backupChunkSize {
+		if err := save(nil, deletes[start:min(start+backupChunkSize, len(deletes))]); err != nil {
+			return nil, err
+		}
+	}
+	manifest.Written = len(upserts)
+	manifest.Deleted = len(deletes)
+
+	completedAt := time.Now().UTC()
+	manifest.Status = "completed"
+	manifest.Checksum = BackupChecksum(contacts)
+	manifest.CompletedAt = &completedAt
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE backups SET status = ?, written = ?, deleted = ?, unchanged = ?, checksum = ?, completed_at = ? WHERE id = ?",
+		manifest.Status, manifest.Written, manifest.Deleted, manifest.Unchanged, manifest.Checksum, completedAt, manifest.ID,
+	)
+	if err != nil {
+		logging.Errorf("Failed to update backup manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// fail marks a backup run as failed, recording how many changes were
+// committed to the store before the failure
+func (s *Backups) fail(ctx context.Context, backupID, committed int) {
+	// The failure is recorded even if it was the context expiring
+	_, err := s.db.ExecContext(context.WithoutCancel(ctx),
+		"UPDATE backups SET status = 'failed', written = ?, completed_at = ? WHERE id = ?",
+		committed, time.Now().UTC(), backupID,
+	)
+	if err != nil {
+		logging.Errorf("Failed to mark backup %d as failed: %v", backupID, err)
+	}
+}
+
+// LoadContacts loads and decrypts every contact in the user's backup. An
+// encrypted backup read without its key is reported as ErrSealedBackup.
+func (s *Backups) LoadContacts(ctx context.Context, userID int, key []byte) ([]models.Contact, error) {
+	records, err := s.store.LoadContacts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	contacts := make([]models.Contact, 0, len(records))
+	for _, record := range records {
+		contact, err := openRecord(record, key)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, nil
+}
+
+// sealContact builds the stored record for a contact, encrypting it with key
+// when one is given
+func sealContact(contact models.Contact, key []byte, timestamp time.Time) (repository.BackupRecord, error) {
+	if key == nil {
+		return repository.BackupRecord{Contact: contact, BackupTimestamp: timestamp}, nil
+	}
+
+	plaintext, err := json.Marshal(contact)
+	if err != nil {
+		return repository.BackupRecord{}, err
+	}
+	gcm, err := backupCipher(key)
+	if err != nil {
+		return repository.BackupRecord{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return repository.BackupRecord{}, err
+	}
+
+	return repository.BackupRecord{
+		Contact:         models.Contact{ID: contact.ID, UpdatedAt: contact.UpdatedAt},
+		Sealed:          gcm.Seal(nonce, nonce, plaintext, []byte(fmt.Sprint(contact.ID))),
+		BackupTimestamp: timestamp,
+	}, nil
+}
+
+// openRecord returns the contact held in a stored record
+func openRecord(record repository.BackupRecord, key []byte) (models.Contact, error) {
+	if record.Sealed == nil {
+		return record.Contact, nil
+	}
+	if key == nil {
+		return models.Contact{}, ErrSealedBackup
+	}
+
+	gcm, err := backupCipher(key)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	if len(record.Sealed) < gcm.NonceSize() {
+		return models.Contact{}, fmt.Errorf("sealed contact %d is truncated", record.ID)
+	}
+	nonce, ciphertext := record.Sealed[:gcm.NonceSize()], record.Sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(fmt.Sprint(record.ID)))
+	if err != nil {
+		return models.Contact{}, fmt.Errorf("failed to decrypt contact %d: %v", record.ID, err)
+	}
+
+	var contact models.Contact
+	if err := json.Unmarshal(plaintext, &contact); err != nil {
+		return models.Contact{}, err
+	}
+	return contact, nil
+}
+
+func backupCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// BackupSize estimates the stored size of a backup of the given contacts
+func BackupSize(contacts []models.Contact) int64 {
+	var size int64
+	for _, contact := range contacts {
+		data, err := json.Marshal(contact)
+		if err != nil {
+			continue
+		}
+		size += int64(len(data))
+	}
+	return size
+}
+
+// checksumEntry is the canonical form of a contact used for backup checksums
+type checksumEntry struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Phone           string    `json:"phone"`
+	EncryptedPhone  string    `json:"encrypted_phone"`
+	Tags            []string  `json:"tags"`
+	LastInteraction time.Time `json:"last_interaction"`
+	Birthday        time.Time `json:"birthday"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// BackupChecksum computes an order-independent SHA-256 digest of a set of
+// backed-up contacts. Timestamps are truncated to seconds so the digest is
+// stable across stores with different time precision.
+func BackupChecksum(contacts []models.Contact) string {
+	sorted := make([]models.Contact, len(contacts))
+	copy(sorted, contacts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, contact := range sorted {
+		tags := contact.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		enc.Encode(checksumEntry{
+			ID:              contact.ID,
+			Name:            contact.Name,
+			Phone:           contact.Phone,
+			EncryptedPhone:  contact.EncryptedPhone,
+			Tags:            tags,
+			LastInteraction: contact.LastInteraction.UTC().Truncate(time.Second),
+			Birthday:        contact.Birthday.UTC().Truncate(time.Second),
+			UpdatedAt:       contact.UpdatedAt.UTC().Truncate(time.Second),
+		})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+// Contacts manages users' contacts
+type Contacts struct {
+	contacts repository.ContactRepository
+}
+
+// NewContacts returns the contact service over a contact repository
+func NewContacts(contacts repository.ContactRepository) *Contacts {
+	return &Contacts{contacts: contacts}
+}
+
+// List returns a user's contacts matching query. An invalid filter
+// expression is reported as a *repository.FilterError.
+func (s *Contacts) List(ctx context.Context, userID int, query repository.ContactQuery) ([]models.Contact, error) {
+	return s.contacts.List(ctx, userID, query)
+}
+
+// Get returns one of a user's contacts, or repository.ErrNotFound
+func (s *Contacts) Get(ctx context.Context, userID, contactID int) (models.Contact, error) {
+	return s.contacts.Get(ctx, userID, contactID)
+}
+
+// FindByPhone returns a user's contacts whose phone number is phone,
+// ignoring formatting
+func (s *Contacts) FindByPhone(ctx context.Context, userID int, phone string) ([]models.Contact, error) {
+	return s.contacts.FindByPhone(ctx, userID, phone)
+}
+
+// Duplicates returns the groups of a user's contacts that share a phone
+// number
+func (s *Contacts) Duplicates(ctx context.Context, userID int) ([][]models.Contact, error) {
+	return s.contacts.ListDuplicates(ctx, userID)
+}
+
+// Create stores a new contact for a user, setting its ID and version
+func (s *Contacts) Create(ctx context.Context, userID int, contact *models.Contact) error {
+	contact.UserID = userID
+	return s.contacts.Create(ctx, contact)
+}
+
+// CreateAll stores several new contacts for a user, all or none of them
+func (s *Contacts) CreateAll(ctx context.Context, userID int, contacts []models.Contact) error {
+	return s.contacts.Transaction(ctx, func(tx repository.ContactTx) error {
+		for _, contact := range contacts {
+			contact.UserID = userID
+			if err := tx.Create(&contact); err != nil {
+				return fmt.Errorf("failed to create contact: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Delete deletes one of a user's contacts and reports whether it existed
+func (s *Contacts) Delete(ctx context.Context, userID, contactID int) (bool, error) {
+	return s.contacts.Delete(ctx, userID, contactID)
+}
+
+// ContactIndex looks up contacts by ID or normalized phone number, so
+// copies of a contact from a backup or another device can be matched to it
+type ContactIndex struct {
+	byID    map[int]*models.Contact
+	byPhone map[string]*models.Contact
+}
+
+// NewContactIndex indexes contacts, which must not be modified while the
+// index is in use
+func NewContactIndex(contacts []models.Contact) *ContactIndex {
+	idx := &ContactIndex{
+		byID:    make(map[int]*models.Contact, len(contacts)),
+		byPhone: make(map[string]*models.Contact, len(contacts)),
+	}
+	for i := range contacts {
+		contact := &contacts[i]
+		idx.byID[contact.ID] = contact
+		if phone := repository.NormalizePhone(contact.Phone); phone != "" {
+			idx.byPhone[phone] = contact
+		}
+	}
+	return idx
+}
+
+// Match returns the indexed contact corresponding to contact, or nil
+func (idx *ContactIndex) Match(contact models.Contact) *models.Contact {
+	if local, ok := idx.byID[contact.ID]; ok && contact.ID != 0 {
+		return local
+	}
+	if phone := repository.NormalizePhone(contact.Phone); phone != "" {
+		return idx.byPhone[phone]
+	}
+	return nil
+}
+
+// ChangedFields returns the JSON names of the fields that differ between two
+// versions of a contact
+func ChangedFields(a, b models.Contact) []string {
+	var fields []string
+	if a.Name != b.Name {
+		fields = append(fields, "name")
+	}
+	if a.Phone != b.Phone {
+		fields = append(fields, "phone")
+	}
+	if a.EncryptedPhone != b.EncryptedPhone {
+		fields = append(fields, "encrypted_phone")
+	}
+	if strings.Join(a.Tags, ",") != strings.Join(b.Tags, ",") {
+		fields = append(fields, "tags")
+	}
+	if !a.LastInteraction.Equal(b.LastInteraction) {
+		fields = append(fields, "last_interaction")
+	}
+	if !a.Birthday.Equal(b.Birthday) {
+		fields = append(fields, "birthday")
+	}
+	return fields
+}
+
+// ContactsEqual reports whether two contacts hold the same user-visible data
+func ContactsEqual(a, b models.Contact) bool {
+	return len(ChangedFields(a, b)) == 0
+}
+
+// DiffContacts compares backed-up contacts with the current ones. Contacts
+// are matched by ID or normalized phone number.
+func DiffContacts(backup, current []models.Contact) models.BackupDiff {
+	diff := models.BackupDiff{
+		Added:   []models.ContactChange{},
+		Removed: []models.ContactChange{},
+		Changed: []models.ContactChange{},
+	}
+	idx := NewContactIndex(current)
+	matched := make(map[int]bool, len(current))
+
+	for _, old := range backup {
+		now := idx.Match(old)
+		if now == nil {
+			diff.Removed = append(diff.Removed, models.ContactChange{ID: old.ID, Name: old.Name})
+			continue
+		}
+		matched[now.ID] = true
+		if fields := ChangedFields(old, *now); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, models.ContactChange{ID: now.ID, Name: now.Name, Fields: fields})
+		}
+	}
+
+	for _, contact := range current {
+		if !matched[contact.ID] {
+			diff.Added = append(diff.Added, models.ContactChange{ID: contact.ID, Name: contact.Name})
+		}
+	}
+	return diff
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"phonesaver-backend/models"
+	"phonesaver-backend/repository"
+)
+
+const (
+	// RestoreModeReplace deletes all local contacts before restoring
+	RestoreModeReplace = "replace"
+	// RestoreModeMerge upserts restored contacts and keeps newer local edits
+	RestoreModeMerge = "merge"
+)
+
+// PlanRestore compares backed-up contacts with local ones. A conflict is a
+// local contact edited after the backed-up copy was taken: a replace restore
+// discards those edits while a merge restore keeps them.
+func PlanRestore(mode string, local, backup []models.Contact) models.RestorePlan {
+	plan := models.RestorePlan{Mode: mode, ConflictIDs: []int{}}
+	idx := NewContactIndex(local)
+	matched := make(map[int]bool, len(local))
+
+	for _, contact := range backup {
+		existing := idx.Match(contact)
+		if existing == nil {
+			plan.Adds++
+			continue
+		}
+		matched[existing.ID] = true
+
+		switch {
+		case ContactsEqual(*existing, contact):
+			plan.Unchanged++
+		case existing.UpdatedAt.After(contact.UpdatedAt):
+			plan.Conflicts++
+			plan.ConflictIDs = append(plan.ConflictIDs, existing.ID)
+		default:
+			plan.Overwrites++
+		}
+	}
+
+	if mode == RestoreModeReplace {
+		for _, contact := range local {
+			if !matched[contact.ID] {
+				plan.Deletions++
+			}
+		}
+	}
+	return plan
+}
+
+// Restore restores contacts for a user in the given mode and returns a
+// summary of the changes made
+func (s *Contacts) Restore(ctx context.Context, userID int, mode string, contacts []models.Contact) (models.RestorePlan, error) {
+	local, err := s.contacts.ListAll(ctx, userID)
+	if err != nil {
+		return models.RestorePlan{}, fmt.Errorf("failed to load local contacts: %v", err)
+	}
+
+	plan := PlanRestore(mode, local, contacts)
+	if mode == RestoreModeMerge {
+		err = s.merge(ctx, userID, local, contacts)
+	} else {
+		err = s.replace(ctx, userID, contacts)
+	}
+	return plan, err
+}
+
+// merge upserts restored contacts, matching them to local contacts by ID or
+// normalized phone. Local contacts edited after the backed-up copy are left
+// untouched and no local contacts are deleted.
+func (s *Contacts) merge(ctx context.Context, userID int, local, contacts []models.Contact) error {
+	idx := NewContactIndex(local)
+
+	return s.contacts.Transaction(ctx, func(tx repository.ContactTx) error {
+		for _, contact := range contacts {
+			existing := idx.Match(contact)
+			var err error
+			switch {
+			case existing == nil:
+				contact.UserID = userID
+				err = tx.Create(&contact)
+			case ContactsEqual(*existing, contact), existing.UpdatedAt.After(contact.UpdatedAt):
+				continue
+			default:
+				patch := repository.EditableFields(contact)
+				patch.LastInteraction = &contact.LastInteraction
+				err = tx.Update(userID, existing.ID, patch)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to merge restored contact: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// replace atomically replaces all of a user's contacts
+func (s *Contacts) replace(ctx context.Context, userID int, contacts []models.Contact) error {
+	return s.contacts.Transaction(ctx, func(tx repository.ContactTx) error {
+		// Delete existing contacts
+		if err := tx.DeleteAll(userID); err != nil {
+			return fmt.Errorf("failed to delete existing contacts: %v", err)
+		}
+
+		// Insert restored contacts
+		for _, contact := range contacts {
+			contact.UserID = userID
+			if err := tx.Create(&contact); err != nil {
+				return fmt.Errorf("failed to insert restored contact: %v", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,42 @@
+// Package services implements the business rules of accounts, contacts and
+// backups on top of the repositories. Inputs and results are plain Go values,
+// so the rules can be used and tested without an HTTP request.
+package services
+
+import "errors"
+
+var (
+	// ErrInvalidCredentials is returned when a login's email or password
+	// does not match an account
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidRefreshToken is returned when refreshing with a refresh
+	// token that is unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when refreshing with a refresh token
+	// that was already used, after its family has been revoked
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+	// ErrInvalidRevocationToken is returned when signing out a login with a
+	// token that is invalid, expired or not for revoking a login
+	ErrInvalidRevocationToken = errors.New("invalid revocation token")
+	// ErrInvalidResetToken is returned when resetting a password with a
+	// token that is invalid, expired or no longer usable
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	// ErrInvalidInviteToken is returned when answering an invitation to an
+	// organization with a token that is invalid or expired
+	ErrInvalidInviteToken = errors.New("invalid invite token")
+	// ErrInvalidSyncState is returned when finishing a connection to a
+	// contact provider with a state that is invalid, expired or for another
+	// provider
+	ErrInvalidSyncState = errors.New("invalid contact sync state")
+	// ErrAccountSuspended is returned when logging in to an account an
+	// admin has suspended
+	ErrAccountSuspended = errors.New("account suspended")
+	// ErrEmailTaken is returned when signing up with an email that is already
+	// registered
+	ErrEmailTaken = errors.New("email already exists")
+	// ErrNoContacts is returned when backing up a user who has no contacts
+	ErrNoContacts = errors.New("no contacts to backup")
+	// ErrSealedBackup is returned when reading an encrypted backup without
+	// its key
+	ErrSealedBackup = errors.New("backup is encrypted and no backup key was supplied")
+)
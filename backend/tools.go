@@ -0,0 +1,8 @@
+//go:build tools
+
+// Package main tracks the code generators used by go generate
+package main
+
+import (
+	_ "github.com/99designs/gqlgen"
+)